@@ -0,0 +1,53 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+// addAccountIDs adds the service account's SID and GUID to the response if
+// the config asks for them. The response's data may be cached, so it's copied
+// rather than changed. The password is what was asked for, so if the IDs
+// can't be looked up, it's returned with a warning instead of failing.
+func (b *backend) addAccountIDs(engineConf *configuration, serviceAccountName string, resp *logical.Response) {
+	if !engineConf.IncludeAccountIDs || resp == nil || resp.Data == nil {
+		return
+	}
+	sid, guid, err := b.accountIDs(engineConf, serviceAccountName)
+	if err != nil {
+		b.Logger().Warn("unable to look up account IDs", "service_account_name", serviceAccountName, "error", err)
+		resp.AddWarning(fmt.Sprintf("unable to look up the SID and GUID of %q: %s", serviceAccountName, err))
+		return
+	}
+	data := make(map[string]interface{}, len(resp.Data)+2)
+	for k, v := range resp.Data {
+		data[k] = v
+	}
+	data["object_sid"] = sid
+	data["object_guid"] = guid
+	resp.Data = data
+}
+
+func (b *backend) accountIDs(engineConf *configuration, serviceAccountName string) (string, string, error) {
+	entry, err := b.client.Get(engineConf.ADConf, serviceAccountName)
+	if err != nil {
+		return "", "", err
+	}
+	rawSID, _ := entry.GetJoined(client.FieldRegistry.ObjectSID)
+	sid, err := client.FormatSID([]byte(rawSID))
+	if err != nil {
+		return "", "", err
+	}
+	rawGUID, _ := entry.GetJoined(client.FieldRegistry.ObjectGUID)
+	guid, err := client.FormatGUID([]byte(rawGUID))
+	if err != nil {
+		return "", "", err
+	}
+	return sid, guid, nil
+}
@@ -0,0 +1,84 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+// accountIDsDirectory gives every account the same SID and GUID, except for
+// ones named "corrupt", whose SID is truncated.
+type accountIDsDirectory struct {
+	*memoryDirectory
+}
+
+func (d *accountIDsDirectory) Get(conf *client.ADConf, serviceAccountName string) (*client.Entry, error) {
+	sid := string([]byte{
+		0x01, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x05,
+		0x15, 0x00, 0x00, 0x00,
+		0xc7, 0x3f, 0xff, 0xd7,
+		0x7c, 0x6f, 0x55, 0xc8,
+		0x94, 0x57, 0xce, 0x01,
+		0xf5, 0x03, 0x00, 0x00,
+	})
+	if serviceAccountName == "corrupt" {
+		sid = sid[:20]
+	}
+	guid := string([]byte{0xff, 0x19, 0x96, 0x6f, 0x86, 0x8b, 0x11, 0xd0, 0xb4, 0x2d, 0x00, 0xc0, 0x4f, 0xc9, 0x64, 0xff})
+	return client.NewEntry(&ldap.Entry{
+		Attributes: []*ldap.EntryAttribute{
+			{Name: client.FieldRegistry.ObjectSID.String(), Values: []string{sid}},
+			{Name: client.FieldRegistry.ObjectGUID.String(), Values: []string{guid}},
+		},
+	}), nil
+}
+
+func TestAccountIDs(t *testing.T) {
+	conf := testConfig()
+	b, storage := getBackend(t, &accountIDsDirectory{newMemoryDirectory()}, conf)
+	handle := succeedingRequester(t, b, storage, "")
+
+	for _, name := range []string{"app", "corrupt"} {
+		handle(logical.UpdateOperation, rolePrefix+name, map[string]interface{}{
+			"service_account_name": name,
+		})
+	}
+	handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"borrowed"},
+	})
+
+	if resp := handle(logical.ReadOperation, credPrefix+"app", nil); resp.Data["object_sid"] != nil {
+		t.Fatalf("expected no account IDs unless they're asked for but received %#v", resp.Data)
+	}
+
+	conf.IncludeAccountIDs = true
+	if err := writeConfig(ctx, storage, conf); err != nil {
+		t.Fatal(err)
+	}
+	for _, resp := range []*logical.Response{
+		handle(logical.ReadOperation, credPrefix+"app", nil),
+		handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil),
+	} {
+		if resp.Data["object_sid"] != "S-1-5-21-3623829447-3361042300-30300052-1013" {
+			t.Fatalf("unexpected SID in %#v", resp.Data)
+		}
+		if resp.Data["object_guid"] != "6f9619ff-8b86-d011-b42d-00c04fc964ff" {
+			t.Fatalf("unexpected GUID in %#v", resp.Data)
+		}
+		if resp.Data["current_password"] == nil && resp.Data["password"] == nil {
+			t.Fatalf("expected the password to still be returned but received %#v", resp.Data)
+		}
+	}
+
+	// The password is still returned if the IDs can't be read.
+	resp := handle(logical.ReadOperation, credPrefix+"corrupt", nil)
+	if resp.Data["current_password"] == nil || resp.Data["object_sid"] != nil || len(resp.Warnings) != 1 {
+		t.Fatalf("expected the password with a warning but received %#v", resp)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	accountOwnerStoragePrefix = "account-owner/"
+
+	// accountIndexStorageKey is written once every library set and elevation
+	// role has been added to the index. Until then, conflicts are also found
+	// by probing the check-out entries.
+	accountIndexStorageKey = "account-index"
+
+	accountOwnerSet       = "set"
+	accountOwnerElevation = "elevation role"
+)
+
+// accountOwner is the library set or elevation role managing a service account,
+// so a set or elevation role that wants the account can learn who has it without
+// reading every set.
+type accountOwner struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// readAccountOwner returns the owner of the service account, or nil if nothing
+// manages it. Entries whose set or elevation role no longer manages the account,
+// like those left by a failed delete, are ignored.
+func readAccountOwner(ctx context.Context, storage logical.Storage, serviceAccountName string) (*accountOwner, error) {
+	entry, err := storage.Get(ctx, accountOwnerStoragePrefix+normalizeServiceAccountName(serviceAccountName))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	owner := &accountOwner{}
+	if err := entry.DecodeJSON(owner); err != nil {
+		return nil, err
+	}
+	switch owner.Kind {
+	case accountOwnerSet:
+		set, err := readSet(ctx, storage, owner.Name)
+		if err != nil {
+			return nil, err
+		}
+		if set != nil && findServiceAccountName(set.ServiceAccountNames, serviceAccountName) != "" {
+			return owner, nil
+		}
+	case accountOwnerElevation:
+		role, err := readElevationRole(ctx, storage, owner.Name)
+		if err != nil {
+			return nil, err
+		}
+		if role != nil && normalizeServiceAccountName(role.ServiceAccountName) == normalizeServiceAccountName(serviceAccountName) {
+			return owner, nil
+		}
+	}
+	return nil, nil
+}
+
+func storeAccountOwners(ctx context.Context, storage logical.Storage, owner *accountOwner, serviceAccountNames []string) error {
+	for _, serviceAccountName := range serviceAccountNames {
+		entry, err := logical.StorageEntryJSON(accountOwnerStoragePrefix+normalizeServiceAccountName(serviceAccountName), owner)
+		if err != nil {
+			return err
+		}
+		if err := storage.Put(ctx, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteAccountOwners(ctx context.Context, storage logical.Storage, serviceAccountNames []string) error {
+	for _, serviceAccountName := range serviceAccountNames {
+		if err := storage.Delete(ctx, accountOwnerStoragePrefix+normalizeServiceAccountName(serviceAccountName)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkUnmanaged returns an error response if any of the given service accounts
+// is already managed by a role, library set, or elevation role.
+func (b *backend) checkUnmanaged(ctx context.Context, storage logical.Storage, serviceAccountNames []string) (*logical.Response, error) {
+	if len(serviceAccountNames) == 0 {
+		return nil, nil
+	}
+	// Roles may share a service account, so they aren't in the index. Their
+	// accounts are gathered once rather than once per service account.
+	roleOwners, err := roleServiceAccounts(ctx, storage)
+	if err != nil {
+		return nil, err
+	}
+	for _, serviceAccountName := range serviceAccountNames {
+		if roleName, ok := roleOwners[normalizeServiceAccountName(serviceAccountName)]; ok {
+			return codedErrorResponse(errCodeAccountAlreadyManaged, "%q is already managed by role %q", serviceAccountName, roleName), nil
+		}
+		owner, err := b.describeAccountOwner(ctx, storage, serviceAccountName)
+		if err != nil {
+			return nil, err
+		}
+		if owner != "" {
+			return codedErrorResponse(errCodeAccountAlreadyManaged, "%q is already managed by %s", serviceAccountName, owner), nil
+		}
+	}
+	return nil, nil
+}
+
+// describeAccountOwner describes the library set or elevation role managing the
+// service account, or returns an empty string if neither does.
+func (b *backend) describeAccountOwner(ctx context.Context, storage logical.Storage, serviceAccountName string) (string, error) {
+	owner, err := readAccountOwner(ctx, storage, serviceAccountName)
+	if err != nil {
+		return "", err
+	}
+	if owner != nil {
+		return fmt.Sprintf("%s %q", owner.Kind, owner.Name), nil
+	}
+	indexed, err := storage.Get(ctx, accountIndexStorageKey)
+	if err != nil {
+		return "", err
+	}
+	if indexed != nil {
+		return "", nil
+	}
+	if _, err := b.checkOutHandler.LoadCheckOut(ctx, storage, serviceAccountName); err != errNotFound {
+		if err != nil {
+			return "", err
+		}
+		return "a library set or elevation role", nil
+	}
+	return "", nil
+}
+
+// indexAccountOwners adds the service accounts of the library sets and elevation
+// roles created before the index existed. It only does the work once per mount.
+func (b *backend) indexAccountOwners(ctx context.Context, storage logical.Storage) error {
+	indexed, err := storage.Get(ctx, accountIndexStorageKey)
+	if err != nil {
+		return err
+	}
+	if indexed != nil {
+		return nil
+	}
+
+	// Hold every set lock so no set or elevation role changes while it's indexed.
+	for _, lock := range b.checkOutLocks {
+		lock.Lock()
+		defer lock.Unlock()
+	}
+
+	setNames, err := storage.List(ctx, libraryPrefix)
+	if err != nil {
+		return err
+	}
+	for _, setName := range setNames {
+		if strings.HasSuffix(setName, "/") {
+			continue
+		}
+		set, err := readSet(ctx, storage, setName)
+		if err != nil {
+			return err
+		}
+		if set == nil {
+			continue
+		}
+		if err := storeAccountOwners(ctx, storage, &accountOwner{Kind: accountOwnerSet, Name: setName}, set.ServiceAccountNames); err != nil {
+			return err
+		}
+	}
+	roleNames, err := storage.List(ctx, elevationRolePrefix)
+	if err != nil {
+		return err
+	}
+	for _, roleName := range roleNames {
+		if strings.HasSuffix(roleName, "/") {
+			continue
+		}
+		role, err := readElevationRole(ctx, storage, roleName)
+		if err != nil {
+			return err
+		}
+		if role == nil {
+			continue
+		}
+		if err := storeAccountOwners(ctx, storage, &accountOwner{Kind: accountOwnerElevation, Name: roleName}, []string{role.ServiceAccountName}); err != nil {
+			return err
+		}
+	}
+	if err := storage.Put(ctx, &logical.StorageEntry{Key: accountIndexStorageKey, Value: []byte("1")}); err != nil {
+		return err
+	}
+	b.Logger().Info("indexed the service accounts of library sets and elevation roles")
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestAccountIndex(t *testing.T) {
+	b, storage := getBackend(t, &fakeSecretsClient{}, testConfig())
+	handle := requester(t, b, storage, "")
+	expectManagedBy := func(resp *logical.Response, owner string) {
+		t.Helper()
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("expected the account to already be managed but received %#v", resp)
+		}
+		if errMsg := resp.Error().Error(); !strings.Contains(errMsg, owner) {
+			t.Fatalf("expected the error to name %s but received %q", owner, errMsg)
+		}
+	}
+
+	if resp := handle(logical.CreateOperation, libraryPrefix+"first", map[string]interface{}{
+		"service_account_names": []string{"a@example.com", "b@example.com"},
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to create set: %#v", resp)
+	}
+
+	// The set was created before the index was built, so it isn't in it yet.
+	if err := storage.Delete(ctx, accountOwnerStoragePrefix+"a@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Delete(ctx, accountOwnerStoragePrefix+"b@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	// Conflicts are still found by probing the check-out entries.
+	expectManagedBy(handle(logical.CreateOperation, libraryPrefix+"second", map[string]interface{}{
+		"service_account_names": []string{"a@example.com"},
+	}), "a library set or elevation role")
+
+	if err := b.Initialize(ctx, &logical.InitializationRequest{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	owner, err := readAccountOwner(ctx, storage, "b@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner == nil || owner.Kind != accountOwnerSet || owner.Name != "first" {
+		t.Fatalf("expected the set to be indexed but received %#v", owner)
+	}
+	expectManagedBy(handle(logical.CreateOperation, libraryPrefix+"second", map[string]interface{}{
+		"service_account_names": []string{"c@example.com", "b@example.com"},
+	}), `set "first"`)
+
+	// Accounts removed from a set can be managed by another.
+	if resp := handle(logical.UpdateOperation, libraryPrefix+"first", map[string]interface{}{
+		"service_account_names": []string{"a@example.com"},
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to update set: %#v", resp)
+	}
+	if resp := handle(logical.CreateOperation, libraryPrefix+"second", map[string]interface{}{
+		"service_account_names": []string{"b@example.com"},
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to create set: %#v", resp)
+	}
+	expectManagedBy(handle(logical.UpdateOperation, libraryPrefix+"first", map[string]interface{}{
+		"service_account_names": []string{"a@example.com", "b@example.com"},
+	}), `set "second"`)
+
+	// Deleting a set frees its accounts.
+	handle(logical.DeleteOperation, libraryPrefix+"second", nil)
+	if owner, err := readAccountOwner(ctx, storage, "b@example.com"); err != nil || owner != nil {
+		t.Fatalf("expected the account to be removed from the index but received %#v, %v", owner, err)
+	}
+	if resp := handle(logical.UpdateOperation, libraryPrefix+"first", map[string]interface{}{
+		"service_account_names": []string{"a@example.com", "b@example.com"},
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to update set: %#v", resp)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/util"
+)
+
+// normalizeServiceAccountName returns the form service account names are stored
+// and compared in, so one account can't be managed twice under names that only
+// differ in case or surrounding whitespace. AD compares userPrincipalNames without
+// regard to case, so lowercasing one doesn't change which account it finds.
+func normalizeServiceAccountName(serviceAccountName string) string {
+	return strings.ToLower(strings.TrimSpace(serviceAccountName))
+}
+
+// canonicalServiceAccountName normalizes a service account name sent in a request.
+// Accounts are looked up by userPrincipalName, so a name in the down-level logon
+// form, like EXAMPLE\svc, is converted to one using the config's upndomain.
+// Computer accounts are looked up by sAMAccountName, so EXAMPLE\web01$ is web01$.
+func canonicalServiceAccountName(engineConf *configuration, serviceAccountName string) (string, error) {
+	serviceAccountName = normalizeServiceAccountName(serviceAccountName)
+	domain, user, found := strings.Cut(serviceAccountName, `\`)
+	if !found {
+		return serviceAccountName, nil
+	}
+	if user == "" || domain == "" || strings.ContainsAny(user, `\@`) {
+		return "", fmt.Errorf("%q isn't a valid service account name", serviceAccountName)
+	}
+	if util.IsComputerAccount(user) {
+		return user, nil
+	}
+	if engineConf == nil || engineConf.ADConf == nil || engineConf.ADConf.UPNDomain == "" {
+		return "", fmt.Errorf(`%q is a down-level logon name, please use its userPrincipalName, like "%s@example.com", or set upndomain in the config`, serviceAccountName, user)
+	}
+	return user + "@" + strings.ToLower(engineConf.ADConf.UPNDomain), nil
+}
+
+// canonicalServiceAccountNames normalizes the service account names sent in a
+// request, dropping any that name the same account twice.
+func canonicalServiceAccountNames(engineConf *configuration, serviceAccountNames []string) ([]string, error) {
+	canonical := make([]string, 0, len(serviceAccountNames))
+	for _, serviceAccountName := range serviceAccountNames {
+		name, err := canonicalServiceAccountName(engineConf, serviceAccountName)
+		if err != nil {
+			return nil, err
+		}
+		if findServiceAccountName(canonical, name) == "" {
+			canonical = append(canonical, name)
+		}
+	}
+	return canonical, nil
+}
+
+// findServiceAccountName returns the name in serviceAccountNames that's the same
+// account as serviceAccountName, or an empty string if there's none. Library sets
+// created before names were normalized keep their accounts' original spelling,
+// which their storage entries are keyed by.
+func findServiceAccountName(serviceAccountNames []string, serviceAccountName string) string {
+	normalized := normalizeServiceAccountName(serviceAccountName)
+	for _, name := range serviceAccountNames {
+		if normalizeServiceAccountName(name) == normalized {
+			return name
+		}
+	}
+	return ""
+}
+
+// serviceAccountsNotIn returns the service accounts in serviceAccountNames that
+// aren't in others, whatever their spelling.
+func serviceAccountsNotIn(serviceAccountNames, others []string) []string {
+	var missing []string
+	for _, serviceAccountName := range serviceAccountNames {
+		if findServiceAccountName(others, serviceAccountName) == "" {
+			missing = append(missing, serviceAccountName)
+		}
+	}
+	return missing
+}
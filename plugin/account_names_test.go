@@ -0,0 +1,81 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+func TestCanonicalServiceAccountName(t *testing.T) {
+	withUPNDomain := &configuration{
+		ADConf: &client.ADConf{ConfigEntry: &ldaputil.ConfigEntry{UPNDomain: "Example.com"}},
+	}
+	for _, tc := range []struct {
+		name     string
+		conf     *configuration
+		expected string
+		err      bool
+	}{
+		{name: " Svc@Example.COM ", conf: withUPNDomain, expected: "svc@example.com"},
+		{name: `EXAMPLE\Svc`, conf: withUPNDomain, expected: "svc@example.com"},
+		{name: `EXAMPLE\Svc`, conf: &configuration{ADConf: &client.ADConf{ConfigEntry: &ldaputil.ConfigEntry{}}}, err: true},
+		{name: `EXAMPLE\`, conf: withUPNDomain, err: true},
+		{name: `\svc`, conf: withUPNDomain, err: true},
+		{name: `EXAMPLE\Web01$`, conf: &configuration{ADConf: &client.ADConf{ConfigEntry: &ldaputil.ConfigEntry{}}}, expected: "web01$"},
+		{name: "WEB01$", conf: withUPNDomain, expected: "web01$"},
+	} {
+		actual, err := canonicalServiceAccountName(tc.conf, tc.name)
+		if tc.err {
+			if err == nil {
+				t.Fatalf("expected %q to be rejected but received %q", tc.name, actual)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != tc.expected {
+			t.Fatalf("expected %q to become %q but received %q", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestServiceAccountNamesAreNormalized(t *testing.T) {
+	b, storage := getBackend(t, &fakeSecretsClient{}, testConfig())
+	handle := requester(t, b, storage, "entity")
+
+	if resp := handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{" Svc@Example.com", "svc@example.com"},
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to create set: %#v", resp)
+	}
+	resp := handle(logical.ReadOperation, libraryPrefix+"lib", nil)
+	if names := resp.Data["service_account_names"].([]string); len(names) != 1 || names[0] != "svc@example.com" {
+		t.Fatalf("expected the names to be normalized into one but received %#v", names)
+	}
+
+	// The same account in another spelling is already managed.
+	resp = handle(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "SVC@example.com",
+	})
+	if responseErrorCode(resp) != string(errCodeAccountAlreadyManaged) {
+		t.Fatalf("expected the account to already be managed but received %#v", resp)
+	}
+
+	handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil)
+	resp = handle(logical.UpdateOperation, libraryPrefix+"lib/check-in", map[string]interface{}{
+		"service_account_names": []string{"SVC@EXAMPLE.COM"},
+	})
+	if resp == nil || resp.IsError() {
+		t.Fatalf("unable to check in: %#v", resp)
+	}
+	if checkIns := resp.Data["check_ins"].([]string); len(checkIns) != 1 || checkIns[0] != "svc@example.com" {
+		t.Fatalf("expected the account to be checked in but received %#v", checkIns)
+	}
+}
@@ -5,55 +5,117 @@ package plugin
 
 import (
 	"context"
+	"errors"
+	"net/http"
 	"sync"
 	"time"
 
+	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
 	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/patrickmn/go-cache"
+	"golang.org/x/time/rate"
 
-	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
 	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/util"
+	"github.com/hashicorp/vault-plugin-secrets-ad/version"
 )
 
+// operationPrefixAD is used as a prefix for OpenAPI operation IDs.
+const operationPrefixAD = "ad"
+
 func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
-	backend := newBackend(util.NewSecretsClient(conf.Logger), conf.System)
+	backend := NewBackend(WithSecretsClient(newDevModeClient(util.NewSecretsClient(conf.Logger))))
 	if err := backend.Setup(ctx, conf); err != nil {
 		return nil, err
 	}
 	return backend, nil
 }
 
-func newBackend(client secretsClient, passwordGenerator passwordGenerator) *backend {
+func newBackend(client SecretsClient, passwordGenerator passwordGenerator) *backend {
+	bgCtx, bgCancel := context.WithCancel(context.Background())
+	rotationLocks := locksutil.CreateLocks()
+	transit := &transitCache{}
 	adBackend := &backend{
-		client:         client,
-		roleCache:      cache.New(roleCacheExpiration, roleCacheCleanup),
-		credCache:      cache.New(credCacheExpiration, credCacheCleanup),
-		rotateRootLock: new(int32),
+		client:        client,
+		roleCache:     cache.New(roleCacheExpiration, roleCacheCleanup),
+		credCache:     cache.New(credCacheExpiration, credCacheCleanup),
+		rotationLocks: rotationLocks,
+		now:           time.Now,
+
+		verifyRetryInterval: defaultVerifyRetryInterval,
+		webhookClient:       &http.Client{Timeout: webhookTimeout},
+		transit:             transit,
 		checkOutHandler: &checkOutHandler{
 			client:            client,
 			passwordGenerator: passwordGenerator,
+			rotationLocks:     rotationLocks,
+			now:               time.Now,
+			limiter:           rate.NewLimiter(rate.Inf, defaultRotationBurst),
+			transit:           transit,
 		},
-		checkOutLocks: locksutil.CreateLocks(),
+		checkOutLocks:        locksutil.CreateLocks(),
+		groupMembershipLocks: locksutil.CreateLocks(),
+		bgCtx:                bgCtx,
+		bgCancel:             bgCancel,
 	}
+	adBackend.usage = &usageRecorder{logger: adBackend.Logger}
+	adBackend.checkOutHandler.usage = adBackend.usage
 	adBackend.Backend = &framework.Backend{
 		Help: backendHelp,
 		Paths: []*framework.Path{
 			adBackend.pathConfig(),
+			adBackend.pathNamedConfigs(),
+			adBackend.pathListNamedConfigs(),
 			adBackend.pathRoles(),
 			adBackend.pathListRoles(),
 			adBackend.pathCreds(),
 			adBackend.pathRotateRootCredentials(),
+			adBackend.pathRotateRootCancel(),
+			adBackend.pathRotateRootStatus(),
 			adBackend.pathRotateCredentials(),
+			adBackend.pathRollbackPassword(),
+			adBackend.pathRoleMoveToLibrary(),
+			adBackend.pathTidy(),
+			adBackend.pathInfo(),
+			adBackend.pathRotationPause(),
+			adBackend.pathRotationResume(),
+			adBackend.pathUsage(),
+			adBackend.pathPasswordAgeReport(),
 
 			// The following paths are for AD credential checkout.
 			adBackend.pathSetCheckIn(),
 			adBackend.pathSetManageCheckIn(),
+			adBackend.pathSetManageCheckOut(),
+			adBackend.pathSetManageExtend(),
+			adBackend.pathSetRenew(),
+			adBackend.pathSetManagePassword(),
+			adBackend.pathSetManageSetPassword(),
+			adBackend.pathSetManageRotateAll(),
+			adBackend.pathSetManageMoveToRole(),
 			adBackend.pathSetCheckOut(),
 			adBackend.pathSetStatus(),
 			adBackend.pathSets(),
 			adBackend.pathListSets(),
+			adBackend.pathApprovals(),
+			adBackend.pathListApprovals(),
+			adBackend.pathLibraryGroupCheckOut(),
+			adBackend.pathLibraryGroups(),
+			adBackend.pathListLibraryGroups(),
+
+			// The following paths are for temporary group membership.
+			adBackend.pathGroupMembershipRoles(),
+			adBackend.pathListGroupMembershipRoles(),
+			adBackend.pathGroupMembership(),
+
+			// The following paths are for privileged elevation.
+			adBackend.pathElevationRoles(),
+			adBackend.pathListElevationRoles(),
+			adBackend.pathElevationCreds(),
+
+			// The following path is for reading computers' LAPS passwords.
+			adBackend.pathLAPS(),
 		},
 		PathsSpecial: &logical.Paths{
 			SealWrapStorage: []string{
@@ -61,13 +123,19 @@ func newBackend(client secretsClient, passwordGenerator passwordGenerator) *back
 				credPrefix,
 			},
 		},
-		Invalidate:  adBackend.Invalidate,
-		BackendType: logical.TypeLogical,
+		Invalidate:     adBackend.Invalidate,
+		Clean:          adBackend.clean,
+		BackendType:    logical.TypeLogical,
+		RunningVersion: version.Version,
 		Secrets: []*framework.Secret{
 			adBackend.secretAccessKeys(),
+			adBackend.secretGroupMembership(),
+			adBackend.secretElevation(),
 		},
 		WALRollback:       adBackend.walRollback,
 		WALRollbackMinAge: 1 * time.Minute,
+		PeriodicFunc:      adBackend.periodicFunc,
+		InitializeFunc:    adBackend.initialize,
 	}
 	return adBackend
 }
@@ -75,30 +143,178 @@ func newBackend(client secretsClient, passwordGenerator passwordGenerator) *back
 type backend struct {
 	*framework.Backend
 
-	client secretsClient
+	client SecretsClient
 
-	roleCache      *cache.Cache
-	credCache      *cache.Cache
-	credLock       sync.Mutex
-	rotateRootLock *int32
+	// logger, if set, is used instead of the logger Vault provides.
+	logger hclog.Logger
+	// now returns the current time, and is swapped out in tests.
+	now func() time.Time
+	// verifyRetryInterval is how long to wait between attempts to bind with a
+	// role's new password.
+	verifyRetryInterval time.Duration
+	// webhookClient sends notifications to the config's webhook_url.
+	webhookClient *http.Client
+	// transit is the client for the config's Transit server, shared with
+	// checkOutHandler.
+	transit *transitCache
+
+	roleCache *cache.Cache
+	credCache *cache.Cache
+	// credLock guards roles' creds. When a checkOutLocks entry is needed too,
+	// like when a role is converted to or from a library set, the checkOutLocks
+	// entry is acquired first and credLock after it.
+	credLock sync.Mutex
+
+	// rotateRootLock guards rootRotation, the root rotation in progress if
+	// there is one, and canceledRootRotation, one that was canceled but hasn't
+	// returned yet. Only one root rotation runs at a time, and none starts
+	// while a canceled one may still change the password in AD.
+	rotateRootLock       sync.Mutex
+	rootRotation         *rootRotation
+	canceledRootRotation *rootRotation
+
+	// rotationLocks are held by service account name while its password is
+	// changed in AD and stored, so that roles, library sets, and rollbacks
+	// can't race each other to store different current passwords.
+	// They must always be acquired last, after any other lock.
+	rotationLocks []*locksutil.LockEntry
 
 	checkOutHandler *checkOutHandler
 	// checkOutLocks are used for avoiding races
 	// when working with sets through the check-out system.
+	// They're acquired before credLock.
 	checkOutLocks []*locksutil.LockEntry
+	// groupMembershipLocks are held by group DN while a membership is granted
+	// or revoked, so two leases can't be granted the same membership.
+	groupMembershipLocks []*locksutil.LockEntry
+
+	// bgCtx is canceled when the backend is cleaned up, and should be used
+	// by any work that outlives the request that started it. Such work
+	// should also be tracked in bgWG so cleanup can wait for it to finish.
+	bgCtx    context.Context
+	bgCancel context.CancelFunc
+	bgWG     sync.WaitGroup
+
+	// usage counts how much the engine is used, for the usage endpoint.
+	usage *usageRecorder
+
+	// lastTidy is when storage was last tidied automatically.
+	// It's only accessed by the periodic func, which never runs concurrently.
+	lastTidy time.Time
+
+	// epochLock guards epochID, the storage epoch this backend started.
+	epochLock sync.Mutex
+	epochID   string
+}
+
+// Logger returns the logger given to NewBackend, or else the one Vault provided.
+func (b *backend) Logger() hclog.Logger {
+	if b.logger != nil {
+		return b.logger
+	}
+	return b.Backend.Logger()
 }
 
 func (b *backend) Invalidate(ctx context.Context, key string) {
 	b.invalidateRole(ctx, key)
 	b.invalidateCred(ctx, key)
+	if key == configStorageKey {
+		b.transit.reset()
+	}
+}
+
+// clean is called when the mount is disabled or the plugin is reloaded.
+// It stops any background work and drops cached credentials from memory.
+func (b *backend) clean(_ context.Context) {
+	b.bgCancel()
+	b.bgWG.Wait()
+	b.roleCache.Flush()
+	b.credCache.Flush()
+	// Background work is done with the client, so its idle connections can go.
+	if closer, ok := b.client.(ConnectionCloser); ok {
+		closer.Close()
+	}
 }
 
-// Wraps the *util.SecretsClient in an interface to support testing.
-type secretsClient interface {
-	Get(conf *client.ADConf, serviceAccountName string) (*client.Entry, error)
-	GetPasswordLastSet(conf *client.ADConf, serviceAccountName string) (time.Time, error)
-	UpdatePassword(conf *client.ADConf, serviceAccountName string, newPassword string) error
-	UpdateRootPassword(conf *client.ADConf, bindDN string, newPassword string) error
+// initialize is called by Vault once the mount is set up, on the active node.
+func (b *backend) initialize(ctx context.Context, req *logical.InitializationRequest) error {
+	if err := b.prewarmConnections(ctx, req.Storage); err != nil {
+		return err
+	}
+	if b.isReplicatedFollower() {
+		return nil
+	}
+	if err := b.startStorageEpoch(ctx, req.Storage); err != nil {
+		return err
+	}
+	return b.indexAccountOwners(ctx, req.Storage)
+}
+
+// prewarmConnections connects to AD in the background if the config asks for it,
+// so the first request after a restart or unseal doesn't wait to connect and bind.
+// Failing to connect is only logged, since the request will try again.
+func (b *backend) prewarmConnections(ctx context.Context, storage logical.Storage) error {
+	engineConf, err := readConfig(ctx, storage)
+	if err != nil {
+		return err
+	}
+	if engineConf == nil || !engineConf.ADConf.PrewarmConnections {
+		return nil
+	}
+	prewarmer, ok := b.client.(ConnectionPrewarmer)
+	if !ok {
+		return nil
+	}
+	b.bgWG.Add(1)
+	go func() {
+		defer b.bgWG.Done()
+		start := time.Now()
+		if err := prewarmer.Prewarm(engineConf.ADConf); err != nil {
+			b.Logger().Warn("unable to prewarm connection to AD", "error", err)
+			return
+		}
+		b.Logger().Debug("prewarmed connection to AD", "duration", time.Since(start))
+	}()
+	return nil
+}
+
+// periodicFunc is called by Vault about once a minute on the active node.
+func (b *backend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	if b.isReplicatedFollower() {
+		return nil
+	}
+	epochErr := b.checkStorageEpoch(ctx, req.Storage)
+	tidyErr := b.periodicTidy(ctx, req.Storage)
+	// Warnings don't change passwords, so they're sent even while rotation is paused.
+	warnErr := b.warnDueCheckOuts(ctx, req.Storage)
+	// So does probing, since it only dials domain controllers.
+	probeErr := b.probeDCs(ctx, req.Storage)
+	pause, err := activeRotationPause(ctx, req.Storage, b.now())
+	if err != nil || pause != nil {
+		return errors.Join(epochErr, tidyErr, warnErr, probeErr, err)
+	}
+	return errors.Join(
+		epochErr,
+		tidyErr,
+		warnErr,
+		probeErr,
+		b.checkInLapsedCheckOuts(ctx, req.Storage),
+		b.rotateIdleLibraryAccounts(ctx, req.Storage),
+		b.rotateAgedRolePasswords(ctx, req.Storage),
+		b.processRetryQueue(ctx, req.Storage),
+	)
+}
+
+// isReplicatedFollower reports whether this node only replicates storage that
+// another cluster writes, like a DR secondary. Such nodes must never change
+// passwords in AD on their own, because the cluster that owns the storage
+// would keep handing out passwords that no longer work.
+func (b *backend) isReplicatedFollower() bool {
+	state := b.System().ReplicationState()
+	if state.HasState(consts.ReplicationDRSecondary | consts.ReplicationPerformanceStandby) {
+		return true
+	}
+	return state.HasState(consts.ReplicationPerformanceSecondary) && !b.System().LocalMount()
 }
 
 const backendHelp = `
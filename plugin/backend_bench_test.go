@@ -0,0 +1,119 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+// ldapLatency is how long latencySecretsClient takes to update a password, roughly
+// a round trip to a nearby domain controller.
+const ldapLatency = time.Millisecond
+
+// latencySecretsClient is a fakeSecretsClient that takes as long as AD would to
+// update passwords, so locks are held about as long as they would be in production.
+type latencySecretsClient struct {
+	fakeSecretsClient
+}
+
+func (c *latencySecretsClient) UpdatePassword(conf *client.ADConf, serviceAccountName string, newPassword string) error {
+	time.Sleep(ldapLatency)
+	return c.fakeSecretsClient.UpdatePassword(conf, serviceAccountName, newPassword)
+}
+
+// BenchmarkCheckOutCheckIn drives concurrent check-out and check-in cycles against
+// a library set, reporting the latency distribution of successful cycles and how
+// often a check-out found no account available. Run it with a -cpu list to see how
+// contention grows with the number of borrowers, ex.
+//
+//	go test ./plugin -run '^$' -bench CheckOutCheckIn -cpu 1,4,16
+func BenchmarkCheckOutCheckIn(b *testing.B) {
+	for _, accounts := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("accounts=%d", accounts), func(b *testing.B) {
+			benchmarkCheckOutCheckIn(b, accounts)
+		})
+	}
+}
+
+func benchmarkCheckOutCheckIn(b *testing.B, accounts int) {
+	backend, storage := getBackend(b, &latencySecretsClient{}, testConfig())
+	serviceAccountNames := make([]string, accounts)
+	for i := range serviceAccountNames {
+		serviceAccountNames[i] = fmt.Sprintf("bench%d@example.com", i)
+	}
+	succeedingRequester(b, backend, storage, "")(logical.CreateOperation, libraryPrefix+"bench", map[string]interface{}{
+		"service_account_names": serviceAccountNames,
+	})
+
+	var (
+		borrowers   int64
+		unavailable int64
+
+		mu        sync.Mutex
+		latencies []time.Duration
+	)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		borrower := fmt.Sprintf("borrower%d", atomic.AddInt64(&borrowers, 1))
+		var local []time.Duration
+		for pb.Next() {
+			start := time.Now()
+			resp, err := backend.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      libraryPrefix + "bench/check-out",
+				Storage:   storage,
+				EntityID:  borrower,
+			})
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			if resp.IsError() {
+				if resp.Data["data"].(map[string]interface{})["error_code"] != string(errCodeNoAccountsAvailable) {
+					b.Errorf("unexpected error response: %#v", resp)
+					return
+				}
+				atomic.AddInt64(&unavailable, 1)
+				continue
+			}
+			resp, err = backend.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      libraryPrefix + "bench/check-in",
+				Storage:   storage,
+				EntityID:  borrower,
+				Data: map[string]interface{}{
+					"service_account_names": []string{resp.Data["service_account_name"].(string)},
+				},
+			})
+			if err != nil || (resp != nil && resp.IsError()) {
+				b.Errorf("bad: resp: %#v\nerr: %v", resp, err)
+				return
+			}
+			local = append(local, time.Since(start))
+		}
+		mu.Lock()
+		latencies = append(latencies, local...)
+		mu.Unlock()
+	})
+	b.StopTimer()
+
+	b.ReportMetric(float64(unavailable)/float64(b.N), "unavailable/op")
+	if len(latencies) == 0 {
+		return
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	for _, p := range []int{50, 90, 99} {
+		b.ReportMetric(float64(latencies[(len(latencies)-1)*p/100].Microseconds()), fmt.Sprintf("p%d-µs", p))
+	}
+	b.ReportMetric(float64(latencies[len(latencies)-1].Microseconds()), "max-µs")
+}
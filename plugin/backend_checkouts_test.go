@@ -63,8 +63,8 @@ func TestCheckOutRaces(t *testing.T) {
 				Storage:   testStorage,
 				Data: map[string]interface{}{
 					"service_account_names":        []string{"tester1@example.com", "tester2@example.com"},
-					"ttl":                          "10h",
-					"max_ttl":                      "11h",
+					"ttl":                          "100s",
+					"max_ttl":                      "150s",
 					"disable_check_in_enforcement": true,
 				},
 			})
@@ -95,7 +95,7 @@ func TestCheckOutRaces(t *testing.T) {
 				Storage:   testStorage,
 				Data: map[string]interface{}{
 					"service_account_names":        []string{"tester1@example.com", "tester2@example.com"},
-					"ttl":                          "10h",
+					"ttl":                          "100s",
 					"disable_check_in_enforcement": false,
 				},
 			})
@@ -178,8 +178,8 @@ func WriteSet(t *testing.T) {
 		Storage:   testStorage,
 		Data: map[string]interface{}{
 			"service_account_names":        []string{"tester1@example.com", "tester2@example.com"},
-			"ttl":                          "10h",
-			"max_ttl":                      "11h",
+			"ttl":                          "100s",
+			"max_ttl":                      "150s",
 			"disable_check_in_enforcement": true,
 		},
 	}
@@ -250,11 +250,11 @@ func ReadSet(t *testing.T) {
 		t.Fatal("check-in enforcement should be disabled")
 	}
 	ttl := resp.Data["ttl"].(int64)
-	if ttl != 10*60*60 { // 10 hours
+	if ttl != 100 {
 		t.Fatal(ttl)
 	}
 	maxTTL := resp.Data["max_ttl"].(int64)
-	if maxTTL != 11*60*60 { // 11 hours
+	if maxTTL != 150 {
 		t.Fatal(maxTTL)
 	}
 }
@@ -266,7 +266,7 @@ func WriteSetToggleOff(t *testing.T) {
 		Storage:   testStorage,
 		Data: map[string]interface{}{
 			"service_account_names":        []string{"tester1@example.com", "tester2@example.com"},
-			"ttl":                          "10h",
+			"ttl":                          "100s",
 			"disable_check_in_enforcement": false,
 		},
 	}
@@ -446,11 +446,11 @@ func PerformCheckOut(t *testing.T) {
 	if !resp.Secret.Renewable {
 		t.Fatal("lease should be renewable")
 	}
-	if resp.Secret.TTL != time.Hour*10 {
-		t.Fatal("expected 10h TTL")
+	if resp.Secret.TTL != 100*time.Second {
+		t.Fatal("expected 100s TTL")
 	}
-	if resp.Secret.MaxTTL != time.Hour*11 {
-		t.Fatal("expected 11h TTL")
+	if resp.Secret.MaxTTL != 150*time.Second {
+		t.Fatal("expected 150s max TTL")
 	}
 	if resp.Secret.InternalData["service_account_name"].(string) == "" {
 		t.Fatal("internal service account name should not be empty")
@@ -528,3 +528,76 @@ func ForceCheckIn(t *testing.T) {
 		t.Fatal("expected 1 check-in")
 	}
 }
+
+func TestRoleAndSetConflicts(t *testing.T) {
+	b, storage := getBackend(t, &fakeSecretsClient{}, testConfig())
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      rolePrefix + "role",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"service_account_name": "role-account@example.com",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      libraryPrefix + "set",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"service_account_names": []string{"set-account@example.com"},
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+
+	// A role can't take over an account that belongs to a set.
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      rolePrefix + "other-role",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"service_account_name": "set-account@example.com",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected an error because the account is managed by a set")
+	}
+
+	// A set can't be created or updated to include an account that belongs to a role.
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      libraryPrefix + "other-set",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"service_account_names": []string{"role-account@example.com"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected an error because the account is managed by a role")
+	}
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      libraryPrefix + "set",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"service_account_names": []string{"set-account@example.com", "role-account@example.com"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected an error because the account is managed by a role")
+	}
+}
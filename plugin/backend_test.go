@@ -12,6 +12,9 @@ import (
 	"time"
 
 	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+	schemahelper "github.com/hashicorp/vault/sdk/helper/testhelpers/schema"
 	"github.com/hashicorp/vault/sdk/logical"
 
 	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
@@ -63,6 +66,114 @@ func TestBackend(t *testing.T) {
 	t.Run("rotate root creds with write", RotateRootCredsWithPost)
 }
 
+func TestClean(t *testing.T) {
+	b := newBackend(&fakeSecretsClient{}, &logical.StaticSystemView{})
+	b.roleCache.SetDefault("role", &backendRole{})
+	b.credCache.SetDefault("role", map[string]interface{}{"current_password": "pa$$w0rd"})
+
+	b.bgWG.Add(1)
+	go func() {
+		defer b.bgWG.Done()
+		<-b.bgCtx.Done()
+	}()
+
+	b.clean(ctx)
+
+	if b.bgCtx.Err() == nil {
+		t.Fatal("expected the background context to be canceled")
+	}
+	if b.roleCache.ItemCount() != 0 {
+		t.Fatal("expected the role cache to be flushed")
+	}
+	if b.credCache.ItemCount() != 0 {
+		t.Fatal("expected the cred cache to be flushed")
+	}
+}
+
+// TestMutatingOperationsForward ensures that every operation that may write to storage
+// or change a password in AD is forwarded from performance standbys and secondaries.
+func TestMutatingOperationsForward(t *testing.T) {
+	for _, path := range testBackend.Paths {
+		for operation, handler := range path.Operations {
+			if operation == logical.ReadOperation || operation == logical.ListOperation {
+				continue
+			}
+			props := handler.Properties()
+			if !props.ForwardPerformanceStandby || !props.ForwardPerformanceSecondary {
+				t.Fatalf("%s on %q should be forwarded to the active node of the primary cluster", operation, path.Pattern)
+			}
+		}
+	}
+}
+
+func TestOperationsDocumented(t *testing.T) {
+	for _, path := range testBackend.Paths {
+		if path.DisplayAttrs == nil || path.DisplayAttrs.OperationPrefix != operationPrefixAD {
+			t.Fatalf("%q should have the %q operation prefix", path.Pattern, operationPrefixAD)
+		}
+		for operation, handler := range path.Operations {
+			props := handler.Properties()
+			if props.Summary == "" {
+				t.Fatalf("%s on %q should have a summary", operation, path.Pattern)
+			}
+			if operation != logical.ListOperation && len(props.Responses) == 0 {
+				t.Fatalf("%s on %q should describe its responses", operation, path.Pattern)
+			}
+		}
+	}
+}
+
+func TestIsReplicatedFollower(t *testing.T) {
+	testCases := map[string]struct {
+		state      consts.ReplicationState
+		localMount bool
+		expected   bool
+	}{
+		"standalone": {
+			state:    consts.ReplicationUnknown,
+			expected: false,
+		},
+		"performance primary": {
+			state:    consts.ReplicationPerformancePrimary,
+			expected: false,
+		},
+		"dr secondary": {
+			state:    consts.ReplicationDRSecondary,
+			expected: true,
+		},
+		"performance standby": {
+			state:    consts.ReplicationPerformanceStandby,
+			expected: true,
+		},
+		"performance secondary": {
+			state:    consts.ReplicationPerformanceSecondary,
+			expected: true,
+		},
+		"performance secondary with local mount": {
+			state:      consts.ReplicationPerformanceSecondary,
+			localMount: true,
+			expected:   false,
+		},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			conf := &logical.BackendConfig{
+				System: &logical.StaticSystemView{
+					ReplicationStateVal: testCase.state,
+					LocalMountVal:       testCase.localMount,
+				},
+			}
+			b := newBackend(&fakeSecretsClient{}, conf.System)
+			if err := b.Setup(ctx, conf); err != nil {
+				t.Fatal(err)
+			}
+			if actual := b.isReplicatedFollower(); actual != testCase.expected {
+				t.Fatalf("expected %t but received %t", testCase.expected, actual)
+			}
+		})
+	}
+}
+
 func WriteConfig(t *testing.T) {
 	req := &logical.Request{
 		Operation: logical.UpdateOperation,
@@ -136,6 +247,12 @@ func ReadConfig(t *testing.T) {
 	if err != nil || (resp != nil && resp.IsError()) {
 		t.Fatal(err)
 	}
+	schemahelper.ValidateResponse(
+		t,
+		schemahelper.GetResponseSchema(t, testBackend.Route(req.Path), req.Operation),
+		resp,
+		true,
+	)
 
 	// Did we get the response data we expect?
 	if resp.Data["certificate"] != "\n-----BEGIN CERTIFICATE-----\nMIIF7zCCA9egAwIBAgIJAOY2qjn64Qq5MA0GCSqGSIb3DQEBCwUAMIGNMQswCQYD\nVQQGEwJVUzEQMA4GA1UECAwHTm93aGVyZTERMA8GA1UEBwwIVGltYnVrdHUxEjAQ\nBgNVBAoMCVRlc3QgRmFrZTENMAsGA1UECwwETm9uZTEPMA0GA1UEAwwGTm9ib2R5\nMSUwIwYJKoZIhvcNAQkBFhZkb25vdHRydXN0QG5vd2hlcmUuY29tMB4XDTE4MDQw\nMzIwNDQwOFoXDTE5MDQwMzIwNDQwOFowgY0xCzAJBgNVBAYTAlVTMRAwDgYDVQQI\nDAdOb3doZXJlMREwDwYDVQQHDAhUaW1idWt0dTESMBAGA1UECgwJVGVzdCBGYWtl\nMQ0wCwYDVQQLDAROb25lMQ8wDQYDVQQDDAZOb2JvZHkxJTAjBgkqhkiG9w0BCQEW\nFmRvbm90dHJ1c3RAbm93aGVyZS5jb20wggIiMA0GCSqGSIb3DQEBAQUAA4ICDwAw\nggIKAoICAQDzQPGErqjaoFcuUV6QFpSMU6w8wO8F0othik+rrlKERmrGonUGsoum\nWqRe6L4ZnxBvCKB6EWjvf894TXOF2cpUnjDAyBePISyPkRBEJS6VS2SEC4AJzmVu\na+P+fZr4Hf7/bEcUr7Ax37yGVZ5i5ByNHgZkBlPxKiGWSmAqIDRZLp9gbu2EkG9q\nNOjNLPU+QI2ov6U/laGS1vbE2LahTYeT5yscu9LpllxzFv4lM1f4wYEaM3HuOxzT\nl86cGmEr9Q2N4PZ2T0O/s6D4but7c6Bz2XPXy9nWb5bqu0n5bJEpbRFrkryW1ozh\nL9uVVz4dyW10pFBJtE42bqA4PRCDQsUof7UfsQF11D1ThrDfKsQa8PxrYdGUHUG9\nGFF1MdTTwaoT90RI582p+6XYV+LNlXcdfyNZO9bMThu9fnCvT7Ey0TKU4MfPrlfT\naIhZmyaHt6mL5p881UPDIvy7paTLgL+C1orLjZAiT//c4Zn+0qG0//Cirxr020UF\n3YiEFk2H0bBVwOHoOGw4w5HrvLdyy0ZLDSPQbzkSZ0RusHb5TjiyhtTk/h9vvJv7\nu1fKJub4MzgrBRi16ejFdiWoVuMXRC6fu/ERy3+9DH6LURerbPrdroYypUmTe9N6\nXPeaF1Tc+WO7O/yW96mV7X/D211qjkOtwboZC5kjogVbaZgGzjHCVwIDAQABo1Aw\nTjAdBgNVHQ4EFgQU2zWT3HeiMBzusz7AggVqVEL5g0UwHwYDVR0jBBgwFoAU2zWT\n3HeiMBzusz7AggVqVEL5g0UwDAYDVR0TBAUwAwEB/zANBgkqhkiG9w0BAQsFAAOC\nAgEAwTGcppY86mNRE43uOimeApTfqHJv+lGDTjEoJCZZmzmtxFe6O9+Vk4bH/8/i\ngVQvqzBpaWXRt9OhqlFMK7OkX4ZvqXmnShmxib1dz1XxGhbwSec9ca8bill59Jqa\nbIOq2SXVMcFD0GwFxfJRBVzHHuB6AwV9B2QN61zeB1oxNGJrUOo80jVkB7+MWMyD\nbQqiFCHWGMa6BG4N91KGOTveZCGdBvvVw5j6lt731KjbvL2hB1UHioucOweKLfa4\nQWDImTEjgV68699wKERNL0DCpeD7PcP/L3SY2RJzdyC1CSR7O8yU4lQK7uZGusgB\nMgup+yUaSjxasIqYMebNDDocr5kdwG0+2r2gQdRwc5zLX6YDBn6NLSWjRnY04ZuK\nP1cF68rWteWpzJu8bmkJ5r2cqskqrnVK+zz8xMQyEaj548Bnt51ARLHOftR9jkSU\nNJWh7zOLZ1r2UUKdDlrMoh3GQO3rvnCJJ16NBM1dB7TUyhMhtF6UOE62BSKdHtQn\nd6TqelcRw9WnDsb9IPxRwaXhvGljnYVAgXXlJEI/6nxj2T4wdmL1LWAr6C7DuWGz\n8qIvxc4oAau4DsZs2+BwolCFtYc98OjWGcBStBfZz/YYXM+2hKjbONKFxWdEPxGR\nBeq3QOqp2+dga36IzQybzPQ8QtotrpSJ3q82zztEvyWiJ7E=\n-----END CERTIFICATE-----\n" {
@@ -256,10 +373,16 @@ func ReadRole(t *testing.T) {
 	if err != nil || (resp != nil && resp.IsError()) {
 		t.Fatal(err)
 	}
+	schemahelper.ValidateResponse(
+		t,
+		schemahelper.GetResponseSchema(t, testBackend.Route(req.Path), req.Operation),
+		resp,
+		true,
+	)
 
 	// Did we get the response data we expect?
-	if len(resp.Data) != 2 {
-		t.Fatalf("expected 2 items in %s but received %d", resp.Data, len(resp.Data))
+	if len(resp.Data) != 3 {
+		t.Fatalf("expected 3 items in %s but received %d", resp.Data, len(resp.Data))
 	}
 	if resp.Data["service_account_name"] != "tester@example.com" {
 		t.Fatalf("expected \"tester@example.com\" but received %q", resp.Data["service_account_name"])
@@ -267,6 +390,9 @@ func ReadRole(t *testing.T) {
 	if resp.Data["ttl"] != 10 {
 		t.Fatalf("expected \"10\" but received \"%d\"", resp.Data["ttl"])
 	}
+	if _, ok := resp.Data["updated_at"].(time.Time); !ok {
+		t.Fatalf("expected when the role was written but received %#v", resp.Data["updated_at"])
+	}
 }
 
 func ListRoles(t *testing.T) {
@@ -318,6 +444,12 @@ func ReadCred(t *testing.T) {
 	if err != nil || (resp != nil && resp.IsError()) {
 		t.Fatal(err)
 	}
+	schemahelper.ValidateResponse(
+		t,
+		schemahelper.GetResponseSchema(t, testBackend.Route(req.Path), req.Operation),
+		resp,
+		true,
+	)
 
 	// Did we get the response data we expect?
 	if len(resp.Data) != 2 {
@@ -467,12 +599,11 @@ func RollbackRolePassword(t *testing.T) {
 	}
 
 	wal := map[string]interface{}{
-		"CurrentPassword":    currentPassword,
-		"LastPassword":       "",
-		"RoleName":           role,
-		"TTL":                resp.Data["ttl"].(int),
-		"ServiceAccountName": resp.Data["service_account_name"].(string),
-		"LastVaultRotation":  resp.Data["last_vault_rotation"],
+		"current_password":     currentPassword,
+		"last_password":        "",
+		"name":                 role,
+		"service_account_name": resp.Data["service_account_name"].(string),
+		"last_vault_rotation":  resp.Data["last_vault_rotation"],
 	}
 
 	// Rotate role's creds
@@ -566,12 +697,11 @@ func DiscardWAL(t *testing.T) {
 	}
 
 	wal := map[string]interface{}{
-		"CurrentPassword":    currentPassword,
-		"LastPassword":       "",
-		"RoleName":           role,
-		"TTL":                resp.Data["ttl"].(int),
-		"ServiceAccountName": resp.Data["service_account_name"].(string),
-		"LastVaultRotation":  resp.Data["last_vault_rotation"],
+		"current_password":     currentPassword,
+		"last_password":        "",
+		"name":                 role,
+		"service_account_name": resp.Data["service_account_name"].(string),
+		"last_vault_rotation":  resp.Data["last_vault_rotation"],
 	}
 
 	// Rollback the creds
@@ -672,6 +802,96 @@ Beq3QOqp2+dga36IzQybzPQ8QtotrpSJ3q82zztEvyWiJ7E=
 -----END CERTIFICATE-----
 `
 
+// testConfig returns the config most tests start from, which generates
+// passwords with the default length and TTLs.
+func testConfig() *configuration {
+	return &configuration{
+		PasswordConf: passwordConf{
+			TTL:    defaultTTLInt,
+			MaxTTL: maxTTLInt,
+			Length: defaultPasswordLength,
+		},
+		ADConf: &client.ADConf{ConfigEntry: &ldaputil.ConfigEntry{}},
+	}
+}
+
+// getBackend returns a backend that uses the client, set up with the default
+// lease TTLs, along with storage the config has been written to. If the config
+// is nil, none is written.
+func getBackend(t testing.TB, adClient SecretsClient, config *configuration) (*backend, logical.Storage) {
+	t.Helper()
+	return getBackendWithSystemView(t, adClient, config, &logical.StaticSystemView{
+		DefaultLeaseTTLVal: defaultLeaseTTLVal,
+		MaxLeaseTTLVal:     maxLeaseTTLVal,
+	})
+}
+
+// getBackendWithSystemView is like getBackend, but sets the backend up with the
+// system view, for tests that need other lease TTLs or an entity.
+func getBackendWithSystemView(t testing.TB, adClient SecretsClient, config *configuration, system logical.SystemView) (*backend, logical.Storage) {
+	t.Helper()
+	storage := &logical.InmemStorage{}
+	b := newBackend(adClient, nil)
+	if err := b.Setup(ctx, &logical.BackendConfig{System: system}); err != nil {
+		t.Fatal(err)
+	}
+	if config != nil {
+		if err := writeConfig(ctx, storage, config); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b, storage
+}
+
+// sendRequest sends the request to the backend with the storage, and fails the
+// test if it returns an error. Error responses are returned for the test to check.
+func sendRequest(t testing.TB, b *backend, storage logical.Storage, req *logical.Request) *logical.Response {
+	t.Helper()
+	req.Storage = storage
+	resp, err := b.HandleRequest(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// requester returns a func that sends requests to the backend as the entity,
+// like sendRequest does.
+func requester(t testing.TB, b *backend, storage logical.Storage, entityID string) func(logical.Operation, string, map[string]interface{}) *logical.Response {
+	return func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		return sendRequest(t, b, storage, &logical.Request{
+			Operation: operation,
+			Path:      path,
+			EntityID:  entityID,
+			Data:      data,
+		})
+	}
+}
+
+// succeedingRequester is like requester, but also fails the test if the backend
+// responds with an error.
+func succeedingRequester(t testing.TB, b *backend, storage logical.Storage, entityID string) func(logical.Operation, string, map[string]interface{}) *logical.Response {
+	request := requester(t, b, storage, entityID)
+	return func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp := request(operation, path, data)
+		if resp != nil && resp.IsError() {
+			t.Fatalf("unexpected error: %#v", resp)
+		}
+		return resp
+	}
+}
+
+// responseErrorCode returns the error code of an error response, or nil if the
+// response isn't an error.
+func responseErrorCode(resp *logical.Response) interface{} {
+	if resp == nil || !resp.IsError() {
+		return nil
+	}
+	return resp.Data["data"].(map[string]interface{})["error_code"]
+}
+
 type fakeSecretsClient struct {
 	throwErrs bool
 }
@@ -6,8 +6,13 @@ package plugin
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -30,13 +35,88 @@ type CheckOut struct {
 	IsAvailable         bool   `json:"is_available"`
 	BorrowerEntityID    string `json:"borrower_entity_id"`
 	BorrowerClientToken string `json:"borrower_client_token"`
+
+	// ID identifies the check-out, so it can be checked in without naming the
+	// service account. Check-outs made before IDs existed have none.
+	ID string `json:"id,omitempty"`
+
+	// Network is the CIDR the account was checked out from, if its set binds
+	// check-outs to the borrower's network.
+	Network string `json:"network,omitempty"`
+
+	// Operator identifies who checked the account out on the borrower's behalf
+	// through the manage path, if anyone did.
+	Operator string `json:"operator,omitempty"`
+
+	// RemoteAddress and TokenAccessor are where the check-out request came from
+	// and the accessor of the token that made it, if Vault provided them. For
+	// check-outs made through the manage path, they're the operator's.
+	RemoteAddress string `json:"remote_address,omitempty"`
+	TokenAccessor string `json:"token_accessor,omitempty"`
+
+	// Reason is why the borrower said they needed the account, if they did.
+	Reason string `json:"reason,omitempty"`
+
+	// DueAt is when the check-out's lease expires unless it's renewed, and
+	// DueWarningSent is whether its borrower was warned it's expiring soon since
+	// it was last renewed. Check-outs made before due times were kept have none.
+	DueAt          time.Time `json:"due_at,omitempty"`
+	DueWarningSent bool      `json:"due_warning_sent,omitempty"`
+
+	// CheckedOutAt is when the check-out was made, which its max_ttl counts from
+	// when it's renewed through the library's renew path. LeaseLapsed is set once
+	// its lease expired before it was due, leaving it to be checked in when it is.
+	CheckedOutAt time.Time `json:"checked_out_at,omitempty"`
+	LeaseLapsed  bool      `json:"lease_lapsed,omitempty"`
+
+	// ExtendedUntil is when an operator extended the check-out to last until
+	// through the manage path, and ExtendedBy is who did, if anyone has. The
+	// lease's renewals are allowed to last until then.
+	ExtendedUntil time.Time `json:"extended_until,omitempty"`
+	ExtendedBy    string    `json:"extended_by,omitempty"`
+
+	// CheckedInAt is when an available account was last checked in, so its
+	// set's check_out_cooldown can be enforced.
+	CheckedInAt time.Time `json:"checked_in_at,omitempty"`
+}
+
+// storedPassword is the current password for a service account in the library,
+// along with when Vault last set it.
+type storedPassword struct {
+	Password    string    `json:"password"`
+	LastRotated time.Time `json:"last_rotated"`
+
+	// Ciphertext replaces Password when the config's transit_key_name is set, and
+	// TransitKey is the key that encrypted it.
+	Ciphertext string      `json:"ciphertext,omitempty"`
+	TransitKey *transitKey `json:"transit_key,omitempty"`
+
+	// ExternallySet is true if the password was supplied by an operator rather
+	// than generated, and the rest say who supplied it. It's cleared the next
+	// time Vault rotates the password.
+	ExternallySet    bool   `json:"externally_set,omitempty"`
+	SetByEntityID    string `json:"set_by_entity_id,omitempty"`
+	SetByDisplayName string `json:"set_by_display_name,omitempty"`
+
+	// Epoch is the storage epoch the password was set or verified in. Passwords
+	// from an earlier epoch are checked against AD before they're checked out.
+	Epoch string `json:"epoch,omitempty"`
 }
 
 // checkOutHandler manages checkouts. It's not thread-safe and expects the caller to handle locking because
 // locking may span multiple calls.
 type checkOutHandler struct {
-	client            secretsClient
+	client            SecretsClient
 	passwordGenerator passwordGenerator
+	now               func() time.Time
+	rotationLocks     []*locksutil.LockEntry
+	// usage, if set, counts the passwords rotated.
+	usage *usageRecorder
+	// limiter, if set, spreads rotations out to the config's rotation_rate_limit.
+	limiter *rate.Limiter
+	// transit encrypts passwords before they're stored, if the config has a
+	// transit_key_name.
+	transit *transitCache
 }
 
 // CheckOut attempts to check out a service account. If the account is unavailable, it returns
@@ -84,6 +164,16 @@ func (h *checkOutHandler) CheckOut(ctx context.Context, storage logical.Storage,
 // and can either be retried by the caller, or eventually may be checked in if it has a ttl
 // that ends.
 func (h *checkOutHandler) CheckIn(ctx context.Context, storage logical.Storage, serviceAccountName string) error {
+	return h.makeAvailable(ctx, storage, serviceAccountName, h.now())
+}
+
+// AddAccount rotates the password of a service account being added to a set and makes it
+// available. Unlike a check-in, it doesn't start the set's check-out cooldown.
+func (h *checkOutHandler) AddAccount(ctx context.Context, storage logical.Storage, serviceAccountName string) error {
+	return h.makeAvailable(ctx, storage, serviceAccountName, time.Time{})
+}
+
+func (h *checkOutHandler) makeAvailable(ctx context.Context, storage logical.Storage, serviceAccountName string, checkedInAt time.Time) error {
 	if ctx == nil {
 		return errors.New("ctx must be provided")
 	}
@@ -95,33 +185,132 @@ func (h *checkOutHandler) CheckIn(ctx context.Context, storage logical.Storage,
 	}
 
 	// On check-ins, a new AD password is generated, updated in AD, and stored.
-	engineConf, err := readConfig(ctx, storage)
+	if _, err := h.RotatePassword(ctx, storage, serviceAccountName); err != nil {
+		return err
+	}
+
+	// That ends the password-handling leg of our journey, now let's deal with the stored check-out itself.
+	// Store a check-out status indicating it's available.
+	checkOut := &CheckOut{
+		IsAvailable: true,
+		CheckedInAt: checkedInAt,
+	}
+	entry, err := logical.StorageEntryJSON(checkoutStoragePrefix+serviceAccountName, checkOut)
 	if err != nil {
 		return err
 	}
+	return storage.Put(ctx, entry)
+}
+
+// RotatePassword generates a new password for a service account, updates it in AD, and stores it.
+// It doesn't change whether the service account is checked out. It waits for the
+// rotation rate limit before it takes the service account's rotation lock.
+func (h *checkOutHandler) RotatePassword(ctx context.Context, storage logical.Storage, serviceAccountName string) (string, error) {
+	engineConf, err := readConfig(ctx, storage)
+	if err != nil {
+		return "", err
+	}
+	if err := h.throttle(ctx, engineConf); err != nil {
+		return "", err
+	}
+	return h.rotatePassword(ctx, storage, serviceAccountName)
+}
+
+// rotatePassword is RotatePassword without the wait for the rotation rate limit,
+// for callers that already waited before taking their own locks.
+func (h *checkOutHandler) rotatePassword(ctx context.Context, storage logical.Storage, serviceAccountName string) (string, error) {
+	lock := locksutil.LockForKey(h.rotationLocks, serviceAccountName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := checkRotationPaused(ctx, storage, h.now()); err != nil {
+		return "", err
+	}
+
+	engineConf, err := readConfig(ctx, storage)
+	if err != nil {
+		return "", err
+	}
 	if engineConf == nil {
-		return errors.New("the config is currently unset")
+		return "", errors.New("the config is currently unset")
+	}
+	if engineConf, err = libraryConf(ctx, storage, engineConf, serviceAccountName); err != nil {
+		return "", err
+	}
+	if err := checkMinPasswordAge(h.client, engineConf, serviceAccountName, h.now()); err != nil {
+		return "", err
 	}
 	newPassword, err := GeneratePassword(ctx, engineConf.PasswordConf, h.passwordGenerator)
 	if err != nil {
-		return err
+		return "", err
 	}
-	if err := h.client.UpdatePassword(engineConf.ADConf, serviceAccountName, newPassword); err != nil {
-		return err
+
+	// The password is encrypted before it's set in AD, so if Transit is down the
+	// rotation stops there instead of leaving a password Vault can't store.
+	rotatedAt := h.now().UTC()
+	sealed, err := sealPassword(ctx, h.transit, engineConf, &storedPassword{
+		Password:    newPassword,
+		LastRotated: rotatedAt,
+	})
+	if err != nil {
+		return "", err
 	}
-	pwdEntry, err := logical.StorageEntryJSON(passwordStoragePrefix+serviceAccountName, newPassword)
+	// If we crash after updating AD but before storing the password, the WAL lets
+	// us finish the job so AD and Vault agree on the current password. It holds
+	// the password the way it'll be stored, so it's encrypted if that is.
+	wal := checkInEntry{
+		ServiceAccountName: serviceAccountName,
+		Password:           sealed.Password,
+		Ciphertext:         sealed.Ciphertext,
+		TransitKey:         sealed.TransitKey,
+		RotatedAt:          rotatedAt.Format(time.RFC3339Nano),
+	}
+	walID, err := framework.PutWAL(ctx, storage, checkInWAL, wal)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("could not persist WAL before check-in: %w", err)
 	}
-	if err := storage.Put(ctx, pwdEntry); err != nil {
-		return err
+	if err := h.client.UpdatePassword(engineConf.ADConf, serviceAccountName, newPassword); err != nil {
+		// AD wasn't changed, so there's nothing for the rollback to finish. It
+		// would otherwise set the password later, without the checks this
+		// rotation just made.
+		_ = framework.DeleteWAL(ctx, storage, walID)
+		return "", err
+	}
+	if err := writePassword(ctx, storage, serviceAccountName, sealed); err != nil {
+		return "", err
 	}
+	h.usage.rotated(ctx, storage, h.now())
+	// The password is safely stored, so if the WAL can't be deleted here,
+	// the rollback handler will find nothing to do and discard it.
+	_ = framework.DeleteWAL(ctx, storage, walID)
+	return newPassword, nil
+}
 
-	// That ends the password-handling leg of our journey, now let's deal with the stored check-out itself.
-	// Store a check-out status indicating it's available.
-	checkOut := &CheckOut{
-		IsAvailable: true,
+// throttle waits until the config's rotation rate limit allows another rotation.
+// It returns an error right away if the wait would outlast the context. No lock
+// should be held while it waits.
+func (h *checkOutHandler) throttle(ctx context.Context, engineConf *configuration) error {
+	if h.limiter == nil || engineConf == nil {
+		return nil
 	}
+	limit := rate.Inf
+	if engineConf.RotationRateLimit > 0 {
+		limit = rate.Limit(engineConf.RotationRateLimit)
+	}
+	if h.limiter.Limit() != limit {
+		h.limiter.SetLimit(limit)
+	}
+	if burst := max(engineConf.RotationBurst, 1); h.limiter.Burst() != burst {
+		h.limiter.SetBurst(burst)
+	}
+	if err := h.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("unable to rotate the password within the rotation rate limit: %w", err)
+	}
+	return nil
+}
+
+// Update stores changes to a service account's current check-out.
+func (h *checkOutHandler) Update(ctx context.Context, storage logical.Storage, serviceAccountName string, checkOut *CheckOut) error {
 	entry, err := logical.StorageEntryJSON(checkoutStoragePrefix+serviceAccountName, checkOut)
 	if err != nil {
 		return err
@@ -175,22 +364,119 @@ func (h *checkOutHandler) Delete(ctx context.Context, storage logical.Storage, s
 	return storage.Delete(ctx, checkoutStoragePrefix+serviceAccountName)
 }
 
+// storePassword is a utility function for storing a service account's current password.
+// It records the current time as when the password was last rotated.
+func storePassword(ctx context.Context, storage logical.Storage, transit *transitCache, serviceAccountName, password string, lastRotated time.Time) error {
+	return putPassword(ctx, storage, transit, serviceAccountName, &storedPassword{
+		Password:    password,
+		LastRotated: lastRotated.UTC(),
+	})
+}
+
+// putPassword stores a password, encrypting it first if the config says to.
+func putPassword(ctx context.Context, storage logical.Storage, transit *transitCache, serviceAccountName string, stored *storedPassword) error {
+	engineConf, err := readConfig(ctx, storage)
+	if err != nil {
+		return err
+	}
+	sealed, err := sealPassword(ctx, transit, engineConf, stored)
+	if err != nil {
+		return err
+	}
+	return writePassword(ctx, storage, serviceAccountName, sealed)
+}
+
+// writePassword stores a password as it is, so it must already be encrypted if
+// the config says it should be. It's marked as set in the current storage epoch.
+func writePassword(ctx context.Context, storage logical.Storage, serviceAccountName string, stored *storedPassword) error {
+	epoch, err := readStorageEpoch(ctx, storage)
+	if err != nil {
+		return err
+	}
+	stamped := *stored
+	stamped.Epoch = epoch
+	entry, err := logical.StorageEntryJSON(passwordStoragePrefix+serviceAccountName, &stamped)
+	if err != nil {
+		return err
+	}
+	return storage.Put(ctx, entry)
+}
+
 // retrievePassword is a utility function for grabbing a service account's password from storage.
 // retrievePassword will return:
 //   - "password", nil if it was successfully able to retrieve the password.
 //   - errNotFound if there's no password presently.
 //   - Some other err if it was unable to complete successfully.
-func retrievePassword(ctx context.Context, storage logical.Storage, serviceAccountName string) (string, error) {
-	entry, err := storage.Get(ctx, passwordStoragePrefix+serviceAccountName)
+func retrievePassword(ctx context.Context, storage logical.Storage, transit *transitCache, serviceAccountName string) (string, error) {
+	stored, err := loadPassword(ctx, storage, transit, serviceAccountName)
 	if err != nil {
 		return "", err
 	}
+	return stored.Password, nil
+}
+
+// loadPassword is like retrievePassword, but also returns when the password was last rotated.
+// Passwords stored before rotation times were tracked have a zero LastRotated.
+func loadPassword(ctx context.Context, storage logical.Storage, transit *transitCache, serviceAccountName string) (*storedPassword, error) {
+	stored, err := loadPasswordMetadata(ctx, storage, serviceAccountName)
+	if err != nil {
+		return nil, err
+	}
+	if stored.TransitKey == nil {
+		return stored, nil
+	}
+	engineConf, err := readConfig(ctx, storage)
+	if err != nil {
+		return nil, err
+	}
+	if err := unsealPassword(ctx, transit, engineConf, stored); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// loadPasswordMetadata is like loadPassword, but doesn't decrypt the password, for
+// callers that only need to know when it was set.
+func loadPasswordMetadata(ctx context.Context, storage logical.Storage, serviceAccountName string) (*storedPassword, error) {
+	entry, err := storage.Get(ctx, passwordStoragePrefix+serviceAccountName)
+	if err != nil {
+		return nil, err
+	}
 	if entry == nil {
-		return "", errNotFound
+		return nil, errNotFound
 	}
-	password := ""
-	if err := entry.DecodeJSON(&password); err != nil {
-		return "", err
+	stored := &storedPassword{}
+	if err := entry.DecodeJSON(stored); err != nil {
+		// Older versions stored the password as a bare string.
+		if err := entry.DecodeJSON(&stored.Password); err != nil {
+			return nil, err
+		}
+	}
+	return stored, nil
+}
+
+// libraryConf returns the config to manage a library service account with: the
+// one its set names, with the characters the set excludes left out of its
+// passwords.
+func libraryConf(ctx context.Context, storage logical.Storage, engineConf *configuration, serviceAccountName string) (*configuration, error) {
+	owner, err := readAccountOwner(ctx, storage, serviceAccountName)
+	if err != nil || owner == nil || owner.Kind != accountOwnerSet {
+		return engineConf, err
+	}
+	set, err := readSet(ctx, storage, owner.Name)
+	if err != nil || set == nil {
+		return engineConf, err
+	}
+	setConf, err := configFor(ctx, storage, engineConf, set.Config)
+	if err != nil {
+		return nil, err
+	}
+	if set.ExcludeCharacters != "" {
+		if setConf == engineConf {
+			copied := *engineConf
+			setConf = &copied
+		}
+		setConf.PasswordConf = setConf.PasswordConf.withExcludedCharacters(set.ExcludeCharacters)
 	}
-	return password, nil
+	return setConf, nil
 }
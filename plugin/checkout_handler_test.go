@@ -8,8 +8,12 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/time/rate"
 )
 
 func setup() (context.Context, logical.Storage, string, *CheckOut) {
@@ -39,7 +43,9 @@ func TestCheckOutHandlerStorageLayer(t *testing.T) {
 	ctx, storage, serviceAccountName, testCheckOut := setup()
 
 	storageHandler := &checkOutHandler{
-		client: &fakeSecretsClient{},
+		client:        &fakeSecretsClient{},
+		rotationLocks: locksutil.CreateLocks(),
+		now:           time.Now,
 	}
 
 	// Service accounts must initially be checked in to the library
@@ -101,7 +107,9 @@ func TestPasswordHandlerInterfaceFulfillment(t *testing.T) {
 	ctx, storage, serviceAccountName, checkOut := setup()
 
 	passwordHandler := &checkOutHandler{
-		client: &fakeSecretsClient{},
+		client:        &fakeSecretsClient{},
+		rotationLocks: locksutil.CreateLocks(),
+		now:           time.Now,
 	}
 
 	// We must always start managing a service account by checking it in.
@@ -115,14 +123,14 @@ func TestPasswordHandlerInterfaceFulfillment(t *testing.T) {
 	}
 
 	// The password should get rotated successfully during check-in.
-	origPassword, err := retrievePassword(ctx, storage, serviceAccountName)
+	origPassword, err := retrievePassword(ctx, storage, passwordHandler.transit, serviceAccountName)
 	if err != nil {
 		t.Fatal(err)
 	}
 	if err := passwordHandler.CheckIn(ctx, storage, serviceAccountName); err != nil {
 		t.Fatal(err)
 	}
-	currPassword, err := retrievePassword(ctx, storage, serviceAccountName)
+	currPassword, err := retrievePassword(ctx, storage, passwordHandler.transit, serviceAccountName)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -135,7 +143,7 @@ func TestPasswordHandlerInterfaceFulfillment(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	currPassword, err = retrievePassword(ctx, storage, serviceAccountName)
+	currPassword, err = retrievePassword(ctx, storage, passwordHandler.transit, serviceAccountName)
 	if err != errNotFound {
 		t.Fatal("expected errNotFound")
 	}
@@ -148,3 +156,145 @@ func TestPasswordHandlerInterfaceFulfillment(t *testing.T) {
 		t.Fatal("expected checkOut to be nil")
 	}
 }
+
+func TestCheckInRollback(t *testing.T) {
+	ctx, storage, serviceAccountName, _ := setup()
+
+	b := newBackend(&fakeSecretsClient{}, nil)
+	if err := b.checkOutHandler.CheckIn(ctx, storage, serviceAccountName); err != nil {
+		t.Fatal(err)
+	}
+
+	// A successful check-in shouldn't leave a WAL behind.
+	walIDs, err := framework.ListWAL(ctx, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(walIDs) != 0 {
+		t.Fatalf("expected no WALs but found %d", len(walIDs))
+	}
+
+	// Simulate a check-in that updated AD but crashed before storing the password.
+	wal := map[string]interface{}{
+		"service_account_name": serviceAccountName,
+		"password":             "updated-in-ad",
+	}
+	if err := b.handleCheckInRollback(ctx, storage, wal); err != nil {
+		t.Fatal(err)
+	}
+	password, err := retrievePassword(ctx, storage, b.transit, serviceAccountName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password != "updated-in-ad" {
+		t.Fatalf("expected the WAL's password to be stored but received %q", password)
+	}
+
+	// A WAL older than the stored password doesn't replace it.
+	if err := storePassword(ctx, storage, b.transit, serviceAccountName, "rotated-later", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	staleWAL := map[string]interface{}{
+		"service_account_name": serviceAccountName,
+		"password":             "stale",
+		"rotated_at":           time.Now().Add(-time.Hour).Format(time.RFC3339Nano),
+	}
+	if err := b.handleCheckInRollback(ctx, storage, staleWAL); err != nil {
+		t.Fatal(err)
+	}
+	if password, err := retrievePassword(ctx, storage, b.transit, serviceAccountName); err != nil || password != "rotated-later" {
+		t.Fatalf("expected the later password to be kept but received %q, %v", password, err)
+	}
+
+	// Nor does a rotation AD refused leave a WAL behind to set its password later.
+	failing := newBackend(&fakeSecretsClient{throwErrs: true}, nil)
+	if _, err := failing.checkOutHandler.RotatePassword(ctx, storage, serviceAccountName); err == nil {
+		t.Fatal("expected the rotation to fail")
+	}
+	if walIDs, err := framework.ListWAL(ctx, storage); err != nil || len(walIDs) != 0 {
+		t.Fatalf("expected no WALs but found %v, %v", walIDs, err)
+	}
+
+	// WALs for accounts that are no longer managed are discarded.
+	if err := b.checkOutHandler.Delete(ctx, storage, serviceAccountName); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.handleCheckInRollback(ctx, storage, wal); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := retrievePassword(ctx, storage, b.transit, serviceAccountName); err != errNotFound {
+		t.Fatalf("expected errNotFound but received %v", err)
+	}
+}
+
+func TestRotatePasswordIsSerialized(t *testing.T) {
+	ctx, storage, serviceAccountName, _ := setup()
+
+	b := newBackend(&fakeSecretsClient{}, nil)
+
+	// Hold the account's rotation lock as another subsystem would.
+	lock := locksutil.LockForKey(b.rotationLocks, serviceAccountName)
+	lock.Lock()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.checkOutHandler.RotatePassword(ctx, storage, serviceAccountName)
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected rotation to wait for the account's rotation lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	lock.Unlock()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected rotation to complete once the lock was released")
+	}
+}
+
+func TestRotatePasswordIsRateLimited(t *testing.T) {
+	_, storage, _, _ := setup()
+	config := &configuration{
+		PasswordConf: passwordConf{
+			Length: 14,
+		},
+		RotationRateLimit: 0.001,
+		RotationBurst:     2,
+	}
+	entry, err := logical.StorageEntryJSON(configStorageKey, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put(context.Background(), entry); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := &checkOutHandler{
+		client:        &fakeSecretsClient{},
+		rotationLocks: locksutil.CreateLocks(),
+		now:           time.Now,
+		limiter:       rate.NewLimiter(rate.Inf, defaultRotationBurst),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// The burst is let through at once.
+	for i := 0; i < 2; i++ {
+		if _, err := handler.RotatePassword(ctx, storage, fmt.Sprintf("svc%d@example.com", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The next rotation would have to wait longer than the context allows.
+	if _, err := handler.RotatePassword(ctx, storage, "svc2@example.com"); err == nil {
+		t.Fatal("expected the rotation to be refused by the rate limit")
+	}
+	if _, err := loadPassword(ctx, storage, handler.transit, "svc2@example.com"); err != errNotFound {
+		t.Fatalf("expected no password to be stored but received %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// BindModeDN binds with the binddn and bindpass.
+	BindModeDN = "dn"
+	// BindModeUPN binds as upn_username@upndomain with the bindpass.
+	BindModeUPN = "upn"
+)
+
+// BindModeOrDefault returns how the config binds with a password. Configs
+// written before bind_mode existed bind with a UPN made from the binddn if the
+// upndomain is set, so that's what they keep doing.
+func (c *ADConf) BindModeOrDefault() string {
+	if c.BindMode != "" {
+		return c.BindMode
+	}
+	if c.ConfigEntry != nil && c.UPNDomain != "" {
+		return BindModeUPN
+	}
+	return BindModeDN
+}
+
+// upnBindUsername returns the username part of the UPN bound as, which is the
+// binddn on configs that don't set bind_mode.
+func (c *ADConf) upnBindUsername() string {
+	if c.BindMode == "" {
+		return c.BindDN
+	}
+	return c.UPNUsername
+}
+
+// BindUPN returns the userPrincipalName the config binds as, or "" if it binds
+// with a DN.
+func (c *ADConf) BindUPN() string {
+	if c.BindModeOrDefault() != BindModeUPN || c.upnBindUsername() == "" {
+		return ""
+	}
+	return c.upnBindUsername() + "@" + c.UPNDomain
+}
+
+// ValidateBindMode returns an error if the bind_mode doesn't have the fields it
+// needs, or has ones that belong to the other mode. Configs without a bind_mode
+// aren't checked, since they're interpreted the way they always were.
+func (c *ADConf) ValidateBindMode() error {
+	switch c.BindMode {
+	case "":
+		if c.UPNUsername != "" {
+			return errors.New("upn_username is only used when bind_mode is upn")
+		}
+	case BindModeDN:
+		if c.UPNUsername != "" {
+			return errors.New("upn_username is only used when bind_mode is upn, so it must be empty when bind_mode is dn")
+		}
+		if c.BindDN == "" && !c.BindsWithKerberos() && !c.BindsWithClientCertificate() {
+			return errors.New("binddn is required when bind_mode is dn")
+		}
+	case BindModeUPN:
+		if c.UPNUsername == "" {
+			return errors.New("upn_username is required when bind_mode is upn")
+		}
+		if strings.Contains(c.UPNUsername, "@") {
+			return fmt.Errorf("upn_username %q must not contain an @, since upndomain is added to it", c.UPNUsername)
+		}
+		if c.UPNDomain == "" {
+			return errors.New("upndomain is required when bind_mode is upn")
+		}
+		if c.BindDN != "" {
+			return errors.New("binddn isn't used when bind_mode is upn, so it must be set to an empty string")
+		}
+	default:
+		return fmt.Errorf("bind_mode must be %q or %q, not %q", BindModeDN, BindModeUPN, c.BindMode)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"crypto"
+	"crypto/md5"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+	krbclient "github.com/jcmturner/gokrb5/v8/client"
+	krbcrypto "github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// gssapiContextFlags are the GSS-API flags asked for when binding, which are
+// the ones go-ldap asks for.
+var gssapiContextFlags = []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf, gssapi.ContextFlagMutual}
+
+// channelBoundGSSAPIClient is a SASL GSSAPI client like go-ldap's, except that
+// its AP-REQ carries the channel bindings of the TLS connection it's sent
+// over, so domain controllers that require LDAP channel binding accept it.
+type channelBoundGSSAPIClient struct {
+	client *krbclient.Client
+	// bindings is the channel binding application data, which is the
+	// "tls-server-end-point" of the domain controller's certificate.
+	bindings []byte
+
+	ekey   types.EncryptionKey
+	subkey types.EncryptionKey
+}
+
+// newChannelBoundGSSAPIClient returns a GSSAPI client bound to the TLS
+// connection's channel, or an error if the connection isn't encrypted.
+func newChannelBoundGSSAPIClient(krb *krbclient.Client, conn ldaputil.Connection) (*channelBoundGSSAPIClient, error) {
+	tlsConn, ok := conn.(tlsConnection)
+	if !ok {
+		return nil, errors.New("channel_binding is set but the connection doesn't support TLS")
+	}
+	state, encrypted := tlsConn.TLSConnectionState()
+	if !encrypted || len(state.PeerCertificates) == 0 {
+		return nil, errors.New("channel_binding is set but the connection isn't encrypted, so there's no channel to bind to")
+	}
+	bindings, err := tlsServerEndPoint(state.PeerCertificates[0])
+	if err != nil {
+		return nil, err
+	}
+	return &channelBoundGSSAPIClient{client: krb, bindings: bindings}, nil
+}
+
+// tlsServerEndPoint returns the tls-server-end-point channel binding of a
+// server certificate from RFC 5929, which is the hash of the certificate with
+// its signature's hash function, or SHA-256 if that's MD5 or SHA-1.
+func tlsServerEndPoint(cert *x509.Certificate) ([]byte, error) {
+	var hash crypto.Hash
+	switch cert.SignatureAlgorithm {
+	case x509.MD5WithRSA, x509.SHA1WithRSA, x509.ECDSAWithSHA1, x509.DSAWithSHA1,
+		x509.SHA256WithRSA, x509.SHA256WithRSAPSS, x509.ECDSAWithSHA256, x509.DSAWithSHA256:
+		hash = crypto.SHA256
+	case x509.SHA384WithRSA, x509.SHA384WithRSAPSS, x509.ECDSAWithSHA384:
+		hash = crypto.SHA384
+	case x509.SHA512WithRSA, x509.SHA512WithRSAPSS, x509.ECDSAWithSHA512:
+		hash = crypto.SHA512
+	default:
+		return nil, fmt.Errorf("unable to bind to the channel of a domain controller whose certificate is signed with %s", cert.SignatureAlgorithm)
+	}
+	h := hash.New()
+	h.Write(cert.Raw)
+	return append([]byte("tls-server-end-point:"), h.Sum(nil)...), nil
+}
+
+// gssapiChecksum returns the authenticator checksum of RFC 4121 section
+// 4.1.1, with the MD5 hash of the channel bindings in its Bnd field. The
+// bindings have no addresses, like the ones AD expects.
+func gssapiChecksum(applicationData []byte, flags []int) []byte {
+	bindings := make([]byte, 20, 20+len(applicationData))
+	binary.LittleEndian.PutUint32(bindings[16:20], uint32(len(applicationData)))
+	bindings = append(bindings, applicationData...)
+	bnd := md5.Sum(bindings)
+
+	checksum := make([]byte, 24)
+	binary.LittleEndian.PutUint32(checksum[:4], uint32(len(bnd)))
+	copy(checksum[4:20], bnd[:])
+	var contextFlags uint32
+	for _, flag := range flags {
+		contextFlags |= uint32(flag)
+	}
+	binary.LittleEndian.PutUint32(checksum[20:24], contextFlags)
+	return checksum
+}
+
+// InitSecContext sends the AP-REQ for the target's service ticket with the
+// channel bindings, then reads the domain controller's AP-REP.
+func (c *channelBoundGSSAPIClient) InitSecContext(target string, input []byte) ([]byte, bool, error) {
+	if input == nil {
+		tkt, ekey, err := c.client.GetServiceTicket(target)
+		if err != nil {
+			return nil, false, err
+		}
+		c.ekey = ekey
+
+		token, err := spnego.NewKRB5TokenAPREQ(c.client, tkt, ekey, gssapiContextFlags, nil)
+		if err != nil {
+			return nil, false, err
+		}
+		// gokrb5 leaves the channel bindings out of the authenticator, so it's
+		// replaced with one that has them.
+		auth, err := types.NewAuthenticator(c.client.Credentials.Domain(), c.client.Credentials.CName())
+		if err != nil {
+			return nil, false, err
+		}
+		auth.Cksum = types.Checksum{
+			CksumType: chksumtype.GSSAPI,
+			Checksum:  gssapiChecksum(c.bindings, gssapiContextFlags),
+		}
+		if token.APReq, err = messages.NewAPReq(tkt, ekey, auth); err != nil {
+			return nil, false, err
+		}
+		output, err := token.Marshal()
+		if err != nil {
+			return nil, false, err
+		}
+		return output, true, nil
+	}
+
+	var token spnego.KRB5Token
+	if err := token.Unmarshal(input); err != nil {
+		return nil, false, err
+	}
+	if token.IsKRBError() {
+		return nil, true, token.KRBError
+	}
+	if !token.IsAPRep() {
+		return []byte{}, true, nil
+	}
+	encPart, err := krbcrypto.DecryptEncPart(token.APRep.EncPart, c.ekey, keyusage.AP_REP_ENCPART)
+	if err != nil {
+		return nil, false, err
+	}
+	part := &messages.EncAPRepPart{}
+	if err := part.Unmarshal(encPart); err != nil {
+		return nil, false, err
+	}
+	c.subkey = part.Subkey
+	return []byte{}, false, nil
+}
+
+// NegotiateSaslAuth verifies the domain controller's security layer token and
+// answers that no security layer is wanted, since TLS already protects the
+// connection. See RFC 4752 section 3.1.
+func (c *channelBoundGSSAPIClient) NegotiateSaslAuth(input []byte, authzid string) ([]byte, error) {
+	token := &gssapi.WrapToken{}
+	if err := token.Unmarshal(input, true); err != nil {
+		return nil, err
+	}
+	if token.Flags&0b1 == 0 {
+		return nil, errors.New("received a wrap token that isn't from the domain controller")
+	}
+	key := c.ekey
+	if token.Flags&0b100 != 0 {
+		key = c.subkey
+	}
+	if _, err := token.Verify(key, keyusage.GSSAPI_ACCEPTOR_SEAL); err != nil {
+		return nil, err
+	}
+	if len(token.Payload) != 4 {
+		return nil, errors.New("the domain controller sent a bad final token for the SASL GSSAPI handshake")
+	}
+
+	encType, err := krbcrypto.GetEtype(key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	reply := &gssapi.WrapToken{
+		Flags:     0b100,
+		EC:        uint16(encType.GetHMACBitLength() / 8),
+		SndSeqNum: 1,
+		Payload:   append([]byte{0, 0, 0, 0}, authzid...),
+	}
+	if err := reply.SetCheckSum(key, keyusage.GSSAPI_INITIATOR_SEAL); err != nil {
+		return nil, err
+	}
+	return reply.Marshal()
+}
+
+// DeleteSecContext forgets the keys of the security context.
+func (c *channelBoundGSSAPIClient) DeleteSecContext() error {
+	c.ekey = types.EncryptionKey{}
+	c.subkey = types.EncryptionKey{}
+	return nil
+}
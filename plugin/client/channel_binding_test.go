@@ -0,0 +1,119 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/ldapifc"
+)
+
+// testServerCertificate returns a self-signed certificate for a domain
+// controller, signed with the given curve and algorithm.
+func testServerCertificate(t *testing.T, curve elliptic.Curve, algorithm x509.SignatureAlgorithm) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:       big.NewInt(1),
+		Subject:            pkix.Name{CommonName: "dc1.corp.example.com"},
+		NotBefore:          time.Now().Add(-time.Hour),
+		NotAfter:           time.Now().Add(time.Hour),
+		SignatureAlgorithm: algorithm,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestTLSServerEndPoint(t *testing.T) {
+	cert := testServerCertificate(t, elliptic.P256(), x509.ECDSAWithSHA256)
+	sum256 := sha256.Sum256(cert.Raw)
+	bindings, err := tlsServerEndPoint(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bindings, append([]byte("tls-server-end-point:"), sum256[:]...)) {
+		t.Fatalf("unexpected channel bindings %q", bindings)
+	}
+
+	// The certificate's own hash is used if it's stronger than SHA-256.
+	cert = testServerCertificate(t, elliptic.P384(), x509.ECDSAWithSHA384)
+	sum384 := sha512.Sum384(cert.Raw)
+	bindings, err = tlsServerEndPoint(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bindings, append([]byte("tls-server-end-point:"), sum384[:]...)) {
+		t.Fatalf("unexpected channel bindings %q", bindings)
+	}
+}
+
+func TestGSSAPIChecksum(t *testing.T) {
+	applicationData := []byte("tls-server-end-point:hash")
+	checksum := gssapiChecksum(applicationData, gssapiContextFlags)
+	if len(checksum) != 24 || binary.LittleEndian.Uint32(checksum[:4]) != 16 {
+		t.Fatalf("unexpected checksum %x", checksum)
+	}
+	bindings := make([]byte, 20)
+	binary.LittleEndian.PutUint32(bindings[16:], uint32(len(applicationData)))
+	bnd := md5.Sum(append(bindings, applicationData...))
+	if !bytes.Equal(checksum[4:20], bnd[:]) {
+		t.Fatalf("expected the hash of the channel bindings but received %x", checksum[4:20])
+	}
+	if flags := binary.LittleEndian.Uint32(checksum[20:]); flags != 2|16|32 {
+		t.Fatalf("unexpected context flags %b", flags)
+	}
+}
+
+func TestBindWithChannelBinding(t *testing.T) {
+	client := &Client{ldap: &ldaputil.Client{Logger: hclog.NewNullLogger()}}
+	config := emptyConfig()
+	config.BindPassword = ""
+	config.BindKeytab = testKeytab(t, "vault", 1)
+	config.BindKrb5Conf = testKrb5Conf
+	config.BindPrincipal = "vault"
+	config.ChannelBinding = true
+
+	if err := client.bind(config, &ldapifc.FakeLDAPConnection{}, "ldap://dc1.corp.example.com"); err == nil {
+		t.Fatal("expected an error binding to the channel of an unencrypted connection")
+	}
+
+	cert := testServerCertificate(t, elliptic.P256(), x509.ECDSAWithSHA256)
+	conn := &ldapifc.FakeLDAPConnection{Encrypted: true, PeerCertificates: []*x509.Certificate{cert}}
+	if err := client.bind(config, conn, "ldaps://dc1.corp.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	bound, ok := conn.GSSAPIClient.(*channelBoundGSSAPIClient)
+	if !ok {
+		t.Fatalf("expected a channel-bound GSSAPI client but received %T", conn.GSSAPIClient)
+	}
+	expected, _ := tlsServerEndPoint(cert)
+	if !bytes.Equal(bound.bindings, expected) {
+		t.Fatalf("expected the bindings of the domain controller's certificate but received %q", bound.bindings)
+	}
+}
@@ -4,9 +4,14 @@
 package client
 
 import (
+	"crypto/tls"
 	"fmt"
 	"math"
+	"net"
+	"net/http"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-errors/errors"
@@ -27,9 +32,137 @@ func NewClient(logger hclog.Logger) *Client {
 
 type Client struct {
 	ldap *ldaputil.Client
+
+	mu sync.Mutex
+	// connReleased is signaled when a pooled connection is released, for
+	// requests waiting on max_open_connections.
+	connReleased *sync.Cond
+	pools        map[string]*connPool
+	discovered   map[string]discoveredDCs
+	health       map[string]*dcHealth
+	kerberos     map[string]*kerberosClient
+
+	// closed is set by Close, after which released connections are closed
+	// rather than kept idle.
+	closed bool
+
+	ocsp map[string]ocspStatus
+
+	// ocspHTTP makes OCSP requests. If it's nil, a client with the config's
+	// connection_timeout is used.
+	ocspHTTP *http.Client
+
+	// lookupSRV resolves DNS SRV records. It's net.LookupSRV unless a test
+	// replaces it.
+	lookupSRV func(service, proto, name string) (string, []*net.SRV, error)
+}
+
+// Prewarm dials AD and binds, and keeps the connection idle so the next search
+// or change with the same config doesn't have to. Unless max_idle_connections
+// allows more, a connection prewarmed earlier for the config is replaced.
+func (c *Client) Prewarm(cfg *ADConf) error {
+	cfg, err := c.withDiscoveredDCs(cfg)
+	if err != nil {
+		return err
+	}
+	conn, dcURL, err := c.dial(cfg)
+	if err != nil {
+		return err
+	}
+	if err := c.bind(cfg, conn, dcURL); err != nil {
+		conn.Close()
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := poolKey(cfg)
+	pool := c.poolFor(cfg, key)
+	if pool.maxOpen > 0 && pool.open >= pool.maxOpen {
+		// There are already as many connections as are allowed.
+		conn.Close()
+		return nil
+	}
+	pooled := c.newPooledConn(conn, key)
+	pooled.released = pooled.dialed
+	pool.open++
+	pool.idle = append(pool.idle, pooled)
+	maxIdle := pool.maxIdle
+	if maxIdle < 1 {
+		maxIdle = 1
+	}
+	for len(pool.idle) > maxIdle {
+		pool.idle[0].Connection.Close()
+		pool.idle = pool.idle[1:]
+		pool.open--
+	}
+	return nil
+}
+
+// connect returns a bound connection, reusing an idle one bound with the same
+// config if there is one. Closing it returns it to the pool.
+func (c *Client) connect(cfg *ADConf) (ldaputil.Connection, error) {
+	cfg, err := c.withDiscoveredDCs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	key := poolKey(cfg)
+	if conn := c.acquire(cfg, key); conn != nil {
+		return conn, nil
+	}
+	conn, dcURL, err := c.dial(cfg)
+	if err != nil {
+		c.discard(key)
+		return nil, err
+	}
+	if err := c.bind(cfg, conn, dcURL); err != nil {
+		conn.Close()
+		c.discard(key)
+		return nil, err
+	}
+	return c.newPooledConn(conn, key), nil
 }
 
 func (c *Client) Search(cfg *ADConf, baseDN string, filters map[*Field][]string) ([]*Entry, error) {
+	cfg, err := c.withDiscoveredDCs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	urls := strings.Split(cfg.Url, ",")
+	if !cfg.ParallelSearch || len(urls) < 2 {
+		return c.search(cfg, baseDN, filters)
+	}
+
+	// Search every domain controller at once and take the first answer, so one
+	// that's slow but still up doesn't hold up the search.
+	type result struct {
+		entries []*Entry
+		err     error
+	}
+	results := make(chan result, len(urls))
+	for _, u := range urls {
+		entry := *cfg.ConfigEntry
+		entry.Url = strings.TrimSpace(u)
+		dcConf := *cfg
+		dcConf.ConfigEntry = &entry
+		go func() {
+			entries, err := c.search(&dcConf, baseDN, filters)
+			results <- result{entries: entries, err: err}
+		}()
+	}
+	var errs []error
+	for range urls {
+		r := <-results
+		if r.err == nil {
+			return r.entries, nil
+		}
+		errs = append(errs, r.err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// search searches the first domain controller that can be reached.
+func (c *Client) search(cfg *ADConf, baseDN string, filters map[*Field][]string) ([]*Entry, error) {
 	req := &ldap.SearchRequest{
 		BaseDN:    baseDN,
 		Scope:     ldap.ScopeWholeSubtree,
@@ -37,16 +170,12 @@ func (c *Client) Search(cfg *ADConf, baseDN string, filters map[*Field][]string)
 		SizeLimit: math.MaxInt32,
 	}
 
-	conn, err := c.ldap.DialLDAP(cfg.ConfigEntry)
+	conn, err := c.connect(cfg)
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Close()
 
-	if err := bind(cfg, conn); err != nil {
-		return nil, err
-	}
-
 	result, err := conn.Search(req)
 	if err != nil {
 		return nil, err
@@ -76,15 +205,46 @@ func (c *Client) UpdateEntry(cfg *ADConf, baseDN string, filters map[*Field][]st
 		modifyReq.Replace(field.String(), vals)
 	}
 
-	conn, err := c.ldap.DialLDAP(cfg.ConfigEntry)
+	conn, err := c.connect(cfg)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
+	return conn.Modify(modifyReq)
+}
+
+// AddGroupMember adds the DN to the group's members. It succeeds if the DN is
+// already a member.
+func (c *Client) AddGroupMember(cfg *ADConf, groupDN, memberDN string) error {
+	modifyReq := ldap.NewModifyRequest(groupDN, nil)
+	modifyReq.Add(FieldRegistry.Member.String(), []string{memberDN})
+	err := c.modify(cfg, modifyReq)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultEntryAlreadyExists) {
+		return nil
+	}
+	return err
+}
 
-	if err := bind(cfg, conn); err != nil {
+// RemoveGroupMember removes the DN from the group's members. It succeeds if the
+// DN isn't a member.
+func (c *Client) RemoveGroupMember(cfg *ADConf, groupDN, memberDN string) error {
+	modifyReq := ldap.NewModifyRequest(groupDN, nil)
+	modifyReq.Delete(FieldRegistry.Member.String(), []string{memberDN})
+	err := c.modify(cfg, modifyReq)
+	// AD is unwilling to remove a member that isn't there, where other
+	// directories report that there's no such attribute value.
+	if ldap.IsErrorAnyOf(err, ldap.LDAPResultNoSuchAttribute, ldap.LDAPResultUnwillingToPerform) {
+		return nil
+	}
+	return err
+}
+
+func (c *Client) modify(cfg *ADConf, modifyReq *ldap.ModifyRequest) error {
+	conn, err := c.connect(cfg)
+	if err != nil {
 		return err
 	}
+	defer conn.Close()
 	return conn.Modify(modifyReq)
 }
 
@@ -111,52 +271,250 @@ func formatPassword(original string) (string, error) {
 	return utf16.NewEncoder().String("\"" + original + "\"")
 }
 
-// Ex. "(cn=Ellen Jones)"
+// Ex. "(cn=Ellen Jones)", or "(&(objectClass=computer)(sAMAccountName=WEB01$))"
+// when there are several filters, which must all match.
 func toString(filters map[*Field][]string) string {
 	var fieldEquals []string
 	for f, values := range filters {
 		for _, v := range values {
-			fieldEquals = append(fieldEquals, fmt.Sprintf("%s=%s", f, v))
+			fieldEquals = append(fieldEquals, fmt.Sprintf("(%s=%s)", f, v))
 		}
 	}
-	result := strings.Join(fieldEquals, ",")
-	return "(" + result + ")"
+	if len(fieldEquals) == 1 {
+		return fieldEquals[0]
+	}
+	sort.Strings(fieldEquals)
+	return "(&" + strings.Join(fieldEquals, "") + ")"
 }
 
-func bind(cfg *ADConf, conn ldaputil.Connection) error {
-	if cfg.BindPassword == "" {
-		return errors.New("unable to bind due to lack of configured password")
+// tlsConnection is implemented by connections that know whether they're encrypted.
+type tlsConnection interface {
+	TLSConnectionState() (tls.ConnectionState, bool)
+}
+
+// isEncrypted reports whether the connection uses TLS.
+func isEncrypted(conn ldaputil.Connection) bool {
+	tlsConn, ok := conn.(tlsConnection)
+	if !ok {
+		return false
 	}
+	_, encrypted := tlsConn.TLSConnectionState()
+	return encrypted
+}
 
-	if cfg.UPNDomain != "" {
-		origErr := conn.Bind(fmt.Sprintf("%s@%s", ldaputil.EscapeLDAPValue(cfg.BindDN), cfg.UPNDomain), cfg.BindPassword)
-		if origErr == nil {
-			return nil
+// dial connects to AD, at the domain controllers found in DNS if the config asks
+// for them to be discovered, and at the first one that's up. It returns the URL
+// of the domain controller it connected to. If the config requires StartTLS,
+// ldap:// connections are upgraded, and the connection is abandoned before
+// binding unless it's encrypted. So is any connection that isn't encrypted if
+// the config enforces secure connections.
+func (c *Client) dial(cfg *ADConf) (ldaputil.Connection, string, error) {
+	cfg, err := c.withDiscoveredDCs(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	entry := *cfg.ConfigEntry
+	if cfg.RequireStartTLS {
+		entry.StartTLS = true
+	}
+	conn, dcURL, err := c.dialFirstHealthy(&entry)
+	if err != nil {
+		return nil, "", err
+	}
+	if cfg.RequireStartTLS && !isEncrypted(conn) {
+		conn.Close()
+		return nil, "", errors.New("refusing to bind because require_starttls is set and the connection isn't encrypted")
+	}
+	if cfg.EnforceSecureConnection && !isEncrypted(conn) {
+		conn.Close()
+		return nil, "", fmt.Errorf("refusing to use the connection to %s because enforce_secure_connection is set and it isn't encrypted", dcURL)
+	}
+	if err := c.checkRevocation(cfg, conn); err != nil {
+		conn.Close()
+		return nil, "", err
+	}
+	return conn, dcURL, nil
+}
+
+// VerifyPassword binds to AD as the account with the given DN and password on a
+// connection of its own, to check that the password works.
+func (c *Client) VerifyPassword(cfg *ADConf, accountDN, password string) error {
+	conn, _, err := c.dial(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Bind(accountDN, password)
+}
+
+// MinPasswordAge returns how long the password of the account with the given DN
+// must be kept before it can be changed again. It's the minimum age of the
+// account's resultant fine-grained password policy if it has one, and otherwise
+// its domain's minPwdAge.
+func (c *Client) MinPasswordAge(cfg *ADConf, accountDN string) (time.Duration, error) {
+	conn, err := c.connect(cfg)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	policyDN, ageField := "", FieldRegistry.MSDSMinimumPasswordAge
+	// msDS-ResultantPSO is constructed, so it's only returned when it's asked for.
+	psos, err := readAttribute(conn, accountDN, FieldRegistry.MSDSResultantPSO)
+	if err != nil {
+		return 0, err
+	}
+	if len(psos) == 1 {
+		policyDN = psos[0]
+	} else {
+		policyDN, err = domainDN(accountDN)
+		if err != nil {
+			return 0, err
 		}
-		if !shouldTryLastPwd(cfg.LastBindPassword, cfg.LastBindPasswordRotation) {
-			return origErr
+		ageField = FieldRegistry.MinPasswordAge
+	}
+	ages, err := readAttribute(conn, policyDN, ageField)
+	if err != nil {
+		return 0, err
+	}
+	if len(ages) != 1 {
+		return 0, fmt.Errorf("expected one value for %s on %q, but received %s", ageField, policyDN, ages)
+	}
+	age, _, err := ParseInterval(ages[0])
+	return age, err
+}
+
+// readAttribute returns the values of one attribute of the entry with the given DN.
+func readAttribute(conn ldaputil.Connection, dn string, field *Field) ([]string, error) {
+	result, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     dn,
+		Scope:      ldap.ScopeBaseObject,
+		Filter:     "(objectClass=*)",
+		Attributes: []string{field.String()},
+		SizeLimit:  1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Entries) == 0 {
+		return nil, fmt.Errorf("unable to find %q", dn)
+	}
+	return result.Entries[0].GetAttributeValues(field.String()), nil
+}
+
+// domainDN returns the DN of the domain an entry is in, which is the part of its
+// DN from its first domain component on.
+func domainDN(dn string) (string, error) {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return "", err
+	}
+	for i, rdn := range parsed.RDNs {
+		for _, attr := range rdn.Attributes {
+			if strings.EqualFold(attr.Type, FieldRegistry.DomainComponent.String()) {
+				return (&ldap.DN{RDNs: parsed.RDNs[i:]}).String(), nil
+			}
 		}
-		if err := conn.Bind(fmt.Sprintf("%s@%s", ldaputil.EscapeLDAPValue(cfg.BindDN), cfg.UPNDomain), cfg.LastBindPassword); err != nil {
-			// Return the original error because it'll be more helpful for debugging.
-			return origErr
+	}
+	return "", fmt.Errorf("%q has no domain components", dn)
+}
+
+// VerifyConnection dials and binds to AD on a connection of its own, and
+// searches for the userdn, to check that the config works.
+func (c *Client) VerifyConnection(cfg *ADConf) error {
+	conn, dcURL, err := c.dial(cfg)
+	if err != nil {
+		return fmt.Errorf("unable to connect: %w", err)
+	}
+	defer conn.Close()
+	if err := c.bind(cfg, conn, dcURL); err != nil {
+		return fmt.Errorf("unable to bind: %w", err)
+	}
+	if _, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:    cfg.UserDN,
+		Scope:     ldap.ScopeBaseObject,
+		Filter:    "(objectClass=*)",
+		SizeLimit: 1,
+	}); err != nil {
+		return fmt.Errorf("unable to search userdn %q: %w", cfg.UserDN, err)
+	}
+	return nil
+}
+
+// bind binds as the config's bind account, or as its fallback account if that
+// fails, so a reset of the bind account's password in AD doesn't leave Vault
+// unable to connect. dcURL is the domain controller the connection is to.
+func (c *Client) bind(cfg *ADConf, conn ldaputil.Connection, dcURL string) error {
+	origErr := c.bindPrimary(cfg, conn, dcURL)
+	if origErr == nil || cfg.FallbackBindDN == "" {
+		return origErr
+	}
+	if err := conn.Bind(cfg.FallbackBindDN, cfg.FallbackBindPassword); err != nil {
+		// Return the original error because it'll be more helpful for debugging.
+		return origErr
+	}
+	if c.ldap.Logger != nil {
+		c.ldap.Logger.Warn("unable to bind as binddn, bound as fallback_binddn instead", "binddn", cfg.BindDN, "fallback_binddn", cfg.FallbackBindDN, "error", origErr)
+	}
+	return nil
+}
+
+func (c *Client) bindPrimary(cfg *ADConf, conn ldaputil.Connection, dcURL string) error {
+	if cfg.BindsWithKerberos() {
+		return c.bindGSSAPI(cfg, conn, dcURL)
+	}
+	if cfg.BindsWithClientCertificate() {
+		return bindExternal(conn)
+	}
+	if cfg.BindPassword == "" {
+		return errors.New("unable to bind due to lack of configured password")
+	}
+
+	bindDN := cfg.BindDN
+	if cfg.BindModeOrDefault() == BindModeUPN {
+		if cfg.upnBindUsername() == "" {
+			return errors.New("must provide upn_username to bind with a UPN")
 		}
+		bindDN = fmt.Sprintf("%s@%s", ldaputil.EscapeLDAPValue(cfg.upnBindUsername()), cfg.UPNDomain)
+	} else if cfg.BindDN == "" {
+		return errors.New("must provide binddn or upndomain")
+	}
+
+	origErr := conn.Bind(bindDN, cfg.BindPassword)
+	if origErr == nil {
 		return nil
 	}
+	if !shouldTryLastPwd(cfg.LastBindPassword, cfg.LastBindPasswordRotation, cfg.LastBindPasswordTTLOrDefault()) {
+		return origErr
+	}
+	if err := conn.Bind(bindDN, cfg.LastBindPassword); err != nil {
+		// Return the original error because it'll be more helpful for debugging.
+		return origErr
+	}
+	return nil
+}
 
-	if cfg.BindDN != "" {
-		origErr := conn.Bind(cfg.BindDN, cfg.BindPassword)
-		if origErr == nil {
-			return nil
-		}
-		if !shouldTryLastPwd(cfg.LastBindPassword, cfg.LastBindPasswordRotation) {
-			return origErr
-		}
-		if err := conn.Bind(cfg.BindDN, cfg.LastBindPassword); err != nil {
-			// Return the original error because it'll be more helpful for debugging.
-			return origErr
-		}
+// externalBinder is implemented by connections that can bind with SASL EXTERNAL.
+type externalBinder interface {
+	ExternalBind() error
+}
+
+// bindExternal binds as the identity AD maps the client certificate presented
+// during the TLS handshake to. It's refused over a connection that isn't
+// encrypted, since then no certificate was presented.
+func bindExternal(conn ldaputil.Connection) error {
+	tlsConn, ok := conn.(tlsConnection)
+	if !ok {
+		return errors.New("unable to bind with a client certificate because the connection's TLS state is unknown")
+	}
+	if _, encrypted := tlsConn.TLSConnectionState(); !encrypted {
+		return errors.New("unable to bind with a client certificate over a connection that isn't encrypted, use ldaps:// or set starttls")
+	}
+	binder, ok := conn.(externalBinder)
+	if !ok {
+		return errors.New("unable to bind with a client certificate because the connection doesn't support SASL EXTERNAL")
 	}
-	return errors.New("must provide binddn or upndomain")
+	return binder.ExternalBind()
 }
 
 // shouldTryLastPwd determines if we should try a previous password.
@@ -164,12 +522,12 @@ func bind(cfg *ADConf, conn ldaputil.Connection) error {
 // Rather than attempting to catalogue these errors across multiple versions of
 // AD, we simply try the last password if it's been less than a set amount of
 // time since a rotation occurred.
-func shouldTryLastPwd(lastPwd string, lastBindPasswordRotation time.Time) bool {
+func shouldTryLastPwd(lastPwd string, lastBindPasswordRotation time.Time, ttl time.Duration) bool {
 	if lastPwd == "" {
 		return false
 	}
 	if lastBindPasswordRotation.Equal(time.Time{}) {
 		return false
 	}
-	return lastBindPasswordRotation.Add(10 * time.Minute).After(time.Now())
+	return lastBindPasswordRotation.Add(ttl).After(time.Now())
 }
@@ -4,7 +4,10 @@
 package client
 
 import (
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-ldap/ldap/v3"
 	"github.com/hashicorp/go-hclog"
@@ -89,10 +92,10 @@ func TestUpdateEntry(t *testing.T) {
 	conn.ModifyRequestToExpect.Replace("cn", []string{"Blue", "Red"})
 	ldapClient := &ldaputil.Client{
 		Logger: hclog.NewNullLogger(),
-		LDAP:   &ldapifc.FakeLDAPClient{conn},
+		LDAP:   &ldapifc.FakeLDAPClient{ConnToReturn: conn},
 	}
 
-	client := &Client{ldapClient}
+	client := &Client{ldap: ldapClient}
 
 	filters := map[*Field][]string{
 		FieldRegistry.Surname: {"Jones"},
@@ -129,10 +132,10 @@ func TestUpdatePassword(t *testing.T) {
 	conn.ModifyRequestToExpect.Replace("unicodePwd", []string{expectedPass})
 	ldapClient := &ldaputil.Client{
 		Logger: hclog.NewNullLogger(),
-		LDAP:   &ldapifc.FakeLDAPClient{conn},
+		LDAP:   &ldapifc.FakeLDAPClient{ConnToReturn: conn},
 	}
 
-	client := &Client{ldapClient}
+	client := &Client{ldap: ldapClient}
 
 	filters := map[*Field][]string{
 		FieldRegistry.Surname: {"Jones"},
@@ -171,10 +174,10 @@ func TestUpdateRootPassword(t *testing.T) {
 	conn.ModifyRequestToExpect.Replace("unicodePwd", []string{expectedPass})
 	ldapClient := &ldaputil.Client{
 		Logger: hclog.NewNullLogger(),
-		LDAP:   &ldapifc.FakeLDAPClient{conn},
+		LDAP:   &ldapifc.FakeLDAPClient{ConnToReturn: conn},
 	}
 
-	client := &Client{ldapClient}
+	client := &Client{ldap: ldapClient}
 
 	filters := map[*Field][]string{
 		FieldRegistry.Surname: {"Jones"},
@@ -239,3 +242,526 @@ func testSearchResult() *ldap.SearchResult {
 		},
 	}
 }
+
+func TestRequireStartTLS(t *testing.T) {
+	config := emptyConfig()
+	config.RequireStartTLS = true
+
+	conn := &ldapifc.FakeLDAPConnection{
+		SearchRequestToExpect: testSearchRequest(),
+		SearchResultToReturn:  testSearchResult(),
+	}
+	client := &Client{ldap: &ldaputil.Client{
+		Logger: hclog.NewNullLogger(),
+		LDAP: &ldapifc.FakeLDAPClient{
+			ConnToReturn: conn,
+		},
+	}}
+	filters := map[*Field][]string{
+		FieldRegistry.Surname: {"Jones"},
+	}
+
+	if _, err := client.Search(config, config.UserDN, filters); err == nil {
+		t.Fatal("expected an error because the connection isn't encrypted")
+	}
+
+	conn.Encrypted = true
+	if _, err := client.Search(config, config.UserDN, filters); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnforceSecureConnection(t *testing.T) {
+	config := emptyConfig()
+	config.Url = "ldaps://127.0.0.1"
+	config.EnforceSecureConnection = true
+
+	conn := &ldapifc.FakeLDAPConnection{
+		SearchRequestToExpect: testSearchRequest(),
+		SearchResultToReturn:  testSearchResult(),
+	}
+	client := &Client{ldap: &ldaputil.Client{
+		Logger: hclog.NewNullLogger(),
+		LDAP: &ldapifc.FakeLDAPClient{
+			ConnToReturn: conn,
+		},
+	}}
+	filters := map[*Field][]string{
+		FieldRegistry.Surname: {"Jones"},
+	}
+
+	// Whatever the URL says, a connection that isn't encrypted isn't used.
+	if _, err := client.Search(config, config.UserDN, filters); err == nil || !strings.Contains(err.Error(), "enforce_secure_connection") {
+		t.Fatalf("expected the unencrypted connection to be refused but received %v", err)
+	}
+
+	conn.Encrypted = true
+	if _, err := client.Search(config, config.UserDN, filters); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dcLDAPClient dials a different fake connection for each domain controller.
+type dcLDAPClient struct {
+	conns  map[string]ldaputil.Connection
+	delays map[string]time.Duration
+}
+
+func (d *dcLDAPClient) DialURL(addr string, opts ...ldap.DialOpt) (ldaputil.Connection, error) {
+	time.Sleep(d.delays[addr])
+	conn, ok := d.conns[addr]
+	if !ok {
+		return nil, errors.New("connection refused")
+	}
+	return conn, nil
+}
+
+func TestParallelSearch(t *testing.T) {
+	config := emptyConfig()
+	config.Url = "ldap://slow,ldap://fast,ldap://down"
+	config.ParallelSearch = true
+
+	conn := &ldapifc.FakeLDAPConnection{
+		SearchRequestToExpect: testSearchRequest(),
+		SearchResultToReturn:  testSearchResult(),
+	}
+	dcs := &dcLDAPClient{
+		conns: map[string]ldaputil.Connection{
+			"ldap://slow:389": conn,
+			"ldap://fast:389": conn,
+		},
+		delays: map[string]time.Duration{
+			"ldap://slow:389": time.Second,
+		},
+	}
+	client := &Client{ldap: &ldaputil.Client{
+		Logger: hclog.NewNullLogger(),
+		LDAP:   dcs,
+	}}
+	filters := map[*Field][]string{
+		FieldRegistry.Surname: {"Jones"},
+	}
+
+	start := time.Now()
+	entries, err := client.Search(config, config.UserDN, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry but received %d", len(entries))
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Fatalf("expected the fast domain controller to answer first, but the search took %s", elapsed)
+	}
+
+	config.Url = "ldap://down,ldap://gone"
+	if _, err := client.Search(config, config.UserDN, filters); err == nil {
+		t.Fatal("expected an error because no domain controller is up")
+	}
+}
+
+// countingLDAPClient counts the connections dialed.
+type countingLDAPClient struct {
+	ldapifc.FakeLDAPClient
+	dials int
+}
+
+func (c *countingLDAPClient) DialURL(addr string, opts ...ldap.DialOpt) (ldaputil.Connection, error) {
+	c.dials++
+	return c.FakeLDAPClient.DialURL(addr, opts...)
+}
+
+func TestPrewarm(t *testing.T) {
+	config := emptyConfig()
+
+	dialer := &countingLDAPClient{FakeLDAPClient: ldapifc.FakeLDAPClient{
+		ConnToReturn: &ldapifc.FakeLDAPConnection{
+			SearchRequestToExpect: testSearchRequest(),
+			SearchResultToReturn:  testSearchResult(),
+		},
+	}}
+	client := &Client{ldap: &ldaputil.Client{
+		Logger: hclog.NewNullLogger(),
+		LDAP:   dialer,
+	}}
+	filters := map[*Field][]string{
+		FieldRegistry.Surname: {"Jones"},
+	}
+
+	if err := client.Prewarm(config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Search(config, config.UserDN, filters); err != nil {
+		t.Fatal(err)
+	}
+	if dialer.dials != 1 {
+		t.Fatalf("expected the search to use the prewarmed connection but %d were dialed", dialer.dials)
+	}
+	// The prewarmed connection is only used once.
+	if _, err := client.Search(config, config.UserDN, filters); err != nil {
+		t.Fatal(err)
+	}
+	if dialer.dials != 2 {
+		t.Fatalf("expected a new connection to be dialed but %d were dialed", dialer.dials)
+	}
+
+	// A connection bound with other credentials isn't used.
+	if err := client.Prewarm(config); err != nil {
+		t.Fatal(err)
+	}
+	rotated := emptyConfig()
+	rotated.BindPassword = "dogs"
+	if _, err := client.Search(rotated, rotated.UserDN, filters); err != nil {
+		t.Fatal(err)
+	}
+	if dialer.dials != 4 {
+		t.Fatalf("expected a new connection to be dialed but %d were dialed", dialer.dials)
+	}
+
+	// Nor is one dialed with other TLS settings.
+	if err := client.Prewarm(config); err != nil {
+		t.Fatal(err)
+	}
+	insecure := emptyConfig()
+	insecure.InsecureTLS = true
+	if _, err := client.Search(insecure, insecure.UserDN, filters); err != nil {
+		t.Fatal(err)
+	}
+	if dialer.dials != 6 {
+		t.Fatalf("expected a new connection to be dialed but %d were dialed", dialer.dials)
+	}
+}
+
+func TestConnectionPool(t *testing.T) {
+	config := emptyConfig()
+	config.MaxOpenConnections = 1
+	config.MaxIdleConnections = 1
+
+	dialer := &countingLDAPClient{FakeLDAPClient: ldapifc.FakeLDAPClient{
+		ConnToReturn: &ldapifc.FakeLDAPConnection{
+			SearchRequestToExpect: testSearchRequest(),
+			SearchResultToReturn:  testSearchResult(),
+		},
+	}}
+	client := &Client{ldap: &ldaputil.Client{
+		Logger: hclog.NewNullLogger(),
+		LDAP:   dialer,
+	}}
+	filters := map[*Field][]string{
+		FieldRegistry.Surname: {"Jones"},
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.Search(config, config.UserDN, filters); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if dialer.dials != 1 {
+		t.Fatalf("expected the idle connection to be reused but %d were dialed", dialer.dials)
+	}
+
+	// Once max_open_connections are in use, a search waits for one to be released.
+	conn, err := client.connect(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := client.Search(config, config.UserDN, filters)
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected the search to wait for the connection in use")
+	case <-time.After(50 * time.Millisecond):
+	}
+	conn.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if dialer.dials != 1 {
+		t.Fatalf("expected the released connection to be reused but %d were dialed", dialer.dials)
+	}
+
+	// A connection older than connection_max_lifetime is replaced.
+	config.ConnectionMaxLifetime = time.Nanosecond
+	if _, err := client.Search(config, config.UserDN, filters); err != nil {
+		t.Fatal(err)
+	}
+	if dialer.dials != 2 {
+		t.Fatalf("expected an expired connection to be replaced but %d were dialed", dialer.dials)
+	}
+
+	// Closing the client closes the idle connections, and ones released later
+	// aren't kept.
+	config.ConnectionMaxLifetime = 0
+	client.Close()
+	if len(client.pools) != 0 {
+		t.Fatalf("expected the idle connections to be closed but %d pools remain", len(client.pools))
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := client.Search(config, config.UserDN, filters); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if dialer.dials != 4 {
+		t.Fatalf("expected no connection to be kept idle but %d were dialed", dialer.dials)
+	}
+}
+
+func TestVerifyConnection(t *testing.T) {
+	config := emptyConfig()
+
+	conn := &ldapifc.FakeLDAPConnection{
+		SearchRequestToExpect: &ldap.SearchRequest{
+			BaseDN: config.UserDN,
+			Scope:  ldap.ScopeBaseObject,
+			Filter: "(objectClass=*)",
+		},
+		SearchResultToReturn: testSearchResult(),
+	}
+	client := &Client{ldap: &ldaputil.Client{
+		Logger: hclog.NewNullLogger(),
+		LDAP: &ldapifc.FakeLDAPClient{
+			ConnToReturn: conn,
+		},
+	}}
+
+	if err := client.VerifyConnection(config); err != nil {
+		t.Fatal(err)
+	}
+
+	// The search fails if the userdn is wrong.
+	wrong := emptyConfig()
+	wrong.UserDN = "dc=example,dc=org"
+	if err := client.VerifyConnection(wrong); err == nil {
+		t.Fatal("expected the search to fail")
+	}
+
+	// Binding fails without a password.
+	unbindable := emptyConfig()
+	unbindable.BindPassword = ""
+	if err := client.VerifyConnection(unbindable); err == nil {
+		t.Fatal("expected the bind to fail")
+	}
+}
+
+// passwordConn only accepts binds with the accounts' passwords, and records who
+// bound last.
+type passwordConn struct {
+	ldapifc.FakeLDAPConnection
+	passwords map[string]string
+	boundAs   string
+}
+
+func (c *passwordConn) Bind(username, password string) error {
+	if c.passwords[username] != password {
+		return errors.New("invalid credentials")
+	}
+	c.boundAs = username
+	return nil
+}
+
+func TestBind(t *testing.T) {
+	conn := &passwordConn{passwords: map[string]string{
+		"cats":     "dogs",
+		"fallback": "birds",
+	}}
+	client := &Client{ldap: &ldaputil.Client{Logger: hclog.NewNullLogger()}}
+
+	// The last password is tried for a while after a rotation.
+	config := emptyConfig()
+	config.LastBindPassword = "dogs"
+	config.LastBindPasswordRotation = time.Now().Add(-5 * time.Minute)
+	if err := client.bind(config, conn, "ldap://127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	config.LastBindPasswordTTL = time.Minute
+	if err := client.bind(config, conn, "ldap://127.0.0.1"); err == nil {
+		t.Fatal("expected the last password not to be tried once its ttl has passed")
+	}
+
+	// The fallback account is bound as if the bind account can't bind.
+	config.FallbackBindDN = "fallback"
+	config.FallbackBindPassword = "birds"
+	if err := client.bind(config, conn, "ldap://127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if conn.boundAs != "fallback" {
+		t.Fatalf("expected to bind as the fallback account but bound as %q", conn.boundAs)
+	}
+	config.FallbackBindPassword = "fish"
+	if err := client.bind(config, conn, "ldap://127.0.0.1"); err == nil || err.Error() != "invalid credentials" {
+		t.Fatalf("expected the bind account's error but received %v", err)
+	}
+}
+
+func TestBindMode(t *testing.T) {
+	conn := &passwordConn{passwords: map[string]string{
+		"cats":                   "dogs",
+		"vault@corp.example.com": "dogs",
+	}}
+	client := &Client{ldap: &ldaputil.Client{Logger: hclog.NewNullLogger()}}
+
+	// Without a bind_mode, the binddn is the username of a UPN when there's a
+	// upndomain.
+	config := emptyConfig()
+	config.BindPassword = "dogs"
+	config.BindDN = "vault"
+	config.UPNDomain = "corp.example.com"
+	if err := client.bind(config, conn, "ldap://127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if conn.boundAs != "vault@corp.example.com" {
+		t.Fatalf("expected to bind with a UPN but bound as %q", conn.boundAs)
+	}
+
+	// With it, the upndomain only makes a UPN in upn mode.
+	config.BindMode = BindModeDN
+	config.BindDN = "cats"
+	if err := client.bind(config, conn, "ldap://127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if conn.boundAs != "cats" {
+		t.Fatalf("expected to bind with the binddn but bound as %q", conn.boundAs)
+	}
+
+	config.BindMode = BindModeUPN
+	config.BindDN = ""
+	config.UPNUsername = "vault"
+	if err := client.bind(config, conn, "ldap://127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if conn.boundAs != "vault@corp.example.com" || config.BindUPN() != "vault@corp.example.com" {
+		t.Fatalf("expected to bind as upn_username@upndomain but bound as %q", conn.boundAs)
+	}
+}
+
+func TestValidateBindMode(t *testing.T) {
+	config := emptyConfig()
+	config.UPNDomain = "corp.example.com"
+	for _, tc := range []struct {
+		bindMode, bindDN, upnUsername string
+		valid                         bool
+	}{
+		{"", "cats", "", true},
+		{"", "cats", "vault", false},
+		{BindModeDN, "cats", "", true},
+		{BindModeDN, "", "", false},
+		{BindModeDN, "cats", "vault", false},
+		{BindModeUPN, "", "vault", true},
+		{BindModeUPN, "", "", false},
+		{BindModeUPN, "", "vault@corp.example.com", false},
+		{BindModeUPN, "cats", "vault", false},
+		{"sam", "cats", "", false},
+	} {
+		config.BindMode, config.BindDN, config.UPNUsername = tc.bindMode, tc.bindDN, tc.upnUsername
+		if err := config.ValidateBindMode(); (err == nil) != tc.valid {
+			t.Fatalf("bind_mode %q with binddn %q and upn_username %q: expected valid to be %t but received %v", tc.bindMode, tc.bindDN, tc.upnUsername, tc.valid, err)
+		}
+	}
+
+	config.BindMode, config.BindDN, config.UPNUsername = BindModeUPN, "", "vault"
+	config.UPNDomain = ""
+	if err := config.ValidateBindMode(); err == nil {
+		t.Fatal("expected upn mode without a upndomain to be refused")
+	}
+}
+
+func TestBindWithClientCertificate(t *testing.T) {
+	conn := &ldapifc.FakeLDAPConnection{}
+	client := &Client{ldap: &ldaputil.Client{Logger: hclog.NewNullLogger()}}
+	config := emptyConfig()
+	config.ClientTLSCert = "cert"
+	config.BindPassword = ""
+
+	if err := client.bind(config, conn, "ldap://127.0.0.1"); err == nil || conn.ExternallyBound {
+		t.Fatal("expected binding with a certificate to be refused over a connection that isn't encrypted")
+	}
+	conn.Encrypted = true
+	if err := client.bind(config, conn, "ldap://127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if !conn.ExternallyBound {
+		t.Fatal("expected to bind with SASL EXTERNAL")
+	}
+
+	// With a bindpass, it's still used.
+	conn = &ldapifc.FakeLDAPConnection{Encrypted: true}
+	config.BindPassword = "cats"
+	if err := client.bind(config, conn, "ldap://127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if conn.ExternallyBound {
+		t.Fatal("expected to bind with the bindpass")
+	}
+}
+
+func TestToString(t *testing.T) {
+	if filter := toString(map[*Field][]string{FieldRegistry.Surname: {"Jones"}}); filter != "(sn=Jones)" {
+		t.Fatalf("expected a single filter but received %q", filter)
+	}
+	filter := toString(map[*Field][]string{
+		FieldRegistry.SAMAccountName: {"WEB01$"},
+		FieldRegistry.ObjectClass:    {"computer"},
+	})
+	if filter != "(&(objectClass=computer)(sAMAccountName=WEB01$))" {
+		t.Fatalf("expected both filters to be required but received %q", filter)
+	}
+}
+
+// policyConn returns one attribute of the entry whose DN is searched for.
+type policyConn struct {
+	ldapifc.FakeLDAPConnection
+	entries map[string]map[string][]string
+}
+
+func (c *policyConn) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	attrs, ok := c.entries[req.BaseDN]
+	if !ok {
+		return nil, ldap.NewError(ldap.LDAPResultNoSuchObject, errors.New("no such object"))
+	}
+	entry := &ldap.Entry{DN: req.BaseDN}
+	for _, name := range req.Attributes {
+		if values, ok := attrs[name]; ok {
+			entry.Attributes = append(entry.Attributes, &ldap.EntryAttribute{Name: name, Values: values})
+		}
+	}
+	return &ldap.SearchResult{Entries: []*ldap.Entry{entry}}, nil
+}
+
+func TestMinPasswordAge(t *testing.T) {
+	const (
+		userDN  = "CN=app,OU=Service Accounts,DC=example,DC=com"
+		adminDN = "CN=admin,OU=Admins,DC=example,DC=com"
+		psoDN   = "CN=Admins PSO,CN=Password Settings Container,CN=System,DC=example,DC=com"
+	)
+	conn := &policyConn{entries: map[string]map[string][]string{
+		userDN:              {},
+		adminDN:             {"msDS-ResultantPSO": {psoDN}},
+		"dc=example,dc=com": {"minPwdAge": {"-864000000000"}},
+		psoDN:               {"msDS-MinimumPasswordAge": {"-36000000000"}},
+	}}
+	client := &Client{ldap: &ldaputil.Client{
+		Logger: hclog.NewNullLogger(),
+		LDAP: &ldapifc.FakeLDAPClient{
+			ConnToReturn: conn,
+		},
+	}}
+
+	// The domain's policy applies unless a fine-grained one does.
+	age, err := client.MinPasswordAge(emptyConfig(), userDN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if age != 24*time.Hour {
+		t.Fatalf("expected the domain's minPwdAge but received %s", age)
+	}
+	age, err = client.MinPasswordAge(emptyConfig(), adminDN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if age != time.Hour {
+		t.Fatalf("expected the PSO's minimum age but received %s", age)
+	}
+}
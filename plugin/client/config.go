@@ -4,13 +4,151 @@
 package client
 
 import (
+	"strings"
 	"time"
 
 	"github.com/hashicorp/vault/sdk/helper/ldaputil"
 )
 
+// DefaultLastBindPasswordTTL is how long the last bind password is tried after a
+// root rotation, unless the config says otherwise.
+const DefaultLastBindPasswordTTL = 10 * time.Minute
+
 type ADConf struct {
 	*ldaputil.ConfigEntry
 	LastBindPassword         string    `json:"last_bind_password"`
 	LastBindPasswordRotation time.Time `json:"last_bind_password_rotation"`
+
+	// LastBindPasswordTTL is how long after a root rotation the last password
+	// is still tried if the current one is refused. If it's zero,
+	// DefaultLastBindPasswordTTL is used.
+	LastBindPasswordTTL time.Duration `json:"last_bind_password_ttl,omitempty"`
+
+	// BindMode is how a password bind identifies the bind account, either with
+	// the binddn or as UPNUsername@upndomain. If it's empty, the binddn is used
+	// as the username of a UPN when the upndomain is set, like before it existed.
+	BindMode    string `json:"bind_mode,omitempty"`
+	UPNUsername string `json:"upn_username,omitempty"`
+
+	// FallbackBindDN and FallbackBindPassword, when set, are the identity bound
+	// as when the bind account can't bind, for example because its password was
+	// reset in AD.
+	FallbackBindDN       string `json:"fallback_binddn,omitempty"`
+	FallbackBindPassword string `json:"fallback_bindpass,omitempty"`
+
+	// DevMode directs requests to an in-memory directory instead of AD.
+	DevMode bool `json:"dev_mode"`
+
+	// RotationBindDN and RotationBindPassword, when set, are the identity used to
+	// reset the bind account's password instead of having it change its own.
+	RotationBindDN       string `json:"rotation_binddn"`
+	RotationBindPassword string `json:"rotation_bindpass"`
+
+	// RequireStartTLS upgrades ldap:// connections with StartTLS even if StartTLS
+	// isn't set, and refuses to bind over any connection that isn't encrypted.
+	RequireStartTLS bool `json:"require_starttls"`
+
+	// EnforceSecureConnection refuses to use any connection that isn't
+	// encrypted, whether it was made to an ldap:// URL without StartTLS or its
+	// TLS negotiation didn't succeed, so nothing is sent to AD in cleartext.
+	EnforceSecureConnection bool `json:"enforce_secure_connection,omitempty"`
+
+	// ParallelSearch sends searches to every URL at once and uses the first
+	// answer, instead of trying them in order.
+	ParallelSearch bool `json:"parallel_search"`
+
+	// PrewarmConnections connects and binds to AD when the engine starts, so the
+	// first request after a restart or unseal doesn't wait to.
+	PrewarmConnections bool `json:"prewarm_connections"`
+
+	// MaxOpenConnections caps the connections open to AD at once with the same
+	// domain controllers and credentials, and requests wait for one to be free
+	// beyond it. If it's zero, there's no cap. MaxIdleConnections is how many are
+	// kept bound for the next request once they're done with, instead of being
+	// closed, and ConnectionMaxLifetime, if set, is how long after dialing a
+	// connection is closed rather than reused.
+	MaxOpenConnections    int           `json:"max_open_connections,omitempty"`
+	MaxIdleConnections    int           `json:"max_idle_connections,omitempty"`
+	ConnectionMaxLifetime time.Duration `json:"connection_max_lifetime,omitempty"`
+
+	// ComputerDN is the base DN to search for computer accounts, which AD keeps
+	// apart from users by default. If it's empty, UserDN is searched.
+	ComputerDN string `json:"computerdn,omitempty"`
+
+	// DomainRoutes maps lowercase UPN suffixes, like "child1.corp.example.com", to
+	// where accounts with them live, for forests with several domains.
+	DomainRoutes map[string]DomainRoute `json:"domain_routes,omitempty"`
+
+	// DiscoverDC finds the domain controllers to connect to from the
+	// _ldap._tcp SRV records of DiscoverDCDomain, or of the userdn's domain if
+	// it's empty, instead of using the url.
+	DiscoverDC       bool   `json:"discover_dc"`
+	DiscoverDCDomain string `json:"discover_dc_domain,omitempty"`
+
+	// BindKeytab, when set, is a base64-encoded keytab for BindPrincipal, and
+	// Vault binds to AD with GSSAPI instead of a password. BindKrb5Conf is the
+	// krb5.conf that says where the KDCs of the principal's realm are.
+	BindKeytab    string `json:"bind_keytab,omitempty"`
+	BindKrb5Conf  string `json:"bind_krb5_conf,omitempty"`
+	BindPrincipal string `json:"bind_principal,omitempty"`
+
+	// CRL is PEM-encoded certificate revocation lists for the CAs in the
+	// certificate field, and CheckOCSP asks the OCSP responders of the domain
+	// controllers' certificates too. A domain controller whose certificate or
+	// intermediate CA is revoked isn't bound to.
+	CRL       string `json:"crl,omitempty"`
+	CheckOCSP bool   `json:"check_ocsp,omitempty"`
+
+	// ChannelBinding binds GSSAPI binds to the TLS connection they're made
+	// over, for domain controllers that require LDAP channel binding.
+	ChannelBinding bool `json:"channel_binding,omitempty"`
+}
+
+// BindsWithClientCertificate reports whether Vault authenticates to AD with
+// the config's client_tls_cert instead of a password, which it does when a
+// certificate is set and a bindpass isn't.
+func (c *ADConf) BindsWithClientCertificate() bool {
+	return c.ConfigEntry != nil && c.ClientTLSCert != "" && c.BindPassword == ""
+}
+
+// LastBindPasswordTTLOrDefault returns how long after a root rotation the last
+// bind password is tried.
+func (c *ADConf) LastBindPasswordTTLOrDefault() time.Duration {
+	if c.LastBindPasswordTTL <= 0 {
+		return DefaultLastBindPasswordTTL
+	}
+	return c.LastBindPasswordTTL
+}
+
+// DomainRoute is where to find the accounts of one domain in the forest.
+type DomainRoute struct {
+	// UserDN is the base DN to search for the domain's accounts.
+	UserDN string `json:"userdn"`
+
+	// URL is the domain's domain controllers, if they aren't the ones in the
+	// config's url.
+	URL string `json:"url,omitempty"`
+}
+
+// ForAccount returns the config to use for the account with the given
+// userPrincipalName. If a route matches its UPN suffix, it's a copy pointing at
+// the route's userdn and url, otherwise it's the config itself.
+func (c *ADConf) ForAccount(userPrincipalName string) *ADConf {
+	at := strings.LastIndex(userPrincipalName, "@")
+	if at < 0 || len(c.DomainRoutes) == 0 {
+		return c
+	}
+	route, ok := c.DomainRoutes[strings.ToLower(userPrincipalName[at+1:])]
+	if !ok {
+		return c
+	}
+	entry := *c.ConfigEntry
+	entry.UserDN = route.UserDN
+	routed := *c
+	if route.URL != "" {
+		entry.Url = route.URL
+		routed.DiscoverDC = false
+	}
+	routed.ConfigEntry = &entry
+	return &routed
 }
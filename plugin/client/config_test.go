@@ -0,0 +1,36 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import "testing"
+
+func TestForAccount(t *testing.T) {
+	config := emptyConfig()
+	config.DomainRoutes = map[string]DomainRoute{
+		"child1.corp": {UserDN: "dc=child1,dc=corp", URL: "ldap://dc.child1.corp"},
+		"child2.corp": {UserDN: "dc=child2,dc=corp"},
+	}
+
+	routed := config.ForAccount("svc@Child1.Corp")
+	if routed.UserDN != "dc=child1,dc=corp" || routed.Url != "ldap://dc.child1.corp" {
+		t.Fatalf("expected the child1 route but received %s at %s", routed.UserDN, routed.Url)
+	}
+	if routed.BindDN != config.BindDN {
+		t.Fatal("expected the routed config to keep the bind account")
+	}
+	if config.UserDN != "dc=example,dc=com" || config.Url != "ldap://127.0.0.1" {
+		t.Fatal("expected routing not to change the config")
+	}
+
+	routed = config.ForAccount("svc@child2.corp")
+	if routed.UserDN != "dc=child2,dc=corp" || routed.Url != config.Url {
+		t.Fatalf("expected the child2 route with the config's url but received %s at %s", routed.UserDN, routed.Url)
+	}
+
+	for _, name := range []string{"svc@example.com", "svc", "svc@corp"} {
+		if routed := config.ForAccount(name); routed != config {
+			t.Fatalf("expected %q not to be routed", name)
+		}
+	}
+}
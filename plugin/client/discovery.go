@@ -0,0 +1,153 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// dcDiscoveryInterval is how long domain controllers found in DNS are used
+// before their SRV records are resolved again, so DCs that are added or
+// removed are picked up without rewriting the config.
+const dcDiscoveryInterval = 5 * time.Minute
+
+// discoveredDCs is the URLs of the domain controllers last found in DNS for a
+// domain.
+type discoveredDCs struct {
+	urls     string
+	resolved time.Time
+}
+
+// DiscoveryDomain returns the domain whose _ldap._tcp SRV records list its
+// domain controllers. It's DiscoverDCDomain if that's set, and otherwise the
+// domain of the userdn, like "corp.example.com" for DC=corp,DC=example,DC=com.
+func (c *ADConf) DiscoveryDomain() (string, error) {
+	if c.DiscoverDCDomain != "" {
+		return strings.TrimSuffix(c.DiscoverDCDomain, "."), nil
+	}
+	var userDN string
+	if c.ConfigEntry != nil {
+		userDN = c.UserDN
+	}
+	parsed, err := ldap.ParseDN(userDN)
+	if err != nil {
+		return "", err
+	}
+	var labels []string
+	for _, rdn := range parsed.RDNs {
+		for _, attr := range rdn.Attributes {
+			if strings.EqualFold(attr.Type, FieldRegistry.DomainComponent.String()) {
+				labels = append(labels, attr.Value)
+			}
+		}
+	}
+	if len(labels) == 0 {
+		return "", fmt.Errorf("userdn %q has no domain components to discover domain controllers from", userDN)
+	}
+	return strings.ToLower(strings.Join(labels, ".")), nil
+}
+
+// withDiscoveredDCs returns the config pointing at the domain controllers found
+// in DNS if it asks for them to be discovered, and otherwise the config itself.
+func (c *Client) withDiscoveredDCs(cfg *ADConf) (*ADConf, error) {
+	if !cfg.DiscoverDC {
+		return cfg, nil
+	}
+	urls, err := c.discoverDCs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	entry := *cfg.ConfigEntry
+	entry.Url = urls
+	discovered := *cfg
+	discovered.ConfigEntry = &entry
+	// The URLs are already resolved, so they aren't again when the copy is dialed.
+	discovered.DiscoverDC = false
+	return &discovered, nil
+}
+
+// discoverDCs returns the comma-separated URLs of the config's domain
+// controllers, in the order their SRV records' priorities and weights give. The
+// last URLs found for the domain are reused until dcDiscoveryInterval passes,
+// and after that if resolving them again fails, so a DNS outage doesn't also
+// cut Vault off from AD.
+func (c *Client) discoverDCs(cfg *ADConf) (string, error) {
+	domain, err := cfg.DiscoveryDomain()
+	if err != nil {
+		return "", err
+	}
+	// ldaps:// and ldap:// URLs for the same domain are cached apart.
+	key := dcURLScheme(cfg) + "://" + domain
+
+	c.mu.Lock()
+	cached, ok := c.discovered[key]
+	c.mu.Unlock()
+	if ok && time.Since(cached.resolved) < dcDiscoveryInterval {
+		return cached.urls, nil
+	}
+
+	urls, err := c.resolveDCs(cfg, domain)
+	if err != nil {
+		if ok {
+			if c.ldap.Logger != nil {
+				c.ldap.Logger.Warn("unable to resolve domain controllers, using the ones last found", "domain", domain, "error", err)
+			}
+			return cached.urls, nil
+		}
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.discovered == nil {
+		c.discovered = make(map[string]discoveredDCs)
+	}
+	c.discovered[key] = discoveredDCs{urls: urls, resolved: time.Now()}
+	return urls, nil
+}
+
+// resolveDCs looks up the domain's _ldap._tcp SRV records. Connections that
+// will use StartTLS go to the port each record gives, and the rest go to the
+// domain controller's LDAPS port.
+func (c *Client) resolveDCs(cfg *ADConf, domain string) (string, error) {
+	lookupSRV := c.lookupSRV
+	if lookupSRV == nil {
+		lookupSRV = net.LookupSRV
+	}
+	_, records, err := lookupSRV("ldap", "tcp", domain)
+	if err != nil {
+		return "", fmt.Errorf("unable to discover the domain controllers of %q: %w", domain, err)
+	}
+	scheme := dcURLScheme(cfg)
+	var urls []string
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		// A target of "." means the service isn't offered.
+		if host == "" {
+			continue
+		}
+		if scheme == "ldap" {
+			host = net.JoinHostPort(host, strconv.Itoa(int(record.Port)))
+		}
+		urls = append(urls, scheme+"://"+host)
+	}
+	if len(urls) == 0 {
+		return "", fmt.Errorf("no domain controllers of %q were found in DNS", domain)
+	}
+	return strings.Join(urls, ","), nil
+}
+
+// dcURLScheme returns the scheme to reach discovered domain controllers with.
+func dcURLScheme(cfg *ADConf) string {
+	if cfg.StartTLS || cfg.RequireStartTLS {
+		return "ldap"
+	}
+	return "ldaps"
+}
@@ -0,0 +1,98 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+)
+
+func TestDiscoverDCs(t *testing.T) {
+	var lookups []string
+	records := []*net.SRV{
+		{Target: "dc1.corp.example.com.", Port: 389},
+		{Target: "dc2.corp.example.com.", Port: 3268},
+	}
+	var lookupErr error
+	c := &Client{
+		ldap: &ldaputil.Client{Logger: hclog.NewNullLogger()},
+		lookupSRV: func(service, proto, name string) (string, []*net.SRV, error) {
+			lookups = append(lookups, "_"+service+"._"+proto+"."+name)
+			return "", records, lookupErr
+		},
+	}
+	cfg := &ADConf{
+		ConfigEntry: &ldaputil.ConfigEntry{
+			Url:    "ldap://127.0.0.1",
+			UserDN: "OU=Service Accounts,DC=corp,DC=example,DC=com",
+		},
+		DiscoverDC: true,
+	}
+
+	discovered, err := c.withDiscoveredDCs(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if discovered.Url != "ldaps://dc1.corp.example.com,ldaps://dc2.corp.example.com" || discovered.DiscoverDC {
+		t.Fatalf("unexpected discovered config %q", discovered.Url)
+	}
+	if cfg.Url != "ldap://127.0.0.1" {
+		t.Fatalf("expected the config not to be changed but its url is %q", cfg.Url)
+	}
+	if len(lookups) != 1 || lookups[0] != "_ldap._tcp.corp.example.com" {
+		t.Fatalf("unexpected lookups %v", lookups)
+	}
+
+	// The domain controllers are reused until it's time to look again.
+	records = records[:1]
+	if discovered, err = c.withDiscoveredDCs(cfg); err != nil || len(lookups) != 1 {
+		t.Fatalf("expected the discovered domain controllers to be reused but received %v, %v", lookups, err)
+	}
+	c.discovered["ldaps://corp.example.com"] = discoveredDCs{urls: discovered.Url, resolved: time.Now().Add(-dcDiscoveryInterval)}
+	if discovered, err = c.withDiscoveredDCs(cfg); err != nil || discovered.Url != "ldaps://dc1.corp.example.com" {
+		t.Fatalf("expected a removed domain controller to be dropped but received %v, %v", discovered, err)
+	}
+
+	// If DNS fails, the last ones found are still used.
+	lookupErr = errors.New("no such host")
+	c.discovered["ldaps://corp.example.com"] = discoveredDCs{urls: discovered.Url, resolved: time.Now().Add(-dcDiscoveryInterval)}
+	if discovered, err = c.withDiscoveredDCs(cfg); err != nil || discovered.Url != "ldaps://dc1.corp.example.com" {
+		t.Fatalf("expected the last domain controllers found but received %v, %v", discovered, err)
+	}
+
+	// StartTLS connections use the records' ports, and the domain can be set.
+	lookupErr = nil
+	startTLS := *cfg.ConfigEntry
+	startTLS.StartTLS = true
+	cfg = &ADConf{ConfigEntry: &startTLS, DiscoverDC: true, DiscoverDCDomain: "example.com."}
+	if discovered, err = c.withDiscoveredDCs(cfg); err != nil || discovered.Url != "ldap://dc1.corp.example.com:389" {
+		t.Fatalf("unexpected discovered config %v, %v", discovered, err)
+	}
+	if lookups[len(lookups)-1] != "_ldap._tcp.example.com" {
+		t.Fatalf("unexpected lookups %v", lookups)
+	}
+
+	// With nothing found, there's nowhere to connect.
+	records = []*net.SRV{{Target: ".", Port: 0}}
+	cfg.DiscoverDCDomain = "empty.example.com"
+	if _, err := c.withDiscoveredDCs(cfg); err == nil {
+		t.Fatal("expected an error when no domain controllers are found")
+	}
+}
+
+func TestDiscoveryDomain(t *testing.T) {
+	cfg := &ADConf{ConfigEntry: &ldaputil.ConfigEntry{UserDN: "OU=Users,DC=Child,DC=Corp,DC=example,DC=com"}}
+	if domain, err := cfg.DiscoveryDomain(); err != nil || domain != "child.corp.example.com" {
+		t.Fatalf("unexpected domain %q, %v", domain, err)
+	}
+	cfg.UserDN = "OU=Users"
+	if _, err := cfg.DiscoveryDomain(); err == nil {
+		t.Fatal("expected an error for a userdn without domain components")
+	}
+}
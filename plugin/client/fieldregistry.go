@@ -50,6 +50,8 @@ func newFieldRegistry() *fieldRegistry {
 // that may be useful to Vault. Feel free to add to this list!
 type fieldRegistry struct {
 	AccountExpires              *Field `ldap:"accountExpires"`
+	AdmPwd                      *Field `ldap:"ms-Mcs-AdmPwd"`
+	AdmPwdExpirationTime        *Field `ldap:"ms-Mcs-AdmPwdExpirationTime"`
 	AdminCount                  *Field `ldap:"adminCount"`
 	BadPasswordCount            *Field `ldap:"badPwdCount"`
 	BadPasswordTime             *Field `ldap:"badPasswordTime"`
@@ -70,7 +72,14 @@ type fieldRegistry struct {
 	LastLogonTimestamp          *Field `ldap:"lastLogonTimestamp"`
 	LockoutTime                 *Field `ldap:"lockoutTime"`
 	LogonCount                  *Field `ldap:"logonCount"`
+	MSLAPSEncryptedPassword     *Field `ldap:"msLAPS-EncryptedPassword"`
+	MSLAPSPassword              *Field `ldap:"msLAPS-Password"`
+	MSLAPSPasswordExpiration    *Field `ldap:"msLAPS-PasswordExpirationTime"`
+	Member                      *Field `ldap:"member"`
 	MemberOf                    *Field `ldap:"memberOf"`
+	MinPasswordAge              *Field `ldap:"minPwdAge"`
+	MSDSMinimumPasswordAge      *Field `ldap:"msDS-MinimumPasswordAge"`
+	MSDSResultantPSO            *Field `ldap:"msDS-ResultantPSO"`
 	Name                        *Field `ldap:"name"`
 	ObjectCategory              *Field `ldap:"objectCategory"`
 	ObjectClass                 *Field `ldap:"objectClass"`
@@ -106,6 +115,15 @@ func (r *fieldRegistry) Parse(s string) *Field {
 	return nil
 }
 
+// NewField returns the field with the given LDAP name. Fields that aren't in the
+// registry, like a custom attribute, can be used too.
+func NewField(s string) *Field {
+	if f := FieldRegistry.Parse(s); f != nil {
+		return f
+	}
+	return &Field{str: s}
+}
+
 type Field struct {
 	str string
 }
@@ -9,7 +9,7 @@ import (
 
 func TestFieldRegistryListsFields(t *testing.T) {
 	fields := FieldRegistry.List()
-	if len(fields) != 40 {
+	if len(fields) != 49 {
 		t.FailNow()
 	}
 }
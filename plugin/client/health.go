@@ -0,0 +1,167 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+)
+
+// dcHealth is what's known of whether a domain controller can be reached.
+type dcHealth struct {
+	// downSince is when the domain controller was first found unreachable
+	// since it was last reached, or zero if it's up.
+	downSince time.Time
+	lastErr   error
+	checked   time.Time
+}
+
+// DCStatus reports whether a domain controller in a config's url could be
+// reached the last time it was dialed or probed.
+type DCStatus struct {
+	URL       string
+	Healthy   bool
+	DownSince time.Time
+	LastError string
+	CheckedAt time.Time
+}
+
+// configURLs returns the URLs in a comma-separated url, in order.
+func configURLs(rawURLs string) []string {
+	var urls []string
+	for _, u := range strings.Split(rawURLs, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// dialFirstHealthy dials the entry's URLs in their order of priority, except
+// that ones found down are tried after the rest, so an unreachable domain
+// controller first in the list doesn't hold up every connection until it
+// times out. It's still tried last, so it's used again once it's back if the
+// others are down too. It returns the URL of the one it connected to.
+func (c *Client) dialFirstHealthy(entry *ldaputil.ConfigEntry) (ldaputil.Connection, string, error) {
+	urls := configURLs(entry.Url)
+	if len(urls) < 2 {
+		conn, err := c.dialLDAP(entry)
+		if len(urls) == 1 {
+			c.recordDial(urls[0], err)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		return conn, strings.TrimSpace(entry.Url), nil
+	}
+
+	c.mu.Lock()
+	var up, down []string
+	for _, u := range urls {
+		if health, ok := c.health[u]; ok && !health.downSince.IsZero() {
+			down = append(down, u)
+		} else {
+			up = append(up, u)
+		}
+	}
+	c.mu.Unlock()
+
+	var errs []error
+	for _, u := range append(up, down...) {
+		dcEntry := *entry
+		dcEntry.Url = u
+		conn, err := c.dialLDAP(&dcEntry)
+		c.recordDial(u, err)
+		if err == nil {
+			return conn, u, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, "", errors.Join(errs...)
+}
+
+// recordDial records whether dialing a domain controller succeeded.
+func (c *Client) recordDial(url string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.health == nil {
+		c.health = make(map[string]*dcHealth)
+	}
+	health, ok := c.health[url]
+	if !ok {
+		health = &dcHealth{}
+		c.health[url] = health
+	}
+	now := time.Now()
+	health.checked = now
+	health.lastErr = err
+	switch {
+	case err == nil:
+		if !health.downSince.IsZero() && c.ldap.Logger != nil {
+			c.ldap.Logger.Info("domain controller is reachable again", "url", url, "down_for", now.Sub(health.downSince))
+		}
+		health.downSince = time.Time{}
+	case health.downSince.IsZero():
+		health.downSince = now
+		if c.ldap.Logger != nil {
+			c.ldap.Logger.Warn("domain controller is unreachable, trying it after the others until it's back", "url", url, "error", err)
+		}
+	}
+}
+
+// ProbeDCs dials each of the config's domain controllers that's down, without
+// binding, so they're put back in their place in the order as soon as they're
+// back rather than only once the others fail. It returns their health
+// afterwards.
+func (c *Client) ProbeDCs(cfg *ADConf) ([]DCStatus, error) {
+	cfg, err := c.withDiscoveredDCs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range c.dcStatuses(cfg) {
+		if status.Healthy {
+			continue
+		}
+		entry := *cfg.ConfigEntry
+		entry.Url = status.URL
+		conn, err := c.dialLDAP(&entry)
+		if err == nil {
+			conn.Close()
+		}
+		c.recordDial(status.URL, err)
+	}
+	return c.dcStatuses(cfg), nil
+}
+
+// DCHealth returns the health of the config's domain controllers, as of when
+// each was last dialed. Ones that haven't been dialed yet are reported healthy.
+func (c *Client) DCHealth(cfg *ADConf) ([]DCStatus, error) {
+	cfg, err := c.withDiscoveredDCs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return c.dcStatuses(cfg), nil
+}
+
+func (c *Client) dcStatuses(cfg *ADConf) []DCStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var statuses []DCStatus
+	for _, u := range configURLs(cfg.Url) {
+		status := DCStatus{URL: u, Healthy: true}
+		if health, ok := c.health[u]; ok {
+			status.Healthy = health.downSince.IsZero()
+			status.DownSince = health.downSince
+			status.CheckedAt = health.checked
+			if health.lastErr != nil {
+				status.LastError = health.lastErr.Error()
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
@@ -0,0 +1,95 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/ldapifc"
+)
+
+// flakyLDAP refuses connections to the hosts that are down.
+type flakyLDAP struct {
+	down   map[string]bool
+	dialed []string
+}
+
+func (f *flakyLDAP) DialURL(addr string, _ ...ldap.DialOpt) (ldaputil.Connection, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	f.dialed = append(f.dialed, u.Hostname())
+	if f.down[u.Hostname()] {
+		return nil, errors.New("connection refused")
+	}
+	return &ldapifc.FakeLDAPConnection{}, nil
+}
+
+func TestDCFailover(t *testing.T) {
+	fake := &flakyLDAP{down: map[string]bool{"dc1": true}}
+	c := &Client{ldap: &ldaputil.Client{Logger: hclog.NewNullLogger(), LDAP: fake}}
+	cfg := emptyConfig()
+	cfg.Url = "ldap://dc1,ldap://dc2,ldap://dc3"
+
+	// The first domain controller is down, so the next one is used.
+	if _, _, err := c.dial(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fake.dialed, []string{"dc1", "dc2"}) {
+		t.Fatalf("unexpected dials %v", fake.dialed)
+	}
+
+	// Now that it's known to be down, it's tried last instead of first.
+	fake.dialed = nil
+	fake.down["dc2"] = true
+	if _, _, err := c.dial(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fake.dialed, []string{"dc2", "dc3"}) {
+		t.Fatalf("unexpected dials %v", fake.dialed)
+	}
+	statuses, err := c.DCHealth(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 3 || statuses[0].Healthy || statuses[1].Healthy || !statuses[2].Healthy || !strings.Contains(statuses[0].LastError, "connection refused") {
+		t.Fatalf("unexpected health %+v", statuses)
+	}
+
+	// Probing finds the ones that are back, and they're first again.
+	fake.down["dc1"] = false
+	fake.dialed = nil
+	if statuses, err = c.ProbeDCs(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fake.dialed, []string{"dc1", "dc2"}) || !statuses[0].Healthy || statuses[1].Healthy {
+		t.Fatalf("unexpected probe of %v with health %+v", fake.dialed, statuses)
+	}
+	fake.dialed = nil
+	if _, _, err := c.dial(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fake.dialed, []string{"dc1"}) {
+		t.Fatalf("unexpected dials %v", fake.dialed)
+	}
+
+	// When every one is down, each is tried.
+	fake.down = map[string]bool{"dc1": true, "dc2": true, "dc3": true}
+	fake.dialed = nil
+	if _, _, err := c.dial(cfg); err == nil {
+		t.Fatal("expected an error when every domain controller is down")
+	}
+	if len(fake.dialed) != 3 {
+		t.Fatalf("unexpected dials %v", fake.dialed)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/go-ldap/ldap/v3/gssapi"
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+	krbclient "github.com/jcmturner/gokrb5/v8/client"
+	krbconfig "github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+)
+
+// gssapiBinder is implemented by connections that can bind with SASL GSSAPI.
+type gssapiBinder interface {
+	GSSAPIBind(client ldap.GSSAPIClient, servicePrincipal, authzid string) error
+}
+
+// kerberosClient is a Kerberos client for a bind principal, and which
+// principal it's for so it can be replaced when the principal's keytab is.
+type kerberosClient struct {
+	principal string
+	client    *krbclient.Client
+}
+
+// BindsWithKerberos reports whether Vault authenticates to AD with GSSAPI,
+// which it does when a keytab is set, instead of with a simple bind.
+func (c *ADConf) BindsWithKerberos() bool {
+	return c.BindKeytab != ""
+}
+
+// ValidateKerberosBind returns an error if the keytab, krb5.conf, and principal
+// can't be used to bind with GSSAPI.
+func (c *ADConf) ValidateKerberosBind() error {
+	_, err := newKerberosClient(c)
+	return err
+}
+
+// newKerberosClient returns a Kerberos client that gets tickets for the
+// config's bind principal with its keytab. It doesn't contact the KDC until the
+// first ticket is needed.
+func newKerberosClient(cfg *ADConf) (*krbclient.Client, error) {
+	if cfg.BindPrincipal == "" {
+		return nil, errors.New("bind_principal is required to bind with a keytab")
+	}
+	if cfg.BindKrb5Conf == "" {
+		return nil, errors.New("bind_krb5_conf is required to bind with a keytab")
+	}
+	rawKeytab, err := base64.StdEncoding.DecodeString(cfg.BindKeytab)
+	if err != nil {
+		return nil, fmt.Errorf("bind_keytab must be base64-encoded: %w", err)
+	}
+	kt := keytab.New()
+	if err := kt.Unmarshal(rawKeytab); err != nil {
+		return nil, fmt.Errorf("unable to parse bind_keytab: %w", err)
+	}
+	krb5Conf, err := krbconfig.NewFromString(cfg.BindKrb5Conf)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse bind_krb5_conf: %w", err)
+	}
+	username, realm := cfg.BindPrincipal, ""
+	if at := strings.LastIndex(username, "@"); at >= 0 {
+		username, realm = username[:at], username[at+1:]
+	}
+	if realm == "" {
+		realm = krb5Conf.LibDefaults.DefaultRealm
+	}
+	if realm == "" {
+		return nil, errors.New("bind_principal must include its realm, like vault@CORP.EXAMPLE.COM, since bind_krb5_conf has no default_realm")
+	}
+	// AD doesn't support FAST, so gokrb5 is kept from asking for it.
+	return krbclient.NewWithKeytab(username, realm, kt, krb5Conf, krbclient.DisablePAFXFAST(true)), nil
+}
+
+// kerberosClientFor returns the Kerberos client for the config's bind
+// principal. It's kept so its tickets are reused for later binds, until the
+// keytab, krb5.conf, or principal changes.
+func (c *Client) kerberosClientFor(cfg *ADConf) (*krbclient.Client, error) {
+	hash := sha256.Sum256([]byte(strings.Join([]string{cfg.BindPrincipal, cfg.BindKrb5Conf, cfg.BindKeytab}, "\x00")))
+	key := hex.EncodeToString(hash[:])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.kerberos[key]; ok {
+		return cached.client, nil
+	}
+	krb, err := newKerberosClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if c.kerberos == nil {
+		c.kerberos = make(map[string]*kerberosClient)
+	}
+	for oldKey, old := range c.kerberos {
+		if old.principal == cfg.BindPrincipal {
+			old.client.Destroy()
+			delete(c.kerberos, oldKey)
+		}
+	}
+	c.kerberos[key] = &kerberosClient{principal: cfg.BindPrincipal, client: krb}
+	return krb, nil
+}
+
+// bindGSSAPI binds as the config's bind principal with SASL GSSAPI, using a
+// ticket for the LDAP service of the domain controller the connection is to.
+func (c *Client) bindGSSAPI(cfg *ADConf, conn ldaputil.Connection, dcURL string) error {
+	binder, ok := conn.(gssapiBinder)
+	if !ok {
+		return errors.New("unable to bind with a keytab because the connection doesn't support SASL GSSAPI")
+	}
+	u, err := url.Parse(dcURL)
+	if err != nil || u.Hostname() == "" {
+		return fmt.Errorf("unable to find the host of %q to get a service ticket for", dcURL)
+	}
+	krb, err := c.kerberosClientFor(cfg)
+	if err != nil {
+		return err
+	}
+	var gssapiClient ldap.GSSAPIClient = &gssapi.Client{Client: krb}
+	if cfg.ChannelBinding {
+		if gssapiClient, err = newChannelBoundGSSAPIClient(krb, conn); err != nil {
+			return err
+		}
+	}
+	return binder.GSSAPIBind(gssapiClient, "ldap/"+u.Hostname(), "")
+}
@@ -0,0 +1,93 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/ldapifc"
+)
+
+const testKrb5Conf = `[libdefaults]
+  default_realm = CORP.EXAMPLE.COM
+
+[realms]
+  CORP.EXAMPLE.COM = {
+    kdc = dc1.corp.example.com
+  }
+`
+
+// testKeytab returns a base64-encoded keytab with a key of the given version for the principal.
+func testKeytab(t *testing.T, principal string, kvno uint8) string {
+	t.Helper()
+	kt := keytab.New()
+	if err := kt.AddEntry(principal, "CORP.EXAMPLE.COM", "password", time.Now(), kvno, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := kt.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func TestBindWithKerberos(t *testing.T) {
+	client := &Client{ldap: &ldaputil.Client{Logger: hclog.NewNullLogger()}}
+	config := emptyConfig()
+	config.BindPassword = ""
+	config.BindKeytab = testKeytab(t, "vault", 1)
+	config.BindKrb5Conf = testKrb5Conf
+
+	if err := config.ValidateKerberosBind(); err == nil {
+		t.Fatal("expected an error without a bind_principal")
+	}
+	config.BindPrincipal = "vault"
+	if err := config.ValidateKerberosBind(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The service ticket is for the domain controller the connection is to.
+	conn := &ldapifc.FakeLDAPConnection{}
+	if err := client.bind(config, conn, "ldaps://dc2.corp.example.com:636"); err != nil {
+		t.Fatal(err)
+	}
+	if conn.GSSAPIServicePrincipal != "ldap/dc2.corp.example.com" {
+		t.Fatalf("unexpected service principal %q", conn.GSSAPIServicePrincipal)
+	}
+
+	// The Kerberos client is kept, so its tickets are reused, until the keytab changes.
+	first, err := client.kerberosClientFor(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := client.kerberosClientFor(config); again != first {
+		t.Fatal("expected the Kerberos client to be reused")
+	}
+	config.BindKeytab = testKeytab(t, "vault", 2)
+	if replaced, _ := client.kerberosClientFor(config); replaced == first || len(client.kerberos) != 1 {
+		t.Fatal("expected the Kerberos client to be replaced when the keytab is")
+	}
+
+	// Even with a bindpass, the keytab is used instead.
+	conn = &ldapifc.FakeLDAPConnection{}
+	config.BindPassword = "cats"
+	if err := client.bind(config, conn, "ldap://dc1.corp.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if conn.GSSAPIServicePrincipal != "ldap/dc1.corp.example.com" {
+		t.Fatalf("unexpected service principal %q", conn.GSSAPIServicePrincipal)
+	}
+
+	config.BindKeytab = "not base64"
+	if err := config.ValidateKerberosBind(); err == nil {
+		t.Fatal("expected an error for a keytab that isn't base64")
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+)
+
+// idleConnTimeout is how long a bound connection is kept idle before it's
+// discarded. It's shorter than AD's default MaxConnIdleTime of 15 minutes, after
+// which AD drops idle connections.
+const idleConnTimeout = 10 * time.Minute
+
+// connPool is the bound connections to one set of domain controllers with one
+// set of credentials.
+type connPool struct {
+	// open counts the connections that are idle, in use, or being dialed.
+	open int
+	idle []*pooledConn
+
+	maxOpen     int
+	maxIdle     int
+	maxLifetime time.Duration
+}
+
+// pooledConn is a bound connection that's returned to its pool when it's
+// closed, if the pool has room for it, instead of being closed.
+type pooledConn struct {
+	ldaputil.Connection
+
+	client *Client
+	key    string
+	dialed time.Time
+	// released is when the connection was last returned to the pool.
+	released time.Time
+}
+
+// Close returns the connection to its pool, or closes it if the pool is full.
+func (p *pooledConn) Close() error {
+	p.client.release(p)
+	return nil
+}
+
+// closingConnection is implemented by connections that know whether they've closed.
+type closingConnection interface {
+	IsClosing() bool
+}
+
+// reusable reports whether the connection can still be used.
+func (p *pooledConn) reusable(pool *connPool, now time.Time) bool {
+	if pool.maxLifetime > 0 && now.Sub(p.dialed) > pool.maxLifetime {
+		return false
+	}
+	if closing, ok := p.Connection.(closingConnection); ok && closing.IsClosing() {
+		return false
+	}
+	return true
+}
+
+// poolFor returns the pool for the key, with the config's limits.
+func (c *Client) poolFor(cfg *ADConf, key string) *connPool {
+	if c.pools == nil {
+		c.pools = make(map[string]*connPool)
+	}
+	pool, ok := c.pools[key]
+	if !ok {
+		pool = &connPool{}
+		c.pools[key] = pool
+	}
+	pool.maxOpen = cfg.MaxOpenConnections
+	pool.maxIdle = cfg.MaxIdleConnections
+	pool.maxLifetime = cfg.ConnectionMaxLifetime
+	return pool
+}
+
+// acquire returns an idle connection from the config's pool if there's one
+// that's still fresh. If there isn't, it returns nil once there's room to dial
+// a new connection, waiting for one to be released if max_open_connections are
+// already open. The caller must then dial and bind one, and call
+// newPooledConn if it does or discard if it doesn't.
+func (c *Client) acquire(cfg *ADConf, key string) *pooledConn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connReleased == nil {
+		c.connReleased = sync.NewCond(&c.mu)
+	}
+	c.closeStaleLocked()
+	pool := c.poolFor(cfg, key)
+	for {
+		for len(pool.idle) > 0 {
+			// The most recently used connection is the least likely to have been
+			// dropped by AD.
+			conn := pool.idle[len(pool.idle)-1]
+			pool.idle = pool.idle[:len(pool.idle)-1]
+			if conn.reusable(pool, time.Now()) {
+				return conn
+			}
+			conn.Connection.Close()
+			pool.open--
+		}
+		if pool.maxOpen <= 0 || pool.open < pool.maxOpen {
+			pool.open++
+			return nil
+		}
+		c.connReleased.Wait()
+	}
+}
+
+// newPooledConn wraps a connection dialed and bound after acquire returned nil.
+func (c *Client) newPooledConn(conn ldaputil.Connection, key string) *pooledConn {
+	return &pooledConn{Connection: conn, client: c, key: key, dialed: time.Now()}
+}
+
+// discard gives back the room acquire made for a connection that couldn't be
+// dialed or bound.
+func (c *Client) discard(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pool, ok := c.pools[key]; ok {
+		pool.open--
+	}
+	c.signalReleasedLocked()
+}
+
+// release keeps the connection idle in its pool if there's room for it and
+// it's still fresh, and otherwise closes it.
+func (c *Client) release(conn *pooledConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.signalReleasedLocked()
+	pool, ok := c.pools[conn.key]
+	if !ok {
+		conn.Connection.Close()
+		return
+	}
+	if c.closed || len(pool.idle) >= pool.maxIdle || !conn.reusable(pool, time.Now()) {
+		conn.Connection.Close()
+		pool.open--
+		return
+	}
+	conn.released = time.Now()
+	pool.idle = append(pool.idle, conn)
+}
+
+// Close closes the idle connections in every pool. Connections in use are
+// closed when they're released, instead of being kept idle.
+func (c *Client) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for key, pool := range c.pools {
+		for _, conn := range pool.idle {
+			conn.Connection.Close()
+			pool.open--
+		}
+		pool.idle = nil
+		if pool.open <= 0 {
+			delete(c.pools, key)
+		}
+	}
+	c.signalReleasedLocked()
+}
+
+func (c *Client) signalReleasedLocked() {
+	if c.connReleased != nil {
+		c.connReleased.Broadcast()
+	}
+}
+
+// closeStaleLocked closes the connections that have been idle longer than
+// idleConnTimeout, and forgets the pools with no connections left, like the
+// ones for a bind password that's since been rotated.
+func (c *Client) closeStaleLocked() {
+	now := time.Now()
+	for key, pool := range c.pools {
+		fresh := pool.idle[:0]
+		for _, conn := range pool.idle {
+			if now.Sub(conn.released) > idleConnTimeout {
+				conn.Connection.Close()
+				pool.open--
+				continue
+			}
+			fresh = append(fresh, conn)
+		}
+		pool.idle = fresh
+		if pool.open <= 0 {
+			delete(c.pools, key)
+		}
+	}
+}
+
+// poolKey identifies the domain controllers, credentials and TLS settings a
+// connection was bound with, so a connection is only reused for the same ones.
+// A connection dialed before StartTLS was required, say, isn't reused after.
+// Secrets and certificates are hashed rather than kept in the key.
+func poolKey(cfg *ADConf) string {
+	secrets := sha256.Sum256([]byte(strings.Join([]string{cfg.BindPassword, cfg.ClientTLSCert, cfg.BindKeytab, cfg.Certificate}, "\x00")))
+	return strings.Join([]string{
+		cfg.Url, cfg.BindMode, cfg.BindDN, cfg.UPNUsername, cfg.UPNDomain, cfg.BindPrincipal,
+		strconv.FormatBool(cfg.StartTLS), strconv.FormatBool(cfg.InsecureTLS), cfg.TLSMinVersion, cfg.TLSMaxVersion,
+		strconv.FormatBool(cfg.RequireStartTLS), strconv.FormatBool(cfg.EnforceSecureConnection),
+		hex.EncodeToString(secrets[:]),
+	}, "\x00")
+}
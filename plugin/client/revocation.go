@@ -0,0 +1,208 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+	"golang.org/x/crypto/ocsp"
+)
+
+// ocspDefaultValidity is how long an OCSP response without a nextUpdate is
+// reused before the responder is asked again.
+const ocspDefaultValidity = time.Hour
+
+// ocspStatus is a cached OCSP answer for a certificate.
+type ocspStatus struct {
+	revoked bool
+	until   time.Time
+}
+
+// ValidateCABundle returns an error unless every PEM block in the certificate
+// field is a certificate that parses. ldaputil only checks the first, so a
+// typo later in a bundle would otherwise be ignored along with the CA it was
+// meant to add.
+func ValidateCABundle(bundle string) error {
+	rest := []byte(bundle)
+	var found int
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		found++
+		if block.Type != "CERTIFICATE" {
+			return fmt.Errorf("PEM block %d in certificate is a %q instead of a CERTIFICATE", found, block.Type)
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return fmt.Errorf("unable to parse certificate %d in certificate: %w", found, err)
+		}
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return fmt.Errorf("certificate has data after its %d PEM blocks that isn't PEM", found)
+	}
+	if found == 0 {
+		return errors.New("certificate has no PEM blocks")
+	}
+	return nil
+}
+
+// ParseCRLs parses the config's PEM-encoded certificate revocation lists.
+func ParseCRLs(rawCRLs string) ([]*x509.RevocationList, error) {
+	rest := []byte(rawCRLs)
+	var crls []*x509.RevocationList
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "X509 CRL" {
+			return nil, fmt.Errorf("PEM block %d in crl is a %q instead of an X509 CRL", len(crls)+1, block.Type)
+		}
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse CRL %d in crl: %w", len(crls)+1, err)
+		}
+		crls = append(crls, crl)
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return nil, errors.New("crl has data that isn't a PEM-encoded CRL")
+	}
+	return crls, nil
+}
+
+// checkRevocation refuses a connection whose domain controller presented a
+// certificate that's been revoked, according to the config's CRLs and, if
+// it asks for it, the OCSP responders of the certificates. It's checked before
+// binding, so credentials aren't sent to a domain controller that can't be
+// trusted. Connections without TLS have nothing to check.
+func (c *Client) checkRevocation(cfg *ADConf, conn ldaputil.Connection) error {
+	if cfg.CRL == "" && !cfg.CheckOCSP {
+		return nil
+	}
+	tlsConn, ok := conn.(tlsConnection)
+	if !ok {
+		return nil
+	}
+	state, encrypted := tlsConn.TLSConnectionState()
+	if !encrypted {
+		return nil
+	}
+	// The verified chain ends at the CA in the certificate field. If the
+	// certificate wasn't verified, like with insecure_tls, the chain the domain
+	// controller sent is checked instead.
+	chain := state.PeerCertificates
+	if len(state.VerifiedChains) > 0 {
+		chain = state.VerifiedChains[0]
+	}
+
+	crls, err := ParseCRLs(cfg.CRL)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := 0; i+1 < len(chain); i++ {
+		cert, issuer := chain[i], chain[i+1]
+		for _, crl := range crls {
+			if !bytes.Equal(crl.RawIssuer, issuer.RawSubject) {
+				continue
+			}
+			if err := crl.CheckSignatureFrom(issuer); err != nil {
+				return fmt.Errorf("the CRL for %q isn't signed by it: %w", issuer.Subject, err)
+			}
+			if !crl.NextUpdate.IsZero() && now.After(crl.NextUpdate) {
+				return fmt.Errorf("the CRL for %q expired at %s, so crl must be updated", issuer.Subject, crl.NextUpdate.Format(time.RFC3339))
+			}
+			for _, revoked := range crl.RevokedCertificateEntries {
+				if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+					return fmt.Errorf("refusing to connect because the certificate %q was revoked at %s", cert.Subject, revoked.RevocationTime.Format(time.RFC3339))
+				}
+			}
+		}
+		if cfg.CheckOCSP && len(cert.OCSPServer) > 0 {
+			revoked, err := c.ocspRevoked(cfg, cert, issuer)
+			if err != nil {
+				return fmt.Errorf("unable to check whether the certificate %q was revoked: %w", cert.Subject, err)
+			}
+			if revoked {
+				return fmt.Errorf("refusing to connect because OCSP says the certificate %q was revoked", cert.Subject)
+			}
+		}
+	}
+	return nil
+}
+
+// ocspRevoked asks the certificate's OCSP responder whether it's been revoked.
+// Answers are cached until they say they should be refreshed, so pooled and
+// repeated connections don't each make a request.
+func (c *Client) ocspRevoked(cfg *ADConf, cert, issuer *x509.Certificate) (bool, error) {
+	hash := sha256.Sum256(cert.Raw)
+	key := hex.EncodeToString(hash[:])
+	c.mu.Lock()
+	cached, ok := c.ocsp[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.until) {
+		return cached.revoked, nil
+	}
+
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return false, err
+	}
+	httpClient := c.ocspHTTP
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: cfg.ConnectionTimeoutOrDefault()}
+	}
+	var errs []error
+	for _, server := range cert.OCSPServer {
+		resp, err := httpClient.Post(server, "application/ocsp-request", bytes.NewReader(req))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		resp.Body.Close()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			errs = append(errs, fmt.Errorf("%s answered with %s", server, resp.Status))
+			continue
+		}
+		parsed, err := ocsp.ParseResponseForCert(body, cert, issuer)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to parse the answer from %s: %w", server, err))
+			continue
+		}
+		if parsed.Status == ocsp.Unknown {
+			errs = append(errs, fmt.Errorf("%s doesn't know the certificate", server))
+			continue
+		}
+		status := ocspStatus{revoked: parsed.Status == ocsp.Revoked, until: parsed.NextUpdate}
+		if status.until.IsZero() {
+			status.until = time.Now().Add(ocspDefaultValidity)
+		}
+		c.mu.Lock()
+		if c.ocsp == nil {
+			c.ocsp = make(map[string]ocspStatus)
+		}
+		c.ocsp[key] = status
+		c.mu.Unlock()
+		return status.revoked, nil
+	}
+	return false, errors.Join(errs...)
+}
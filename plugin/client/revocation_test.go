@@ -0,0 +1,216 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/ldapifc"
+)
+
+// testCA is a root CA that issues domain controllers' certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+// newTestCA returns a root CA with the given common name.
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) pem() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}))
+}
+
+// issue returns a domain controller's certificate with the serial number, and
+// the OCSP responder if one's given.
+func (ca *testCA) issue(t *testing.T, serial int64, ocspServer string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "dc1.corp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if ocspServer != "" {
+		template.OCSPServer = []string{ocspServer}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// crl returns a PEM-encoded CRL that revokes the serial numbers and is due
+// for its next update at nextUpdate.
+func (ca *testCA) crl(t *testing.T, nextUpdate time.Time, serials ...int64) string {
+	t.Helper()
+	var revoked []x509.RevocationListEntry
+	for _, serial := range serials {
+		revoked = append(revoked, x509.RevocationListEntry{SerialNumber: big.NewInt(serial), RevocationTime: time.Now().Add(-time.Minute)})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(1),
+		ThisUpdate:                time.Now().Add(-time.Hour),
+		NextUpdate:                nextUpdate,
+		RevokedCertificateEntries: revoked,
+	}, ca.cert, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}))
+}
+
+func TestValidateCABundle(t *testing.T) {
+	root, other := newTestCA(t, "Corp Root CA"), newTestCA(t, "Other Root CA")
+	if err := ValidateCABundle(root.pem() + other.pem()); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateCABundle(root.pem() + "-----BEGIN CERTIFICATE-----\nbm90IGEgY2VydA==\n-----END CERTIFICATE-----\n"); err == nil {
+		t.Fatal("expected an error for a bundle with a certificate that doesn't parse")
+	}
+	if err := ValidateCABundle(root.pem() + "trailing"); err == nil {
+		t.Fatal("expected an error for a bundle with data that isn't PEM")
+	}
+	if err := ValidateCABundle(root.crl(t, time.Now().Add(time.Hour))); err == nil {
+		t.Fatal("expected an error for a bundle with a CRL in it")
+	}
+}
+
+func TestCheckRevocation_CRL(t *testing.T) {
+	ca := newTestCA(t, "Corp Root CA")
+	c := &Client{ldap: &ldaputil.Client{Logger: hclog.NewNullLogger()}}
+	config := emptyConfig()
+	dcCert := ca.issue(t, 10, "")
+	conn := &ldapifc.FakeLDAPConnection{Encrypted: true, PeerCertificates: []*x509.Certificate{dcCert, ca.cert}}
+
+	config.CRL = ca.crl(t, time.Now().Add(time.Hour), 11)
+	if err := c.checkRevocation(config, conn); err != nil {
+		t.Fatal(err)
+	}
+
+	config.CRL = ca.crl(t, time.Now().Add(time.Hour), 10, 11)
+	if err := c.checkRevocation(config, conn); err == nil || !strings.Contains(err.Error(), "revoked") {
+		t.Fatalf("expected the revoked certificate to be refused but received %v", err)
+	}
+
+	config.CRL = ca.crl(t, time.Now().Add(-time.Minute))
+	if err := c.checkRevocation(config, conn); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("expected an expired CRL to be refused but received %v", err)
+	}
+
+	// A CRL from another CA says nothing about the domain controller's certificate.
+	config.CRL = newTestCA(t, "Other Root CA").crl(t, time.Now().Add(time.Hour), 10)
+	if err := c.checkRevocation(config, conn); err != nil {
+		t.Fatal(err)
+	}
+
+	// There's nothing to check without TLS.
+	config.CRL = ca.crl(t, time.Now().Add(time.Hour), 10)
+	if err := c.checkRevocation(config, &ldapifc.FakeLDAPConnection{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckRevocation_OCSP(t *testing.T) {
+	ca := newTestCA(t, "Corp Root CA")
+	status := ocsp.Good
+	requests := 0
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := io.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resp, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+			Status:       status,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+			RevokedAt:    time.Now().Add(-time.Minute),
+		}, ca.key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(resp)
+	}))
+	defer responder.Close()
+
+	c := &Client{ldap: &ldaputil.Client{Logger: hclog.NewNullLogger()}, ocspHTTP: responder.Client()}
+	config := emptyConfig()
+	config.CheckOCSP = true
+	conn := &ldapifc.FakeLDAPConnection{Encrypted: true, PeerCertificates: []*x509.Certificate{ca.issue(t, 10, responder.URL), ca.cert}}
+
+	if err := c.checkRevocation(config, conn); err != nil {
+		t.Fatal(err)
+	}
+	// The answer is reused until its next update.
+	status = ocsp.Revoked
+	if err := c.checkRevocation(config, conn); err != nil || requests != 1 {
+		t.Fatalf("expected the cached answer to be used but received %v after %d requests", err, requests)
+	}
+
+	conn.PeerCertificates[0] = ca.issue(t, 11, responder.URL)
+	if err := c.checkRevocation(config, conn); err == nil || !strings.Contains(err.Error(), "revoked") {
+		t.Fatalf("expected the revoked certificate to be refused but received %v", err)
+	}
+
+	// If the responder can't be reached, the connection is refused.
+	conn.PeerCertificates[0] = ca.issue(t, 12, "http://127.0.0.1:1")
+	if err := c.checkRevocation(config, conn); err == nil {
+		t.Fatal("expected an error when the OCSP responder can't be reached")
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FormatSID converts a binary objectSid into its string form, like
+// S-1-5-21-3623811015-3361044348-30300820-1013. The binary form is a revision,
+// a count of sub-authorities, a 48-bit big-endian identifier authority, and the
+// sub-authorities as 32-bit little-endian integers.
+func FormatSID(raw []byte) (string, error) {
+	if len(raw) < 8 {
+		return "", fmt.Errorf("objectSid is %d bytes, which is too short", len(raw))
+	}
+	subAuthorities := int(raw[1])
+	if len(raw) != 8+4*subAuthorities {
+		return "", fmt.Errorf("objectSid is %d bytes but has %d sub-authorities", len(raw), subAuthorities)
+	}
+	var authority uint64
+	for _, b := range raw[2:8] {
+		authority = authority<<8 | uint64(b)
+	}
+	sid := &strings.Builder{}
+	fmt.Fprintf(sid, "S-%d-%d", raw[0], authority)
+	for i := 0; i < subAuthorities; i++ {
+		sid.WriteString("-")
+		sid.WriteString(strconv.FormatUint(uint64(binary.LittleEndian.Uint32(raw[8+4*i:])), 10))
+	}
+	return sid.String(), nil
+}
+
+// FormatGUID converts a binary objectGUID into its string form, like
+// 6f9619ff-8b86-d011-b42d-00c04fc964ff. Its first three parts are stored
+// little-endian, as Windows does.
+func FormatGUID(raw []byte) (string, error) {
+	if len(raw) != 16 {
+		return "", fmt.Errorf("objectGUID is %d bytes instead of 16", len(raw))
+	}
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(raw[0:4]),
+		binary.LittleEndian.Uint16(raw[4:6]),
+		binary.LittleEndian.Uint16(raw[6:8]),
+		raw[8:10],
+		raw[10:16],
+	), nil
+}
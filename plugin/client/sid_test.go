@@ -0,0 +1,43 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"testing"
+)
+
+func TestFormatSID(t *testing.T) {
+	raw := []byte{
+		0x01, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x05,
+		0x15, 0x00, 0x00, 0x00,
+		0xc7, 0x3f, 0xff, 0xd7,
+		0x7c, 0x6f, 0x55, 0xc8,
+		0x94, 0x57, 0xce, 0x01,
+		0xf5, 0x03, 0x00, 0x00,
+	}
+	sid, err := FormatSID(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sid != "S-1-5-21-3623829447-3361042300-30300052-1013" {
+		t.Fatalf("received %s", sid)
+	}
+	if _, err := FormatSID(raw[:20]); err == nil {
+		t.Fatal("expected a truncated SID to be rejected")
+	}
+}
+
+func TestFormatGUID(t *testing.T) {
+	raw := []byte{0xff, 0x19, 0x96, 0x6f, 0x86, 0x8b, 0x11, 0xd0, 0xb4, 0x2d, 0x00, 0xc0, 0x4f, 0xc9, 0x64, 0xff}
+	guid, err := FormatGUID(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if guid != "6f9619ff-8b86-d011-b42d-00c04fc964ff" {
+		t.Fatalf("received %s", guid)
+	}
+	if _, err := FormatGUID(raw[:15]); err == nil {
+		t.Fatal("expected a truncated GUID to be rejected")
+	}
+}
@@ -4,6 +4,7 @@
 package client
 
 import (
+	"math"
 	"strconv"
 	"time"
 )
@@ -44,3 +45,27 @@ func TicksToTime(ticks int64) time.Time {
 	remainingNanoseconds := ticks % ticksPerSecond * 100
 	return time.Unix(origin+secondsSinceOrigin, remainingNanoseconds).UTC()
 }
+
+// ParseInterval parses a length of time represented as an Active Directory
+// LargeInt, like minPwdAge, into a duration. Intervals are stored as negative
+// numbers of ticks, and the largest negative number means there's no limit,
+// which is returned as 0 along with ok set to false.
+func ParseInterval(ticks string) (d time.Duration, ok bool, err error) {
+	i, err := strconv.ParseInt(ticks, 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	if i == math.MinInt64 {
+		return 0, false, nil
+	}
+	if i < 0 {
+		i = -i
+	}
+	return time.Duration(i) * nanosInTick, true, nil
+}
+
+// TimeToTicks converts a time to an ActiveDirectory time in ticks. It's the inverse of TicksToTime.
+func TimeToTicks(t time.Time) int64 {
+	origin := time.Date(1601, time.January, 1, 0, 0, 0, 0, time.UTC).Unix()
+	return (t.Unix()-origin)*ticksPerSecond + int64(t.Nanosecond())/nanosInTick
+}
@@ -5,6 +5,7 @@ package client
 
 import (
 	"testing"
+	"time"
 )
 
 func TestParseTime(t *testing.T) {
@@ -18,3 +19,23 @@ func TestParseTime(t *testing.T) {
 		t.Fatalf("expected last set of \"2018-04-12 23:47:08.5591921 +0000 UTC\" but received %q", lastSet.String())
 	}
 }
+
+func TestTimeToTicks(t *testing.T) {
+	if ticks := TimeToTicks(TicksToTime(131680504285591921)); ticks != 131680504285591921 {
+		t.Fatalf("expected 131680504285591921 but received %d", ticks)
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	// AD's default minPwdAge of one day.
+	age, ok, err := ParseInterval("-864000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || age != 24*time.Hour {
+		t.Fatalf("expected 24h but received %s", age)
+	}
+	if _, ok, err := ParseInterval("-9223372036854775808"); err != nil || ok {
+		t.Fatalf("expected no limit but received %t, %v", ok, err)
+	}
+}
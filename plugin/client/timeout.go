@@ -0,0 +1,75 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+)
+
+// DefaultConnectionTimeout and DefaultRequestTimeout are used when a config's
+// connection_timeout or request_timeout is zero, like in configs written before
+// they could be set, so a domain controller that hangs can't block a request
+// forever. They're the defaults of the fields themselves.
+const (
+	DefaultConnectionTimeout = 30 * time.Second
+	DefaultRequestTimeout    = 90 * time.Second
+)
+
+// ConnectionTimeoutOrDefault returns how long dialing a domain controller,
+// including the TLS handshake and StartTLS, may take.
+func (c *ADConf) ConnectionTimeoutOrDefault() time.Duration {
+	if c.ConfigEntry == nil || c.ConnectionTimeout <= 0 {
+		return DefaultConnectionTimeout
+	}
+	return time.Duration(c.ConnectionTimeout) * time.Second
+}
+
+// RequestTimeoutOrDefault returns how long a bind, search, or modify may wait
+// for AD to answer.
+func (c *ADConf) RequestTimeoutOrDefault() time.Duration {
+	if c.ConfigEntry == nil || c.RequestTimeout <= 0 {
+		return DefaultRequestTimeout
+	}
+	return time.Duration(c.RequestTimeout) * time.Second
+}
+
+// dialLDAP dials the entry's domain controller with its timeouts, or the
+// defaults if they aren't set. ldaputil only bounds connecting the socket and
+// the requests made once it's dialed, so the whole dial is bounded here too,
+// since a domain controller can also hang during the TLS handshake or StartTLS.
+func (c *Client) dialLDAP(entry *ldaputil.ConfigEntry) (ldaputil.Connection, error) {
+	cfg := &ADConf{ConfigEntry: entry}
+	timed := *entry
+	timed.ConnectionTimeout = int(cfg.ConnectionTimeoutOrDefault() / time.Second)
+	timed.RequestTimeout = int(cfg.RequestTimeoutOrDefault() / time.Second)
+
+	type dialed struct {
+		conn ldaputil.Connection
+		err  error
+	}
+	result := make(chan dialed, 1)
+	go func() {
+		conn, err := c.ldap.DialLDAP(&timed)
+		result <- dialed{conn: conn, err: err}
+	}()
+
+	timeout := cfg.ConnectionTimeoutOrDefault()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case d := <-result:
+		return d.conn, d.err
+	case <-timer.C:
+		// The connection is closed if it's made after all.
+		go func() {
+			if d := <-result; d.conn != nil {
+				d.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("timed out after %s connecting to %s", timeout, entry.Url)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/ldapifc"
+)
+
+// hungLDAP doesn't finish dialing the hosts that are hung until release is
+// closed.
+type hungLDAP struct {
+	hung    map[string]bool
+	release chan struct{}
+	closed  chan struct{}
+}
+
+func (h *hungLDAP) DialURL(addr string, _ ...ldap.DialOpt) (ldaputil.Connection, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := &timeoutConn{}
+	if h.hung[u.Hostname()] {
+		<-h.release
+		conn.closed = h.closed
+	}
+	return conn, nil
+}
+
+// timeoutConn records the request timeout it's given.
+type timeoutConn struct {
+	ldapifc.FakeLDAPConnection
+	timeout time.Duration
+	closed  chan struct{}
+}
+
+func (c *timeoutConn) SetTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+
+func (c *timeoutConn) Close() error {
+	if c.closed != nil {
+		close(c.closed)
+	}
+	return nil
+}
+
+func TestDialTimeout(t *testing.T) {
+	fake := &hungLDAP{
+		hung:    map[string]bool{"dc1": true},
+		release: make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+	c := &Client{ldap: &ldaputil.Client{Logger: hclog.NewNullLogger(), LDAP: fake}}
+	config := emptyConfig()
+	config.Url = "ldap://dc1,ldap://dc2"
+	config.ConnectionTimeout = 1
+
+	// The hung domain controller is given up on, and the next one is used.
+	conn, dcURL, err := c.dial(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dcURL != "ldap://dc2" {
+		t.Fatalf("expected to connect to dc2 but connected to %q", dcURL)
+	}
+	// A config without a request_timeout gets the default.
+	if timeout := conn.(*timeoutConn).timeout; timeout != DefaultRequestTimeout {
+		t.Fatalf("expected a request timeout of %s but received %s", DefaultRequestTimeout, timeout)
+	}
+
+	// The connection is closed if it's made after all.
+	close(fake.release)
+	select {
+	case <-fake.closed:
+	case <-time.After(time.Second):
+		t.Fatal("expected the late connection to be closed")
+	}
+}
+
+func TestTimeoutsOrDefault(t *testing.T) {
+	config := emptyConfig()
+	if config.ConnectionTimeoutOrDefault() != DefaultConnectionTimeout || config.RequestTimeoutOrDefault() != DefaultRequestTimeout {
+		t.Fatal("expected the defaults for a config without timeouts")
+	}
+	config.ConnectionTimeout = 5
+	config.RequestTimeout = 10
+	if config.ConnectionTimeoutOrDefault() != 5*time.Second || config.RequestTimeoutOrDefault() != 10*time.Second {
+		t.Fatal("expected the configured timeouts")
+	}
+}
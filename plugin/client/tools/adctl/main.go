@@ -0,0 +1,266 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+// adctl runs the plugin's directory client against an arbitrary domain
+// controller, so directory issues can be debugged in the field without writing
+// one-off programs.
+//
+// Usage:
+//
+//	adctl [flags] search <attribute>=<value>
+//	adctl [flags] get <attribute>=<value> [attribute...]
+//	adctl [flags] set-password <attribute>=<value>
+//	adctl [flags] enable <attribute>=<value>
+//	adctl [flags] disable <attribute>=<value>
+//	adctl [flags] uac <attribute>=<value> | <userAccountControl>
+//
+// Each filter matches one attribute the client knows about, ex.
+// "userPrincipalName=svc-app@example.com". set-password reads the new password
+// from the first line of stdin. Connection flags default to the TEST_LDAP_URL,
+// TEST_DN, TEST_LDAP_USERNAME, and TEST_LDAP_PASSWORD environment variables.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+var commands = map[string]func(c *client.Client, conf *client.ADConf, args []string) error{
+	"search":       search,
+	"get":          get,
+	"set-password": setPassword,
+	"enable": func(c *client.Client, conf *client.ADConf, args []string) error {
+		return setDisabled(c, conf, args, false)
+	},
+	"disable": func(c *client.Client, conf *client.ADConf, args []string) error {
+		return setDisabled(c, conf, args, true)
+	},
+	"uac": uac,
+}
+
+func main() {
+	flags := flag.NewFlagSet("adctl", flag.ExitOnError)
+	url := flags.String("url", os.Getenv("TEST_LDAP_URL"), `LDAP URL of the domain controller, ex. "ldaps://dc1.example.com"`)
+	bindDN := flags.String("binddn", os.Getenv("TEST_LDAP_USERNAME"), "DN or UPN of the account to bind with")
+	bindPassword := flags.String("bindpass", os.Getenv("TEST_LDAP_PASSWORD"), "password of the bind account")
+	userDN := flags.String("userdn", os.Getenv("TEST_DN"), "base DN to search under")
+	upnDomain := flags.String("upndomain", "", "userPrincipalName domain of the bind account")
+	certificate := flags.String("certificate", "", "path to the PEM encoded CA certificate of the domain controller")
+	insecureTLS := flags.Bool("insecure-tls", false, "skip verifying the domain controller's certificate")
+	verbose := flags.Bool("v", false, "log what the client is doing")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: adctl [flags] <search|get|set-password|enable|disable|uac> [args]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	args := flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	conf := &client.ADConf{
+		ConfigEntry: &ldaputil.ConfigEntry{
+			Url:           *url,
+			BindDN:        *bindDN,
+			BindPassword:  *bindPassword,
+			UserDN:        *userDN,
+			UPNDomain:     *upnDomain,
+			InsecureTLS:   *insecureTLS,
+			TLSMinVersion: "tls12",
+			TLSMaxVersion: "tls12",
+		},
+	}
+	if *certificate != "" {
+		pem, err := os.ReadFile(*certificate)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		conf.Certificate = string(pem)
+	}
+
+	logger := hclog.NewNullLogger()
+	if *verbose {
+		logger = hclog.New(&hclog.LoggerOptions{Name: "adctl", Level: hclog.Debug})
+	}
+	if err := command(client.NewClient(logger), conf, args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func search(c *client.Client, conf *client.ADConf, args []string) error {
+	if len(args) != 1 {
+		return errors.New("search requires exactly one filter")
+	}
+	filters, err := parseFilter(args[0])
+	if err != nil {
+		return err
+	}
+	entries, err := c.Search(conf, conf.UserDN, filters)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("found %d entries:\n", len(entries))
+	for _, entry := range entries {
+		fmt.Println(entry.DN)
+	}
+	return nil
+}
+
+// get prints the requested attributes of the entry matching the filter, or all
+// of its attributes if none are requested.
+func get(c *client.Client, conf *client.ADConf, args []string) error {
+	if len(args) == 0 {
+		return errors.New("get requires a filter")
+	}
+	entry, err := findOne(c, conf, args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Println("dn:", entry.DN)
+	attributes := args[1:]
+	if len(attributes) == 0 {
+		for _, attribute := range entry.Attributes {
+			attributes = append(attributes, attribute.Name)
+		}
+		sort.Strings(attributes)
+	}
+	for _, name := range attributes {
+		for _, value := range entry.GetAttributeValues(name) {
+			fmt.Printf("%s: %s\n", name, value)
+		}
+	}
+	return nil
+}
+
+func setPassword(c *client.Client, conf *client.ADConf, args []string) error {
+	if len(args) != 1 {
+		return errors.New("set-password requires exactly one filter")
+	}
+	filters, err := parseFilter(args[0])
+	if err != nil {
+		return err
+	}
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		return fmt.Errorf("unable to read the new password from stdin: %w", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		return errors.New("the new password is empty")
+	}
+	if err := c.UpdatePassword(conf, conf.UserDN, filters, password); err != nil {
+		return err
+	}
+	fmt.Println("password updated")
+	return nil
+}
+
+// setDisabled sets or clears the ACCOUNTDISABLE flag, leaving the others alone.
+func setDisabled(c *client.Client, conf *client.ADConf, args []string, disabled bool) error {
+	if len(args) != 1 {
+		return errors.New("exactly one filter is required")
+	}
+	entry, err := findOne(c, conf, args[0])
+	if err != nil {
+		return err
+	}
+	current, err := entryUAC(entry)
+	if err != nil {
+		return err
+	}
+	updated := current &^ client.UACAccountDisable
+	if disabled {
+		updated |= client.UACAccountDisable
+	}
+	if updated == current {
+		fmt.Printf("userAccountControl: %d is unchanged\n", current)
+		return nil
+	}
+	filters := map[*client.Field][]string{client.FieldRegistry.DistinguishedName: {entry.DN}}
+	newValues := map[*client.Field][]string{client.FieldRegistry.UserAccountControl: {strconv.FormatInt(updated, 10)}}
+	if err := c.UpdateEntry(conf, conf.UserDN, filters, newValues); err != nil {
+		return err
+	}
+	fmt.Printf("userAccountControl: %d -> %d\n", current, updated)
+	return nil
+}
+
+// uac decodes a userAccountControl value, or that of the entry matching the filter.
+func uac(c *client.Client, conf *client.ADConf, args []string) error {
+	if len(args) != 1 {
+		return errors.New("uac requires a filter or a userAccountControl value")
+	}
+	value, err := client.ParseUAC(args[0])
+	if err != nil {
+		entry, err := findOne(c, conf, args[0])
+		if err != nil {
+			return err
+		}
+		if value, err = entryUAC(entry); err != nil {
+			return err
+		}
+		fmt.Println("dn:", entry.DN)
+	}
+	fmt.Printf("userAccountControl: %d (0x%x)\n", value, value)
+	for _, flag := range client.UACFlags(value) {
+		fmt.Println(" ", flag)
+	}
+	return nil
+}
+
+func findOne(c *client.Client, conf *client.ADConf, arg string) (*client.Entry, error) {
+	filters, err := parseFilter(arg)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := c.Search(conf, conf.UserDN, filters)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 1 {
+		return nil, fmt.Errorf("%s matched %d entries, expected 1", arg, len(entries))
+	}
+	return entries[0], nil
+}
+
+func entryUAC(entry *client.Entry) (int64, error) {
+	raw, found := entry.GetJoined(client.FieldRegistry.UserAccountControl)
+	if !found {
+		return 0, fmt.Errorf("%s has no userAccountControl", entry.DN)
+	}
+	return client.ParseUAC(raw)
+}
+
+// parseFilter parses an argument like "givenName=Sara".
+func parseFilter(arg string) (map[*client.Field][]string, error) {
+	name, value, ok := strings.Cut(arg, "=")
+	if !ok || value == "" {
+		return nil, fmt.Errorf("%q isn't a filter like attribute=value", arg)
+	}
+	field := client.FieldRegistry.Parse(name)
+	if field == nil {
+		return nil, fmt.Errorf("%q isn't a known attribute", name)
+	}
+	return map[*client.Field][]string{field: {value}}, nil
+}
@@ -0,0 +1,83 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"sort"
+	"strconv"
+)
+
+// UserAccountControl flags, as documented at
+// https://learn.microsoft.com/en-us/troubleshoot/windows-server/active-directory/useraccountcontrol-manipulate-account-properties
+const (
+	UACScript                       = 0x0001
+	UACAccountDisable               = 0x0002
+	UACHomeDirRequired              = 0x0008
+	UACLockout                      = 0x0010
+	UACPasswordNotRequired          = 0x0020
+	UACPasswordCantChange           = 0x0040
+	UACEncryptedTextPasswordAllowed = 0x0080
+	UACTempDuplicateAccount         = 0x0100
+	UACNormalAccount                = 0x0200
+	UACInterdomainTrustAccount      = 0x0800
+	UACWorkstationTrustAccount      = 0x1000
+	UACServerTrustAccount           = 0x2000
+	UACDontExpirePassword           = 0x10000
+	UACMNSLogonAccount              = 0x20000
+	UACSmartcardRequired            = 0x40000
+	UACTrustedForDelegation         = 0x80000
+	UACNotDelegated                 = 0x100000
+	UACUseDESKeyOnly                = 0x200000
+	UACDontRequirePreauth           = 0x400000
+	UACPasswordExpired              = 0x800000
+	UACTrustedToAuthForDelegation   = 0x1000000
+	UACPartialSecretsAccount        = 0x04000000
+)
+
+var uacFlagNames = map[int64]string{
+	UACScript:                       "SCRIPT",
+	UACAccountDisable:               "ACCOUNTDISABLE",
+	UACHomeDirRequired:              "HOMEDIR_REQUIRED",
+	UACLockout:                      "LOCKOUT",
+	UACPasswordNotRequired:          "PASSWD_NOTREQD",
+	UACPasswordCantChange:           "PASSWD_CANT_CHANGE",
+	UACEncryptedTextPasswordAllowed: "ENCRYPTED_TEXT_PWD_ALLOWED",
+	UACTempDuplicateAccount:         "TEMP_DUPLICATE_ACCOUNT",
+	UACNormalAccount:                "NORMAL_ACCOUNT",
+	UACInterdomainTrustAccount:      "INTERDOMAIN_TRUST_ACCOUNT",
+	UACWorkstationTrustAccount:      "WORKSTATION_TRUST_ACCOUNT",
+	UACServerTrustAccount:           "SERVER_TRUST_ACCOUNT",
+	UACDontExpirePassword:           "DONT_EXPIRE_PASSWORD",
+	UACMNSLogonAccount:              "MNS_LOGON_ACCOUNT",
+	UACSmartcardRequired:            "SMARTCARD_REQUIRED",
+	UACTrustedForDelegation:         "TRUSTED_FOR_DELEGATION",
+	UACNotDelegated:                 "NOT_DELEGATED",
+	UACUseDESKeyOnly:                "USE_DES_KEY_ONLY",
+	UACDontRequirePreauth:           "DONT_REQ_PREAUTH",
+	UACPasswordExpired:              "PASSWORD_EXPIRED",
+	UACTrustedToAuthForDelegation:   "TRUSTED_TO_AUTH_FOR_DELEGATION",
+	UACPartialSecretsAccount:        "PARTIAL_SECRETS_ACCOUNT",
+}
+
+// ParseUAC parses a userAccountControl value.
+func ParseUAC(s string) (int64, error) {
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// UACFlags returns the names of the flags set in a userAccountControl value,
+// in ascending order of their bits. Unknown bits are ignored.
+func UACFlags(uac int64) []string {
+	bits := make([]int64, 0, len(uacFlagNames))
+	for bit := range uacFlagNames {
+		if uac&bit != 0 {
+			bits = append(bits, bit)
+		}
+	}
+	sort.Slice(bits, func(i, j int) bool { return bits[i] < bits[j] })
+	names := make([]string, len(bits))
+	for i, bit := range bits {
+		names[i] = uacFlagNames[bit]
+	}
+	return names
+}
@@ -0,0 +1,24 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package client
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUACFlags(t *testing.T) {
+	// This is a disabled account whose password never expires.
+	uac, err := ParseUAC("66050")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"ACCOUNTDISABLE", "NORMAL_ACCOUNT", "DONT_EXPIRE_PASSWORD"}
+	if flags := UACFlags(uac); !reflect.DeepEqual(flags, expected) {
+		t.Fatalf("expected %v but received %v", expected, flags)
+	}
+	if flags := UACFlags(0); len(flags) != 0 {
+		t.Fatalf("expected no flags but received %v", flags)
+	}
+}
@@ -6,6 +6,7 @@ package plugin
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
 )
@@ -14,6 +15,131 @@ type configuration struct {
 	PasswordConf          passwordConf
 	ADConf                *client.ADConf
 	LastRotationTolerance int
+
+	// TidyInterval is how often, in seconds, to automatically tidy storage.
+	// Zero disables automatic tidying.
+	TidyInterval int
+
+	// DisallowUnlimitedTTL rejects library sets and check-outs whose lending
+	// period would have no limit.
+	DisallowUnlimitedTTL bool
+
+	// LibraryTTL and LibraryMaxTTL, in seconds, are the ttl and max_ttl of
+	// check-outs from library sets that don't have their own. LibraryMaxTTL also
+	// caps every set's max_ttl. Zero leaves them to the mount's lease TTLs.
+	LibraryTTL    int
+	LibraryMaxTTL int
+
+	// DueWarningWindow is how long, in seconds, before a check-out is due that
+	// its borrower is warned it's expiring soon, so they can renew it before it's
+	// checked in. Zero sends no warnings.
+	DueWarningWindow int
+
+	// RequireResponseWrapping rejects creds reads and check-outs that aren't
+	// response-wrapped for at least MinWrapTTL seconds.
+	RequireResponseWrapping bool
+	MinWrapTTL              int
+
+	// OmitLastPassword leaves last_password out of every role's creds
+	// responses. Roles can also set it for themselves.
+	OmitLastPassword bool
+
+	// IncludeAccountIDs adds service accounts' SIDs and GUIDs to creds and
+	// check-out responses.
+	IncludeAccountIDs bool
+
+	// IncludeKerberosInfo adds service accounts' Kerberos realm, principal,
+	// NetBIOS domain, and KDCs to creds and check-out responses. KerberosRealm,
+	// NetBIOSDomain, and KDCs are used instead of discovering them if they're set.
+	IncludeKerberosInfo bool
+	KerberosRealm       string
+	NetBIOSDomain       string
+	KDCs                []string
+
+	// RespectMinPasswordAge defers rotations of passwords that are younger than
+	// the minimum password age AD applies to their accounts, instead of letting
+	// AD reject them.
+	RespectMinPasswordAge bool
+
+	// ComplianceMaxPasswordAge is the age, in seconds, past which the password
+	// age report counts a password as non-compliant. Zero judges each account by
+	// its own role's or library set's rotation settings.
+	ComplianceMaxPasswordAge int
+
+	// RootPasswordMaxAge is the age, in seconds, past which reading the config
+	// warns that the bind password is due for rotate-root. Zero doesn't warn.
+	RootPasswordMaxAge int
+
+	// RotationRateLimit is how many library passwords may be rotated per second
+	// once RotationBurst rotations have been made at once, so mass check-ins are
+	// spread out instead of resetting hundreds of passwords at the same time.
+	// Zero means no limit.
+	RotationRateLimit float64
+	RotationBurst     int
+
+	// Provider names the managed AD service the directory runs on, if any, so
+	// its restrictions can be checked up front.
+	Provider string
+
+	// StampAttribute, if set, is set on service accounts from StampTemplate when
+	// a role, library set, or elevation role takes them over, and cleared when
+	// they're no longer managed, so directory admins can identify them.
+	StampAttribute string
+	StampTemplate  string
+
+	// WebhookURL, if set, is sent JSON notifications of check-outs, forced and
+	// overdue check-ins, and rotation failures. WebhookAuthHeader is sent as the
+	// Authorization header, and WebhookHMACKey signs the body.
+	WebhookURL        string
+	WebhookAuthHeader string
+	WebhookHMACKey    string
+
+	// TransitKeyName, if set, is the Transit key that library passwords are
+	// encrypted with before they're stored. TransitAddress and TransitToken
+	// reach the Vault server whose TransitMount has it, and are kept after the
+	// key name is cleared so passwords it encrypted can still be read.
+	// TransitCACert verifies the server's certificate, and TransitNamespace is
+	// the namespace TransitMount is in.
+	TransitAddress   string
+	TransitToken     string
+	TransitMount     string
+	TransitKeyName   string
+	TransitCACert    string
+	TransitNamespace string
+}
+
+// libraryTTLs returns a library check-out's ttl and max_ttl once the config's
+// library_ttl and library_max_ttl are applied: they stand in for a ttl or max_ttl
+// of 0, and library_max_ttl caps the max_ttl. The mount's limits are applied
+// after, by leaseTTLs.
+func (c *configuration) libraryTTLs(ttl, maxTTL time.Duration) (time.Duration, time.Duration) {
+	if c == nil {
+		return ttl, maxTTL
+	}
+	if ttl <= 0 {
+		ttl = time.Duration(c.LibraryTTL) * time.Second
+	}
+	libraryMaxTTL := time.Duration(c.LibraryMaxTTL) * time.Second
+	if maxTTL <= 0 || (libraryMaxTTL > 0 && maxTTL > libraryMaxTTL) {
+		maxTTL = libraryMaxTTL
+	}
+	return ttl, maxTTL
+}
+
+// transitMount returns the mount of the Transit key, which defaults to "transit".
+func (c *configuration) transitMount() string {
+	if c.TransitMount == "" {
+		return defaultTransitMount
+	}
+	return c.TransitMount
+}
+
+// providerPreset returns the preset for the configured provider, or nil if none is set.
+func (c *configuration) providerPreset() *providerPreset {
+	if c == nil {
+		return nil
+	}
+	return providerPresets[c.Provider]
 }
 
 type passwordConf struct {
@@ -31,16 +157,74 @@ type passwordConf struct {
 	// Mutually exclusive with PasswordPolicy.
 	// Deprecated
 	Formatter string `json:"formatter"`
+
+	// FIPSMode generates passwords only with the FIPS 140-2 validated crypto
+	// module and rejects settings that would produce weaker passwords.
+	FIPSMode bool `json:"fips_mode"`
+
+	// Composition generates passwords of Length that follow inline rules.
+	// Mutually exclusive with PasswordPolicy.
+	Composition passwordComposition `json:"composition"`
 }
 
 func (c passwordConf) Map() map[string]interface{} {
 	return map[string]interface{}{
-		"ttl":             c.TTL,
-		"max_ttl":         c.MaxTTL,
-		"length":          c.Length,
-		"formatter":       c.Formatter,
-		"password_policy": c.PasswordPolicy,
+		"ttl":                c.TTL,
+		"max_ttl":            c.MaxTTL,
+		"length":             c.Length,
+		"formatter":          c.Formatter,
+		"password_policy":    c.PasswordPolicy,
+		"fips_mode":          c.FIPSMode,
+		"min_digits":         c.Composition.MinDigits,
+		"min_uppercase":      c.Composition.MinUppercase,
+		"min_symbols":        c.Composition.MinSymbols,
+		"charset":            c.Composition.Charset,
+		"exclude_characters": c.Composition.ExcludeCharacters,
+	}
+}
+
+// deprecatedFields returns the deprecated fields passwords are still generated
+// with, instead of a password policy or composition rules.
+func (c passwordConf) deprecatedFields() []string {
+	var fields []string
+	if c.PasswordPolicy == "" && !c.Composition.isSet() {
+		fields = append(fields, "length")
+	}
+	if c.Formatter != "" {
+		fields = append(fields, "formatter")
+	}
+	return fields
+}
+
+// withComposition returns the config with the role's composition rules in place of
+// its own. A role's rules take precedence over the config's password_policy, in
+// which case passwords are generated with the default length.
+func (c passwordConf) withComposition(composition *passwordComposition) passwordConf {
+	if composition == nil || !composition.isSet() {
+		return c
+	}
+	c.Composition = *composition
+	if c.PasswordPolicy != "" {
+		c.PasswordPolicy = ""
+		c.Length = defaultPasswordLength
+		c.Formatter = ""
+	}
+	return c
+}
+
+// withExcludedCharacters returns the config with more characters excluded from
+// its passwords, like a library set's. As with a role's composition rules, they
+// take precedence over the config's password_policy.
+func (c passwordConf) withExcludedCharacters(excludeCharacters string) passwordConf {
+	if excludeCharacters == "" {
+		return c
+	}
+	composition := passwordComposition{}
+	if c.PasswordPolicy == "" {
+		composition = c.Composition
 	}
+	composition.ExcludeCharacters += excludeCharacters
+	return c.withComposition(&composition)
 }
 
 // validate returns an error if the configuration is invalid/unable to process for whatever reason.
@@ -49,18 +233,47 @@ func (c passwordConf) validate() error {
 		(c.Length != 0 || c.Formatter != "") {
 		return fmt.Errorf("cannot set password_policy and either length or formatter")
 	}
+	if c.PasswordPolicy != "" && c.Composition.isSet() {
+		return fmt.Errorf("cannot set password_policy and composition rules like min_digits, charset, or exclude_characters")
+	}
+	if c.FIPSMode && !fipsModeAvailable() {
+		return fmt.Errorf("fips_mode is only available in FIPS 140-2 builds of the plugin")
+	}
 
 	// Don't PasswordPolicy the length and formatter fields if a policy is set
 	if c.PasswordPolicy != "" {
 		return nil
 	}
 
+	if c.Composition.isSet() {
+		length := c.Length
+		if c.Formatter != "" {
+			length = lengthOfPassword(c.Formatter, c.Length)
+		}
+		if length < minimumLengthOfComplexString {
+			return fmt.Errorf("it's not possible to generate a _secure_ password with %d generated characters, please boost length so at least %d are generated", length, minimumLengthOfComplexString)
+		}
+		if c.FIPSMode && length < minimumFIPSPasswordLength {
+			return fmt.Errorf("fips_mode requires at least %d generated characters", minimumFIPSPasswordLength)
+		}
+		if err := c.Composition.validate(length); err != nil {
+			return err
+		}
+		if c.Formatter != "" && strings.Count(c.Formatter, pwdFieldTmpl) != 1 {
+			return fmt.Errorf("%s must contain ONE password replacement field of %s", c.Formatter, pwdFieldTmpl)
+		}
+		return nil
+	}
+
 	// Check for if there's no formatter.
 	if c.Formatter == "" {
 		if c.Length < len(passwordComplexityPrefix)+minimumLengthOfComplexString {
 			return fmt.Errorf("it's not possible to generate a _secure_ password of length %d, please boost length to %d, though Vault recommends higher",
 				c.Length, minimumLengthOfComplexString+len(passwordComplexityPrefix))
 		}
+		if c.FIPSMode && c.Length-len(passwordComplexityPrefix) < minimumFIPSPasswordLength {
+			return fmt.Errorf("fips_mode requires a length of at least %d", minimumFIPSPasswordLength+len(passwordComplexityPrefix))
+		}
 		return nil
 	}
 
@@ -68,6 +281,9 @@ func (c passwordConf) validate() error {
 	if lengthOfPassword(c.Formatter, c.Length) < minimumLengthOfComplexString {
 		return fmt.Errorf("since the desired length is %d, it isn't possible to generate a sufficiently complex password - please increase desired length or remove characters from the formatter", c.Length)
 	}
+	if c.FIPSMode && lengthOfPassword(c.Formatter, c.Length) < minimumFIPSPasswordLength {
+		return fmt.Errorf("fips_mode requires at least %d generated characters, please increase desired length or remove characters from the formatter", minimumFIPSPasswordLength)
+	}
 	numPwdFields := strings.Count(c.Formatter, pwdFieldTmpl)
 	if numPwdFields == 0 {
 		return fmt.Errorf("%s must contain password replacement field of %s", c.Formatter, pwdFieldTmpl)
@@ -0,0 +1,91 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+// probeDCs dials the domain controllers of the config and each named config
+// that were found down, so they're preferred again as soon as they're back.
+// It's called by the periodic func. Failing to probe is only logged, since the
+// next request tries the domain controllers anyway.
+func (b *backend) probeDCs(ctx context.Context, storage logical.Storage) error {
+	checker, ok := b.client.(DCHealthChecker)
+	if !ok {
+		return nil
+	}
+	engineConf, err := readConfig(ctx, storage)
+	if err != nil {
+		return err
+	}
+	if engineConf == nil || engineConf.ADConf == nil || engineConf.ADConf.ConfigEntry == nil {
+		return nil
+	}
+	names, err := storage.List(ctx, namedConfigStoragePrefix)
+	if err != nil {
+		return err
+	}
+	adConfs := map[string]*client.ADConf{"": engineConf.ADConf}
+	for _, name := range names {
+		named, err := readNamedConfig(ctx, storage, name)
+		if err != nil {
+			return err
+		}
+		if named != nil && named.ConfigEntry != nil {
+			adConfs[name] = named
+		}
+	}
+	for name, adConf := range adConfs {
+		statuses, err := checker.ProbeDCs(adConf)
+		if err != nil {
+			b.Logger().Warn("unable to probe domain controllers", "config", name, "error", err)
+			continue
+		}
+		for _, status := range statuses {
+			if !status.Healthy {
+				b.Logger().Debug("domain controller is still unreachable", "config", name, "url", status.URL, "down_since", status.DownSince)
+			}
+		}
+	}
+	return nil
+}
+
+// dcHealthData returns the health of the domain controllers in a config's url
+// for its read response, or nil if the client doesn't track it.
+func (b *backend) dcHealthData(adConf *client.ADConf) []map[string]interface{} {
+	checker, ok := b.client.(DCHealthChecker)
+	if !ok || adConf == nil || adConf.ConfigEntry == nil {
+		return nil
+	}
+	statuses, err := checker.DCHealth(adConf)
+	if err != nil {
+		b.Logger().Warn("unable to read the health of domain controllers", "error", err)
+		return nil
+	}
+	if len(statuses) == 0 {
+		return nil
+	}
+	data := make([]map[string]interface{}, 0, len(statuses))
+	for _, status := range statuses {
+		dc := map[string]interface{}{
+			"url":     status.URL,
+			"healthy": status.Healthy,
+		}
+		if !status.CheckedAt.IsZero() {
+			dc["checked_at"] = status.CheckedAt
+		}
+		if !status.Healthy {
+			dc["down_since"] = status.DownSince
+			dc["last_error"] = strings.TrimSpace(status.LastError)
+		}
+		data = append(data, dc)
+	}
+	return data
+}
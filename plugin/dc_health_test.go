@@ -0,0 +1,82 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+// healthDirectory reports dc1 down until it's probed.
+type healthDirectory struct {
+	*memoryDirectory
+	probed []string
+}
+
+func (d *healthDirectory) ProbeDCs(conf *client.ADConf) ([]client.DCStatus, error) {
+	d.probed = append(d.probed, conf.Url)
+	return d.DCHealth(conf)
+}
+
+func (d *healthDirectory) DCHealth(_ *client.ADConf) ([]client.DCStatus, error) {
+	dc1 := client.DCStatus{URL: "ldaps://dc1", Healthy: len(d.probed) > 0}
+	if !dc1.Healthy {
+		dc1.DownSince = time.Unix(0, 0)
+		dc1.LastError = "connection refused"
+	}
+	return []client.DCStatus{dc1, {URL: "ldaps://dc2", Healthy: true}}, nil
+}
+
+func TestDCHealth(t *testing.T) {
+	directory := &healthDirectory{memoryDirectory: newMemoryDirectory()}
+	conf := testConfig()
+	conf.ADConf.Url = "ldaps://dc1,ldaps://dc2"
+	b, storage := getBackend(t, directory, conf)
+	readDCs := func() interface{} {
+		t.Helper()
+		resp := sendRequest(t, b, storage, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      configPath,
+		})
+		if resp == nil || resp.IsError() {
+			t.Fatalf("unable to read config: %#v", resp)
+		}
+		return resp.Data["domain_controllers"]
+	}
+
+	expected := []map[string]interface{}{
+		{"url": "ldaps://dc1", "healthy": false, "down_since": time.Unix(0, 0), "last_error": "connection refused"},
+		{"url": "ldaps://dc2", "healthy": true},
+	}
+	if dcs := readDCs(); !reflect.DeepEqual(dcs, expected) {
+		t.Fatalf("expected %#v but received %#v", expected, dcs)
+	}
+
+	// The periodic func probes the domain controllers, even while rotation is paused.
+	entry, err := logical.StorageEntryJSON(rotationPauseStorageKey, &rotationPause{Until: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.periodicFunc(ctx, &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(directory.probed, []string{"ldaps://dc1,ldaps://dc2"}) {
+		t.Fatalf("unexpected probes %v", directory.probed)
+	}
+	expected = []map[string]interface{}{
+		{"url": "ldaps://dc1", "healthy": true},
+		{"url": "ldaps://dc2", "healthy": true},
+	}
+	if dcs := readDCs(); !reflect.DeepEqual(dcs, expected) {
+		t.Fatalf("expected %#v but received %#v", expected, dcs)
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/util"
+)
+
+// devModeClient sends requests to an in-memory directory instead of AD when
+// the config has dev_mode enabled. Dev mode can only be enabled in builds made
+// with the devmode tag.
+type devModeClient struct {
+	SecretsClient
+	directory *memoryDirectory
+}
+
+func newDevModeClient(c SecretsClient) *devModeClient {
+	return &devModeClient{
+		SecretsClient: c,
+		directory:     newMemoryDirectory(),
+	}
+}
+
+func (c *devModeClient) clientFor(conf *client.ADConf) SecretsClient {
+	if conf != nil && conf.DevMode {
+		return c.directory
+	}
+	return c.SecretsClient
+}
+
+func (c *devModeClient) Get(conf *client.ADConf, serviceAccountName string) (*client.Entry, error) {
+	return c.clientFor(conf).Get(conf, serviceAccountName)
+}
+
+func (c *devModeClient) GetPasswordLastSet(conf *client.ADConf, serviceAccountName string) (time.Time, error) {
+	return c.clientFor(conf).GetPasswordLastSet(conf, serviceAccountName)
+}
+
+func (c *devModeClient) UpdatePassword(conf *client.ADConf, serviceAccountName string, newPassword string) error {
+	return c.clientFor(conf).UpdatePassword(conf, serviceAccountName, newPassword)
+}
+
+func (c *devModeClient) UpdateRootPassword(conf *client.ADConf, bindDN string, newPassword string) error {
+	return c.clientFor(conf).UpdateRootPassword(conf, bindDN, newPassword)
+}
+
+func (c *devModeClient) AddGroupMember(conf *client.ADConf, groupDN string, serviceAccountName string) error {
+	groupClient, ok := c.clientFor(conf).(GroupMembershipClient)
+	if !ok {
+		return errors.New("the secrets client doesn't support group membership")
+	}
+	return groupClient.AddGroupMember(conf, groupDN, serviceAccountName)
+}
+
+func (c *devModeClient) RemoveGroupMember(conf *client.ADConf, groupDN string, serviceAccountName string) error {
+	groupClient, ok := c.clientFor(conf).(GroupMembershipClient)
+	if !ok {
+		return errors.New("the secrets client doesn't support group membership")
+	}
+	return groupClient.RemoveGroupMember(conf, groupDN, serviceAccountName)
+}
+
+func (c *devModeClient) UpdateEntry(conf *client.ADConf, serviceAccountName string, newValues map[*client.Field][]string) error {
+	updater, ok := c.clientFor(conf).(EntryUpdater)
+	if !ok {
+		return errors.New("the secrets client doesn't support updating entries")
+	}
+	return updater.UpdateEntry(conf, serviceAccountName, newValues)
+}
+
+func (c *devModeClient) VerifyPassword(conf *client.ADConf, serviceAccountName string, password string) error {
+	verifier, ok := c.clientFor(conf).(PasswordVerifier)
+	if !ok {
+		return errors.New("the secrets client doesn't support verifying passwords")
+	}
+	return verifier.VerifyPassword(conf, serviceAccountName, password)
+}
+
+// MinPasswordAge returns the account's minimum password age. The in-memory
+// directory doesn't have one.
+func (c *devModeClient) MinPasswordAge(conf *client.ADConf, serviceAccountName string) (time.Duration, error) {
+	reader, ok := c.clientFor(conf).(MinPasswordAgeReader)
+	if !ok {
+		return 0, nil
+	}
+	return reader.MinPasswordAge(conf, serviceAccountName)
+}
+
+// Prewarm connects to AD ahead of time. There's nothing to connect to in dev mode.
+func (c *devModeClient) Prewarm(conf *client.ADConf) error {
+	prewarmer, ok := c.clientFor(conf).(ConnectionPrewarmer)
+	if !ok {
+		return nil
+	}
+	return prewarmer.Prewarm(conf)
+}
+
+// Close closes the connections kept to AD. There are none in dev mode.
+func (c *devModeClient) Close() {
+	if closer, ok := c.SecretsClient.(ConnectionCloser); ok {
+		closer.Close()
+	}
+}
+
+// VerifyConnection checks the config works. There's nothing to connect to in dev mode.
+func (c *devModeClient) VerifyConnection(conf *client.ADConf) error {
+	verifier, ok := c.clientFor(conf).(ConnectionVerifier)
+	if !ok {
+		return nil
+	}
+	return verifier.VerifyConnection(conf)
+}
+
+// ProbeDCs dials the domain controllers that are down. There are none in dev mode.
+func (c *devModeClient) ProbeDCs(conf *client.ADConf) ([]client.DCStatus, error) {
+	checker, ok := c.clientFor(conf).(DCHealthChecker)
+	if !ok {
+		return nil, nil
+	}
+	return checker.ProbeDCs(conf)
+}
+
+// DCHealth returns the health of the domain controllers. There are none in dev mode.
+func (c *devModeClient) DCHealth(conf *client.ADConf) ([]client.DCStatus, error) {
+	checker, ok := c.clientFor(conf).(DCHealthChecker)
+	if !ok {
+		return nil, nil
+	}
+	return checker.DCHealth(conf)
+}
+
+// memoryDirectory is a fake AD that keeps passwords in memory. Every service
+// account exists, so any name can be used with roles and library sets.
+type memoryDirectory struct {
+	mu       sync.Mutex
+	accounts map[string]*memoryAccount
+}
+
+type memoryAccount struct {
+	password        string
+	passwordLastSet time.Time
+	memberOf        []string
+}
+
+func newMemoryDirectory() *memoryDirectory {
+	return &memoryDirectory{
+		accounts: make(map[string]*memoryAccount),
+	}
+}
+
+func (d *memoryDirectory) account(name string) *memoryAccount {
+	account, ok := d.accounts[name]
+	if !ok {
+		account = &memoryAccount{}
+		d.accounts[name] = account
+	}
+	return account
+}
+
+func (d *memoryDirectory) Get(conf *client.ADConf, serviceAccountName string) (*client.Entry, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	username := strings.Split(serviceAccountName, "@")[0]
+	dn := "CN=" + ldaputil.EscapeLDAPValue(username)
+	if conf != nil && conf.ConfigEntry != nil && conf.UserDN != "" {
+		dn += "," + conf.UserDN
+	}
+	nameField := client.FieldRegistry.UserPrincipalName
+	if util.IsComputerAccount(serviceAccountName) {
+		nameField = client.FieldRegistry.SAMAccountName
+	}
+	entry := &ldap.Entry{
+		DN: dn,
+		Attributes: []*ldap.EntryAttribute{
+			{
+				Name:   nameField.String(),
+				Values: []string{serviceAccountName},
+			},
+		},
+	}
+	if passwordLastSet := d.account(serviceAccountName).passwordLastSet; !passwordLastSet.IsZero() {
+		entry.Attributes = append(entry.Attributes, &ldap.EntryAttribute{
+			Name:   client.FieldRegistry.PasswordLastSet.String(),
+			Values: []string{strconv.FormatInt(client.TimeToTicks(passwordLastSet), 10)},
+		})
+	}
+	if memberOf := d.account(serviceAccountName).memberOf; len(memberOf) > 0 {
+		entry.Attributes = append(entry.Attributes, &ldap.EntryAttribute{
+			Name:   client.FieldRegistry.MemberOf.String(),
+			Values: append([]string(nil), memberOf...),
+		})
+	}
+	return client.NewEntry(entry), nil
+}
+
+func (d *memoryDirectory) GetPasswordLastSet(_ *client.ADConf, serviceAccountName string) (time.Time, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.account(serviceAccountName).passwordLastSet, nil
+}
+
+func (d *memoryDirectory) UpdatePassword(_ *client.ADConf, serviceAccountName string, newPassword string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	account := d.account(serviceAccountName)
+	account.password = newPassword
+	account.passwordLastSet = time.Now().UTC()
+	return nil
+}
+
+func (d *memoryDirectory) VerifyPassword(_ *client.ADConf, serviceAccountName string, password string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.account(serviceAccountName).password != password {
+		return errors.New("invalid credentials")
+	}
+	return nil
+}
+
+func (d *memoryDirectory) UpdateRootPassword(conf *client.ADConf, bindDN string, newPassword string) error {
+	return d.UpdatePassword(conf, bindDN, newPassword)
+}
+
+func (d *memoryDirectory) AddGroupMember(_ *client.ADConf, groupDN string, serviceAccountName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	account := d.account(serviceAccountName)
+	if !strutil.StrListContainsCaseInsensitive(account.memberOf, groupDN) {
+		account.memberOf = append(account.memberOf, groupDN)
+	}
+	return nil
+}
+
+func (d *memoryDirectory) RemoveGroupMember(_ *client.ADConf, groupDN string, serviceAccountName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	account := d.account(serviceAccountName)
+	memberOf := account.memberOf[:0]
+	for _, dn := range account.memberOf {
+		if !strings.EqualFold(dn, groupDN) {
+			memberOf = append(memberOf, dn)
+		}
+	}
+	account.memberOf = memberOf
+	return nil
+}
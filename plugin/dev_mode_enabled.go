@@ -0,0 +1,9 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build devmode
+
+package plugin
+
+// devModeAvailable reports whether dev_mode may be enabled in the config.
+const devModeAvailable = true
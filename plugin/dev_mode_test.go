@@ -0,0 +1,85 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+func TestDevModeClient(t *testing.T) {
+	devClient := newDevModeClient(&fakeSecretsClient{throwErrs: true})
+	adConf := &client.ADConf{
+		ConfigEntry: &ldaputil.ConfigEntry{
+			UserDN: "OU=Service Accounts,DC=example,DC=com",
+		},
+	}
+
+	// Without dev mode, requests go to the wrapped client.
+	if _, err := devClient.Get(adConf, "app@example.com"); err == nil {
+		t.Fatal("expected the wrapped client's error")
+	}
+
+	adConf.DevMode = true
+	entry, err := devClient.Get(adConf, "app@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.DN != "CN=app,OU=Service Accounts,DC=example,DC=com" {
+		t.Fatalf("unexpected dn %q", entry.DN)
+	}
+	passwordLastSet, err := devClient.GetPasswordLastSet(adConf, "app@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !passwordLastSet.IsZero() {
+		t.Fatalf("expected the password to have never been set but it was set at %s", passwordLastSet)
+	}
+	if err := devClient.UpdatePassword(adConf, "app@example.com", "pa$$w0rd"); err != nil {
+		t.Fatal(err)
+	}
+	passwordLastSet, err = devClient.GetPasswordLastSet(adConf, "app@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if passwordLastSet.IsZero() {
+		t.Fatal("expected the password's last set time to be recorded")
+	}
+	entry, err = devClient.Get(adConf, "app@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entry.GetJoined(client.FieldRegistry.PasswordLastSet); !ok {
+		t.Fatal("expected the entry to include pwdLastSet")
+	}
+}
+
+func TestDevModeRequiresTag(t *testing.T) {
+	if devModeAvailable {
+		t.Skip("dev mode is available in this build")
+	}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configPath,
+		Storage:   &logical.InmemStorage{},
+	}
+	fieldData := &framework.FieldData{
+		Schema: testBackend.pathConfig().Fields,
+		Raw: map[string]interface{}{
+			"binddn":   "tester",
+			"password": "pa$$w0rd",
+			"urls":     "ldap://138.91.247.105",
+			"userdn":   "example,com",
+			"dev_mode": true,
+		},
+	}
+	if _, err := testBackend.configUpdateOperation(ctx, req, fieldData); err == nil {
+		t.Fatal("expected an error because dev mode isn't available in this build")
+	}
+}
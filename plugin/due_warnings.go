@@ -0,0 +1,91 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// expiringSoon reports whether the check-out is due within the config's
+// due_warning_window of now.
+func (c *CheckOut) expiringSoon(engineConf *configuration, now time.Time) bool {
+	if c.IsAvailable || c.DueAt.IsZero() || engineConf.DueWarningWindow <= 0 {
+		return false
+	}
+	window := time.Duration(engineConf.DueWarningWindow) * time.Second
+	return now.Before(c.DueAt) && !now.Before(c.DueAt.Add(-window))
+}
+
+// warnDueCheckOuts warns the borrowers of library check-outs that are expiring
+// soon, once per due time, so they can renew them before they're checked in and
+// their passwords are rotated.
+func (b *backend) warnDueCheckOuts(ctx context.Context, storage logical.Storage) error {
+	engineConf, err := readConfig(ctx, storage)
+	if err != nil {
+		return err
+	}
+	if engineConf == nil || engineConf.DueWarningWindow <= 0 {
+		return nil
+	}
+	setNames, err := storage.List(ctx, libraryPrefix)
+	if err != nil {
+		return err
+	}
+	for _, setName := range setNames {
+		if strings.HasSuffix(setName, "/") {
+			continue
+		}
+		if err := b.warnDueSetCheckOuts(ctx, storage, engineConf, setName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *backend) warnDueSetCheckOuts(ctx context.Context, storage logical.Storage, engineConf *configuration, setName string) error {
+	lock := locksutil.LockForKey(b.checkOutLocks, setName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	set, err := readSet(ctx, storage, setName)
+	if err != nil {
+		return err
+	}
+	if set == nil {
+		return nil
+	}
+	now := b.now()
+	for _, serviceAccountName := range set.ServiceAccountNames {
+		checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, storage, serviceAccountName)
+		if err != nil {
+			if err == errNotFound {
+				continue
+			}
+			return err
+		}
+		if checkOut.DueWarningSent || !checkOut.expiringSoon(engineConf, now) {
+			continue
+		}
+		checkOut.DueWarningSent = true
+		if err := b.checkOutHandler.Update(ctx, storage, serviceAccountName, checkOut); err != nil {
+			return err
+		}
+		b.Logger().Warn("check-out is expiring soon", "set", setName, "service_account_name", serviceAccountName, "due_at", checkOut.DueAt, "borrower_entity_id", checkOut.BorrowerEntityID)
+		metrics.IncrCounterWithLabels([]string{"active directory", "check-out", "expiring soon"}, 1, []metrics.Label{{Name: "set", Value: setName}})
+		b.notifyWebhook(ctx, storage, webhookEventCheckOutExpiring, map[string]interface{}{
+			"set_name":             setName,
+			"service_account_name": serviceAccountName,
+			"checkout_id":          checkOut.ID,
+			"entity_id":            checkOut.BorrowerEntityID,
+			"due_at":               checkOut.DueAt,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestDueWarnings(t *testing.T) {
+	var mu sync.Mutex
+	var events []*webhookEvent
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := &webhookEvent{}
+		if err := json.NewDecoder(r.Body).Decode(event); err != nil {
+			t.Error(err)
+			return
+		}
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	conf := testConfig()
+	conf.WebhookURL = server.URL
+	conf.DueWarningWindow = 30
+	b, storage := getBackend(t, newMemoryDirectory(), conf)
+	b.webhookClient = server.Client()
+	now := time.Now().Add(time.Hour)
+	b.now = func() time.Time { return now }
+	handle := succeedingRequester(t, b, storage, "")
+	expiringSoon := func() interface{} {
+		t.Helper()
+		resp := handle(logical.ReadOperation, libraryPrefix+"lib/status", nil)
+		return resp.Data["a@example.com"].(map[string]interface{})["expiring_soon"]
+	}
+	warn := func() {
+		t.Helper()
+		if err := b.periodicFunc(ctx, &logical.Request{Storage: storage}); err != nil {
+			t.Fatal(err)
+		}
+		b.bgWG.Wait()
+	}
+
+	handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com"},
+		"ttl":                   60,
+	})
+	checkOut := handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil)
+
+	// It's not due within the window yet.
+	now = now.Add(10 * time.Second)
+	warn()
+	if expiringSoon() != false {
+		t.Fatal("expected the check-out not to be expiring soon yet")
+	}
+
+	// Once it is, the borrower is warned only once.
+	now = now.Add(25 * time.Second)
+	warn()
+	warn()
+	if expiringSoon() != true {
+		t.Fatal("expected the check-out to be expiring soon")
+	}
+	mu.Lock()
+	if len(events) != 2 || events[1].Type != webhookEventCheckOutExpiring || events[1].Data["checkout_id"] != checkOut.Data["checkout_id"] {
+		t.Fatalf("expected a check-out and a single expiring warning but received %#v", events)
+	}
+	mu.Unlock()
+
+	// Renewing it moves the due time, so it'll be warned about again.
+	renewed, err := b.renewCheckOut(ctx, &logical.Request{Storage: storage, Secret: checkOut.Secret}, nil)
+	if err != nil || renewed.IsError() {
+		t.Fatalf("unexpected error: %#v, %v", renewed, err)
+	}
+	if expiringSoon() != false {
+		t.Fatal("expected the renewed check-out not to be expiring soon")
+	}
+	loaded, err := b.checkOutHandler.LoadCheckOut(ctx, storage, "a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.DueWarningSent || !loaded.DueAt.Equal(now.Add(renewed.Secret.TTL).UTC()) {
+		t.Fatalf("expected the renewal to reset the warning but received %#v", loaded)
+	}
+}
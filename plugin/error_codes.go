@@ -0,0 +1,83 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"errors"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/util"
+)
+
+// errorCode identifies the kind of failure behind an error response, so clients
+// can branch on it instead of matching the message. Codes are part of the API
+// and must not change once released.
+type errorCode string
+
+const (
+	errCodeInvalidRequest         errorCode = "AD_INVALID_REQUEST"
+	errCodeSetNotFound            errorCode = "AD_SET_NOT_FOUND"
+	errCodeAccountNotFound        errorCode = "AD_ACCOUNT_NOT_FOUND"
+	errCodeAccountAlreadyManaged  errorCode = "AD_ACCOUNT_ALREADY_MANAGED"
+	errCodeBindAccount            errorCode = "AD_BIND_ACCOUNT"
+	errCodePasswordRejected       errorCode = "AD_PASSWORD_REJECTED"
+	errCodeAlreadyCheckedOut      errorCode = "AD_ALREADY_CHECKED_OUT"
+	errCodeAlreadyCheckedIn       errorCode = "AD_ALREADY_CHECKED_IN"
+	errCodeNoAccountsAvailable    errorCode = "AD_NO_ACCOUNTS_AVAILABLE"
+	errCodeNotCheckedOutByCaller  errorCode = "AD_NOT_CHECKED_OUT_BY_CALLER"
+	errCodeEntityRequired         errorCode = "AD_ENTITY_REQUIRED"
+	errCodeApprovalNotFound       errorCode = "AD_APPROVAL_NOT_FOUND"
+	errCodeApprovalPending        errorCode = "AD_APPROVAL_PENDING"
+	errCodeApprovalWrongRequester errorCode = "AD_APPROVAL_WRONG_REQUESTER"
+	errCodeSelfApproval           errorCode = "AD_SELF_APPROVAL"
+	errCodeGroupNotFound          errorCode = "AD_GROUP_NOT_FOUND"
+	errCodePrivilegedAccount      errorCode = "AD_PRIVILEGED_ACCOUNT"
+	errCodeWrappingRequired       errorCode = "AD_WRAPPING_REQUIRED"
+	errCodeRotationPaused         errorCode = "AD_ROTATION_PAUSED"
+	errCodeProviderRestriction    errorCode = "AD_PROVIDER_RESTRICTION"
+	errCodeRoleDisabled           errorCode = "AD_ROLE_DISABLED"
+	errCodeCheckOutNotFound       errorCode = "AD_CHECKOUT_NOT_FOUND"
+	errCodeAlreadyMember          errorCode = "AD_ALREADY_MEMBER"
+	errCodeLAPSPasswordNotFound   errorCode = "AD_LAPS_PASSWORD_NOT_FOUND"
+	errCodeNetworkMismatch        errorCode = "AD_NETWORK_MISMATCH"
+	errCodeAccountQuarantined     errorCode = "AD_ACCOUNT_QUARANTINED"
+	errCodeConnectionFailed       errorCode = "AD_CONNECTION_FAILED"
+	errCodeRotationDisabled       errorCode = "AD_ROTATION_DISABLED"
+	errCodeMinPasswordAge         errorCode = "AD_MIN_PASSWORD_AGE"
+)
+
+// codedErrorResponse returns an error response that also carries an error_code.
+// Vault returns it to clients as {"errors": [message], "data": {"error_code": code}}.
+func codedErrorResponse(code errorCode, format string, args ...interface{}) *logical.Response {
+	resp := logical.ErrorResponse(format, args...)
+	resp.Data["data"] = map[string]interface{}{
+		"error_code": string(code),
+	}
+	return resp
+}
+
+// errorResponseFor converts errors from AD that callers can act on into coded
+// error responses. Any other error is returned as is.
+func errorResponseFor(err error) (*logical.Response, error) {
+	var notFound *util.AccountNotFoundError
+	var paused *rotationPausedError
+	var tooYoung *minPasswordAgeError
+	switch {
+	case errors.As(err, &notFound):
+		return codedErrorResponse(errCodeAccountNotFound, "%s", err), nil
+	case errors.As(err, &paused):
+		return codedErrorResponse(errCodeRotationPaused, "%s", err), nil
+	case errors.As(err, &tooYoung):
+		return codedErrorResponse(errCodeMinPasswordAge, "%s", err), nil
+	case errors.Is(err, errRotationDisabled):
+		return codedErrorResponse(errCodeRotationDisabled, "%s", err), nil
+	case ldap.IsErrorAnyOf(err, ldap.LDAPResultConstraintViolation, ldap.LDAPResultUnwillingToPerform):
+		// AD rejects passwords that don't meet its complexity, length, or history requirements.
+		return codedErrorResponse(errCodePasswordRejected, "%s", err), nil
+	default:
+		return nil, err
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/util"
+)
+
+func TestErrorResponseFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode errorCode
+	}{
+		{
+			"account not found",
+			fmt.Errorf("unable to rotate: %w", &util.AccountNotFoundError{ServiceAccountName: "app@example.com"}),
+			errCodeAccountNotFound,
+		},
+		{
+			"password rejected",
+			ldap.NewError(ldap.LDAPResultConstraintViolation, errors.New("0000052D: Constraint violation")),
+			errCodePasswordRejected,
+		},
+		{
+			"other error",
+			errors.New("connection refused"),
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := errorResponseFor(tt.err)
+			if tt.wantCode == "" {
+				if resp != nil || err != tt.err {
+					t.Fatalf("expected the error to be returned as is but received resp %#v and err %v", resp, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !resp.IsError() {
+				t.Fatalf("expected an error response but received %#v", resp)
+			}
+			if code := resp.Data["data"].(map[string]interface{})["error_code"]; code != string(tt.wantCode) {
+				t.Fatalf("expected error code %q but received %q", tt.wantCode, code)
+			}
+		})
+	}
+}
+
+func TestCodedErrorResponse(t *testing.T) {
+	resp, err := testBackend.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      libraryPrefix + "missing/check-out",
+		Storage:   &logical.InmemStorage{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.IsError() {
+		t.Fatalf("expected an error response but received %#v", resp)
+	}
+	if resp.Error().Error() != `"missing" doesn't exist` {
+		t.Fatalf("unexpected error message %q", resp.Error())
+	}
+	if code := resp.Data["data"].(map[string]interface{})["error_code"]; code != string(errCodeSetNotFound) {
+		t.Fatalf("expected error code %q but received %q", errCodeSetNotFound, code)
+	}
+}
@@ -0,0 +1,10 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !boringcrypto
+
+package plugin
+
+// fipsModeAvailable reports whether this build uses a FIPS 140-2 validated
+// crypto module, which fips_mode requires.
+var fipsModeAvailable = func() bool { return false }
@@ -0,0 +1,12 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build boringcrypto
+
+package plugin
+
+import "crypto/boring"
+
+// fipsModeAvailable reports whether this build uses a FIPS 140-2 validated
+// crypto module, which fips_mode requires.
+var fipsModeAvailable = boring.Enabled
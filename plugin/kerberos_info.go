@@ -0,0 +1,128 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// maxNetBIOSDomainLength is the longest NetBIOS domain name AD allows.
+const maxNetBIOSDomainLength = 15
+
+// kerberosInfo is what a consumer needs to use a service account's password
+// with Kerberos, like in a krb5.conf or to kinit.
+type kerberosInfo struct {
+	Realm         string
+	NetBIOSDomain string
+	KDCs          []string
+	Principal     string
+}
+
+// addKerberosInfo adds the service account's Kerberos realm, NetBIOS domain,
+// principal, and KDCs to the response if the config asks for them. Like
+// addAccountIDs, the response's data is copied rather than changed, and if the
+// realm can't be found, the password is still returned with a warning.
+func (b *backend) addKerberosInfo(engineConf *configuration, serviceAccountName string, resp *logical.Response) {
+	if !engineConf.IncludeKerberosInfo || resp == nil || resp.Data == nil {
+		return
+	}
+	info, err := b.kerberosInfo(engineConf, serviceAccountName)
+	if err != nil {
+		b.Logger().Warn("unable to find Kerberos info", "service_account_name", serviceAccountName, "error", err)
+		resp.AddWarning(fmt.Sprintf("unable to find the Kerberos realm of %q: %s", serviceAccountName, err))
+		return
+	}
+	data := make(map[string]interface{}, len(resp.Data)+4)
+	for k, v := range resp.Data {
+		data[k] = v
+	}
+	data["kerberos_realm"] = info.Realm
+	data["kerberos_principal"] = info.Principal
+	data["netbios_domain"] = info.NetBIOSDomain
+	data["kdcs"] = info.KDCs
+	resp.Data = data
+}
+
+// kerberosInfo returns the Kerberos info of the service account. What's set in
+// the config is used as is, and the rest is discovered: the realm from the
+// domain components of the account's DN, the NetBIOS domain from the realm's
+// first label as AD names it by default, and the KDCs from the hosts of the
+// domain controllers the config connects to.
+func (b *backend) kerberosInfo(engineConf *configuration, serviceAccountName string) (*kerberosInfo, error) {
+	info := &kerberosInfo{
+		Realm:         engineConf.KerberosRealm,
+		NetBIOSDomain: engineConf.NetBIOSDomain,
+		KDCs:          engineConf.KDCs,
+	}
+	if info.Realm == "" {
+		entry, err := b.client.Get(engineConf.ADConf, serviceAccountName)
+		if err != nil {
+			return nil, err
+		}
+		realm, err := realmFromDN(entry.DN)
+		if err != nil {
+			return nil, err
+		}
+		info.Realm = realm
+	}
+	if info.NetBIOSDomain == "" {
+		info.NetBIOSDomain = strings.SplitN(info.Realm, ".", 2)[0]
+		if len(info.NetBIOSDomain) > maxNetBIOSDomainLength {
+			info.NetBIOSDomain = info.NetBIOSDomain[:maxNetBIOSDomainLength]
+		}
+	}
+	if len(info.KDCs) == 0 && engineConf.ADConf != nil && engineConf.ADConf.ConfigEntry != nil {
+		// Discovered domain controllers aren't listed, since Kerberos clients can
+		// find the KDCs in DNS the same way.
+		if adConf := engineConf.ADConf.ForAccount(serviceAccountName); !adConf.DiscoverDC {
+			info.KDCs = kdcsFromURLs(adConf.Url)
+		}
+	}
+	username, err := getUsername(serviceAccountName)
+	if err != nil {
+		return nil, err
+	}
+	info.Principal = username + "@" + info.Realm
+	return info, nil
+}
+
+// realmFromDN returns the Kerberos realm of the domain an entry is in, which
+// is its DN's domain components joined with dots and uppercased.
+func realmFromDN(dn string) (string, error) {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return "", err
+	}
+	var labels []string
+	for _, rdn := range parsed.RDNs {
+		for _, attr := range rdn.Attributes {
+			if strings.EqualFold(attr.Type, "dc") {
+				labels = append(labels, attr.Value)
+			}
+		}
+	}
+	if len(labels) == 0 {
+		return "", fmt.Errorf("%q has no domain components", dn)
+	}
+	return strings.ToUpper(strings.Join(labels, ".")), nil
+}
+
+// kdcsFromURLs returns the hosts of a comma-separated list of LDAP URLs. In AD,
+// every domain controller is also a KDC.
+func kdcsFromURLs(urls string) []string {
+	var kdcs []string
+	for _, rawURL := range strings.Split(urls, ",") {
+		u, err := url.Parse(strings.TrimSpace(rawURL))
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		kdcs = append(kdcs, u.Hostname())
+	}
+	return kdcs
+}
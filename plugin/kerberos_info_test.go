@@ -0,0 +1,75 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestKerberosInfo(t *testing.T) {
+	conf := testConfig()
+	conf.ADConf.Url = "ldaps://dc1.corp.example.com,ldaps://dc2.corp.example.com:636"
+	conf.ADConf.UserDN = "OU=Service Accounts,DC=corp,DC=example,DC=com"
+	b, storage := getBackend(t, newMemoryDirectory(), conf)
+	handle := succeedingRequester(t, b, storage, "")
+
+	handle(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@corp.example.com",
+	})
+	handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"borrowed@corp.example.com"},
+	})
+
+	if resp := handle(logical.ReadOperation, credPrefix+"app", nil); resp.Data["kerberos_realm"] != nil {
+		t.Fatalf("expected no Kerberos info unless it's asked for but received %#v", resp.Data)
+	}
+
+	// Everything is discovered unless it's configured.
+	conf.IncludeKerberosInfo = true
+	if err := writeConfig(ctx, storage, conf); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		resp      *logical.Response
+		principal string
+	}{
+		{handle(logical.ReadOperation, credPrefix+"app", nil), "app@CORP.EXAMPLE.COM"},
+		{handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil), "borrowed@CORP.EXAMPLE.COM"},
+	} {
+		if tt.resp.Data["kerberos_realm"] != "CORP.EXAMPLE.COM" || tt.resp.Data["netbios_domain"] != "CORP" || tt.resp.Data["kerberos_principal"] != tt.principal {
+			t.Fatalf("unexpected Kerberos info in %#v", tt.resp.Data)
+		}
+		if kdcs := tt.resp.Data["kdcs"]; !reflect.DeepEqual(kdcs, []string{"dc1.corp.example.com", "dc2.corp.example.com"}) {
+			t.Fatalf("unexpected kdcs %#v", kdcs)
+		}
+	}
+
+	conf.KerberosRealm = "EXAMPLE.COM"
+	conf.NetBIOSDomain = "EXAMPLE"
+	conf.KDCs = []string{"kdc.example.com"}
+	if err := writeConfig(ctx, storage, conf); err != nil {
+		t.Fatal(err)
+	}
+	resp := handle(logical.ReadOperation, credPrefix+"app", nil)
+	if resp.Data["kerberos_realm"] != "EXAMPLE.COM" || resp.Data["netbios_domain"] != "EXAMPLE" || resp.Data["kerberos_principal"] != "app@EXAMPLE.COM" ||
+		!reflect.DeepEqual(resp.Data["kdcs"], []string{"kdc.example.com"}) {
+		t.Fatalf("expected the configured Kerberos info but received %#v", resp.Data)
+	}
+}
+
+func TestRealmFromDN(t *testing.T) {
+	realm, err := realmFromDN("CN=app,OU=Service Accounts,DC=child,DC=corp,DC=example,DC=com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if realm != "CHILD.CORP.EXAMPLE.COM" {
+		t.Fatalf("unexpected realm %q", realm)
+	}
+	if _, err := realmFromDN("CN=app,OU=Service Accounts"); err == nil {
+		t.Fatal("expected an error for a DN without domain components")
+	}
+}
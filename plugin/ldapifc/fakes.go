@@ -5,6 +5,7 @@ package ldapifc
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"reflect"
 	"time"
@@ -31,6 +32,19 @@ type FakeLDAPConnection struct {
 	ModifyRequestToExpect *ldap.ModifyRequest
 	SearchRequestToExpect *ldap.SearchRequest
 	SearchResultToReturn  *ldap.SearchResult
+
+	// Encrypted is whether the connection reports it's using TLS, and
+	// PeerCertificates are the certificates it reports the server presented.
+	Encrypted        bool
+	PeerCertificates []*x509.Certificate
+
+	// ExternallyBound is whether the connection was bound with SASL EXTERNAL.
+	ExternallyBound bool
+
+	// GSSAPIServicePrincipal is the service principal the connection was bound
+	// to with SASL GSSAPI, if it was.
+	GSSAPIServicePrincipal string
+	GSSAPIClient           ldap.GSSAPIClient
 }
 
 func (f *FakeLDAPConnection) Add(addRequest *ldap.AddRequest) error {
@@ -45,6 +59,17 @@ func (f *FakeLDAPConnection) Bind(username, password string) error {
 	return nil
 }
 
+func (f *FakeLDAPConnection) ExternalBind() error {
+	f.ExternallyBound = true
+	return nil
+}
+
+func (f *FakeLDAPConnection) GSSAPIBind(client ldap.GSSAPIClient, servicePrincipal, authzid string) error {
+	f.GSSAPIServicePrincipal = servicePrincipal
+	f.GSSAPIClient = client
+	return nil
+}
+
 func (f *FakeLDAPConnection) Close() error {
 	return nil
 }
@@ -75,6 +100,10 @@ func (f *FakeLDAPConnection) StartTLS(config *tls.Config) error {
 
 func (f *FakeLDAPConnection) SetTimeout(timeout time.Duration) {}
 
+func (f *FakeLDAPConnection) TLSConnectionState() (tls.ConnectionState, bool) {
+	return tls.ConnectionState{PeerCertificates: f.PeerCertificates}, f.Encrypted
+}
+
 func (f *FakeLDAPConnection) UnauthenticatedBind(username string) error {
 	return nil
 }
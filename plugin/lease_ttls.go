@@ -0,0 +1,95 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+)
+
+// leaseTTLs returns the ttl and max_ttl a lease is actually given for a library
+// set's or role's configured ones. A max_ttl of 0 doesn't mean leases can be
+// renewed forever, but that they're limited by the mount's max lease TTL, which
+// Vault would enforce anyway. Likewise, a ttl of 0 means the mount's default
+// lease TTL. The ttl is capped at the max_ttl, so a lease never outlasts it.
+func (b *backend) leaseTTLs(ttl, maxTTL time.Duration) (time.Duration, time.Duration) {
+	systemMaxTTL := b.System().MaxLeaseTTL()
+	if maxTTL <= 0 || (systemMaxTTL > 0 && maxTTL > systemMaxTTL) {
+		maxTTL = systemMaxTTL
+	}
+	if ttl <= 0 {
+		ttl = b.System().DefaultLeaseTTL()
+	}
+	if maxTTL > 0 && ttl > maxTTL {
+		ttl = maxTTL
+	}
+	return ttl, maxTTL
+}
+
+// validateLeaseTTLs checks a library set's or role's ttl and max_ttl when they're
+// written, rather than leaving leases to be quietly capped when they're issued.
+// Only the fields sent in the request are checked against the mount's max lease
+// TTL, because the mount can be tuned after they were written.
+func (b *backend) validateLeaseTTLs(fieldData *framework.FieldData, ttl, maxTTL time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("ttl (%s) can't be negative", ttl)
+	}
+	if maxTTL < 0 {
+		return fmt.Errorf("max_ttl (%s) can't be negative", maxTTL)
+	}
+	if maxTTL > 0 && ttl > maxTTL {
+		return fmt.Errorf("ttl (%s) can't be longer than max_ttl (%s), please lower ttl or raise max_ttl", ttl, maxTTL)
+	}
+	systemMaxTTL := b.System().MaxLeaseTTL()
+	if systemMaxTTL <= 0 {
+		return nil
+	}
+	if _, ok := fieldData.GetOk("max_ttl"); ok && maxTTL > systemMaxTTL {
+		return fmt.Errorf("max_ttl (%s) can't be longer than the mount's max lease TTL (%s), please lower max_ttl or tune the mount's max_lease_ttl", maxTTL, systemMaxTTL)
+	}
+	if _, ok := fieldData.GetOk("ttl"); ok && ttl > systemMaxTTL {
+		return fmt.Errorf("ttl (%s) can't be longer than the mount's max lease TTL (%s), please lower ttl or tune the mount's max_lease_ttl", ttl, systemMaxTTL)
+	}
+	return nil
+}
+
+// validateLibraryTTLs checks a library set's ttl and max_ttl against the config's
+// library_max_ttl when they're written. Like validateLeaseTTLs, only the fields
+// sent in the request are checked, because the config can change after.
+func validateLibraryTTLs(fieldData *framework.FieldData, engineConf *configuration, ttl, maxTTL time.Duration) error {
+	if engineConf == nil || engineConf.LibraryMaxTTL <= 0 {
+		return nil
+	}
+	libraryMaxTTL := time.Duration(engineConf.LibraryMaxTTL) * time.Second
+	if _, ok := fieldData.GetOk("max_ttl"); ok && maxTTL > libraryMaxTTL {
+		return fmt.Errorf("max_ttl (%s) can't be longer than the config's library_max_ttl (%s)", maxTTL, libraryMaxTTL)
+	}
+	if _, ok := fieldData.GetOk("ttl"); ok && ttl > libraryMaxTTL {
+		return fmt.Errorf("ttl (%s) can't be longer than the config's library_max_ttl (%s)", ttl, libraryMaxTTL)
+	}
+	return nil
+}
+
+// addEffectiveTTLs adds the ttl and max_ttl leases are actually given to the
+// response data of a read.
+func (b *backend) addEffectiveTTLs(data map[string]interface{}, ttl, maxTTL time.Duration) {
+	ttl, maxTTL = b.leaseTTLs(ttl, maxTTL)
+	data["effective_ttl"] = int64(ttl.Seconds())
+	data["effective_max_ttl"] = int64(maxTTL.Seconds())
+}
+
+// effectiveTTLResponseFields describes the fields added by addEffectiveTTLs.
+func effectiveTTLResponseFields(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["effective_ttl"] = &framework.FieldSchema{
+		Type:        framework.TypeDurationSecond,
+		Description: "In seconds, the ttl leases are given once the mount's limits are applied.",
+	}
+	fields["effective_max_ttl"] = &framework.FieldSchema{
+		Type:        framework.TypeDurationSecond,
+		Description: "In seconds, the max_ttl leases are given once the mount's limits are applied.",
+	}
+	return fields
+}
@@ -0,0 +1,134 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestLeaseTTLs(t *testing.T) {
+	b, _ := getBackendWithSystemView(t, &fakeSecretsClient{}, nil, &logical.StaticSystemView{
+		DefaultLeaseTTLVal: time.Hour,
+		MaxLeaseTTLVal:     24 * time.Hour,
+	})
+
+	for _, tc := range []struct {
+		name           string
+		ttl, maxTTL    time.Duration
+		expectedTTL    time.Duration
+		expectedMaxTTL time.Duration
+	}{
+		{"configured", 2 * time.Hour, 4 * time.Hour, 2 * time.Hour, 4 * time.Hour},
+		{"no max_ttl", 2 * time.Hour, 0, 2 * time.Hour, 24 * time.Hour},
+		{"no ttl", 0, 4 * time.Hour, time.Hour, 4 * time.Hour},
+		{"neither", 0, 0, time.Hour, 24 * time.Hour},
+		{"ttl over max_ttl", 8 * time.Hour, 4 * time.Hour, 4 * time.Hour, 4 * time.Hour},
+		{"over the mount's max", 48 * time.Hour, 72 * time.Hour, 24 * time.Hour, 24 * time.Hour},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ttl, maxTTL := b.leaseTTLs(tc.ttl, tc.maxTTL)
+			if ttl != tc.expectedTTL || maxTTL != tc.expectedMaxTTL {
+				t.Fatalf("expected %s and %s but received %s and %s", tc.expectedTTL, tc.expectedMaxTTL, ttl, maxTTL)
+			}
+		})
+	}
+}
+
+func TestLeaseTTLs_Set(t *testing.T) {
+	b, storage := getBackendWithSystemView(t, &fakeSecretsClient{}, testConfig(), &logical.StaticSystemView{
+		DefaultLeaseTTLVal: time.Hour,
+		MaxLeaseTTLVal:     24 * time.Hour,
+	})
+	handle := succeedingRequester(t, b, storage, "")
+
+	handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"lib@example.com"},
+		"ttl":                   0,
+		"max_ttl":               0,
+	})
+	resp := handle(logical.ReadOperation, libraryPrefix+"lib", nil)
+	if resp.Data["max_ttl"] != int64(0) || resp.Data["effective_max_ttl"] != int64(24*60*60) {
+		t.Fatalf("expected the mount's max lease TTL to be effective but received %#v", resp.Data)
+	}
+	if resp.Data["effective_ttl"] != int64(60*60) {
+		t.Fatalf("expected the mount's default lease TTL to be effective but received %#v", resp.Data)
+	}
+
+	// A requested ttl longer than the effective max_ttl is capped.
+	resp = handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", map[string]interface{}{
+		"ttl": 48 * 60 * 60,
+	})
+	if resp.Secret.TTL != 24*time.Hour || resp.Secret.MaxTTL != 24*time.Hour {
+		t.Fatalf("expected the lease to be capped at the mount's max lease TTL but received %s and %s", resp.Secret.TTL, resp.Secret.MaxTTL)
+	}
+
+	// Renewals are capped the same way.
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   storage,
+		Secret:    resp.Secret,
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("unable to renew: %#v, %v", resp, err)
+	}
+	if resp.Secret.TTL != time.Hour || resp.Secret.MaxTTL != 24*time.Hour {
+		t.Fatalf("expected the renewal to use the effective ttls but received %s and %s", resp.Secret.TTL, resp.Secret.MaxTTL)
+	}
+}
+
+func TestValidateLeaseTTLs(t *testing.T) {
+	b, storage := getBackendWithSystemView(t, &fakeSecretsClient{}, testConfig(), &logical.StaticSystemView{
+		DefaultLeaseTTLVal: time.Hour,
+		MaxLeaseTTLVal:     24 * time.Hour,
+	})
+	handle := requester(t, b, storage, "")
+
+	for _, tc := range []struct {
+		name     string
+		data     map[string]interface{}
+		expected string
+	}{
+		{"ttl over max_ttl", map[string]interface{}{"ttl": "2h", "max_ttl": "1h"}, "ttl (2h0m0s) can't be longer than max_ttl (1h0m0s)"},
+		{"max_ttl over the mount's max", map[string]interface{}{"ttl": "1h", "max_ttl": "48h"}, "max_ttl (48h0m0s) can't be longer than the mount's max lease TTL (24h0m0s)"},
+		{"ttl over the mount's max", map[string]interface{}{"ttl": "48h", "max_ttl": 0}, "ttl (48h0m0s) can't be longer than the mount's max lease TTL (24h0m0s)"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, write := range []struct {
+				operation logical.Operation
+				path      string
+				data      map[string]interface{}
+			}{
+				{logical.CreateOperation, libraryPrefix + "lib", map[string]interface{}{
+					"service_account_names": []string{"lib@example.com"},
+				}},
+				{logical.UpdateOperation, groupMembershipRolePrefix + "group", map[string]interface{}{
+					"group_dn":         "CN=Admins,DC=example,DC=com",
+					"allowed_accounts": []string{"*@example.com"},
+				}},
+			} {
+				for k, v := range tc.data {
+					write.data[k] = v
+				}
+				resp := handle(write.operation, write.path, write.data)
+				if resp == nil || !resp.IsError() {
+					t.Fatalf("expected %s to be rejected but received %#v", write.path, resp)
+				}
+				if errMsg := resp.Error().Error(); !strings.Contains(errMsg, tc.expected) {
+					t.Fatalf("expected the error for %s to contain %q but received %q", write.path, tc.expected, errMsg)
+				}
+			}
+		})
+	}
+
+	// The set's default ttls aren't sent, so they're capped rather than rejected.
+	if resp := handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"lib@example.com"},
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to create set: %#v", resp)
+	}
+}
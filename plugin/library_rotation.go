@@ -0,0 +1,99 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// rotateIdleLibraryAccounts rotates the passwords of checked-in service accounts
+// that are older than their set's max_password_age, so accounts that are rarely
+// borrowed don't keep the same password indefinitely.
+func (b *backend) rotateIdleLibraryAccounts(ctx context.Context, storage logical.Storage) error {
+	setNames, err := storage.List(ctx, libraryPrefix)
+	if err != nil {
+		return err
+	}
+	for _, setName := range setNames {
+		if strings.HasSuffix(setName, "/") {
+			continue
+		}
+		if err := b.rotateIdleSetAccounts(ctx, storage, setName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *backend) rotateIdleSetAccounts(ctx context.Context, storage logical.Storage, setName string) error {
+	set, err := readSet(ctx, storage, setName)
+	if err != nil {
+		return err
+	}
+	if set == nil || set.MaxPasswordAge <= 0 {
+		return nil
+	}
+	engineConf, err := readConfig(ctx, storage)
+	if err != nil {
+		return err
+	}
+	for _, serviceAccountName := range set.ServiceAccountNames {
+		checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, storage, serviceAccountName)
+		if err != nil {
+			if err == errNotFound {
+				continue
+			}
+			return err
+		}
+		idle, err := b.idle(ctx, storage, set, serviceAccountName, checkOut)
+		if err != nil {
+			return err
+		}
+		if !idle {
+			continue
+		}
+		// The rate limit is waited for before the set is locked, so check-outs
+		// and check-ins from it aren't held up.
+		if err := b.checkOutHandler.throttle(ctx, engineConf); err != nil {
+			return err
+		}
+		var lookupErr error
+		rotated, err := b.rotateSetAccount(ctx, storage, setName, serviceAccountName, func(set *librarySet, checkOut *CheckOut) bool {
+			idle, err := b.idle(ctx, storage, set, serviceAccountName, checkOut)
+			lookupErr = err
+			return idle
+		})
+		if lookupErr != nil {
+			return lookupErr
+		}
+		if err != nil {
+			// Keep going so one failing account doesn't hold back the rest.
+			b.Logger().Error("unable to rotate idle service account", "set", setName, "service_account_name", serviceAccountName, "error", err)
+			continue
+		}
+		if rotated {
+			b.Logger().Info("rotated idle service account", "set", setName, "service_account_name", serviceAccountName)
+		}
+	}
+	return nil
+}
+
+// idle reports whether a checked-in service account's password is older than
+// its set's max_password_age.
+func (b *backend) idle(ctx context.Context, storage logical.Storage, set *librarySet, serviceAccountName string, checkOut *CheckOut) (bool, error) {
+	if set.MaxPasswordAge <= 0 || !checkOut.IsAvailable {
+		// A checked-out account is rotated when it's checked in.
+		return false, nil
+	}
+	stored, err := loadPasswordMetadata(ctx, storage, serviceAccountName)
+	if err != nil && err != errNotFound {
+		return false, err
+	}
+	// Passwords stored before rotation times were tracked have a zero LastRotated,
+	// so their age is unknown and they're rotated too.
+	return stored == nil || !b.now().Before(stored.LastRotated.Add(set.MaxPasswordAge)), nil
+}
@@ -0,0 +1,59 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestRotateIdleLibraryAccounts(t *testing.T) {
+	b, storage := getBackend(t, &fakeSecretsClient{}, testConfig())
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	b.checkOutHandler.now = b.now
+	succeedingRequester(t, b, storage, "")(logical.CreateOperation, libraryPrefix+"idle", map[string]interface{}{
+		"service_account_names": []string{"tester1@example.com", "tester2@example.com"},
+		"max_password_age":      "1h",
+	})
+	if err := b.checkOutHandler.CheckOut(ctx, storage, "tester2@example.com", &CheckOut{}); err != nil {
+		t.Fatal(err)
+	}
+	passwords := make(map[string]string)
+	for _, serviceAccountName := range []string{"tester1@example.com", "tester2@example.com"} {
+		password, err := retrievePassword(ctx, storage, b.transit, serviceAccountName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		passwords[serviceAccountName] = password
+	}
+
+	// Nothing is old enough to rotate yet.
+	if err := b.rotateIdleLibraryAccounts(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+	if password, _ := retrievePassword(ctx, storage, b.transit, "tester1@example.com"); password != passwords["tester1@example.com"] {
+		t.Fatal("expected a fresh password to be left alone")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if err := b.rotateIdleLibraryAccounts(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+	if password, _ := retrievePassword(ctx, storage, b.transit, "tester1@example.com"); password == passwords["tester1@example.com"] {
+		t.Fatal("expected the idle account's password to be rotated")
+	}
+	if password, _ := retrievePassword(ctx, storage, b.transit, "tester2@example.com"); password != passwords["tester2@example.com"] {
+		t.Fatal("expected the checked out account's password to be left alone")
+	}
+	stored, err := loadPassword(ctx, storage, b.transit, "tester1@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.LastRotated.Equal(now.UTC()) {
+		t.Fatalf("expected the rotation to be recorded at %s but it was recorded at %s", now.UTC(), stored.LastRotated)
+	}
+}
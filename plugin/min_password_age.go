@@ -0,0 +1,51 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"fmt"
+	"time"
+)
+
+// minPasswordAgeError is returned instead of changing a password that's younger
+// than the minimum password age AD applies to its account, which AD would
+// otherwise reject with a bare constraint violation.
+type minPasswordAgeError struct {
+	ServiceAccountName string
+	RetryAfter         time.Time
+}
+
+func (e *minPasswordAgeError) Error() string {
+	return fmt.Sprintf("minimum password age not yet elapsed for %q, retry after %s", e.ServiceAccountName, e.RetryAfter.Format(time.RFC3339))
+}
+
+// checkMinPasswordAge returns a *minPasswordAgeError if the config respects AD's
+// minimum password age and the service account's password is younger than it.
+func checkMinPasswordAge(c SecretsClient, engineConf *configuration, serviceAccountName string, now time.Time) error {
+	if !engineConf.RespectMinPasswordAge {
+		return nil
+	}
+	reader, ok := c.(MinPasswordAgeReader)
+	if !ok {
+		return nil
+	}
+	minAge, err := reader.MinPasswordAge(engineConf.ADConf, serviceAccountName)
+	if err != nil {
+		return fmt.Errorf("unable to read the minimum password age of %q: %w", serviceAccountName, err)
+	}
+	if minAge <= 0 {
+		return nil
+	}
+	lastSet, err := c.GetPasswordLastSet(engineConf.ADConf, serviceAccountName)
+	if err != nil {
+		return err
+	}
+	if lastSet.IsZero() {
+		return nil
+	}
+	if retryAfter := lastSet.Add(minAge); now.Before(retryAfter) {
+		return &minPasswordAgeError{ServiceAccountName: serviceAccountName, RetryAfter: retryAfter.UTC()}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+// minAgeDirectory applies the same minimum password age to every account.
+type minAgeDirectory struct {
+	*memoryDirectory
+	minAge time.Duration
+}
+
+func (d *minAgeDirectory) MinPasswordAge(_ *client.ADConf, _ string) (time.Duration, error) {
+	return d.minAge, nil
+}
+
+func TestRespectMinPasswordAge(t *testing.T) {
+	directory := &minAgeDirectory{memoryDirectory: newMemoryDirectory(), minAge: 24 * time.Hour}
+	conf := testConfig()
+	conf.RespectMinPasswordAge = true
+	b, storage := getBackend(t, directory, conf)
+	// AD shows passwords as set at the real time, so the fake time stays ahead
+	// of it to keep them from looking rotated outside of Vault.
+	now := time.Now().Add(time.Hour)
+	b.now = func() time.Time { return now }
+	handle := requester(t, b, storage, "")
+
+	handle(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@example.com",
+		"ttl":                  60,
+	})
+	// The password has never been set, so there's nothing to wait for.
+	first := handle(logical.ReadOperation, credPrefix+"app", nil)
+	if first.IsError() {
+		t.Fatalf("unexpected error: %#v", first)
+	}
+
+	// The ttl has passed, but AD wouldn't allow the password to be changed yet,
+	// so the current one is returned with a warning instead.
+	now = now.Add(2 * time.Minute)
+	resp := handle(logical.ReadOperation, credPrefix+"app", nil)
+	if resp.IsError() || resp.Data["current_password"] != first.Data["current_password"] {
+		t.Fatalf("expected the current password but received %#v", resp)
+	}
+	if len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "retry after") {
+		t.Fatalf("expected a warning saying when to retry but received %#v", resp.Warnings)
+	}
+	resp = handle(logical.UpdateOperation, rotateRolePath+"app", nil)
+	if resp == nil || !resp.IsError() || resp.Data["data"].(map[string]interface{})["error_code"] != string(errCodeMinPasswordAge) {
+		t.Fatalf("expected rotate-role to be refused but received %#v", resp)
+	}
+	if task, err := readRetryTask(ctx, storage, retryKindRole, "app"); err != nil || task != nil {
+		t.Fatalf("expected the rotation not to be queued for retry but received %#v, %v", task, err)
+	}
+
+	// Once the minimum age has passed, the password is rotated.
+	directory.minAge = time.Minute
+	resp = handle(logical.ReadOperation, credPrefix+"app", nil)
+	if resp.IsError() || resp.Data["current_password"] == first.Data["current_password"] {
+		t.Fatalf("expected the password to be rotated but received %#v", resp)
+	}
+}
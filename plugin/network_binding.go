@@ -0,0 +1,84 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// validateNetworkBinding checks the prefix lengths check-outs are bound with.
+// Zero is allowed because sets written before network binding existed have it,
+// and it means the full address.
+func (l *librarySet) validateNetworkBinding() error {
+	if l.IPv4PrefixLength < 0 || l.IPv4PrefixLength > 8*net.IPv4len {
+		return fmt.Errorf("ipv4_prefix_length must be between 1 and %d", 8*net.IPv4len)
+	}
+	if l.IPv6PrefixLength < 0 || l.IPv6PrefixLength > 8*net.IPv6len {
+		return fmt.Errorf("ipv6_prefix_length must be between 1 and %d", 8*net.IPv6len)
+	}
+	return nil
+}
+
+// clientNetwork returns the network the request came from as a CIDR, with the
+// set's prefix length for the client's address family.
+func (l *librarySet) clientNetwork(req *logical.Request) (string, error) {
+	ip := clientIP(req)
+	if ip == nil {
+		return "", errors.New("the client's address is unknown, so the check-out can't be bound to its network")
+	}
+	mask := net.CIDRMask(l.ipv6PrefixLength(), 8*net.IPv6len)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		mask = net.CIDRMask(l.ipv4PrefixLength(), 8*net.IPv4len)
+	}
+	network := &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+	return network.String(), nil
+}
+
+func (l *librarySet) ipv4PrefixLength() int {
+	if l.IPv4PrefixLength == 0 {
+		return 8 * net.IPv4len
+	}
+	return l.IPv4PrefixLength
+}
+
+func (l *librarySet) ipv6PrefixLength() int {
+	if l.IPv6PrefixLength == 0 {
+		return 8 * net.IPv6len
+	}
+	return l.IPv6PrefixLength
+}
+
+// fromNetwork reports whether the request came from the network the service
+// account was checked out from. Check-outs that aren't bound to a network may
+// be used from anywhere, but bound ones are refused if the client's address is
+// unknown.
+func (c *CheckOut) fromNetwork(req *logical.Request) bool {
+	if c.Network == "" {
+		return true
+	}
+	_, network, err := net.ParseCIDR(c.Network)
+	if err != nil {
+		return false
+	}
+	ip := clientIP(req)
+	return ip != nil && network.Contains(ip)
+}
+
+// clientIP returns the address the request came from, or nil if Vault didn't
+// provide it.
+func clientIP(req *logical.Request) net.IP {
+	if req.Connection == nil || req.Connection.RemoteAddr == "" {
+		return nil
+	}
+	host := req.Connection.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,98 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestNetworkBinding(t *testing.T) {
+	b, storage := getBackend(t, newMemoryDirectory(), testConfig())
+	request := func(operation logical.Operation, path string, data map[string]interface{}, remoteAddr string) *logical.Request {
+		req := &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Data:      data,
+			EntityID:  "borrower",
+		}
+		if remoteAddr != "" {
+			req.Connection = &logical.Connection{RemoteAddr: remoteAddr}
+		}
+		return req
+	}
+	handle := func(req *logical.Request) *logical.Response {
+		t.Helper()
+		return sendRequest(t, b, storage, req)
+	}
+
+	if resp := handle(request(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com"},
+		"bind_to_network":       true,
+		"ipv4_prefix_length":    24,
+	}, "")); resp != nil {
+		t.Fatalf("unable to create set: %#v", resp)
+	}
+	if resp := handle(request(logical.UpdateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"ipv6_prefix_length": 129,
+	}, "")); responseErrorCode(resp) != string(errCodeInvalidRequest) {
+		t.Fatalf("expected an invalid prefix length to be rejected but received %#v", resp)
+	}
+
+	// Without the client's address, there's no network to bind the check-out to.
+	if resp := handle(request(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil, "")); responseErrorCode(resp) != string(errCodeNetworkMismatch) {
+		t.Fatalf("expected the check-out to be refused but received %#v", resp)
+	}
+
+	checkOut := handle(request(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil, "10.0.1.5"))
+	if checkOut == nil || checkOut.IsError() {
+		t.Fatalf("unable to check out: %#v", checkOut)
+	}
+	status := handle(request(logical.ReadOperation, libraryPrefix+"lib/status", nil, "")).Data["a@example.com"].(map[string]interface{})
+	if status["network"] != "10.0.1.0/24" {
+		t.Fatalf("expected the check-out to be bound to 10.0.1.0/24 but received %#v", status)
+	}
+
+	// Vault renews the lease without the client's address, so it isn't checked.
+	req := request(logical.RenewOperation, "", nil, "")
+	req.Storage, req.Secret = storage, checkOut.Secret
+	if resp, err := b.renewCheckOut(ctx, req, nil); err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("expected the lease renewal to succeed but received %#v, %v", resp, err)
+	}
+	// The library's renew path is, though.
+	if resp := handle(request(logical.UpdateOperation, libraryPrefix+"lib/renew", nil, "10.0.2.5")); responseErrorCode(resp) != string(errCodeNetworkMismatch) {
+		t.Fatalf("expected a renewal from another network to be refused but received %#v", resp)
+	}
+	if resp := handle(request(logical.UpdateOperation, libraryPrefix+"lib/renew", nil, "10.0.1.200")); resp == nil || resp.IsError() {
+		t.Fatalf("expected a renewal from the same network to succeed but received %#v", resp)
+	}
+
+	if resp := handle(request(logical.UpdateOperation, libraryPrefix+"lib/check-in", nil, "10.0.2.5")); responseErrorCode(resp) != string(errCodeNetworkMismatch) {
+		t.Fatalf("expected a check-in from another network to be refused but received %#v", resp)
+	}
+	if resp := handle(request(logical.UpdateOperation, libraryPrefix+"lib/check-in", map[string]interface{}{
+		"service_account_names": "a@example.com",
+	}, "")); responseErrorCode(resp) != string(errCodeNetworkMismatch) {
+		t.Fatalf("expected a check-in from an unknown address to be refused but received %#v", resp)
+	}
+	// Admins can check it in from anywhere.
+	resp := handle(request(logical.UpdateOperation, libraryPrefix+"manage/lib/check-in", nil, "192.168.0.1"))
+	if resp == nil || resp.IsError() || len(resp.Data["check_ins"].([]string)) != 1 {
+		t.Fatalf("expected the forced check-in to succeed but received %#v", resp)
+	}
+
+	// IPv6 check-outs use their own prefix length.
+	handle(request(logical.UpdateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"ipv6_prefix_length": 64,
+	}, ""))
+	handle(request(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil, "[2001:db8::1]:8200"))
+	status = handle(request(logical.ReadOperation, libraryPrefix+"lib/status", nil, "")).Data["a@example.com"].(map[string]interface{})
+	if status["network"] != "2001:db8::/64" {
+		t.Fatalf("expected the check-out to be bound to 2001:db8::/64 but received %#v", status)
+	}
+	if resp := handle(request(logical.UpdateOperation, libraryPrefix+"lib/check-in", nil, "2001:db8::2")); resp == nil || resp.IsError() {
+		t.Fatalf("expected a check-in from the same network to succeed but received %#v", resp)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestNotes(t *testing.T) {
+	b, storage := getBackend(t, newMemoryDirectory(), testConfig())
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	handle := func(operation logical.Operation, path string, data map[string]interface{}, entityID string) *logical.Response {
+		t.Helper()
+		resp := sendRequest(t, b, storage, &logical.Request{
+			Operation:   operation,
+			Path:        path,
+			Data:        data,
+			EntityID:    entityID,
+			DisplayName: "root",
+		})
+		if resp != nil && resp.IsError() {
+			t.Fatalf("unexpected error: %#v", resp)
+		}
+		return resp
+	}
+
+	handle(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@example.com",
+		"notes":                "owned by the payments team",
+	}, "")
+	role := handle(logical.ReadOperation, rolePrefix+"app", nil, "").Data
+	if role["notes"] != "owned by the payments team" || role["updated_by"] != "root" || role["updated_at"] != now {
+		t.Fatalf("unexpected role %#v", role)
+	}
+
+	handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"lib@example.com"},
+		"notes":                 "break-glass accounts",
+	}, "creator")
+	now = now.Add(time.Hour)
+	// Notes are kept when a set is updated without them.
+	handle(logical.UpdateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"ttl": 60,
+	}, "updater")
+	set := handle(logical.ReadOperation, libraryPrefix+"lib", nil, "").Data
+	if set["notes"] != "break-glass accounts" || set["updated_by"] != "updater" || set["updated_at"] != now {
+		t.Fatalf("unexpected set %#v", set)
+	}
+	handle(logical.UpdateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"notes": "",
+	}, "updater")
+	if set := handle(logical.ReadOperation, libraryPrefix+"lib", nil, "").Data; set["notes"] != "" {
+		t.Fatalf("expected the notes to be cleared but received %#v", set)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/util"
+)
+
+// SecretsClient is how the backend reads and updates service accounts in AD.
+type SecretsClient interface {
+	Get(conf *client.ADConf, serviceAccountName string) (*client.Entry, error)
+	GetPasswordLastSet(conf *client.ADConf, serviceAccountName string) (time.Time, error)
+	UpdatePassword(conf *client.ADConf, serviceAccountName string, newPassword string) error
+	UpdateRootPassword(conf *client.ADConf, bindDN string, newPassword string) error
+}
+
+// GroupMembershipClient is implemented by SecretsClients that can add service
+// accounts to AD groups and remove them, which group membership leases require.
+type GroupMembershipClient interface {
+	AddGroupMember(conf *client.ADConf, groupDN string, serviceAccountName string) error
+	RemoveGroupMember(conf *client.ADConf, groupDN string, serviceAccountName string) error
+}
+
+// EntryUpdater is implemented by SecretsClients that can change fields of an
+// account's entry other than its password, which resetting a LAPS password's
+// expiration requires.
+type EntryUpdater interface {
+	UpdateEntry(conf *client.ADConf, serviceAccountName string, newValues map[*client.Field][]string) error
+}
+
+// PasswordVerifier is implemented by SecretsClients that can bind to AD as a
+// service account, which verify_after_rotation requires.
+type PasswordVerifier interface {
+	VerifyPassword(conf *client.ADConf, serviceAccountName string, password string) error
+}
+
+// MinPasswordAgeReader is implemented by SecretsClients that can read the
+// minimum password age that applies to a service account, which
+// respect_min_password_age requires.
+type MinPasswordAgeReader interface {
+	MinPasswordAge(conf *client.ADConf, serviceAccountName string) (time.Duration, error)
+}
+
+// ConnectionPrewarmer is implemented by SecretsClients that can connect to AD
+// ahead of the first request that needs to.
+type ConnectionPrewarmer interface {
+	Prewarm(conf *client.ADConf) error
+}
+
+// ConnectionCloser is implemented by SecretsClients that keep connections to
+// AD open between requests, which are closed when the backend is cleaned up.
+type ConnectionCloser interface {
+	Close()
+}
+
+// ConnectionVerifier is implemented by SecretsClients that can check a config
+// works before it's saved, which verify_connection requires.
+type ConnectionVerifier interface {
+	VerifyConnection(conf *client.ADConf) error
+}
+
+// DCHealthChecker is implemented by SecretsClients that track which domain
+// controllers in a config's url can be reached, and can probe the ones that
+// couldn't to find when they're back.
+type DCHealthChecker interface {
+	ProbeDCs(conf *client.ADConf) ([]client.DCStatus, error)
+	DCHealth(conf *client.ADConf) ([]client.DCStatus, error)
+}
+
+// Option configures a backend created with NewBackend.
+type Option func(*backendOptions)
+
+type backendOptions struct {
+	client SecretsClient
+	logger hclog.Logger
+	now    func() time.Time
+}
+
+// WithSecretsClient sets the client the backend uses to talk to AD.
+// By default, the backend connects to AD using its config.
+func WithSecretsClient(client SecretsClient) Option {
+	return func(opts *backendOptions) {
+		opts.client = client
+	}
+}
+
+// WithLogger sets the logger the backend uses instead of the one Vault provides.
+func WithLogger(logger hclog.Logger) Option {
+	return func(opts *backendOptions) {
+		opts.logger = logger
+	}
+}
+
+// WithClock sets the function the backend uses to tell the time,
+// so that tests can control when passwords are due for rotation.
+func WithClock(now func() time.Time) Option {
+	return func(opts *backendOptions) {
+		opts.now = now
+	}
+}
+
+// NewBackend returns an Active Directory secrets backend. Like any backend,
+// it must be set up with Setup before it handles requests.
+func NewBackend(opts ...Option) logical.Backend {
+	options := &backendOptions{
+		now: time.Now,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.client == nil {
+		logger := options.logger
+		if logger == nil {
+			logger = hclog.NewNullLogger()
+		}
+		options.client = newDevModeClient(util.NewSecretsClient(logger))
+	}
+
+	b := newBackend(options.client, nil)
+	b.checkOutHandler.passwordGenerator = systemPasswordGenerator{b}
+	b.logger = options.logger
+	b.now = options.now
+	b.checkOutHandler.now = options.now
+	return b
+}
+
+// systemPasswordGenerator generates passwords with the password policies of
+// the Vault the backend was set up by.
+type systemPasswordGenerator struct {
+	b *backend
+}
+
+func (g systemPasswordGenerator) GeneratePasswordFromPolicy(ctx context.Context, policyName string) (string, error) {
+	return g.b.System().GeneratePasswordFromPolicy(ctx, policyName)
+}
@@ -0,0 +1,71 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestNewBackend(t *testing.T) {
+	now := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	logger := hclog.NewNullLogger()
+	b := NewBackend(
+		WithSecretsClient(&fakeSecretsClient{}),
+		WithLogger(logger),
+		WithClock(func() time.Time { return now }),
+	)
+	conf := &logical.BackendConfig{
+		System: &logical.StaticSystemView{
+			DefaultLeaseTTLVal: defaultLeaseTTLVal,
+			MaxLeaseTTLVal:     maxLeaseTTLVal,
+		},
+	}
+	if err := b.Setup(ctx, conf); err != nil {
+		t.Fatal(err)
+	}
+	if b.Logger() != logger {
+		t.Fatal("expected the backend to use the given logger")
+	}
+
+	storage := &logical.InmemStorage{}
+	if err := writeConfig(ctx, storage, testConfig()); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      rolePrefix + "role",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"service_account_name": "app@example.com",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      credPrefix + "role",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+
+	// The role's password was rotated at the time the clock gave.
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      rolePrefix + "role",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	if lastVaultRotation := resp.Data["last_vault_rotation"].(time.Time); !lastVaultRotation.Equal(now) {
+		t.Fatalf("expected the last rotation to be at %s but it was at %s", now, lastVaultRotation)
+	}
+}
@@ -5,7 +5,11 @@ package plugin
 
 import (
 	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
 	"strings"
+	"unicode"
 
 	"github.com/hashicorp/go-secure-stdlib/base62"
 )
@@ -14,10 +18,143 @@ var (
 	// Per https://en.wikipedia.org/wiki/Password_strength#Guidelines_for_strong_passwords
 	minimumLengthOfComplexString = 8
 
+	// minimumFIPSPasswordLength is the fewest generated characters allowed in fips_mode.
+	minimumFIPSPasswordLength = 14
+
+	fipsPasswordCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
 	passwordComplexityPrefix = "?@09AZ"
 	pwdFieldTmpl             = "{{PASSWORD}}"
+
+	// defaultCompositionCharset is used by composition rules that don't set a
+	// charset, with defaultCompositionSymbols added if symbols are required.
+	defaultCompositionCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	defaultCompositionSymbols = "!#$%&*+-=?@^_"
 )
 
+// passwordComposition describes what generated passwords must contain, for
+// operators who can't use a Vault password policy.
+type passwordComposition struct {
+	MinDigits    int    `json:"min_digits" mapstructure:"min_digits"`
+	MinUppercase int    `json:"min_uppercase" mapstructure:"min_uppercase"`
+	MinSymbols   int    `json:"min_symbols" mapstructure:"min_symbols"`
+	Charset      string `json:"charset" mapstructure:"charset"`
+
+	// ExcludeCharacters are left out of the charset, for downstream systems that
+	// can't handle characters like quotes or backslashes.
+	ExcludeCharacters string `json:"exclude_characters,omitempty" mapstructure:"exclude_characters"`
+}
+
+// isSet reports whether any composition rule is set.
+func (c passwordComposition) isSet() bool {
+	return c.MinDigits != 0 || c.MinUppercase != 0 || c.MinSymbols != 0 || c.Charset != "" || c.ExcludeCharacters != ""
+}
+
+// charset returns the characters passwords are generated from, without the
+// excluded ones.
+func (c passwordComposition) charset() string {
+	charset := c.Charset
+	if charset == "" {
+		charset = defaultCompositionCharset
+		if c.MinSymbols > 0 {
+			charset += defaultCompositionSymbols
+		}
+	}
+	if c.ExcludeCharacters == "" {
+		return charset
+	}
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(c.ExcludeCharacters, r) {
+			return -1
+		}
+		return r
+	}, charset)
+}
+
+// validate returns an error if passwords of the given length can't follow the rules.
+func (c passwordComposition) validate(length int) error {
+	if c.MinDigits < 0 || c.MinUppercase < 0 || c.MinSymbols < 0 {
+		return fmt.Errorf("min_digits, min_uppercase, and min_symbols can't be negative")
+	}
+	if required := c.MinDigits + c.MinUppercase + c.MinSymbols; required > length {
+		return fmt.Errorf("passwords must contain at least %d digits, uppercase letters, and symbols, but only %d characters are generated", required, length)
+	}
+	charset := c.charset()
+	if charset == "" {
+		return fmt.Errorf("exclude_characters leaves no characters to generate passwords from")
+	}
+	for _, class := range []struct {
+		name     string
+		min      int
+		contains func(rune) bool
+	}{
+		{"min_digits", c.MinDigits, isDigit},
+		{"min_uppercase", c.MinUppercase, isUppercase},
+		{"min_symbols", c.MinSymbols, isSymbol},
+	} {
+		if class.min > 0 && !strings.ContainsFunc(charset, class.contains) {
+			return fmt.Errorf("%s is set, but charset has no such characters", class.name)
+		}
+	}
+	return nil
+}
+
+// generate returns a random string of the given length that follows the rules.
+func (c passwordComposition) generate(length int) (string, error) {
+	charset := []rune(c.charset())
+	var pwd []rune
+	for _, class := range []struct {
+		min      int
+		contains func(rune) bool
+	}{
+		{c.MinDigits, isDigit},
+		{c.MinUppercase, isUppercase},
+		{c.MinSymbols, isSymbol},
+	} {
+		var candidates []rune
+		for _, r := range charset {
+			if class.contains(r) {
+				candidates = append(candidates, r)
+			}
+		}
+		for i := 0; i < class.min; i++ {
+			r, err := randomRune(candidates)
+			if err != nil {
+				return "", err
+			}
+			pwd = append(pwd, r)
+		}
+	}
+	for len(pwd) < length {
+		r, err := randomRune(charset)
+		if err != nil {
+			return "", err
+		}
+		pwd = append(pwd, r)
+	}
+	// Shuffle so the required characters aren't always first.
+	for i := len(pwd) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		pwd[i], pwd[j.Int64()] = pwd[j.Int64()], pwd[i]
+	}
+	return string(pwd), nil
+}
+
+func randomRune(runes []rune) (rune, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(runes))))
+	if err != nil {
+		return 0, err
+	}
+	return runes[n.Int64()], nil
+}
+
+func isDigit(r rune) bool     { return r >= '0' && r <= '9' }
+func isUppercase(r rune) bool { return unicode.IsUpper(r) }
+func isSymbol(r rune) bool    { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }
+
 type passwordGenerator interface {
 	GeneratePasswordFromPolicy(ctx context.Context, policyName string) (password string, err error)
 }
@@ -33,14 +170,34 @@ func GeneratePassword(ctx context.Context, passConf passwordConf, generator pass
 	if passConf.PasswordPolicy != "" {
 		return generator.GeneratePasswordFromPolicy(ctx, passConf.PasswordPolicy)
 	}
-	return generateDeprecatedPassword(passConf.Formatter, passConf.Length)
+	if passConf.Composition.isSet() {
+		return generateComposedPassword(passConf.Formatter, passConf.Length, passConf.Composition)
+	}
+	if passConf.FIPSMode {
+		return generateDeprecatedPassword(passConf.Formatter, passConf.Length, fipsRandom)
+	}
+	return generateDeprecatedPassword(passConf.Formatter, passConf.Length, base62.Random)
+}
+
+// generateComposedPassword generates a password following the composition rules.
+// Unlike generateDeprecatedPassword, it doesn't add a prefix without a formatter,
+// because the rules already say what the password must contain.
+func generateComposedPassword(formatter string, totalLength int, composition passwordComposition) (string, error) {
+	if formatter == "" {
+		return composition.generate(totalLength)
+	}
+	pwd, err := composition.generate(lengthOfPassword(formatter, totalLength))
+	if err != nil {
+		return "", err
+	}
+	return strings.Replace(formatter, pwdFieldTmpl, pwd, 1), nil
 }
 
-func generateDeprecatedPassword(formatter string, totalLength int) (string, error) {
+func generateDeprecatedPassword(formatter string, totalLength int, random func(int) (string, error)) (string, error) {
 	// Has formatter
 	if formatter != "" {
 		passLen := lengthOfPassword(formatter, totalLength)
-		pwd, err := base62.Random(passLen)
+		pwd, err := random(passLen)
 		if err != nil {
 			return "", err
 		}
@@ -48,13 +205,28 @@ func generateDeprecatedPassword(formatter string, totalLength int) (string, erro
 	}
 
 	// Doesn't have formatter
-	pwd, err := base62.Random(totalLength - len(passwordComplexityPrefix))
+	pwd, err := random(totalLength - len(passwordComplexityPrefix))
 	if err != nil {
 		return "", err
 	}
 	return passwordComplexityPrefix + pwd, nil
 }
 
+// fipsRandom generates a random string of the given length from crypto/rand, which
+// in FIPS 140-2 builds draws from the validated module's DRBG.
+func fipsRandom(length int) (string, error) {
+	charsetLen := big.NewInt(int64(len(fipsPasswordCharset)))
+	pwd := make([]byte, length)
+	for i := range pwd {
+		n, err := rand.Int(rand.Reader, charsetLen)
+		if err != nil {
+			return "", err
+		}
+		pwd[i] = fipsPasswordCharset[n.Int64()]
+	}
+	return string(pwd), nil
+}
+
 func lengthOfPassword(formatter string, totalLength int) int {
 	lengthOfText := len(formatter) - len(pwdFieldTmpl)
 	return totalLength - lengthOfText
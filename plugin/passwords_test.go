@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -99,6 +100,76 @@ func TestGeneratePassword(t *testing.T) {
 	}
 }
 
+func TestGeneratePassword_FIPSMode(t *testing.T) {
+	passConf := passwordConf{
+		Length:   50,
+		FIPSMode: true,
+	}
+	if _, err := GeneratePassword(context.Background(), passConf, nil); err == nil {
+		t.Fatal("expected fips_mode to be rejected outside of FIPS builds")
+	}
+
+	available := fipsModeAvailable
+	fipsModeAvailable = func() bool { return true }
+	defer func() { fipsModeAvailable = available }()
+
+	tests := map[string]struct {
+		passConf          passwordConf
+		passwordAssertion func(t *testing.T, password string)
+		expectErr         bool
+	}{
+		"no formatter": {
+			passConf: passwordConf{
+				Length:   50,
+				FIPSMode: true,
+			},
+			passwordAssertion: assertPasswordRegex(
+				fmt.Sprintf("^%s[a-zA-Z0-9]{%d}$",
+					regexp.QuoteMeta(passwordComplexityPrefix),
+					50-len(passwordComplexityPrefix),
+				),
+			),
+		},
+		"formatter": {
+			passConf: passwordConf{
+				Length:    50,
+				Formatter: "foo{{PASSWORD}}bar",
+				FIPSMode:  true,
+			},
+			passwordAssertion: assertPasswordRegex("^foo[a-zA-Z0-9]{44}bar$"),
+		},
+		"too short": {
+			passConf: passwordConf{
+				Length:   16,
+				FIPSMode: true,
+			},
+			passwordAssertion: assertNoPassword,
+			expectErr:         true,
+		},
+		"formatter leaves too few characters": {
+			passConf: passwordConf{
+				Length:    20,
+				Formatter: "foobar{{PASSWORD}}foobar",
+				FIPSMode:  true,
+			},
+			passwordAssertion: assertNoPassword,
+			expectErr:         true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			password, err := GeneratePassword(context.Background(), test.passConf, nil)
+			if test.expectErr && err == nil {
+				t.Fatalf("err expected, got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+			test.passwordAssertion(t, password)
+		})
+	}
+}
+
 func assertNoPassword(t *testing.T, password string) {
 	t.Helper()
 	if password != "" {
@@ -140,3 +211,154 @@ func makePasswordGenerator(returnedPass string, returnedErr error) passwordGener
 		err:      returnedErr,
 	}
 }
+
+func TestGeneratePassword_Composition(t *testing.T) {
+	count := func(password string, class func(rune) bool) int {
+		n := 0
+		for _, r := range password {
+			if class(r) {
+				n++
+			}
+		}
+		return n
+	}
+	tests := map[string]struct {
+		passConf  passwordConf
+		expectErr bool
+	}{
+		"minimums": {
+			passConf: passwordConf{
+				Length:      20,
+				Composition: passwordComposition{MinDigits: 4, MinUppercase: 3, MinSymbols: 2},
+			},
+		},
+		"charset": {
+			passConf: passwordConf{
+				Length:      20,
+				Composition: passwordComposition{MinDigits: 10, Charset: "abc123"},
+			},
+		},
+		"formatter": {
+			passConf: passwordConf{
+				Length:      24,
+				Formatter:   "svc-{{PASSWORD}}",
+				Composition: passwordComposition{MinSymbols: 20},
+			},
+		},
+		"exclude characters": {
+			passConf: passwordConf{
+				Length:      20,
+				Composition: passwordComposition{MinSymbols: 4, ExcludeCharacters: `"'\` + "`$%"},
+			},
+		},
+		"minimums exceed length": {
+			passConf: passwordConf{
+				Length:      12,
+				Composition: passwordComposition{MinDigits: 8, MinSymbols: 8},
+			},
+			expectErr: true,
+		},
+		"charset lacks required class": {
+			passConf: passwordConf{
+				Length:      20,
+				Composition: passwordComposition{MinUppercase: 1, Charset: "abc123"},
+			},
+			expectErr: true,
+		},
+		"everything excluded": {
+			passConf: passwordConf{
+				Length:      20,
+				Composition: passwordComposition{Charset: "abc123", ExcludeCharacters: "abc123"},
+			},
+			expectErr: true,
+		},
+		"required class excluded": {
+			passConf: passwordConf{
+				Length:      20,
+				Composition: passwordComposition{MinDigits: 1, Charset: "abc123", ExcludeCharacters: "123"},
+			},
+			expectErr: true,
+		},
+		"with password policy": {
+			passConf: passwordConf{
+				PasswordPolicy: "testpolicy",
+				Composition:    passwordComposition{MinDigits: 1},
+			},
+			expectErr: true,
+		},
+		"too short": {
+			passConf: passwordConf{
+				Length:      6,
+				Composition: passwordComposition{MinDigits: 1},
+			},
+			expectErr: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			password, err := GeneratePassword(context.Background(), test.passConf, makePasswordGenerator("testpassword", nil))
+			if test.expectErr {
+				if err == nil {
+					t.Fatalf("err expected, got password %q", password)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+			if len(password) != test.passConf.Length {
+				t.Fatalf("expected a password of length %d but received %q", test.passConf.Length, password)
+			}
+			composition := test.passConf.Composition
+			if count(password, isDigit) < composition.MinDigits ||
+				count(password, isUppercase) < composition.MinUppercase ||
+				count(password, isSymbol) < composition.MinSymbols {
+				t.Fatalf("%q doesn't follow %#v", password, composition)
+			}
+			generated := strings.TrimPrefix(password, "svc-")
+			if test.passConf.Formatter != "" && generated == password {
+				t.Fatalf("expected %q to be formatted", password)
+			}
+			for _, r := range generated {
+				if !strings.ContainsRune(composition.charset(), r) {
+					t.Fatalf("%q contains %q, which isn't in the charset", password, r)
+				}
+			}
+		})
+	}
+}
+
+func TestPasswordConfWithComposition(t *testing.T) {
+	policy := passwordConf{PasswordPolicy: "testpolicy"}
+	if conf := policy.withComposition(nil); conf != policy {
+		t.Fatalf("expected no change without composition rules but received %#v", conf)
+	}
+	conf := policy.withComposition(&passwordComposition{MinDigits: 2})
+	if conf.PasswordPolicy != "" || conf.Length != defaultPasswordLength || conf.Composition.MinDigits != 2 {
+		t.Fatalf("expected the role's rules to replace the password policy but received %#v", conf)
+	}
+	if err := conf.validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPasswordConfWithExcludedCharacters(t *testing.T) {
+	composed := passwordConf{Length: 20, Composition: passwordComposition{MinDigits: 2, ExcludeCharacters: "0"}}
+	if conf := composed.withExcludedCharacters(""); conf != composed {
+		t.Fatalf("expected no change without excluded characters but received %#v", conf)
+	}
+	conf := composed.withExcludedCharacters("1")
+	if conf.Composition.MinDigits != 2 || conf.Composition.ExcludeCharacters != "01" {
+		t.Fatalf("expected the characters to be excluded along with the config's rules but received %#v", conf)
+	}
+
+	// Like a role's rules, they take precedence over a password policy.
+	policy := passwordConf{PasswordPolicy: "testpolicy"}
+	conf = policy.withExcludedCharacters(`"`)
+	if conf.PasswordPolicy != "" || conf.Length != defaultPasswordLength || conf.Composition.ExcludeCharacters != `"` {
+		t.Fatalf("expected the excluded characters to replace the password policy but received %#v", conf)
+	}
+	if err := conf.validate(); err != nil {
+		t.Fatal(err)
+	}
+}
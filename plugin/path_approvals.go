@@ -0,0 +1,341 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	approvalStoragePrefix = "approvals/"
+
+	// approvalRequestTTL is how long a check-out request remains valid, whether or
+	// not it has been approved.
+	approvalRequestTTL = time.Hour
+)
+
+// approvalRequest is a pending check-out from a set that requires approval.
+type approvalRequest struct {
+	RequesterEntityID string        `json:"requester_entity_id"`
+	TTL               time.Duration `json:"ttl"`
+	CreatedAt         time.Time     `json:"created_at"`
+	ApproverEntityID  string        `json:"approver_entity_id"`
+	ApprovedAt        time.Time     `json:"approved_at"`
+}
+
+func (a *approvalRequest) Approved() bool {
+	return a.ApproverEntityID != ""
+}
+
+func (a *approvalRequest) ExpiresAt() time.Time {
+	return a.CreatedAt.Add(approvalRequestTTL)
+}
+
+func (b *backend) pathListApprovals() *framework.Path {
+	return &framework.Path{
+		Pattern: libraryPrefix + framework.GenericNameRegex("name") + "/approvals/?$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationSuffix: "library-set-approvals",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the set.",
+				Required:    true,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.operationApprovalList,
+				Summary:  "List the check-out requests awaiting use for a library set.",
+			},
+		},
+		HelpSynopsis:    approvalHelpSynopsis,
+		HelpDescription: approvalHelpDescription,
+	}
+}
+
+func (b *backend) pathApprovals() *framework.Path {
+	return &framework.Path{
+		Pattern: libraryPrefix + framework.GenericNameRegex("name") + "/approvals/" + framework.GenericNameRegex("approval_id"),
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationSuffix: "library-set-approval",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the set.",
+				Required:    true,
+			},
+			"approval_id": {
+				Type:        framework.TypeString,
+				Description: "ID of the check-out request.",
+				Required:    true,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.operationApprovalRead,
+				Summary:  "Read a check-out request.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields:      approvalResponseFields(),
+					}},
+				},
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.operationApprovalApprove,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Approve a check-out request.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationVerb: "approve",
+				},
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
+			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback:                    b.operationApprovalDelete,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Deny or cancel a check-out request.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    approvalHelpSynopsis,
+		HelpDescription: approvalHelpDescription,
+	}
+}
+
+// approvalResponseFields describes the fields returned when reading a check-out request.
+func approvalResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"requester_entity_id": {
+			Type:        framework.TypeString,
+			Description: "The entity that requested the check-out.",
+		},
+		"ttl": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, how long the check-out will last once it's made.",
+		},
+		"created_at": {
+			Type:        framework.TypeTime,
+			Description: "When the check-out was requested.",
+		},
+		"expires_at": {
+			Type:        framework.TypeTime,
+			Description: "When the request expires if it hasn't been used to check out.",
+		},
+		"approved": {
+			Type:        framework.TypeBool,
+			Description: "Whether the request has been approved.",
+		},
+		"approver_entity_id": {
+			Type:        framework.TypeString,
+			Description: "The entity that approved the request.",
+		},
+		"approved_at": {
+			Type:        framework.TypeTime,
+			Description: "When the request was approved.",
+		},
+	}
+}
+
+func (b *backend) operationApprovalList(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	setName := fieldData.Get("name").(string)
+	keys, err := req.Storage.List(ctx, approvalStoragePrefix+setName+"/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(keys), nil
+}
+
+func (b *backend) operationApprovalRead(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	setName := fieldData.Get("name").(string)
+	lock := locksutil.LockForKey(b.checkOutLocks, setName)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	approval, err := readApproval(ctx, req.Storage, setName, fieldData.Get("approval_id").(string), b.now())
+	if err != nil {
+		return nil, err
+	}
+	if approval == nil {
+		return nil, nil
+	}
+	respData := map[string]interface{}{
+		"requester_entity_id": approval.RequesterEntityID,
+		"ttl":                 int64(approval.TTL.Seconds()),
+		"created_at":          approval.CreatedAt,
+		"expires_at":          approval.ExpiresAt(),
+		"approved":            approval.Approved(),
+	}
+	if approval.Approved() {
+		respData["approver_entity_id"] = approval.ApproverEntityID
+		respData["approved_at"] = approval.ApprovedAt
+	}
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+func (b *backend) operationApprovalApprove(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	setName := fieldData.Get("name").(string)
+	approvalID := fieldData.Get("approval_id").(string)
+
+	lock := locksutil.LockForKey(b.checkOutLocks, setName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	approval, err := readApproval(ctx, req.Storage, setName, approvalID, b.now())
+	if err != nil {
+		return nil, err
+	}
+	if approval == nil {
+		return codedErrorResponse(errCodeApprovalNotFound, "check-out request %q doesn't exist", approvalID), nil
+	}
+	if approval.Approved() {
+		return nil, nil
+	}
+	if req.EntityID == "" {
+		return codedErrorResponse(errCodeEntityRequired, "approving a check-out requires a token with an entity"), nil
+	}
+	if req.EntityID == approval.RequesterEntityID {
+		return codedErrorResponse(errCodeSelfApproval, "a check-out can't be approved by the entity that requested it"), nil
+	}
+	approval.ApproverEntityID = req.EntityID
+	approval.ApprovedAt = b.now().UTC()
+	if err := storeApproval(ctx, req.Storage, setName, approvalID, approval); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) operationApprovalDelete(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	setName := fieldData.Get("name").(string)
+
+	lock := locksutil.LockForKey(b.checkOutLocks, setName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := req.Storage.Delete(ctx, approvalStoragePrefix+setName+"/"+fieldData.Get("approval_id").(string)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// requestApproval stores a new check-out request for the set and returns its ID.
+func (b *backend) requestApproval(ctx context.Context, req *logical.Request, setName string, ttl time.Duration) (*logical.Response, error) {
+	if req.EntityID == "" {
+		return codedErrorResponse(errCodeEntityRequired, "check-outs from this set require approval, which requires a token with an entity"), nil
+	}
+	approvalID, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	approval := &approvalRequest{
+		RequesterEntityID: req.EntityID,
+		TTL:               ttl,
+		CreatedAt:         b.now().UTC(),
+	}
+	if err := storeApproval(ctx, req.Storage, setName, approvalID, approval); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"approval_id": approvalID,
+			"expires_at":  approval.ExpiresAt(),
+		},
+	}, nil
+}
+
+// approvalForCheckOut returns the approved request that lets the entity check out from
+// the set. If the request can't be used, an error response explaining why is returned.
+func (b *backend) approvalForCheckOut(ctx context.Context, req *logical.Request, setName, approvalID, requesterEntityID string) (*approvalRequest, *logical.Response, error) {
+	approval, err := readApproval(ctx, req.Storage, setName, approvalID, b.now())
+	if err != nil {
+		return nil, nil, err
+	}
+	if approval == nil {
+		return nil, codedErrorResponse(errCodeApprovalNotFound, "check-out request %q doesn't exist", approvalID), nil
+	}
+	if approval.RequesterEntityID != requesterEntityID {
+		return nil, codedErrorResponse(errCodeApprovalWrongRequester, "check-out request %q was made by another entity", approvalID), nil
+	}
+	if !approval.Approved() {
+		return nil, codedErrorResponse(errCodeApprovalPending, "check-out request %q hasn't been approved yet", approvalID), nil
+	}
+	return approval, nil, nil
+}
+
+// readApproval returns nil, nil if the request doesn't exist or had expired by now.
+func readApproval(ctx context.Context, storage logical.Storage, setName, approvalID string, now time.Time) (*approvalRequest, error) {
+	entry, err := storage.Get(ctx, approvalStoragePrefix+setName+"/"+approvalID)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	approval := &approvalRequest{}
+	if err := entry.DecodeJSON(approval); err != nil {
+		return nil, err
+	}
+	if now.After(approval.ExpiresAt()) {
+		return nil, nil
+	}
+	return approval, nil
+}
+
+func storeApproval(ctx context.Context, storage logical.Storage, setName, approvalID string, approval *approvalRequest) error {
+	entry, err := logical.StorageEntryJSON(approvalStoragePrefix+setName+"/"+approvalID, approval)
+	if err != nil {
+		return err
+	}
+	return storage.Put(ctx, entry)
+}
+
+// deleteApprovals removes every check-out request for a set.
+func deleteApprovals(ctx context.Context, storage logical.Storage, setName string) error {
+	approvalIDs, err := storage.List(ctx, approvalStoragePrefix+setName+"/")
+	if err != nil {
+		return err
+	}
+	for _, approvalID := range approvalIDs {
+		if err := storage.Delete(ctx, approvalStoragePrefix+setName+"/"+approvalID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	approvalHelpSynopsis = `
+Approve or deny check-outs from sets that require approval.
+`
+	approvalHelpDescription = `
+When a set has "require_approval" enabled, a check-out doesn't return a
+password. Instead it returns an "approval_id" for a pending request. A different
+entity approves the request by writing to this endpoint, or denies it by
+deleting it. Then the requester checks out again, passing the "approval_id",
+to receive the password. Requests expire an hour after they're made.
+`
+)
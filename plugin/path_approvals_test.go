@@ -0,0 +1,68 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestApprovalCheckOut(t *testing.T) {
+	b, storage := getBackend(t, &fakeSecretsClient{}, testConfig())
+	resp := requester(t, b, storage, "")(logical.CreateOperation, libraryPrefix+"sensitive", map[string]interface{}{
+		"service_account_names": []string{"admin@example.com"},
+		"require_approval":      true,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	checkOut := func(entityID, approvalID string) *logical.Response {
+		data := map[string]interface{}{}
+		if approvalID != "" {
+			data["approval_id"] = approvalID
+		}
+		return requester(t, b, storage, entityID)(logical.UpdateOperation, libraryPrefix+"sensitive/check-out", data)
+	}
+	approve := func(entityID, approvalID string) *logical.Response {
+		return requester(t, b, storage, entityID)(logical.UpdateOperation, libraryPrefix+"sensitive/approvals/"+approvalID, nil)
+	}
+
+	// Checking out only creates a request.
+	resp = checkOut("requester", "")
+	if resp == nil || resp.IsError() {
+		t.Fatalf("expected a check-out request but received %#v", resp)
+	}
+	if _, ok := resp.Data["password"]; ok {
+		t.Fatal("the password shouldn't be released before approval")
+	}
+	approvalID := resp.Data["approval_id"].(string)
+
+	if resp := checkOut("requester", approvalID); resp == nil || !resp.IsError() {
+		t.Fatal("expected an error because the request hasn't been approved")
+	}
+	if resp := approve("requester", approvalID); resp == nil || !resp.IsError() {
+		t.Fatal("expected an error because requesters can't approve their own check-outs")
+	}
+	if resp := approve("approver", approvalID); resp != nil && resp.IsError() {
+		t.Fatalf("bad: resp: %#v", resp)
+	}
+	if resp := checkOut("someone-else", approvalID); resp == nil || !resp.IsError() {
+		t.Fatal("expected an error because the request was made by another entity")
+	}
+
+	resp = checkOut("requester", approvalID)
+	if resp == nil || resp.IsError() {
+		t.Fatalf("expected a check-out but received %#v", resp)
+	}
+	if resp.Data["service_account_name"] != "admin@example.com" {
+		t.Fatalf("expected admin@example.com to be checked out but received %v", resp.Data["service_account_name"])
+	}
+
+	// Approvals can't be reused.
+	if resp := checkOut("requester", approvalID); resp == nil || !resp.IsError() {
+		t.Fatal("expected an error because the approval was already used")
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func (b *backend) pathSetManageExtend() *framework.Path {
+	return &framework.Path{
+		Pattern: libraryPrefix + "manage/" + framework.GenericNameRegex("name") + "/extend$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "extend",
+			OperationSuffix: "library-check-out",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the set.",
+				Required:    true,
+			},
+			"service_account_name": {
+				Type:        framework.TypeString,
+				Description: "The checked out service account to give more time.",
+			},
+			"checkout_id": {
+				Type:        framework.TypeString,
+				Description: "The ID of the check-out to give more time. Can't be used with service_account_name.",
+			},
+			"ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "In seconds, how long from now the check-out may last. It may be longer than the set's ttl and max_ttl, but not the mount's max lease TTL.",
+				Required:    true,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.operationSetManageExtend,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Give another borrower's check-out more time.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"service_account_name": {
+								Type:        framework.TypeString,
+								Description: "The service account whose check-out was extended.",
+							},
+							"checkout_id": {
+								Type:        framework.TypeString,
+								Description: "The ID of the check-out that was extended.",
+							},
+							"extended_until": {
+								Type:        framework.TypeTime,
+								Description: "When the check-out may last until.",
+							},
+						},
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    manageExtendHelpSynopsis,
+		HelpDescription: manageExtendHelpDescription,
+	}
+}
+
+func (b *backend) operationSetManageExtend(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	setName := fieldData.Get("name").(string)
+	ttl := time.Duration(fieldData.Get("ttl").(int)) * time.Second
+	if ttl <= 0 {
+		return codedErrorResponse(errCodeInvalidRequest, "ttl must be positive"), nil
+	}
+	if systemMaxTTL := b.System().MaxLeaseTTL(); systemMaxTTL > 0 && ttl > systemMaxTTL {
+		return codedErrorResponse(errCodeInvalidRequest, "ttl (%s) can't be longer than the mount's max lease TTL (%s)", ttl, systemMaxTTL), nil
+	}
+
+	lock := locksutil.LockForKey(b.checkOutLocks, setName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	set, err := readSet(ctx, req.Storage, setName)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return codedErrorResponse(errCodeSetNotFound, `%q doesn't exist`, setName), nil
+	}
+
+	requestedName := fieldData.Get("service_account_name").(string)
+	checkOutID := fieldData.Get("checkout_id").(string)
+	var serviceAccountName string
+	switch {
+	case requestedName != "" && checkOutID != "":
+		return codedErrorResponse(errCodeInvalidRequest, `"checkout_id" and "service_account_name" can't both be provided`), nil
+	case checkOutID != "":
+		serviceAccountName, err = b.findCheckOut(ctx, req.Storage, set, checkOutID)
+		if err != nil {
+			return nil, err
+		}
+		if serviceAccountName == "" {
+			return codedErrorResponse(errCodeCheckOutNotFound, "no service account in %q is checked out with ID %q", setName, checkOutID), nil
+		}
+	case requestedName != "":
+		// The set's spelling is used, since its storage entries are keyed by it.
+		serviceAccountName = findServiceAccountName(set.ServiceAccountNames, requestedName)
+		if serviceAccountName == "" {
+			return codedErrorResponse(errCodeInvalidRequest, "%q isn't managed by %q", requestedName, setName), nil
+		}
+	default:
+		return codedErrorResponse(errCodeInvalidRequest, `"service_account_name" or "checkout_id" must be provided`), nil
+	}
+
+	checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, req.Storage, serviceAccountName)
+	if err != nil {
+		return nil, err
+	}
+	if checkOut.IsAvailable {
+		return codedErrorResponse(errCodeAlreadyCheckedIn, "%q isn't checked out", serviceAccountName), nil
+	}
+	checkOut.ExtendedUntil = b.now().Add(ttl).UTC()
+	checkOut.ExtendedBy = requesterIdentity(req)
+	if err := b.checkOutHandler.Update(ctx, req.Storage, serviceAccountName, checkOut); err != nil {
+		return nil, err
+	}
+	b.Logger().Info("extended check-out", "set", setName, "service_account_name", serviceAccountName, "extended_until", checkOut.ExtendedUntil, "extended_by", checkOut.ExtendedBy)
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"service_account_name": serviceAccountName,
+			"checkout_id":          checkOut.ID,
+			"extended_until":       checkOut.ExtendedUntil,
+		},
+	}
+	resp.AddWarning("the borrower's lease must be renewed for the extension to take effect")
+	return resp, nil
+}
+
+// extendedLeaseTTLs returns the ttl and max_ttl for renewing the lease of a
+// check-out that was extended through the manage path, which are raised to
+// last until the extension ends if they wouldn't already. issueTime is when
+// the lease was issued, which its max_ttl counts from.
+func (b *backend) extendedLeaseTTLs(checkOut *CheckOut, issueTime time.Time, ttl, maxTTL time.Duration) (time.Duration, time.Duration) {
+	now := b.now()
+	if !checkOut.ExtendedUntil.After(now) {
+		return ttl, maxTTL
+	}
+	if extendedTTL := checkOut.ExtendedUntil.Sub(now); extendedTTL > ttl {
+		ttl = extendedTTL
+	}
+	if extendedMaxTTL := checkOut.ExtendedUntil.Sub(issueTime); maxTTL > 0 && extendedMaxTTL > maxTTL {
+		maxTTL = extendedMaxTTL
+	}
+	return b.leaseTTLs(ttl, maxTTL)
+}
+
+const (
+	manageExtendHelpSynopsis = `
+Give another borrower's check-out more time.
+`
+	manageExtendHelpDescription = `
+Extends the check-out of a service account, named by service_account_name or
+checkout_id, to last until ttl seconds from now, even if that's longer than the
+set's ttl and max_ttl allow. The borrower doesn't have to check the account in
+and out again, but its lease only gets the extra time the next time it's
+renewed, so the borrower, or Vault Agent on its behalf, must renew it before it
+expires.
+`
+)
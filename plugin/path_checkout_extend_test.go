@@ -0,0 +1,89 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestManageExtend(t *testing.T) {
+	b, storage := getBackend(t, newMemoryDirectory(), testConfig())
+	now := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	b.now = func() time.Time { return now }
+	handle := func(req *logical.Request) *logical.Response {
+		t.Helper()
+		return sendRequest(t, b, storage, req)
+	}
+
+	handle(&logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      libraryPrefix + "lib",
+		Data: map[string]interface{}{
+			"service_account_names": []string{"a@example.com"},
+			"ttl":                   30,
+			"max_ttl":               60,
+		},
+	})
+	extendPath := libraryPrefix + "manage/lib/extend"
+	if resp := handle(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      extendPath,
+		Data:      map[string]interface{}{"service_account_name": "a@example.com", "ttl": 150},
+	}); resp == nil || resp.Data["data"].(map[string]interface{})["error_code"] != string(errCodeAlreadyCheckedIn) {
+		t.Fatalf("expected an available account not to be extended but received %#v", resp)
+	}
+
+	checkOut := handle(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      libraryPrefix + "lib/check-out",
+		EntityID:  "borrower",
+	})
+	checkOut.Secret.IssueTime = now
+	if resp := handle(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      extendPath,
+		Data:      map[string]interface{}{"checkout_id": checkOut.Data["checkout_id"], "ttl": 1000},
+	}); resp == nil || resp.Data["data"].(map[string]interface{})["error_code"] != string(errCodeInvalidRequest) {
+		t.Fatalf("expected a ttl over the mount's max to be rejected but received %#v", resp)
+	}
+	resp := handle(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      extendPath,
+		Data:      map[string]interface{}{"checkout_id": checkOut.Data["checkout_id"], "ttl": 150},
+	})
+	if resp.IsError() || resp.Data["service_account_name"] != "a@example.com" || resp.Data["extended_until"] != now.Add(150*time.Second) {
+		t.Fatalf("expected the check-out to be extended but received %#v", resp)
+	}
+	status := handle(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      libraryPrefix + "lib/status",
+	}).Data["a@example.com"].(map[string]interface{})
+	if status["extended_until"] != now.Add(150*time.Second) {
+		t.Fatalf("expected the extension in the status but received %#v", status)
+	}
+
+	// Renewing the borrower's lease gives it the extra time, past the set's max_ttl.
+	now = now.Add(20 * time.Second)
+	renewed := handle(&logical.Request{
+		Operation: logical.RenewOperation,
+		EntityID:  "borrower",
+		Secret:    checkOut.Secret,
+	})
+	if renewed.IsError() || renewed.Secret.TTL != 130*time.Second || renewed.Secret.MaxTTL != 150*time.Second {
+		t.Fatalf("expected the lease to last until the extension ends but received %#v", renewed.Secret)
+	}
+
+	// Once the account is checked in, the extension is gone.
+	handle(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      libraryPrefix + "lib/check-in",
+		EntityID:  "borrower",
+	})
+	if stored, err := b.checkOutHandler.LoadCheckOut(ctx, storage, "a@example.com"); err != nil || !stored.ExtendedUntil.IsZero() {
+		t.Fatalf("expected the extension to be cleared but received %#v, %v", stored, err)
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func (b *backend) pathSetRenew() *framework.Path {
+	return &framework.Path{
+		Pattern: libraryPrefix + framework.GenericNameRegex("name") + "/renew$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "renew",
+			OperationSuffix: "library-check-out",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the set.",
+				Required:    true,
+			},
+			"service_account_name": {
+				Type:        framework.TypeString,
+				Description: "The checked out service account to renew. Not needed if the caller only has one checked out from the set.",
+			},
+			"checkout_id": {
+				Type:        framework.TypeString,
+				Description: "The ID returned by check-out for the service account to renew. Can't be used with service_account_name.",
+			},
+			"increment": {
+				Type:        framework.TypeDurationSecond,
+				Description: "In seconds, how long from now the check-out should last. Defaults to the set's ttl, and is capped at its max_ttl counted from the check-out.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.operationSetRenew,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Renew the caller's check-out without renewing its lease.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"service_account_name": {
+								Type:        framework.TypeString,
+								Description: "The service account whose check-out was renewed.",
+							},
+							"checkout_id": {
+								Type:        framework.TypeString,
+								Description: "The ID of the check-out that was renewed.",
+							},
+							"due_at": {
+								Type:        framework.TypeTime,
+								Description: "When the check-out is now due to be checked in.",
+							},
+						},
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    setRenewHelpSynopsis,
+		HelpDescription: setRenewHelpDescription,
+	}
+}
+
+func (b *backend) operationSetRenew(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	setName := fieldData.Get("name").(string)
+	increment := time.Duration(fieldData.Get("increment").(int)) * time.Second
+	if increment < 0 {
+		return codedErrorResponse(errCodeInvalidRequest, "increment can't be negative"), nil
+	}
+
+	lock := locksutil.LockForKey(b.checkOutLocks, setName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	set, err := readSet(ctx, req.Storage, setName)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return codedErrorResponse(errCodeSetNotFound, `%q doesn't exist`, setName), nil
+	}
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	requestedName := fieldData.Get("service_account_name").(string)
+	checkOutID := fieldData.Get("checkout_id").(string)
+	var serviceAccountName string
+	switch {
+	case requestedName != "" && checkOutID != "":
+		return codedErrorResponse(errCodeInvalidRequest, `"checkout_id" and "service_account_name" can't both be provided`), nil
+	case checkOutID != "":
+		serviceAccountName, err = b.findCheckOut(ctx, req.Storage, set, checkOutID)
+		if err != nil {
+			return nil, err
+		}
+		if serviceAccountName == "" {
+			return codedErrorResponse(errCodeCheckOutNotFound, "no service account in %q is checked out with ID %q", setName, checkOutID), nil
+		}
+	case requestedName != "":
+		// The set's spelling is used, since its storage entries are keyed by it.
+		serviceAccountName = findServiceAccountName(set.ServiceAccountNames, requestedName)
+		if serviceAccountName == "" {
+			return codedErrorResponse(errCodeInvalidRequest, "%q isn't managed by %q", requestedName, setName), nil
+		}
+	default:
+		// Like check-in, the caller needn't say which check-out they mean if
+		// they only have one.
+		var borrowed []string
+		for _, setServiceAccount := range set.ServiceAccountNames {
+			checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, req.Storage, setServiceAccount)
+			if err != nil {
+				return nil, err
+			}
+			if !checkOut.IsAvailable && checkinAuthorized(req, checkOut) {
+				borrowed = append(borrowed, setServiceAccount)
+			}
+		}
+		switch len(borrowed) {
+		case 0:
+			return codedErrorResponse(errCodeNotCheckedOutByCaller, "the caller has nothing checked out from %q", setName), nil
+		case 1:
+			serviceAccountName = borrowed[0]
+		default:
+			return codedErrorResponse(errCodeInvalidRequest, `when multiple service accounts are checked out, the "service_account_name" to renew must be provided`), nil
+		}
+	}
+
+	checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, req.Storage, serviceAccountName)
+	if err != nil {
+		return nil, err
+	}
+	if checkOut.IsAvailable {
+		return codedErrorResponse(errCodeAlreadyCheckedIn, "%s is already checked in, please call check-out to regain it", serviceAccountName), nil
+	}
+	// Renewing lends the account out for longer, so unlike check-in, it's
+	// limited to the borrower even if the set doesn't enforce check-ins.
+	if !checkinAuthorized(req, checkOut) {
+		return codedErrorResponse(errCodeNotCheckedOutByCaller, "%q can't be renewed because it wasn't checked out by the caller", serviceAccountName), nil
+	}
+	if !checkOut.fromNetwork(req) {
+		return codedErrorResponse(errCodeNetworkMismatch, "%s can only be renewed from %s, where it was checked out", serviceAccountName, checkOut.Network), nil
+	}
+	if isQuarantined, err := quarantined(ctx, req.Storage, serviceAccountName); err != nil {
+		return nil, err
+	} else if isQuarantined {
+		return codedErrorResponse(errCodeAccountQuarantined, "%s was quarantined because its check-ins kept failing, and can't be renewed", serviceAccountName), nil
+	}
+	if checkOut.CheckedOutAt.IsZero() {
+		// Without knowing when it was checked out, its max_ttl can't be enforced.
+		return codedErrorResponse(errCodeInvalidRequest, "%s was checked out before check-outs could be renewed here, so its lease must be renewed instead", serviceAccountName), nil
+	}
+
+	ttl, maxTTL := b.leaseTTLs(engineConf.libraryTTLs(set.ttlsFor(serviceAccountName, set.TTL)))
+	if increment > 0 {
+		ttl = increment
+	}
+	now := b.now()
+	dueAt := now.Add(ttl).UTC()
+	var warnings []string
+	if maxTTL > 0 {
+		maxDueAt := checkOut.CheckedOutAt.Add(maxTTL)
+		if checkOut.ExtendedUntil.After(maxDueAt) {
+			maxDueAt = checkOut.ExtendedUntil
+		}
+		if !maxDueAt.After(now) {
+			return codedErrorResponse(errCodeInvalidRequest, "%s has been checked out for its max_ttl of %s and can't be renewed", serviceAccountName, maxTTL), nil
+		}
+		if dueAt.After(maxDueAt) {
+			dueAt = maxDueAt.UTC()
+			warnings = append(warnings, "the renewal was capped at the check-out's max_ttl")
+		}
+	}
+	if dueAt.Before(checkOut.DueAt) {
+		// A renewal never makes the check-out due sooner.
+		dueAt = checkOut.DueAt
+	}
+	checkOut.DueAt, checkOut.DueWarningSent = dueAt, false
+	if err := b.checkOutHandler.Update(ctx, req.Storage, serviceAccountName, checkOut); err != nil {
+		return nil, err
+	}
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"service_account_name": serviceAccountName,
+			"checkout_id":          checkOut.ID,
+			"due_at":               dueAt,
+		},
+		Warnings: warnings,
+	}
+	return resp, nil
+}
+
+// leaseLapsed reports whether a check-out whose lease is being revoked was
+// renewed through the library's renew path past when the lease expires, in which
+// case it stays checked out until it's due. A lease revoked before it expires,
+// like with its token, still checks the account in. The lease's due time was
+// recorded by whichever node issued it, so a lease revoked within
+// clockSkewTolerance of it is taken to have expired, in case our clock is behind.
+func (b *backend) leaseLapsed(req *logical.Request, checkOut *CheckOut) bool {
+	leaseDueAtRaw, ok := req.Secret.InternalData["due_at"].(string)
+	if !ok {
+		return false
+	}
+	leaseDueAt, err := time.Parse(time.RFC3339, leaseDueAtRaw)
+	if err != nil {
+		return false
+	}
+	now := b.now()
+	return !now.Add(clockSkewTolerance).Before(leaseDueAt) && now.Before(checkOut.DueAt)
+}
+
+// checkInLapsedCheckOuts checks in the check-outs that outlived their leases
+// through the library's renew path once they're due, since no lease is left to
+// check them in.
+func (b *backend) checkInLapsedCheckOuts(ctx context.Context, storage logical.Storage) error {
+	setNames, err := storage.List(ctx, libraryPrefix)
+	if err != nil {
+		return err
+	}
+	for _, setName := range setNames {
+		if strings.HasSuffix(setName, "/") {
+			continue
+		}
+		if err := b.checkInLapsedSetCheckOuts(ctx, storage, setName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *backend) checkInLapsedSetCheckOuts(ctx context.Context, storage logical.Storage, setName string) error {
+	lock := locksutil.LockForKey(b.checkOutLocks, setName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	set, err := readSet(ctx, storage, setName)
+	if err != nil {
+		return err
+	}
+	if set == nil {
+		return nil
+	}
+	now := b.now()
+	for _, serviceAccountName := range set.ServiceAccountNames {
+		checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, storage, serviceAccountName)
+		if err != nil {
+			if err == errNotFound {
+				continue
+			}
+			return err
+		}
+		if checkOut.IsAvailable || !checkOut.LeaseLapsed || now.Before(checkOut.DueAt) {
+			continue
+		}
+		if err := b.checkOutHandler.CheckIn(ctx, storage, serviceAccountName); err != nil {
+			// The retry queue finishes the check-in.
+			b.enqueueRetry(ctx, storage, retryKindCheckIn, serviceAccountName, setName, err)
+			continue
+		}
+		b.clearRetry(ctx, storage, retryKindCheckIn, serviceAccountName)
+		b.notifyWebhook(ctx, storage, webhookEventCheckOutOverdue, map[string]interface{}{
+			"set_name":             setName,
+			"service_account_name": serviceAccountName,
+			"checkout_id":          checkOut.ID,
+		})
+	}
+	return nil
+}
+
+const (
+	setRenewHelpSynopsis = `
+Renew the caller's check-out without renewing its lease.
+`
+	setRenewHelpDescription = `
+Gives the caller's check-out of a service account, named by
+service_account_name or checkout_id, or their only one from the set, another
+increment seconds, or the set's ttl, up to its max_ttl counted from when it was
+checked out. It's for clients that use the library over plain HTTP and don't
+keep track of lease IDs to renew through sys/leases.
+
+If the check-out's lease expires before the check-out is due, the account
+stays checked out, and is checked in once it's due unless it's renewed again.
+Revoking the lease any earlier, like with its token, still checks it in.
+`
+)
@@ -0,0 +1,83 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestSetRenew(t *testing.T) {
+	b, storage := getBackend(t, newMemoryDirectory(), testConfig())
+	start := time.Now().Add(time.Hour)
+	now := start
+	b.now = func() time.Time { return now }
+	handle := func(entityID string, operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		return requester(t, b, storage, entityID)(operation, path, data)
+	}
+	status := func() map[string]interface{} {
+		t.Helper()
+		return handle("", logical.ReadOperation, libraryPrefix+"lib/status", nil).Data["a@example.com"].(map[string]interface{})
+	}
+
+	handle("", logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com"},
+		"ttl":                   60,
+		"max_ttl":               150,
+	})
+	checkOut := handle("borrower", logical.UpdateOperation, libraryPrefix+"lib/check-out", nil)
+
+	// Only the borrower may renew it.
+	if resp := handle("someone else", logical.UpdateOperation, libraryPrefix+"lib/renew", map[string]interface{}{
+		"service_account_name": "a@example.com",
+	}); responseErrorCode(resp) != string(errCodeNotCheckedOutByCaller) {
+		t.Fatalf("expected another entity's renewal to be refused but received %#v", resp)
+	}
+	now = start.Add(30 * time.Second)
+	resp := handle("borrower", logical.UpdateOperation, libraryPrefix+"lib/renew", nil)
+	if resp.IsError() || !resp.Data["due_at"].(time.Time).Equal(start.Add(90*time.Second)) || resp.Data["checkout_id"] != checkOut.Data["checkout_id"] {
+		t.Fatalf("expected the check-out to be due in another ttl but received %#v", resp)
+	}
+
+	// The lease expires before the check-out is due, so it stays checked out,
+	// even when it's revoked by a node whose clock is a little behind.
+	now = start.Add(45 * time.Second)
+	if _, err := b.endCheckOut(ctx, &logical.Request{Storage: storage, Secret: checkOut.Secret}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if s := status(); s["available"] != false || s["lease_lapsed"] != true {
+		t.Fatalf("expected the check-out to outlive its lease but received %#v", s)
+	}
+
+	// Renewals can't go past the max_ttl.
+	now = start.Add(80 * time.Second)
+	resp = handle("borrower", logical.UpdateOperation, libraryPrefix+"lib/renew", map[string]interface{}{
+		"increment": 100,
+	})
+	if resp.IsError() || !resp.Data["due_at"].(time.Time).Equal(start.Add(150*time.Second).UTC()) || len(resp.Warnings) != 1 {
+		t.Fatalf("expected the renewal to be capped at the max_ttl but received %#v", resp)
+	}
+
+	// Once it's due, it's checked in.
+	now = start.Add(140 * time.Second)
+	if err := b.periodicFunc(ctx, &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	if s := status(); s["available"] != false {
+		t.Fatalf("expected the check-out to stay checked out until it's due but received %#v", s)
+	}
+	now = start.Add(150 * time.Second)
+	if err := b.periodicFunc(ctx, &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	if s := status(); s["available"] != true {
+		t.Fatalf("expected the check-out to be checked in once it's due but received %#v", s)
+	}
+	if resp := handle("borrower", logical.UpdateOperation, libraryPrefix+"lib/renew", nil); responseErrorCode(resp) != string(errCodeNotCheckedOutByCaller) {
+		t.Fatalf("expected nothing left to renew but received %#v", resp)
+	}
+}
@@ -5,22 +5,49 @@ package plugin
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"time"
 
-	"github.com/hashicorp/go-secure-stdlib/strutil"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/helper/parseutil"
 	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
 )
 
 const libraryPrefix = "library/"
 
 type librarySet struct {
-	ServiceAccountNames       []string      `json:"service_account_names"`
-	TTL                       time.Duration `json:"ttl"`
-	MaxTTL                    time.Duration `json:"max_ttl"`
-	DisableCheckInEnforcement bool          `json:"disable_check_in_enforcement"`
+	ServiceAccountNames       []string               `json:"service_account_names"`
+	Config                    string                 `json:"config,omitempty"`
+	TTL                       time.Duration          `json:"ttl"`
+	MaxTTL                    time.Duration          `json:"max_ttl"`
+	DisableCheckInEnforcement bool                   `json:"disable_check_in_enforcement"`
+	RequireApproval           bool                   `json:"require_approval"`
+	MaxPasswordAge            time.Duration          `json:"max_password_age"`
+	CheckOutCooldown          time.Duration          `json:"check_out_cooldown"`
+	AccountTTLs               map[string]accountTTLs `json:"account_ttls,omitempty"`
+	DisallowUnlimitedTTL      bool                   `json:"disallow_unlimited_ttl"`
+	AllowPrivileged           bool                   `json:"allow_privileged"`
+	FailureThreshold          int                    `json:"failure_threshold"`
+	FailureAction             string                 `json:"failure_action"`
+	BindToNetwork             bool                   `json:"bind_to_network"`
+	IPv4PrefixLength          int                    `json:"ipv4_prefix_length"`
+	IPv6PrefixLength          int                    `json:"ipv6_prefix_length"`
+	ExcludeCharacters         string                 `json:"exclude_characters,omitempty"`
+	Notes                     string                 `json:"notes,omitempty"`
+	UpdatedBy                 string                 `json:"updated_by,omitempty"`
+	UpdatedAt                 time.Time              `json:"updated_at"`
+}
+
+// accountTTLs are a service account's own ttl and max_ttl, which replace its set's
+// when it's checked out. Zero keeps the set's.
+type accountTTLs struct {
+	TTL    time.Duration `json:"ttl"`
+	MaxTTL time.Duration `json:"max_ttl"`
 }
 
 // Validates ensures that a set meets our code assumptions that TTLs are set in
@@ -29,20 +56,101 @@ func (l *librarySet) Validate() error {
 	if len(l.ServiceAccountNames) < 1 {
 		return fmt.Errorf(`at least one service account must be configured`)
 	}
-	if l.MaxTTL > 0 {
-		if l.MaxTTL < l.TTL {
-			return fmt.Errorf(`max_ttl (%d seconds) may not be less than ttl (%d seconds)`, l.MaxTTL, l.TTL)
+	if l.MaxPasswordAge < 0 {
+		return fmt.Errorf(`max_password_age can't be negative`)
+	}
+	if l.CheckOutCooldown < 0 {
+		return fmt.Errorf(`check_out_cooldown can't be negative`)
+	}
+	for serviceAccountName := range l.AccountTTLs {
+		if ttl, maxTTL := l.ttlsFor(serviceAccountName, l.TTL); maxTTL > 0 && ttl > maxTTL {
+			return fmt.Errorf("the ttl of %s (%s) can't be longer than its max_ttl (%s)", serviceAccountName, ttl, maxTTL)
 		}
 	}
+	if err := l.validateNetworkBinding(); err != nil {
+		return err
+	}
+	return validateFailurePolicy(l.FailureThreshold, l.FailureAction)
+}
+
+// ttlsFor returns the ttl and max_ttl of a check-out of serviceAccountName, given the
+// ttl worked out from the set's. The account's own ttl replaces the set's, but a
+// shorter one the caller asked for is kept.
+func (l *librarySet) ttlsFor(serviceAccountName string, ttl time.Duration) (time.Duration, time.Duration) {
+	maxTTL := l.MaxTTL
+	own, ok := l.AccountTTLs[serviceAccountName]
+	if !ok {
+		return ttl, maxTTL
+	}
+	if own.MaxTTL > 0 {
+		maxTTL = own.MaxTTL
+	}
+	if own.TTL > 0 && (ttl == l.TTL || ttl > own.TTL) {
+		ttl = own.TTL
+	}
+	return ttl, maxTTL
+}
+
+// pruneAccountTTLs drops the ttls of service accounts that are no longer in the set.
+func (l *librarySet) pruneAccountTTLs() {
+	for serviceAccountName := range l.AccountTTLs {
+		if findServiceAccountName(l.ServiceAccountNames, serviceAccountName) == "" {
+			delete(l.AccountTTLs, serviceAccountName)
+		}
+	}
+	if len(l.AccountTTLs) == 0 {
+		l.AccountTTLs = nil
+	}
+}
+
+// coolingDown reports whether a checked-in service account is still within the
+// set's check_out_cooldown, and if so, when it ends.
+func (l *librarySet) coolingDown(checkOut *CheckOut, now time.Time) (time.Time, bool) {
+	if l.CheckOutCooldown <= 0 || !checkOut.IsAvailable || checkOut.CheckedInAt.IsZero() {
+		return time.Time{}, false
+	}
+	ends := checkOut.CheckedInAt.Add(l.CheckOutCooldown)
+	return ends, now.Before(ends)
+}
+
+// unlimitedTTLDisallowed reports whether check-outs from the set must have a limited
+// lending period, either because the set or the config says so.
+func (l *librarySet) unlimitedTTLDisallowed(engineConf *configuration) bool {
+	return l.DisallowUnlimitedTTL || (engineConf != nil && engineConf.DisallowUnlimitedTTL)
+}
+
+// validateTTLLimit ensures that, if unlimited check-outs are disallowed, the set
+// can't lend a service account out indefinitely through its ttl or renewals.
+func (l *librarySet) validateTTLLimit(engineConf *configuration) error {
+	if !l.unlimitedTTLDisallowed(engineConf) {
+		return nil
+	}
+	if ttl, maxTTL := engineConf.libraryTTLs(l.TTL, l.MaxTTL); ttl <= 0 || maxTTL <= 0 {
+		return fmt.Errorf(`unlimited check-outs are disallowed, so ttl and max_ttl must be greater than 0`)
+	}
 	return nil
 }
 
+// validateExcludeCharacters returns an error if passwords can't be generated
+// for the set without its excluded characters.
+func (l *librarySet) validateExcludeCharacters(engineConf *configuration) error {
+	if l.ExcludeCharacters == "" || engineConf == nil {
+		return nil
+	}
+	return engineConf.PasswordConf.withExcludedCharacters(l.ExcludeCharacters).validate()
+}
+
 func (b *backend) pathListSets() *framework.Path {
 	return &framework.Path{
 		Pattern: libraryPrefix + "?$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationSuffix: "library-sets",
+		},
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.ListOperation: &framework.PathOperation{
 				Callback: b.setListOperation,
+				Summary:  "List the name of each library set.",
 			},
 		},
 		HelpSynopsis:    pathListSetsHelpSyn,
@@ -61,6 +169,10 @@ func (b *backend) setListOperation(ctx context.Context, req *logical.Request, _
 func (b *backend) pathSets() *framework.Path {
 	return &framework.Path{
 		Pattern: libraryPrefix + framework.GenericNameRegex("name"),
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationSuffix: "library-set",
+		},
 		Fields: map[string]*framework.FieldSchema{
 			"name": {
 				Type:        framework.TypeLowerCaseString,
@@ -73,12 +185,12 @@ func (b *backend) pathSets() *framework.Path {
 			},
 			"ttl": {
 				Type:        framework.TypeDurationSecond,
-				Description: "In seconds, the amount of time a check-out should last. Defaults to 24 hours.",
+				Description: "In seconds, the amount of time a check-out should last. Defaults to the config's library_ttl if it's set, or 24 hours. 0 means the config's library_ttl, or the mount's default lease TTL.",
 				Default:     24 * 60 * 60, // 24 hours
 			},
 			"max_ttl": {
 				Type:        framework.TypeDurationSecond,
-				Description: "In seconds, the max amount of time a check-out's renewals should last. Defaults to 24 hours.",
+				Description: "In seconds, the max amount of time a check-out's renewals should last. Defaults to the config's library_max_ttl if it's set, or 24 hours. 0 means the config's library_max_ttl, or the mount's max lease TTL.",
 				Default:     24 * 60 * 60, // 24 hours
 			},
 			"disable_check_in_enforcement": {
@@ -86,23 +198,116 @@ func (b *backend) pathSets() *framework.Path {
 				Description: "Disable the default behavior of requiring that check-ins are performed by the entity that checked them out.",
 				Default:     false,
 			},
+			"require_approval": {
+				Type:        framework.TypeBool,
+				Description: "Require that a second entity approves each check-out before the password is released.",
+				Default:     false,
+			},
+			"max_password_age": {
+				Type:        framework.TypeDurationSecond,
+				Description: "In seconds, how old the password of a checked-in service account may get before it's rotated in the background. Defaults to 0, which never rotates idle service accounts.",
+				Default:     0,
+			},
+			"check_out_cooldown": {
+				Type:        framework.TypeDurationSecond,
+				Description: "In seconds, how long a service account stays unavailable after it's checked in, so sessions can be terminated and the new password can replicate before it's lent out again. Defaults to 0.",
+				Default:     0,
+			},
+			"account_ttls": {
+				Type:        framework.TypeMap,
+				Description: `Gives service accounts in the set their own ttl and max_ttl in place of the set's, ex. {"admin@example.com": {"ttl": "1h", "max_ttl": "1h"}}. Either may be left out to keep the set's.`,
+			},
+			"disallow_unlimited_ttl": {
+				Type:        framework.TypeBool,
+				Description: "Reject a ttl or max_ttl of 0, and check-outs with no limit on how long a service account may be borrowed.",
+				Default:     false,
+			},
+			"allow_privileged": {
+				Type:        framework.TypeBool,
+				Description: "Allow service accounts with an adminCount of 1, or in a built-in group like Domain Admins, to be managed by the set.",
+				Default:     false,
+			},
+			"failure_threshold": {
+				Type:        framework.TypeInt,
+				Description: "How many check-ins of a service account in a row may fail before the failure_action is taken. Defaults to 0, which never takes it.",
+				Default:     0,
+			},
+			"failure_action": {
+				Type:        framework.TypeString,
+				Description: `What to do once failure_threshold check-ins in a row fail: "retry" keeps retrying, "stop" stops retrying, leaving the service account checked out, "disable" also stops retrying, and doesn't lend the service account again until a check-in of it succeeds, "event" keeps retrying but sends an event, and "quarantine" stops retrying and takes the service account from its borrower until it's checked in through the manage path.`,
+				Default:     failureActionRetry,
+			},
+			"bind_to_network": {
+				Type:        framework.TypeBool,
+				Description: "Record the network each check-out is made from, and reject check-ins and renewals through the library's renew path from other networks. Check-ins through the manage path are allowed from anywhere.",
+				Default:     false,
+			},
+			"ipv4_prefix_length": {
+				Type:        framework.TypeInt,
+				Description: "The prefix length of the network IPv4 check-outs are bound to. Defaults to 32, the client's own address.",
+				Default:     32,
+			},
+			"ipv6_prefix_length": {
+				Type:        framework.TypeInt,
+				Description: "The prefix length of the network IPv6 check-outs are bound to. Defaults to 128, the client's own address.",
+				Default:     128,
+			},
+			"config": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "The name of the config/<name> to manage the service accounts with, for accounts in another AD domain. Defaults to the config. Can't be changed once the set is created.",
+			},
+			"exclude_characters": {
+				Type:        framework.TypeString,
+				Description: "Characters to leave out of the set's passwords, in addition to the config's exclude_characters, like quotes or backslashes that downstream systems can't handle. Like a role's composition rules, they take precedence over the config's password_policy.",
+			},
+			"notes": {
+				Type:        framework.TypeString,
+				Description: "Free-form notes for operators, like who owns the set or how it's used.",
+			},
 		},
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.CreateOperation: &framework.PathOperation{
-				Callback: b.operationSetCreate,
-				Summary:  "Create a library set.",
+				Callback:                    b.operationSetCreate,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Create a library set.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
 			},
 			logical.UpdateOperation: &framework.PathOperation{
-				Callback: b.operationSetUpdate,
-				Summary:  "Update a library set.",
+				Callback:                    b.operationSetUpdate,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Update a library set.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
 			},
 			logical.ReadOperation: &framework.PathOperation{
 				Callback: b.operationSetRead,
 				Summary:  "Read a library set.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields:      effectiveTTLResponseFields(setResponseFields()),
+					}},
+				},
 			},
 			logical.DeleteOperation: &framework.PathOperation{
-				Callback: b.operationSetDelete,
-				Summary:  "Delete a library set.",
+				Callback:                    b.operationSetDelete,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Delete a library set.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
 			},
 		},
 		ExistenceCheck:  b.operationSetExistenceCheck,
@@ -111,6 +316,92 @@ func (b *backend) pathSets() *framework.Path {
 	}
 }
 
+// setResponseFields describes the fields returned when reading a library set.
+func setResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"service_account_names": {
+			Type:        framework.TypeCommaStringSlice,
+			Description: "The username/logon name for the service accounts with which this set is associated.",
+		},
+		"ttl": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, the amount of time a check-out should last.",
+		},
+		"max_ttl": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, the max amount of time a check-out's renewals should last.",
+		},
+		"disable_check_in_enforcement": {
+			Type:        framework.TypeBool,
+			Description: "Whether check-ins may be performed by an entity other than the one that checked them out.",
+		},
+		"require_approval": {
+			Type:        framework.TypeBool,
+			Description: "Whether a second entity must approve each check-out.",
+		},
+		"max_password_age": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, how old the password of a checked-in service account may get before it's rotated in the background.",
+		},
+		"check_out_cooldown": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, how long a service account stays unavailable after it's checked in.",
+		},
+		"account_ttls": {
+			Type:        framework.TypeMap,
+			Description: "The ttl and max_ttl, in seconds, of each service account that has its own.",
+		},
+		"disallow_unlimited_ttl": {
+			Type:        framework.TypeBool,
+			Description: "Whether check-outs with no limit on how long a service account may be borrowed are rejected.",
+		},
+		"allow_privileged": {
+			Type:        framework.TypeBool,
+			Description: "Whether privileged service accounts may be managed by the set.",
+		},
+		"failure_threshold": {
+			Type:        framework.TypeInt,
+			Description: "How many check-ins of a service account in a row may fail before the failure_action is taken.",
+		},
+		"failure_action": {
+			Type:        framework.TypeString,
+			Description: "What to do once failure_threshold check-ins in a row fail.",
+		},
+		"bind_to_network": {
+			Type:        framework.TypeBool,
+			Description: "Whether check-ins and renewals through the library's renew path must come from the network the check-out was made from.",
+		},
+		"ipv4_prefix_length": {
+			Type:        framework.TypeInt,
+			Description: "The prefix length of the network IPv4 check-outs are bound to.",
+		},
+		"ipv6_prefix_length": {
+			Type:        framework.TypeInt,
+			Description: "The prefix length of the network IPv6 check-outs are bound to.",
+		},
+		"config": {
+			Type:        framework.TypeString,
+			Description: "The name of the config/<name> the service accounts are managed with, if it isn't the config.",
+		},
+		"exclude_characters": {
+			Type:        framework.TypeString,
+			Description: "Characters left out of the set's passwords, in addition to the config's.",
+		},
+		"notes": {
+			Type:        framework.TypeString,
+			Description: "Free-form notes for operators.",
+		},
+		"updated_by": {
+			Type:        framework.TypeString,
+			Description: "The entity ID, or the display name of a token without an entity, that last wrote the set.",
+		},
+		"updated_at": {
+			Type:        framework.TypeTime,
+			Description: "When the set was last written.",
+		},
+	}
+}
+
 func (b *backend) operationSetExistenceCheck(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (bool, error) {
 	set, err := readSet(ctx, req.Storage, fieldData.Get("name").(string))
 	if err != nil {
@@ -130,41 +421,100 @@ func (b *backend) operationSetCreate(ctx context.Context, req *logical.Request,
 	ttl := time.Duration(fieldData.Get("ttl").(int)) * time.Second
 	maxTTL := time.Duration(fieldData.Get("max_ttl").(int)) * time.Second
 	disableCheckInEnforcement := fieldData.Get("disable_check_in_enforcement").(bool)
+	requireApproval := fieldData.Get("require_approval").(bool)
+	maxPasswordAge := time.Duration(fieldData.Get("max_password_age").(int)) * time.Second
+	checkOutCooldown := time.Duration(fieldData.Get("check_out_cooldown").(int)) * time.Second
+	disallowUnlimitedTTL := fieldData.Get("disallow_unlimited_ttl").(bool)
+	allowPrivileged := fieldData.Get("allow_privileged").(bool)
+	failureThreshold := fieldData.Get("failure_threshold").(int)
+	failureAction := fieldData.Get("failure_action").(string)
+	bindToNetwork := fieldData.Get("bind_to_network").(bool)
+	ipv4PrefixLength := fieldData.Get("ipv4_prefix_length").(int)
+	ipv6PrefixLength := fieldData.Get("ipv6_prefix_length").(int)
 
 	if len(serviceAccountNames) == 0 {
-		return logical.ErrorResponse(`"service_account_names" must be provided`), nil
+		return codedErrorResponse(errCodeInvalidRequest, `"service_account_names" must be provided`), nil
+	}
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	configName := fieldData.Get("config").(string)
+	if engineConf, err = configFor(ctx, req.Storage, engineConf, configName); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+	}
+	if serviceAccountNames, err = canonicalServiceAccountNames(engineConf, serviceAccountNames); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
 	}
 
-	// Ensure these service accounts aren't already managed by another check-out set.
-	for _, serviceAccountName := range serviceAccountNames {
-		if _, err := b.checkOutHandler.LoadCheckOut(ctx, req.Storage, serviceAccountName); err != nil {
-			if err == errNotFound {
-				// This is what we want to see.
-				continue
-			}
-			return nil, err
-		}
-		return logical.ErrorResponse(fmt.Sprintf("%q is already managed by another set", serviceAccountName)), nil
+	// Ensure these service accounts aren't already managed by a role or another check-out set.
+	if resp, err := b.checkUnmanaged(ctx, req.Storage, serviceAccountNames); resp != nil || err != nil {
+		return resp, err
+	}
+	if resp, err := b.checkServiceAccounts(ctx, req.Storage, configName, serviceAccountNames, allowPrivileged); resp != nil || err != nil {
+		return resp, err
+	}
+	// Sets that don't give their own ttls follow the config's library defaults.
+	if _, ok := fieldData.GetOk("ttl"); !ok && engineConf != nil && engineConf.LibraryTTL > 0 {
+		ttl = 0
+	}
+	if _, ok := fieldData.GetOk("max_ttl"); !ok && engineConf != nil && engineConf.LibraryMaxTTL > 0 {
+		maxTTL = 0
 	}
 
 	set := &librarySet{
 		ServiceAccountNames:       serviceAccountNames,
+		Config:                    configName,
 		TTL:                       ttl,
 		MaxTTL:                    maxTTL,
 		DisableCheckInEnforcement: disableCheckInEnforcement,
+		RequireApproval:           requireApproval,
+		MaxPasswordAge:            maxPasswordAge,
+		CheckOutCooldown:          checkOutCooldown,
+		DisallowUnlimitedTTL:      disallowUnlimitedTTL,
+		AllowPrivileged:           allowPrivileged,
+		FailureThreshold:          failureThreshold,
+		FailureAction:             failureAction,
+		BindToNetwork:             bindToNetwork,
+		IPv4PrefixLength:          ipv4PrefixLength,
+		IPv6PrefixLength:          ipv6PrefixLength,
+		ExcludeCharacters:         fieldData.Get("exclude_characters").(string),
+		Notes:                     fieldData.Get("notes").(string),
+		UpdatedBy:                 requesterIdentity(req),
+		UpdatedAt:                 b.now().UTC(),
+	}
+	if accountTTLsRaw, ok := fieldData.GetOk("account_ttls"); ok {
+		if set.AccountTTLs, err = parseAccountTTLs(accountTTLsRaw.(map[string]interface{}), set.ServiceAccountNames); err != nil {
+			return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+		}
 	}
 	if err := set.Validate(); err != nil {
-		return logical.ErrorResponse(err.Error()), nil
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+	}
+	if err := b.validateLeaseTTLs(fieldData, set.TTL, set.MaxTTL); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+	}
+	if err := validateLibraryTTLs(fieldData, engineConf, set.TTL, set.MaxTTL); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+	}
+	if err := set.validateTTLLimit(engineConf); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+	}
+	if err := set.validateExcludeCharacters(engineConf); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+	}
+	if err := storeAccountOwners(ctx, req.Storage, &accountOwner{Kind: accountOwnerSet, Name: setName}, serviceAccountNames); err != nil {
+		return nil, err
 	}
 	for _, serviceAccountName := range serviceAccountNames {
-		if err := b.checkOutHandler.CheckIn(ctx, req.Storage, serviceAccountName); err != nil {
-			return nil, err
+		if err := b.checkOutHandler.AddAccount(ctx, req.Storage, serviceAccountName); err != nil {
+			return errorResponseFor(err)
 		}
 	}
 	if err := storeSet(ctx, req.Storage, setName, set); err != nil {
 		return nil, err
 	}
-	return nil, nil
+	return warningsResponse(b.stampAccounts(engineConf, req.MountPoint, &accountOwner{Kind: accountOwnerSet, Name: setName}, serviceAccountNames)), nil
 }
 
 func (b *backend) operationSetUpdate(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
@@ -198,33 +548,60 @@ func (b *backend) operationSetUpdate(ctx context.Context, req *logical.Request,
 	}
 	disableCheckInEnforcement := disableCheckInEnforcementRaw.(bool)
 
+	requireApprovalRaw, requireApprovalSent := fieldData.GetOk("require_approval")
+	maxPasswordAgeRaw, maxPasswordAgeSent := fieldData.GetOk("max_password_age")
+	checkOutCooldownRaw, checkOutCooldownSent := fieldData.GetOk("check_out_cooldown")
+	disallowUnlimitedTTLRaw, disallowUnlimitedTTLSent := fieldData.GetOk("disallow_unlimited_ttl")
+	allowPrivilegedRaw, allowPrivilegedSent := fieldData.GetOk("allow_privileged")
+	failureThresholdRaw, failureThresholdSent := fieldData.GetOk("failure_threshold")
+	failureActionRaw, failureActionSent := fieldData.GetOk("failure_action")
+	bindToNetworkRaw, bindToNetworkSent := fieldData.GetOk("bind_to_network")
+	ipv4PrefixLengthRaw, ipv4PrefixLengthSent := fieldData.GetOk("ipv4_prefix_length")
+	ipv6PrefixLengthRaw, ipv6PrefixLengthSent := fieldData.GetOk("ipv6_prefix_length")
+	excludeCharactersRaw, excludeCharactersSent := fieldData.GetOk("exclude_characters")
+	notesRaw, notesSent := fieldData.GetOk("notes")
+	accountTTLsRaw, accountTTLsSent := fieldData.GetOk("account_ttls")
+
 	set, err := readSet(ctx, req.Storage, setName)
 	if err != nil {
 		return nil, err
 	}
 	if set == nil {
-		return logical.ErrorResponse(fmt.Sprintf(`%q doesn't exist`, setName)), nil
+		return codedErrorResponse(errCodeSetNotFound, `%q doesn't exist`, setName), nil
+	}
+
+	if configName, ok := fieldData.GetOk("config"); ok && configName.(string) != set.Config {
+		return codedErrorResponse(errCodeInvalidRequest, "config can't be changed once the set is created"), nil
+	}
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if engineConf, err = configFor(ctx, req.Storage, engineConf, set.Config); err != nil {
+		return nil, err
 	}
 
 	var beingAdded []string
 	var beingDeleted []string
 	if newServiceAccountNamesSent {
-
-		// For new service accounts we receive, before we check them in, ensure they're not in another set.
-		beingAdded = strutil.Difference(newServiceAccountNames, set.ServiceAccountNames, true)
-		for _, newServiceAccountName := range beingAdded {
-			if _, err := b.checkOutHandler.LoadCheckOut(ctx, req.Storage, newServiceAccountName); err != nil {
-				if err == errNotFound {
-					// Great, this validates that it's not in use in another set.
-					continue
-				}
-				return nil, err
+		if newServiceAccountNames, err = canonicalServiceAccountNames(engineConf, newServiceAccountNames); err != nil {
+			return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+		}
+		// Accounts the set already has keep the spelling their storage entries use.
+		for i, newServiceAccountName := range newServiceAccountNames {
+			if existing := findServiceAccountName(set.ServiceAccountNames, newServiceAccountName); existing != "" {
+				newServiceAccountNames[i] = existing
 			}
-			return logical.ErrorResponse(fmt.Sprintf("%q is already managed by another set", newServiceAccountName)), nil
+		}
+
+		// For new service accounts we receive, before we check them in, ensure they're not in a role or another set.
+		beingAdded = serviceAccountsNotIn(newServiceAccountNames, set.ServiceAccountNames)
+		if resp, err := b.checkUnmanaged(ctx, req.Storage, beingAdded); resp != nil || err != nil {
+			return resp, err
 		}
 
 		// For service accounts we won't be handling anymore, before we delete them, ensure they're not checked out.
-		beingDeleted = strutil.Difference(set.ServiceAccountNames, newServiceAccountNames, true)
+		beingDeleted = serviceAccountsNotIn(set.ServiceAccountNames, newServiceAccountNames)
 		for _, prevServiceAccountName := range beingDeleted {
 			checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, req.Storage, prevServiceAccountName)
 			if err != nil {
@@ -235,10 +612,37 @@ func (b *backend) operationSetUpdate(ctx context.Context, req *logical.Request,
 				return nil, err
 			}
 			if !checkOut.IsAvailable {
-				return logical.ErrorResponse(fmt.Sprintf(`"%s" can't be deleted because it is currently checked out'`, prevServiceAccountName)), nil
+				return codedErrorResponse(errCodeAlreadyCheckedOut, `"%s" can't be deleted because it is currently checked out'`, prevServiceAccountName), nil
 			}
 		}
+	}
+
+	// Accounts already in the set were checked when they were added, unless
+	// privileged accounts are no longer allowed.
+	toCheck := beingAdded
+	allowPrivileged := set.AllowPrivileged
+	if allowPrivilegedSent {
+		allowPrivileged = allowPrivilegedRaw.(bool)
+		if set.AllowPrivileged && !allowPrivileged {
+			toCheck = set.ServiceAccountNames
+			if newServiceAccountNamesSent {
+				toCheck = newServiceAccountNames
+			}
+		}
+	}
+	if len(toCheck) > 0 {
+		if resp, err := b.checkServiceAccounts(ctx, req.Storage, set.Config, toCheck, allowPrivileged); resp != nil || err != nil {
+			return resp, err
+		}
+	}
+	if newServiceAccountNamesSent {
 		set.ServiceAccountNames = newServiceAccountNames
+		set.pruneAccountTTLs()
+	}
+	if accountTTLsSent {
+		if set.AccountTTLs, err = parseAccountTTLs(accountTTLsRaw.(map[string]interface{}), set.ServiceAccountNames); err != nil {
+			return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+		}
 	}
 
 	if ttlSent {
@@ -250,14 +654,65 @@ func (b *backend) operationSetUpdate(ctx context.Context, req *logical.Request,
 	if enforcementSent {
 		set.DisableCheckInEnforcement = disableCheckInEnforcement
 	}
+	if requireApprovalSent {
+		set.RequireApproval = requireApprovalRaw.(bool)
+	}
+	if maxPasswordAgeSent {
+		set.MaxPasswordAge = time.Duration(maxPasswordAgeRaw.(int)) * time.Second
+	}
+	if checkOutCooldownSent {
+		set.CheckOutCooldown = time.Duration(checkOutCooldownRaw.(int)) * time.Second
+	}
+	if disallowUnlimitedTTLSent {
+		set.DisallowUnlimitedTTL = disallowUnlimitedTTLRaw.(bool)
+	}
+	set.AllowPrivileged = allowPrivileged
+	if failureThresholdSent {
+		set.FailureThreshold = failureThresholdRaw.(int)
+	}
+	if failureActionSent {
+		set.FailureAction = failureActionRaw.(string)
+	}
+	if bindToNetworkSent {
+		set.BindToNetwork = bindToNetworkRaw.(bool)
+	}
+	if ipv4PrefixLengthSent {
+		set.IPv4PrefixLength = ipv4PrefixLengthRaw.(int)
+	}
+	if ipv6PrefixLengthSent {
+		set.IPv6PrefixLength = ipv6PrefixLengthRaw.(int)
+	}
+	if excludeCharactersSent {
+		set.ExcludeCharacters = excludeCharactersRaw.(string)
+	}
+	if notesSent {
+		set.Notes = notesRaw.(string)
+	}
+	set.UpdatedBy = requesterIdentity(req)
+	set.UpdatedAt = b.now().UTC()
 	if err := set.Validate(); err != nil {
-		return logical.ErrorResponse(err.Error()), nil
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+	}
+	if err := b.validateLeaseTTLs(fieldData, set.TTL, set.MaxTTL); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+	}
+	if err := validateLibraryTTLs(fieldData, engineConf, set.TTL, set.MaxTTL); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+	}
+	if err := set.validateTTLLimit(engineConf); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+	}
+	if err := set.validateExcludeCharacters(engineConf); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
 	}
 
 	// Now that we know we can take all these actions, let's take them.
+	if err := storeAccountOwners(ctx, req.Storage, &accountOwner{Kind: accountOwnerSet, Name: setName}, beingAdded); err != nil {
+		return nil, err
+	}
 	for _, newServiceAccountName := range beingAdded {
-		if err := b.checkOutHandler.CheckIn(ctx, req.Storage, newServiceAccountName); err != nil {
-			return nil, err
+		if err := b.checkOutHandler.AddAccount(ctx, req.Storage, newServiceAccountName); err != nil {
+			return errorResponseFor(err)
 		}
 	}
 	for _, prevServiceAccountName := range beingDeleted {
@@ -268,7 +723,12 @@ func (b *backend) operationSetUpdate(ctx context.Context, req *logical.Request,
 	if err := storeSet(ctx, req.Storage, setName, set); err != nil {
 		return nil, err
 	}
-	return nil, nil
+	if err := deleteAccountOwners(ctx, req.Storage, beingDeleted); err != nil {
+		return nil, err
+	}
+	warnings := b.stampAccounts(engineConf, req.MountPoint, &accountOwner{Kind: accountOwnerSet, Name: setName}, beingAdded)
+	warnings = append(warnings, b.clearStamps(engineConf, beingDeleted)...)
+	return warningsResponse(warnings), nil
 }
 
 func (b *backend) operationSetRead(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
@@ -285,13 +745,40 @@ func (b *backend) operationSetRead(ctx context.Context, req *logical.Request, fi
 	if set == nil {
 		return nil, nil
 	}
+	respData := map[string]interface{}{
+		"service_account_names":        set.ServiceAccountNames,
+		"config":                       set.Config,
+		"ttl":                          int64(set.TTL.Seconds()),
+		"max_ttl":                      int64(set.MaxTTL.Seconds()),
+		"disable_check_in_enforcement": set.DisableCheckInEnforcement,
+		"require_approval":             set.RequireApproval,
+		"max_password_age":             int64(set.MaxPasswordAge.Seconds()),
+		"check_out_cooldown":           int64(set.CheckOutCooldown.Seconds()),
+		"account_ttls":                 set.accountTTLsMap(),
+		"disallow_unlimited_ttl":       set.DisallowUnlimitedTTL,
+		"allow_privileged":             set.AllowPrivileged,
+		"failure_threshold":            set.FailureThreshold,
+		"failure_action":               set.FailureAction,
+		"bind_to_network":              set.BindToNetwork,
+		"ipv4_prefix_length":           set.ipv4PrefixLength(),
+		"ipv6_prefix_length":           set.ipv6PrefixLength(),
+		"exclude_characters":           set.ExcludeCharacters,
+		"notes":                        set.Notes,
+	}
+	if set.UpdatedBy != "" {
+		respData["updated_by"] = set.UpdatedBy
+	}
+	if !set.UpdatedAt.IsZero() {
+		respData["updated_at"] = set.UpdatedAt
+	}
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	ttl, maxTTL := engineConf.libraryTTLs(set.TTL, set.MaxTTL)
+	b.addEffectiveTTLs(respData, ttl, maxTTL)
 	return &logical.Response{
-		Data: map[string]interface{}{
-			"service_account_names":        set.ServiceAccountNames,
-			"ttl":                          int64(set.TTL.Seconds()),
-			"max_ttl":                      int64(set.MaxTTL.Seconds()),
-			"disable_check_in_enforcement": set.DisableCheckInEnforcement,
-		},
+		Data: respData,
 	}, nil
 }
 
@@ -320,7 +807,7 @@ func (b *backend) operationSetDelete(ctx context.Context, req *logical.Request,
 			return nil, err
 		}
 		if !checkOut.IsAvailable {
-			return logical.ErrorResponse(fmt.Sprintf(`"%s" can't be deleted because it is currently checked out'`, serviceAccountName)), nil
+			return codedErrorResponse(errCodeAlreadyCheckedOut, `"%s" can't be deleted because it is currently checked out'`, serviceAccountName), nil
 		}
 	}
 	for _, serviceAccountName := range set.ServiceAccountNames {
@@ -328,12 +815,68 @@ func (b *backend) operationSetDelete(ctx context.Context, req *logical.Request,
 			return nil, err
 		}
 	}
+	if err := deleteApprovals(ctx, req.Storage, setName); err != nil {
+		return nil, err
+	}
 	if err := req.Storage.Delete(ctx, libraryPrefix+setName); err != nil {
 		return nil, err
 	}
+	if err := deleteAccountOwners(ctx, req.Storage, set.ServiceAccountNames); err != nil {
+		return nil, err
+	}
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if engineConf, err = configFor(ctx, req.Storage, engineConf, set.Config); err != nil {
+		return nil, err
+	}
+	return warningsResponse(b.clearStamps(engineConf, set.ServiceAccountNames)), nil
+}
+
+// checkServiceAccounts returns an error response if any of the given service accounts
+// is the account Vault binds to AD with, or is privileged and allowPrivileged isn't set.
+func (b *backend) checkServiceAccounts(ctx context.Context, storage logical.Storage, configName string, serviceAccountNames []string, allowPrivileged bool) (*logical.Response, error) {
+	engineConf, err := readConfig(ctx, storage)
+	if err != nil {
+		return nil, err
+	}
+	if engineConf == nil {
+		return nil, errors.New("the config is currently unset")
+	}
+	if engineConf, err = configFor(ctx, storage, engineConf, configName); err != nil {
+		return nil, err
+	}
+	for _, serviceAccountName := range serviceAccountNames {
+		entry, err := b.client.Get(engineConf.ADConf, serviceAccountName)
+		if err != nil {
+			return errorResponseFor(err)
+		}
+		if resp := checkManageable(engineConf, serviceAccountName, entry, allowPrivileged); resp != nil {
+			return resp, nil
+		}
+	}
 	return nil, nil
 }
 
+// checkManageable returns an error response if a service account can't be managed
+// by a role or set, because it's the bind account, it's privileged and allowPrivileged
+// isn't set, or the configured provider reserves it.
+func checkManageable(engineConf *configuration, serviceAccountName string, entry *client.Entry, allowPrivileged bool) *logical.Response {
+	if isBindAccount(engineConf.ADConf, serviceAccountName, entry) {
+		return codedErrorResponse(errCodeBindAccount, "%q is the account Vault binds with, use rotate-root to rotate its password", serviceAccountName)
+	}
+	if reason := privilegedReason(entry); reason != "" && !allowPrivileged {
+		return codedErrorResponse(errCodePrivilegedAccount, "%q is privileged because %s, set allow_privileged to manage it anyway", serviceAccountName, reason)
+	}
+	if preset := engineConf.providerPreset(); preset != nil {
+		if err := preset.checkAccount(serviceAccountName, entry); err != nil {
+			return codedErrorResponse(errCodeProviderRestriction, "%s", err)
+		}
+	}
+	return nil
+}
+
 // readSet is a helper method for reading a set from storage by name.
 // It's intended to be used anywhere in the plugin. It may return nil, nil if
 // a librarySet doesn't currently exist for a given setName.
@@ -377,3 +920,54 @@ To learn which service accounts are being managed by Vault, list the set names u
 this endpoint. Then read any individual set by name to learn more.
 `
 )
+
+// parseAccountTTLs parses the account_ttls field. Each service account must be in
+// serviceAccountNames, and is keyed by the spelling used there.
+func parseAccountTTLs(raw map[string]interface{}, serviceAccountNames []string) (map[string]accountTTLs, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	parsed := make(map[string]accountTTLs, len(raw))
+	for name, ttlsRaw := range raw {
+		serviceAccountName := findServiceAccountName(serviceAccountNames, name)
+		if serviceAccountName == "" {
+			return nil, fmt.Errorf("account_ttls names %q, which isn't in the set", name)
+		}
+		fields, ok := ttlsRaw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("account_ttls[%q] must be an object with a ttl and/or max_ttl", name)
+		}
+		var ttls accountTTLs
+		for key, value := range fields {
+			d, err := parseutil.ParseDurationSecond(value)
+			if err != nil {
+				return nil, fmt.Errorf("account_ttls[%q].%s: %w", name, key, err)
+			}
+			if d < 0 {
+				return nil, fmt.Errorf("account_ttls[%q].%s can't be negative", name, key)
+			}
+			switch key {
+			case "ttl":
+				ttls.TTL = d
+			case "max_ttl":
+				ttls.MaxTTL = d
+			default:
+				return nil, fmt.Errorf("account_ttls[%q] has unknown field %q, only ttl and max_ttl are allowed", name, key)
+			}
+		}
+		parsed[serviceAccountName] = ttls
+	}
+	return parsed, nil
+}
+
+// accountTTLsMap returns the set's account ttls for reading.
+func (l *librarySet) accountTTLsMap() map[string]interface{} {
+	m := make(map[string]interface{}, len(l.AccountTTLs))
+	for serviceAccountName, ttls := range l.AccountTTLs {
+		m[serviceAccountName] = map[string]interface{}{
+			"ttl":     int64(ttls.TTL.Seconds()),
+			"max_ttl": int64(ttls.MaxTTL.Seconds()),
+		}
+	}
+	return m
+}
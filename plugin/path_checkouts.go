@@ -5,10 +5,13 @@ package plugin
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"time"
 
 	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -19,27 +22,161 @@ const secretAccessKeyType = "creds"
 func (b *backend) pathSetCheckOut() *framework.Path {
 	return &framework.Path{
 		Pattern: libraryPrefix + framework.GenericNameRegex("name") + "/check-out$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "check-out",
+			OperationSuffix: "library-account",
+		},
 		Fields: map[string]*framework.FieldSchema{
 			"name": {
 				Type:        framework.TypeLowerCaseString,
-				Description: "Name of the set",
+				Description: "Name of the set.",
 				Required:    true,
 			},
 			"ttl": {
 				Type:        framework.TypeDurationSecond,
 				Description: "The length of time before the check-out will expire, in seconds.",
 			},
+			"approval_id": {
+				Type:        framework.TypeString,
+				Description: "For sets that require approval, the ID of the approved check-out request.",
+			},
+			"reason": {
+				Type:        framework.TypeString,
+				Description: "Why the service account is needed. It's kept with the check-out and its lease, so it shows in the set's status and in lease lookups.",
+			},
 		},
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.UpdateOperation: &framework.PathOperation{
-				Callback: b.operationSetCheckOut,
-				Summary:  "Check a service account out from the library.",
+				Callback:                    b.operationSetCheckOut,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Check a service account out from the library.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields:      checkOutResponseFields(),
+					}},
+				},
 			},
 		},
 		HelpSynopsis: `Check a service account out from the library.`,
 	}
 }
 
+func (b *backend) pathSetManageCheckOut() *framework.Path {
+	return &framework.Path{
+		Pattern: libraryPrefix + "manage/" + framework.GenericNameRegex("name") + "/check-out$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "check-out-on-behalf",
+			OperationSuffix: "library-account",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the set.",
+				Required:    true,
+			},
+			"entity_id": {
+				Type:        framework.TypeString,
+				Description: "The ID of the entity to check the service account out to. It may check the service account in like it had checked it out itself.",
+				Required:    true,
+			},
+			"ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "The length of time before the check-out will expire, in seconds.",
+			},
+			"approval_id": {
+				Type:        framework.TypeString,
+				Description: "For sets that require approval, the ID of the check-out request the entity made and another entity approved.",
+			},
+			"reason": {
+				Type:        framework.TypeString,
+				Description: "Why the service account is needed. It's kept with the check-out and its lease, so it shows in the set's status and in lease lookups.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.operationSetManageCheckOut,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Check a service account out from the library on behalf of another entity.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields:      checkOutResponseFields(),
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    manageCheckOutHelpSynopsis,
+		HelpDescription: manageCheckOutHelpDescription,
+	}
+}
+
+// checkOutResponseFields describes the fields returned by check-outs.
+func checkOutResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"service_account_name": {
+			Type:        framework.TypeString,
+			Description: "The service account that was checked out.",
+		},
+		"password": {
+			Type:        framework.TypeString,
+			Description: "The service account's current password.",
+		},
+		"approval_id": {
+			Type:        framework.TypeString,
+			Description: "For sets that require approval, the ID of the check-out request that was made.",
+		},
+		"checkout_id": {
+			Type:        framework.TypeString,
+			Description: "The ID of the check-out, which may be used to check the service account in.",
+		},
+		"set_name": {
+			Type:        framework.TypeString,
+			Description: "The library set the service account was checked out from.",
+		},
+		"due_at": {
+			Type:        framework.TypeTime,
+			Description: "When the check-out's lease expires unless it's renewed.",
+		},
+		"reason": {
+			Type:        framework.TypeString,
+			Description: "Why the service account was checked out, if a reason was given.",
+		},
+		"expires_at": {
+			Type:        framework.TypeTime,
+			Description: "For sets that require approval, when the check-out request expires.",
+		},
+		"object_sid": {
+			Type:        framework.TypeString,
+			Description: "The service account's SID, if include_account_ids is set in the config.",
+		},
+		"object_guid": {
+			Type:        framework.TypeString,
+			Description: "The service account's objectGUID, if include_account_ids is set in the config.",
+		},
+		"kerberos_realm": {
+			Type:        framework.TypeString,
+			Description: "The service account's Kerberos realm, if include_kerberos_info is set in the config.",
+		},
+		"kerberos_principal": {
+			Type:        framework.TypeString,
+			Description: "The service account's Kerberos principal, if include_kerberos_info is set in the config.",
+		},
+		"netbios_domain": {
+			Type:        framework.TypeString,
+			Description: "The NetBIOS name of the service account's domain, if include_kerberos_info is set in the config.",
+		},
+		"kdcs": {
+			Type:        framework.TypeCommaStringSlice,
+			Description: "The KDCs of the service account's realm, if include_kerberos_info is set in the config.",
+		},
+	}
+}
+
 func (b *backend) operationSetCheckOut(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
 	setName := fieldData.Get("name").(string)
 
@@ -47,62 +184,255 @@ func (b *backend) operationSetCheckOut(ctx context.Context, req *logical.Request
 	lock.Lock()
 	defer lock.Unlock()
 
-	ttlPeriodRaw, ttlPeriodSent := fieldData.GetOk("ttl")
-	if !ttlPeriodSent {
-		ttlPeriodRaw = 0
+	set, err := readSet(ctx, req.Storage, setName)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return codedErrorResponse(errCodeSetNotFound, `%q doesn't exist`, setName), nil
+	}
+	ttl := checkOutTTL(set, fieldData)
+
+	// Sets requiring approval only release a password for a request that a
+	// different entity has approved.
+	approvalID := ""
+	if set.RequireApproval {
+		approvalIDRaw, approvalIDSent := fieldData.GetOk("approval_id")
+		if !approvalIDSent {
+			return b.requestApproval(ctx, req, setName, ttl)
+		}
+		approvalID = approvalIDRaw.(string)
+		approval, resp, err := b.approvalForCheckOut(ctx, req, setName, approvalID, req.EntityID)
+		if resp != nil || err != nil {
+			return resp, err
+		}
+		ttl = approval.TTL
+	}
+
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if engineConf == nil {
+		return nil, errors.New("the config is currently unset")
+	}
+
+	resp, err := b.checkOutFromSet(ctx, req, engineConf, setName, set, ttl, approvalID, "", fieldData.Get("reason").(string))
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	b.usage.checkOutUnavailable(ctx, req.Storage, b.now(), setName)
+	return codedErrorResponse(errCodeNoAccountsAvailable, "No service accounts available for check-out."), nil
+}
+
+func (b *backend) operationSetManageCheckOut(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	setName := fieldData.Get("name").(string)
+	borrowerEntityID := fieldData.Get("entity_id").(string)
+	if borrowerEntityID == "" {
+		return codedErrorResponse(errCodeInvalidRequest, `"entity_id" must be provided`), nil
+	}
+	entity, err := b.System().EntityInfo(borrowerEntityID)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil {
+		return codedErrorResponse(errCodeInvalidRequest, "entity %q doesn't exist", borrowerEntityID), nil
 	}
-	requestedTTL := time.Duration(ttlPeriodRaw.(int)) * time.Second
+
+	lock := locksutil.LockForKey(b.checkOutLocks, setName)
+	lock.Lock()
+	defer lock.Unlock()
 
 	set, err := readSet(ctx, req.Storage, setName)
 	if err != nil {
 		return nil, err
 	}
 	if set == nil {
-		return logical.ErrorResponse(fmt.Sprintf(`%q doesn't exist`, setName)), nil
+		return codedErrorResponse(errCodeSetNotFound, `%q doesn't exist`, setName), nil
 	}
+	ttl := checkOutTTL(set, fieldData)
 
-	// Prepare the check-out we'd like to execute.
-	ttl := set.TTL
-	if ttlPeriodSent {
-		switch {
-		case set.TTL <= 0 && requestedTTL > 0:
-			// The set's TTL is infinite and the caller requested a finite TTL.
-			ttl = requestedTTL
-		case set.TTL > 0 && requestedTTL < set.TTL:
-			// The set's TTL isn't infinite and the caller requested a shorter TTL.
-			ttl = requestedTTL
+	// Operators can't skip a set's approval, so they need a request the borrower
+	// made that another entity approved.
+	approvalID := ""
+	if set.RequireApproval {
+		approvalIDRaw, approvalIDSent := fieldData.GetOk("approval_id")
+		if !approvalIDSent {
+			return codedErrorResponse(errCodeInvalidRequest, "%q requires approval, so \"approval_id\" must be provided", setName), nil
 		}
+		approvalID = approvalIDRaw.(string)
+		approval, resp, err := b.approvalForCheckOut(ctx, req, setName, approvalID, borrowerEntityID)
+		if resp != nil || err != nil {
+			return resp, err
+		}
+		ttl = approval.TTL
+	}
+
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if engineConf == nil {
+		return nil, errors.New("the config is currently unset")
+	}
+
+	resp, err := b.checkOutFromSet(ctx, req, engineConf, setName, set, ttl, approvalID, borrowerEntityID, fieldData.Get("reason").(string))
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	b.usage.checkOutUnavailable(ctx, req.Storage, b.now(), setName)
+	return codedErrorResponse(errCodeNoAccountsAvailable, "No service accounts available for check-out."), nil
+}
+
+// checkOutTTL returns the ttl for a check-out from the set, honoring a requested ttl
+// only if it's shorter than the set's. Zero means the mount's default lease TTL,
+// and the result is capped at the set's max_ttl by leaseTTLs.
+func checkOutTTL(set *librarySet, fieldData *framework.FieldData) time.Duration {
+	ttlPeriodRaw, ttlPeriodSent := fieldData.GetOk("ttl")
+	if !ttlPeriodSent {
+		return set.TTL
+	}
+	requestedTTL := time.Duration(ttlPeriodRaw.(int)) * time.Second
+	switch {
+	case set.TTL <= 0 && requestedTTL > 0:
+		// The set has no TTL of its own and the caller requested one.
+		return requestedTTL
+	case set.TTL > 0 && requestedTTL < set.TTL:
+		// The set has a TTL and the caller requested a shorter one.
+		return requestedTTL
+	}
+	return set.TTL
+}
+
+// checkOutFromSet checks out the first available service account in the set. If
+// none are available, it returns a nil response. The caller must hold the set's lock.
+// If borrowerEntityID is set, the service account is checked out to that entity
+// on the caller's behalf. The reason the borrower gave, if any, is kept with the
+// check-out and its lease.
+func (b *backend) checkOutFromSet(ctx context.Context, req *logical.Request, engineConf *configuration, setName string, set *librarySet, ttl time.Duration, approvalID, borrowerEntityID, reason string) (*logical.Response, error) {
+	if resp := responseWrappingRequired(engineConf, req); resp != nil {
+		return resp, nil
+	}
+	engineConf, err := configFor(ctx, req.Storage, engineConf, set.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sets are validated against this when they're written, but the set may predate it.
+	if set.unlimitedTTLDisallowed(engineConf) {
+		ttl, maxTTL := engineConf.libraryTTLs(ttl, set.MaxTTL)
+		if maxTTL <= 0 {
+			return codedErrorResponse(errCodeInvalidRequest, "unlimited check-outs are disallowed, but %q has no max_ttl", setName), nil
+		}
+		if ttl <= 0 {
+			return codedErrorResponse(errCodeInvalidRequest, "unlimited check-outs are disallowed, please request a ttl"), nil
+		}
+	}
+
+	checkOutID, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
 	}
 	newCheckOut := &CheckOut{
 		IsAvailable:         false,
 		BorrowerEntityID:    req.EntityID,
 		BorrowerClientToken: req.ClientToken,
+		ID:                  checkOutID,
+		TokenAccessor:       req.ClientTokenAccessor,
+		Reason:              reason,
+	}
+	if req.Connection != nil {
+		newCheckOut.RemoteAddress = req.Connection.RemoteAddr
+	}
+	if borrowerEntityID != "" {
+		// The borrower checks it in with their own token, not the operator's.
+		newCheckOut.BorrowerEntityID = borrowerEntityID
+		newCheckOut.BorrowerClientToken = ""
+		newCheckOut.Operator = requesterIdentity(req)
+	} else if set.BindToNetwork {
+		// The operator's network says nothing about the borrower's, so check-outs
+		// on someone's behalf aren't bound to it.
+		if newCheckOut.Network, err = set.clientNetwork(req); err != nil {
+			return codedErrorResponse(errCodeNetworkMismatch, "%s", err), nil
+		}
 	}
 
 	// Check out the first service account available.
 	for _, serviceAccountName := range set.ServiceAccountNames {
-		if err := b.checkOutHandler.CheckOut(ctx, req.Storage, serviceAccountName, newCheckOut); err != nil {
-			if err == errCheckedOut {
-				continue
-			}
+		checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, req.Storage, serviceAccountName)
+		if err != nil {
 			return nil, err
 		}
-		password, err := retrievePassword(ctx, req.Storage, serviceAccountName)
+		if !checkOut.IsAvailable {
+			continue
+		}
+		if _, ok := set.coolingDown(checkOut, b.now()); ok {
+			continue
+		}
+		// A disabled account isn't lent until a check-in of it succeeds, even
+		// if it was made available some other way.
+		if disabled, err := checkInDisabled(ctx, req.Storage, serviceAccountName); err != nil {
+			return nil, err
+		} else if disabled {
+			continue
+		}
+		// The password is verified before the account is marked checked out, so
+		// if AD can't be reached the account is left available.
+		password, err := b.verifiedPassword(ctx, req.Storage, engineConf, serviceAccountName)
 		if err != nil {
+			return errorResponseFor(err)
+		}
+		if err := b.checkOutHandler.CheckOut(ctx, req.Storage, serviceAccountName, newCheckOut); err != nil {
+			return nil, err
+		}
+		if approvalID != "" {
+			// Each approval is good for a single check-out.
+			if err := req.Storage.Delete(ctx, approvalStoragePrefix+setName+"/"+approvalID); err != nil {
+				return nil, err
+			}
+		}
+		leaseTTL, leaseMaxTTL := b.leaseTTLs(engineConf.libraryTTLs(set.ttlsFor(serviceAccountName, ttl)))
+		dueAt := b.now().Add(leaseTTL).UTC()
+		newCheckOut.DueAt, newCheckOut.CheckedOutAt = dueAt, b.now().UTC()
+		if err := b.checkOutHandler.Update(ctx, req.Storage, serviceAccountName, newCheckOut); err != nil {
 			return nil, err
 		}
 		respData := map[string]interface{}{
 			"service_account_name": serviceAccountName,
 			"password":             password,
+			"checkout_id":          checkOutID,
+			"set_name":             setName,
+			"due_at":               dueAt,
 		}
+		// The lease carries enough to tell which borrow it is without reading
+		// storage, for lease lookups and revocation tooling.
 		internalData := map[string]interface{}{
 			"service_account_name": serviceAccountName,
 			"set_name":             setName,
+			"checkout_id":          checkOutID,
+			"due_at":               dueAt.Format(time.RFC3339),
+		}
+		if reason != "" {
+			respData["reason"] = reason
+			internalData["reason"] = reason
+		}
+		b.usage.checkedOut(ctx, req.Storage, b.now(), setName, newCheckOut.BorrowerEntityID)
+		webhookData := map[string]interface{}{
+			"set_name":             setName,
+			"service_account_name": serviceAccountName,
+			"checkout_id":          checkOutID,
+			"entity_id":            newCheckOut.BorrowerEntityID,
+		}
+		if newCheckOut.Operator != "" {
+			webhookData["operator"] = newCheckOut.Operator
+			b.Logger().Info("checked out service account on behalf of another entity", "set", setName, "service_account_name", serviceAccountName, "borrower_entity_id", borrowerEntityID, "operator", newCheckOut.Operator)
 		}
+		b.notifyWebhook(ctx, req.Storage, webhookEventCheckOut, webhookData)
 		resp := b.Backend.Secret(secretAccessKeyType).Response(respData, internalData)
 		resp.Secret.Renewable = true
-		resp.Secret.TTL = ttl
-		resp.Secret.MaxTTL = set.MaxTTL
+		resp.Secret.TTL, resp.Secret.MaxTTL = leaseTTL, leaseMaxTTL
+		b.addAccountIDs(engineConf, serviceAccountName, resp)
+		b.addKerberosInfo(engineConf, serviceAccountName, resp)
 		return resp, nil
 	}
 
@@ -110,7 +440,49 @@ func (b *backend) operationSetCheckOut(ctx context.Context, req *logical.Request
 	// In case of customer issues, we need to make this easy to see and diagnose.
 	b.Logger().Debug(fmt.Sprintf(`%q had no check-outs available`, setName))
 	metrics.IncrCounter([]string{"active directory", "check-out", "unavailable", setName}, 1)
-	return logical.ErrorResponse("No service accounts available for check-out."), nil
+	return nil, nil
+}
+
+// verifiedPassword returns the stored password for a service account. Passwords set
+// or verified in the current storage epoch are returned as they are. Older ones may
+// have come from a snapshot restore or migration, so they're checked against AD: if
+// AD shows the password was set after Vault last rotated it, the stored password no
+// longer works, so it's rotated before being returned.
+func (b *backend) verifiedPassword(ctx context.Context, storage logical.Storage, engineConf *configuration, serviceAccountName string) (string, error) {
+	stored, err := loadPassword(ctx, storage, b.transit, serviceAccountName)
+	if err != nil {
+		return "", err
+	}
+	epoch, err := readStorageEpoch(ctx, storage)
+	if err != nil {
+		return "", err
+	}
+	if epoch != "" && stored.Epoch == epoch {
+		return stored.Password, nil
+	}
+	passwordLastSet, err := b.client.GetPasswordLastSet(engineConf.ADConf, serviceAccountName)
+	if err != nil {
+		return "", err
+	}
+	tolerance := time.Duration(engineConf.LastRotationTolerance) * time.Second
+	if !passwordLastSet.After(stored.LastRotated.Add(tolerance)) {
+		// AD agrees, so mark it verified in this epoch. It's rewritten as it was
+		// loaded, still encrypted if it is.
+		metadata, err := loadPasswordMetadata(ctx, storage, serviceAccountName)
+		if err != nil {
+			return "", err
+		}
+		if err := writePassword(ctx, storage, serviceAccountName, metadata); err != nil {
+			return "", err
+		}
+		return stored.Password, nil
+	}
+	b.Logger().Warn(fmt.Sprintf(
+		"Vault stored the password for %s at %s, but it was set in AD later at %s, so rotating it again so Vault will know it",
+		serviceAccountName, stored.LastRotated.String(), passwordLastSet.String()),
+	)
+	metrics.IncrCounter([]string{"active directory", "check-out", "stale password"}, 1)
+	return b.checkOutHandler.RotatePassword(ctx, storage, serviceAccountName)
 }
 
 func (b *backend) secretAccessKeys() *framework.Secret {
@@ -134,15 +506,15 @@ func (b *backend) secretAccessKeys() *framework.Secret {
 func (b *backend) renewCheckOut(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
 	setName := req.Secret.InternalData["set_name"].(string)
 	lock := locksutil.LockForKey(b.checkOutLocks, setName)
-	lock.RLock()
-	defer lock.RUnlock()
+	lock.Lock()
+	defer lock.Unlock()
 
 	set, err := readSet(ctx, req.Storage, setName)
 	if err != nil {
 		return nil, err
 	}
 	if set == nil {
-		return logical.ErrorResponse(fmt.Sprintf(`%q doesn't exist`, setName)), nil
+		return codedErrorResponse(errCodeSetNotFound, `%q doesn't exist`, setName), nil
 	}
 
 	serviceAccountName := req.Secret.InternalData["service_account_name"].(string)
@@ -153,30 +525,104 @@ func (b *backend) renewCheckOut(ctx context.Context, req *logical.Request, field
 	if checkOut.IsAvailable {
 		// It's possible that this renewal could be attempted after a check-in occurred either by this entity or by
 		// another user with access to the "manage check-ins" endpoint that forcibly checked it back in.
-		return logical.ErrorResponse(fmt.Sprintf("%s is already checked in, please call check-out to regain it", serviceAccountName)), nil
+		return codedErrorResponse(errCodeAlreadyCheckedIn, "%s is already checked in, please call check-out to regain it", serviceAccountName), nil
+	}
+	// Vault's expiration manager renews leases without the client's address, so
+	// the network a check-out is bound to is only checked by the library's renew
+	// path.
+	if isQuarantined, err := quarantined(ctx, req.Storage, serviceAccountName); err != nil {
+		return nil, err
+	} else if isQuarantined {
+		return codedErrorResponse(errCodeAccountQuarantined, "%s was quarantined because its check-ins kept failing, and can't be renewed", serviceAccountName), nil
+	}
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
 	}
 	resp := &logical.Response{Secret: req.Secret}
-	resp.Secret.TTL = set.TTL
-	resp.Secret.MaxTTL = set.MaxTTL
+	resp.Secret.TTL, resp.Secret.MaxTTL = b.leaseTTLs(engineConf.libraryTTLs(set.ttlsFor(serviceAccountName, set.TTL)))
+	resp.Secret.TTL, resp.Secret.MaxTTL = b.extendedLeaseTTLs(checkOut, req.Secret.IssueTime, resp.Secret.TTL, resp.Secret.MaxTTL)
+	dueAt := b.now().Add(resp.Secret.TTL).UTC()
+	resp.Secret.InternalData["due_at"] = dueAt.Format(time.RFC3339)
+	// The renewal moves the due time, so the borrower is warned again before it.
+	// A renewal never makes the check-out due sooner than the library's renew
+	// path already let it last.
+	if dueAt.After(checkOut.DueAt) {
+		checkOut.DueAt, checkOut.DueWarningSent = dueAt, false
+	}
+	if err := b.checkOutHandler.Update(ctx, req.Storage, serviceAccountName, checkOut); err != nil {
+		return nil, err
+	}
 	return resp, nil
 }
 
 func (b *backend) endCheckOut(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	if b.isReplicatedFollower() {
+		return nil, logical.ErrReadOnly
+	}
+
 	setName := req.Secret.InternalData["set_name"].(string)
 	lock := locksutil.LockForKey(b.checkOutLocks, setName)
 	lock.Lock()
 	defer lock.Unlock()
 
 	serviceAccountName := req.Secret.InternalData["service_account_name"].(string)
+	// The lease's due time is used for leases issued before check-outs were
+	// stored with theirs.
+	var dueAt time.Time
+	if dueAtRaw, ok := req.Secret.InternalData["due_at"].(string); ok {
+		dueAt, _ = time.Parse(time.RFC3339, dueAtRaw)
+	}
+	if checkOutID, ok := req.Secret.InternalData["checkout_id"].(string); ok {
+		// If the account was since checked in and out again, the lease being
+		// revoked no longer owns it.
+		checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, req.Storage, serviceAccountName)
+		if err == errNotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if checkOut.IsAvailable || (checkOut.ID != "" && checkOut.ID != checkOutID) {
+			return nil, nil
+		}
+		if b.leaseLapsed(req, checkOut) {
+			checkOut.LeaseLapsed = true
+			if err := b.checkOutHandler.Update(ctx, req.Storage, serviceAccountName, checkOut); err != nil {
+				return nil, err
+			}
+			b.Logger().Info("check-out outlived its lease", "set", setName, "service_account_name", serviceAccountName, "due_at", checkOut.DueAt)
+			return nil, nil
+		}
+		dueAt = checkOut.DueAt
+	}
 	if err := b.checkOutHandler.CheckIn(ctx, req.Storage, serviceAccountName); err != nil {
+		b.enqueueRetry(ctx, req.Storage, retryKindCheckIn, serviceAccountName, setName, err)
 		return nil, err
 	}
+	b.clearRetry(ctx, req.Storage, retryKindCheckIn, serviceAccountName)
+	// A lease revoked before it's due, like by its borrower or with its token,
+	// isn't overdue.
+	if dueAt.IsZero() || b.now().Before(dueAt) {
+		return nil, nil
+	}
+	checkOutID, _ := req.Secret.InternalData["checkout_id"].(string)
+	b.notifyWebhook(ctx, req.Storage, webhookEventCheckOutOverdue, map[string]interface{}{
+		"set_name":             setName,
+		"service_account_name": serviceAccountName,
+		"checkout_id":          checkOutID,
+	})
 	return nil, nil
 }
 
 func (b *backend) pathSetCheckIn() *framework.Path {
 	return &framework.Path{
 		Pattern: libraryPrefix + framework.GenericNameRegex("name") + "/check-in$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "check-in",
+			OperationSuffix: "library-accounts",
+		},
 		Fields: map[string]*framework.FieldSchema{
 			"name": {
 				Type:        framework.TypeLowerCaseString,
@@ -187,11 +633,23 @@ func (b *backend) pathSetCheckIn() *framework.Path {
 				Type:        framework.TypeCommaStringSlice,
 				Description: "The username/logon name for the service accounts to check in.",
 			},
+			"checkout_id": {
+				Type:        framework.TypeString,
+				Description: "The ID returned by check-out for the service account to check in. Can't be used with service_account_names.",
+			},
 		},
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.UpdateOperation: &framework.PathOperation{
-				Callback: b.operationCheckIn(false),
-				Summary:  "Check service accounts in to the library.",
+				Callback:                    b.operationCheckIn(false),
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Check service accounts in to the library.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields:      checkInResponseFields(),
+					}},
+				},
 			},
 		},
 		HelpSynopsis: `Check service accounts in to the library.`,
@@ -201,6 +659,11 @@ func (b *backend) pathSetCheckIn() *framework.Path {
 func (b *backend) pathSetManageCheckIn() *framework.Path {
 	return &framework.Path{
 		Pattern: libraryPrefix + "manage/" + framework.GenericNameRegex("name") + "/check-in$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "force-check-in",
+			OperationSuffix: "library-accounts",
+		},
 		Fields: map[string]*framework.FieldSchema{
 			"name": {
 				Type:        framework.TypeLowerCaseString,
@@ -211,17 +674,39 @@ func (b *backend) pathSetManageCheckIn() *framework.Path {
 				Type:        framework.TypeCommaStringSlice,
 				Description: "The username/logon name for the service accounts to check in.",
 			},
+			"checkout_id": {
+				Type:        framework.TypeString,
+				Description: "The ID returned by check-out for the service account to check in. Can't be used with service_account_names.",
+			},
 		},
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.UpdateOperation: &framework.PathOperation{
-				Callback: b.operationCheckIn(true),
-				Summary:  "Check service accounts in to the library.",
+				Callback:                    b.operationCheckIn(true),
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Force checking service accounts in to the library.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields:      checkInResponseFields(),
+					}},
+				},
 			},
 		},
 		HelpSynopsis: `Force checking service accounts in to the library.`,
 	}
 }
 
+// checkInResponseFields describes the fields returned by check-ins.
+func checkInResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"check_ins": {
+			Type:        framework.TypeStringSlice,
+			Description: "The service accounts that were checked in.",
+		},
+	}
+}
+
 func (b *backend) operationCheckIn(overrideCheckInEnforcement bool) framework.OperationFunc {
 	return func(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
 		setName := fieldData.Get("name").(string)
@@ -240,7 +725,21 @@ func (b *backend) operationCheckIn(overrideCheckInEnforcement bool) framework.Op
 			return nil, err
 		}
 		if set == nil {
-			return logical.ErrorResponse(fmt.Sprintf(`%q doesn't exist`, setName)), nil
+			return codedErrorResponse(errCodeSetNotFound, `%q doesn't exist`, setName), nil
+		}
+
+		if checkOutID := fieldData.Get("checkout_id").(string); checkOutID != "" {
+			if serviceAccountNamesSent {
+				return codedErrorResponse(errCodeInvalidRequest, `"checkout_id" and "service_account_names" can't both be provided`), nil
+			}
+			serviceAccountName, err := b.findCheckOut(ctx, req.Storage, set, checkOutID)
+			if err != nil {
+				return nil, err
+			}
+			if serviceAccountName == "" {
+				return codedErrorResponse(errCodeCheckOutNotFound, "no service account in %q is checked out with ID %q", setName, checkOutID), nil
+			}
+			serviceAccountNames = []string{serviceAccountName}
 		}
 
 		// If check-in enforcement is overridden or disabled at the set level, we should consider it disabled.
@@ -265,30 +764,56 @@ func (b *backend) operationCheckIn(overrideCheckInEnforcement bool) framework.Op
 				if !disableCheckInEnforcement && !checkinAuthorized(req, checkOut) {
 					continue
 				}
+				if !overrideCheckInEnforcement && !checkOut.fromNetwork(req) {
+					return codedErrorResponse(errCodeNetworkMismatch, "%q can only be checked in from %s, where it was checked out", setServiceAccount, checkOut.Network), nil
+				}
+				if resp, err := quarantinedCheckInResponse(ctx, req.Storage, setName, setServiceAccount, overrideCheckInEnforcement); resp != nil || err != nil {
+					return resp, err
+				}
 				toCheckIn = append(toCheckIn, setServiceAccount)
 			}
 			if len(toCheckIn) > 1 {
-				return logical.ErrorResponse(`when multiple service accounts are checked out, the "service_account_names" to check in must be provided`), nil
+				return codedErrorResponse(errCodeInvalidRequest, `when multiple service accounts are checked out, the "service_account_names" to check in must be provided`), nil
 			}
 		} else {
-			for _, serviceAccountName := range serviceAccountNames {
+			for _, requestedName := range serviceAccountNames {
+				// The set's spelling is used, since its storage entries are keyed by it.
+				serviceAccountName := findServiceAccountName(set.ServiceAccountNames, requestedName)
+				if serviceAccountName == "" {
+					return codedErrorResponse(errCodeInvalidRequest, "%q isn't managed by %q", requestedName, setName), nil
+				}
 				checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, req.Storage, serviceAccountName)
 				if err != nil {
 					return nil, err
 				}
 				// First guard that they should be able to do anything at all.
 				if !checkOut.IsAvailable && !disableCheckInEnforcement && !checkinAuthorized(req, checkOut) {
-					return logical.ErrorResponse("%q can't be checked in because it wasn't checked out by the caller", serviceAccountName), nil
+					return codedErrorResponse(errCodeNotCheckedOutByCaller, "%q can't be checked in because it wasn't checked out by the caller", serviceAccountName), nil
 				}
 				if checkOut.IsAvailable {
 					continue
 				}
+				if !overrideCheckInEnforcement && !checkOut.fromNetwork(req) {
+					return codedErrorResponse(errCodeNetworkMismatch, "%q can only be checked in from %s, where it was checked out", serviceAccountName, checkOut.Network), nil
+				}
+				if resp, err := quarantinedCheckInResponse(ctx, req.Storage, setName, serviceAccountName, overrideCheckInEnforcement); resp != nil || err != nil {
+					return resp, err
+				}
 				toCheckIn = append(toCheckIn, serviceAccountName)
 			}
 		}
 		for _, serviceAccountName := range toCheckIn {
 			if err := b.checkOutHandler.CheckIn(ctx, req.Storage, serviceAccountName); err != nil {
-				return nil, err
+				b.enqueueRetry(ctx, req.Storage, retryKindCheckIn, serviceAccountName, setName, err)
+				return errorResponseFor(err)
+			}
+			b.clearRetry(ctx, req.Storage, retryKindCheckIn, serviceAccountName)
+			if overrideCheckInEnforcement {
+				b.notifyWebhook(ctx, req.Storage, webhookEventForcedCheckIn, map[string]interface{}{
+					"set_name":             setName,
+					"service_account_name": serviceAccountName,
+					"entity_id":            req.EntityID,
+				})
 			}
 		}
 		return &logical.Response{
@@ -299,9 +824,28 @@ func (b *backend) operationCheckIn(overrideCheckInEnforcement bool) framework.Op
 	}
 }
 
+// quarantinedCheckInResponse refuses to check in a quarantined service account
+// except through the manage path, so an operator looks into why its check-ins
+// kept failing before it's lent again.
+func quarantinedCheckInResponse(ctx context.Context, storage logical.Storage, setName, serviceAccountName string, overrideCheckInEnforcement bool) (*logical.Response, error) {
+	if overrideCheckInEnforcement {
+		return nil, nil
+	}
+	isQuarantined, err := quarantined(ctx, storage, serviceAccountName)
+	if err != nil || !isQuarantined {
+		return nil, err
+	}
+	return codedErrorResponse(errCodeAccountQuarantined, "%q was quarantined because its check-ins kept failing, and must be checked in with %q", serviceAccountName, libraryPrefix+"manage/"+setName+"/check-in"), nil
+}
+
 func (b *backend) pathSetStatus() *framework.Path {
 	return &framework.Path{
 		Pattern: libraryPrefix + framework.GenericNameRegex("name") + "/status$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "check-status",
+			OperationSuffix: "library-set",
+		},
 		Fields: map[string]*framework.FieldSchema{
 			"name": {
 				Type:        framework.TypeLowerCaseString,
@@ -313,6 +857,12 @@ func (b *backend) pathSetStatus() *framework.Path {
 			logical.ReadOperation: &framework.PathOperation{
 				Callback: b.operationSetStatus,
 				Summary:  "Check the status of the service accounts in a library set.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						// The fields are keyed by service account name.
+						Description: "OK",
+					}},
+				},
 			},
 		},
 		HelpSynopsis: `Check the status of the service accounts in a library.`,
@@ -330,7 +880,11 @@ func (b *backend) operationSetStatus(ctx context.Context, req *logical.Request,
 		return nil, err
 	}
 	if set == nil {
-		return logical.ErrorResponse(fmt.Sprintf(`%q doesn't exist`, setName)), nil
+		return codedErrorResponse(errCodeSetNotFound, `%q doesn't exist`, setName), nil
+	}
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
 	}
 	respData := make(map[string]interface{})
 
@@ -343,6 +897,28 @@ func (b *backend) operationSetStatus(ctx context.Context, req *logical.Request,
 		status := map[string]interface{}{
 			"available": checkOut.IsAvailable,
 		}
+		if cooldownEnds, ok := set.coolingDown(checkOut, b.now()); ok {
+			// It's checked in, but won't be lent out again until its cooldown ends.
+			status["available"] = false
+			status["cooldown_ends"] = cooldownEnds
+		}
+		stored, err := loadPasswordMetadata(ctx, req.Storage, serviceAccountName)
+		if err != nil && err != errNotFound {
+			return nil, err
+		}
+		if stored != nil && !stored.LastRotated.IsZero() {
+			// A stalled rotation shows up as an account whose password stays old
+			// however often it's checked in.
+			status["password_last_rotated"] = stored.LastRotated
+		}
+		if stored != nil && stored.ExternallySet {
+			// An externally set password is reported whether or not the account is
+			// checked out, because it's known outside of Vault either way.
+			status["password_externally_set"] = true
+			status["password_set_by_entity_id"] = stored.SetByEntityID
+			status["password_set_by_display_name"] = stored.SetByDisplayName
+			status["password_set_time"] = stored.LastRotated
+		}
 		if checkOut.IsAvailable {
 			// We only omit all other fields if the checkout is currently available,
 			// because they're only relevant to accounts that aren't checked out.
@@ -355,6 +931,51 @@ func (b *backend) operationSetStatus(ctx context.Context, req *logical.Request,
 		if checkOut.BorrowerEntityID != "" {
 			status["borrower_entity_id"] = checkOut.BorrowerEntityID
 		}
+		if checkOut.ID != "" {
+			status["checkout_id"] = checkOut.ID
+		}
+		if checkOut.Network != "" {
+			status["network"] = checkOut.Network
+		}
+		if checkOut.Operator != "" {
+			status["operator"] = checkOut.Operator
+		}
+		if checkOut.RemoteAddress != "" {
+			status["remote_address"] = checkOut.RemoteAddress
+		}
+		if checkOut.TokenAccessor != "" {
+			status["token_accessor"] = checkOut.TokenAccessor
+		}
+		if checkOut.Reason != "" {
+			status["reason"] = checkOut.Reason
+		}
+		if !checkOut.DueAt.IsZero() {
+			status["due_at"] = checkOut.DueAt
+			if engineConf != nil && engineConf.DueWarningWindow > 0 {
+				status["expiring_soon"] = checkOut.expiringSoon(engineConf, b.now())
+			}
+		}
+		if checkOut.LeaseLapsed {
+			status["lease_lapsed"] = true
+		}
+		if !checkOut.ExtendedUntil.IsZero() {
+			status["extended_until"] = checkOut.ExtendedUntil
+			status["extended_by"] = checkOut.ExtendedBy
+		}
+		retry, err := readRetryTask(ctx, req.Storage, retryKindCheckIn, serviceAccountName)
+		if err != nil {
+			return nil, err
+		}
+		if retry != nil {
+			status["check_in_failures"] = retry.Attempts
+			status["check_in_stopped"] = retry.Stopped
+			if retry.Quarantined {
+				status["quarantined"] = true
+			}
+			if retry.Disabled {
+				status["disabled"] = true
+			}
+		}
 		respData[serviceAccountName] = status
 	}
 	return &logical.Response{
@@ -362,6 +983,24 @@ func (b *backend) operationSetStatus(ctx context.Context, req *logical.Request,
 	}, nil
 }
 
+// findCheckOut returns the service account in the set that's checked out with the
+// given ID, or "" if none is.
+func (b *backend) findCheckOut(ctx context.Context, storage logical.Storage, set *librarySet, checkOutID string) (string, error) {
+	for _, serviceAccountName := range set.ServiceAccountNames {
+		checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, storage, serviceAccountName)
+		if err == errNotFound {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if !checkOut.IsAvailable && checkOut.ID == checkOutID {
+			return serviceAccountName, nil
+		}
+	}
+	return "", nil
+}
+
 func checkinAuthorized(req *logical.Request, checkOut *CheckOut) bool {
 	if checkOut.BorrowerEntityID != "" && req.EntityID != "" {
 		if checkOut.BorrowerEntityID == req.EntityID {
@@ -375,3 +1014,22 @@ func checkinAuthorized(req *logical.Request, checkOut *CheckOut) bool {
 	}
 	return false
 }
+
+const (
+	manageCheckOutHelpSynopsis = `
+Check a service account out from the library on behalf of another entity.
+`
+	manageCheckOutHelpDescription = `
+Checks a service account out to the entity named by "entity_id", for operators
+and automation that reserve accounts for users. The password is returned to the
+caller to hand over, and the check-out's lease belongs to the caller's token.
+
+The entity may check the service account in as if it had checked it out
+itself, and the set's status reports who checked it out on its behalf. Sets
+requiring approval still require it here: "approval_id" must name a check-out
+request the entity made that another entity approved, and it's used up like it
+would be by the entity's own check-out. The check-out isn't bound to the
+caller's network, since it says nothing about the borrower's. Like the other
+manage paths, it's meant to be allowed only to administrators.
+`
+)
@@ -4,9 +4,14 @@
 package plugin
 
 import (
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
 )
 
 func TestCheckInAuthorized(t *testing.T) {
@@ -31,3 +36,691 @@ func TestCheckInAuthorized(t *testing.T) {
 		t.Fatal("when insufficient auth info is provided, check-in should not be allowed")
 	}
 }
+
+type passwordLastSetFake struct {
+	fakeSecretsClient
+	passwordLastSet    time.Time
+	lookupErr          error
+	numLookups         int
+	numPasswordUpdates int
+}
+
+func (f *passwordLastSetFake) GetPasswordLastSet(conf *client.ADConf, serviceAccountName string) (time.Time, error) {
+	f.numLookups++
+	return f.passwordLastSet, f.lookupErr
+}
+
+func (f *passwordLastSetFake) UpdatePassword(conf *client.ADConf, serviceAccountName string, newPassword string) error {
+	f.numPasswordUpdates++
+	return nil
+}
+
+func TestVerifiedPassword(t *testing.T) {
+	ctx, storage, serviceAccountName, _ := setup()
+	engineConf, err := readConfig(ctx, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engineConf.LastRotationTolerance = 5
+
+	fake := &passwordLastSetFake{}
+	b := newBackend(fake, nil)
+	if err := b.checkOutHandler.CheckIn(ctx, storage, serviceAccountName); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := loadPassword(ctx, storage, b.transit, serviceAccountName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// AD agrees with when Vault last set the password.
+	fake.passwordLastSet = stored.LastRotated
+	password, err := b.verifiedPassword(ctx, storage, engineConf, serviceAccountName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password != stored.Password {
+		t.Fatal("expected the stored password to be returned")
+	}
+	if fake.numPasswordUpdates != 1 {
+		t.Fatalf("expected 1 password update but received %d", fake.numPasswordUpdates)
+	}
+
+	// AD shows the password was set after Vault last set it, as it would if
+	// storage were restored from a snapshot.
+	fake.passwordLastSet = stored.LastRotated.Add(time.Hour)
+	password, err = b.verifiedPassword(ctx, storage, engineConf, serviceAccountName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password == stored.Password {
+		t.Fatal("expected the stale password to be rotated")
+	}
+	if fake.numPasswordUpdates != 2 {
+		t.Fatalf("expected 2 password updates but received %d", fake.numPasswordUpdates)
+	}
+	currPassword, err := retrievePassword(ctx, storage, b.transit, serviceAccountName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if currPassword != password {
+		t.Fatal("expected the rotated password to be stored")
+	}
+}
+
+func TestVerifiedPasswordStorageEpoch(t *testing.T) {
+	ctx, storage, serviceAccountName, _ := setup()
+	engineConf, err := readConfig(ctx, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &passwordLastSetFake{}
+	b := newBackend(fake, nil)
+	if err := b.startStorageEpoch(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.checkOutHandler.CheckIn(ctx, storage, serviceAccountName); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := loadPassword(ctx, storage, b.transit, serviceAccountName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.passwordLastSet = stored.LastRotated
+
+	// The password was set in this epoch, so AD isn't asked about it.
+	if _, err := b.verifiedPassword(ctx, storage, engineConf, serviceAccountName); err != nil {
+		t.Fatal(err)
+	}
+	if fake.numLookups != 0 {
+		t.Fatalf("expected no lookups but received %d", fake.numLookups)
+	}
+
+	// Storage that no longer holds the backend's epoch, as it wouldn't after a
+	// restore, starts a new one, and the password is verified once in it.
+	if err := storage.Delete(ctx, storageEpochStorageKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.checkStorageEpoch(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		password, err := b.verifiedPassword(ctx, storage, engineConf, serviceAccountName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if password != stored.Password {
+			t.Fatal("expected the stored password to be returned")
+		}
+	}
+	if fake.numLookups != 1 {
+		t.Fatalf("expected 1 lookup but received %d", fake.numLookups)
+	}
+
+	// If AD can't be asked, the check-out fails and the account stays available.
+	if err := b.startStorageEpoch(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+	fake.lookupErr = errors.New("unreachable")
+	set := &librarySet{ServiceAccountNames: []string{serviceAccountName}}
+	req := &logical.Request{Storage: storage, EntityID: "entity-id"}
+	resp, err := b.checkOutFromSet(ctx, req, engineConf, "test-set", set, 0, "", "", "")
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("expected the check-out to fail")
+	}
+	checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, storage, serviceAccountName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !checkOut.IsAvailable {
+		t.Fatal("expected the account to remain available")
+	}
+}
+
+func TestLoadLegacyPassword(t *testing.T) {
+	ctx, storage, serviceAccountName, _ := setup()
+	entry, err := logical.StorageEntryJSON(passwordStoragePrefix+serviceAccountName, "legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := loadPassword(ctx, storage, nil, serviceAccountName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Password != "legacy" {
+		t.Fatalf("expected \"legacy\" but received %q", stored.Password)
+	}
+	if !stored.LastRotated.IsZero() {
+		t.Fatal("expected an unknown rotation time")
+	}
+}
+
+func TestDisallowUnlimitedTTL(t *testing.T) {
+	engineConf := testConfig()
+	b, storage := getBackend(t, &fakeSecretsClient{}, engineConf)
+	handle := requester(t, b, storage, "borrower")
+
+	// Written before unlimited check-outs were disallowed.
+	for setName, set := range map[string]map[string]interface{}{
+		"open-ended": {
+			"service_account_names": []string{"tester1@example.com"},
+			"ttl":                   0,
+			"max_ttl":               0,
+		},
+		"no-ttl": {
+			"service_account_names": []string{"tester2@example.com"},
+			"ttl":                   0,
+			"max_ttl":               150,
+		},
+	} {
+		resp := handle(logical.CreateOperation, libraryPrefix+setName, set)
+		if resp != nil && resp.IsError() {
+			t.Fatalf("bad: %#v", resp)
+		}
+	}
+
+	engineConf.DisallowUnlimitedTTL = true
+	if err := writeConfig(ctx, storage, engineConf); err != nil {
+		t.Fatal(err)
+	}
+	resp := handle(logical.CreateOperation, libraryPrefix+"another", map[string]interface{}{
+		"service_account_names": []string{"tester3@example.com"},
+		"ttl":                   0,
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected a set with an unlimited ttl to be rejected")
+	}
+	resp = handle(logical.UpdateOperation, libraryPrefix+"open-ended/check-out", map[string]interface{}{
+		"ttl": 60,
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected a check-out with unlimited renewals to be rejected")
+	}
+	resp = handle(logical.UpdateOperation, libraryPrefix+"no-ttl/check-out", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected a check-out without a ttl to be rejected")
+	}
+	resp = handle(logical.UpdateOperation, libraryPrefix+"no-ttl/check-out", map[string]interface{}{
+		"ttl": 60,
+	})
+	if resp == nil || resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
+func TestCheckInByCheckOutID(t *testing.T) {
+	b, storage := getBackend(t, &fakeSecretsClient{}, testConfig())
+	handle := requester(t, b, storage, "borrower")
+
+	if resp := handle(logical.CreateOperation, libraryPrefix+"test-set", map[string]interface{}{
+		"service_account_names": []string{"tester1@example.com", "tester2@example.com"},
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	first := handle(logical.UpdateOperation, libraryPrefix+"test-set/check-out", nil)
+	second := handle(logical.UpdateOperation, libraryPrefix+"test-set/check-out", nil)
+	if first == nil || first.IsError() || second == nil || second.IsError() {
+		t.Fatalf("bad: %#v, %#v", first, second)
+	}
+	firstID := first.Data["checkout_id"].(string)
+	secondID := second.Data["checkout_id"].(string)
+	if firstID == "" || firstID == secondID {
+		t.Fatalf("expected distinct check-out IDs but received %q and %q", firstID, secondID)
+	}
+	status := handle(logical.ReadOperation, libraryPrefix+"test-set/status", nil)
+	if status.Data[second.Data["service_account_name"].(string)].(map[string]interface{})["checkout_id"] != secondID {
+		t.Fatalf("expected the status to include the check-out ID but received %#v", status.Data)
+	}
+
+	resp := handle(logical.UpdateOperation, libraryPrefix+"test-set/check-in", map[string]interface{}{
+		"checkout_id": "not-a-check-out",
+	})
+	if responseErrorCode(resp) != string(errCodeCheckOutNotFound) {
+		t.Fatalf("expected an unknown check-out ID to be rejected but received %#v", resp)
+	}
+	resp = handle(logical.UpdateOperation, libraryPrefix+"test-set/check-in", map[string]interface{}{
+		"checkout_id":           secondID,
+		"service_account_names": []string{"tester1@example.com"},
+	})
+	if responseErrorCode(resp) != string(errCodeInvalidRequest) {
+		t.Fatalf("expected checkout_id with service_account_names to be rejected but received %#v", resp)
+	}
+	resp = handle(logical.UpdateOperation, libraryPrefix+"test-set/check-in", map[string]interface{}{
+		"checkout_id": secondID,
+	})
+	if resp == nil || resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if checkIns := resp.Data["check_ins"].([]string); len(checkIns) != 1 || checkIns[0] != second.Data["service_account_name"] {
+		t.Fatalf("expected only the second check-out to be checked in but received %#v", checkIns)
+	}
+
+	// Revoking the lease of an earlier check-out of the same account leaves the
+	// current one alone.
+	third := handle(logical.UpdateOperation, libraryPrefix+"test-set/check-out", nil)
+	if third == nil || third.IsError() || third.Data["service_account_name"] != second.Data["service_account_name"] {
+		t.Fatalf("bad: %#v", third)
+	}
+	if _, err := b.endCheckOut(ctx, &logical.Request{
+		Storage: storage,
+		Secret: &logical.Secret{
+			InternalData: second.Secret.InternalData,
+		},
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, storage, third.Data["service_account_name"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkOut.IsAvailable || checkOut.ID != third.Data["checkout_id"] {
+		t.Fatalf("expected the current check-out to remain but received %#v", checkOut)
+	}
+}
+
+func TestManageCheckOut(t *testing.T) {
+	b, storage := getBackendWithSystemView(t, newMemoryDirectory(), testConfig(), &logical.StaticSystemView{
+		DefaultLeaseTTLVal: defaultLeaseTTLVal,
+		MaxLeaseTTLVal:     maxLeaseTTLVal,
+		EntityVal:          &logical.Entity{ID: "user"},
+	})
+	handle := func(operation logical.Operation, path string, data map[string]interface{}, entityID string) *logical.Response {
+		t.Helper()
+		return sendRequest(t, b, storage, &logical.Request{
+			Operation:   operation,
+			Path:        path,
+			Data:        data,
+			EntityID:    entityID,
+			ClientToken: entityID + "-token",
+		})
+	}
+
+	handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com"},
+		"require_approval":      true,
+	}, "")
+	if resp := handle(logical.UpdateOperation, libraryPrefix+"manage/lib/check-out", nil, "helpdesk"); resp == nil || !resp.IsError() {
+		t.Fatalf("expected a missing entity_id to be refused but received %#v", resp)
+	}
+
+	// Operators can't skip the set's approval.
+	if resp := handle(logical.UpdateOperation, libraryPrefix+"manage/lib/check-out", map[string]interface{}{
+		"entity_id": "user",
+	}, "helpdesk"); resp == nil || !resp.IsError() {
+		t.Fatalf("expected a check-out without an approval to be refused but received %#v", resp)
+	}
+	approvalID := handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil, "user").Data["approval_id"].(string)
+	if resp := handle(logical.UpdateOperation, libraryPrefix+"manage/lib/check-out", map[string]interface{}{
+		"entity_id":   "user",
+		"approval_id": approvalID,
+	}, "helpdesk"); resp == nil || !resp.IsError() {
+		t.Fatalf("expected a check-out with a pending approval to be refused but received %#v", resp)
+	}
+	if resp := handle(logical.UpdateOperation, libraryPrefix+"lib/approvals/"+approvalID, nil, "approver"); resp != nil && resp.IsError() {
+		t.Fatalf("unable to approve: %#v", resp)
+	}
+	if resp := handle(logical.UpdateOperation, libraryPrefix+"manage/lib/check-out", map[string]interface{}{
+		"entity_id":   "someone else",
+		"approval_id": approvalID,
+	}, "helpdesk"); resp == nil || !resp.IsError() {
+		t.Fatalf("expected another entity's approval to be refused but received %#v", resp)
+	}
+	resp := handle(logical.UpdateOperation, libraryPrefix+"manage/lib/check-out", map[string]interface{}{
+		"entity_id":   "user",
+		"approval_id": approvalID,
+	}, "helpdesk")
+	if resp == nil || resp.IsError() || resp.Data["password"] == nil {
+		t.Fatalf("unable to check out on the user's behalf: %#v", resp)
+	}
+	status := handle(logical.ReadOperation, libraryPrefix+"lib/status", nil, "").Data["a@example.com"].(map[string]interface{})
+	if status["borrower_entity_id"] != "user" || status["operator"] != "helpdesk" || status["borrower_client_token"] != nil {
+		t.Fatalf("expected the check-out to record the user and operator but received %#v", status)
+	}
+
+	// The operator can't check it in like a borrower, but the user can.
+	if resp := handle(logical.UpdateOperation, libraryPrefix+"lib/check-in", map[string]interface{}{
+		"service_account_names": "a@example.com",
+	}, "helpdesk"); resp == nil || !resp.IsError() {
+		t.Fatalf("expected the operator's check-in to be refused but received %#v", resp)
+	}
+	resp = handle(logical.UpdateOperation, libraryPrefix+"lib/check-in", nil, "user")
+	if resp == nil || resp.IsError() || len(resp.Data["check_ins"].([]string)) != 1 {
+		t.Fatalf("expected the user to check it in but received %#v", resp)
+	}
+}
+
+func TestCheckOutCooldown(t *testing.T) {
+	b, storage := getBackend(t, newMemoryDirectory(), testConfig())
+	now := time.Now().UTC()
+	b.now = func() time.Time { return now }
+	b.checkOutHandler.now = b.now
+	handle := requester(t, b, storage, "borrower")
+
+	if resp := handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com"},
+		"check_out_cooldown":    -1,
+	}); resp == nil || !resp.IsError() {
+		t.Fatalf("expected a negative cooldown to be rejected but received %#v", resp)
+	}
+	handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com"},
+		"check_out_cooldown":    60,
+	})
+	if set := handle(logical.ReadOperation, libraryPrefix+"lib", nil); set.Data["check_out_cooldown"] != int64(60) {
+		t.Fatalf("unexpected set %#v", set.Data)
+	}
+
+	// Accounts that have never been checked in aren't cooling down.
+	if resp := handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil); resp == nil || resp.IsError() {
+		t.Fatalf("unable to check out: %#v", resp)
+	}
+	if resp := handle(logical.UpdateOperation, libraryPrefix+"lib/check-in", nil); resp == nil || resp.IsError() {
+		t.Fatalf("unable to check in: %#v", resp)
+	}
+
+	if resp := handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil); responseErrorCode(resp) != string(errCodeNoAccountsAvailable) {
+		t.Fatalf("expected the account to be cooling down but received %#v", resp)
+	}
+	status := handle(logical.ReadOperation, libraryPrefix+"lib/status", nil).Data["a@example.com"].(map[string]interface{})
+	if status["available"] != false || status["cooldown_ends"] != now.Add(time.Minute) {
+		t.Fatalf("unexpected status %#v", status)
+	}
+
+	now = now.Add(time.Minute)
+	if resp := handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil); resp == nil || resp.IsError() {
+		t.Fatalf("expected the account to be available once its cooldown ended but received %#v", resp)
+	}
+}
+
+func TestCheckOutConnectionMetadata(t *testing.T) {
+	b, storage := getBackend(t, newMemoryDirectory(), testConfig())
+	handle := func(req *logical.Request) *logical.Response {
+		t.Helper()
+		resp := sendRequest(t, b, storage, req)
+		if resp != nil && resp.IsError() {
+			t.Fatalf("unexpected error response %#v", resp)
+		}
+		return resp
+	}
+
+	handle(&logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      libraryPrefix + "lib",
+		Data: map[string]interface{}{
+			"service_account_names": []string{"a@example.com", "b@example.com"},
+		},
+	})
+	handle(&logical.Request{
+		Operation:           logical.UpdateOperation,
+		Path:                libraryPrefix + "lib/check-out",
+		EntityID:            "borrower",
+		ClientToken:         "borrower-token",
+		ClientTokenAccessor: "borrower-accessor",
+		Connection:          &logical.Connection{RemoteAddr: "10.0.1.5"},
+	})
+	// Vault doesn't always know where a request came from.
+	handle(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      libraryPrefix + "lib/check-out",
+		EntityID:  "borrower",
+	})
+
+	status := handle(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      libraryPrefix + "lib/status",
+	}).Data
+	first := status["a@example.com"].(map[string]interface{})
+	if first["remote_address"] != "10.0.1.5" || first["token_accessor"] != "borrower-accessor" {
+		t.Fatalf("expected the check-out to record where it came from but received %#v", first)
+	}
+	second := status["b@example.com"].(map[string]interface{})
+	if _, ok := second["remote_address"]; ok {
+		t.Fatalf("expected no remote address but received %#v", second)
+	}
+	if _, ok := second["token_accessor"]; ok {
+		t.Fatalf("expected no token accessor but received %#v", second)
+	}
+}
+
+func TestCheckOutLeaseMetadata(t *testing.T) {
+	b, storage := getBackend(t, newMemoryDirectory(), testConfig())
+	now := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	b.now = func() time.Time { return now }
+	handle := func(req *logical.Request) *logical.Response {
+		t.Helper()
+		req.EntityID = "borrower"
+		resp := sendRequest(t, b, storage, req)
+		if resp != nil && resp.IsError() {
+			t.Fatalf("unexpected error response %#v", resp)
+		}
+		return resp
+	}
+	handle(&logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      libraryPrefix + "lib",
+		Data: map[string]interface{}{
+			"service_account_names": []string{"a@example.com"},
+			"ttl":                   60,
+		},
+	})
+	checkOut := handle(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      libraryPrefix + "lib/check-out",
+		Data:      map[string]interface{}{"reason": "INC-1234"},
+	})
+	if checkOut.Data["set_name"] != "lib" || checkOut.Data["reason"] != "INC-1234" || checkOut.Data["due_at"] != now.Add(time.Minute) {
+		t.Fatalf("expected the check-out's metadata but received %#v", checkOut.Data)
+	}
+	internal := checkOut.Secret.InternalData
+	if internal["set_name"] != "lib" || internal["checkout_id"] != checkOut.Data["checkout_id"] || internal["reason"] != "INC-1234" || internal["due_at"] != now.Add(time.Minute).Format(time.RFC3339) {
+		t.Fatalf("expected the lease to carry the check-out's metadata but received %#v", internal)
+	}
+	status := handle(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      libraryPrefix + "lib/status",
+	}).Data["a@example.com"].(map[string]interface{})
+	if status["reason"] != "INC-1234" {
+		t.Fatalf("expected the reason in the status but received %#v", status)
+	}
+
+	// Renewing moves the due time.
+	now = now.Add(30 * time.Second)
+	renewed := handle(&logical.Request{
+		Operation: logical.RenewOperation,
+		Secret:    checkOut.Secret,
+	})
+	if renewed.Secret.InternalData["due_at"] != now.Add(time.Minute).Format(time.RFC3339) {
+		t.Fatalf("expected the due time to move but received %#v", renewed.Secret.InternalData)
+	}
+}
+
+func TestAccountTTLs(t *testing.T) {
+	b, storage := getBackend(t, newMemoryDirectory(), testConfig())
+	handle := requester(t, b, storage, "borrower")
+
+	if resp := handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com", "b@example.com"},
+		"account_ttls": map[string]interface{}{
+			"c@example.com": map[string]interface{}{"ttl": 10},
+		},
+	}); responseErrorCode(resp) != string(errCodeInvalidRequest) {
+		t.Fatalf("expected an account outside the set to be rejected but received %#v", resp)
+	}
+	if resp := handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com", "b@example.com"},
+		"max_ttl":               100,
+		"account_ttls": map[string]interface{}{
+			"a@example.com": map[string]interface{}{"ttl": "2m"},
+		},
+	}); responseErrorCode(resp) != string(errCodeInvalidRequest) {
+		t.Fatalf("expected a ttl longer than the max_ttl to be rejected but received %#v", resp)
+	}
+	if resp := handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com", "b@example.com"},
+		"ttl":                   60,
+		"max_ttl":               100,
+		"account_ttls": map[string]interface{}{
+			"A@example.com": map[string]interface{}{"ttl": "10s", "max_ttl": 20},
+		},
+	}); resp != nil {
+		t.Fatalf("unable to create set: %#v", resp)
+	}
+	set := handle(logical.ReadOperation, libraryPrefix+"lib", nil).Data
+	if ttls := set["account_ttls"].(map[string]interface{})["a@example.com"].(map[string]interface{}); ttls["ttl"] != int64(10) || ttls["max_ttl"] != int64(20) {
+		t.Fatalf("unexpected account ttls %#v", set["account_ttls"])
+	}
+
+	checkOut := handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil)
+	if checkOut.Data["service_account_name"] != "a@example.com" || checkOut.Secret.TTL != 10*time.Second || checkOut.Secret.MaxTTL != 20*time.Second {
+		t.Fatalf("expected the account's own ttls but received %#v", checkOut.Secret)
+	}
+	renewal, err := b.renewCheckOut(ctx, &logical.Request{Storage: storage, Secret: checkOut.Secret}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewal.Secret.TTL != 10*time.Second || renewal.Secret.MaxTTL != 20*time.Second {
+		t.Fatalf("expected renewals to keep the account's own ttls but received %#v", renewal.Secret)
+	}
+	checkOut = handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil)
+	if checkOut.Data["service_account_name"] != "b@example.com" || checkOut.Secret.TTL != time.Minute || checkOut.Secret.MaxTTL != 100*time.Second {
+		t.Fatalf("expected the set's ttls but received %#v", checkOut.Secret)
+	}
+	handle(logical.UpdateOperation, libraryPrefix+"manage/lib/check-in", map[string]interface{}{
+		"service_account_names": []string{"a@example.com", "b@example.com"},
+	})
+
+	// A shorter ttl can still be asked for.
+	checkOut = handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", map[string]interface{}{
+		"ttl": 5,
+	})
+	if checkOut.Data["service_account_name"] != "a@example.com" || checkOut.Secret.TTL != 5*time.Second {
+		t.Fatalf("expected the requested ttl but received %#v", checkOut.Secret)
+	}
+	handle(logical.UpdateOperation, libraryPrefix+"manage/lib/check-in", nil)
+
+	// Removing an account from the set drops its ttls.
+	handle(logical.UpdateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"b@example.com"},
+	})
+	set = handle(logical.ReadOperation, libraryPrefix+"lib", nil).Data
+	if len(set["account_ttls"].(map[string]interface{})) != 0 {
+		t.Fatalf("expected the removed account's ttls to be dropped but received %#v", set["account_ttls"])
+	}
+}
+
+func TestStatusPasswordLastRotated(t *testing.T) {
+	b, storage := getBackend(t, newMemoryDirectory(), testConfig())
+	// The directory records when passwords were really set, so Vault's clock is
+	// kept ahead of it to keep check-outs from seeing them as reset outside Vault.
+	now := time.Now().UTC().Add(time.Hour)
+	b.now = func() time.Time { return now }
+	b.checkOutHandler.now = b.now
+	handle := succeedingRequester(t, b, storage, "borrower")
+	lastRotated := func() interface{} {
+		t.Helper()
+		return handle(logical.ReadOperation, libraryPrefix+"lib/status", nil).Data["a@example.com"].(map[string]interface{})["password_last_rotated"]
+	}
+
+	handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com"},
+	})
+	if got := lastRotated(); got != now {
+		t.Fatalf("expected the password to have been rotated when the set was created but received %v", got)
+	}
+
+	created := now
+	now = now.Add(time.Hour)
+	handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil)
+	if got := lastRotated(); got != created {
+		t.Fatalf("expected checked-out accounts to be reported too but received %v", got)
+	}
+	handle(logical.UpdateOperation, libraryPrefix+"lib/check-in", nil)
+	if got := lastRotated(); got != now {
+		t.Fatalf("expected the password to have been rotated on check-in but received %v", got)
+	}
+}
+
+func TestLibraryTTLDefaults(t *testing.T) {
+	engineConf := testConfig()
+	engineConf.LibraryTTL = 30
+	engineConf.LibraryMaxTTL = 100
+	b, storage := getBackend(t, newMemoryDirectory(), engineConf)
+	handle := requester(t, b, storage, "borrower")
+
+	// Sets without ttls of their own follow the config's.
+	if resp := handle(logical.CreateOperation, libraryPrefix+"defaults", map[string]interface{}{
+		"service_account_names": []string{"a@example.com"},
+	}); resp != nil {
+		t.Fatalf("unable to create set: %#v", resp)
+	}
+	set := handle(logical.ReadOperation, libraryPrefix+"defaults", nil).Data
+	if set["ttl"] != int64(0) || set["max_ttl"] != int64(0) || set["effective_ttl"] != int64(30) || set["effective_max_ttl"] != int64(100) {
+		t.Fatalf("expected the config's ttls to be in effect but received %#v", set)
+	}
+	checkOut := handle(logical.UpdateOperation, libraryPrefix+"defaults/check-out", nil)
+	if checkOut.Secret.TTL != 30*time.Second || checkOut.Secret.MaxTTL != 100*time.Second {
+		t.Fatalf("expected the config's ttls but received %s and %s", checkOut.Secret.TTL, checkOut.Secret.MaxTTL)
+	}
+
+	// No set may lend an account out for longer than library_max_ttl.
+	if resp := handle(logical.CreateOperation, libraryPrefix+"own", map[string]interface{}{
+		"service_account_names": []string{"b@example.com"},
+		"max_ttl":               150,
+	}); responseErrorCode(resp) != string(errCodeInvalidRequest) {
+		t.Fatalf("expected a max_ttl longer than library_max_ttl to be rejected but received %#v", resp)
+	}
+	if resp := handle(logical.CreateOperation, libraryPrefix+"own", map[string]interface{}{
+		"service_account_names": []string{"b@example.com"},
+		"ttl":                   20,
+		"max_ttl":               50,
+	}); resp != nil {
+		t.Fatalf("unable to create set: %#v", resp)
+	}
+	checkOut = handle(logical.UpdateOperation, libraryPrefix+"own/check-out", nil)
+	if checkOut.Secret.TTL != 20*time.Second || checkOut.Secret.MaxTTL != 50*time.Second {
+		t.Fatalf("expected the set's own ttls but received %s and %s", checkOut.Secret.TTL, checkOut.Secret.MaxTTL)
+	}
+
+	// Sets written before library_max_ttl was lowered are capped at it.
+	engineConf.LibraryMaxTTL = 40
+	if err := writeConfig(ctx, storage, engineConf); err != nil {
+		t.Fatal(err)
+	}
+	if set := handle(logical.ReadOperation, libraryPrefix+"own", nil).Data; set["effective_max_ttl"] != int64(40) {
+		t.Fatalf("expected the max_ttl to be capped at library_max_ttl but received %#v", set)
+	}
+}
+
+func TestLibraryExcludeCharacters(t *testing.T) {
+	b, storage := getBackend(t, newMemoryDirectory(), testConfig())
+	handle := requester(t, b, storage, "")
+
+	const lowercase = "abcdefghijklmnopqrstuvwxyz"
+	if resp := handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com"},
+		"exclude_characters":    lowercase + "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789",
+	}); resp == nil || !resp.IsError() {
+		t.Fatalf("expected a set that excludes every character to be rejected but received %#v", resp)
+	}
+	if resp := handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com"},
+		"exclude_characters":    lowercase,
+	}); resp != nil {
+		t.Fatalf("unable to create set: %#v", resp)
+	}
+	if set := handle(logical.ReadOperation, libraryPrefix+"lib", nil).Data; set["exclude_characters"] != lowercase {
+		t.Fatalf("expected the excluded characters to be read back but received %#v", set)
+	}
+
+	// The password is rotated on check-in without the set's excluded characters.
+	handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil)
+	handle(logical.UpdateOperation, libraryPrefix+"manage/lib/check-in", nil)
+	password := handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil).Data["password"].(string)
+	if strings.ContainsAny(password, lowercase) {
+		t.Fatalf("expected %q to have no lowercase letters", password)
+	}
+}
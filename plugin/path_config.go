@@ -7,8 +7,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"sort"
+	"strings"
 	"time"
 
+	metrics "github.com/armon/go-metrics"
+	"github.com/go-ldap/ldap/v3"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/ldaputil"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -26,6 +31,10 @@ const (
 	defaultPasswordLength = 64
 
 	defaultTLSVersion = "tls12"
+
+	// defaultRotationBurst lets a handful of check-ins through at once before
+	// rotation_rate_limit spreads out the rest.
+	defaultRotationBurst = 10
 )
 
 func readConfig(ctx context.Context, storage logical.Storage) (*configuration, error) {
@@ -54,14 +63,88 @@ func writeConfig(ctx context.Context, storage logical.Storage, config *configura
 	return nil
 }
 
+// isBindAccount reports whether a service account's entry is the account Vault binds to
+// AD with. That account's password is stored in the config and rotated by rotate-root,
+// so if a role or set rotated it, Vault would be locked out of AD.
+func isBindAccount(adConf *client.ADConf, serviceAccountName string, entry *client.Entry) bool {
+	// A principal's name usually matches its account's UPN, other than the case
+	// of the realm.
+	if adConf != nil && adConf.BindsWithKerberos() && strings.EqualFold(serviceAccountName, adConf.BindPrincipal) {
+		return true
+	}
+	if adConf == nil || adConf.ConfigEntry == nil {
+		return false
+	}
+	if adConf.BindModeOrDefault() == client.BindModeUPN {
+		upn := adConf.BindUPN()
+		return upn != "" && strings.EqualFold(serviceAccountName, upn)
+	}
+	if adConf.BindDN == "" {
+		return false
+	}
+	if entry == nil || entry.DN == "" {
+		return false
+	}
+	bindDN, err := ldap.ParseDN(adConf.BindDN)
+	if err != nil {
+		return strings.EqualFold(entry.DN, adConf.BindDN)
+	}
+	entryDN, err := ldap.ParseDN(entry.DN)
+	if err != nil {
+		return strings.EqualFold(entry.DN, adConf.BindDN)
+	}
+	return bindDN.EqualFold(entryDN)
+}
+
 func (b *backend) pathConfig() *framework.Path {
 	return &framework.Path{
 		Pattern: configPath,
-		Fields:  b.configFields(),
-		Callbacks: map[logical.Operation]framework.OperationFunc{
-			logical.UpdateOperation: b.configUpdateOperation,
-			logical.ReadOperation:   b.configReadOperation,
-			logical.DeleteOperation: b.configDeleteOperation,
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+		},
+		Fields: b.configFields(),
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.configUpdateOperation,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Configure the connection to AD and password options.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationVerb: "configure",
+				},
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
+			},
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.configReadOperation,
+				Summary:  "Read the configuration.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationSuffix: "configuration",
+				},
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields:      configResponseFields(),
+					}},
+				},
+			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback:                    b.configDeleteOperation,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Delete the configuration.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationSuffix: "configuration",
+				},
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
+			},
 		},
 		HelpSynopsis:    configHelpSynopsis,
 		HelpDescription: configHelpDescription,
@@ -83,10 +166,291 @@ func (b *backend) configFields() map[string]*framework.FieldSchema {
 		Description: "The number of seconds after a Vault rotation where, if Active Directory shows a later rotation, it should be considered out-of-band.",
 		Default:     5,
 	}
+	fields["tidy_interval"] = &framework.FieldSchema{
+		Type:        framework.TypeDurationSecond,
+		Description: "In seconds, how often to automatically remove storage entries left behind by deleted roles and library sets. Defaults to 0, which disables automatic tidying.",
+		Default:     0,
+	}
+	fields["rotation_rate_limit"] = &framework.FieldSchema{
+		Type:        framework.TypeFloat,
+		Description: "How many library and elevation passwords may be rotated per second once rotation_burst have been rotated at once, so a mass check-in doesn't reset hundreds of passwords against the domain controllers simultaneously. Defaults to 0, which doesn't limit rotations.",
+		Default:     0,
+	}
+	fields["rotation_burst"] = &framework.FieldSchema{
+		Type:        framework.TypeInt,
+		Description: "How many library and elevation passwords may be rotated at once before rotation_rate_limit applies.",
+		Default:     defaultRotationBurst,
+	}
+	fields["disallow_unlimited_ttl"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Reject library sets and check-outs with no limit on how long a service account may be borrowed.",
+		Default:     false,
+	}
+	fields["library_ttl"] = &framework.FieldSchema{
+		Type:        framework.TypeDurationSecond,
+		Description: "In seconds, how long check-outs from library sets without a ttl of their own last. Defaults to 0, which uses the mount's default lease TTL.",
+	}
+	fields["library_max_ttl"] = &framework.FieldSchema{
+		Type:        framework.TypeDurationSecond,
+		Description: "In seconds, the longest any library check-out may last with renewals. Sets without a max_ttl of their own use it, and longer ones are capped at it. Defaults to 0, which uses the mount's max lease TTL.",
+	}
+	fields["due_warning_window"] = &framework.FieldSchema{
+		Type:        framework.TypeDurationSecond,
+		Description: "In seconds, how long before a library check-out is due to send a check_out_expiring webhook event and metric, and flag it as expiring_soon in its set's status, so the borrower can renew it before it's checked in. Defaults to 0, which sends no warnings.",
+		Default:     0,
+	}
+	fields["require_response_wrapping"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Reject creds reads and check-outs that aren't response-wrapped, so passwords are never returned in plaintext.",
+		Default:     false,
+	}
+	fields["omit_last_password"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Leave last_password out of every role's creds responses, so consumers only ever see the current password.",
+		Default:     false,
+	}
+	fields["include_account_ids"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Return each service account's objectSid and objectGUID as object_sid and object_guid in creds and check-out responses. Looking them up costs a search of AD on each request.",
+		Default:     false,
+	}
+	fields["include_kerberos_info"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Return each service account's kerberos_realm, kerberos_principal, netbios_domain, and kdcs in creds and check-out responses, so they can be used with kinit or in a krb5.conf. Unless kerberos_realm is set, finding the realm costs a search of AD on each request.",
+		Default:     false,
+	}
+	fields["kerberos_realm"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The Kerberos realm to return with creds. Defaults to the domain components of each service account's DN, uppercased.",
+	}
+	fields["netbios_domain"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The NetBIOS domain name to return with creds. Defaults to the first label of the realm, which is what AD names domains by default.",
+	}
+	fields["kdcs"] = &framework.FieldSchema{
+		Type:        framework.TypeCommaStringSlice,
+		Description: "KDC hosts to return with creds. Defaults to the hosts in url, since every domain controller is a KDC.",
+	}
+	fields["respect_min_password_age"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Before rotating a password, read the minimum password age that applies to the account from its fine-grained password policy or its domain's minPwdAge, and defer the rotation until it has passed instead of letting AD reject it. It costs a few searches of AD on each rotation.",
+		Default:     false,
+	}
+	fields["root_password_max_age"] = &framework.FieldSchema{
+		Type:        framework.TypeDurationSecond,
+		Description: "In seconds, the age past which reading the config warns that the bind password should be rotated with rotate-root. Defaults to 0, which doesn't warn.",
+		Default:     0,
+	}
+	fields["compliance_max_password_age"] = &framework.FieldSchema{
+		Type:        framework.TypeDurationSecond,
+		Description: "In seconds, the password age past which report/password-age counts an account as non-compliant. Defaults to 0, which judges each account by its role's max_password_age or ttl, or its library set's max_password_age.",
+		Default:     0,
+	}
+	fields["min_wrap_ttl"] = &framework.FieldSchema{
+		Type:        framework.TypeDurationSecond,
+		Description: "In seconds, the shortest response-wrapping TTL accepted when require_response_wrapping is set. Defaults to 0, which accepts any.",
+		Default:     0,
+	}
+	fields["require_starttls"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Upgrade ldap:// connections with StartTLS even if starttls isn't set, and never bind over a connection that isn't encrypted.",
+		Default:     false,
+	}
+	fields["enforce_secure_connection"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Refuse ldap:// URLs, in url, domain_routes, and named configs, unless starttls is set, and refuse to bind, search, or change passwords over any connection whose TLS negotiation didn't succeed, so nothing is sent to AD in cleartext.",
+		Default:     false,
+	}
+	fields["parallel_search"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Send searches to every domain controller in url at once and use the first answer, instead of trying them in order. Password changes still go to the first domain controller that can be reached.",
+		Default:     false,
+	}
+	fields["bind_mode"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "How Vault binds to AD with bindpass: \"dn\" binds with binddn, and \"upn\" binds as upn_username@upndomain. If it's unset, binddn is used as the username of a UPN when upndomain is set, which is deprecated.",
+	}
+	fields["upn_username"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The username Vault binds as when bind_mode is upn, without the @upndomain, ex. \"vault\".",
+	}
+	fields["bind_keytab"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "A base64-encoded keytab for bind_principal. If it's set, Vault binds to AD with Kerberos (GSSAPI) as bind_principal instead of with binddn and bindpass. Set it to an empty string to go back to binding with a password.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	}
+	fields["bind_krb5_conf"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The contents of a krb5.conf that says where the KDCs of bind_principal's realm are. Required with bind_keytab.",
+	}
+	fields["bind_principal"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The Kerberos principal Vault binds to AD as with bind_keytab, ex. \"vault@CORP.EXAMPLE.COM\". Its realm defaults to bind_krb5_conf's default_realm.",
+	}
+	fields["crl"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "PEM-encoded certificate revocation lists of the CAs in certificate. A domain controller whose certificate, or an intermediate CA's, is listed in the CRL of its issuer isn't bound to. An expired CRL is refused, so it must be replaced before its next update.",
+	}
+	fields["check_ocsp"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Ask the OCSP responder named in each certificate of a domain controller's chain whether it's been revoked before binding, and refuse to bind if it has or if no responder can answer.",
+		Default:     false,
+	}
+	fields["channel_binding"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Bind the Kerberos bind made with bind_keytab to the TLS connection it's made over with a channel binding token, for domain controllers that require LDAP channel binding. Requires bind_keytab and ldaps:// or StartTLS. Simple binds and client_tls_cert aren't affected by channel binding.",
+		Default:     false,
+	}
+	fields["discover_dc"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Find the domain controllers to connect to from the _ldap._tcp SRV records of discover_dc_domain instead of using url. The records are resolved again every few minutes, so domain controllers can be added and removed without rewriting the config. They're reached with ldaps:// unless starttls or require_starttls is set.",
+		Default:     false,
+	}
+	fields["discover_dc_domain"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The DNS domain whose domain controllers are discovered when discover_dc is set, ex. \"corp.example.com\". Defaults to the domain of the userdn.",
+	}
+	fields["prewarm_connections"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Connect and bind to AD when the engine starts, after a restart or unseal, so the first request doesn't pay for connecting, the TLS handshake, and binding.",
+		Default:     false,
+	}
+	fields["max_open_connections"] = &framework.FieldSchema{
+		Type:        framework.TypeInt,
+		Description: "The most connections open to AD at once, beyond which requests wait for one to be free. Defaults to 0, which is no limit.",
+	}
+	fields["max_idle_connections"] = &framework.FieldSchema{
+		Type:        framework.TypeInt,
+		Description: "How many bound connections to AD are kept open for the next request once they're done with, so it doesn't pay for connecting, the TLS handshake, and binding. Defaults to 0, which closes every connection after use.",
+	}
+	fields["connection_max_lifetime"] = &framework.FieldSchema{
+		Type:        framework.TypeDurationSecond,
+		Description: "In seconds, how long after a connection to AD is made it's closed rather than reused, so connections move to domain controllers that come back up. Defaults to 0, which is no limit. Idle connections are always closed after 10 minutes.",
+	}
+	fields["verify_connection"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Bind to AD and search the userdn before saving the config, and refuse to save it if either fails. It isn't stored.",
+		Default:     true,
+	}
+	fields["computerdn"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "Base DN under which to search for computer accounts, whose names end in $, ex. \"CN=Computers,DC=example,DC=com\". Defaults to userdn.",
+	}
+	fields["domain_routes"] = &framework.FieldSchema{
+		Type:        framework.TypeMap,
+		Description: `Maps UPN suffixes to where their accounts live, for forests with several domains, ex. {"child1.corp.example.com": {"userdn": "OU=Service Accounts,DC=child1,DC=corp,DC=example,DC=com", "url": "ldaps://dc1.child1.corp.example.com"}}. url is optional and defaults to the config's. Accounts whose suffix isn't listed use the config's userdn and url.`,
+	}
+	fields["provider"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The managed Active Directory service the directory runs on, if any: \"aws-managed-ad\", \"azure-ad-ds\", or \"google-managed-ad\". Operations the provider doesn't allow are rejected with an explanation.",
+	}
+	fields["stamp_attribute"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "An attribute, like description, managedBy, or a custom one, to set on service accounts when a role, library set, or elevation role takes them over, and clear when they're no longer managed. Empty, the default, leaves accounts alone.",
+	}
+	fields["stamp_template"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The template stamp_attribute is set from. {{.MountPath}}, {{.Kind}}, {{.Name}}, and {{.Owner}}, like 'library set \"lib\"', are replaced. Defaults to \"" + defaultStampTemplate + "\". managedBy requires a DN.",
+	}
+	fields["webhook_url"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "An https URL to send JSON notifications of check-outs, forced check-ins, overdue check-outs, password peeks, and rotation failures to. Empty, the default, sends none.",
+	}
+	fields["webhook_auth_header"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The value of the Authorization header sent with notifications, ex. \"Bearer <token>\".",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	}
+	fields["webhook_hmac_key"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "A key to sign notifications with. The hex HMAC-SHA256 of the body is sent in the " + webhookSignatureHeader + " header as \"sha256=<signature>\".",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	}
+	fields["transit_address"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The address of the Vault server whose Transit engine encrypts library passwords, ex. \"https://vault.example.com:8200\".",
+	}
+	fields["transit_token"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "A token that may encrypt and decrypt with the Transit key.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	}
+	fields["transit_mount"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The mount of the Transit engine. Defaults to \"" + defaultTransitMount + "\".",
+	}
+	fields["transit_key_name"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The Transit key to encrypt library passwords with before they're stored. Passwords already stored are encrypted the next time they're rotated. Empty, the default, stores them unencrypted.",
+	}
+	fields["transit_ca_cert"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "CA certificate to verify the Transit server's certificate with, must be x509 PEM encoded. Defaults to the system's CAs.",
+	}
+	fields["transit_namespace"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The namespace the Transit engine is mounted in.",
+	}
 	fields["password_policy"] = &framework.FieldSchema{
 		Type:        framework.TypeString,
 		Description: "Name of the password policy to use to generate passwords.",
 	}
+	for name, field := range passwordCompositionFields() {
+		fields[name] = field
+	}
+	fields["dev_mode"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Use an in-memory directory instead of AD, for demos and testing. Only available in builds made with the devmode tag.",
+		Default:     false,
+	}
+
+	fields["fips_mode"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Generate passwords only with the FIPS 140-2 validated crypto module, and reject settings that would produce weaker passwords. Only available in FIPS builds of the plugin.",
+		Default:     false,
+	}
+	fields["fallback_binddn"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "DN of an account to bind as if the binddn can't bind, for example because its password was reset in AD.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Name: "Fallback DN",
+		},
+	}
+	fields["fallback_bindpass"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "Password for the fallback_binddn account.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Name:      "Fallback Password",
+			Sensitive: true,
+		},
+	}
+	fields["last_bind_password_ttl"] = &framework.FieldSchema{
+		Type:        framework.TypeDurationSecond,
+		Description: "In seconds, how long after rotate-root the previous bindpass is tried if the new one is refused, while the change replicates across domain controllers. Defaults to 10 minutes.",
+	}
+	fields["rotation_binddn"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "DN of a privileged account used to reset the binddn's password during root rotation, instead of the binddn changing its own.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Name: "Rotation DN",
+		},
+	}
+	fields["rotation_bindpass"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "Password for the rotation_binddn account.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Name:      "Rotation Password",
+			Sensitive: true,
+		},
+	}
 
 	// Deprecated fields
 	fields["length"] = &framework.FieldSchema{
@@ -103,6 +467,363 @@ func (b *backend) configFields() map[string]*framework.FieldSchema {
 	return fields
 }
 
+// configResponseFields describes the fields returned when reading the config.
+func configResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"url": {
+			Type:        framework.TypeString,
+			Description: "LDAP URL to connect to. Multiple URLs can be specified by concatenating them with commas; they will be tried in-order.",
+		},
+		"starttls": {
+			Type:        framework.TypeBool,
+			Description: "Whether to issue a StartTLS command after establishing an unencrypted connection.",
+		},
+		"insecure_tls": {
+			Type:        framework.TypeBool,
+			Description: "Whether TLS certificate verification is skipped.",
+		},
+		"certificate": {
+			Type:        framework.TypeString,
+			Description: "CA certificate to use when verifying LDAP server certificate, must be x509 PEM encoded.",
+		},
+		"binddn": {
+			Type:        framework.TypeString,
+			Description: "LDAP DN for searching for the user DN.",
+		},
+		"userdn": {
+			Type:        framework.TypeString,
+			Description: "LDAP domain to use for users.",
+		},
+		"upndomain": {
+			Type:        framework.TypeString,
+			Description: "Enables userPrincipalDomain login with [username]@UPNDomain.",
+		},
+		"bind_mode": {
+			Type:        framework.TypeString,
+			Description: "Whether Vault binds with binddn (dn) or as upn_username@upndomain (upn).",
+		},
+		"upn_username": {
+			Type:        framework.TypeString,
+			Description: "The username Vault binds as when bind_mode is upn.",
+		},
+		"tls_min_version": {
+			Type:        framework.TypeString,
+			Description: "Minimum TLS version to use.",
+		},
+		"tls_max_version": {
+			Type:        framework.TypeString,
+			Description: "Maximum TLS version to use.",
+		},
+		"last_rotation_tolerance": {
+			Type:        framework.TypeDurationSecond,
+			Description: "The number of seconds after a Vault rotation where, if Active Directory shows a later rotation, it should be considered out-of-band.",
+		},
+		"tidy_interval": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, how often storage is automatically tidied. Zero means never.",
+		},
+		"rotation_rate_limit": {
+			Type:        framework.TypeFloat,
+			Description: "How many library and elevation passwords may be rotated per second. Zero means no limit.",
+		},
+		"rotation_burst": {
+			Type:        framework.TypeInt,
+			Description: "How many library and elevation passwords may be rotated at once before the rate limit applies.",
+		},
+		"dev_mode": {
+			Type:        framework.TypeBool,
+			Description: "Whether an in-memory directory is used instead of AD.",
+		},
+		"library_ttl": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, how long check-outs from library sets without a ttl of their own last.",
+		},
+		"library_max_ttl": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, the longest any library check-out may last with renewals.",
+		},
+		"disallow_unlimited_ttl": {
+			Type:        framework.TypeBool,
+			Description: "Whether library sets and check-outs with no limit on how long a service account may be borrowed are rejected.",
+		},
+		"due_warning_window": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, how long before a library check-out is due that it's warned about. Zero means never.",
+		},
+		"require_response_wrapping": {
+			Type:        framework.TypeBool,
+			Description: "Whether creds reads and check-outs that aren't response-wrapped are rejected.",
+		},
+		"omit_last_password": {
+			Type:        framework.TypeBool,
+			Description: "Whether last_password is left out of every role's creds responses.",
+		},
+		"include_account_ids": {
+			Type:        framework.TypeBool,
+			Description: "Whether service accounts' SIDs and GUIDs are returned in creds and check-out responses.",
+		},
+		"include_kerberos_info": {
+			Type:        framework.TypeBool,
+			Description: "Whether service accounts' Kerberos info is returned in creds and check-out responses.",
+		},
+		"kerberos_realm": {
+			Type:        framework.TypeString,
+			Description: "The Kerberos realm returned with creds, if it isn't discovered.",
+		},
+		"netbios_domain": {
+			Type:        framework.TypeString,
+			Description: "The NetBIOS domain name returned with creds, if it isn't discovered.",
+		},
+		"kdcs": {
+			Type:        framework.TypeCommaStringSlice,
+			Description: "The KDC hosts returned with creds, if they aren't discovered.",
+		},
+		"respect_min_password_age": {
+			Type:        framework.TypeBool,
+			Description: "Whether rotations are deferred until AD's minimum password age has passed.",
+		},
+		"compliance_max_password_age": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, the password age past which report/password-age counts an account as non-compliant.",
+		},
+		"root_password_max_age": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, the bind password age past which reading the config warns that it should be rotated.",
+		},
+		"bind_password_age_days": {
+			Type:        framework.TypeInt,
+			Description: "How many whole days ago the bind password was last rotated by Vault.",
+		},
+		"min_wrap_ttl": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, the shortest response-wrapping TTL accepted when response wrapping is required.",
+		},
+		"rotation_binddn": {
+			Type:        framework.TypeString,
+			Description: "DN of the account used to reset the binddn's password during root rotation.",
+		},
+		"fallback_binddn": {
+			Type:        framework.TypeString,
+			Description: "DN of the account bound as if the binddn can't bind.",
+		},
+		"last_bind_password_ttl": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, how long after rotate-root the previous bindpass is tried.",
+		},
+		"require_starttls": {
+			Type:        framework.TypeBool,
+			Description: "Whether binding over a connection that isn't encrypted is refused.",
+		},
+		"enforce_secure_connection": {
+			Type:        framework.TypeBool,
+			Description: "Whether ldap:// URLs without starttls, and connections that aren't encrypted, are refused.",
+		},
+		"client_tls_cert": {
+			Type:        framework.TypeString,
+			Description: "The client certificate presented to AD, which is bound as when there's no bindpass.",
+		},
+		"bind_principal": {
+			Type:        framework.TypeString,
+			Description: "The Kerberos principal Vault binds to AD as, if it binds with a keytab.",
+		},
+		"bind_krb5_conf": {
+			Type:        framework.TypeString,
+			Description: "The krb5.conf used to bind with a keytab.",
+		},
+		"channel_binding": {
+			Type:        framework.TypeBool,
+			Description: "Whether binds with a keytab carry a TLS channel binding token.",
+		},
+		"crl": {
+			Type:        framework.TypeString,
+			Description: "The certificate revocation lists domain controllers' certificates are checked against.",
+		},
+		"check_ocsp": {
+			Type:        framework.TypeBool,
+			Description: "Whether domain controllers' certificates are checked with OCSP.",
+		},
+		"provider": {
+			Type:        framework.TypeString,
+			Description: "The managed Active Directory service the directory runs on, if any.",
+		},
+		"parallel_search": {
+			Type:        framework.TypeBool,
+			Description: "Whether searches are sent to every domain controller at once.",
+		},
+		"prewarm_connections": {
+			Type:        framework.TypeBool,
+			Description: "Whether a connection to AD is made when the engine starts.",
+		},
+		"connection_timeout": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, how long connecting to a domain controller, including the TLS handshake, may take before the next is tried.",
+		},
+		"request_timeout": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, how long AD may take to answer a bind, search, or change.",
+		},
+		"max_open_connections": {
+			Type:        framework.TypeInt,
+			Description: "The most connections open to AD at once, or 0 for no limit.",
+		},
+		"max_idle_connections": {
+			Type:        framework.TypeInt,
+			Description: "How many bound connections to AD are kept open between requests.",
+		},
+		"connection_max_lifetime": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, how long a connection to AD is reused for, or 0 for no limit.",
+		},
+		"discover_dc": {
+			Type:        framework.TypeBool,
+			Description: "Whether domain controllers are found from DNS SRV records instead of url.",
+		},
+		"discover_dc_domain": {
+			Type:        framework.TypeString,
+			Description: "The DNS domain whose domain controllers are discovered.",
+		},
+		"domain_controllers": {
+			Type:        framework.TypeSlice,
+			Description: "The domain controllers in url, in order, and whether each could be reached the last time it was dialed.",
+		},
+		"stamp_attribute": {
+			Type:        framework.TypeString,
+			Description: "The attribute set on service accounts Vault manages.",
+		},
+		"stamp_template": {
+			Type:        framework.TypeString,
+			Description: "The template stamp_attribute is set from.",
+		},
+		"computerdn": {
+			Type:        framework.TypeString,
+			Description: "Base DN under which computer accounts are searched for.",
+		},
+		"webhook_url": {
+			Type:        framework.TypeString,
+			Description: "The URL notifications are sent to.",
+		},
+		"webhook_signed": {
+			Type:        framework.TypeBool,
+			Description: "Whether notifications are signed with a webhook_hmac_key.",
+		},
+		"transit_address": {
+			Type:        framework.TypeString,
+			Description: "The address of the Vault server whose Transit engine encrypts library passwords.",
+		},
+		"transit_mount": {
+			Type:        framework.TypeString,
+			Description: "The mount of the Transit engine.",
+		},
+		"transit_key_name": {
+			Type:        framework.TypeString,
+			Description: "The Transit key library passwords are encrypted with.",
+		},
+		"transit_ca_cert": {
+			Type:        framework.TypeString,
+			Description: "The CA certificate the Transit server's certificate is verified with.",
+		},
+		"transit_namespace": {
+			Type:        framework.TypeString,
+			Description: "The namespace the Transit engine is mounted in.",
+		},
+		"domain_routes": {
+			Type:        framework.TypeMap,
+			Description: "Where the accounts with each UPN suffix live.",
+		},
+		"last_bind_password_rotation": {
+			Type:        framework.TypeTime,
+			Description: "When the bind password was last rotated by Vault.",
+		},
+		"use_pre111_group_cn_behavior": {
+			Type:        framework.TypeBool,
+			Description: "Whether to use the Vault 1.10 and earlier behavior of returning the full DN of groups.",
+		},
+		"ttl": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, the default password time-to-live.",
+		},
+		"max_ttl": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, the maximum password time-to-live.",
+		},
+		"length": {
+			Type:        framework.TypeInt,
+			Description: "The desired length of passwords that Vault generates.",
+		},
+		"formatter": {
+			Type:        framework.TypeString,
+			Description: "Text to insert the password into.",
+		},
+		"password_policy": {
+			Type:        framework.TypeString,
+			Description: "Name of the password policy to use to generate passwords.",
+		},
+		"fips_mode": {
+			Type:        framework.TypeBool,
+			Description: "Whether passwords are generated only with the FIPS 140-2 validated crypto module.",
+		},
+		"min_digits": {
+			Type:        framework.TypeInt,
+			Description: "The fewest digits generated passwords contain.",
+		},
+		"min_uppercase": {
+			Type:        framework.TypeInt,
+			Description: "The fewest uppercase letters generated passwords contain.",
+		},
+		"min_symbols": {
+			Type:        framework.TypeInt,
+			Description: "The fewest symbols generated passwords contain.",
+		},
+		"charset": {
+			Type:        framework.TypeString,
+			Description: "The characters generated passwords are made of.",
+		},
+		"exclude_characters": {
+			Type:        framework.TypeString,
+			Description: "The characters left out of generated passwords.",
+		},
+	}
+}
+
+// passwordCompositionFields describes the composition rules that the config and
+// roles accept.
+func passwordCompositionFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"min_digits": {
+			Type:        framework.TypeInt,
+			Description: "The fewest digits generated passwords must contain. Can't be used with password_policy.",
+		},
+		"min_uppercase": {
+			Type:        framework.TypeInt,
+			Description: "The fewest uppercase letters generated passwords must contain. Can't be used with password_policy.",
+		},
+		"min_symbols": {
+			Type:        framework.TypeInt,
+			Description: "The fewest symbols, characters that are neither letters nor digits, generated passwords must contain. Can't be used with password_policy.",
+		},
+		"charset": {
+			Type:        framework.TypeString,
+			Description: "The characters generated passwords are made of. Defaults to letters and digits, plus " + defaultCompositionSymbols + " if min_symbols is set. Can't be used with password_policy.",
+		},
+		"exclude_characters": {
+			Type:        framework.TypeString,
+			Description: "Characters to leave out of generated passwords, like quotes or backslashes that downstream systems can't handle. They're removed from charset, or from the default characters if it isn't set. Can't be used with password_policy.",
+		},
+	}
+}
+
+// passwordCompositionFromFields returns the composition rules that were sent.
+func passwordCompositionFromFields(fieldData *framework.FieldData) passwordComposition {
+	return passwordComposition{
+		MinDigits:    fieldData.Get("min_digits").(int),
+		MinUppercase: fieldData.Get("min_uppercase").(int),
+		MinSymbols:   fieldData.Get("min_symbols").(int),
+		Charset:      fieldData.Get("charset").(string),
+
+		ExcludeCharacters: fieldData.Get("exclude_characters").(string),
+	}
+}
+
 func (b *backend) configUpdateOperation(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
 
 	conf, err := readConfig(ctx, req.Storage)
@@ -130,11 +851,20 @@ func (b *backend) configUpdateOperation(ctx context.Context, req *logical.Reques
 	if err := activeDirectoryConf.Validate(); err != nil {
 		return nil, err
 	}
+	if activeDirectoryConf.Certificate != "" {
+		if err := client.ValidateCABundle(activeDirectoryConf.Certificate); err != nil {
+			return nil, err
+		}
+	}
 
 	// Build the password conf.
 	ttl := fieldData.Get("ttl").(int)
 	maxTTL := fieldData.Get("max_ttl").(int)
 	lastRotationTolerance := fieldData.Get("last_rotation_tolerance").(int)
+	tidyInterval := fieldData.Get("tidy_interval").(int)
+	if tidyInterval < 0 {
+		return nil, errors.New("tidy_interval can't be negative")
+	}
 
 	passwordPolicy := fieldData.Get("password_policy").(string)
 
@@ -149,6 +879,361 @@ func (b *backend) configUpdateOperation(ctx context.Context, req *logical.Reques
 
 	formatter := fieldData.Get("formatter").(string)
 
+	rotationRateLimit := conf.RotationRateLimit
+	if rotationRateLimitRaw, ok := fieldData.GetOk("rotation_rate_limit"); ok {
+		rotationRateLimit = rotationRateLimitRaw.(float64)
+	}
+	if rotationRateLimit < 0 {
+		return nil, errors.New("rotation_rate_limit can't be negative")
+	}
+	rotationBurst := conf.RotationBurst
+	if rotationBurstRaw, ok := fieldData.GetOk("rotation_burst"); ok {
+		rotationBurst = rotationBurstRaw.(int)
+	} else if rotationBurst == 0 {
+		rotationBurst = defaultRotationBurst
+	}
+	if rotationBurst < 1 {
+		return nil, errors.New("rotation_burst must be positive")
+	}
+
+	disallowUnlimitedTTL := conf.DisallowUnlimitedTTL
+	if disallowUnlimitedTTLRaw, ok := fieldData.GetOk("disallow_unlimited_ttl"); ok {
+		disallowUnlimitedTTL = disallowUnlimitedTTLRaw.(bool)
+	}
+
+	libraryTTL := conf.LibraryTTL
+	if libraryTTLRaw, ok := fieldData.GetOk("library_ttl"); ok {
+		libraryTTL = libraryTTLRaw.(int)
+	}
+	libraryMaxTTL := conf.LibraryMaxTTL
+	if libraryMaxTTLRaw, ok := fieldData.GetOk("library_max_ttl"); ok {
+		libraryMaxTTL = libraryMaxTTLRaw.(int)
+	}
+	if libraryTTL < 0 || libraryMaxTTL < 0 {
+		return nil, errors.New("library_ttl and library_max_ttl can't be negative")
+	}
+	if libraryMaxTTL > 0 && libraryTTL > libraryMaxTTL {
+		return nil, errors.New("library_ttl can't be longer than library_max_ttl")
+	}
+
+	dueWarningWindow := conf.DueWarningWindow
+	if dueWarningWindowRaw, ok := fieldData.GetOk("due_warning_window"); ok {
+		dueWarningWindow = dueWarningWindowRaw.(int)
+	}
+	if dueWarningWindow < 0 {
+		return nil, errors.New("due_warning_window can't be negative")
+	}
+	requireResponseWrapping := conf.RequireResponseWrapping
+	if requireResponseWrappingRaw, ok := fieldData.GetOk("require_response_wrapping"); ok {
+		requireResponseWrapping = requireResponseWrappingRaw.(bool)
+	}
+	omitLastPassword := conf.OmitLastPassword
+	if omitLastPasswordRaw, ok := fieldData.GetOk("omit_last_password"); ok {
+		omitLastPassword = omitLastPasswordRaw.(bool)
+	}
+	includeAccountIDs := conf.IncludeAccountIDs
+	if includeAccountIDsRaw, ok := fieldData.GetOk("include_account_ids"); ok {
+		includeAccountIDs = includeAccountIDsRaw.(bool)
+	}
+	includeKerberosInfo := conf.IncludeKerberosInfo
+	if includeKerberosInfoRaw, ok := fieldData.GetOk("include_kerberos_info"); ok {
+		includeKerberosInfo = includeKerberosInfoRaw.(bool)
+	}
+	kerberosRealm := conf.KerberosRealm
+	if kerberosRealmRaw, ok := fieldData.GetOk("kerberos_realm"); ok {
+		kerberosRealm = strings.ToUpper(strings.TrimSpace(kerberosRealmRaw.(string)))
+	}
+	netBIOSDomain := conf.NetBIOSDomain
+	if netBIOSDomainRaw, ok := fieldData.GetOk("netbios_domain"); ok {
+		netBIOSDomain = strings.ToUpper(strings.TrimSpace(netBIOSDomainRaw.(string)))
+	}
+	if len(netBIOSDomain) > maxNetBIOSDomainLength {
+		return nil, fmt.Errorf("netbios_domain can't be longer than %d characters", maxNetBIOSDomainLength)
+	}
+	kdcs := conf.KDCs
+	if kdcsRaw, ok := fieldData.GetOk("kdcs"); ok {
+		kdcs = kdcsRaw.([]string)
+	}
+	minWrapTTL := conf.MinWrapTTL
+	if minWrapTTLRaw, ok := fieldData.GetOk("min_wrap_ttl"); ok {
+		minWrapTTL = minWrapTTLRaw.(int)
+	}
+	if minWrapTTL < 0 {
+		return nil, errors.New("min_wrap_ttl can't be negative")
+	}
+	respectMinPasswordAge := conf.RespectMinPasswordAge
+	if respectMinPasswordAgeRaw, ok := fieldData.GetOk("respect_min_password_age"); ok {
+		respectMinPasswordAge = respectMinPasswordAgeRaw.(bool)
+	}
+	if _, ok := b.client.(MinPasswordAgeReader); respectMinPasswordAge && !ok {
+		return nil, errors.New("respect_min_password_age isn't supported by the secrets client")
+	}
+	complianceMaxPasswordAge := conf.ComplianceMaxPasswordAge
+	if complianceMaxPasswordAgeRaw, ok := fieldData.GetOk("compliance_max_password_age"); ok {
+		complianceMaxPasswordAge = complianceMaxPasswordAgeRaw.(int)
+	}
+	if complianceMaxPasswordAge < 0 {
+		return nil, errors.New("compliance_max_password_age can't be negative")
+	}
+	rootPasswordMaxAge := conf.RootPasswordMaxAge
+	if rootPasswordMaxAgeRaw, ok := fieldData.GetOk("root_password_max_age"); ok {
+		rootPasswordMaxAge = rootPasswordMaxAgeRaw.(int)
+	}
+	if rootPasswordMaxAge < 0 {
+		return nil, errors.New("root_password_max_age can't be negative")
+	}
+
+	fipsMode := conf.PasswordConf.FIPSMode
+	if fipsModeRaw, ok := fieldData.GetOk("fips_mode"); ok {
+		fipsMode = fipsModeRaw.(bool)
+	}
+
+	devMode := conf.ADConf != nil && conf.ADConf.DevMode
+	if devModeRaw, ok := fieldData.GetOk("dev_mode"); ok {
+		devMode = devModeRaw.(bool)
+	}
+	if devMode && !devModeAvailable {
+		return nil, errors.New("dev_mode is only available in builds made with the devmode tag")
+	}
+
+	requireStartTLS := conf.ADConf != nil && conf.ADConf.RequireStartTLS
+	if requireStartTLSRaw, ok := fieldData.GetOk("require_starttls"); ok {
+		requireStartTLS = requireStartTLSRaw.(bool)
+	}
+
+	enforceSecureConnection := conf.ADConf != nil && conf.ADConf.EnforceSecureConnection
+	if enforceSecureConnectionRaw, ok := fieldData.GetOk("enforce_secure_connection"); ok {
+		enforceSecureConnection = enforceSecureConnectionRaw.(bool)
+	}
+	parallelSearch := conf.ADConf != nil && conf.ADConf.ParallelSearch
+	if parallelSearchRaw, ok := fieldData.GetOk("parallel_search"); ok {
+		parallelSearch = parallelSearchRaw.(bool)
+	}
+
+	prewarmConnections := conf.ADConf != nil && conf.ADConf.PrewarmConnections
+	if prewarmConnectionsRaw, ok := fieldData.GetOk("prewarm_connections"); ok {
+		prewarmConnections = prewarmConnectionsRaw.(bool)
+	}
+
+	var maxOpenConnections, maxIdleConnections int
+	var connectionMaxLifetime time.Duration
+	if conf.ADConf != nil {
+		maxOpenConnections = conf.ADConf.MaxOpenConnections
+		maxIdleConnections = conf.ADConf.MaxIdleConnections
+		connectionMaxLifetime = conf.ADConf.ConnectionMaxLifetime
+	}
+	if maxOpenConnectionsRaw, ok := fieldData.GetOk("max_open_connections"); ok {
+		maxOpenConnections = maxOpenConnectionsRaw.(int)
+	}
+	if maxIdleConnectionsRaw, ok := fieldData.GetOk("max_idle_connections"); ok {
+		maxIdleConnections = maxIdleConnectionsRaw.(int)
+	}
+	if connectionMaxLifetimeRaw, ok := fieldData.GetOk("connection_max_lifetime"); ok {
+		connectionMaxLifetime = time.Duration(connectionMaxLifetimeRaw.(int)) * time.Second
+	}
+	if maxOpenConnections < 0 {
+		return nil, errors.New("max_open_connections can't be negative")
+	}
+	if maxIdleConnections < 0 {
+		return nil, errors.New("max_idle_connections can't be negative")
+	}
+	if maxOpenConnections > 0 && maxIdleConnections > maxOpenConnections {
+		return nil, errors.New("max_idle_connections can't be more than max_open_connections")
+	}
+	if connectionMaxLifetime < 0 {
+		return nil, errors.New("connection_max_lifetime can't be negative")
+	}
+
+	discoverDC := conf.ADConf != nil && conf.ADConf.DiscoverDC
+	if discoverDCRaw, ok := fieldData.GetOk("discover_dc"); ok {
+		discoverDC = discoverDCRaw.(bool)
+	}
+	var discoverDCDomain string
+	if conf.ADConf != nil {
+		discoverDCDomain = conf.ADConf.DiscoverDCDomain
+	}
+	if discoverDCDomainRaw, ok := fieldData.GetOk("discover_dc_domain"); ok {
+		discoverDCDomain = discoverDCDomainRaw.(string)
+	}
+
+	var bindMode, upnUsername string
+	if conf.ADConf != nil {
+		bindMode, upnUsername = conf.ADConf.BindMode, conf.ADConf.UPNUsername
+	}
+	if bindModeRaw, ok := fieldData.GetOk("bind_mode"); ok {
+		bindMode = strings.ToLower(bindModeRaw.(string))
+	}
+	if upnUsernameRaw, ok := fieldData.GetOk("upn_username"); ok {
+		upnUsername = upnUsernameRaw.(string)
+	}
+
+	var bindKeytab, bindKrb5Conf, bindPrincipal string
+	if conf.ADConf != nil {
+		bindKeytab, bindKrb5Conf, bindPrincipal = conf.ADConf.BindKeytab, conf.ADConf.BindKrb5Conf, conf.ADConf.BindPrincipal
+	}
+	if bindKeytabRaw, ok := fieldData.GetOk("bind_keytab"); ok {
+		bindKeytab = bindKeytabRaw.(string)
+	}
+	if bindKrb5ConfRaw, ok := fieldData.GetOk("bind_krb5_conf"); ok {
+		bindKrb5Conf = bindKrb5ConfRaw.(string)
+	}
+	if bindPrincipalRaw, ok := fieldData.GetOk("bind_principal"); ok {
+		bindPrincipal = bindPrincipalRaw.(string)
+	}
+	var crl string
+	if conf.ADConf != nil {
+		crl = conf.ADConf.CRL
+	}
+	if crlRaw, ok := fieldData.GetOk("crl"); ok {
+		crl = crlRaw.(string)
+	}
+	if _, err := client.ParseCRLs(crl); err != nil {
+		return nil, err
+	}
+	checkOCSP := conf.ADConf != nil && conf.ADConf.CheckOCSP
+	if checkOCSPRaw, ok := fieldData.GetOk("check_ocsp"); ok {
+		checkOCSP = checkOCSPRaw.(bool)
+	}
+	channelBinding := conf.ADConf != nil && conf.ADConf.ChannelBinding
+	if channelBindingRaw, ok := fieldData.GetOk("channel_binding"); ok {
+		channelBinding = channelBindingRaw.(bool)
+	}
+
+	var computerDN string
+	if conf.ADConf != nil {
+		computerDN = conf.ADConf.ComputerDN
+	}
+	if computerDNRaw, ok := fieldData.GetOk("computerdn"); ok {
+		computerDN = computerDNRaw.(string)
+	}
+
+	var domainRoutes map[string]client.DomainRoute
+	if conf.ADConf != nil {
+		domainRoutes = conf.ADConf.DomainRoutes
+	}
+	if domainRoutesRaw, ok := fieldData.GetOk("domain_routes"); ok {
+		if domainRoutes, err = parseDomainRoutes(domainRoutesRaw.(map[string]interface{})); err != nil {
+			return nil, err
+		}
+	}
+
+	provider := conf.Provider
+	if providerRaw, ok := fieldData.GetOk("provider"); ok {
+		provider = providerRaw.(string)
+	}
+	if _, ok := providerPresets[provider]; provider != "" && !ok {
+		return nil, fmt.Errorf("provider must be one of %s", strings.Join(providerNames(), ", "))
+	}
+
+	stampAttribute := conf.StampAttribute
+	if stampAttributeRaw, ok := fieldData.GetOk("stamp_attribute"); ok {
+		stampAttribute = stampAttributeRaw.(string)
+	}
+	stampTemplate := conf.StampTemplate
+	if stampTemplateRaw, ok := fieldData.GetOk("stamp_template"); ok {
+		stampTemplate = stampTemplateRaw.(string)
+	}
+
+	webhookURL := conf.WebhookURL
+	if webhookURLRaw, ok := fieldData.GetOk("webhook_url"); ok {
+		webhookURL = webhookURLRaw.(string)
+	}
+	if err := validateWebhookURL(webhookURL); err != nil {
+		return nil, err
+	}
+	webhookAuthHeader := conf.WebhookAuthHeader
+	if webhookAuthHeaderRaw, ok := fieldData.GetOk("webhook_auth_header"); ok {
+		webhookAuthHeader = webhookAuthHeaderRaw.(string)
+	}
+	webhookHMACKey := conf.WebhookHMACKey
+	if webhookHMACKeyRaw, ok := fieldData.GetOk("webhook_hmac_key"); ok {
+		webhookHMACKey = webhookHMACKeyRaw.(string)
+	}
+
+	transitAddress := conf.TransitAddress
+	if transitAddressRaw, ok := fieldData.GetOk("transit_address"); ok {
+		transitAddress = transitAddressRaw.(string)
+	}
+	transitToken := conf.TransitToken
+	if transitTokenRaw, ok := fieldData.GetOk("transit_token"); ok {
+		transitToken = transitTokenRaw.(string)
+	}
+	transitMount := conf.TransitMount
+	if transitMountRaw, ok := fieldData.GetOk("transit_mount"); ok {
+		transitMount = strings.Trim(transitMountRaw.(string), "/")
+	}
+	transitKeyName := conf.TransitKeyName
+	if transitKeyNameRaw, ok := fieldData.GetOk("transit_key_name"); ok {
+		transitKeyName = transitKeyNameRaw.(string)
+	}
+	if transitKeyName != "" && (transitAddress == "" || transitToken == "") {
+		return nil, errors.New("transit_key_name requires transit_address and transit_token")
+	}
+	transitCACert := conf.TransitCACert
+	if transitCACertRaw, ok := fieldData.GetOk("transit_ca_cert"); ok {
+		transitCACert = transitCACertRaw.(string)
+	}
+	if transitCACert != "" {
+		if err := client.ValidateCABundle(transitCACert); err != nil {
+			return nil, fmt.Errorf("transit_ca_cert: %w", err)
+		}
+	}
+	transitNamespace := conf.TransitNamespace
+	if transitNamespaceRaw, ok := fieldData.GetOk("transit_namespace"); ok {
+		transitNamespace = strings.Trim(transitNamespaceRaw.(string), "/")
+	}
+
+	var rotationBindDN, rotationBindPassword string
+	if conf.ADConf != nil {
+		rotationBindDN = conf.ADConf.RotationBindDN
+		rotationBindPassword = conf.ADConf.RotationBindPassword
+	}
+	if rotationBindDNRaw, ok := fieldData.GetOk("rotation_binddn"); ok {
+		rotationBindDN = rotationBindDNRaw.(string)
+	}
+	if rotationBindPasswordRaw, ok := fieldData.GetOk("rotation_bindpass"); ok {
+		rotationBindPassword = rotationBindPasswordRaw.(string)
+	}
+	if rotationBindDN == "" {
+		rotationBindPassword = ""
+	} else if rotationBindPassword == "" {
+		return nil, errors.New("rotation_bindpass is required when rotation_binddn is set")
+	}
+
+	var fallbackBindDN, fallbackBindPassword string
+	if conf.ADConf != nil {
+		fallbackBindDN = conf.ADConf.FallbackBindDN
+		fallbackBindPassword = conf.ADConf.FallbackBindPassword
+	}
+	if fallbackBindDNRaw, ok := fieldData.GetOk("fallback_binddn"); ok {
+		fallbackBindDN = fallbackBindDNRaw.(string)
+	}
+	if fallbackBindPasswordRaw, ok := fieldData.GetOk("fallback_bindpass"); ok {
+		fallbackBindPassword = fallbackBindPasswordRaw.(string)
+	}
+	if fallbackBindDN == "" {
+		fallbackBindPassword = ""
+	} else if fallbackBindPassword == "" {
+		return nil, errors.New("fallback_bindpass is required when fallback_binddn is set")
+	}
+
+	// The last bind password is kept so a config update right after rotate-root
+	// doesn't stop it being tried.
+	var lastBindPassword string
+	var lastBindPasswordRotation time.Time
+	var lastBindPasswordTTL time.Duration
+	if conf.ADConf != nil {
+		lastBindPassword = conf.ADConf.LastBindPassword
+		lastBindPasswordRotation = conf.ADConf.LastBindPasswordRotation
+		lastBindPasswordTTL = conf.ADConf.LastBindPasswordTTL
+	}
+	if lastBindPasswordTTLRaw, ok := fieldData.GetOk("last_bind_password_ttl"); ok {
+		lastBindPasswordTTL = time.Duration(lastBindPasswordTTLRaw.(int)) * time.Second
+	}
+	if lastBindPasswordTTL < 0 {
+		return nil, errors.New("last_bind_password_ttl can't be negative")
+	}
+
 	if pre111Val, ok := fieldData.GetOk("use_pre111_group_cn_behavior"); ok {
 		activeDirectoryConf.UsePre111GroupCNBehavior = new(bool)
 		*activeDirectoryConf.UsePre111GroupCNBehavior = pre111Val.(bool)
@@ -179,6 +1264,8 @@ func (b *backend) configUpdateOperation(ctx context.Context, req *logical.Reques
 		Length:         length,
 		Formatter:      formatter,
 		PasswordPolicy: passwordPolicy,
+		FIPSMode:       fipsMode,
+		Composition:    passwordCompositionFromFields(fieldData),
 	}
 	err = passwordConf.validate()
 	if err != nil {
@@ -189,18 +1276,242 @@ func (b *backend) configUpdateOperation(ctx context.Context, req *logical.Reques
 		PasswordConf: passwordConf,
 		ADConf: &client.ADConf{
 			ConfigEntry: activeDirectoryConf,
+			DevMode:     devMode,
+
+			LastBindPassword:         lastBindPassword,
+			LastBindPasswordRotation: lastBindPasswordRotation,
+			LastBindPasswordTTL:      lastBindPasswordTTL,
+
+			FallbackBindDN:          fallbackBindDN,
+			FallbackBindPassword:    fallbackBindPassword,
+			RotationBindDN:          rotationBindDN,
+			RotationBindPassword:    rotationBindPassword,
+			RequireStartTLS:         requireStartTLS,
+			EnforceSecureConnection: enforceSecureConnection,
+			ParallelSearch:          parallelSearch,
+			PrewarmConnections:      prewarmConnections,
+			MaxOpenConnections:      maxOpenConnections,
+			MaxIdleConnections:      maxIdleConnections,
+			ConnectionMaxLifetime:   connectionMaxLifetime,
+			DiscoverDC:              discoverDC,
+			DiscoverDCDomain:        discoverDCDomain,
+			BindMode:                bindMode,
+			UPNUsername:             upnUsername,
+			BindKeytab:              bindKeytab,
+			BindKrb5Conf:            bindKrb5Conf,
+			BindPrincipal:           bindPrincipal,
+			ChannelBinding:          channelBinding,
+			CRL:                     crl,
+			CheckOCSP:               checkOCSP,
+			ComputerDN:              computerDN,
+			DomainRoutes:            domainRoutes,
 		},
 		LastRotationTolerance: lastRotationTolerance,
+		TidyInterval:          tidyInterval,
+		RotationRateLimit:     rotationRateLimit,
+		RotationBurst:         rotationBurst,
+		DisallowUnlimitedTTL:  disallowUnlimitedTTL,
+		LibraryTTL:            libraryTTL,
+		LibraryMaxTTL:         libraryMaxTTL,
+		DueWarningWindow:      dueWarningWindow,
+
+		RequireResponseWrapping: requireResponseWrapping,
+		MinWrapTTL:              minWrapTTL,
+		OmitLastPassword:        omitLastPassword,
+		IncludeAccountIDs:       includeAccountIDs,
+
+		IncludeKerberosInfo: includeKerberosInfo,
+		KerberosRealm:       kerberosRealm,
+		NetBIOSDomain:       netBIOSDomain,
+		KDCs:                kdcs,
+
+		RespectMinPasswordAge:    respectMinPasswordAge,
+		ComplianceMaxPasswordAge: complianceMaxPasswordAge,
+		RootPasswordMaxAge:       rootPasswordMaxAge,
+
+		Provider: provider,
+
+		StampAttribute: stampAttribute,
+		StampTemplate:  stampTemplate,
+
+		WebhookURL:        webhookURL,
+		WebhookAuthHeader: webhookAuthHeader,
+		WebhookHMACKey:    webhookHMACKey,
+
+		TransitAddress: transitAddress,
+		TransitToken:   transitToken,
+		TransitMount:   transitMount,
+		TransitKeyName: transitKeyName,
+
+		TransitCACert:    transitCACert,
+		TransitNamespace: transitNamespace,
+	}
+	if _, err := parseStampTemplate(config.StampAttribute, config.stampTemplate()); err != nil {
+		return nil, err
+	}
+	if err := config.ADConf.ValidateBindMode(); err != nil {
+		return nil, err
+	}
+	if config.ADConf.BindsWithKerberos() {
+		if err := config.ADConf.ValidateKerberosBind(); err != nil {
+			return nil, err
+		}
+	}
+	if config.ADConf.BindsWithClientCertificate() && !config.ADConf.BindsWithKerberos() {
+		// The certificate is only presented during a TLS handshake.
+		if rawURL := unencryptedURL(config.ADConf); rawURL != "" {
+			return nil, fmt.Errorf("binding with client_tls_cert requires an encrypted connection, so %q must use ldaps:// or starttls must be set", rawURL)
+		}
+	}
+	if config.ADConf.ChannelBinding {
+		if !config.ADConf.BindsWithKerberos() {
+			return nil, errors.New("channel_binding requires bind_keytab, since AD only checks channel binding on Kerberos binds")
+		}
+		if rawURL := unencryptedURL(config.ADConf); rawURL != "" {
+			return nil, fmt.Errorf("channel_binding requires an encrypted connection to bind to, so %q must use ldaps:// or starttls must be set", rawURL)
+		}
+	}
+	if config.ADConf.EnforceSecureConnection {
+		if rawURL := cleartextURL(config.ADConf); rawURL != "" {
+			return nil, fmt.Errorf("enforce_secure_connection is set, so %q must use ldaps:// or starttls must be set", rawURL)
+		}
+		name, rawURL, err := cleartextNamedConfig(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		if rawURL != "" {
+			return nil, fmt.Errorf("enforce_secure_connection is set, so %q of config/%s must use ldaps:// or its starttls must be set", rawURL, name)
+		}
+	}
+	if config.ADConf.DiscoverDC {
+		if _, err := config.ADConf.DiscoveryDomain(); err != nil {
+			return nil, fmt.Errorf("discover_dc_domain must be set: %w", err)
+		}
+	}
+	var warnings []string
+	if preset := config.providerPreset(); preset != nil {
+		if warnings, err = preset.validateConfig(config.ADConf); err != nil {
+			return nil, err
+		}
+	}
+	if config.ADConf.BindMode == "" && config.ADConf.UPNDomain != "" && config.ADConf.BindDN != "" &&
+		!config.ADConf.BindsWithKerberos() && !config.ADConf.BindsWithClientCertificate() {
+		warnings = append(warnings, fmt.Sprintf("binddn is being used as the username of a UPN because upndomain is set, which is deprecated; set bind_mode to %q and upn_username to %q, and binddn to an empty string, instead", client.BindModeUPN, config.ADConf.BindDN))
+	}
+	if fieldData.Get("verify_connection").(bool) {
+		if verifier, ok := b.client.(ConnectionVerifier); ok {
+			if err := verifier.VerifyConnection(config.ADConf); err != nil {
+				return codedErrorResponse(errCodeConnectionFailed, "the config wasn't saved because it doesn't work: %s; to save it anyway, set verify_connection to false", err), nil
+			}
+		}
 	}
 	err = writeConfig(ctx, req.Storage, &config)
 	if err != nil {
 		return nil, err
 	}
+	b.transit.reset()
 
+	if len(warnings) > 0 {
+		resp := &logical.Response{}
+		for _, warning := range warnings {
+			resp.AddWarning(warning)
+		}
+		return resp, nil
+	}
 	// Respond with a 204.
 	return nil, nil
 }
 
+// addDeprecationWarnings warns that passwords are generated with deprecated
+// fields, and counts each so operators can find the mounts still using them.
+// It's added to reads of the config and roles, so writes still respond with a 204.
+func addDeprecationWarnings(resp *logical.Response, passConf passwordConf) {
+	for _, field := range passConf.deprecatedFields() {
+		resp.AddWarning(fmt.Sprintf("passwords are generated with the deprecated %q field, which will be removed in a future release; set password_policy to generate them with a password policy instead", field))
+		metrics.IncrCounterWithLabels([]string{"active directory", "deprecated field"}, 1, []metrics.Label{{Name: "field", Value: field}})
+	}
+}
+
+// parseDomainRoutes parses the domain_routes field. Each route is either an object
+// with a userdn and an optional url, or just the userdn.
+func parseDomainRoutes(raw map[string]interface{}) (map[string]client.DomainRoute, error) {
+	routes := make(map[string]client.DomainRoute, len(raw))
+	for suffix, routeRaw := range raw {
+		suffix = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(suffix), "@"))
+		if suffix == "" {
+			return nil, errors.New("domain_routes can't have an empty UPN suffix")
+		}
+		var route client.DomainRoute
+		switch v := routeRaw.(type) {
+		case string:
+			route.UserDN = v
+		case map[string]interface{}:
+			for key, value := range v {
+				s, ok := value.(string)
+				if !ok {
+					return nil, fmt.Errorf("domain_routes[%q].%s must be a string", suffix, key)
+				}
+				switch key {
+				case "userdn":
+					route.UserDN = s
+				case "url":
+					route.URL = s
+				default:
+					return nil, fmt.Errorf("domain_routes[%q] has unknown field %q, only userdn and url are allowed", suffix, key)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("domain_routes[%q] must be an object with a userdn and optional url", suffix)
+		}
+		if route.UserDN == "" {
+			return nil, fmt.Errorf("domain_routes[%q] requires a userdn", suffix)
+		}
+		if _, ok := routes[suffix]; ok {
+			return nil, fmt.Errorf("domain_routes has %q more than once", suffix)
+		}
+		routes[suffix] = route
+	}
+	return routes, nil
+}
+
+// unencryptedURL returns the first of the config's URLs that's connected to
+// without TLS, or an empty string if they're all encrypted.
+func unencryptedURL(adConf *client.ADConf) string {
+	if adConf.StartTLS || adConf.RequireStartTLS || adConf.DiscoverDC {
+		return ""
+	}
+	for _, rawURL := range strings.Split(adConf.Url, ",") {
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(rawURL)), "ldap://") {
+			return strings.TrimSpace(rawURL)
+		}
+	}
+	return ""
+}
+
+// cleartextURL returns the first of the URLs of the config and its domain routes
+// that's connected to without TLS, or "" if there's none.
+func cleartextURL(adConf *client.ADConf) string {
+	if rawURL := unencryptedURL(adConf); rawURL != "" {
+		return rawURL
+	}
+	if adConf.StartTLS || adConf.RequireStartTLS {
+		return ""
+	}
+	suffixes := make([]string, 0, len(adConf.DomainRoutes))
+	for suffix := range adConf.DomainRoutes {
+		suffixes = append(suffixes, suffix)
+	}
+	sort.Strings(suffixes)
+	for _, suffix := range suffixes {
+		for _, rawURL := range strings.Split(adConf.DomainRoutes[suffix].URL, ",") {
+			if strings.HasPrefix(strings.ToLower(strings.TrimSpace(rawURL)), "ldap://") {
+				return strings.TrimSpace(rawURL)
+			}
+		}
+	}
+	return ""
+}
+
 func (b *backend) configReadOperation(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
 	config, err := readConfig(ctx, req.Storage)
 	if err != nil {
@@ -215,19 +1526,102 @@ func (b *backend) configReadOperation(ctx context.Context, req *logical.Request,
 	// as we lean away from returning sensitive information unless it's absolutely necessary.
 	// Also, we don't return the full ADConf here because not all parameters are used by this engine.
 	configMap := map[string]interface{}{
-		"url":                     config.ADConf.Url,
-		"starttls":                config.ADConf.StartTLS,
-		"insecure_tls":            config.ADConf.InsecureTLS,
-		"certificate":             config.ADConf.Certificate,
-		"binddn":                  config.ADConf.BindDN,
-		"userdn":                  config.ADConf.UserDN,
-		"upndomain":               config.ADConf.UPNDomain,
-		"tls_min_version":         config.ADConf.TLSMinVersion,
-		"tls_max_version":         config.ADConf.TLSMaxVersion,
-		"last_rotation_tolerance": config.LastRotationTolerance,
+		"url":                         config.ADConf.Url,
+		"starttls":                    config.ADConf.StartTLS,
+		"insecure_tls":                config.ADConf.InsecureTLS,
+		"certificate":                 config.ADConf.Certificate,
+		"client_tls_cert":             config.ADConf.ClientTLSCert,
+		"binddn":                      config.ADConf.BindDN,
+		"userdn":                      config.ADConf.UserDN,
+		"upndomain":                   config.ADConf.UPNDomain,
+		"bind_mode":                   config.ADConf.BindModeOrDefault(),
+		"tls_min_version":             config.ADConf.TLSMinVersion,
+		"tls_max_version":             config.ADConf.TLSMaxVersion,
+		"connection_timeout":          int64(config.ADConf.ConnectionTimeoutOrDefault().Seconds()),
+		"request_timeout":             int64(config.ADConf.RequestTimeoutOrDefault().Seconds()),
+		"last_rotation_tolerance":     config.LastRotationTolerance,
+		"tidy_interval":               config.TidyInterval,
+		"rotation_rate_limit":         config.RotationRateLimit,
+		"rotation_burst":              config.RotationBurst,
+		"disallow_unlimited_ttl":      config.DisallowUnlimitedTTL,
+		"library_ttl":                 config.LibraryTTL,
+		"library_max_ttl":             config.LibraryMaxTTL,
+		"due_warning_window":          config.DueWarningWindow,
+		"require_response_wrapping":   config.RequireResponseWrapping,
+		"omit_last_password":          config.OmitLastPassword,
+		"include_account_ids":         config.IncludeAccountIDs,
+		"include_kerberos_info":       config.IncludeKerberosInfo,
+		"kerberos_realm":              config.KerberosRealm,
+		"netbios_domain":              config.NetBIOSDomain,
+		"kdcs":                        config.KDCs,
+		"min_wrap_ttl":                config.MinWrapTTL,
+		"respect_min_password_age":    config.RespectMinPasswordAge,
+		"compliance_max_password_age": config.ComplianceMaxPasswordAge,
+		"root_password_max_age":       config.RootPasswordMaxAge,
+		"dev_mode":                    config.ADConf.DevMode,
+		"rotation_binddn":             config.ADConf.RotationBindDN,
+		"fallback_binddn":             config.ADConf.FallbackBindDN,
+		"last_bind_password_ttl":      int64(config.ADConf.LastBindPasswordTTLOrDefault().Seconds()),
+		"require_starttls":            config.ADConf.RequireStartTLS,
+		"enforce_secure_connection":   config.ADConf.EnforceSecureConnection,
+		"provider":                    config.Provider,
+		"parallel_search":             config.ADConf.ParallelSearch,
+		"prewarm_connections":         config.ADConf.PrewarmConnections,
+		"max_open_connections":        config.ADConf.MaxOpenConnections,
+		"max_idle_connections":        config.ADConf.MaxIdleConnections,
+		"connection_max_lifetime":     int64(config.ADConf.ConnectionMaxLifetime.Seconds()),
+		"discover_dc":                 config.ADConf.DiscoverDC,
+		"check_ocsp":                  config.ADConf.CheckOCSP,
+		"stamp_attribute":             config.StampAttribute,
+		"stamp_template":              config.stampTemplate(),
+	}
+	if config.ADConf.CRL != "" {
+		configMap["crl"] = config.ADConf.CRL
+	}
+	if config.ADConf.BindMode == client.BindModeUPN {
+		configMap["upn_username"] = config.ADConf.UPNUsername
+	}
+	if config.ADConf.DiscoverDCDomain != "" {
+		configMap["discover_dc_domain"] = config.ADConf.DiscoverDCDomain
+	}
+	// Like the bind passwords, the keytab isn't returned.
+	if config.ADConf.BindsWithKerberos() {
+		configMap["bind_principal"] = config.ADConf.BindPrincipal
+		configMap["bind_krb5_conf"] = config.ADConf.BindKrb5Conf
+		configMap["channel_binding"] = config.ADConf.ChannelBinding
+	}
+	if dcs := b.dcHealthData(config.ADConf); dcs != nil {
+		configMap["domain_controllers"] = dcs
+	}
+	if config.ADConf.ComputerDN != "" {
+		configMap["computerdn"] = config.ADConf.ComputerDN
+	}
+	// Like the bind passwords, the webhook's auth header and key aren't returned.
+	if config.WebhookURL != "" {
+		configMap["webhook_url"] = config.WebhookURL
+		configMap["webhook_signed"] = config.WebhookHMACKey != ""
+	}
+	// So is the Transit token.
+	if config.TransitAddress != "" {
+		configMap["transit_address"] = config.TransitAddress
+		configMap["transit_mount"] = config.transitMount()
+		configMap["transit_key_name"] = config.TransitKeyName
+		configMap["transit_ca_cert"] = config.TransitCACert
+		configMap["transit_namespace"] = config.TransitNamespace
+	}
+	if len(config.ADConf.DomainRoutes) > 0 {
+		domainRoutes := make(map[string]interface{}, len(config.ADConf.DomainRoutes))
+		for suffix, route := range config.ADConf.DomainRoutes {
+			domainRoutes[suffix] = map[string]interface{}{
+				"userdn": route.UserDN,
+				"url":    route.URL,
+			}
+		}
+		configMap["domain_routes"] = domainRoutes
 	}
 	if !config.ADConf.LastBindPasswordRotation.Equal(time.Time{}) {
 		configMap["last_bind_password_rotation"] = config.ADConf.LastBindPasswordRotation
+		configMap["bind_password_age_days"] = int(b.now().Sub(config.ADConf.LastBindPasswordRotation) / (24 * time.Hour))
 	}
 	if config.ADConf.UsePre111GroupCNBehavior != nil {
 		configMap["use_pre111_group_cn_behavior"] = *config.ADConf.UsePre111GroupCNBehavior
@@ -239,13 +1633,36 @@ func (b *backend) configReadOperation(ctx context.Context, req *logical.Request,
 	resp := &logical.Response{
 		Data: configMap,
 	}
+	if warning := b.rootPasswordAgeWarning(config); warning != "" {
+		resp.AddWarning(warning)
+	}
+	addDeprecationWarnings(resp, config.PasswordConf)
 	return resp, nil
 }
 
+// rootPasswordAgeWarning returns a warning if the bind password is older than
+// the config's root_password_max_age, or if Vault has never rotated it, in
+// which case its age isn't known.
+func (b *backend) rootPasswordAgeWarning(config *configuration) string {
+	if config.RootPasswordMaxAge <= 0 || config.ADConf.BindPassword == "" {
+		return ""
+	}
+	maxAge := time.Duration(config.RootPasswordMaxAge) * time.Second
+	if config.ADConf.LastBindPasswordRotation.IsZero() {
+		return fmt.Sprintf("the bind password has never been rotated by Vault, so it may be older than root_password_max_age of %s; rotate it with rotate-root", maxAge)
+	}
+	age := b.now().Sub(config.ADConf.LastBindPasswordRotation)
+	if age <= maxAge {
+		return ""
+	}
+	return fmt.Sprintf("the bind password was last rotated %s ago, which is older than root_password_max_age of %s; rotate it with rotate-root", age.Truncate(time.Second), maxAge)
+}
+
 func (b *backend) configDeleteOperation(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
 	if err := req.Storage.Delete(ctx, configStorageKey); err != nil {
 		return nil, err
 	}
+	b.transit.reset()
 	return nil, nil
 }
 
@@ -264,6 +1681,46 @@ case, an unencrypted connection will be made with a default port of 389, unless
 the "starttls" parameter is set to true, in which case TLS will be used. In the
 latter case, a SSL connection will be established with a default port of 636.
 
+The "certificate" may be a bundle of several PEM-encoded CAs, like a root and
+its intermediates, and every one is trusted. Domain controllers' certificates
+are checked against the revocation lists in "crl", and with OCSP if
+"check_ocsp" is set, before Vault binds to them.
+
+Vault binds with "binddn" when "bind_mode" is "dn", or as
+"upn_username@upndomain" when it's "upn". Configs without a "bind_mode" bind as
+"binddn@upndomain" when "upndomain" is set, which is deprecated.
+
+If "enforce_secure_connection" is set, ldap:// URLs are refused unless
+"starttls" is set, including those of domain routes and named configs, and
+Vault refuses to use any connection to AD that isn't encrypted, like one whose
+StartTLS negotiation failed, so passwords are never sent in cleartext.
+
+If the bind account can't bind, for example because its password was reset in
+AD, Vault binds as "fallback_binddn" instead, if it's set. For
+"last_bind_password_ttl" after rotate-root, the previous password is also tried,
+while the change replicates across domain controllers.
+
+Reading the config returns when rotate-root last changed the bind password, in
+"last_bind_password_rotation", and how many days ago that was, in
+"bind_password_age_days". If "root_password_max_age" is set, reading it also
+warns when the bind password is older than that, or has never been rotated.
+
+Dialing a domain controller, including the TLS handshake and StartTLS, gives
+up after "connection_timeout" and the next one is tried, and a bind, search, or
+change gives up if AD hasn't answered after "request_timeout", so a domain
+controller that hangs can't hold up a check-in or rotate-root forever. If
+either is 0, its default of 30 or 90 seconds is used.
+
+Connections to AD are closed after each request unless "max_idle_connections"
+is set, in which case that many are kept bound for the next request, so a busy
+mount doesn't connect, handshake, and bind for every search and rotation.
+"max_open_connections" caps the connections open at once, and
+"connection_max_lifetime" closes connections that have been open for that long.
+
+Before the config is saved, Vault binds to AD with it and searches the userdn,
+and refuses to save a config that can't do both. Set "verify_connection" to
+false to save it anyway, for example when AD can't be reached yet.
+
 ## A NOTE ON ESCAPING
 
 It is up to the administrator to provide properly escaped DNs. This includes
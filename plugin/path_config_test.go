@@ -5,13 +5,29 @@ package plugin
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
 	"testing"
+	"time"
 
+	"github.com/go-ldap/ldap/v3"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/keytab"
 	"github.com/mitchellh/mapstructure"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
 	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
 )
 
 var (
@@ -191,3 +207,924 @@ func TestConfig_PasswordLength(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_RotationAccount(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configPath,
+		Storage:   storage,
+	}
+	write := func(raw map[string]interface{}) error {
+		fieldData := &framework.FieldData{
+			Schema: testBackend.pathConfig().Fields,
+			Raw: map[string]interface{}{
+				"binddn":   "tester",
+				"password": "pa$$w0rd",
+				"urls":     "ldap://138.91.247.105",
+				"userdn":   "example,com",
+			},
+		}
+		for k, v := range raw {
+			fieldData.Raw[k] = v
+		}
+		_, err := testBackend.configUpdateOperation(ctx, req, fieldData)
+		return err
+	}
+
+	err := write(map[string]interface{}{"rotation_binddn": "CN=Rotator,DC=example,DC=com"})
+	assert.Error(t, err, "a rotation account without a password should be rejected")
+
+	err = write(map[string]interface{}{
+		"rotation_binddn":   "CN=Rotator,DC=example,DC=com",
+		"rotation_bindpass": "r0tat0r",
+	})
+	assert.NoError(t, err)
+
+	// The rotation account is kept when it isn't sent.
+	assert.NoError(t, write(nil))
+	config, err := readConfig(ctx, storage)
+	assert.NoError(t, err)
+	assert.Equal(t, "CN=Rotator,DC=example,DC=com", config.ADConf.RotationBindDN)
+	assert.Equal(t, "r0tat0r", config.ADConf.RotationBindPassword)
+
+	resp, err := testBackend.configReadOperation(ctx, &logical.Request{Storage: storage}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "CN=Rotator,DC=example,DC=com", resp.Data["rotation_binddn"])
+	assert.NotContains(t, resp.Data, "rotation_bindpass")
+
+	// Clearing the DN clears the password with it.
+	assert.NoError(t, write(map[string]interface{}{"rotation_binddn": ""}))
+	config, err = readConfig(ctx, storage)
+	assert.NoError(t, err)
+	assert.Empty(t, config.ADConf.RotationBindPassword)
+}
+
+func TestConfig_FallbackBind(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configPath,
+		Storage:   storage,
+	}
+	write := func(raw map[string]interface{}) error {
+		fieldData := &framework.FieldData{
+			Schema: testBackend.pathConfig().Fields,
+			Raw: map[string]interface{}{
+				"binddn":   "tester",
+				"bindpass": "pa$$w0rd",
+				"urls":     "ldap://138.91.247.105",
+				"userdn":   "example,com",
+			},
+		}
+		for k, v := range raw {
+			fieldData.Raw[k] = v
+		}
+		_, err := testBackend.configUpdateOperation(ctx, req, fieldData)
+		return err
+	}
+
+	assert.Error(t, write(map[string]interface{}{"fallback_binddn": "CN=Fallback,DC=example,DC=com"}), "a fallback account without a password should be rejected")
+	assert.NoError(t, write(map[string]interface{}{
+		"fallback_binddn":        "CN=Fallback,DC=example,DC=com",
+		"fallback_bindpass":      "f4llb4ck",
+		"last_bind_password_ttl": "1h",
+	}))
+
+	// Both are kept when they aren't sent.
+	assert.NoError(t, write(nil))
+	config, err := readConfig(ctx, storage)
+	assert.NoError(t, err)
+	assert.Equal(t, "f4llb4ck", config.ADConf.FallbackBindPassword)
+	resp, err := testBackend.configReadOperation(ctx, &logical.Request{Storage: storage}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "CN=Fallback,DC=example,DC=com", resp.Data["fallback_binddn"])
+	assert.Equal(t, int64(3600), resp.Data["last_bind_password_ttl"])
+	assert.NotContains(t, resp.Data, "fallback_bindpass")
+}
+
+func TestConfig_RotationRateLimit(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configPath,
+		Storage:   storage,
+	}
+	write := func(raw map[string]interface{}) error {
+		fieldData := &framework.FieldData{
+			Schema: testBackend.pathConfig().Fields,
+			Raw: map[string]interface{}{
+				"binddn":   "tester",
+				"bindpass": "pa$$w0rd",
+				"urls":     "ldap://138.91.247.105",
+				"userdn":   "example,com",
+			},
+		}
+		for k, v := range raw {
+			fieldData.Raw[k] = v
+		}
+		_, err := testBackend.configUpdateOperation(ctx, req, fieldData)
+		return err
+	}
+
+	assert.NoError(t, write(nil))
+	config, err := readConfig(ctx, storage)
+	assert.NoError(t, err)
+	assert.Zero(t, config.RotationRateLimit)
+	assert.Equal(t, defaultRotationBurst, config.RotationBurst)
+
+	assert.Error(t, write(map[string]interface{}{"rotation_rate_limit": -1}))
+	assert.Error(t, write(map[string]interface{}{"rotation_burst": 0}))
+
+	assert.NoError(t, write(map[string]interface{}{"rotation_rate_limit": 0.5, "rotation_burst": 3}))
+	// The limit is kept when it isn't sent.
+	assert.NoError(t, write(nil))
+	resp, err := testBackend.configReadOperation(ctx, &logical.Request{Storage: storage}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, resp.Data["rotation_rate_limit"])
+	assert.Equal(t, 3, resp.Data["rotation_burst"])
+}
+
+func TestIsBindAccount(t *testing.T) {
+	tests := []struct {
+		name               string
+		bindDN             string
+		upnDomain          string
+		serviceAccountName string
+		entryDN            string
+		want               bool
+	}{
+		{
+			"matching dn",
+			"CN=vault,OU=Service Accounts,DC=example,DC=com",
+			"",
+			"vault@example.com",
+			"cn=vault,ou=Service Accounts,dc=example,dc=com",
+			true,
+		},
+		{
+			"different dn",
+			"CN=vault,OU=Service Accounts,DC=example,DC=com",
+			"",
+			"app@example.com",
+			"CN=app,OU=Service Accounts,DC=example,DC=com",
+			false,
+		},
+		{
+			"matching upn",
+			"vault",
+			"example.com",
+			"Vault@Example.com",
+			"CN=vault,OU=Service Accounts,DC=example,DC=com",
+			true,
+		},
+		{
+			"different upn",
+			"vault",
+			"example.com",
+			"app@example.com",
+			"CN=app,OU=Service Accounts,DC=example,DC=com",
+			false,
+		},
+		{
+			"no bind dn",
+			"",
+			"",
+			"app@example.com",
+			"",
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adConf := &client.ADConf{
+				ConfigEntry: &ldaputil.ConfigEntry{
+					BindDN:    tt.bindDN,
+					UPNDomain: tt.upnDomain,
+				},
+			}
+			entry := client.NewEntry(&ldap.Entry{DN: tt.entryDN})
+			assert.Equal(t, tt.want, isBindAccount(adConf, tt.serviceAccountName, entry))
+		})
+	}
+}
+
+func TestConfig_DomainRoutes(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configPath,
+		Storage:   storage,
+	}
+	write := func(raw map[string]interface{}) error {
+		fieldData := &framework.FieldData{
+			Schema: testBackend.pathConfig().Fields,
+			Raw: map[string]interface{}{
+				"binddn":   "tester",
+				"password": "pa$$w0rd",
+				"urls":     "ldap://138.91.247.105",
+				"userdn":   "example,com",
+			},
+		}
+		for k, v := range raw {
+			fieldData.Raw[k] = v
+		}
+		_, err := testBackend.configUpdateOperation(ctx, req, fieldData)
+		return err
+	}
+
+	assert.Error(t, write(map[string]interface{}{
+		"domain_routes": map[string]interface{}{"child1.corp": map[string]interface{}{"url": "ldap://dc1"}},
+	}), "a route without a userdn should be rejected")
+	assert.Error(t, write(map[string]interface{}{
+		"domain_routes": map[string]interface{}{"child1.corp": map[string]interface{}{"userdn": "dc=child1", "base": "dc=child1"}},
+	}), "a route with an unknown field should be rejected")
+
+	assert.NoError(t, write(map[string]interface{}{
+		"domain_routes": map[string]interface{}{
+			"@Child1.Corp": map[string]interface{}{"userdn": "dc=child1,dc=corp", "url": "ldaps://dc1.child1.corp"},
+			"child2.corp":  "dc=child2,dc=corp",
+		},
+	}))
+
+	// The routes are kept when they aren't sent.
+	assert.NoError(t, write(nil))
+	config, err := readConfig(ctx, storage)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]client.DomainRoute{
+		"child1.corp": {UserDN: "dc=child1,dc=corp", URL: "ldaps://dc1.child1.corp"},
+		"child2.corp": {UserDN: "dc=child2,dc=corp"},
+	}, config.ADConf.DomainRoutes)
+
+	resp, err := testBackend.configReadOperation(ctx, &logical.Request{Storage: storage}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"userdn": "dc=child2,dc=corp",
+		"url":    "",
+	}, resp.Data["domain_routes"].(map[string]interface{})["child2.corp"])
+}
+
+func TestConfig_DiscoverDC(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configPath,
+		Storage:   storage,
+	}
+	write := func(raw map[string]interface{}) error {
+		fieldData := &framework.FieldData{
+			Schema: testBackend.pathConfig().Fields,
+			Raw: map[string]interface{}{
+				"binddn":   "tester",
+				"password": "pa$$w0rd",
+				"userdn":   "example,com",
+			},
+		}
+		for k, v := range raw {
+			fieldData.Raw[k] = v
+		}
+		_, err := testBackend.configUpdateOperation(ctx, req, fieldData)
+		return err
+	}
+
+	assert.Error(t, write(map[string]interface{}{
+		"discover_dc": true,
+	}), "a userdn without domain components should need a discover_dc_domain")
+	assert.NoError(t, write(map[string]interface{}{
+		"discover_dc":        true,
+		"discover_dc_domain": "corp.example.com",
+	}))
+
+	// The settings are kept when they aren't sent.
+	assert.NoError(t, write(nil))
+	resp, err := testBackend.configReadOperation(ctx, &logical.Request{Storage: storage}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, true, resp.Data["discover_dc"])
+	assert.Equal(t, "corp.example.com", resp.Data["discover_dc_domain"])
+}
+
+func TestConfig_ConnectionPool(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configPath,
+		Storage:   storage,
+	}
+	write := func(raw map[string]interface{}) error {
+		fieldData := &framework.FieldData{
+			Schema: testBackend.pathConfig().Fields,
+			Raw: map[string]interface{}{
+				"binddn":   "tester",
+				"password": "pa$$w0rd",
+				"userdn":   "dc=example,dc=com",
+			},
+		}
+		for k, v := range raw {
+			fieldData.Raw[k] = v
+		}
+		_, err := testBackend.configUpdateOperation(ctx, req, fieldData)
+		return err
+	}
+
+	assert.Error(t, write(map[string]interface{}{"max_open_connections": -1}))
+	assert.Error(t, write(map[string]interface{}{
+		"max_open_connections": 2,
+		"max_idle_connections": 3,
+	}), "more connections shouldn't be kept idle than can be open")
+	assert.NoError(t, write(map[string]interface{}{
+		"max_open_connections":    10,
+		"max_idle_connections":    2,
+		"connection_max_lifetime": 3600,
+	}))
+
+	// The settings are kept when they aren't sent.
+	assert.NoError(t, write(nil))
+	resp, err := testBackend.configReadOperation(ctx, &logical.Request{Storage: storage}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, resp.Data["max_open_connections"])
+	assert.Equal(t, 2, resp.Data["max_idle_connections"])
+	assert.Equal(t, int64(3600), resp.Data["connection_max_lifetime"])
+}
+
+func TestConfig_ClientCertificate(t *testing.T) {
+	cert, key := testClientCertificate(t)
+	storage := &logical.InmemStorage{}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configPath,
+		Storage:   storage,
+	}
+	write := func(raw map[string]interface{}) error {
+		fieldData := &framework.FieldData{
+			Schema: testBackend.pathConfig().Fields,
+			Raw: map[string]interface{}{
+				"userdn":          "dc=example,dc=com",
+				"client_tls_cert": cert,
+				"client_tls_key":  key,
+			},
+		}
+		for k, v := range raw {
+			fieldData.Raw[k] = v
+		}
+		_, err := testBackend.configUpdateOperation(ctx, req, fieldData)
+		return err
+	}
+
+	// Without a bindpass, the certificate is bound as, which needs TLS.
+	assert.Error(t, write(map[string]interface{}{"url": "ldap://dc1.example.com"}), "a client certificate can't be presented without TLS")
+	assert.NoError(t, write(map[string]interface{}{"url": "ldap://dc1.example.com", "starttls": true}))
+	assert.NoError(t, write(map[string]interface{}{"url": "ldaps://dc1.example.com"}))
+
+	resp, err := testBackend.configReadOperation(ctx, &logical.Request{Storage: storage}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, cert, resp.Data["client_tls_cert"])
+	assert.Nil(t, resp.Data["client_tls_key"])
+
+	// There's no password for rotate-root to rotate.
+	resp, err = testBackend.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "rotate-root",
+		Storage:   storage,
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Equal(t, string(errCodeInvalidRequest), resp.Data["data"].(map[string]interface{})["error_code"])
+}
+
+// testClientCertificate returns a self-signed client certificate and its key, PEM-encoded.
+func testClientCertificate(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "vault"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func TestConfig_CABundle(t *testing.T) {
+	root, _ := testClientCertificate(t)
+	intermediate, _ := testClientCertificate(t)
+	storage := &logical.InmemStorage{}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configPath,
+		Storage:   storage,
+	}
+	write := func(raw map[string]interface{}) error {
+		fieldData := &framework.FieldData{
+			Schema: testBackend.pathConfig().Fields,
+			Raw: map[string]interface{}{
+				"url":      "ldaps://dc1.corp.example.com",
+				"binddn":   "tester",
+				"password": "pa$$w0rd",
+				"userdn":   "dc=corp,dc=example,dc=com",
+			},
+		}
+		for k, v := range raw {
+			fieldData.Raw[k] = v
+		}
+		_, err := testBackend.configUpdateOperation(ctx, req, fieldData)
+		return err
+	}
+
+	assert.Error(t, write(map[string]interface{}{
+		"certificate": root + "-----BEGIN CERTIFICATE-----\nbm90IGEgY2VydA==\n-----END CERTIFICATE-----\n",
+	}), "every certificate in the bundle should be checked, not only the first")
+	assert.Error(t, write(map[string]interface{}{
+		"crl": "not a CRL",
+	}))
+	assert.NoError(t, write(map[string]interface{}{
+		"certificate": root + intermediate,
+		"check_ocsp":  true,
+	}))
+
+	resp, err := testBackend.configReadOperation(ctx, &logical.Request{Storage: storage}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, root+intermediate, resp.Data["certificate"])
+	assert.Equal(t, true, resp.Data["check_ocsp"])
+}
+
+func TestConfig_KerberosBind(t *testing.T) {
+	kt := keytab.New()
+	if err := kt.AddEntry("vault", "CORP.EXAMPLE.COM", "password", time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatal(err)
+	}
+	rawKeytab, err := kt.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := &logical.InmemStorage{}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configPath,
+		Storage:   storage,
+	}
+	write := func(raw map[string]interface{}) error {
+		fieldData := &framework.FieldData{
+			Schema: testBackend.pathConfig().Fields,
+			Raw: map[string]interface{}{
+				"url":         "ldaps://dc1.corp.example.com",
+				"userdn":      "dc=corp,dc=example,dc=com",
+				"bind_keytab": base64.StdEncoding.EncodeToString(rawKeytab),
+			},
+		}
+		for k, v := range raw {
+			fieldData.Raw[k] = v
+		}
+		_, err := testBackend.configUpdateOperation(ctx, req, fieldData)
+		return err
+	}
+
+	assert.Error(t, write(nil), "a keytab without a principal and krb5.conf should be rejected")
+	assert.Error(t, write(map[string]interface{}{
+		"bind_principal": "vault",
+		"bind_krb5_conf": "[realms]\n",
+	}), "a principal without a realm should be rejected unless the krb5.conf has a default")
+	assert.NoError(t, write(map[string]interface{}{
+		"bind_principal": "vault@CORP.EXAMPLE.COM",
+		"bind_krb5_conf": "[libdefaults]\n  default_realm = CORP.EXAMPLE.COM\n",
+	}))
+
+	resp, err := testBackend.configReadOperation(ctx, &logical.Request{Storage: storage}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "vault@CORP.EXAMPLE.COM", resp.Data["bind_principal"])
+	assert.Nil(t, resp.Data["bind_keytab"])
+
+	// Channel binding needs a Kerberos bind over TLS.
+	assert.Error(t, write(map[string]interface{}{
+		"url":             "ldap://dc1.corp.example.com",
+		"channel_binding": true,
+	}))
+	assert.Error(t, write(map[string]interface{}{
+		"bind_keytab":     "",
+		"binddn":          "vault",
+		"bindpass":        "pa$$w0rd",
+		"channel_binding": true,
+	}))
+	assert.NoError(t, write(map[string]interface{}{
+		"channel_binding": true,
+	}))
+	resp, err = testBackend.configReadOperation(ctx, &logical.Request{Storage: storage}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, true, resp.Data["channel_binding"])
+
+	// The principal's account can't be managed, or Vault would lose its keytab.
+	config, err := readConfig(ctx, storage)
+	assert.NoError(t, err)
+	assert.True(t, isBindAccount(config.ADConf, "vault@corp.example.com", nil))
+
+	resp, err = testBackend.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "rotate-root",
+		Storage:   storage,
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+	assert.Equal(t, string(errCodeInvalidRequest), resp.Data["data"].(map[string]interface{})["error_code"])
+}
+
+func TestConfig_BindMode(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configPath,
+		Storage:   storage,
+	}
+	write := func(raw map[string]interface{}) (*logical.Response, error) {
+		fieldData := &framework.FieldData{
+			Schema: testBackend.pathConfig().Fields,
+			Raw: map[string]interface{}{
+				"bindpass":        "pa$$w0rd",
+				"urls":            "ldap://138.91.247.105",
+				"userdn":          "dc=example,dc=com",
+				"upndomain":       "example.com",
+				"password_policy": "ad",
+			},
+		}
+		for k, v := range raw {
+			fieldData.Raw[k] = v
+		}
+		return testBackend.configUpdateOperation(ctx, req, fieldData)
+	}
+
+	// Configs that use the binddn as the username of a UPN still work, but are
+	// warned about.
+	resp, err := write(map[string]interface{}{"binddn": "vault"})
+	assert.NoError(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Len(t, resp.Warnings, 1)
+		assert.Contains(t, resp.Warnings[0], "bind_mode")
+	}
+	resp, err = testBackend.configReadOperation(ctx, req, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, client.BindModeUPN, resp.Data["bind_mode"])
+
+	_, err = write(map[string]interface{}{"bind_mode": "sam"})
+	assert.Error(t, err, "an unknown bind_mode should be rejected")
+	_, err = write(map[string]interface{}{"bind_mode": "upn", "upn_username": "vault"})
+	assert.Error(t, err, "the binddn left over from before bind_mode should be rejected in upn mode")
+	_, err = write(map[string]interface{}{"bind_mode": "upn", "binddn": ""})
+	assert.Error(t, err, "upn mode without a upn_username should be rejected")
+	_, err = write(map[string]interface{}{"bind_mode": "upn", "binddn": "", "upn_username": "vault@example.com"})
+	assert.Error(t, err, "a upn_username with its domain should be rejected")
+
+	resp, err = write(map[string]interface{}{"bind_mode": "UPN", "binddn": "", "upn_username": "vault"})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+	resp, err = testBackend.configReadOperation(ctx, req, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, client.BindModeUPN, resp.Data["bind_mode"])
+	assert.Equal(t, "vault", resp.Data["upn_username"])
+	config, err := readConfig(ctx, storage)
+	assert.NoError(t, err)
+	assert.True(t, isBindAccount(config.ADConf, "Vault@Example.com", nil))
+
+	_, err = write(map[string]interface{}{"bind_mode": "dn"})
+	assert.Error(t, err, "dn mode without a binddn should be rejected")
+	_, err = write(map[string]interface{}{"bind_mode": "dn", "binddn": "CN=vault,DC=example,DC=com"})
+	assert.Error(t, err, "the upn_username should be rejected in dn mode")
+
+	// In dn mode, the upndomain only names accounts.
+	resp, err = write(map[string]interface{}{"bind_mode": "dn", "binddn": "CN=vault,DC=example,DC=com", "upn_username": ""})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+	resp, err = testBackend.configReadOperation(ctx, req, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, client.BindModeDN, resp.Data["bind_mode"])
+	assert.NotContains(t, resp.Data, "upn_username")
+}
+
+func TestConfig_RootPasswordMaxAge(t *testing.T) {
+	b, storage := getBackend(t, &fakeSecretsClient{}, nil)
+	now := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configPath,
+		Storage:   storage,
+	}
+	_, err := b.configUpdateOperation(ctx, req, &framework.FieldData{
+		Schema: b.pathConfig().Fields,
+		Raw: map[string]interface{}{
+			"binddn":                "tester",
+			"bindpass":              "pa$$w0rd",
+			"urls":                  "ldap://138.91.247.105",
+			"userdn":                "example,com",
+			"password_policy":       "ad",
+			"root_password_max_age": "720h",
+		},
+	})
+	assert.NoError(t, err)
+	rotatedAgo := func(age time.Duration) {
+		config, err := readConfig(ctx, storage)
+		assert.NoError(t, err)
+		config.ADConf.LastBindPasswordRotation = now.Add(-age)
+		assert.NoError(t, writeConfig(ctx, storage, config))
+	}
+
+	resp, err := b.configReadOperation(ctx, req, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 30*24*60*60, resp.Data["root_password_max_age"])
+	assert.NotContains(t, resp.Data, "bind_password_age_days")
+	if assert.Len(t, resp.Warnings, 1) {
+		assert.Contains(t, resp.Warnings[0], "never been rotated")
+	}
+
+	rotatedAgo(10*24*time.Hour + time.Hour)
+	resp, err = b.configReadOperation(ctx, req, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, resp.Data["bind_password_age_days"])
+	assert.Equal(t, now.Add(-(10*24*time.Hour + time.Hour)), resp.Data["last_bind_password_rotation"])
+	assert.Empty(t, resp.Warnings)
+
+	rotatedAgo(40 * 24 * time.Hour)
+	resp, err = b.configReadOperation(ctx, req, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 40, resp.Data["bind_password_age_days"])
+	if assert.Len(t, resp.Warnings, 1) {
+		assert.Contains(t, resp.Warnings[0], "root_password_max_age")
+	}
+}
+
+func TestConfig_EnforceSecureConnection(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configPath,
+		Storage:   storage,
+	}
+	write := func(raw map[string]interface{}) error {
+		fieldData := &framework.FieldData{
+			Schema: testBackend.pathConfig().Fields,
+			Raw: map[string]interface{}{
+				"binddn":                    "tester",
+				"bindpass":                  "pa$$w0rd",
+				"userdn":                    "dc=example,dc=com",
+				"enforce_secure_connection": true,
+			},
+		}
+		for k, v := range raw {
+			fieldData.Raw[k] = v
+		}
+		_, err := testBackend.configUpdateOperation(ctx, req, fieldData)
+		return err
+	}
+
+	assert.Error(t, write(map[string]interface{}{"url": "ldaps://dc1.example.com,ldap://dc2.example.com"}), "an ldap:// URL without starttls should be rejected")
+	assert.NoError(t, write(map[string]interface{}{"url": "ldap://dc1.example.com", "starttls": true}))
+	assert.NoError(t, write(map[string]interface{}{"url": "ldaps://dc1.example.com", "starttls": false}))
+	assert.Error(t, write(map[string]interface{}{
+		"domain_routes": map[string]interface{}{
+			"child.example.com": map[string]interface{}{"userdn": "dc=child,dc=example,dc=com", "url": "ldap://child.example.com"},
+		},
+	}), "an ldap:// URL of a domain route without starttls should be rejected")
+
+	// Named configs can't connect in cleartext either.
+	named, err := logical.StorageEntryJSON(namedConfigStoragePrefix+"partner", &client.ADConf{
+		ConfigEntry: &ldaputil.ConfigEntry{Url: "ldap://partner.example.com"},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Put(ctx, named))
+	err = write(nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "config/partner")
+	}
+	assert.NoError(t, storage.Delete(ctx, namedConfigStoragePrefix+"partner"))
+	assert.NoError(t, write(nil))
+	resp, err := testBackend.operationNamedConfigUpdate(ctx, req, &framework.FieldData{
+		Schema: testBackend.pathNamedConfigs().Fields,
+		Raw: map[string]interface{}{
+			"name": "partner",
+			"url":  "ldap://partner.example.com",
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp != nil && resp.IsError(), "a named config with an ldap:// URL without starttls should be rejected")
+
+	assert.NoError(t, write(map[string]interface{}{"enforce_secure_connection": false}))
+	resp, err = testBackend.configReadOperation(ctx, req, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, false, resp.Data["enforce_secure_connection"])
+}
+
+func TestConfig_DeprecationWarnings(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configPath,
+		Storage:   storage,
+	}
+	write := func(raw map[string]interface{}) *logical.Response {
+		t.Helper()
+		fieldData := &framework.FieldData{
+			Schema: testBackend.pathConfig().Fields,
+			Raw: map[string]interface{}{
+				"binddn": "tester",
+				"urls":   "ldap://138.91.247.105",
+				"userdn": "example,com",
+			},
+		}
+		for k, v := range raw {
+			fieldData.Raw[k] = v
+		}
+		resp, err := testBackend.configUpdateOperation(ctx, req, fieldData)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	read := func() *logical.Response {
+		t.Helper()
+		resp, err := testBackend.configReadOperation(ctx, req, nil)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	// Writes still respond with a 204, and reads warn about the deprecated fields.
+	assert.Nil(t, write(map[string]interface{}{
+		"formatter": "prefix{{PASSWORD}}",
+	}))
+	warnings := read().Warnings
+	if assert.Len(t, warnings, 2, "both length and formatter should be warned about") {
+		assert.Contains(t, warnings[0], `deprecated "length" field`)
+		assert.Contains(t, warnings[1], `deprecated "formatter" field`)
+	}
+
+	assert.Nil(t, write(map[string]interface{}{
+		"min_digits": 2,
+	}))
+	assert.Empty(t, read().Warnings, "composition rules aren't deprecated")
+
+	assert.Nil(t, write(map[string]interface{}{
+		"password_policy": "ad",
+	}))
+	assert.Empty(t, read().Warnings, "password policies aren't deprecated")
+}
+
+func TestConfig_Webhook(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configPath,
+		Storage:   storage,
+	}
+	write := func(raw map[string]interface{}) error {
+		fieldData := &framework.FieldData{
+			Schema: testBackend.pathConfig().Fields,
+			Raw: map[string]interface{}{
+				"binddn":   "tester",
+				"bindpass": "pa$$w0rd",
+				"urls":     "ldap://138.91.247.105",
+				"userdn":   "example,com",
+			},
+		}
+		for k, v := range raw {
+			fieldData.Raw[k] = v
+		}
+		_, err := testBackend.configUpdateOperation(ctx, req, fieldData)
+		return err
+	}
+
+	assert.Error(t, write(map[string]interface{}{"webhook_url": "http://itsm.example.com/hooks/vault"}), "webhooks must use https")
+	assert.NoError(t, write(map[string]interface{}{
+		"webhook_url":         "https://itsm.example.com/hooks/vault",
+		"webhook_auth_header": "Bearer token",
+		"webhook_hmac_key":    "key",
+	}))
+	// The webhook is kept when it isn't sent.
+	assert.NoError(t, write(nil))
+	config, err := readConfig(ctx, storage)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer token", config.WebhookAuthHeader)
+	assert.Equal(t, "key", config.WebhookHMACKey)
+
+	resp, err := testBackend.configReadOperation(ctx, &logical.Request{Storage: storage}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://itsm.example.com/hooks/vault", resp.Data["webhook_url"])
+	assert.Equal(t, true, resp.Data["webhook_signed"])
+	assert.NotContains(t, resp.Data, "webhook_auth_header")
+	assert.NotContains(t, resp.Data, "webhook_hmac_key")
+}
+
+func TestConfig_Transit(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configPath,
+		Storage:   storage,
+	}
+	write := func(raw map[string]interface{}) error {
+		fieldData := &framework.FieldData{
+			Schema: testBackend.pathConfig().Fields,
+			Raw: map[string]interface{}{
+				"binddn":   "tester",
+				"bindpass": "pa$$w0rd",
+				"urls":     "ldap://138.91.247.105",
+				"userdn":   "example,com",
+			},
+		}
+		for k, v := range raw {
+			fieldData.Raw[k] = v
+		}
+		_, err := testBackend.configUpdateOperation(ctx, req, fieldData)
+		return err
+	}
+
+	assert.Error(t, write(map[string]interface{}{"transit_ca_cert": "not a certificate"}))
+	assert.NoError(t, write(map[string]interface{}{
+		"transit_address":   "https://vault.example.com:8200",
+		"transit_token":     "transit-token",
+		"transit_key_name":  "passwords",
+		"transit_ca_cert":   validCertificate,
+		"transit_namespace": "/team-a/",
+	}))
+
+	// Writing the config drops the cached client, so the next one is built from it.
+	testBackend.transit.settings = transitSettings{address: "https://old.example.com"}
+	testBackend.transit.client = &transitClient{}
+	assert.NoError(t, write(nil))
+	assert.Nil(t, testBackend.transit.client)
+
+	resp, err := testBackend.configReadOperation(ctx, &logical.Request{Storage: storage}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, validCertificate, resp.Data["transit_ca_cert"])
+	assert.Equal(t, "team-a", resp.Data["transit_namespace"])
+	assert.NotContains(t, resp.Data, "transit_token")
+}
+
+// verifyingClient is a fake AD whose config check fails with err.
+type verifyingClient struct {
+	*fakeSecretsClient
+	err      error
+	verified int
+}
+
+func (c *verifyingClient) VerifyConnection(conf *client.ADConf) error {
+	c.verified++
+	return c.err
+}
+
+func TestConfig_VerifyConnection(t *testing.T) {
+	verifier := &verifyingClient{fakeSecretsClient: &fakeSecretsClient{}, err: errors.New("invalid credentials")}
+	b, storage := getBackend(t, verifier, nil)
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configPath,
+		Storage:   storage,
+	}
+	write := func(raw map[string]interface{}) (*logical.Response, error) {
+		fieldData := &framework.FieldData{
+			Schema: b.pathConfig().Fields,
+			Raw: map[string]interface{}{
+				"binddn":   "tester",
+				"bindpass": "pa$$w0rd",
+				"urls":     "ldap://138.91.247.105",
+				"userdn":   "example,com",
+			},
+		}
+		for k, v := range raw {
+			fieldData.Raw[k] = v
+		}
+		return b.configUpdateOperation(ctx, req, fieldData)
+	}
+
+	resp, err := write(nil)
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError(), "a config that can't bind should be rejected")
+	assert.Equal(t, string(errCodeConnectionFailed), resp.Data["data"].(map[string]interface{})["error_code"])
+	assert.Contains(t, resp.Error().Error(), "invalid credentials")
+	config, err := readConfig(ctx, storage)
+	assert.NoError(t, err)
+	assert.Nil(t, config, "a config that can't bind shouldn't be saved")
+
+	// It can be saved anyway.
+	resp, err = write(map[string]interface{}{"verify_connection": false})
+	assert.NoError(t, err)
+	assert.False(t, resp != nil && resp.IsError())
+	assert.Equal(t, 1, verifier.verified)
+	config, err = readConfig(ctx, storage)
+	assert.NoError(t, err)
+	assert.NotNil(t, config)
+
+	verifier.err = nil
+	resp, err = write(nil)
+	assert.NoError(t, err)
+	assert.False(t, resp != nil && resp.IsError())
+	assert.Equal(t, 2, verifier.verified)
+}
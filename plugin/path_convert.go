@@ -0,0 +1,368 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const moveToLibrarySuffix = "/move-to-library"
+
+// roleNameRegex matches the names the roles path accepts.
+var roleNameRegex = regexp.MustCompile("^" + framework.GenericNameRegex("name") + "$")
+
+func (b *backend) pathRoleMoveToLibrary() *framework.Path {
+	return &framework.Path{
+		Pattern: rolePrefix + framework.GenericNameRegex("name") + moveToLibrarySuffix + "$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "move",
+			OperationSuffix: "role-to-library",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the role",
+			},
+			"set_name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the library set to add the role's service account to.",
+				Required:    true,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.operationRoleMoveToLibrary,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Convert a role into a member of a library set.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    moveToLibraryHelpSynopsis,
+		HelpDescription: moveToLibraryHelpDescription,
+	}
+}
+
+func (b *backend) pathSetManageMoveToRole() *framework.Path {
+	return &framework.Path{
+		Pattern: libraryPrefix + "manage/" + framework.GenericNameRegex("name") + "/move-to-role$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "move",
+			OperationSuffix: "library-account-to-role",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the set.",
+				Required:    true,
+			},
+			"service_account_name": {
+				Type:        framework.TypeString,
+				Description: "The username/logon name of the service account to take out of the set.",
+				Required:    true,
+			},
+			"role_name": {
+				Type:        framework.TypeString,
+				Description: "Name of the role to create for the service account. It must not exist yet.",
+				Required:    true,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.operationSetManageMoveToRole,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Convert a member of a library set into a role.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    moveToRoleHelpSynopsis,
+		HelpDescription: moveToRoleHelpDescription,
+	}
+}
+
+func (b *backend) operationRoleMoveToLibrary(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	roleName := fieldData.Get("name").(string)
+	setName := fieldData.Get("set_name").(string)
+	if setName == "" {
+		return codedErrorResponse(errCodeInvalidRequest, `"set_name" must be provided`), nil
+	}
+
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if engineConf == nil {
+		return nil, errors.New("the config is currently unset")
+	}
+
+	// The set's lock is taken before credLock, like tidy takes them.
+	lock := locksutil.LockForKey(b.checkOutLocks, setName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	b.credLock.Lock()
+	defer b.credLock.Unlock()
+
+	role, err := readStoredRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse("role %q does not exist", roleName), nil
+	}
+	set, err := readSet(ctx, req.Storage, setName)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return codedErrorResponse(errCodeSetNotFound, `%q doesn't exist`, setName), nil
+	}
+	serviceAccountName := role.ServiceAccountName
+
+	// The set would rotate the password out from under any other role sharing
+	// the service account.
+	roleNames, err := req.Storage.List(ctx, roleStorageKey+"/")
+	if err != nil {
+		return nil, err
+	}
+	for _, otherRoleName := range roleNames {
+		if otherRoleName == roleName {
+			continue
+		}
+		otherRole, err := readStoredRole(ctx, req.Storage, otherRoleName)
+		if err != nil {
+			return nil, err
+		}
+		if otherRole != nil && normalizeServiceAccountName(otherRole.ServiceAccountName) == normalizeServiceAccountName(serviceAccountName) {
+			return codedErrorResponse(errCodeAccountAlreadyManaged, "%q is also managed by role %q", serviceAccountName, otherRoleName), nil
+		}
+	}
+	if role.Config != set.Config {
+		return codedErrorResponse(errCodeInvalidRequest, "role %q and set %q don't use the same config", roleName, setName), nil
+	}
+	if resp, err := b.checkServiceAccounts(ctx, req.Storage, set.Config, []string{serviceAccountName}, set.AllowPrivileged); resp != nil || err != nil {
+		return resp, err
+	}
+
+	credEntry, err := req.Storage.Get(ctx, storageKey+"/"+roleName)
+	if err != nil {
+		return nil, err
+	}
+	var cred map[string]interface{}
+	if credEntry != nil {
+		if err := credEntry.DecodeJSON(&cred); err != nil {
+			return nil, err
+		}
+	}
+	password, _ := cred["current_password"].(string)
+	if password == "" {
+		return codedErrorResponse(errCodeInvalidRequest, "%q has no password yet, so there's none to carry over to the set", roleName), nil
+	}
+
+	// Add the service account to the set as if it had just been checked in,
+	// but with the role's password and rotation time instead of a new password.
+	if err := storeAccountOwners(ctx, req.Storage, &accountOwner{Kind: accountOwnerSet, Name: setName}, []string{serviceAccountName}); err != nil {
+		return nil, err
+	}
+	if err := putPassword(ctx, req.Storage, b.transit, serviceAccountName, &storedPassword{
+		Password:    password,
+		LastRotated: role.LastVaultRotation.UTC(),
+	}); err != nil {
+		return nil, err
+	}
+	entry, err := logical.StorageEntryJSON(checkoutStoragePrefix+serviceAccountName, &CheckOut{IsAvailable: true})
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	set.ServiceAccountNames = append(set.ServiceAccountNames, serviceAccountName)
+	set.UpdatedBy = requesterIdentity(req)
+	set.UpdatedAt = b.now().UTC()
+	if err := storeSet(ctx, req.Storage, setName, set); err != nil {
+		return nil, err
+	}
+
+	if err := req.Storage.Delete(ctx, roleStorageKey+"/"+roleName); err != nil {
+		return nil, err
+	}
+	b.roleCache.Delete(roleName)
+	if err := req.Storage.Delete(ctx, roleErrorStoragePrefix+roleName); err != nil {
+		return nil, err
+	}
+	if err := b.deleteCred(ctx, req.Storage, roleName); err != nil {
+		return nil, err
+	}
+	b.clearRetry(ctx, req.Storage, retryKindRole, roleName)
+
+	b.Logger().Info("moved role to library set", "role", roleName, "set", setName, "service_account_name", serviceAccountName)
+	return warningsResponse(b.stampAccounts(engineConf, req.MountPoint, &accountOwner{Kind: accountOwnerSet, Name: setName}, []string{serviceAccountName})), nil
+}
+
+func (b *backend) operationSetManageMoveToRole(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	setName := fieldData.Get("name").(string)
+	requestedName := fieldData.Get("service_account_name").(string)
+	if requestedName == "" {
+		return codedErrorResponse(errCodeInvalidRequest, `"service_account_name" must be provided`), nil
+	}
+	roleName := fieldData.Get("role_name").(string)
+	if !roleNameRegex.MatchString(roleName) {
+		return codedErrorResponse(errCodeInvalidRequest, "%q isn't a valid role name", roleName), nil
+	}
+
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if engineConf == nil {
+		return nil, errors.New("the config is currently unset")
+	}
+
+	// The set's lock is taken before credLock, like tidy takes them.
+	lock := locksutil.LockForKey(b.checkOutLocks, setName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	b.credLock.Lock()
+	defer b.credLock.Unlock()
+
+	set, err := readSet(ctx, req.Storage, setName)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return codedErrorResponse(errCodeSetNotFound, `%q doesn't exist`, setName), nil
+	}
+	// The set's spelling is used, since its storage entries are keyed by it.
+	serviceAccountName := findServiceAccountName(set.ServiceAccountNames, requestedName)
+	if serviceAccountName == "" {
+		return codedErrorResponse(errCodeInvalidRequest, "%q isn't managed by %q", requestedName, setName), nil
+	}
+	remaining := serviceAccountsNotIn(set.ServiceAccountNames, []string{serviceAccountName})
+	if len(remaining) == 0 {
+		return codedErrorResponse(errCodeInvalidRequest, "%q is the only service account in %q, which must have at least one", serviceAccountName, setName), nil
+	}
+	existingRole, err := readStoredRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if existingRole != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "role %q already exists", roleName), nil
+	}
+	checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, req.Storage, serviceAccountName)
+	if err != nil {
+		return nil, err
+	}
+	if !checkOut.IsAvailable {
+		return codedErrorResponse(errCodeAlreadyCheckedOut, "%q can't be moved because it is currently checked out", serviceAccountName), nil
+	}
+	stored, err := loadPassword(ctx, req.Storage, b.transit, serviceAccountName)
+	if err != nil {
+		return nil, err
+	}
+	username, err := getUsername(serviceAccountName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Passwords stored before rotation times were tracked have no rotation time.
+	// Without one the role would rotate on its first read, so it's treated as
+	// rotated now.
+	lastRotated := stored.LastRotated
+	if lastRotated.IsZero() {
+		lastRotated = b.now().UTC()
+	}
+	role := &backendRole{
+		ServiceAccountName: serviceAccountName,
+		Config:             set.Config,
+		TTL:                engineConf.PasswordConf.TTL,
+		AllowPrivileged:    set.AllowPrivileged,
+		LastVaultRotation:  lastRotated,
+		UpdatedBy:          requesterIdentity(req),
+		UpdatedAt:          b.now().UTC(),
+	}
+	cred := map[string]interface{}{
+		"username":         username,
+		"current_password": stored.Password,
+	}
+	credEntry, err := logical.StorageEntryJSON(storageKey+"/"+roleName, cred)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, credEntry); err != nil {
+		return nil, err
+	}
+	b.credCache.Delete(roleName)
+	if err := b.writeRoleToStorage(ctx, req.Storage, roleName, role); err != nil {
+		return nil, err
+	}
+
+	set.ServiceAccountNames = remaining
+	set.pruneAccountTTLs()
+	set.UpdatedBy = requesterIdentity(req)
+	set.UpdatedAt = b.now().UTC()
+	if err := storeSet(ctx, req.Storage, setName, set); err != nil {
+		return nil, err
+	}
+	if err := b.checkOutHandler.Delete(ctx, req.Storage, serviceAccountName); err != nil {
+		return nil, err
+	}
+	if err := deleteAccountOwners(ctx, req.Storage, []string{serviceAccountName}); err != nil {
+		return nil, err
+	}
+	b.clearRetry(ctx, req.Storage, retryKindCheckIn, serviceAccountName)
+
+	b.Logger().Info("moved library account to role", "set", setName, "service_account_name", serviceAccountName, "role", roleName)
+	return warningsResponse(b.stampAccounts(engineConf, req.MountPoint, &accountOwner{Kind: accountOwnerRole, Name: roleName}, []string{serviceAccountName})), nil
+}
+
+const (
+	moveToLibraryHelpSynopsis = `
+Convert a role into a member of a library set.
+`
+	moveToLibraryHelpDescription = `
+Adds the role's service account to the library set named by "set_name", then
+deletes the role and its creds. The account keeps its current password and
+when Vault last rotated it, so it isn't rotated by the move, and the set
+rotates it as usual once it's next checked in or grows older than the set's
+max_password_age. The role's last password isn't carried over, since sets
+don't keep one.
+
+The move is refused if another role shares the service account, since the set
+would rotate its password out from under that role, or if the set doesn't allow
+privileged accounts and the account is privileged.
+`
+	moveToRoleHelpSynopsis = `
+Convert a member of a library set into a role.
+`
+	moveToRoleHelpDescription = `
+Takes a checked-in service account out of the set, and creates the role named
+by "role_name" for it. The role is given the account's current password and
+when Vault last rotated it, so it isn't rotated by the move, and the config's
+password TTL. Its other settings can be changed by writing to the role
+afterwards.
+
+The account can't be moved while it's checked out, or if it's the last one in
+the set. The role must not exist yet.
+`
+)
@@ -0,0 +1,92 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestMoveBetweenRolesAndLibrary(t *testing.T) {
+	directory := newMemoryDirectory()
+	b, storage := getBackend(t, directory, testConfig())
+	handle := requester(t, b, storage, "")
+
+	handle(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@example.com",
+	})
+	handle(logical.UpdateOperation, rolePrefix+"other", map[string]interface{}{
+		"service_account_name": "shared@example.com",
+	})
+	handle(logical.UpdateOperation, rolePrefix+"other-too", map[string]interface{}{
+		"service_account_name": "shared@example.com",
+	})
+	handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"lib@example.com"},
+	})
+	password := handle(logical.ReadOperation, credPrefix+"app", nil).Data["current_password"]
+
+	if resp := handle(logical.UpdateOperation, rolePrefix+"other/move-to-library", map[string]interface{}{
+		"set_name": "lib",
+	}); responseErrorCode(resp) != string(errCodeAccountAlreadyManaged) {
+		t.Fatalf("expected a shared service account to be refused but received %#v", resp)
+	}
+	if resp := handle(logical.UpdateOperation, rolePrefix+"app/move-to-library", map[string]interface{}{
+		"set_name": "nope",
+	}); responseErrorCode(resp) != string(errCodeSetNotFound) {
+		t.Fatalf("expected a missing set to be refused but received %#v", resp)
+	}
+
+	if resp := handle(logical.UpdateOperation, rolePrefix+"app/move-to-library", map[string]interface{}{
+		"set_name": "lib",
+	}); resp != nil {
+		t.Fatalf("unable to move the role: %#v", resp)
+	}
+	if resp := handle(logical.ReadOperation, rolePrefix+"app", nil); resp != nil {
+		t.Fatalf("expected the role to be deleted but received %#v", resp)
+	}
+	if resp := handle(logical.ReadOperation, libraryPrefix+"lib", nil); len(resp.Data["service_account_names"].([]string)) != 2 {
+		t.Fatalf("expected the service account to be added to the set but received %#v", resp.Data)
+	}
+	stored, err := loadPassword(ctx, storage, b.transit, "app@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Password != password || directory.account("app@example.com").password != password {
+		t.Fatal("expected the role's password to be carried over without rotating it")
+	}
+	if resp := handle(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@example.com",
+	}); responseErrorCode(resp) != string(errCodeAccountAlreadyManaged) {
+		t.Fatalf("expected the set to own the service account but received %#v", resp)
+	}
+
+	// And back again.
+	if resp := handle(logical.UpdateOperation, libraryPrefix+"manage/lib/move-to-role", map[string]interface{}{
+		"service_account_name": "app@example.com",
+		"role_name":            "other",
+	}); responseErrorCode(resp) != string(errCodeInvalidRequest) {
+		t.Fatalf("expected an existing role to be refused but received %#v", resp)
+	}
+	if resp := handle(logical.UpdateOperation, libraryPrefix+"manage/lib/move-to-role", map[string]interface{}{
+		"service_account_name": "APP@example.com",
+		"role_name":            "app-again",
+	}); resp != nil {
+		t.Fatalf("unable to move the service account: %#v", resp)
+	}
+	if resp := handle(logical.ReadOperation, libraryPrefix+"lib", nil); len(resp.Data["service_account_names"].([]string)) != 1 {
+		t.Fatalf("expected the service account to be removed from the set but received %#v", resp.Data)
+	}
+	resp := handle(logical.ReadOperation, credPrefix+"app-again", nil)
+	if resp == nil || resp.IsError() || resp.Data["current_password"] != password || directory.account("app@example.com").password != password {
+		t.Fatalf("expected the password to be carried over without rotating it but received %#v", resp)
+	}
+	if resp := handle(logical.UpdateOperation, libraryPrefix+"manage/lib/move-to-role", map[string]interface{}{
+		"service_account_name": "lib@example.com",
+		"role_name":            "lib",
+	}); responseErrorCode(resp) != string(errCodeInvalidRequest) {
+		t.Fatalf("expected the set's last service account to stay but received %#v", resp)
+	}
+}
@@ -6,12 +6,15 @@ package plugin
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
 	"github.com/go-errors/errors"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/robfig/cron/v3"
 )
 
 const (
@@ -22,6 +25,10 @@ const (
 	// we can't cache passwords for an entire second.
 	credCacheCleanup    = time.Second / 3
 	credCacheExpiration = time.Second / 2
+
+	// clockSkewTolerance is how far in the future a role's last Vault rotation
+	// may be before we assume it was recorded by a node whose clock was ahead of ours.
+	clockSkewTolerance = time.Minute
 )
 
 // deleteCred fulfills the DeleteWatcher interface in roles.
@@ -44,6 +51,11 @@ func (b *backend) invalidateCred(ctx context.Context, key string) {
 func (b *backend) pathCreds() *framework.Path {
 	return &framework.Path{
 		Pattern: credPrefix + framework.GenericNameRegex("name"),
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "request",
+			OperationSuffix: "service-account-credentials",
+		},
 		Fields: map[string]*framework.FieldSchema{
 			"name": {
 				Type:        framework.TypeString,
@@ -55,6 +67,13 @@ func (b *backend) pathCreds() *framework.Path {
 				Callback:                    b.credReadOperation,
 				ForwardPerformanceStandby:   true,
 				ForwardPerformanceSecondary: true,
+				Summary:                     "Retrieve a role's creds, rotating the password if its ttl has passed.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields:      credResponseFields(),
+					}},
+				},
 			},
 		},
 		HelpSynopsis:    credHelpSynopsis,
@@ -62,6 +81,48 @@ func (b *backend) pathCreds() *framework.Path {
 	}
 }
 
+// credResponseFields describes the fields returned when reading creds.
+func credResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"username": {
+			Type:        framework.TypeString,
+			Description: "The username of the service account.",
+		},
+		"current_password": {
+			Type:        framework.TypeString,
+			Description: "The current password of the service account.",
+		},
+		"last_password": {
+			Type:        framework.TypeString,
+			Description: "The previous password of the service account.",
+		},
+		"object_sid": {
+			Type:        framework.TypeString,
+			Description: "The service account's SID, if include_account_ids is set in the config.",
+		},
+		"object_guid": {
+			Type:        framework.TypeString,
+			Description: "The service account's objectGUID, if include_account_ids is set in the config.",
+		},
+		"kerberos_realm": {
+			Type:        framework.TypeString,
+			Description: "The service account's Kerberos realm, if include_kerberos_info is set in the config.",
+		},
+		"kerberos_principal": {
+			Type:        framework.TypeString,
+			Description: "The service account's Kerberos principal, if include_kerberos_info is set in the config.",
+		},
+		"netbios_domain": {
+			Type:        framework.TypeString,
+			Description: "The NetBIOS name of the service account's domain, if include_kerberos_info is set in the config.",
+		},
+		"kdcs": {
+			Type:        framework.TypeCommaStringSlice,
+			Description: "The KDCs of the service account's realm, if include_kerberos_info is set in the config.",
+		},
+	}
+}
+
 func (b *backend) credReadOperation(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
 	cred := make(map[string]interface{})
 
@@ -72,6 +133,9 @@ func (b *backend) credReadOperation(ctx context.Context, req *logical.Request, f
 	if engineConf == nil {
 		return nil, errors.New("the config is currently unset")
 	}
+	if resp := responseWrappingRequired(engineConf, req); resp != nil {
+		return resp, nil
+	}
 
 	roleName := fieldData.Get("name").(string)
 
@@ -92,6 +156,17 @@ func (b *backend) credReadOperation(ctx context.Context, req *logical.Request, f
 		return nil, nil
 	}
 	b.Logger().Debug(fmt.Sprintf("role is: %+v", role))
+	if engineConf, err = configFor(ctx, req.Storage, engineConf, role.Config); err != nil {
+		return nil, err
+	}
+
+	retry, err := readRetryTask(ctx, req.Storage, retryKindRole, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if retry != nil && retry.Disabled {
+		return codedErrorResponse(errCodeRoleDisabled, "%q was disabled after %d failed rotations, rotate it with %q to enable it: %s", roleName, retry.Attempts, rotateRolePath+roleName, retry.LastError), nil
+	}
 
 	var resp *logical.Response
 	var respErr error
@@ -99,6 +174,19 @@ func (b *backend) credReadOperation(ctx context.Context, req *logical.Request, f
 
 	switch {
 
+	case role.DisableRotation:
+		// The password is managed outside of Vault, so it's served as it was given.
+		cred, err := b.loadCred(ctx, req.Storage, roleName)
+		if err != nil {
+			return nil, err
+		}
+		if cred == nil {
+			return nil, fmt.Errorf("should have the creds for %+v but they're not found", role)
+		}
+		resp = &logical.Response{
+			Data: cred,
+		}
+
 	case role.LastVaultRotation == unset:
 		b.Logger().Info("rotating password for the first time so Vault will know it")
 		resp, respErr = b.generateAndReturnCreds(ctx, engineConf, req.Storage, roleName, role, cred)
@@ -112,36 +200,52 @@ func (b *backend) credReadOperation(ctx context.Context, req *logical.Request, f
 
 	default:
 		b.Logger().Debug("determining whether to rotate credential")
-		credIfc, found := b.credCache.Get(roleName)
-		if found {
-			b.Logger().Debug("checking cached credential")
-			cred = credIfc.(map[string]interface{})
-		} else {
-			b.Logger().Debug("checking stored credential")
-			entry, err := req.Storage.Get(ctx, storageKey+"/"+roleName)
-			if err != nil {
-				return nil, err
-			}
-			if entry == nil {
-				// If the creds aren't in storage, but roles are and we've created creds before,
-				// this is an unexpected state and something has gone wrong.
-				// Let's be explicit and error about this.
-				return nil, fmt.Errorf("should have the creds for %+v but they're not found", role)
-			}
-			if err := entry.DecodeJSON(&cred); err != nil {
+		cred, err = b.loadCred(ctx, req.Storage, roleName)
+		if err != nil {
+			return nil, err
+		}
+		if cred == nil {
+			// If the creds aren't in storage, but roles are and we've created creds before,
+			// this is an unexpected state and something has gone wrong.
+			// Let's be explicit and error about this.
+			return nil, fmt.Errorf("should have the creds for %+v but they're not found", role)
+		}
+
+		now := b.now().UTC()
+		if lastRotation := clampedLastRotation(role, now); !lastRotation.Equal(role.LastVaultRotation) {
+			// Store the clamped time, so the next rotation stays scheduled from
+			// now instead of from whenever it's next read.
+			b.Logger().Warn("the last Vault rotation is in the future, so scheduling the next rotation from now",
+				"role", roleName, "last_vault_rotation", role.LastVaultRotation, "now", now)
+			role.LastVaultRotation = lastRotation
+			if err := b.writeRoleToStorage(ctx, req.Storage, roleName, role); err != nil {
 				return nil, err
 			}
-			b.credCache.SetDefault(roleName, cred)
 		}
-
-		now := time.Now().UTC()
-		shouldBeRolled := role.LastVaultRotation.Add(time.Duration(role.TTL) * time.Second) // already in UTC
-		if now.After(shouldBeRolled) {
+		due := rotationDue(role, now)
+		if due && rotatedRecently(role, now) {
+			b.Logger().Warn("not rotating the password yet because the last rotation was less than min_rotation_interval ago",
+				"role", roleName, "last_vault_rotation", role.LastVaultRotation, "min_rotation_interval", role.MinRotationInterval)
+			resp = &logical.Response{
+				Data: cred,
+			}
+		} else if due {
 			b.Logger().Info(fmt.Sprintf(
 				"last Vault rotation was at %s, and since the TTL is %d and it's now %s, it's time to rotate it",
 				role.LastVaultRotation.String(), role.TTL, now.String()),
 			)
 			resp, respErr = b.generateAndReturnCreds(ctx, engineConf, req.Storage, roleName, role, cred)
+			var paused *rotationPausedError
+			var tooYoung *minPasswordAgeError
+			if errors.As(respErr, &paused) {
+				// The current password still works, so keep handing it out until rotation resumes.
+				resp, respErr = &logical.Response{Data: cred}, nil
+				resp.AddWarning(paused.Error())
+			} else if errors.As(respErr, &tooYoung) {
+				// Likewise, the rotation is deferred until AD allows it.
+				resp, respErr = &logical.Response{Data: cred}, nil
+				resp.AddWarning(tooYoung.Error())
+			}
 		} else {
 			b.Logger().Debug("returning previous credential")
 			resp = &logical.Response{
@@ -150,13 +254,110 @@ func (b *backend) credReadOperation(ctx context.Context, req *logical.Request, f
 		}
 	}
 	if respErr != nil {
-		return nil, respErr
+		b.enqueueRetry(ctx, req.Storage, retryKindRole, roleName, "", respErr)
+		return errorResponseFor(respErr)
 	}
+	b.usage.credsIssued(ctx, req.Storage, b.now(), roleName)
+	if resp != nil && resp.Data != nil {
+		resp.Data = credResponseData(engineConf, role, resp.Data)
+	}
+	b.addAccountIDs(engineConf, role.ServiceAccountName, resp)
+	b.addKerberosInfo(engineConf, role.ServiceAccountName, resp)
 	return resp, nil
 }
 
+// loadCred returns the role's creds from the cache, or from storage if they aren't
+// cached. It returns nil if there are none.
+func (b *backend) loadCred(ctx context.Context, storage logical.Storage, roleName string) (map[string]interface{}, error) {
+	if credIfc, found := b.credCache.Get(roleName); found {
+		b.Logger().Debug("checking cached credential")
+		return credIfc.(map[string]interface{}), nil
+	}
+	b.Logger().Debug("checking stored credential")
+	entry, err := storage.Get(ctx, storageKey+"/"+roleName)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	cred := make(map[string]interface{})
+	if err := entry.DecodeJSON(&cred); err != nil {
+		return nil, err
+	}
+	b.credCache.SetDefault(roleName, cred)
+	return cred, nil
+}
+
+// storeExternalPassword stores the password of a role with rotation disabled as
+// its current password, keeping the one it replaces as its last password.
+func (b *backend) storeExternalPassword(ctx context.Context, storage logical.Storage, roleName, serviceAccountName, password string) error {
+	b.credLock.Lock()
+	defer b.credLock.Unlock()
+
+	username, err := getUsername(serviceAccountName)
+	if err != nil {
+		return err
+	}
+	previousCred, err := b.loadCred(ctx, storage, roleName)
+	if err != nil {
+		return err
+	}
+	cred := map[string]interface{}{
+		"username":         username,
+		"current_password": password,
+	}
+	if previousCred != nil && previousCred["username"] == username && previousCred["current_password"] != password {
+		cred["last_password"] = previousCred["current_password"]
+	}
+	entry, err := logical.StorageEntryJSON(storageKey+"/"+roleName, cred)
+	if err != nil {
+		return err
+	}
+	if err := storage.Put(ctx, entry); err != nil {
+		return err
+	}
+	b.credCache.SetDefault(roleName, cred)
+	return nil
+}
+
+// credResponseData returns the creds to respond with, leaving out last_password
+// if the role or config says to. The creds may be cached, so they're copied
+// rather than changed.
+func credResponseData(engineConf *configuration, role *backendRole, cred map[string]interface{}) map[string]interface{} {
+	if !role.OmitLastPassword && !engineConf.OmitLastPassword {
+		return cred
+	}
+	data := make(map[string]interface{}, len(cred))
+	for k, v := range cred {
+		if k != "last_password" {
+			data[k] = v
+		}
+	}
+	return data
+}
+
 func (b *backend) generateAndReturnCreds(ctx context.Context, engineConf *configuration, storage logical.Storage, roleName string, role *backendRole, previousCred map[string]interface{}) (*logical.Response, error) {
-	newPassword, err := GeneratePassword(ctx, engineConf.PasswordConf, b.System())
+	if role.DisableRotation {
+		return nil, errRotationDisabled
+	}
+	engineConf, err := configFor(ctx, storage, engineConf, role.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := locksutil.LockForKey(b.rotationLocks, role.ServiceAccountName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := checkRotationPaused(ctx, storage, b.now()); err != nil {
+		return nil, err
+	}
+	if err := checkMinPasswordAge(b.client, engineConf, role.ServiceAccountName, b.now()); err != nil {
+		return nil, err
+	}
+
+	newPassword, err := GeneratePassword(ctx, engineConf.PasswordConf.withComposition(role.PasswordComposition), b.System())
 	if err != nil {
 		return nil, err
 	}
@@ -176,7 +377,6 @@ func (b *backend) generateAndReturnCreds(ctx context.Context, engineConf *config
 		CurrentPassword:    currentPassword,
 		LastPassword:       lastPassword,
 		RoleName:           roleName,
-		TTL:                role.TTL,
 		ServiceAccountName: role.ServiceAccountName,
 		LastVaultRotation:  role.LastVaultRotation,
 	}
@@ -189,11 +389,26 @@ func (b *backend) generateAndReturnCreds(ctx context.Context, engineConf *config
 
 	err = b.client.UpdatePassword(engineConf.ADConf, role.ServiceAccountName, newPassword)
 	if err != nil {
+		b.recordRoleError(ctx, storage, roleName, roleErrorRotation, err)
 		return nil, err
 	}
+	if role.VerifyAfterRotation {
+		if err := b.verifyRotation(ctx, engineConf, role.ServiceAccountName, newPassword); err != nil {
+			b.recordRoleError(ctx, storage, roleName, roleErrorVerification, err)
+			// Put back the password Vault still has, so the account keeps working.
+			if currentPassword != "" {
+				if restoreErr := b.client.UpdatePassword(engineConf.ADConf, role.ServiceAccountName, currentPassword); restoreErr != nil {
+					b.Logger().Warn("unable to restore the previous password after verification failed", "role", roleName, "error", restoreErr)
+				} else if walErr := framework.DeleteWAL(ctx, storage, walID); walErr != nil {
+					b.Logger().Warn("failed to delete password rotation WAL", "error", walErr.Error())
+				}
+			}
+			return nil, err
+		}
+	}
 
 	// Time recorded is in UTC for easier user comparison to AD's last rotated time, which is set to UTC by Microsoft.
-	role.LastVaultRotation = time.Now().UTC()
+	role.LastVaultRotation = b.now().UTC()
 	if err := b.writeRoleToStorage(ctx, storage, roleName, role); err != nil {
 		return nil, err
 	}
@@ -226,6 +441,7 @@ func (b *backend) generateAndReturnCreds(ctx context.Context, engineConf *config
 		return nil, err
 	}
 	b.credCache.SetDefault(roleName, cred)
+	b.usage.rotated(ctx, storage, b.now())
 
 	// Delete the WAL entry
 	if err := framework.DeleteWAL(ctx, storage, walID); err != nil {
@@ -233,12 +449,64 @@ func (b *backend) generateAndReturnCreds(ctx context.Context, engineConf *config
 		// The WAL will eventually be discarded by the rollback handler.
 		b.Logger().Warn("failed to delete password rotation WAL", "error", err.Error())
 	}
+	b.clearRetry(ctx, storage, retryKindRole, roleName)
 
 	return &logical.Response{
 		Data: cred,
 	}, nil
 }
 
+// rotationDue reports whether a role's password should be rotated at the given time.
+// The last rotation time is recorded by whichever node was active, so after a failover
+// to a node whose clock is behind, it may appear to be in the future. Rather than
+// waiting for our clock to catch up, which could take far longer than the TTL, or
+// rotating early, the next rotation is scheduled as if it was rotated now.
+func rotationDue(role *backendRole, now time.Time) bool {
+	lastRotation := clampedLastRotation(role, now)
+	if role.RotationSchedule != "" {
+		schedule, err := rotationScheduleParser.Parse(role.RotationSchedule)
+		if err != nil {
+			// Schedules are validated when roles are written, so this is unexpected.
+			// Rotating is safer than letting the password live forever.
+			return true
+		}
+		return scheduledRotationDue(schedule, lastRotation, time.Duration(role.RotationWindow)*time.Second, now)
+	}
+	shouldBeRolled := lastRotation.Add(time.Duration(role.TTL) * time.Second) // already in UTC
+	return now.After(shouldBeRolled)
+}
+
+// clampedLastRotation returns the role's last Vault rotation, or now if it's more
+// than clockSkewTolerance in the future.
+func clampedLastRotation(role *backendRole, now time.Time) time.Time {
+	if role.LastVaultRotation.After(now.Add(clockSkewTolerance)) {
+		return now
+	}
+	return role.LastVaultRotation
+}
+
+// rotatedRecently reports whether the role's password was rotated less than its
+// min_rotation_interval ago, so a consumer reading the creds in a tight loop can't
+// churn the password. A last rotation that seems to be in the future is from a
+// node whose clock was ahead, and isn't counted as recent.
+func rotatedRecently(role *backendRole, now time.Time) bool {
+	if role.MinRotationInterval <= 0 || role.LastVaultRotation.After(now) {
+		return false
+	}
+	return now.Before(role.LastVaultRotation.Add(time.Duration(role.MinRotationInterval) * time.Second))
+}
+
+// scheduledRotationDue reports whether the schedule has come due since the last rotation.
+// With a window, the scheduled time must also have passed within the window; once it
+// closes, the rotation waits for the next scheduled time.
+func scheduledRotationDue(schedule cron.Schedule, lastVaultRotation time.Time, window time.Duration, now time.Time) bool {
+	since := lastVaultRotation
+	if window > 0 && since.Before(now.Add(-window)) {
+		since = now.Add(-window)
+	}
+	return !schedule.Next(since).After(now)
+}
+
 // getUsername extracts the username from a service account name by
 // splitting on @. For example, if vault@hashicorp.com is the service
 // account, vault is the username.
@@ -120,3 +120,309 @@ func (f *thisFake) UpdatePassword(conf *client.ADConf, serviceAccountName string
 func (f *thisFake) UpdateRootPassword(conf *client.ADConf, bindDN string, newPassword string) error {
 	return nil
 }
+
+func TestRotationDue(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+	testCases := map[string]struct {
+		lastVaultRotation time.Time
+		expected          bool
+	}{
+		"within ttl": {
+			lastVaultRotation: now.Add(-30 * time.Second),
+			expected:          false,
+		},
+		"past ttl": {
+			lastVaultRotation: now.Add(-2 * time.Minute),
+			expected:          true,
+		},
+		"slightly in the future": {
+			lastVaultRotation: now.Add(clockSkewTolerance / 2),
+			expected:          false,
+		},
+		"far in the future": {
+			lastVaultRotation: now.Add(24 * time.Hour),
+			expected:          false,
+		},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			role := &backendRole{
+				TTL:               60,
+				LastVaultRotation: testCase.lastVaultRotation,
+			}
+			if actual := rotationDue(role, now); actual != testCase.expected {
+				t.Fatalf("expected %t but received %t", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestScheduledRotationDue(t *testing.T) {
+	// Saturday, January 4th, 2020 at 12:00 UTC.
+	now := time.Date(2020, time.January, 4, 12, 0, 0, 0, time.UTC)
+	testCases := map[string]struct {
+		lastVaultRotation time.Time
+		rotationWindow    int
+		expected          bool
+	}{
+		"rotated since the scheduled time": {
+			lastVaultRotation: now.Add(-time.Hour),
+			expected:          false,
+		},
+		"scheduled time passed": {
+			lastVaultRotation: now.Add(-24 * time.Hour),
+			expected:          true,
+		},
+		"within the window": {
+			lastVaultRotation: now.Add(-24 * time.Hour),
+			rotationWindow:    int((13 * time.Hour).Seconds()),
+			expected:          true,
+		},
+		"window has closed": {
+			lastVaultRotation: now.Add(-24 * time.Hour),
+			rotationWindow:    int((2 * time.Hour).Seconds()),
+			expected:          false,
+		},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			role := &backendRole{
+				RotationSchedule:  "0 0 * * SAT",
+				RotationWindow:    testCase.rotationWindow,
+				LastVaultRotation: testCase.lastVaultRotation,
+			}
+			if actual := rotationDue(role, now); actual != testCase.expected {
+				t.Fatalf("expected %t but received %t", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestOmitLastPassword(t *testing.T) {
+	engineConf := testConfig()
+	b, storage := getBackend(t, newMemoryDirectory(), engineConf)
+	handle := succeedingRequester(t, b, storage, "")
+	rotatedCreds := func(roleName string) map[string]interface{} {
+		t.Helper()
+		handle(logical.UpdateOperation, rotateRolePath+roleName, nil)
+		return handle(logical.ReadOperation, credPrefix+roleName, nil).Data
+	}
+
+	handle(logical.UpdateOperation, rolePrefix+"omitted", map[string]interface{}{
+		"service_account_name": "omitted@example.com",
+		"omit_last_password":   true,
+	})
+	handle(logical.UpdateOperation, rolePrefix+"shown", map[string]interface{}{
+		"service_account_name": "shown@example.com",
+	})
+	handle(logical.ReadOperation, credPrefix+"omitted", nil)
+	handle(logical.ReadOperation, credPrefix+"shown", nil)
+
+	if creds := rotatedCreds("omitted"); creds["current_password"] == nil || creds["last_password"] != nil {
+		t.Fatalf("expected only the current password but received %#v", creds)
+	}
+	if creds := rotatedCreds("shown"); creds["last_password"] == nil {
+		t.Fatalf("expected the last password but received %#v", creds)
+	}
+	// The last password is still kept, so the role can be rolled back.
+	if resp := handle(logical.UpdateOperation, rolePrefix+"omitted"+rollbackPasswordSuffix, nil); resp.Data["last_password"] != nil {
+		t.Fatalf("expected only the current password but received %#v", resp.Data)
+	}
+
+	engineConf.OmitLastPassword = true
+	if err := writeConfig(ctx, storage, engineConf); err != nil {
+		t.Fatal(err)
+	}
+	if creds := rotatedCreds("shown"); creds["last_password"] != nil {
+		t.Fatalf("expected the config to omit the last password but received %#v", creds)
+	}
+}
+
+func TestMinRotationInterval(t *testing.T) {
+	b, storage := getBackend(t, newMemoryDirectory(), testConfig())
+	// AD shows passwords as set at the real time, so the fake time stays ahead
+	// of it to keep them from looking rotated outside of Vault.
+	now := time.Now().Add(time.Hour)
+	b.now = func() time.Time { return now }
+	handle := succeedingRequester(t, b, storage, "")
+	password := func() string {
+		t.Helper()
+		return handle(logical.ReadOperation, credPrefix+"polled", nil).Data["current_password"].(string)
+	}
+
+	handle(logical.UpdateOperation, rolePrefix+"polled", map[string]interface{}{
+		"service_account_name":  "polled@example.com",
+		"ttl":                   60,
+		"min_rotation_interval": 600,
+	})
+	if resp := handle(logical.ReadOperation, rolePrefix+"polled", nil); resp.Data["min_rotation_interval"] != 600 {
+		t.Fatalf("expected min_rotation_interval to be returned but received %#v", resp.Data)
+	}
+	first := password()
+
+	// The ttl has passed, but the password was rotated too recently.
+	now = now.Add(2 * time.Minute)
+	if second := password(); second != first {
+		t.Fatal("expected the password not to be rotated within min_rotation_interval")
+	}
+
+	now = now.Add(10 * time.Minute)
+	if third := password(); third == first {
+		t.Fatal("expected the password to be rotated once min_rotation_interval passed")
+	}
+}
+
+func TestDisableRotation(t *testing.T) {
+	directory := newMemoryDirectory()
+	b, storage := getBackend(t, directory, testConfig())
+	now := time.Now().Add(time.Hour)
+	b.now = func() time.Time { return now }
+	handle := requester(t, b, storage, "")
+	succeed := succeedingRequester(t, b, storage, "")
+	password := func() string {
+		t.Helper()
+		return succeed(logical.ReadOperation, credPrefix+"managed", nil).Data["current_password"].(string)
+	}
+
+	const account = "managed@example.com"
+	if err := directory.UpdatePassword(nil, account, "external-1"); err != nil {
+		t.Fatal(err)
+	}
+	roleData := map[string]interface{}{
+		"service_account_name": account,
+		"ttl":                  60,
+		"disable_rotation":     true,
+		"password":             "wrong",
+	}
+	if code := responseErrorCode(handle(logical.UpdateOperation, rolePrefix+"managed", roleData)); code != string(errCodeInvalidRequest) {
+		t.Fatalf("expected a wrong password to be rejected but received %v", code)
+	}
+	delete(roleData, "password")
+	if code := responseErrorCode(handle(logical.UpdateOperation, rolePrefix+"managed", roleData)); code != string(errCodeInvalidRequest) {
+		t.Fatalf("expected a password to be required but received %v", code)
+	}
+	roleData["password"] = "external-1"
+	succeed(logical.UpdateOperation, rolePrefix+"managed", roleData)
+	if actual := password(); actual != "external-1" {
+		t.Fatalf("expected the given password but received %q", actual)
+	}
+
+	// The ttl has passed, but the password still isn't rotated.
+	now = now.Add(2 * time.Minute)
+	if actual := password(); actual != "external-1" {
+		t.Fatalf("expected the password not to be rotated but received %q", actual)
+	}
+	if code := responseErrorCode(handle(logical.UpdateOperation, rotateRolePath+"managed", nil)); code != string(errCodeRotationDisabled) {
+		t.Fatalf("expected rotate-role to be refused but received %v", code)
+	}
+
+	// Updating the role without a password keeps the stored one.
+	delete(roleData, "password")
+	roleData["ttl"] = 120
+	succeed(logical.UpdateOperation, rolePrefix+"managed", roleData)
+	if actual := password(); actual != "external-1" {
+		t.Fatalf("expected the stored password to be kept but received %q", actual)
+	}
+
+	// The password changed outside of Vault is given to it again.
+	if err := directory.UpdatePassword(nil, account, "external-2"); err != nil {
+		t.Fatal(err)
+	}
+	roleData["password"] = "external-2"
+	succeed(logical.UpdateOperation, rolePrefix+"managed", roleData)
+	resp := succeed(logical.ReadOperation, credPrefix+"managed", nil)
+	if resp.Data["current_password"] != "external-2" || resp.Data["last_password"] != "external-1" {
+		t.Fatalf("expected the new and last passwords but received %#v", resp.Data)
+	}
+	if err := directory.VerifyPassword(nil, account, "external-2"); err != nil {
+		t.Fatal("expected the password in AD not to be changed by Vault")
+	}
+}
+
+func TestCredsLastRotationInTheFuture(t *testing.T) {
+	b, storage := getBackend(t, newMemoryDirectory(), testConfig())
+	now := time.Now().UTC()
+	b.now = func() time.Time { return now }
+	handle := succeedingRequester(t, b, storage, "")
+
+	handle(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@example.com",
+		"ttl":                  60,
+	})
+	password := handle(logical.ReadOperation, credPrefix+"app", nil).Data["current_password"]
+
+	// A node whose clock was ahead recorded the last rotation.
+	role, err := b.readRole(ctx, storage, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	role.LastVaultRotation = now.Add(24 * time.Hour)
+	if err := b.writeRoleToStorage(ctx, storage, "app", role); err != nil {
+		t.Fatal(err)
+	}
+
+	// The password isn't rotated early, and the next rotation is scheduled from now.
+	if resp := handle(logical.ReadOperation, credPrefix+"app", nil); resp.Data["current_password"] != password {
+		t.Fatalf("expected the password not to be rotated early but received %#v", resp.Data)
+	}
+	if role, err = b.readRole(ctx, storage, "app"); err != nil {
+		t.Fatal(err)
+	}
+	if !role.LastVaultRotation.Equal(now) {
+		t.Fatalf("expected the last rotation to be clamped to %s but received %s", now, role.LastVaultRotation)
+	}
+	now = now.Add(2 * time.Minute)
+	if resp := handle(logical.ReadOperation, credPrefix+"app", nil); resp.Data["current_password"] == password {
+		t.Fatal("expected the password to be rotated a ttl after now")
+	}
+}
+
+func TestRotateCredentialRollbackFromStorage(t *testing.T) {
+	directory := newMemoryDirectory()
+	b, storage := getBackend(t, directory, testConfig())
+	handle := succeedingRequester(t, b, storage, "")
+
+	handle(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@example.com",
+		"ttl":                  60,
+		"notes":                "kept across rollbacks",
+	})
+	password := handle(logical.ReadOperation, credPrefix+"app", nil).Data["current_password"]
+	role, err := readStoredRole(ctx, storage, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The WAL is stored as JSON, like a rotation writes it before changing AD.
+	walID, err := framework.PutWAL(ctx, storage, rotateCredentialWAL, rotateCredentialEntry{
+		CurrentPassword:    password.(string),
+		RoleName:           "app",
+		ServiceAccountName: "app@example.com",
+		LastVaultRotation:  role.LastVaultRotation,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handle(logical.UpdateOperation, rotateRolePath+"app", nil)
+	wal, err := framework.GetWAL(ctx, storage, walID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.handleRotateCredentialRollback(ctx, storage, wal.Data); err != nil {
+		t.Fatal(err)
+	}
+
+	if directory.account("app@example.com").password != password {
+		t.Fatal("expected the WAL's password to be restored in AD")
+	}
+	if resp := handle(logical.ReadOperation, credPrefix+"app", nil); resp.Data["current_password"] != password {
+		t.Fatalf("expected the WAL's password to be restored but received %#v", resp.Data)
+	}
+	rolledBack, err := readStoredRole(ctx, storage, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rolledBack.LastVaultRotation.Equal(role.LastVaultRotation) || rolledBack.TTL != 60 || rolledBack.Notes != "kept across rollbacks" {
+		t.Fatalf("expected the stored role with the WAL's rotation time but received %#v", rolledBack)
+	}
+}
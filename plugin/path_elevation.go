@@ -0,0 +1,634 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	elevationRolePrefix  = "elevation-role/"
+	elevationCredsPrefix = "elevation-creds/"
+
+	secretElevationType = "elevation"
+)
+
+// elevationRole grants a service account membership of an admin group for the
+// length of a lease. The account's password is rotated when the lease starts and
+// again when it ends, so it's only usable with admin rights while the lease lasts.
+// Its password and whether it's elevated are tracked like a library account's.
+type elevationRole struct {
+	ServiceAccountName string        `json:"service_account_name"`
+	GroupDN            string        `json:"group_dn"`
+	TTL                time.Duration `json:"ttl"`
+	MaxTTL             time.Duration `json:"max_ttl"`
+}
+
+func (r *elevationRole) Map() map[string]interface{} {
+	return map[string]interface{}{
+		"service_account_name": r.ServiceAccountName,
+		"group_dn":             r.GroupDN,
+		"ttl":                  int64(r.TTL.Seconds()),
+		"max_ttl":              int64(r.MaxTTL.Seconds()),
+	}
+}
+
+func (b *backend) pathListElevationRoles() *framework.Path {
+	return &framework.Path{
+		Pattern: elevationRolePrefix + "?$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationSuffix: "elevation-roles",
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.operationElevationRoleList,
+				Summary:  "List the name of each elevation role.",
+			},
+		},
+		HelpSynopsis:    elevationHelpSynopsis,
+		HelpDescription: elevationHelpDescription,
+	}
+}
+
+func (b *backend) pathElevationRoles() *framework.Path {
+	return &framework.Path{
+		Pattern: elevationRolePrefix + framework.GenericNameRegex("name"),
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationSuffix: "elevation-role",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the role.",
+				Required:    true,
+			},
+			"service_account_name": {
+				Type:        framework.TypeString,
+				Description: "The service account to elevate. It can't be changed once the role is created.",
+			},
+			"group_dn": {
+				Type:        framework.TypeString,
+				Description: "The distinguished name of the admin group to add the service account to.",
+			},
+			"ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "In seconds, the default length of time the service account is elevated for.",
+			},
+			"max_ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "In seconds, the maximum length of time the service account may be elevated for. 0 means the mount's max lease TTL.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.operationElevationRoleUpdate,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Create or update an elevation role.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
+			},
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.operationElevationRoleRead,
+				Summary:  "Read an elevation role.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"service_account_name": {
+								Type:        framework.TypeString,
+								Description: "The service account to elevate.",
+							},
+							"group_dn": {
+								Type:        framework.TypeString,
+								Description: "The distinguished name of the admin group to add the service account to.",
+							},
+							"ttl": {
+								Type:        framework.TypeDurationSecond,
+								Description: "In seconds, the default length of time the service account is elevated for.",
+							},
+							"max_ttl": {
+								Type:        framework.TypeDurationSecond,
+								Description: "In seconds, the maximum length of time the service account may be elevated for.",
+							},
+							"elevated": {
+								Type:        framework.TypeBool,
+								Description: "Whether the service account is currently elevated.",
+							},
+							"effective_ttl": {
+								Type:        framework.TypeDurationSecond,
+								Description: "In seconds, the ttl leases are given once the mount's limits are applied.",
+							},
+							"effective_max_ttl": {
+								Type:        framework.TypeDurationSecond,
+								Description: "In seconds, the max_ttl leases are given once the mount's limits are applied.",
+							},
+						},
+					}},
+				},
+			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback:                    b.operationElevationRoleDelete,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Delete an elevation role that isn't in use.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    elevationHelpSynopsis,
+		HelpDescription: elevationHelpDescription,
+	}
+}
+
+func (b *backend) pathElevationCreds() *framework.Path {
+	return &framework.Path{
+		Pattern: elevationCredsPrefix + framework.GenericNameRegex("name"),
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "request",
+			OperationSuffix: "elevated-credentials",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the elevation role.",
+				Required:    true,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback:                    b.operationElevationCredsRead,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Elevate the role's service account and return its rotated password.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"service_account_name": {
+								Type:        framework.TypeString,
+								Description: "The service account that was elevated.",
+							},
+							"password": {
+								Type:        framework.TypeString,
+								Description: "The service account's new password.",
+							},
+							"group_dn": {
+								Type:        framework.TypeString,
+								Description: "The distinguished name of the group the service account was added to.",
+							},
+						},
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    elevationHelpSynopsis,
+		HelpDescription: elevationHelpDescription,
+	}
+}
+
+func (b *backend) secretElevation() *framework.Secret {
+	return &framework.Secret{
+		Type: secretElevationType,
+		Fields: map[string]*framework.FieldSchema{
+			"service_account_name": {
+				Type:        framework.TypeString,
+				Description: "Service account name",
+			},
+			"password": {
+				Type:        framework.TypeString,
+				Description: "Password",
+			},
+			"group_dn": {
+				Type:        framework.TypeString,
+				Description: "Group DN",
+			},
+		},
+		Renew:  b.renewElevation,
+		Revoke: b.endElevation,
+	}
+}
+
+func (b *backend) operationElevationRoleList(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	keys, err := req.Storage.List(ctx, elevationRolePrefix)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(keys), nil
+}
+
+func (b *backend) operationElevationRoleUpdate(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	roleName := fieldData.Get("name").(string)
+
+	lock := locksutil.LockForKey(b.checkOutLocks, elevationRolePrefix+roleName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	role, err := readElevationRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	isNew := role == nil
+	if isNew {
+		role = &elevationRole{}
+	}
+	if serviceAccountNameRaw, ok := fieldData.GetOk("service_account_name"); ok {
+		engineConf, err := readConfig(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		serviceAccountName, err := canonicalServiceAccountName(engineConf, serviceAccountNameRaw.(string))
+		if err != nil {
+			return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+		}
+		if !isNew && serviceAccountName != normalizeServiceAccountName(role.ServiceAccountName) {
+			return codedErrorResponse(errCodeInvalidRequest, "service_account_name can't be changed, delete the role and create it again"), nil
+		}
+		if isNew {
+			role.ServiceAccountName = serviceAccountName
+		}
+	}
+	if groupDN, ok := fieldData.GetOk("group_dn"); ok {
+		role.GroupDN = groupDN.(string)
+	}
+	if ttl, ok := fieldData.GetOk("ttl"); ok {
+		role.TTL = time.Duration(ttl.(int)) * time.Second
+	}
+	if maxTTL, ok := fieldData.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(maxTTL.(int)) * time.Second
+	}
+
+	if role.ServiceAccountName == "" {
+		return codedErrorResponse(errCodeInvalidRequest, `"service_account_name" must be provided`), nil
+	}
+	if role.GroupDN == "" {
+		return codedErrorResponse(errCodeInvalidRequest, `"group_dn" must be provided`), nil
+	}
+	if _, err := ldap.ParseDN(role.GroupDN); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "group_dn is invalid: %s", err), nil
+	}
+	if err := b.validateLeaseTTLs(fieldData, role.TTL, role.MaxTTL); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+	}
+
+	if isNew {
+		// The account's password is rotated on every elevation, which would
+		// silently invalidate the password stored by a role or set.
+		if resp, err := b.checkUnmanaged(ctx, req.Storage, []string{role.ServiceAccountName}); resp != nil || err != nil {
+			return resp, err
+		}
+		// The account is only meant to be privileged while it's elevated.
+		if resp, err := b.checkServiceAccounts(ctx, req.Storage, "", []string{role.ServiceAccountName}, false); resp != nil || err != nil {
+			return resp, err
+		}
+		if err := storeAccountOwners(ctx, req.Storage, &accountOwner{Kind: accountOwnerElevation, Name: roleName}, []string{role.ServiceAccountName}); err != nil {
+			return nil, err
+		}
+		// Like a library set's accounts, the account's password is rotated as
+		// soon as Vault starts managing it.
+		if err := b.checkOutHandler.CheckIn(ctx, req.Storage, role.ServiceAccountName); err != nil {
+			return errorResponseFor(err)
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(elevationRolePrefix+roleName, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	if !isNew {
+		return nil, nil
+	}
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return warningsResponse(b.stampAccounts(engineConf, req.MountPoint, &accountOwner{Kind: accountOwnerElevation, Name: roleName}, []string{role.ServiceAccountName})), nil
+}
+
+func (b *backend) operationElevationRoleRead(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	roleName := fieldData.Get("name").(string)
+
+	lock := locksutil.LockForKey(b.checkOutLocks, elevationRolePrefix+roleName)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	role, err := readElevationRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+	respData := role.Map()
+	checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, req.Storage, role.ServiceAccountName)
+	if err != nil && err != errNotFound {
+		return nil, err
+	}
+	respData["elevated"] = checkOut != nil && !checkOut.IsAvailable
+	b.addEffectiveTTLs(respData, role.TTL, role.MaxTTL)
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+func (b *backend) operationElevationRoleDelete(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	roleName := fieldData.Get("name").(string)
+
+	lock := locksutil.LockForKey(b.checkOutLocks, elevationRolePrefix+roleName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	role, err := readElevationRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+	checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, req.Storage, role.ServiceAccountName)
+	if err != nil && err != errNotFound {
+		return nil, err
+	}
+	if checkOut != nil && !checkOut.IsAvailable {
+		return codedErrorResponse(errCodeAlreadyCheckedOut, "%q can't be deleted while %q is elevated, revoke its lease first", roleName, role.ServiceAccountName), nil
+	}
+	if err := b.checkOutHandler.Delete(ctx, req.Storage, role.ServiceAccountName); err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Delete(ctx, elevationRolePrefix+roleName); err != nil {
+		return nil, err
+	}
+	if err := deleteAccountOwners(ctx, req.Storage, []string{role.ServiceAccountName}); err != nil {
+		return nil, err
+	}
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return warningsResponse(b.clearStamps(engineConf, []string{role.ServiceAccountName})), nil
+}
+
+func (b *backend) operationElevationCredsRead(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	roleName := fieldData.Get("name").(string)
+
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if engineConf == nil {
+		return nil, errors.New("the config is currently unset")
+	}
+	if resp := responseWrappingRequired(engineConf, req); resp != nil {
+		return resp, nil
+	}
+	groupClient, ok := b.client.(GroupMembershipClient)
+	if !ok {
+		return nil, errors.New("the secrets client doesn't support group membership")
+	}
+
+	lock := locksutil.LockForKey(b.checkOutLocks, elevationRolePrefix+roleName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	role, err := readElevationRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return codedErrorResponse(errCodeInvalidRequest, "elevation role %q doesn't exist", roleName), nil
+	}
+	current, err := b.checkOutHandler.LoadCheckOut(ctx, req.Storage, role.ServiceAccountName)
+	if err != nil {
+		return nil, err
+	}
+	if !current.IsAvailable {
+		return codedErrorResponse(errCodeAlreadyCheckedOut, "%q is already elevated", role.ServiceAccountName), nil
+	}
+
+	entry, err := b.client.Get(engineConf.ADConf, role.ServiceAccountName)
+	if err != nil {
+		return errorResponseFor(err)
+	}
+	// Ending the elevation removes the account from the group, so it mustn't
+	// start while the account is a member for some other reason.
+	if isMemberOf(entry, role.GroupDN) {
+		return codedErrorResponse(errCodeAlreadyMember, "%q is already a member of %q", role.ServiceAccountName, role.GroupDN), nil
+	}
+
+	checkOutID, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	checkOut := &CheckOut{
+		BorrowerEntityID:    req.EntityID,
+		BorrowerClientToken: req.ClientToken,
+		ID:                  checkOutID,
+	}
+	if err := b.checkOutHandler.CheckOut(ctx, req.Storage, role.ServiceAccountName, checkOut); err != nil {
+		if err == errCheckedOut {
+			return codedErrorResponse(errCodeAlreadyCheckedOut, "%q is already elevated", role.ServiceAccountName), nil
+		}
+		return nil, err
+	}
+	password, err := b.elevate(ctx, req.Storage, engineConf, groupClient, role)
+	if err != nil {
+		if releaseErr := b.releaseElevation(ctx, req.Storage, role.ServiceAccountName); releaseErr != nil {
+			b.Logger().Error("unable to release failed elevation", "service_account_name", role.ServiceAccountName, "error", releaseErr)
+		}
+		return errorResponseFor(err)
+	}
+	b.Logger().Info("elevated service account", "role", roleName, "service_account_name", role.ServiceAccountName, "group_dn", role.GroupDN)
+
+	resp := b.Backend.Secret(secretElevationType).Response(map[string]interface{}{
+		"service_account_name": role.ServiceAccountName,
+		"password":             password,
+		"group_dn":             role.GroupDN,
+	}, map[string]interface{}{
+		"role_name":            roleName,
+		"service_account_name": role.ServiceAccountName,
+		"group_dn":             role.GroupDN,
+		"checkout_id":          checkOutID,
+	})
+	resp.Secret.Renewable = true
+	resp.Secret.TTL, resp.Secret.MaxTTL = b.leaseTTLs(role.TTL, role.MaxTTL)
+	return resp, nil
+}
+
+// elevate adds the role's service account to its group and rotates its password,
+// so whoever knew its password before can't use the elevation. If rotation fails,
+// the account is removed from the group again.
+func (b *backend) elevate(ctx context.Context, storage logical.Storage, engineConf *configuration, groupClient GroupMembershipClient, role *elevationRole) (string, error) {
+	if err := groupClient.AddGroupMember(engineConf.ADConf, role.GroupDN, role.ServiceAccountName); err != nil {
+		return "", err
+	}
+	password, err := b.checkOutHandler.RotatePassword(ctx, storage, role.ServiceAccountName)
+	if err != nil {
+		if removeErr := groupClient.RemoveGroupMember(engineConf.ADConf, role.GroupDN, role.ServiceAccountName); removeErr != nil {
+			b.Logger().Error("unable to remove service account from group after failed elevation", "service_account_name", role.ServiceAccountName, "group_dn", role.GroupDN, "error", removeErr)
+		}
+		return "", err
+	}
+	return password, nil
+}
+
+// releaseElevation marks a service account as no longer elevated without
+// rotating its password, for when elevating it failed.
+func (b *backend) releaseElevation(ctx context.Context, storage logical.Storage, serviceAccountName string) error {
+	entry, err := logical.StorageEntryJSON(checkoutStoragePrefix+serviceAccountName, &CheckOut{IsAvailable: true})
+	if err != nil {
+		return err
+	}
+	return storage.Put(ctx, entry)
+}
+
+func (b *backend) renewElevation(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	roleName := req.Secret.InternalData["role_name"].(string)
+
+	lock := locksutil.LockForKey(b.checkOutLocks, elevationRolePrefix+roleName)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	role, err := readElevationRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return codedErrorResponse(errCodeInvalidRequest, "elevation role %q doesn't exist", roleName), nil
+	}
+	serviceAccountName := req.Secret.InternalData["service_account_name"].(string)
+	checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, req.Storage, serviceAccountName)
+	if err != nil && err != errNotFound {
+		return nil, err
+	}
+	if checkOut == nil || checkOut.IsAvailable || checkOut.ID != req.Secret.InternalData["checkout_id"] {
+		return codedErrorResponse(errCodeAlreadyCheckedIn, "%q is no longer elevated by this lease", serviceAccountName), nil
+	}
+	resp := &logical.Response{Secret: req.Secret}
+	resp.Secret.TTL, resp.Secret.MaxTTL = b.leaseTTLs(role.TTL, role.MaxTTL)
+	return resp, nil
+}
+
+func (b *backend) endElevation(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	if b.isReplicatedFollower() {
+		return nil, logical.ErrReadOnly
+	}
+
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if engineConf == nil {
+		return nil, errors.New("the config is currently unset")
+	}
+	groupClient, ok := b.client.(GroupMembershipClient)
+	if !ok {
+		return nil, errors.New("the secrets client doesn't support group membership")
+	}
+
+	roleName := req.Secret.InternalData["role_name"].(string)
+	lock := locksutil.LockForKey(b.checkOutLocks, elevationRolePrefix+roleName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	serviceAccountName := req.Secret.InternalData["service_account_name"].(string)
+	checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, req.Storage, serviceAccountName)
+	if err == errNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if checkOut.IsAvailable || checkOut.ID != req.Secret.InternalData["checkout_id"] {
+		return nil, nil
+	}
+
+	// If either step fails, Vault retries the revocation, and removing a
+	// membership that's already gone succeeds.
+	groupDN := req.Secret.InternalData["group_dn"].(string)
+	if err := groupClient.RemoveGroupMember(engineConf.ADConf, groupDN, serviceAccountName); err != nil {
+		return nil, err
+	}
+	if err := b.checkOutHandler.CheckIn(ctx, req.Storage, serviceAccountName); err != nil {
+		return nil, err
+	}
+	b.Logger().Info("ended service account elevation", "role", roleName, "service_account_name", serviceAccountName, "group_dn", groupDN)
+	return nil, nil
+}
+
+// elevationServiceAccounts returns the service accounts of every elevation role.
+func elevationServiceAccounts(ctx context.Context, storage logical.Storage) ([]string, error) {
+	roleNames, err := storage.List(ctx, elevationRolePrefix)
+	if err != nil {
+		return nil, err
+	}
+	var serviceAccountNames []string
+	for _, roleName := range roleNames {
+		if strings.HasSuffix(roleName, "/") {
+			continue
+		}
+		role, err := readElevationRole(ctx, storage, roleName)
+		if err != nil {
+			return nil, err
+		}
+		if role != nil {
+			serviceAccountNames = append(serviceAccountNames, role.ServiceAccountName)
+		}
+	}
+	return serviceAccountNames, nil
+}
+
+func readElevationRole(ctx context.Context, storage logical.Storage, roleName string) (*elevationRole, error) {
+	entry, err := storage.Get(ctx, elevationRolePrefix+roleName)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	role := &elevationRole{}
+	if err := entry.DecodeJSON(role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+const (
+	elevationHelpSynopsis = `
+Temporarily add a service account to an admin group.
+`
+	elevationHelpDescription = `
+An elevation role names a service account and an admin group. Reading
+"elevation-creds/<role>" adds the account to the group, rotates its password,
+and returns the new password with a lease. When the lease expires or is
+revoked, the account is removed from the group and its password is rotated
+again, so admin rights can only be used while the lease lasts.
+
+Only one lease may elevate an account at a time. The account can't be managed
+by a role or library set, and can't be privileged, or a member of the group,
+while it isn't elevated. Vault's bind account must be allowed to modify the
+group's members.
+`
+)
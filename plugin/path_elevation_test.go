@@ -0,0 +1,106 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestElevation(t *testing.T) {
+	directory := newMemoryDirectory()
+	b, storage := getBackend(t, directory, testConfig())
+	handle := requester(t, b, storage, "")
+	const groupDN = "CN=Server Admins,DC=example,DC=com"
+	isMember := func() bool {
+		t.Helper()
+		entry, err := directory.Get(nil, "ops@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return isMemberOf(entry, groupDN)
+	}
+	password := func() string {
+		t.Helper()
+		directory.mu.Lock()
+		defer directory.mu.Unlock()
+		return directory.account("ops@example.com").password
+	}
+
+	if resp := handle(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@example.com",
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to create role: %#v", resp)
+	}
+	resp := handle(logical.UpdateOperation, elevationRolePrefix+"ops", map[string]interface{}{
+		"service_account_name": "app@example.com",
+		"group_dn":             groupDN,
+	})
+	if responseErrorCode(resp) != string(errCodeAccountAlreadyManaged) {
+		t.Fatalf("expected an account managed by a role to be rejected but received %#v", resp)
+	}
+	resp = handle(logical.UpdateOperation, elevationRolePrefix+"ops", map[string]interface{}{
+		"service_account_name": "ops@example.com",
+		"group_dn":             groupDN,
+		"ttl":                  150,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("unable to create elevation role: %#v", resp)
+	}
+	restingPassword := password()
+	if restingPassword == "" {
+		t.Fatal("expected the account's password to be rotated when the role was created")
+	}
+
+	resp = handle(logical.ReadOperation, elevationCredsPrefix+"ops", nil)
+	if resp == nil || resp.IsError() || resp.Secret == nil {
+		t.Fatalf("unable to elevate: %#v", resp)
+	}
+	if resp.Data["password"] == restingPassword || resp.Data["password"] != password() {
+		t.Fatal("expected the account's password to be rotated when it was elevated")
+	}
+	if !isMember() {
+		t.Fatal("expected the account to be added to the group")
+	}
+	secret := resp.Secret
+
+	if resp := handle(logical.ReadOperation, elevationCredsPrefix+"ops", nil); responseErrorCode(resp) != string(errCodeAlreadyCheckedOut) {
+		t.Fatalf("expected a second elevation to be rejected but received %#v", resp)
+	}
+	if resp := handle(logical.DeleteOperation, elevationRolePrefix+"ops", nil); responseErrorCode(resp) != string(errCodeAlreadyCheckedOut) {
+		t.Fatalf("expected deleting the role while elevated to be rejected but received %#v", resp)
+	}
+	if resp := handle(logical.ReadOperation, elevationRolePrefix+"ops", nil); resp.Data["elevated"] != true {
+		t.Fatalf("expected the role to report the account as elevated but received %#v", resp.Data)
+	}
+
+	// Tidying mustn't mistake the account for one that was left behind by a set.
+	report, err := b.tidy(ctx, storage, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Passwords) != 0 || len(report.CheckOuts) != 0 {
+		t.Fatalf("expected nothing to tidy but received %#v", report)
+	}
+
+	elevatedPassword := password()
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   storage,
+		Secret:    secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("unable to revoke: %#v, %v", resp, err)
+	}
+	if isMember() {
+		t.Fatal("expected the account to be removed from the group")
+	}
+	if password() == elevatedPassword {
+		t.Fatal("expected the account's password to be rotated when the elevation ended")
+	}
+	if resp := handle(logical.DeleteOperation, elevationRolePrefix+"ops", nil); resp != nil && resp.IsError() {
+		t.Fatalf("unable to delete elevation role: %#v", resp)
+	}
+}
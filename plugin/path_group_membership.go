@@ -0,0 +1,486 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/util"
+)
+
+const (
+	groupMembershipRolePrefix = "group-membership-role/"
+	groupMembershipPrefix     = "group-membership/"
+
+	secretGroupMembershipType = "group_membership"
+)
+
+// groupMembershipRole lets callers add service accounts to an AD group for the
+// length of a lease.
+type groupMembershipRole struct {
+	GroupDN         string        `json:"group_dn"`
+	AllowedAccounts []string      `json:"allowed_accounts"`
+	TTL             time.Duration `json:"ttl"`
+	MaxTTL          time.Duration `json:"max_ttl"`
+}
+
+func (r *groupMembershipRole) Map() map[string]interface{} {
+	return map[string]interface{}{
+		"group_dn":         r.GroupDN,
+		"allowed_accounts": r.AllowedAccounts,
+		"ttl":              int64(r.TTL.Seconds()),
+		"max_ttl":          int64(r.MaxTTL.Seconds()),
+	}
+}
+
+func (b *backend) pathListGroupMembershipRoles() *framework.Path {
+	return &framework.Path{
+		Pattern: groupMembershipRolePrefix + "?$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationSuffix: "group-membership-roles",
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.operationGroupMembershipRoleList,
+				Summary:  "List the name of each group membership role.",
+			},
+		},
+		HelpSynopsis:    groupMembershipHelpSynopsis,
+		HelpDescription: groupMembershipHelpDescription,
+	}
+}
+
+func (b *backend) pathGroupMembershipRoles() *framework.Path {
+	return &framework.Path{
+		Pattern: groupMembershipRolePrefix + framework.GenericNameRegex("name"),
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationSuffix: "group-membership-role",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the role.",
+				Required:    true,
+			},
+			"group_dn": {
+				Type:        framework.TypeString,
+				Description: "The distinguished name of the group to add service accounts to.",
+			},
+			"allowed_accounts": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `The service accounts that may be added to the group. Entries may contain globs, ex. "*@example.com".`,
+			},
+			"ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "In seconds, the default length of time a service account is a member of the group.",
+			},
+			"max_ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "In seconds, the maximum length of time a service account may be a member of the group. 0 means the mount's max lease TTL.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.operationGroupMembershipRoleUpdate,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Create or update a group membership role.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
+			},
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.operationGroupMembershipRoleRead,
+				Summary:  "Read a group membership role.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"group_dn": {
+								Type:        framework.TypeString,
+								Description: "The distinguished name of the group to add service accounts to.",
+							},
+							"allowed_accounts": {
+								Type:        framework.TypeCommaStringSlice,
+								Description: "The service accounts that may be added to the group.",
+							},
+							"ttl": {
+								Type:        framework.TypeDurationSecond,
+								Description: "In seconds, the default length of time a service account is a member of the group.",
+							},
+							"max_ttl": {
+								Type:        framework.TypeDurationSecond,
+								Description: "In seconds, the maximum length of time a service account may be a member of the group.",
+							},
+							"effective_ttl": {
+								Type:        framework.TypeDurationSecond,
+								Description: "In seconds, the ttl leases are given once the mount's limits are applied.",
+							},
+							"effective_max_ttl": {
+								Type:        framework.TypeDurationSecond,
+								Description: "In seconds, the max_ttl leases are given once the mount's limits are applied.",
+							},
+						},
+					}},
+				},
+			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback:                    b.operationGroupMembershipRoleDelete,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Delete a group membership role.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    groupMembershipHelpSynopsis,
+		HelpDescription: groupMembershipHelpDescription,
+	}
+}
+
+func (b *backend) pathGroupMembership() *framework.Path {
+	return &framework.Path{
+		Pattern: groupMembershipPrefix + framework.GenericNameRegex("name") + "$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "grant",
+			OperationSuffix: "group-membership",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the group membership role.",
+				Required:    true,
+			},
+			"service_account_name": {
+				Type:        framework.TypeString,
+				Description: "The service account to add to the group.",
+				Required:    true,
+			},
+			"ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "In seconds, how long the service account should be a member of the group. Defaults to the role's ttl.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.operationGroupMembershipGrant,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Add a service account to the role's group until the lease expires or is revoked.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"service_account_name": {
+								Type:        framework.TypeString,
+								Description: "The service account that was added to the group.",
+							},
+							"group_dn": {
+								Type:        framework.TypeString,
+								Description: "The distinguished name of the group.",
+							},
+						},
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    groupMembershipHelpSynopsis,
+		HelpDescription: groupMembershipHelpDescription,
+	}
+}
+
+func (b *backend) secretGroupMembership() *framework.Secret {
+	return &framework.Secret{
+		Type: secretGroupMembershipType,
+		Fields: map[string]*framework.FieldSchema{
+			"service_account_name": {
+				Type:        framework.TypeString,
+				Description: "Service account name",
+			},
+			"group_dn": {
+				Type:        framework.TypeString,
+				Description: "Group DN",
+			},
+		},
+		Renew:  b.renewGroupMembership,
+		Revoke: b.revokeGroupMembership,
+	}
+}
+
+func (b *backend) operationGroupMembershipRoleList(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	keys, err := req.Storage.List(ctx, groupMembershipRolePrefix)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(keys), nil
+}
+
+func (b *backend) operationGroupMembershipRoleUpdate(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	roleName := fieldData.Get("name").(string)
+
+	role, err := readGroupMembershipRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		role = &groupMembershipRole{}
+	}
+	if groupDN, ok := fieldData.GetOk("group_dn"); ok {
+		role.GroupDN = groupDN.(string)
+	}
+	if allowedAccounts, ok := fieldData.GetOk("allowed_accounts"); ok {
+		role.AllowedAccounts = nil
+		for _, allowedAccount := range allowedAccounts.([]string) {
+			role.AllowedAccounts = append(role.AllowedAccounts, normalizeServiceAccountName(allowedAccount))
+		}
+	}
+	if ttl, ok := fieldData.GetOk("ttl"); ok {
+		role.TTL = time.Duration(ttl.(int)) * time.Second
+	}
+	if maxTTL, ok := fieldData.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(maxTTL.(int)) * time.Second
+	}
+
+	if role.GroupDN == "" {
+		return codedErrorResponse(errCodeInvalidRequest, `"group_dn" must be provided`), nil
+	}
+	if _, err := ldap.ParseDN(role.GroupDN); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "group_dn is invalid: %s", err), nil
+	}
+	if len(role.AllowedAccounts) == 0 {
+		return codedErrorResponse(errCodeInvalidRequest, `"allowed_accounts" must be provided`), nil
+	}
+	if err := b.validateLeaseTTLs(fieldData, role.TTL, role.MaxTTL); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(groupMembershipRolePrefix+roleName, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) operationGroupMembershipRoleRead(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	roleName := fieldData.Get("name").(string)
+
+	role, err := readGroupMembershipRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+	respData := role.Map()
+	b.addEffectiveTTLs(respData, role.TTL, role.MaxTTL)
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+func (b *backend) operationGroupMembershipRoleDelete(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	roleName := fieldData.Get("name").(string)
+	if err := req.Storage.Delete(ctx, groupMembershipRolePrefix+roleName); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) operationGroupMembershipGrant(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	roleName := fieldData.Get("name").(string)
+	serviceAccountName := fieldData.Get("service_account_name").(string)
+	if serviceAccountName == "" {
+		return codedErrorResponse(errCodeInvalidRequest, `"service_account_name" must be provided`), nil
+	}
+
+	role, err := readGroupMembershipRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return codedErrorResponse(errCodeInvalidRequest, `group membership role %q doesn't exist`, roleName), nil
+	}
+
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if engineConf == nil {
+		return nil, errors.New("the config is currently unset")
+	}
+	if serviceAccountName, err = canonicalServiceAccountName(engineConf, serviceAccountName); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+	}
+	// Roles written before names were normalized may have allowed accounts in any case.
+	allowedAccounts := make([]string, len(role.AllowedAccounts))
+	for i, allowedAccount := range role.AllowedAccounts {
+		allowedAccounts[i] = normalizeServiceAccountName(allowedAccount)
+	}
+	if !strutil.StrListContainsGlob(allowedAccounts, serviceAccountName) {
+		return codedErrorResponse(errCodeInvalidRequest, "%q isn't allowed to be added to the group by %q", serviceAccountName, roleName), nil
+	}
+	groupClient, ok := b.client.(GroupMembershipClient)
+	if !ok {
+		return nil, errors.New("the secrets client doesn't support group membership")
+	}
+
+	lock := locksutil.LockForKey(b.groupMembershipLocks, strings.ToLower(role.GroupDN))
+	lock.Lock()
+	defer lock.Unlock()
+
+	entry, err := b.client.Get(engineConf.ADConf, serviceAccountName)
+	if err != nil {
+		return errorResponseFor(err)
+	}
+	// Revoking the lease removes the account from the group, so it mustn't be
+	// granted a membership the account already has, whether another lease
+	// granted it or it was granted in AD.
+	if isMemberOf(entry, role.GroupDN) {
+		return codedErrorResponse(errCodeAlreadyMember, "%q is already a member of %q", serviceAccountName, role.GroupDN), nil
+	}
+	if err := groupClient.AddGroupMember(engineConf.ADConf, role.GroupDN, serviceAccountName); err != nil {
+		return nil, err
+	}
+	b.Logger().Info("added service account to group", "role", roleName, "service_account_name", serviceAccountName, "group_dn", role.GroupDN)
+
+	resp := b.Backend.Secret(secretGroupMembershipType).Response(map[string]interface{}{
+		"service_account_name": serviceAccountName,
+		"group_dn":             role.GroupDN,
+	}, map[string]interface{}{
+		"role_name":            roleName,
+		"service_account_name": serviceAccountName,
+		"group_dn":             role.GroupDN,
+	})
+	resp.Secret.Renewable = true
+	ttl := role.TTL
+	if ttlRaw, ok := fieldData.GetOk("ttl"); ok {
+		ttl = time.Duration(ttlRaw.(int)) * time.Second
+	}
+	resp.Secret.TTL, resp.Secret.MaxTTL = b.leaseTTLs(ttl, role.MaxTTL)
+	return resp, nil
+}
+
+func (b *backend) renewGroupMembership(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	roleName := req.Secret.InternalData["role_name"].(string)
+
+	role, err := readGroupMembershipRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return codedErrorResponse(errCodeInvalidRequest, `group membership role %q doesn't exist`, roleName), nil
+	}
+	groupDN := req.Secret.InternalData["group_dn"].(string)
+	if !strings.EqualFold(role.GroupDN, groupDN) {
+		return codedErrorResponse(errCodeInvalidRequest, "%q no longer grants membership of %q", roleName, groupDN), nil
+	}
+	resp := &logical.Response{Secret: req.Secret}
+	resp.Secret.TTL, resp.Secret.MaxTTL = b.leaseTTLs(role.TTL, role.MaxTTL)
+	return resp, nil
+}
+
+func (b *backend) revokeGroupMembership(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	if b.isReplicatedFollower() {
+		return nil, logical.ErrReadOnly
+	}
+
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if engineConf == nil {
+		return nil, errors.New("the config is currently unset")
+	}
+	groupClient, ok := b.client.(GroupMembershipClient)
+	if !ok {
+		return nil, errors.New("the secrets client doesn't support group membership")
+	}
+
+	serviceAccountName := req.Secret.InternalData["service_account_name"].(string)
+	groupDN := req.Secret.InternalData["group_dn"].(string)
+
+	lock := locksutil.LockForKey(b.groupMembershipLocks, strings.ToLower(groupDN))
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := groupClient.RemoveGroupMember(engineConf.ADConf, groupDN, serviceAccountName); err != nil {
+		var notFound *util.AccountNotFoundError
+		if errors.As(err, &notFound) {
+			// The account was deleted, which took its memberships with it.
+			return nil, nil
+		}
+		return nil, err
+	}
+	b.Logger().Info("removed service account from group", "service_account_name", serviceAccountName, "group_dn", groupDN)
+	return nil, nil
+}
+
+// isMemberOf reports whether the entry's memberOf includes the group.
+func isMemberOf(entry *client.Entry, groupDN string) bool {
+	group, err := ldap.ParseDN(groupDN)
+	if err != nil {
+		return false
+	}
+	memberOf, _ := entry.Get(client.FieldRegistry.MemberOf)
+	for _, rawDN := range memberOf {
+		dn, err := ldap.ParseDN(rawDN)
+		if err == nil && dn.EqualFold(group) {
+			return true
+		}
+	}
+	return false
+}
+
+func readGroupMembershipRole(ctx context.Context, storage logical.Storage, roleName string) (*groupMembershipRole, error) {
+	entry, err := storage.Get(ctx, groupMembershipRolePrefix+roleName)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	role := &groupMembershipRole{}
+	if err := entry.DecodeJSON(role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+const (
+	groupMembershipHelpSynopsis = `
+Add service accounts to an AD group for the length of a lease.
+`
+	groupMembershipHelpDescription = `
+A group membership role names an AD group and the service accounts that may be
+added to it. Writing a service account to "group-membership/<role>" adds it to
+the group and returns a lease. The account is removed from the group when the
+lease expires or is revoked.
+
+An account that's already a member of the group can't be granted membership,
+so revoking a lease never takes away membership that Vault didn't grant.
+Vault's bind account must be allowed to modify the group's members.
+`
+)
@@ -0,0 +1,91 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestGroupMembership(t *testing.T) {
+	directory := newMemoryDirectory()
+	b, storage := getBackend(t, directory, testConfig())
+	handle := requester(t, b, storage, "")
+	isMember := func(serviceAccountName string) bool {
+		t.Helper()
+		entry, err := directory.Get(nil, serviceAccountName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return isMemberOf(entry, "CN=Deployers,DC=example,DC=com")
+	}
+
+	resp := handle(logical.UpdateOperation, groupMembershipRolePrefix+"deploy", map[string]interface{}{
+		"group_dn": "CN=Deployers,DC=example,DC=com",
+	})
+	if responseErrorCode(resp) != string(errCodeInvalidRequest) {
+		t.Fatalf("expected a role without allowed_accounts to be rejected but received %#v", resp)
+	}
+	resp = handle(logical.UpdateOperation, groupMembershipRolePrefix+"deploy", map[string]interface{}{
+		"group_dn":         "CN=Deployers,DC=example,DC=com",
+		"allowed_accounts": "ci-*@example.com",
+		"ttl":              60,
+		"max_ttl":          150,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("unable to create role: %#v", resp)
+	}
+
+	resp = handle(logical.UpdateOperation, groupMembershipPrefix+"deploy", map[string]interface{}{
+		"service_account_name": "admin@example.com",
+	})
+	if responseErrorCode(resp) != string(errCodeInvalidRequest) {
+		t.Fatalf("expected an account that isn't allowed to be rejected but received %#v", resp)
+	}
+
+	resp = handle(logical.UpdateOperation, groupMembershipPrefix+"deploy", map[string]interface{}{
+		"service_account_name": "ci-1@example.com",
+	})
+	if resp == nil || resp.IsError() || resp.Secret == nil {
+		t.Fatalf("unable to grant membership: %#v", resp)
+	}
+	if resp.Secret.TTL != time.Minute || resp.Secret.MaxTTL != 150*time.Second {
+		t.Fatalf("expected the role's ttls but received %s and %s", resp.Secret.TTL, resp.Secret.MaxTTL)
+	}
+	if !isMember("ci-1@example.com") {
+		t.Fatal("expected the account to be added to the group")
+	}
+	secret := resp.Secret
+
+	// A membership can't be granted twice, or revoking either lease would end both.
+	resp = handle(logical.UpdateOperation, groupMembershipPrefix+"deploy", map[string]interface{}{
+		"service_account_name": "ci-1@example.com",
+	})
+	if responseErrorCode(resp) != string(errCodeAlreadyMember) {
+		t.Fatalf("expected an existing member to be rejected but received %#v", resp)
+	}
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   storage,
+		Secret:    secret,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("unable to renew: %#v, %v", resp, err)
+	}
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   storage,
+		Secret:    secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("unable to revoke: %#v, %v", resp, err)
+	}
+	if isMember("ci-1@example.com") {
+		t.Fatal("expected the account to be removed from the group")
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/version"
+)
+
+const infoPath = "info"
+
+// storageSchemaVersion is bumped whenever the layout of stored entries changes.
+// Version 2 began storing library passwords along with when they were rotated.
+// Version 3 began indexing the library set or elevation role managing each account.
+const storageSchemaVersion = 3
+
+// features lists the capabilities this build of the plugin supports.
+var features = []string{
+	"roles",
+	"library",
+	"tidy",
+	"library-group",
+	"rotation-pause",
+	"group-membership",
+	"elevation",
+	"usage",
+	"approvals",
+	"laps",
+	"password-age-report",
+	"multi-config",
+}
+
+func (b *backend) pathInfo() *framework.Path {
+	return &framework.Path{
+		Pattern: infoPath + "$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationSuffix: "plugin-info",
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.operationInfoRead,
+				Summary:  "Report the plugin's version and the features it supports.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"version": {
+								Type:        framework.TypeString,
+								Description: "The version of the plugin.",
+							},
+							"git_commit": {
+								Type:        framework.TypeString,
+								Description: "The commit the plugin was built from, if known.",
+							},
+							"features": {
+								Type:        framework.TypeStringSlice,
+								Description: "The features the plugin supports.",
+							},
+							"storage_version": {
+								Type:        framework.TypeInt,
+								Description: "The version of the layout the plugin stores entries in.",
+							},
+						},
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    infoHelpSynopsis,
+		HelpDescription: infoHelpDescription,
+	}
+}
+
+func (b *backend) operationInfoRead(_ context.Context, _ *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"version":         version.Version,
+			"git_commit":      version.GitCommit,
+			"features":        features,
+			"storage_version": storageSchemaVersion,
+		},
+	}, nil
+}
+
+const (
+	infoHelpSynopsis = `
+Report the plugin's version and the features it supports.
+`
+	infoHelpDescription = `
+This endpoint returns the plugin's version, the commit it was built from, the
+features it supports, and the version of its storage layout, so tooling can
+check for a capability rather than probing for endpoints.
+`
+)
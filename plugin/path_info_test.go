@@ -0,0 +1,37 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/version"
+)
+
+func TestInfo(t *testing.T) {
+	req := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      infoPath,
+		Storage:   &logical.InmemStorage{},
+	}
+	resp, err := testBackend.HandleRequest(ctx, req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatal(err)
+	}
+	if resp.Data["version"] != version.Version {
+		t.Fatalf("expected version %q but received %q", version.Version, resp.Data["version"])
+	}
+	if resp.Data["storage_version"] != storageSchemaVersion {
+		t.Fatalf("expected storage version %d but received %v", storageSchemaVersion, resp.Data["storage_version"])
+	}
+	features := resp.Data["features"].([]string)
+	for _, feature := range []string{"library", "multi-config", "approvals", "laps", "password-age-report"} {
+		if !strutil.StrListContains(features, feature) {
+			t.Fatalf("expected %q to be listed in %v", feature, features)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+const (
+	lapsPrefix = "laps/"
+
+	// lapsSourceLegacy is the original Microsoft LAPS, which keeps the password
+	// in ms-Mcs-AdmPwd. lapsSourceWindows is Windows LAPS, which keeps it in
+	// msLAPS-Password along with the local account's name.
+	lapsSourceLegacy  = "legacy"
+	lapsSourceWindows = "windows"
+)
+
+// lapsPassword is a computer's local administrator password managed by LAPS.
+type lapsPassword struct {
+	Source      string
+	Username    string
+	Password    string
+	UpdatedTime time.Time
+	Expiration  time.Time
+
+	// expirationField is where the expiration is kept, so it can be reset.
+	expirationField *client.Field
+}
+
+func (p *lapsPassword) Map() map[string]interface{} {
+	m := map[string]interface{}{
+		"source":   p.Source,
+		"password": p.Password,
+	}
+	if p.Username != "" {
+		m["username"] = p.Username
+	}
+	if !p.UpdatedTime.IsZero() {
+		m["password_last_set"] = p.UpdatedTime
+	}
+	if !p.Expiration.IsZero() {
+		m["expiration_time"] = p.Expiration
+	}
+	return m
+}
+
+// windowsLAPSPassword is the JSON Windows LAPS keeps in msLAPS-Password.
+type windowsLAPSPassword struct {
+	AccountName string `json:"n"`
+	UpdatedTime string `json:"t"`
+	Password    string `json:"p"`
+}
+
+func (b *backend) pathLAPS() *framework.Path {
+	return &framework.Path{
+		Pattern: lapsPrefix + `(?P<name>\w(([\w-.]+)?\w)?\$?)$`,
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationSuffix: "laps-password",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "The computer's name, with or without the trailing $ of its sAMAccountName.",
+				Required:    true,
+			},
+			"reset_expiration": {
+				Type:        framework.TypeBool,
+				Description: "Expire the password now, so the computer replaces it the next time LAPS runs on it.",
+				Default:     false,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.operationLAPSRead,
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationVerb: "read",
+				},
+				Summary: "Read a computer's LAPS password and when it expires.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields:      lapsResponseFields(),
+					}},
+				},
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.operationLAPSRead,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationVerb:   "read",
+					OperationSuffix: "laps-password-and-reset-expiration",
+				},
+				Summary: "Read a computer's LAPS password, optionally expiring it so the computer replaces it.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields:      lapsResponseFields(),
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    lapsHelpSynopsis,
+		HelpDescription: lapsHelpDescription,
+	}
+}
+
+func lapsResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"source": {
+			Type:        framework.TypeString,
+			Description: `Where the password was read from: "windows" for Windows LAPS, or "legacy" for Microsoft LAPS.`,
+		},
+		"username": {
+			Type:        framework.TypeString,
+			Description: "The local account the password is for, if Windows LAPS reports it.",
+		},
+		"password": {
+			Type:        framework.TypeString,
+			Description: "The computer's local administrator password.",
+		},
+		"password_last_set": {
+			Type:        framework.TypeTime,
+			Description: "When the computer last set the password, if Windows LAPS reports it.",
+		},
+		"expiration_time": {
+			Type:        framework.TypeTime,
+			Description: "When the computer will replace the password.",
+		},
+	}
+}
+
+func (b *backend) operationLAPSRead(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	computerName := lapsComputerName(fieldData.Get("name").(string))
+	resetExpiration := req.Operation == logical.UpdateOperation && fieldData.Get("reset_expiration").(bool)
+
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if engineConf == nil {
+		return nil, errors.New("the config is currently unset")
+	}
+	if resp := responseWrappingRequired(engineConf, req); resp != nil {
+		return resp, nil
+	}
+	var updater EntryUpdater
+	if resetExpiration {
+		var ok bool
+		if updater, ok = b.client.(EntryUpdater); !ok {
+			return nil, errors.New("the secrets client doesn't support resetting LAPS password expirations")
+		}
+	}
+
+	entry, err := b.client.Get(engineConf.ADConf, computerName)
+	if err != nil {
+		return errorResponseFor(err)
+	}
+	password, err := parseLAPSPassword(entry)
+	if err != nil {
+		return codedErrorResponse(errCodeLAPSPasswordNotFound, "unable to read the LAPS password of %q: %s", computerName, err), nil
+	}
+	b.Logger().Info("LAPS password read", "computer", computerName, "source", password.Source, "reset_expiration", resetExpiration)
+
+	if resetExpiration {
+		now := b.now()
+		if err := updater.UpdateEntry(engineConf.ADConf, computerName, map[*client.Field][]string{
+			password.expirationField: {strconv.FormatInt(client.TimeToTicks(now), 10)},
+		}); err != nil {
+			return nil, fmt.Errorf("unable to reset the LAPS password expiration of %q: %w", computerName, err)
+		}
+		password.Expiration = now
+	}
+	return &logical.Response{
+		Data: password.Map(),
+	}, nil
+}
+
+// lapsComputerName returns the sAMAccountName of the computer with the given
+// name, which has a trailing $ whether or not the name does.
+func lapsComputerName(name string) string {
+	name = normalizeServiceAccountName(name)
+	if !strings.HasSuffix(name, "$") {
+		name += "$"
+	}
+	return name
+}
+
+// parseLAPSPassword returns the LAPS password in a computer's entry. Windows LAPS
+// is preferred if the computer has a password from both, because it's what a
+// computer migrated from Microsoft LAPS uses once the migration is done.
+func parseLAPSPassword(entry *client.Entry) (*lapsPassword, error) {
+	if raw, ok := entry.GetJoined(client.FieldRegistry.MSLAPSPassword); ok && raw != "" {
+		parsed := &windowsLAPSPassword{}
+		if err := json.Unmarshal([]byte(raw), parsed); err != nil {
+			return nil, fmt.Errorf("msLAPS-Password isn't valid: %w", err)
+		}
+		password := &lapsPassword{
+			Source:          lapsSourceWindows,
+			Username:        parsed.AccountName,
+			Password:        parsed.Password,
+			expirationField: client.FieldRegistry.MSLAPSPasswordExpiration,
+		}
+		if parsed.UpdatedTime != "" {
+			ticks, err := strconv.ParseInt(parsed.UpdatedTime, 16, 64)
+			if err != nil {
+				return nil, fmt.Errorf("msLAPS-Password has an invalid update time %q: %w", parsed.UpdatedTime, err)
+			}
+			password.UpdatedTime = client.TicksToTime(ticks)
+		}
+		var err error
+		if password.Expiration, err = lapsExpiration(entry, client.FieldRegistry.MSLAPSPasswordExpiration); err != nil {
+			return nil, err
+		}
+		return password, nil
+	}
+	if raw, ok := entry.GetJoined(client.FieldRegistry.AdmPwd); ok && raw != "" {
+		password := &lapsPassword{
+			Source:          lapsSourceLegacy,
+			Password:        raw,
+			expirationField: client.FieldRegistry.AdmPwdExpirationTime,
+		}
+		var err error
+		if password.Expiration, err = lapsExpiration(entry, client.FieldRegistry.AdmPwdExpirationTime); err != nil {
+			return nil, err
+		}
+		return password, nil
+	}
+	if _, ok := entry.Get(client.FieldRegistry.MSLAPSEncryptedPassword); ok {
+		return nil, errors.New("its password is encrypted by Windows LAPS, which Vault can't decrypt")
+	}
+	return nil, errors.New("it has no LAPS password, or the bind account isn't allowed to read it")
+}
+
+// lapsExpiration returns the expiration kept in the field, or the zero time if
+// there's none.
+func lapsExpiration(entry *client.Entry, field *client.Field) (time.Time, error) {
+	ticks, ok := entry.GetJoined(field)
+	if !ok || ticks == "" || ticks == "0" {
+		return time.Time{}, nil
+	}
+	expiration, err := client.ParseTicks(ticks)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s has an invalid value %q: %w", field, ticks, err)
+	}
+	return expiration, nil
+}
+
+const (
+	lapsHelpSynopsis = `
+Read a computer's LAPS password.
+`
+	lapsHelpDescription = `
+Reads the local administrator password LAPS keeps on a computer's entry in
+Active Directory, so retrieving it is authorized and audited by Vault rather
+than granted to people in AD. Both Windows LAPS (msLAPS-Password) and Microsoft
+LAPS (ms-Mcs-AdmPwd) are supported. Passwords encrypted by Windows LAPS can't
+be read. The bind account must be allowed to read the attributes.
+
+Writing with reset_expiration set also expires the password, so the computer
+replaces it the next time LAPS runs on it. Do this once the password has been
+used, so it isn't valid for long after it was shared.
+`
+)
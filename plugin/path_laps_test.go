@@ -0,0 +1,101 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+// lapsFake keeps the attributes of computer entries, and records changes to them.
+type lapsFake struct {
+	fakeSecretsClient
+	computers map[string]map[*client.Field]string
+}
+
+func (f *lapsFake) Get(conf *client.ADConf, serviceAccountName string) (*client.Entry, error) {
+	ldapEntry := &ldap.Entry{}
+	for field, value := range f.computers[serviceAccountName] {
+		ldapEntry.Attributes = append(ldapEntry.Attributes, &ldap.EntryAttribute{
+			Name:   field.String(),
+			Values: []string{value},
+		})
+	}
+	return client.NewEntry(ldapEntry), nil
+}
+
+func (f *lapsFake) UpdateEntry(conf *client.ADConf, serviceAccountName string, newValues map[*client.Field][]string) error {
+	for field, values := range newValues {
+		f.computers[serviceAccountName][field] = values[0]
+	}
+	return nil
+}
+
+func TestLAPS(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	expiration := now.Add(30 * 24 * time.Hour)
+	updated := now.Add(-24 * time.Hour)
+	fake := &lapsFake{
+		computers: map[string]map[*client.Field]string{
+			"legacy01$": {
+				client.FieldRegistry.AdmPwd:               "legacy-password",
+				client.FieldRegistry.AdmPwdExpirationTime: strconv.FormatInt(client.TimeToTicks(expiration), 10),
+			},
+			"web01$": {
+				client.FieldRegistry.MSLAPSPassword:           `{"n":"Administrator","t":"` + strconv.FormatInt(client.TimeToTicks(updated), 16) + `","p":"windows-password"}`,
+				client.FieldRegistry.MSLAPSPasswordExpiration: strconv.FormatInt(client.TimeToTicks(expiration), 10),
+			},
+			"encrypted01$": {
+				client.FieldRegistry.MSLAPSEncryptedPassword: "AAAA",
+			},
+			"none01$": {},
+		},
+	}
+	b, storage := getBackend(t, fake, testConfig())
+	b.now = func() time.Time { return now }
+	handle := requester(t, b, storage, "")
+
+	resp := handle(logical.ReadOperation, lapsPrefix+"WEB01", nil)
+	if resp == nil || resp.IsError() {
+		t.Fatalf("unable to read the LAPS password: %#v", resp)
+	}
+	if resp.Data["source"] != lapsSourceWindows || resp.Data["username"] != "Administrator" || resp.Data["password"] != "windows-password" {
+		t.Fatalf("expected the Windows LAPS password but received %#v", resp.Data)
+	}
+	if !resp.Data["password_last_set"].(time.Time).Equal(updated) || !resp.Data["expiration_time"].(time.Time).Equal(expiration) {
+		t.Fatalf("expected the password's update and expiration times but received %#v", resp.Data)
+	}
+
+	resp = handle(logical.ReadOperation, lapsPrefix+"legacy01$", nil)
+	if resp == nil || resp.IsError() || resp.Data["source"] != lapsSourceLegacy || resp.Data["password"] != "legacy-password" {
+		t.Fatalf("expected the Microsoft LAPS password but received %#v", resp)
+	}
+
+	for _, computer := range []string{"encrypted01", "none01"} {
+		if resp := handle(logical.ReadOperation, lapsPrefix+computer, nil); responseErrorCode(resp) != string(errCodeLAPSPasswordNotFound) {
+			t.Fatalf("expected %s to have no readable password but received %#v", computer, resp)
+		}
+	}
+
+	// Reading without resetting the expiration leaves it alone.
+	handle(logical.UpdateOperation, lapsPrefix+"web01", nil)
+	if fake.computers["web01$"][client.FieldRegistry.MSLAPSPasswordExpiration] != strconv.FormatInt(client.TimeToTicks(expiration), 10) {
+		t.Fatal("expected the expiration to be unchanged")
+	}
+	resp = handle(logical.UpdateOperation, lapsPrefix+"web01", map[string]interface{}{
+		"reset_expiration": true,
+	})
+	if resp == nil || resp.IsError() || resp.Data["password"] != "windows-password" || !resp.Data["expiration_time"].(time.Time).Equal(now) {
+		t.Fatalf("expected the password to expire now but received %#v", resp)
+	}
+	if fake.computers["web01$"][client.FieldRegistry.MSLAPSPasswordExpiration] != strconv.FormatInt(client.TimeToTicks(now), 10) {
+		t.Fatal("expected the expiration to be reset in AD")
+	}
+}
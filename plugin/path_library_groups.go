@@ -0,0 +1,320 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const libraryGroupPrefix = "library-group/"
+
+// libraryGroup is an ordered list of library sets to check service accounts out from.
+type libraryGroup struct {
+	SetNames []string `json:"set_names"`
+}
+
+func (b *backend) pathListLibraryGroups() *framework.Path {
+	return &framework.Path{
+		Pattern: libraryGroupPrefix + "?$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationSuffix: "library-groups",
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.operationLibraryGroupList,
+				Summary:  "List the name of each library group.",
+			},
+		},
+		HelpSynopsis:    libraryGroupHelpSynopsis,
+		HelpDescription: libraryGroupHelpDescription,
+	}
+}
+
+func (b *backend) pathLibraryGroups() *framework.Path {
+	return &framework.Path{
+		Pattern: libraryGroupPrefix + framework.GenericNameRegex("name"),
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationSuffix: "library-group",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the group.",
+				Required:    true,
+			},
+			"set_names": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "The library sets to check service accounts out from, in order of preference.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.operationLibraryGroupUpdate,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Create or update a library group.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
+			},
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.operationLibraryGroupRead,
+				Summary:  "Read a library group.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"set_names": {
+								Type:        framework.TypeCommaStringSlice,
+								Description: "The library sets to check service accounts out from, in order of preference.",
+							},
+						},
+					}},
+				},
+			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback:                    b.operationLibraryGroupDelete,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Delete a library group.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    libraryGroupHelpSynopsis,
+		HelpDescription: libraryGroupHelpDescription,
+	}
+}
+
+func (b *backend) pathLibraryGroupCheckOut() *framework.Path {
+	return &framework.Path{
+		Pattern: libraryGroupPrefix + framework.GenericNameRegex("name") + "/check-out$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "check-out",
+			OperationSuffix: "library-group-account",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the group.",
+				Required:    true,
+			},
+			"ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "The length of time before the check-out will expire, in seconds.",
+			},
+			"reason": {
+				Type:        framework.TypeString,
+				Description: "Why the service account is needed. It's kept with the check-out and its lease, so it shows in the set's status and in lease lookups.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.operationLibraryGroupCheckOut,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Check a service account out from the first library set in the group that has one available.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"service_account_name": {
+								Type:        framework.TypeString,
+								Description: "The service account that was checked out.",
+							},
+							"password": {
+								Type:        framework.TypeString,
+								Description: "The service account's current password.",
+							},
+							"set_name": {
+								Type:        framework.TypeString,
+								Description: "The library set the service account was checked out from.",
+							},
+							"checkout_id": {
+								Type:        framework.TypeString,
+								Description: "The ID of the check-out, which may be used to check the service account in.",
+							},
+							"due_at": {
+								Type:        framework.TypeTime,
+								Description: "When the check-out's lease expires unless it's renewed.",
+							},
+							"reason": {
+								Type:        framework.TypeString,
+								Description: "Why the service account was checked out, if a reason was given.",
+							},
+						},
+					}},
+				},
+			},
+		},
+		HelpSynopsis: `Check a service account out from a library group.`,
+	}
+}
+
+func (b *backend) operationLibraryGroupList(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	keys, err := req.Storage.List(ctx, libraryGroupPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(keys), nil
+}
+
+func (b *backend) operationLibraryGroupUpdate(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	groupName := fieldData.Get("name").(string)
+	setNames := fieldData.Get("set_names").([]string)
+	if len(setNames) == 0 {
+		return codedErrorResponse(errCodeInvalidRequest, `"set_names" must be provided`), nil
+	}
+	seen := make(map[string]bool, len(setNames))
+	for _, setName := range setNames {
+		if seen[setName] {
+			return codedErrorResponse(errCodeInvalidRequest, "%q is listed more than once", setName), nil
+		}
+		seen[setName] = true
+
+		set, err := readSet(ctx, req.Storage, setName)
+		if err != nil {
+			return nil, err
+		}
+		if set == nil {
+			return codedErrorResponse(errCodeSetNotFound, `%q doesn't exist`, setName), nil
+		}
+		if set.RequireApproval {
+			return codedErrorResponse(errCodeInvalidRequest, "%q requires approval, so its accounts must be checked out from the set", setName), nil
+		}
+	}
+	if err := storeLibraryGroup(ctx, req.Storage, groupName, &libraryGroup{SetNames: setNames}); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) operationLibraryGroupRead(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	groupName := fieldData.Get("name").(string)
+
+	group, err := readLibraryGroup(ctx, req.Storage, groupName)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return nil, nil
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"set_names": group.SetNames,
+		},
+	}, nil
+}
+
+func (b *backend) operationLibraryGroupDelete(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	groupName := fieldData.Get("name").(string)
+	if err := req.Storage.Delete(ctx, libraryGroupPrefix+groupName); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) operationLibraryGroupCheckOut(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	groupName := fieldData.Get("name").(string)
+
+	group, err := readLibraryGroup(ctx, req.Storage, groupName)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return codedErrorResponse(errCodeGroupNotFound, `%q doesn't exist`, groupName), nil
+	}
+
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if engineConf == nil {
+		return nil, errors.New("the config is currently unset")
+	}
+
+	for _, setName := range group.SetNames {
+		resp, err := b.checkOutFromGroupSet(ctx, req, engineConf, setName, fieldData)
+		if resp != nil || err != nil {
+			return resp, err
+		}
+	}
+
+	b.Logger().Debug(fmt.Sprintf(`%q had no check-outs available`, groupName))
+	metrics.IncrCounter([]string{"active directory", "check-out", "unavailable", "group", groupName}, 1)
+	b.usage.checkOutUnavailable(ctx, req.Storage, b.now(), groupName)
+	return codedErrorResponse(errCodeNoAccountsAvailable, "No service accounts available for check-out."), nil
+}
+
+// checkOutFromGroupSet checks out a service account from one of a group's sets. It
+// returns a nil response if the set no longer exists, now requires approval, or has
+// no service accounts available.
+func (b *backend) checkOutFromGroupSet(ctx context.Context, req *logical.Request, engineConf *configuration, setName string, fieldData *framework.FieldData) (*logical.Response, error) {
+	lock := locksutil.LockForKey(b.checkOutLocks, setName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	set, err := readSet(ctx, req.Storage, setName)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil || set.RequireApproval {
+		return nil, nil
+	}
+	return b.checkOutFromSet(ctx, req, engineConf, setName, set, checkOutTTL(set, fieldData), "", "", fieldData.Get("reason").(string))
+}
+
+func readLibraryGroup(ctx context.Context, storage logical.Storage, groupName string) (*libraryGroup, error) {
+	entry, err := storage.Get(ctx, libraryGroupPrefix+groupName)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	group := &libraryGroup{}
+	if err := entry.DecodeJSON(group); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+func storeLibraryGroup(ctx context.Context, storage logical.Storage, groupName string, group *libraryGroup) error {
+	entry, err := logical.StorageEntryJSON(libraryGroupPrefix+groupName, group)
+	if err != nil {
+		return err
+	}
+	return storage.Put(ctx, entry)
+}
+
+const (
+	libraryGroupHelpSynopsis = `
+Check service accounts out from several library sets in order of preference.
+`
+	libraryGroupHelpDescription = `
+A library group lists library sets in order of preference. Checking out from a
+group checks out from the first set that has a service account available, so
+pools can be tiered without any logic on the client. Check-ins, renewals, and
+revocations are handled by the set the service account was checked out from.
+
+Sets that require approval can't be added to a group, and are skipped if they
+start requiring approval after they've been added.
+`
+)
@@ -0,0 +1,60 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestLibraryGroupCheckOut(t *testing.T) {
+	b, storage := getBackend(t, &fakeSecretsClient{}, testConfig())
+	handle := requester(t, b, storage, "borrower")
+	for setName, serviceAccountName := range map[string]string{
+		"non-prod": "tester1@example.com",
+		"prod":     "tester2@example.com",
+	} {
+		resp := handle(logical.CreateOperation, libraryPrefix+setName, map[string]interface{}{
+			"service_account_names": []string{serviceAccountName},
+		})
+		if resp != nil && resp.IsError() {
+			t.Fatalf("bad: %#v", resp)
+		}
+	}
+
+	resp := handle(logical.UpdateOperation, libraryGroupPrefix+"tiered", map[string]interface{}{
+		"set_names": "non-prod,missing",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected a group with a missing set to be rejected")
+	}
+	resp = handle(logical.UpdateOperation, libraryGroupPrefix+"tiered", map[string]interface{}{
+		"set_names": "non-prod,prod",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Check-outs spill over to the next set once the preferred one is exhausted.
+	for _, expected := range []string{"non-prod", "prod"} {
+		resp = handle(logical.UpdateOperation, libraryGroupPrefix+"tiered/check-out", nil)
+		if resp == nil || resp.IsError() {
+			t.Fatalf("bad: %#v", resp)
+		}
+		if resp.Data["set_name"] != expected {
+			t.Fatalf("expected a check-out from %q but received one from %q", expected, resp.Data["set_name"])
+		}
+		if resp.Secret.InternalData["set_name"] != expected {
+			t.Fatalf("expected the lease to belong to %q but it belongs to %q", expected, resp.Secret.InternalData["set_name"])
+		}
+	}
+	resp = handle(logical.UpdateOperation, libraryGroupPrefix+"tiered/check-out", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected no service accounts to be available")
+	}
+	if resp.Data["data"].(map[string]interface{})["error_code"] != string(errCodeNoAccountsAvailable) {
+		t.Fatalf("unexpected error response %#v", resp)
+	}
+}
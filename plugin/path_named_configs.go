@@ -0,0 +1,372 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+// namedConfigStoragePrefix is where the connections to other AD domains are
+// stored, each by its name.
+const namedConfigStoragePrefix = configStorageKey + "/"
+
+// readNamedConfig returns the named connection to AD, or nil if there's none.
+func readNamedConfig(ctx context.Context, storage logical.Storage, name string) (*client.ADConf, error) {
+	entry, err := storage.Get(ctx, namedConfigStoragePrefix+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	adConf := &client.ADConf{}
+	if err := entry.DecodeJSON(adConf); err != nil {
+		return nil, err
+	}
+	return adConf, nil
+}
+
+// cleartextNamedConfig returns the name and URL of the first named config that
+// connects to AD without TLS, or "" if there's none.
+func cleartextNamedConfig(ctx context.Context, storage logical.Storage) (string, string, error) {
+	names, err := storage.List(ctx, namedConfigStoragePrefix)
+	if err != nil {
+		return "", "", err
+	}
+	for _, name := range names {
+		adConf, err := readNamedConfig(ctx, storage, name)
+		if err != nil {
+			return "", "", err
+		}
+		if adConf == nil || adConf.ConfigEntry == nil {
+			continue
+		}
+		if rawURL := unencryptedURL(adConf); rawURL != "" {
+			return name, rawURL, nil
+		}
+	}
+	return "", "", nil
+}
+
+// configFor returns the config to manage the accounts of a role or library set
+// with. If it names a config, it's a copy that connects to that config's domain
+// instead, otherwise it's the config itself. Everything but the connection, like
+// password generation, still comes from the config.
+func configFor(ctx context.Context, storage logical.Storage, engineConf *configuration, name string) (*configuration, error) {
+	if engineConf == nil || name == "" {
+		return engineConf, nil
+	}
+	named, err := readNamedConfig(ctx, storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if named == nil {
+		return nil, fmt.Errorf("config %q doesn't exist", name)
+	}
+	if engineConf.ADConf != nil {
+		named.DevMode = engineConf.ADConf.DevMode
+		// Its connections are pooled like the config's.
+		named.MaxOpenConnections = engineConf.ADConf.MaxOpenConnections
+		named.MaxIdleConnections = engineConf.ADConf.MaxIdleConnections
+		named.ConnectionMaxLifetime = engineConf.ADConf.ConnectionMaxLifetime
+		// CRLs only apply to the certificates their CAs issued, so the config's
+		// can be checked against the named domain's too.
+		named.CRL = engineConf.ADConf.CRL
+		named.CheckOCSP = engineConf.ADConf.CheckOCSP
+		// Connections to the named domain are held to the config's TLS requirements.
+		named.RequireStartTLS = engineConf.ADConf.RequireStartTLS
+		named.EnforceSecureConnection = engineConf.ADConf.EnforceSecureConnection
+	}
+	resolved := *engineConf
+	resolved.ADConf = named
+	// The config's Kerberos settings are for its own domain, so the named
+	// domain's are discovered instead.
+	resolved.KerberosRealm, resolved.NetBIOSDomain, resolved.KDCs = "", "", nil
+	return &resolved, nil
+}
+
+func (b *backend) pathNamedConfigs() *framework.Path {
+	fields := ldaputil.ConfigFields()
+	fields["name"] = &framework.FieldSchema{
+		Type:        framework.TypeLowerCaseString,
+		Description: "Name of the config.",
+		Required:    true,
+	}
+	fields["computerdn"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The base DN to search for computer accounts. Defaults to userdn.",
+	}
+	fields["bind_mode"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "How Vault binds to the domain with bindpass: \"dn\" binds with binddn, and \"upn\" binds as upn_username@upndomain.",
+	}
+	fields["upn_username"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The username Vault binds as when bind_mode is upn, without the @upndomain.",
+	}
+	return &framework.Path{
+		Pattern: configPath + "/" + framework.GenericNameRegex("name") + "$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+		},
+		Fields: fields,
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.operationNamedConfigUpdate,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Configure the connection to another AD domain.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationVerb:   "configure",
+					OperationSuffix: "named-configuration",
+				},
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
+			},
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.operationNamedConfigRead,
+				Summary:  "Read the connection to another AD domain.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationSuffix: "named-configuration",
+				},
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"url":                {Type: framework.TypeString, Description: "The domain controllers to connect to."},
+							"starttls":           {Type: framework.TypeBool, Description: "Whether ldap:// connections are upgraded with StartTLS."},
+							"insecure_tls":       {Type: framework.TypeBool, Description: "Whether TLS certificates aren't verified."},
+							"certificate":        {Type: framework.TypeString, Description: "The CA certificate to verify the domain controllers with."},
+							"client_tls_cert":    {Type: framework.TypeString, Description: "The client certificate presented to AD, which is bound as when there's no bindpass."},
+							"binddn":             {Type: framework.TypeString, Description: "The account to bind with."},
+							"userdn":             {Type: framework.TypeString, Description: "The base DN to search for service accounts."},
+							"upndomain":          {Type: framework.TypeString, Description: "The userPrincipalName suffix of the bind account."},
+							"bind_mode":          {Type: framework.TypeString, Description: "Whether Vault binds with binddn (dn) or as upn_username@upndomain (upn)."},
+							"upn_username":       {Type: framework.TypeString, Description: "The username Vault binds as when bind_mode is upn."},
+							"tls_min_version":    {Type: framework.TypeString, Description: "The minimum TLS version."},
+							"tls_max_version":    {Type: framework.TypeString, Description: "The maximum TLS version."},
+							"computerdn":         {Type: framework.TypeString, Description: "The base DN to search for computer accounts."},
+							"connection_timeout": {Type: framework.TypeDurationSecond, Description: "In seconds, how long connecting to a domain controller may take."},
+							"request_timeout":    {Type: framework.TypeDurationSecond, Description: "In seconds, how long AD may take to answer a request."},
+						},
+					}},
+				},
+			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback:                    b.operationNamedConfigDelete,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Delete the connection to another AD domain.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationSuffix: "named-configuration",
+				},
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    namedConfigHelpSynopsis,
+		HelpDescription: namedConfigHelpDescription,
+	}
+}
+
+func (b *backend) pathListNamedConfigs() *framework.Path {
+	return &framework.Path{
+		Pattern: configPath + "/$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationSuffix: "named-configurations",
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.operationNamedConfigList,
+				Summary:  "List the connections to other AD domains.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"keys": {
+								Type:        framework.TypeStringSlice,
+								Description: "The names of the configs.",
+							},
+						},
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    namedConfigHelpSynopsis,
+		HelpDescription: namedConfigHelpDescription,
+	}
+}
+
+func (b *backend) operationNamedConfigUpdate(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	name := fieldData.Get("name").(string)
+	adConf, err := readNamedConfig(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if adConf == nil {
+		adConf = &client.ADConf{}
+	}
+	adConf.ConfigEntry, err = ldaputil.NewConfigEntry(adConf.ConfigEntry, fieldData)
+	if err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+	}
+	if err := adConf.ConfigEntry.Validate(); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+	}
+	if adConf.Certificate != "" {
+		if err := client.ValidateCABundle(adConf.Certificate); err != nil {
+			return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+		}
+	}
+	if computerDNRaw, ok := fieldData.GetOk("computerdn"); ok {
+		adConf.ComputerDN = computerDNRaw.(string)
+	}
+	if bindModeRaw, ok := fieldData.GetOk("bind_mode"); ok {
+		adConf.BindMode = strings.ToLower(bindModeRaw.(string))
+	}
+	if upnUsernameRaw, ok := fieldData.GetOk("upn_username"); ok {
+		adConf.UPNUsername = upnUsernameRaw.(string)
+	}
+	if err := adConf.ValidateBindMode(); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+	}
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if engineConf != nil && engineConf.ADConf != nil && engineConf.ADConf.EnforceSecureConnection {
+		if rawURL := unencryptedURL(adConf); rawURL != "" {
+			return codedErrorResponse(errCodeInvalidRequest, "the config sets enforce_secure_connection, so %q must use ldaps:// or starttls must be set", rawURL), nil
+		}
+	}
+	entry, err := logical.StorageEntryJSON(namedConfigStoragePrefix+name, adConf)
+	if err != nil {
+		return nil, err
+	}
+	return nil, req.Storage.Put(ctx, entry)
+}
+
+func (b *backend) operationNamedConfigRead(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	adConf, err := readNamedConfig(ctx, req.Storage, fieldData.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if adConf == nil {
+		return nil, nil
+	}
+	// Like the config's, the bind password isn't returned.
+	respData := map[string]interface{}{
+		"url":             adConf.Url,
+		"starttls":        adConf.StartTLS,
+		"insecure_tls":    adConf.InsecureTLS,
+		"certificate":     adConf.Certificate,
+		"client_tls_cert": adConf.ClientTLSCert,
+		"binddn":          adConf.BindDN,
+		"userdn":          adConf.UserDN,
+		"upndomain":       adConf.UPNDomain,
+		"bind_mode":       adConf.BindModeOrDefault(),
+		"tls_min_version": adConf.TLSMinVersion,
+		"tls_max_version": adConf.TLSMaxVersion,
+
+		"connection_timeout": int64(adConf.ConnectionTimeoutOrDefault().Seconds()),
+		"request_timeout":    int64(adConf.RequestTimeoutOrDefault().Seconds()),
+	}
+	if adConf.ComputerDN != "" {
+		respData["computerdn"] = adConf.ComputerDN
+	}
+	if adConf.BindMode == client.BindModeUPN {
+		respData["upn_username"] = adConf.UPNUsername
+	}
+	return &logical.Response{Data: respData}, nil
+}
+
+func (b *backend) operationNamedConfigDelete(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	name := fieldData.Get("name").(string)
+	users, err := namedConfigUsers(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) > 0 {
+		return codedErrorResponse(errCodeInvalidRequest, "config %q is still used by %s", name, strings.Join(users, ", ")), nil
+	}
+	return nil, req.Storage.Delete(ctx, namedConfigStoragePrefix+name)
+}
+
+func (b *backend) operationNamedConfigList(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	names, err := req.Storage.List(ctx, namedConfigStoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(names), nil
+}
+
+// namedConfigUsers describes the roles and library sets that connect to AD
+// with the named config, which can't be deleted out from under them.
+func namedConfigUsers(ctx context.Context, storage logical.Storage, name string) ([]string, error) {
+	var users []string
+	roleNames, err := storage.List(ctx, roleStorageKey+"/")
+	if err != nil {
+		return nil, err
+	}
+	for _, roleName := range roleNames {
+		role, err := readStoredRole(ctx, storage, roleName)
+		if err != nil {
+			return nil, err
+		}
+		if role != nil && role.Config == name {
+			users = append(users, fmt.Sprintf("role %q", roleName))
+		}
+	}
+	setNames, err := storage.List(ctx, libraryPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, setName := range setNames {
+		if strings.HasSuffix(setName, "/") {
+			continue
+		}
+		set, err := readSet(ctx, storage, setName)
+		if err != nil {
+			return nil, err
+		}
+		if set != nil && set.Config == name {
+			users = append(users, fmt.Sprintf("set %q", setName))
+		}
+	}
+	return users, nil
+}
+
+const (
+	namedConfigHelpSynopsis = `
+Configure connections to other AD domains.
+`
+	namedConfigHelpDescription = `
+Each config/<name> stores the connection to another AD domain, taking the same
+connection parameters as the config, like url, binddn, bindpass, userdn, and
+bind_mode.
+Roles and library sets whose config parameter names it manage their service
+accounts in that domain, so one mount can serve several domains. Everything
+else, like how passwords are generated, comes from the config.
+
+The bind password of a named config isn't rotated by rotate-root, and a named
+config can't be deleted while a role or set still uses it. If the config sets
+enforce_secure_connection, a named config's url must use ldaps:// or starttls.
+`
+)
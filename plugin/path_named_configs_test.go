@@ -0,0 +1,125 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+// urlDirectory records the URL each account's password was last set through.
+type urlDirectory struct {
+	*memoryDirectory
+	mu   sync.Mutex
+	urls map[string]string
+}
+
+func (d *urlDirectory) UpdatePassword(conf *client.ADConf, serviceAccountName string, newPassword string) error {
+	d.mu.Lock()
+	d.urls[serviceAccountName] = conf.Url
+	d.mu.Unlock()
+	return d.memoryDirectory.UpdatePassword(conf, serviceAccountName, newPassword)
+}
+
+func TestNamedConfigs(t *testing.T) {
+	directory := &urlDirectory{memoryDirectory: newMemoryDirectory(), urls: make(map[string]string)}
+	config := testConfig()
+	config.ADConf.Url = "ldaps://corp.example.com"
+	b, storage := getBackend(t, directory, config)
+	handle := requester(t, b, storage, "")
+
+	if resp := handle(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@partner.example.com",
+		"config":               "partner",
+	}); responseErrorCode(resp) != string(errCodeInvalidRequest) {
+		t.Fatalf("expected a role with a config that doesn't exist to be rejected but received %#v", resp)
+	}
+
+	if resp := handle(logical.UpdateOperation, configPath+"/partner", map[string]interface{}{
+		"url":      "ldaps://partner.example.com",
+		"binddn":   "vault@partner.example.com",
+		"bindpass": "secret",
+		"userdn":   "DC=partner,DC=example,DC=com",
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to write named config: %#v", resp)
+	}
+	resp := handle(logical.ReadOperation, configPath+"/partner", nil)
+	if resp.Data["url"] != "ldaps://partner.example.com" || resp.Data["bindpass"] != nil {
+		t.Fatalf("unexpected named config %#v", resp.Data)
+	}
+	if keys := handle(logical.ListOperation, configPath+"/", nil).Data["keys"]; !reflect.DeepEqual(keys, []string{"partner"}) {
+		t.Fatalf("unexpected named configs %#v", keys)
+	}
+
+	// Roles and sets manage their accounts in the domain their config names.
+	if resp := handle(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@partner.example.com",
+		"config":               "partner",
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to write role: %#v", resp)
+	}
+	if resp := handle(logical.ReadOperation, rolePrefix+"app", nil); resp.Data["config"] != "partner" {
+		t.Fatalf("expected the role's config to be read back but received %#v", resp.Data)
+	}
+	handle(logical.ReadOperation, credPrefix+"app", nil)
+	if resp := handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"borrowed@partner.example.com"},
+		"config":                "partner",
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to create set: %#v", resp)
+	}
+	handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil)
+	handle(logical.UpdateOperation, libraryPrefix+"manage/lib/check-in", nil)
+	handle(logical.UpdateOperation, rolePrefix+"local", map[string]interface{}{
+		"service_account_name": "local@corp.example.com",
+	})
+	handle(logical.ReadOperation, credPrefix+"local", nil)
+	expected := map[string]string{
+		"app@partner.example.com":      "ldaps://partner.example.com",
+		"borrowed@partner.example.com": "ldaps://partner.example.com",
+		"local@corp.example.com":       "ldaps://corp.example.com",
+	}
+	if !reflect.DeepEqual(directory.urls, expected) {
+		t.Fatalf("expected passwords to be set through %v but received %v", expected, directory.urls)
+	}
+
+	if resp := handle(logical.UpdateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"config": "",
+	}); responseErrorCode(resp) != string(errCodeInvalidRequest) {
+		t.Fatalf("expected the set's config not to be changeable but received %#v", resp)
+	}
+
+	// Named configs are held to the config's TLS requirements.
+	engineConf, err := readConfig(ctx, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engineConf.ADConf.RequireStartTLS = true
+	engineConf.ADConf.EnforceSecureConnection = true
+	resolved, err := configFor(ctx, storage, engineConf, "partner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resolved.ADConf.RequireStartTLS || !resolved.ADConf.EnforceSecureConnection {
+		t.Fatalf("expected the config's TLS requirements to apply but received %#v", resolved.ADConf)
+	}
+
+	// A config can't be deleted while it's used.
+	if resp := handle(logical.DeleteOperation, configPath+"/partner", nil); responseErrorCode(resp) != string(errCodeInvalidRequest) {
+		t.Fatalf("expected a config in use not to be deleted but received %#v", resp)
+	}
+	handle(logical.DeleteOperation, rolePrefix+"app", nil)
+	handle(logical.DeleteOperation, libraryPrefix+"lib", nil)
+	if resp := handle(logical.DeleteOperation, configPath+"/partner", nil); resp != nil && resp.IsError() {
+		t.Fatalf("unable to delete named config: %#v", resp)
+	}
+	if resp := handle(logical.ReadOperation, configPath+"/partner", nil); resp != nil {
+		t.Fatalf("expected the named config to be deleted but received %#v", resp)
+	}
+}
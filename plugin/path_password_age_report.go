@@ -0,0 +1,243 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const passwordAgeReportPath = "report/password-age"
+
+func (b *backend) pathPasswordAgeReport() *framework.Path {
+	return &framework.Path{
+		Pattern: passwordAgeReportPath + "$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "report",
+			OperationSuffix: "password-age",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"max_age": {
+				Type:        framework.TypeDurationSecond,
+				Description: "In seconds, the password age past which an account is non-compliant. Defaults to the config's compliance_max_password_age.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.operationPasswordAgeReport,
+				Summary:  "Report which managed service accounts' passwords are older than allowed.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"generated_at": {
+								Type:        framework.TypeTime,
+								Description: "When the report was generated.",
+							},
+							"compliant": {
+								Type:        framework.TypeSlice,
+								Description: "The accounts whose passwords are no older than their maximum age.",
+							},
+							"non_compliant": {
+								Type:        framework.TypeSlice,
+								Description: "The accounts whose passwords are older than their maximum age.",
+							},
+							"unknown": {
+								Type:        framework.TypeSlice,
+								Description: "The accounts that couldn't be judged, with the reason why.",
+							},
+							"summary": {
+								Type:        framework.TypeMap,
+								Description: "How many accounts are in each list.",
+							},
+						},
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    passwordAgeReportHelpSynopsis,
+		HelpDescription: passwordAgeReportHelpDescription,
+	}
+}
+
+// passwordAgeReport sorts accounts into the report's lists.
+type passwordAgeReport struct {
+	b            *backend
+	engineConf   *configuration
+	now          time.Time
+	maxAge       time.Duration
+	compliant    []map[string]interface{}
+	nonCompliant []map[string]interface{}
+	unknown      []map[string]interface{}
+}
+
+// add judges one account against maxAge, or against ownMaxAge if no maxAge was
+// configured or requested. Its age is taken from when AD shows the password was
+// last set, since that's what an auditor checks, falling back to when Vault last
+// rotated it if AD can't say. configName is the config the role or set connects
+// to AD with.
+func (r *passwordAgeReport) add(ctx context.Context, storage logical.Storage, kind, name, configName, serviceAccountName string, lastVaultRotation time.Time, ownMaxAge time.Duration) {
+	entry := map[string]interface{}{
+		"kind":                 kind,
+		"name":                 name,
+		"service_account_name": serviceAccountName,
+	}
+	if !lastVaultRotation.IsZero() {
+		entry["last_vault_rotation"] = lastVaultRotation
+	}
+
+	maxAge := r.maxAge
+	if maxAge <= 0 {
+		maxAge = ownMaxAge
+	}
+	if maxAge <= 0 {
+		entry["reason"] = "no maximum password age is configured for it"
+		r.unknown = append(r.unknown, entry)
+		return
+	}
+	entry["max_age"] = int64(maxAge.Seconds())
+
+	setAt := lastVaultRotation
+	var passwordLastSet time.Time
+	engineConf, err := configFor(ctx, storage, r.engineConf, configName)
+	if err == nil {
+		passwordLastSet, err = r.b.client.GetPasswordLastSet(engineConf.ADConf, serviceAccountName)
+	}
+	if err != nil {
+		r.b.Logger().Warn("unable to look up when the password was last set", "service_account_name", serviceAccountName, "error", err)
+		entry["error"] = err.Error()
+	} else if !passwordLastSet.IsZero() {
+		entry["password_last_set"] = passwordLastSet
+		setAt = passwordLastSet
+	}
+	if setAt.IsZero() {
+		entry["reason"] = "when its password was last set is unknown"
+		r.unknown = append(r.unknown, entry)
+		return
+	}
+
+	age := r.now.Sub(setAt)
+	entry["age"] = int64(age.Seconds())
+	if age > maxAge {
+		r.nonCompliant = append(r.nonCompliant, entry)
+		return
+	}
+	r.compliant = append(r.compliant, entry)
+}
+
+func (b *backend) operationPasswordAgeReport(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if engineConf == nil {
+		return nil, errors.New("the config is currently unset")
+	}
+
+	report := &passwordAgeReport{
+		b:            b,
+		engineConf:   engineConf,
+		now:          b.now(),
+		maxAge:       time.Duration(engineConf.ComplianceMaxPasswordAge) * time.Second,
+		compliant:    []map[string]interface{}{},
+		nonCompliant: []map[string]interface{}{},
+		unknown:      []map[string]interface{}{},
+	}
+	if maxAgeRaw, ok := fieldData.GetOk("max_age"); ok {
+		maxAge := maxAgeRaw.(int)
+		if maxAge <= 0 {
+			return codedErrorResponse(errCodeInvalidRequest, "max_age must be positive"), nil
+		}
+		report.maxAge = time.Duration(maxAge) * time.Second
+	}
+
+	roleNames, err := req.Storage.List(ctx, roleStorageKey+"/")
+	if err != nil {
+		return nil, err
+	}
+	for _, roleName := range roleNames {
+		role, err := readStoredRole(ctx, req.Storage, roleName)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			continue
+		}
+		// A role's password is rotated once it's older than its ttl, unless it's
+		// rotated on a schedule instead, or not by Vault at all.
+		ownMaxAge := time.Duration(role.MaxPasswordAge) * time.Second
+		if ownMaxAge <= 0 && role.RotationSchedule == "" && !role.DisableRotation {
+			ownMaxAge = time.Duration(role.TTL) * time.Second
+		}
+		report.add(ctx, req.Storage, "role", roleName, role.Config, role.ServiceAccountName, role.LastVaultRotation, ownMaxAge)
+	}
+
+	setNames, err := req.Storage.List(ctx, libraryPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, setName := range setNames {
+		if strings.HasSuffix(setName, "/") {
+			continue
+		}
+		set, err := readSet(ctx, req.Storage, setName)
+		if err != nil {
+			return nil, err
+		}
+		if set == nil {
+			continue
+		}
+		for _, serviceAccountName := range set.ServiceAccountNames {
+			var lastRotated time.Time
+			stored, err := loadPasswordMetadata(ctx, req.Storage, serviceAccountName)
+			if err != nil && err != errNotFound {
+				return nil, err
+			}
+			if stored != nil {
+				lastRotated = stored.LastRotated
+			}
+			report.add(ctx, req.Storage, "set", setName, set.Config, serviceAccountName, lastRotated, set.MaxPasswordAge)
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"generated_at":  report.now,
+			"compliant":     report.compliant,
+			"non_compliant": report.nonCompliant,
+			"unknown":       report.unknown,
+			"summary": map[string]interface{}{
+				"compliant":     len(report.compliant),
+				"non_compliant": len(report.nonCompliant),
+				"unknown":       len(report.unknown),
+			},
+		},
+	}, nil
+}
+
+const (
+	passwordAgeReportHelpSynopsis = `
+Report which managed service accounts' passwords are older than allowed.
+`
+	passwordAgeReportHelpDescription = `
+This endpoint walks every role's service account and every library set's
+service accounts, and sorts them into compliant, non_compliant, and unknown
+lists that can be attached to an audit.
+
+A password's age is taken from when AD shows it was last set, falling back to
+when Vault last rotated it. It's compared against max_age if one is given, or
+the config's compliance_max_password_age. If neither is set, a role's account is
+judged by the role's max_password_age, or its ttl if it isn't rotated on a
+schedule, and a library set's account by the set's max_password_age. Accounts
+with no maximum age, or whose password age can't be determined, are listed as
+unknown with the reason why.
+`
+)
@@ -0,0 +1,82 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestPasswordAgeReport(t *testing.T) {
+	directory := newMemoryDirectory()
+	b, storage := getBackend(t, directory, testConfig())
+	handle := succeedingRequester(t, b, storage, "")
+	names := func(entries interface{}) []string {
+		var names []string
+		for _, entry := range entries.([]map[string]interface{}) {
+			names = append(names, entry["service_account_name"].(string))
+		}
+		return names
+	}
+
+	handle(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@example.com",
+		"ttl":                  60,
+	})
+	handle(logical.ReadOperation, "creds/app", nil)
+	handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com", "b@example.com"},
+		"max_password_age":      3600,
+	})
+	handle(logical.CreateOperation, libraryPrefix+"unlimited", map[string]interface{}{
+		"service_account_names": []string{"c@example.com"},
+	})
+
+	// The role's password is older than its ttl, and one of the set's is older than
+	// its max_password_age, according to AD.
+	directory.account("app@example.com").passwordLastSet = time.Now().Add(-2 * time.Minute)
+	directory.account("b@example.com").passwordLastSet = time.Now().Add(-2 * time.Hour)
+
+	resp := handle(logical.ReadOperation, passwordAgeReportPath, nil)
+	if got := names(resp.Data["compliant"]); len(got) != 1 || got[0] != "a@example.com" {
+		t.Fatalf("unexpected compliant accounts %v", got)
+	}
+	if got := names(resp.Data["non_compliant"]); len(got) != 2 || got[0] != "app@example.com" || got[1] != "b@example.com" {
+		t.Fatalf("unexpected non-compliant accounts %v", got)
+	}
+	unknown := resp.Data["unknown"].([]map[string]interface{})
+	if len(unknown) != 1 || unknown[0]["service_account_name"] != "c@example.com" || unknown[0]["reason"] == nil {
+		t.Fatalf("expected the account without a maximum age to be unknown but received %#v", unknown)
+	}
+	if resp.Data["summary"].(map[string]interface{})["non_compliant"] != 2 {
+		t.Fatalf("unexpected summary %#v", resp.Data["summary"])
+	}
+
+	// The config's threshold applies to every account.
+	engineConf, err := readConfig(ctx, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engineConf.ComplianceMaxPasswordAge = 3 * 3600
+	if err := writeConfig(ctx, storage, engineConf); err != nil {
+		t.Fatal(err)
+	}
+	resp = handle(logical.ReadOperation, passwordAgeReportPath, nil)
+	if got := names(resp.Data["compliant"]); len(got) != 4 {
+		t.Fatalf("expected every account to be compliant but received %v", got)
+	}
+
+	// And a requested threshold overrides it.
+	resp = handle(logical.ReadOperation, passwordAgeReportPath, map[string]interface{}{
+		"max_age": 3600,
+	})
+	if got := names(resp.Data["non_compliant"]); len(got) != 1 || got[0] != "b@example.com" {
+		t.Fatalf("unexpected non-compliant accounts %v", got)
+	}
+	if resp.Data["non_compliant"].([]map[string]interface{})[0]["max_age"] != int64(3600) {
+		t.Fatalf("unexpected entry %#v", resp.Data["non_compliant"])
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func (b *backend) pathSetManagePassword() *framework.Path {
+	return &framework.Path{
+		Pattern: libraryPrefix + "manage/" + framework.GenericNameRegex("name") + "/password$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "peek",
+			OperationSuffix: "library-account-password",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the set.",
+				Required:    true,
+			},
+			"service_account_name": {
+				Type:        framework.TypeString,
+				Description: "The username/logon name of the checked-in service account whose password to return.",
+				Required:    true,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.operationSetManagePassword,
+				Summary:  "Read a checked-in library account's password without checking it out.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"service_account_name": {
+								Type:        framework.TypeString,
+								Description: "The service account whose password was read.",
+							},
+							"password": {
+								Type:        framework.TypeString,
+								Description: "The service account's current password.",
+							},
+							"emergency_access": {
+								Type:        framework.TypeBool,
+								Description: "Always true, so the read stands out in audit logs from check-outs.",
+							},
+							"object_sid": {
+								Type:        framework.TypeString,
+								Description: "The service account's SID, if include_account_ids is set in the config.",
+							},
+							"object_guid": {
+								Type:        framework.TypeString,
+								Description: "The service account's objectGUID, if include_account_ids is set in the config.",
+							},
+							"kerberos_realm": {
+								Type:        framework.TypeString,
+								Description: "The service account's Kerberos realm, if include_kerberos_info is set in the config.",
+							},
+							"kerberos_principal": {
+								Type:        framework.TypeString,
+								Description: "The service account's Kerberos principal, if include_kerberos_info is set in the config.",
+							},
+							"netbios_domain": {
+								Type:        framework.TypeString,
+								Description: "The NetBIOS name of the service account's domain, if include_kerberos_info is set in the config.",
+							},
+							"kdcs": {
+								Type:        framework.TypeCommaStringSlice,
+								Description: "The KDCs of the service account's realm, if include_kerberos_info is set in the config.",
+							},
+						},
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    managePasswordHelpSynopsis,
+		HelpDescription: managePasswordHelpDescription,
+	}
+}
+
+func (b *backend) operationSetManagePassword(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	setName := fieldData.Get("name").(string)
+	requestedName := fieldData.Get("service_account_name").(string)
+	if requestedName == "" {
+		return codedErrorResponse(errCodeInvalidRequest, `"service_account_name" must be provided`), nil
+	}
+
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if engineConf == nil {
+		return nil, errors.New("the config is currently unset")
+	}
+	if resp := responseWrappingRequired(engineConf, req); resp != nil {
+		return resp, nil
+	}
+
+	lock := locksutil.LockForKey(b.checkOutLocks, setName)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	set, err := readSet(ctx, req.Storage, setName)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return codedErrorResponse(errCodeSetNotFound, `%q doesn't exist`, setName), nil
+	}
+	// The set's spelling is used, since its storage entries are keyed by it.
+	serviceAccountName := findServiceAccountName(set.ServiceAccountNames, requestedName)
+	if serviceAccountName == "" {
+		return codedErrorResponse(errCodeInvalidRequest, "%q isn't managed by %q", requestedName, setName), nil
+	}
+	checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, req.Storage, serviceAccountName)
+	if err != nil {
+		return nil, err
+	}
+	if !checkOut.IsAvailable {
+		return codedErrorResponse(errCodeAlreadyCheckedOut, "%q is checked out, so its password is only available to its borrower", serviceAccountName), nil
+	}
+	password, err := retrievePassword(ctx, req.Storage, b.transit, serviceAccountName)
+	if err != nil {
+		return nil, err
+	}
+
+	b.Logger().Warn("library account password read without a check-out", "set", setName, "service_account_name", serviceAccountName, "requester", requesterIdentity(req))
+	metrics.IncrCounter([]string{"active directory", "password peek", setName}, 1)
+	b.notifyWebhook(ctx, req.Storage, webhookEventPasswordPeek, map[string]interface{}{
+		"set_name":             setName,
+		"service_account_name": serviceAccountName,
+		"requester":            requesterIdentity(req),
+	})
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"service_account_name": serviceAccountName,
+			"password":             password,
+			"emergency_access":     true,
+		},
+	}
+	resp.AddWarning("this password was read without checking the account out, so it stays available to others and isn't rotated until its next check-in")
+	b.addAccountIDs(engineConf, serviceAccountName, resp)
+	b.addKerberosInfo(engineConf, serviceAccountName, resp)
+	return resp, nil
+}
+
+const (
+	managePasswordHelpSynopsis = `
+Read a checked-in library account's password without checking it out.
+`
+	managePasswordHelpDescription = `
+Returns the stored password of a checked-in service account, for emergencies
+where an account is needed without taking it from the pool. The account stays
+available, and its password isn't rotated until its next check-in, so anyone
+else who checks it out gets the same password. Checked-out accounts are
+refused, since their passwords belong to their borrowers.
+
+The response always has "emergency_access" set and a warning, so the read
+stands out in audit logs, and a "password_peek" webhook is sent if webhooks are
+configured. It's meant to be allowed only to administrators, under a tighter
+policy than the other manage paths.
+`
+)
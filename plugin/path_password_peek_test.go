@@ -0,0 +1,46 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestSetManagePassword(t *testing.T) {
+	directory := newMemoryDirectory()
+	b, storage := getBackend(t, directory, testConfig())
+	handle := requester(t, b, storage, "admin")
+
+	handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com", "b@example.com"},
+	})
+
+	resp := handle(logical.ReadOperation, libraryPrefix+"manage/lib/password", map[string]interface{}{
+		"service_account_name": "A@example.com",
+	})
+	if resp == nil || resp.IsError() {
+		t.Fatalf("unable to read the password: %#v", resp)
+	}
+	if resp.Data["password"] != directory.account("a@example.com").password || resp.Data["emergency_access"] != true || len(resp.Warnings) != 1 {
+		t.Fatalf("unexpected response %#v", resp)
+	}
+	status := handle(logical.ReadOperation, libraryPrefix+"lib/status", nil).Data["a@example.com"].(map[string]interface{})
+	if status["available"] != true {
+		t.Fatalf("expected the account to stay available but received %#v", status)
+	}
+
+	if resp := handle(logical.ReadOperation, libraryPrefix+"manage/lib/password", map[string]interface{}{
+		"service_account_name": "c@example.com",
+	}); responseErrorCode(resp) != string(errCodeInvalidRequest) {
+		t.Fatalf("expected an account outside the set to be refused but received %#v", resp)
+	}
+	checkOut := handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil)
+	if resp := handle(logical.ReadOperation, libraryPrefix+"manage/lib/password", map[string]interface{}{
+		"service_account_name": checkOut.Data["service_account_name"],
+	}); responseErrorCode(resp) != string(errCodeAlreadyCheckedOut) {
+		t.Fatalf("expected a checked-out account to be refused but received %#v", resp)
+	}
+}
@@ -6,6 +6,7 @@ package plugin
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
@@ -33,9 +34,16 @@ func (b *backend) invalidateRole(ctx context.Context, key string) {
 func (b *backend) pathListRoles() *framework.Path {
 	return &framework.Path{
 		Pattern: rolePrefix + "?$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationSuffix: "roles",
+		},
 
-		Callbacks: map[logical.Operation]framework.OperationFunc{
-			logical.ListOperation: b.roleListOperation,
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.roleListOperation,
+				Summary:  "List the name of each role.",
+			},
 		},
 
 		HelpSynopsis:    pathListRolesHelpSyn,
@@ -46,6 +54,10 @@ func (b *backend) pathListRoles() *framework.Path {
 func (b *backend) pathRoles() *framework.Path {
 	return &framework.Path{
 		Pattern: rolePrefix + framework.GenericNameRegex("name"),
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationSuffix: "role",
+		},
 		Fields: map[string]*framework.FieldSchema{
 			"name": {
 				Type:        framework.TypeLowerCaseString,
@@ -53,23 +65,233 @@ func (b *backend) pathRoles() *framework.Path {
 			},
 			"service_account_name": {
 				Type:        framework.TypeString,
-				Description: "The username/logon name for the service account with which this role will be associated.",
+				Description: "The username/logon name for the service account with which this role will be associated. A computer account is named by its sAMAccountName, ex. WEB01$.",
 			},
 			"ttl": {
 				Type:        framework.TypeDurationSecond,
 				Description: "In seconds, the default password time-to-live.",
 			},
+			"rotation_schedule": {
+				Type:        framework.TypeString,
+				Description: "A cron-style string in UTC, like \"0 0 * * SAT\", for when to rotate the password. Can't be used with ttl.",
+			},
+			"rotation_window": {
+				Type:        framework.TypeDurationSecond,
+				Description: "In seconds, how long after each scheduled time the password may still be rotated. Once it passes, rotation waits for the next scheduled time. Defaults to 0, which has no limit.",
+			},
+			"max_password_age": {
+				Type:        framework.TypeDurationSecond,
+				Description: "In seconds, how long after Active Directory shows the password as last set to rotate it in the background, even if the creds are never read. Defaults to 0, which only rotates the password when the creds are read.",
+			},
+			"min_rotation_interval": {
+				Type:        framework.TypeDurationSecond,
+				Description: "In seconds, the least time between rotations triggered by reading the creds. Reads before it passes get the current password, even if its ttl or rotation_schedule says it's due. Defaults to 0, which has no limit.",
+			},
+			"allow_privileged": {
+				Type:        framework.TypeBool,
+				Description: "Allow a service account with an adminCount of 1, or in a built-in group like Domain Admins, to be managed by the role.",
+				Default:     false,
+			},
+			"verify_after_rotation": {
+				Type:        framework.TypeBool,
+				Description: "Bind as the service account with each new password, retrying while it replicates, and fail the rotation if it doesn't work. The previous password is then restored.",
+				Default:     false,
+			},
+			"omit_last_password": {
+				Type:        framework.TypeBool,
+				Description: "Leave last_password out of creds responses, so consumers only ever see the current password. It's still kept for rollback-password.",
+				Default:     false,
+			},
+			"disable_rotation": {
+				Type:        framework.TypeBool,
+				Description: "Never change the service account's password, for accounts whose rotation is owned outside of Vault. Vault serves the password given in password instead, after checking it by binding as the account.",
+				Default:     false,
+			},
+			"config": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "The name of the config/<name> to manage the service account with, for accounts in another AD domain. Defaults to the config.",
+			},
+			"password": {
+				Type:        framework.TypeString,
+				Description: "For roles with disable_rotation set, the service account's current password. Required when disable_rotation is first set or the service account changes, and otherwise kept if it isn't sent.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					Sensitive: true,
+				},
+			},
+			"notes": {
+				Type:        framework.TypeString,
+				Description: "Free-form notes for operators, like who owns the service account or how it's used.",
+			},
+			"failure_threshold": {
+				Type:        framework.TypeInt,
+				Description: "How many rotations in a row may fail before the failure_action is taken. Defaults to 0, which never takes it.",
+				Default:     0,
+			},
+			"failure_action": {
+				Type:        framework.TypeString,
+				Description: `What to do once failure_threshold rotations in a row fail: "retry" keeps retrying, "stop" stops retrying, "disable" stops retrying and refuses the creds until the role is rotated, and "event" keeps retrying but sends an event.`,
+				Default:     failureActionRetry,
+			},
+			"min_digits":    passwordCompositionFields()["min_digits"],
+			"min_uppercase": passwordCompositionFields()["min_uppercase"],
+			"min_symbols":   passwordCompositionFields()["min_symbols"],
+			"charset":       passwordCompositionFields()["charset"],
+
+			"exclude_characters": passwordCompositionFields()["exclude_characters"],
 		},
-		Callbacks: map[logical.Operation]framework.OperationFunc{
-			logical.UpdateOperation: b.roleUpdateOperation,
-			logical.ReadOperation:   b.roleReadOperation,
-			logical.DeleteOperation: b.roleDeleteOperation,
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.roleUpdateOperation,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Create or update a role.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
+			},
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.roleReadOperation,
+				Summary:  "Read a role.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields:      roleResponseFields(),
+					}},
+				},
+			},
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback:                    b.roleDeleteOperation,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Delete a role and its creds.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
+			},
 		},
 		HelpSynopsis:    roleHelpSynopsis,
 		HelpDescription: roleHelpDescription,
 	}
 }
 
+// roleResponseFields describes the fields returned when reading a role.
+func roleResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"service_account_name": {
+			Type:        framework.TypeString,
+			Description: "The username/logon name for the service account with which this role is associated.",
+		},
+		"config": {
+			Type:        framework.TypeString,
+			Description: "The name of the config/<name> the service account is managed with, if it isn't the config.",
+		},
+		"ttl": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, the default password time-to-live.",
+		},
+		"rotation_schedule": {
+			Type:        framework.TypeString,
+			Description: "A cron-style string in UTC for when to rotate the password.",
+		},
+		"rotation_window": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, how long after each scheduled time the password may still be rotated.",
+		},
+		"max_password_age": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, how long after Active Directory shows the password as last set to rotate it in the background.",
+		},
+		"min_rotation_interval": {
+			Type:        framework.TypeDurationSecond,
+			Description: "In seconds, the least time between rotations triggered by reading the creds.",
+		},
+		"allow_privileged": {
+			Type:        framework.TypeBool,
+			Description: "Whether a privileged service account may be managed by the role.",
+		},
+		"verify_after_rotation": {
+			Type:        framework.TypeBool,
+			Description: "Whether each new password is verified by binding as the service account.",
+		},
+		"disable_rotation": {
+			Type:        framework.TypeBool,
+			Description: "Whether Vault never changes the password, and serves one managed outside of Vault.",
+		},
+		"omit_last_password": {
+			Type:        framework.TypeBool,
+			Description: "Whether last_password is left out of creds responses.",
+		},
+		"failure_threshold": {
+			Type:        framework.TypeInt,
+			Description: "How many rotations in a row may fail before the failure_action is taken.",
+		},
+		"failure_action": {
+			Type:        framework.TypeString,
+			Description: "What to do once failure_threshold rotations in a row fail.",
+		},
+		"min_digits": {
+			Type:        framework.TypeInt,
+			Description: "The fewest digits the role's passwords contain, if the role overrides the config's rules.",
+		},
+		"min_uppercase": {
+			Type:        framework.TypeInt,
+			Description: "The fewest uppercase letters the role's passwords contain, if the role overrides the config's rules.",
+		},
+		"min_symbols": {
+			Type:        framework.TypeInt,
+			Description: "The fewest symbols the role's passwords contain, if the role overrides the config's rules.",
+		},
+		"charset": {
+			Type:        framework.TypeString,
+			Description: "The characters the role's passwords are made of, if the role overrides the config's rules.",
+		},
+		"exclude_characters": {
+			Type:        framework.TypeString,
+			Description: "The characters left out of the role's passwords, if the role overrides the config's rules.",
+		},
+		"notes": {
+			Type:        framework.TypeString,
+			Description: "Free-form notes for operators.",
+		},
+		"updated_by": {
+			Type:        framework.TypeString,
+			Description: "The entity ID, or the display name of a token without an entity, that last wrote the role.",
+		},
+		"updated_at": {
+			Type:        framework.TypeTime,
+			Description: "When the role was last written.",
+		},
+		"rotation_failures": {
+			Type:        framework.TypeInt,
+			Description: "How many rotations in a row have failed, if the last one did.",
+		},
+		"rotation_stopped": {
+			Type:        framework.TypeBool,
+			Description: "Whether failed rotations are no longer retried because of the failure_action.",
+		},
+		"disabled": {
+			Type:        framework.TypeBool,
+			Description: "Whether the creds are refused because of the failure_action.",
+		},
+		"last_ldap_error": {
+			Type:        framework.TypeMap,
+			Description: "The most recent error from AD for the role, with the operation that failed and when.",
+		},
+		"last_vault_rotation": {
+			Type:        framework.TypeTime,
+			Description: "When Vault last rotated the service account's password.",
+		},
+		"password_last_set": {
+			Type:        framework.TypeTime,
+			Description: "When Active Directory shows the service account's password was last set.",
+		},
+	}
+}
+
 func (b *backend) readRole(ctx context.Context, storage logical.Storage, roleName string) (*backendRole, error) {
 	// If it's cached, return it from there.
 	roleIfc, found := b.roleCache.Get(roleName)
@@ -78,16 +300,8 @@ func (b *backend) readRole(ctx context.Context, storage logical.Storage, roleNam
 	}
 
 	// It's not, read it from storage.
-	entry, err := storage.Get(ctx, roleStorageKey+"/"+roleName)
-	if err != nil {
-		return nil, err
-	}
-	if entry == nil {
-		return nil, nil
-	}
-
-	role := &backendRole{}
-	if err := entry.DecodeJSON(role); err != nil {
+	role, err := readStoredRole(ctx, storage, roleName)
+	if err != nil || role == nil {
 		return nil, err
 	}
 
@@ -99,9 +313,13 @@ func (b *backend) readRole(ctx context.Context, storage logical.Storage, roleNam
 	if engineConf == nil {
 		return nil, errors.New("the config is currently unset")
 	}
+	if engineConf, err = configFor(ctx, storage, engineConf, role.Config); err != nil {
+		return nil, err
+	}
 
 	passwordLastSet, err := b.client.GetPasswordLastSet(engineConf.ADConf, role.ServiceAccountName)
 	if err != nil {
+		b.recordRoleError(ctx, storage, roleName, roleErrorLookup, err)
 		return nil, err
 	}
 	role.PasswordLastSet = passwordLastSet
@@ -111,6 +329,22 @@ func (b *backend) readRole(ctx context.Context, storage logical.Storage, roleNam
 	return role, nil
 }
 
+// readStoredRole reads a role from storage without looking up its service account in AD.
+func readStoredRole(ctx context.Context, storage logical.Storage, roleName string) (*backendRole, error) {
+	entry, err := storage.Get(ctx, roleStorageKey+"/"+roleName)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	role := &backendRole{}
+	if err := entry.DecodeJSON(role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
 func (b *backend) writeRoleToStorage(ctx context.Context, storage logical.Storage, roleName string, role *backendRole) error {
 	entry, err := logical.StorageEntryJSON(roleStorageKey+"/"+roleName, role)
 	if err != nil {
@@ -135,26 +369,89 @@ func (b *backend) roleUpdateOperation(ctx context.Context, req *logical.Request,
 	if engineConf == nil {
 		return nil, errors.New("the config is currently unset")
 	}
+	baseConf := engineConf
+	configName := fieldData.Get("config").(string)
+	if engineConf, err = configFor(ctx, req.Storage, engineConf, configName); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+	}
 
 	// Actually construct it.
 	serviceAccountName, err := getServiceAccountName(fieldData)
 	if err != nil {
 		return nil, err
 	}
+	if serviceAccountName, err = canonicalServiceAccountName(engineConf, serviceAccountName); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+	}
 
-	// verify service account exists
-	_, err = b.client.Get(engineConf.ADConf, serviceAccountName)
+	// Library sets rotate their service accounts on every check-in, which would
+	// silently invalidate the password stored for this role.
+	owner, err := b.describeAccountOwner(ctx, req.Storage, serviceAccountName)
 	if err != nil {
 		return nil, err
 	}
+	if owner != "" {
+		return codedErrorResponse(errCodeAccountAlreadyManaged, "%q is already managed by %s", serviceAccountName, owner), nil
+	}
 
-	ttl, err := getValidatedTTL(engineConf.PasswordConf, fieldData)
+	// verify service account exists
+	entry, err := b.client.Get(engineConf.ADConf, serviceAccountName)
 	if err != nil {
-		return nil, err
+		return errorResponseFor(err)
+	}
+	allowPrivileged := fieldData.Get("allow_privileged").(bool)
+	if resp := checkManageable(engineConf, serviceAccountName, entry, allowPrivileged); resp != nil {
+		return resp, nil
 	}
+
 	role := &backendRole{
-		ServiceAccountName: serviceAccountName,
-		TTL:                ttl,
+		ServiceAccountName:  serviceAccountName,
+		Config:              configName,
+		AllowPrivileged:     allowPrivileged,
+		VerifyAfterRotation: fieldData.Get("verify_after_rotation").(bool),
+		OmitLastPassword:    fieldData.Get("omit_last_password").(bool),
+		DisableRotation:     fieldData.Get("disable_rotation").(bool),
+		Notes:               fieldData.Get("notes").(string),
+		UpdatedBy:           requesterIdentity(req),
+		UpdatedAt:           b.now().UTC(),
+	}
+	if _, ok := b.client.(PasswordVerifier); role.VerifyAfterRotation && !ok {
+		return codedErrorResponse(errCodeInvalidRequest, "verify_after_rotation isn't supported by the secrets client"), nil
+	}
+	password := fieldData.Get("password").(string)
+	if password != "" && !role.DisableRotation {
+		return codedErrorResponse(errCodeInvalidRequest, "password can only be given when disable_rotation is set"), nil
+	}
+	if _, ok := b.client.(PasswordVerifier); role.DisableRotation && !ok {
+		return codedErrorResponse(errCodeInvalidRequest, "disable_rotation isn't supported by the secrets client"), nil
+	}
+	if err := setRotation(role, engineConf.PasswordConf, fieldData); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+	}
+	role.MaxPasswordAge = fieldData.Get("max_password_age").(int)
+	if role.MaxPasswordAge < 0 {
+		return codedErrorResponse(errCodeInvalidRequest, "max_password_age can't be negative"), nil
+	}
+	if role.DisableRotation && role.MaxPasswordAge > 0 {
+		return codedErrorResponse(errCodeInvalidRequest, "max_password_age can't be used with disable_rotation"), nil
+	}
+	role.MinRotationInterval = fieldData.Get("min_rotation_interval").(int)
+	if role.MinRotationInterval < 0 {
+		return codedErrorResponse(errCodeInvalidRequest, "min_rotation_interval can't be negative"), nil
+	}
+	role.FailureThreshold = fieldData.Get("failure_threshold").(int)
+	role.FailureAction = fieldData.Get("failure_action").(string)
+	if err := validateFailurePolicy(role.FailureThreshold, role.FailureAction); err != nil {
+		return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+	}
+	if role.FailureAction == failureActionQuarantine {
+		return codedErrorResponse(errCodeInvalidRequest, "failure_action %q only applies to library sets", failureActionQuarantine), nil
+	}
+	if composition := passwordCompositionFromFields(fieldData); composition.isSet() {
+		if err := engineConf.PasswordConf.withComposition(&composition).validate(); err != nil {
+			return codedErrorResponse(errCodeInvalidRequest, "%s", err), nil
+		}
+		role.PasswordComposition = &composition
 	}
 
 	// Was there already a role before that we're now overwriting? If so, let's carry forward the LastVaultRotation.
@@ -166,31 +463,106 @@ func (b *backend) roleUpdateOperation(ctx context.Context, req *logical.Request,
 			role.LastVaultRotation = oldRole.LastVaultRotation
 		}
 	}
+	// The password of a role with rotation disabled is given to us rather than
+	// generated, so it's checked before it's stored.
+	if role.DisableRotation {
+		keepPassword := oldRole != nil && oldRole.DisableRotation && normalizeServiceAccountName(oldRole.ServiceAccountName) == serviceAccountName
+		if password == "" && !keepPassword {
+			return codedErrorResponse(errCodeInvalidRequest, "password is required to disable rotation"), nil
+		}
+		if password != "" {
+			if err := b.client.(PasswordVerifier).VerifyPassword(engineConf.ADConf, serviceAccountName, password); err != nil {
+				return codedErrorResponse(errCodeInvalidRequest, "unable to bind as %q with the given password: %s", serviceAccountName, err), nil
+			}
+		}
+	}
+	// Roles may share a service account, so it's only stamped by the first one.
+	roleOwners, err := roleServiceAccounts(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
 
 	// writeRoleToStorage it to storage, but not to the role cache because its
 	// last updated time from AD is only grabbed on reads.
 	if err := b.writeRoleToStorage(ctx, req.Storage, roleName, role); err != nil {
 		return nil, err
 	}
+	if role.DisableRotation && password != "" {
+		if err := b.storeExternalPassword(ctx, req.Storage, roleName, role.ServiceAccountName, password); err != nil {
+			return nil, err
+		}
+	}
 
-	// Return a 204.
-	return nil, nil
+	var warnings []string
+	if oldRole == nil || normalizeServiceAccountName(oldRole.ServiceAccountName) != serviceAccountName {
+		if _, ok := roleOwners[serviceAccountName]; !ok {
+			warnings = b.stampAccounts(engineConf, req.MountPoint, &accountOwner{Kind: accountOwnerRole, Name: roleName}, []string{serviceAccountName})
+		}
+		if oldRole != nil {
+			oldConf, err := configFor(ctx, req.Storage, baseConf, oldRole.Config)
+			if err != nil {
+				return nil, err
+			}
+			clearWarnings, err := b.clearRoleStamp(ctx, req.Storage, oldConf, oldRole.ServiceAccountName)
+			if err != nil {
+				return nil, err
+			}
+			warnings = append(warnings, clearWarnings...)
+		}
+	}
+
+	// Return a 204 unless there's something to warn about.
+	return warningsResponse(warnings), nil
 }
 
 func (b *backend) roleReadOperation(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
 	roleName := fieldData.Get("name").(string)
 
+	var warnings []string
 	role, err := b.readRole(ctx, req.Storage, roleName)
 	if err != nil {
-		return nil, err
+		// Still show the role if its service account can't be looked up, since
+		// that's when it's most likely to be read to find out what's wrong.
+		stored, storedErr := readStoredRole(ctx, req.Storage, roleName)
+		if storedErr != nil || stored == nil {
+			return nil, err
+		}
+		role = stored
+		warnings = append(warnings, fmt.Sprintf("unable to look up the service account: %s", err))
 	}
 	if role == nil {
 		return nil, nil
 	}
 
-	return &logical.Response{
-		Data: role.Map(),
-	}, nil
+	data := role.Map()
+	roleErr, err := readRoleError(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if roleErr != nil {
+		data["last_ldap_error"] = roleErr.Map()
+	}
+	retry, err := readRetryTask(ctx, req.Storage, retryKindRole, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if retry != nil {
+		data["rotation_failures"] = retry.Attempts
+		data["rotation_stopped"] = retry.Stopped
+		data["disabled"] = retry.Disabled
+	}
+	resp := &logical.Response{
+		Data:     data,
+		Warnings: warnings,
+	}
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if engineConf != nil {
+		addDeprecationWarnings(resp, engineConf.PasswordConf.withComposition(role.PasswordComposition))
+	}
+	return resp, nil
 }
 
 func (b *backend) roleListOperation(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
@@ -204,16 +576,81 @@ func (b *backend) roleListOperation(ctx context.Context, req *logical.Request, _
 func (b *backend) roleDeleteOperation(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
 	roleName := fieldData.Get("name").(string)
 
+	role, err := readStoredRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
 	if err := req.Storage.Delete(ctx, roleStorageKey+"/"+roleName); err != nil {
 		return nil, err
 	}
 
 	b.roleCache.Delete(roleName)
 
+	if err := req.Storage.Delete(ctx, roleErrorStoragePrefix+roleName); err != nil {
+		return nil, err
+	}
 	if err := b.deleteCred(ctx, req.Storage, roleName); err != nil {
 		return nil, err
 	}
-	return nil, nil
+	if role == nil {
+		return nil, nil
+	}
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if engineConf, err = configFor(ctx, req.Storage, engineConf, role.Config); err != nil {
+		return nil, err
+	}
+	warnings, err := b.clearRoleStamp(ctx, req.Storage, engineConf, role.ServiceAccountName)
+	if err != nil {
+		return nil, err
+	}
+	return warningsResponse(warnings), nil
+}
+
+// clearRoleStamp clears the stamp of a service account a role no longer manages,
+// unless another role still does.
+func (b *backend) clearRoleStamp(ctx context.Context, storage logical.Storage, engineConf *configuration, serviceAccountName string) ([]string, error) {
+	if engineConf == nil || engineConf.StampAttribute == "" {
+		return nil, nil
+	}
+	roleOwners, err := roleServiceAccounts(ctx, storage)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := roleOwners[normalizeServiceAccountName(serviceAccountName)]; ok {
+		return nil, nil
+	}
+	return b.clearStamps(engineConf, []string{serviceAccountName}), nil
+}
+
+// roleServiceAccounts returns the name of a role managing each service account
+// that's managed by a role, keyed by the account's normalized name.
+func roleServiceAccounts(ctx context.Context, storage logical.Storage) (map[string]string, error) {
+	roleNames, err := storage.List(ctx, roleStorageKey+"/")
+	if err != nil {
+		return nil, err
+	}
+	owners := make(map[string]string, len(roleNames))
+	for _, roleName := range roleNames {
+		entry, err := storage.Get(ctx, roleStorageKey+"/"+roleName)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+		role := &backendRole{}
+		if err := entry.DecodeJSON(role); err != nil {
+			return nil, err
+		}
+		serviceAccountName := normalizeServiceAccountName(role.ServiceAccountName)
+		if _, ok := owners[serviceAccountName]; !ok {
+			owners[serviceAccountName] = roleName
+		}
+	}
+	return owners, nil
 }
 
 func getServiceAccountName(fieldData *framework.FieldData) (string, error) {
@@ -224,6 +661,36 @@ func getServiceAccountName(fieldData *framework.FieldData) (string, error) {
 	return serviceAccountName, nil
 }
 
+// setRotation sets either the role's ttl or its rotation schedule and window.
+func setRotation(role *backendRole, passwordConf passwordConf, fieldData *framework.FieldData) error {
+	rotationSchedule := fieldData.Get("rotation_schedule").(string)
+	rotationWindow := fieldData.Get("rotation_window").(int)
+	if rotationSchedule == "" {
+		if rotationWindow != 0 {
+			return errors.New("rotation_window requires a rotation_schedule")
+		}
+		ttl, err := getValidatedTTL(passwordConf, fieldData)
+		if err != nil {
+			return err
+		}
+		role.TTL = ttl
+		return nil
+	}
+
+	if _, ok := fieldData.GetOk("ttl"); ok {
+		return errors.New("ttl and rotation_schedule are mutually exclusive")
+	}
+	if _, err := rotationScheduleParser.Parse(rotationSchedule); err != nil {
+		return fmt.Errorf("invalid rotation_schedule: %w", err)
+	}
+	if rotationWindow != 0 && time.Duration(rotationWindow)*time.Second < minRotationWindow {
+		return fmt.Errorf("rotation_window must be at least %s", minRotationWindow)
+	}
+	role.RotationSchedule = rotationSchedule
+	role.RotationWindow = rotationWindow
+	return nil
+}
+
 func getValidatedTTL(passwordConf passwordConf, fieldData *framework.FieldData) (int, error) {
 	ttl := fieldData.Get("ttl").(int)
 	if ttl == 0 {
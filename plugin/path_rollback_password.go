@@ -0,0 +1,182 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const rollbackPasswordSuffix = "/rollback-password"
+
+func (b *backend) pathRollbackPassword() *framework.Path {
+	return &framework.Path{
+		Pattern: rolePrefix + framework.GenericNameRegex("name") + rollbackPasswordSuffix + "$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "rollback",
+			OperationSuffix: "role-password",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the role",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.operationRollbackPassword,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Set a role's password back to its last password.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields:      credResponseFields(),
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    rollbackPasswordHelpSynopsis,
+		HelpDescription: rollbackPasswordHelpDescription,
+	}
+}
+
+func (b *backend) operationRollbackPassword(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if engineConf == nil {
+		return nil, errors.New("the config is currently unset")
+	}
+	if resp := responseWrappingRequired(engineConf, req); resp != nil {
+		return resp, nil
+	}
+
+	roleName := fieldData.Get("name").(string)
+
+	b.credLock.Lock()
+	defer b.credLock.Unlock()
+
+	role, err := b.readRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse("role %q does not exist", roleName), nil
+	}
+	if role.DisableRotation {
+		return errorResponseFor(errRotationDisabled)
+	}
+	if engineConf, err = configFor(ctx, req.Storage, engineConf, role.Config); err != nil {
+		return nil, err
+	}
+
+	path := fmt.Sprintf("%s/%s", storageKey, roleName)
+	entry, err := req.Storage.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	cred := make(map[string]interface{})
+	if entry != nil {
+		if err := entry.DecodeJSON(&cred); err != nil {
+			return nil, err
+		}
+	}
+	currentPassword, _ := cred["current_password"].(string)
+	lastPassword, _ := cred["last_password"].(string)
+	if currentPassword == "" || lastPassword == "" {
+		return codedErrorResponse(errCodeInvalidRequest, "role %q has no last password to roll back to", roleName), nil
+	}
+
+	lock := locksutil.LockForKey(b.rotationLocks, role.ServiceAccountName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := checkRotationPaused(ctx, req.Storage, b.now()); err != nil {
+		return errorResponseFor(err)
+	}
+
+	// Like a rotation, the rollback is written ahead in case it's interrupted.
+	walID, err := framework.PutWAL(ctx, req.Storage, rotateCredentialWAL, rotateCredentialEntry{
+		CurrentPassword:    currentPassword,
+		LastPassword:       lastPassword,
+		RoleName:           roleName,
+		ServiceAccountName: role.ServiceAccountName,
+		LastVaultRotation:  role.LastVaultRotation,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not persist WAL before rolling back the password: %s", err)
+	}
+
+	if err := b.client.UpdatePassword(engineConf.ADConf, role.ServiceAccountName, lastPassword); err != nil {
+		b.recordRoleError(ctx, req.Storage, roleName, roleErrorRotation, err)
+		return errorResponseFor(err)
+	}
+	if role.VerifyAfterRotation {
+		if err := b.verifyRotation(ctx, engineConf, role.ServiceAccountName, lastPassword); err != nil {
+			b.recordRoleError(ctx, req.Storage, roleName, roleErrorVerification, err)
+			// Put back the password Vault still has, so the account keeps working.
+			if restoreErr := b.client.UpdatePassword(engineConf.ADConf, role.ServiceAccountName, currentPassword); restoreErr != nil {
+				b.Logger().Warn("unable to restore the current password after verification failed", "role", roleName, "error", restoreErr)
+			} else if walErr := framework.DeleteWAL(ctx, req.Storage, walID); walErr != nil {
+				b.Logger().Warn("failed to delete password rollback WAL", "error", walErr.Error())
+			}
+			return nil, err
+		}
+	}
+
+	// AD now reports the password as set just now, so the rotation time is
+	// updated too, or the next read would rotate it again right away.
+	role.LastVaultRotation = b.now().UTC()
+	if err := b.writeRoleToStorage(ctx, req.Storage, roleName, role); err != nil {
+		return nil, err
+	}
+	b.roleCache.SetDefault(roleName, role)
+
+	cred["current_password"] = lastPassword
+	cred["last_password"] = currentPassword
+	entry, err = logical.StorageEntryJSON(path, cred)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	b.credCache.SetDefault(roleName, cred)
+
+	if err := framework.DeleteWAL(ctx, req.Storage, walID); err != nil {
+		// The rollback was successful, so don't return the error.
+		// The WAL will eventually be discarded by the rollback handler.
+		b.Logger().Warn("failed to delete password rollback WAL", "error", err.Error())
+	}
+	b.clearRetry(ctx, req.Storage, retryKindRole, roleName)
+	b.Logger().Info("rolled back role password", "role", roleName)
+
+	return &logical.Response{
+		Data: credResponseData(engineConf, role, cred),
+	}, nil
+}
+
+const (
+	rollbackPasswordHelpSynopsis = `
+Set a role's password back to its last password.
+`
+	rollbackPasswordHelpDescription = `
+Sets the service account's password in Active Directory back to the role's
+last_password, and swaps the stored current_password and last_password. It's
+meant for recovering when a rotation broke a consumer that can't be given the
+new password quickly.
+
+The role's ttl starts over from the rollback, so the restored password isn't
+rotated again right away. Rolling back twice restores the newer password.
+`
+)
@@ -0,0 +1,92 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestRollbackPassword(t *testing.T) {
+	directory := newMemoryDirectory()
+	b, storage := getBackend(t, directory, testConfig())
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	handle := requester(t, b, storage, "")
+
+	handle(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@example.com",
+	})
+	first := handle(logical.ReadOperation, credPrefix+"app", nil).Data["current_password"]
+
+	// There's nothing to roll back to until the password's been rotated by Vault twice.
+	if resp := handle(logical.UpdateOperation, rolePrefix+"app"+rollbackPasswordSuffix, nil); responseErrorCode(resp) != string(errCodeInvalidRequest) {
+		t.Fatalf("expected the rollback to be refused but received %#v", resp)
+	}
+
+	handle(logical.UpdateOperation, rotateRolePath+"app", nil)
+	second := handle(logical.ReadOperation, credPrefix+"app", nil).Data["current_password"]
+
+	now = now.Add(time.Minute)
+	resp := handle(logical.UpdateOperation, rolePrefix+"app"+rollbackPasswordSuffix, nil)
+	if resp == nil || resp.IsError() || resp.Data["current_password"] != first || resp.Data["last_password"] != second {
+		t.Fatalf("expected the passwords to be swapped but received %#v", resp)
+	}
+	if password := directory.account("app@example.com").password; password != first {
+		t.Fatalf("expected the last password to be set in AD but received %q", password)
+	}
+
+	// The rolled back password isn't rotated again right away.
+	resp = handle(logical.ReadOperation, credPrefix+"app", nil)
+	if resp.Data["current_password"] != first || resp.Data["last_password"] != second {
+		t.Fatalf("expected the rolled back creds but received %#v", resp.Data)
+	}
+	role := handle(logical.ReadOperation, rolePrefix+"app", nil)
+	if !role.Data["last_vault_rotation"].(time.Time).Equal(now) {
+		t.Fatalf("expected the rotation time to be updated but received %#v", role.Data["last_vault_rotation"])
+	}
+
+	if resp := handle(logical.UpdateOperation, rolePrefix+"missing"+rollbackPasswordSuffix, nil); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for a missing role but received %#v", resp)
+	}
+}
+
+func TestRollbackPasswordVerificationFails(t *testing.T) {
+	directory := &unreplicatedDirectory{memoryDirectory: newMemoryDirectory()}
+	b, storage := getBackend(t, directory, testConfig())
+	b.verifyRetryInterval = time.Millisecond
+	handle := requester(t, b, storage, "")
+
+	handle(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name":  "app@example.com",
+		"verify_after_rotation": true,
+	})
+	handle(logical.ReadOperation, credPrefix+"app", nil)
+	handle(logical.UpdateOperation, rotateRolePath+"app", nil)
+	current := handle(logical.ReadOperation, credPrefix+"app", nil).Data["current_password"]
+
+	// The last password never works, so the rollback fails and the current
+	// password is put back in AD, where it matches the stored creds.
+	directory.binds = 0
+	directory.unreplicatedBinds = verifyAttempts
+	if _, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      rolePrefix + "app" + rollbackPasswordSuffix,
+		Storage:   storage,
+	}); err == nil {
+		t.Fatal("expected the rollback to fail")
+	}
+	if password := directory.account("app@example.com").password; password != current {
+		t.Fatalf("expected the current password %q to be restored but received %q", current, password)
+	}
+	if resp := handle(logical.ReadOperation, credPrefix+"app", nil); resp.Data["current_password"] != current {
+		t.Fatalf("expected the creds to be unchanged but received %#v", resp.Data)
+	}
+	if walIDs, err := framework.ListWAL(ctx, storage); err != nil || len(walIDs) != 0 {
+		t.Fatalf("expected the rollback's WAL to be deleted but received %v, %v", walIDs, err)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func (b *backend) pathSetManageRotateAll() *framework.Path {
+	return &framework.Path{
+		Pattern: libraryPrefix + "manage/" + framework.GenericNameRegex("name") + "/rotate-all$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "rotate",
+			OperationSuffix: "library-accounts",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the set.",
+				Required:    true,
+			},
+			"include_checked_out": {
+				Type:        framework.TypeBool,
+				Description: "Also rotate the passwords of checked-out service accounts, so their borrowers' passwords stop working. They stay checked out.",
+				Default:     false,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.operationSetManageRotateAll,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Rotate the passwords of all the service accounts in a set.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"rotated": {
+								Type:        framework.TypeStringSlice,
+								Description: "The service accounts whose passwords were rotated.",
+							},
+							"skipped": {
+								Type:        framework.TypeStringSlice,
+								Description: "The checked-out service accounts that were left alone.",
+							},
+							"failed": {
+								Type:        framework.TypeMap,
+								Description: "The service accounts that couldn't be rotated, and why.",
+							},
+						},
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    rotateAllHelpSynopsis,
+		HelpDescription: rotateAllHelpDescription,
+	}
+}
+
+func (b *backend) operationSetManageRotateAll(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	setName := fieldData.Get("name").(string)
+	includeCheckedOut := fieldData.Get("include_checked_out").(bool)
+
+	set, err := readSet(ctx, req.Storage, setName)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return codedErrorResponse(errCodeSetNotFound, `%q doesn't exist`, setName), nil
+	}
+	// Fail the whole request rather than reporting every account as failed.
+	if err := checkRotationPaused(ctx, req.Storage, b.now()); err != nil {
+		return errorResponseFor(err)
+	}
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	rotatable := func(checkOut *CheckOut) bool {
+		return checkOut.IsAvailable || includeCheckedOut
+	}
+
+	rotated := make([]string, 0, len(set.ServiceAccountNames))
+	skipped := make([]string, 0)
+	failed := make(map[string]interface{})
+	for i, serviceAccountName := range set.ServiceAccountNames {
+		checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, req.Storage, serviceAccountName)
+		if err != nil {
+			failed[serviceAccountName] = err.Error()
+			continue
+		}
+		if !rotatable(checkOut) {
+			skipped = append(skipped, serviceAccountName)
+			continue
+		}
+		// The rate limit is waited for before the set is locked, so check-outs
+		// and check-ins from it aren't held up. If the request's deadline comes
+		// first, the rest would only wait longer, so they're reported as failed.
+		if err := b.checkOutHandler.throttle(ctx, engineConf); err != nil {
+			for _, remaining := range set.ServiceAccountNames[i:] {
+				failed[remaining] = err.Error()
+			}
+			break
+		}
+		// Keep going so one failing account doesn't leave the rest of the set
+		// with passwords that may be compromised.
+		ok, err := b.rotateSetAccount(ctx, req.Storage, setName, serviceAccountName, func(_ *librarySet, checkOut *CheckOut) bool {
+			return rotatable(checkOut)
+		})
+		switch {
+		case err != nil:
+			b.Logger().Error("unable to rotate service account", "set", setName, "service_account_name", serviceAccountName, "error", err)
+			failed[serviceAccountName] = err.Error()
+		case !ok:
+			skipped = append(skipped, serviceAccountName)
+		default:
+			rotated = append(rotated, serviceAccountName)
+		}
+	}
+	b.Logger().Info("rotated library set", "set", setName, "rotated", len(rotated), "skipped", len(skipped), "failed", len(failed), "entity_id", req.EntityID)
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"rotated": rotated,
+			"skipped": skipped,
+			"failed":  failed,
+		},
+	}, nil
+}
+
+// rotateSetAccount locks the set and rotates a service account's password if
+// it's still in the set and rotatable still says it should be, since either may
+// have changed while the caller waited for the rotation rate limit. It reports
+// whether the password was rotated.
+func (b *backend) rotateSetAccount(ctx context.Context, storage logical.Storage, setName, serviceAccountName string, rotatable func(*librarySet, *CheckOut) bool) (bool, error) {
+	lock := locksutil.LockForKey(b.checkOutLocks, setName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	set, err := readSet(ctx, storage, setName)
+	if err != nil {
+		return false, err
+	}
+	if set == nil || !strutil.StrListContains(set.ServiceAccountNames, serviceAccountName) {
+		return false, nil
+	}
+	checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, storage, serviceAccountName)
+	if err != nil {
+		if err == errNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	if !rotatable(set, checkOut) {
+		return false, nil
+	}
+	if _, err := b.checkOutHandler.rotatePassword(ctx, storage, serviceAccountName); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+const (
+	rotateAllHelpSynopsis = `
+Rotate the passwords of all the service accounts in a set.
+`
+	rotateAllHelpDescription = `
+Rotates the password of every checked-in service account in the set, for
+responding to a suspected compromise of the whole pool. Checked-out accounts
+are skipped unless "include_checked_out" is set, in which case they're rotated
+too and stay checked out, but their borrowers' passwords stop working.
+
+An account that can't be rotated doesn't stop the rest. The response lists the
+accounts that were rotated, skipped, and failed, with the error for each
+failure, so the failures can be retried. If rotation_rate_limit wouldn't let
+every account be rotated before the request times out, the accounts it didn't
+reach are reported as failed.
+`
+)
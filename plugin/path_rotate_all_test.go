@@ -0,0 +1,176 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+// brokenAccountDirectory refuses to update the password of broken@example.com.
+type brokenAccountDirectory struct {
+	*memoryDirectory
+}
+
+func (d *brokenAccountDirectory) UpdatePassword(conf *client.ADConf, serviceAccountName string, newPassword string) error {
+	if serviceAccountName == "broken@example.com" {
+		return errors.New("insufficient access rights")
+	}
+	return d.memoryDirectory.UpdatePassword(conf, serviceAccountName, newPassword)
+}
+
+func TestSetManageRotateAll(t *testing.T) {
+	directory := newMemoryDirectory()
+	b, storage := getBackend(t, &brokenAccountDirectory{directory}, testConfig())
+	handle := requester(t, b, storage, "borrower")
+
+	// Creating the set rotates each account's password, except for the broken
+	// one, which is why it's added afterwards.
+	handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com", "b@example.com"},
+	})
+	checkOut := handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil)
+	if checkOut == nil || checkOut.IsError() {
+		t.Fatalf("unable to check out: %#v", checkOut)
+	}
+	borrowed := checkOut.Data["service_account_name"].(string)
+	idle := "a@example.com"
+	if borrowed == idle {
+		idle = "b@example.com"
+	}
+	if err := storage.Put(ctx, &logical.StorageEntry{
+		Key:   checkoutStoragePrefix + "broken@example.com",
+		Value: []byte(`{"is_available":true}`),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	set, err := readSet(ctx, storage, "lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.ServiceAccountNames = append(set.ServiceAccountNames, "broken@example.com")
+	if err := storeSet(ctx, storage, "lib", set); err != nil {
+		t.Fatal(err)
+	}
+
+	idlePassword := directory.account(idle).password
+	resp := handle(logical.UpdateOperation, libraryPrefix+"manage/lib/rotate-all", nil)
+	if resp == nil || resp.IsError() {
+		t.Fatalf("unable to rotate the set: %#v", resp)
+	}
+	if !reflect.DeepEqual(resp.Data["rotated"], []string{idle}) || !reflect.DeepEqual(resp.Data["skipped"], []string{borrowed}) {
+		t.Fatalf("unexpected report %#v", resp.Data)
+	}
+	if failed := resp.Data["failed"].(map[string]interface{}); len(failed) != 1 || failed["broken@example.com"] != "insufficient access rights" {
+		t.Fatalf("expected the broken account's failure to be reported but received %#v", failed)
+	}
+	if directory.account(idle).password == idlePassword {
+		t.Fatal("expected the idle account's password to be rotated")
+	}
+	if directory.account(borrowed).password != checkOut.Data["password"] {
+		t.Fatal("expected the borrowed account's password to be left alone")
+	}
+
+	resp = handle(logical.UpdateOperation, libraryPrefix+"manage/lib/rotate-all", map[string]interface{}{
+		"include_checked_out": true,
+	})
+	if rotated := resp.Data["rotated"].([]string); len(rotated) != 2 {
+		t.Fatalf("expected the borrowed account to be rotated too but received %#v", resp.Data)
+	}
+	if directory.account(borrowed).password == checkOut.Data["password"] {
+		t.Fatal("expected the borrowed account's password to be rotated")
+	}
+	status := handle(logical.ReadOperation, libraryPrefix+"lib/status", nil).Data[borrowed].(map[string]interface{})
+	if status["available"] != false {
+		t.Fatalf("expected the borrowed account to stay checked out but received %#v", status)
+	}
+}
+
+func TestSetManageRotateAllRateLimited(t *testing.T) {
+	directory := &observedDirectory{memoryDirectory: newMemoryDirectory()}
+	engineConf := testConfig()
+	b, storage := getBackend(t, directory, engineConf)
+	handle := requester(t, b, storage, "borrower")
+	handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com", "b@example.com", "c@example.com"},
+	})
+	rotateAll := func(ctx context.Context) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      libraryPrefix + "manage/lib/rotate-all",
+			Storage:   storage,
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("unable to rotate the set: %#v, %v", resp, err)
+		}
+		return resp
+	}
+
+	// Only one rotation is allowed every two seconds, so the request rotates
+	// the first account and reports the rest as failed instead of waiting past
+	// its deadline.
+	engineConf.RotationRateLimit = 0.5
+	engineConf.RotationBurst = 1
+	if err := writeConfig(ctx, storage, engineConf); err != nil {
+		t.Fatal(err)
+	}
+	deadline, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	start := time.Now()
+	resp := rotateAll(deadline)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("expected the request to give up without waiting but it took %s", elapsed)
+	}
+	if !reflect.DeepEqual(resp.Data["rotated"], []string{"a@example.com"}) {
+		t.Fatalf("expected the first account to be rotated but received %#v", resp.Data)
+	}
+	if failed := resp.Data["failed"].(map[string]interface{}); len(failed) != 2 || failed["b@example.com"] == nil || failed["c@example.com"] == nil {
+		t.Fatalf("expected the accounts the rate limit didn't reach to be reported as failed but received %#v", failed)
+	}
+
+	// While the request waits for the rate limit, the set can still be checked
+	// out from.
+	engineConf.RotationRateLimit = 2
+	if err := writeConfig(ctx, storage, engineConf); err != nil {
+		t.Fatal(err)
+	}
+	// Let the first request's rotation age out of the burst.
+	time.Sleep(time.Second)
+	rotating := make(chan struct{}, 3)
+	directory.onUpdate = func() { rotating <- struct{}{} }
+	done := make(chan *logical.Response)
+	go func() {
+		resp, _ := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      libraryPrefix + "manage/lib/rotate-all",
+			Storage:   storage,
+		})
+		done <- resp
+	}()
+	<-rotating
+	checkOut := handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil)
+	select {
+	case <-done:
+		t.Fatal("expected the check-out not to wait for the rotations")
+	default:
+	}
+	if checkOut == nil || checkOut.IsError() {
+		t.Fatalf("unable to check out: %#v", checkOut)
+	}
+	resp = <-done
+	if resp == nil || resp.IsError() {
+		t.Fatalf("unable to rotate the set: %#v", resp)
+	}
+	if rotated := resp.Data["rotated"].([]string); len(rotated) != 3 {
+		t.Fatalf("expected every account to be rotated but received %#v", resp.Data)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -19,6 +20,11 @@ const (
 func (b *backend) pathRotateCredentials() *framework.Path {
 	return &framework.Path{
 		Pattern: rotateRolePath + framework.GenericNameRegex("name"),
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "rotate",
+			OperationSuffix: "role",
+		},
 		Fields: map[string]*framework.FieldSchema{
 			"name": {
 				Type:        framework.TypeString,
@@ -30,6 +36,12 @@ func (b *backend) pathRotateCredentials() *framework.Path {
 				Callback:                    b.pathRotateCredentialsUpdate,
 				ForwardPerformanceStandby:   true,
 				ForwardPerformanceSecondary: true,
+				Summary:                     "Rotate a role's password.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
 			},
 		},
 
@@ -62,6 +74,9 @@ func (b *backend) pathRotateCredentialsUpdate(ctx context.Context, req *logical.
 	if role == nil {
 		return nil, fmt.Errorf("role %s does not exist", roleName)
 	}
+	if role.DisableRotation {
+		return errorResponseFor(errRotationDisabled)
+	}
 
 	if !role.LastVaultRotation.IsZero() {
 		credIfc, found := b.credCache.Get(roleName)
@@ -92,7 +107,8 @@ func (b *backend) pathRotateCredentialsUpdate(ctx context.Context, req *logical.
 
 	_, err = b.generateAndReturnCreds(ctx, config, req.Storage, roleName, role, cred)
 	if err != nil {
-		return nil, err
+		b.enqueueRetry(ctx, req.Storage, retryKindRole, roleName, "", err)
+		return errorResponseFor(err)
 	}
 
 	return nil, nil
@@ -8,37 +8,199 @@ import (
 	"errors"
 	"fmt"
 	"math"
-	"sync/atomic"
+	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
-const rotateRootPath = "rotate-root"
+const (
+	rotateRootPath       = "rotate-root"
+	rotateRootCancelPath = rotateRootPath + "/cancel"
+	rotateRootStatusPath = rotateRootPath + "/status"
+
+	// rootRotationStatusStorageKey is where the status of the latest root
+	// rotation is stored.
+	rootRotationStatusStorageKey = "root-rotation-status"
+)
+
+// The states a root rotation can be in.
+const (
+	rootRotationRunning     = "running"
+	rootRotationSucceeded   = "succeeded"
+	rootRotationFailed      = "failed"
+	rootRotationCanceled    = "canceled"
+	rootRotationInterrupted = "interrupted"
+)
+
+// rootRotationStatus is the progress of a root rotation, so operators can
+// follow one that was started asynchronously.
+type rootRotationStatus struct {
+	ID          string    `json:"id"`
+	Status      string    `json:"status"`
+	Stage       string    `json:"stage,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+func rootRotationFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"job_id": {
+			Type:        framework.TypeString,
+			Description: "The ID of the root rotation.",
+		},
+		"status": {
+			Type:        framework.TypeString,
+			Description: "Whether the rotation is running, succeeded, failed, was canceled, or was interrupted by the plugin stopping.",
+		},
+		"stage": {
+			Type:        framework.TypeString,
+			Description: "What a running rotation is doing: changing the password in AD, storing it, or rolling it back.",
+		},
+		"started_at": {
+			Type:        framework.TypeTime,
+			Description: "When the rotation started.",
+		},
+		"completed_at": {
+			Type:        framework.TypeTime,
+			Description: "When the rotation finished, if it has.",
+		},
+		"last_error": {
+			Type:        framework.TypeString,
+			Description: "Why the rotation failed, if it did.",
+		},
+	}
+}
 
 func (b *backend) pathRotateRootCredentials() *framework.Path {
 	return &framework.Path{
 		Pattern: rotateRootPath,
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "rotate",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"async": {
+				Type:        framework.TypeBool,
+				Description: "Return a job ID right away and rotate the password in the background, instead of holding the request open until it's done. Its progress is at rotate-root/status.",
+				Default:     false,
+			},
+		},
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.ReadOperation: &framework.PathOperation{
 				Callback:                    b.pathRotateRootCredentialsUpdate,
 				ForwardPerformanceStandby:   true,
 				ForwardPerformanceSecondary: true,
+				Summary:                     "Rotate the bind password.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationSuffix: "root-credentials-with-read",
+				},
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
 			},
 			logical.UpdateOperation: &framework.PathOperation{
 				Callback:                    b.pathRotateRootCredentialsUpdate,
 				ForwardPerformanceStandby:   true,
 				ForwardPerformanceSecondary: true,
+				Summary:                     "Rotate the bind password.",
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationSuffix: "root-credentials",
+				},
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields:      rootRotationFields(),
+					}},
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
 			},
 		},
 
-		HelpSynopsis:    pathRotateCredentialsUpdateHelpSyn,
-		HelpDescription: pathRotateCredentialsUpdateHelpDesc,
+		HelpSynopsis:    pathRotateRootCredentialsUpdateHelpSyn,
+		HelpDescription: pathRotateRootCredentialsUpdateHelpDesc,
 	}
 }
 
-func (b *backend) pathRotateRootCredentialsUpdate(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+func (b *backend) pathRotateRootStatus() *framework.Path {
+	return &framework.Path{
+		Pattern: rotateRootStatusPath + "$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "read",
+			OperationSuffix: "root-rotation-status",
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathRotateRootStatusRead,
+				// Only the active node knows whether a rotation is still running.
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Report the progress of the latest root rotation.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields:      rootRotationFields(),
+					}},
+				},
+			},
+		},
+
+		HelpSynopsis:    pathRotateRootStatusHelpSyn,
+		HelpDescription: pathRotateRootStatusHelpDesc,
+	}
+}
+
+func (b *backend) pathRotateRootCancel() *framework.Path {
+	return &framework.Path{
+		Pattern: rotateRootCancelPath + "$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "cancel",
+			OperationSuffix: "root-rotation",
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.pathRotateRootCancelUpdate,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Cancel a stuck root rotation so another can start.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"canceled": {
+								Type:        framework.TypeBool,
+								Description: "Whether a root rotation was in progress and was canceled.",
+							},
+							"job_id": {
+								Type:        framework.TypeString,
+								Description: "The ID of the canceled root rotation.",
+							},
+							"started_at": {
+								Type:        framework.TypeTime,
+								Description: "When the canceled root rotation started.",
+							},
+						},
+					}},
+				},
+			},
+		},
+
+		HelpSynopsis:    pathRotateRootCancelHelpSyn,
+		HelpDescription: pathRotateRootCancelHelpDesc,
+	}
+}
+
+func (b *backend) pathRotateRootCredentialsUpdate(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
 	engineConf, err := readConfig(ctx, req.Storage)
 	if err != nil {
 		return nil, err
@@ -46,40 +208,309 @@ func (b *backend) pathRotateRootCredentialsUpdate(ctx context.Context, req *logi
 	if engineConf == nil {
 		return nil, errors.New("the config is currently unset")
 	}
+	if engineConf.ADConf.BindsWithKerberos() {
+		return codedErrorResponse(errCodeInvalidRequest, "there's no root password to rotate, since Vault binds to AD with bind_keytab"), nil
+	}
+	if engineConf.ADConf.BindsWithClientCertificate() {
+		return codedErrorResponse(errCodeInvalidRequest, "there's no root password to rotate, since Vault binds to AD with client_tls_cert"), nil
+	}
+	if err := checkRotationPaused(ctx, req.Storage, b.now()); err != nil {
+		return errorResponseFor(err)
+	}
 
 	newPassword, err := GeneratePassword(ctx, engineConf.PasswordConf, b.System())
 	if err != nil {
 		return nil, err
 	}
-	oldPassword := engineConf.ADConf.BindPassword
 
-	if !atomic.CompareAndSwapInt32(b.rotateRootLock, 0, 1) {
+	// An asynchronous rotation outlives the request, so it's only canceled
+	// when the backend is cleaned up or rotate-root/cancel is called.
+	async := fieldData.Get("async").(bool)
+	parentCtx := ctx
+	if async {
+		parentCtx = b.bgCtx
+	}
+	rotation, rotationCtx := b.startRootRotation(parentCtx)
+	if rotation == nil {
 		resp := &logical.Response{}
-		resp.AddWarning("Root password rotation is already in progress.")
+		resp.AddWarning("Root password rotation is already in progress, or a canceled one is still waiting for AD. Its progress is at rotate-root/status.")
 		return resp, nil
 	}
-	defer atomic.CompareAndSwapInt32(b.rotateRootLock, 1, 0)
+	status := &rootRotationStatus{
+		ID:        rotation.id,
+		Status:    rootRotationRunning,
+		Stage:     "changing password",
+		StartedAt: rotation.startedAt,
+	}
+	if err := writeRootRotationStatus(ctx, req.Storage, status); err != nil {
+		b.endRootRotation(rotation)
+		return nil, err
+	}
+
+	if !async {
+		defer b.endRootRotation(rotation)
+		resp, err := b.rotateRoot(ctx, rotationCtx, req.Storage, engineConf, newPassword, status)
+		b.finishRootRotation(ctx, req.Storage, status, rotationCtx, resp, err)
+		return resp, err
+	}
+
+	// The response is built first, since the rotation updates the status as it goes.
+	resp := &logical.Response{Data: status.responseData()}
+	b.bgWG.Add(1)
+	go func() {
+		defer b.bgWG.Done()
+		defer b.endRootRotation(rotation)
+		resp, err := b.rotateRoot(b.bgCtx, rotationCtx, req.Storage, engineConf, newPassword, status)
+		b.finishRootRotation(b.bgCtx, req.Storage, status, rotationCtx, resp, err)
+	}()
+	return resp, nil
+}
+
+// rotateRoot changes the bind password in AD and stores it, recording its
+// stage in the status as it goes. Stored state is read and written with ctx,
+// while rotationCtx is canceled if the rotation is.
+func (b *backend) rotateRoot(ctx, rotationCtx context.Context, storage logical.Storage, engineConf *configuration, newPassword string, status *rootRotationStatus) (*logical.Response, error) {
+	oldPassword := engineConf.ADConf.BindPassword
 
 	// Update the password remotely.
 	if err := b.client.UpdateRootPassword(engineConf.ADConf, engineConf.ADConf.BindDN, newPassword); err != nil {
-		return nil, err
+		return errorResponseFor(err)
+	}
+	if rotationCtx.Err() != nil {
+		// The rotation was canceled while AD was changing the password, but AD
+		// has it now, so it's still stored. The config is read again in case it
+		// was changed in the meantime.
+		b.Logger().Warn("storing the bind password of a canceled root rotation because AD accepted it")
+		var err error
+		if engineConf, err = readConfig(ctx, storage); err != nil {
+			return nil, err
+		}
+		if engineConf == nil {
+			return nil, errors.New("the config is currently unset")
+		}
+		oldPassword = engineConf.ADConf.BindPassword
 	}
+	// The old password is still tried for a while, in case a domain controller
+	// hasn't seen the change yet.
+	engineConf.ADConf.LastBindPassword = oldPassword
+	engineConf.ADConf.LastBindPasswordRotation = b.now()
 	engineConf.ADConf.BindPassword = newPassword
 
 	// Update the password locally.
-	if pwdStoringErr := writeConfig(ctx, req.Storage, engineConf); pwdStoringErr != nil {
+	b.setRootRotationStage(ctx, storage, status, "storing password")
+	if pwdStoringErr := writeConfig(ctx, storage, engineConf); pwdStoringErr != nil {
 		// We were unable to store the new password locally. We can't continue in this state because we won't be able
 		// to roll any passwords, including our own to get back into a state of working. So, we need to roll back to
 		// the last password we successfully got into storage.
-		if rollbackErr := b.rollBackRootPassword(ctx, engineConf, oldPassword); rollbackErr != nil {
+		b.setRootRotationStage(ctx, storage, status, "rolling back password")
+		if rollbackErr := b.rollBackRootPassword(rotationCtx, engineConf, oldPassword); rollbackErr != nil {
 			return nil, fmt.Errorf("unable to store new password due to %s and unable to return to previous password due to %s, configure a new binddn and bindpass to restore active directory function", pwdStoringErr, rollbackErr)
 		}
 		return nil, fmt.Errorf("unable to update password due to storage err: %s", pwdStoringErr)
 	}
+	b.usage.rotated(ctx, storage, b.now())
 	// Respond with a 204.
 	return nil, nil
 }
 
+// setRootRotationStage records what a running root rotation is doing. Failing
+// to record it is only logged, since the rotation matters more than its status.
+func (b *backend) setRootRotationStage(ctx context.Context, storage logical.Storage, status *rootRotationStatus, stage string) {
+	status.Stage = stage
+	if !b.rootRotationRunning(status.ID) {
+		// It was canceled, which rotate-root/cancel already recorded.
+		return
+	}
+	if err := writeRootRotationStatus(ctx, storage, status); err != nil {
+		b.Logger().Warn("unable to record the stage of the root rotation", "job_id", status.ID, "stage", stage, "error", err)
+	}
+}
+
+// finishRootRotation records how a root rotation ended, given what rotateRoot returned.
+func (b *backend) finishRootRotation(ctx context.Context, storage logical.Storage, status *rootRotationStatus, rotationCtx context.Context, resp *logical.Response, err error) {
+	status.Stage = ""
+	status.CompletedAt = b.now().UTC()
+	switch {
+	case err != nil:
+		status.Status = rootRotationFailed
+		status.LastError = err.Error()
+	case resp != nil && resp.IsError():
+		status.Status = rootRotationFailed
+		status.LastError = resp.Error().Error()
+	case rotationCtx.Err() != nil:
+		// It was canceled, though AD accepted the password and it was stored.
+		status.Status = rootRotationCanceled
+	default:
+		status.Status = rootRotationSucceeded
+	}
+	if status.Status == rootRotationFailed {
+		b.Logger().Error("root password rotation failed", "job_id", status.ID, "error", status.LastError)
+	}
+	// A canceled rotation can finish after another has started, and mustn't
+	// replace that one's status.
+	if latest, err := readRootRotationStatus(ctx, storage); err == nil && latest != nil && latest.ID != status.ID {
+		return
+	}
+	if err := writeRootRotationStatus(ctx, storage, status); err != nil {
+		b.Logger().Warn("unable to record the outcome of the root rotation", "job_id", status.ID, "status", status.Status, "error", err)
+	}
+}
+
+func readRootRotationStatus(ctx context.Context, storage logical.Storage) (*rootRotationStatus, error) {
+	entry, err := storage.Get(ctx, rootRotationStatusStorageKey)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	status := &rootRotationStatus{}
+	if err := entry.DecodeJSON(status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func writeRootRotationStatus(ctx context.Context, storage logical.Storage, status *rootRotationStatus) error {
+	entry, err := logical.StorageEntryJSON(rootRotationStatusStorageKey, status)
+	if err != nil {
+		return err
+	}
+	return storage.Put(ctx, entry)
+}
+
+func (s *rootRotationStatus) responseData() map[string]interface{} {
+	data := map[string]interface{}{
+		"job_id":     s.ID,
+		"status":     s.Status,
+		"started_at": s.StartedAt,
+	}
+	if s.Stage != "" {
+		data["stage"] = s.Stage
+	}
+	if !s.CompletedAt.IsZero() {
+		data["completed_at"] = s.CompletedAt
+	}
+	if s.LastError != "" {
+		data["last_error"] = s.LastError
+	}
+	return data
+}
+
+func (b *backend) pathRotateRootStatusRead(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	status, err := readRootRotationStatus(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if status == nil {
+		return nil, nil
+	}
+	if status.Status == rootRotationRunning && !b.rootRotationRunning(status.ID) {
+		// The rotation was recorded as running, but the plugin stopped or the
+		// rotation was canceled before it could record how it ended.
+		status.Status = rootRotationInterrupted
+		status.Stage = ""
+	}
+	return &logical.Response{Data: status.responseData()}, nil
+}
+
+// rootRotation is a root rotation in progress.
+type rootRotation struct {
+	id        string
+	startedAt time.Time
+	cancel    context.CancelFunc
+}
+
+// startRootRotation records that a root rotation is starting, and returns it
+// along with a context that's canceled if it's canceled. It returns nil if
+// another root rotation is already in progress, or a canceled one hasn't
+// returned, since AD could still accept its password after this one's.
+func (b *backend) startRootRotation(ctx context.Context) (*rootRotation, context.Context) {
+	b.rotateRootLock.Lock()
+	defer b.rotateRootLock.Unlock()
+	if b.rootRotation != nil || b.canceledRootRotation != nil {
+		return nil, nil
+	}
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		// The ID only tells rotations apart, so the start time will do.
+		id = strconv.FormatInt(b.now().UnixNano(), 10)
+	}
+	rotationCtx, cancel := context.WithCancel(ctx)
+	b.rootRotation = &rootRotation{id: id, startedAt: b.now().UTC(), cancel: cancel}
+	return b.rootRotation, rotationCtx
+}
+
+// rootRotationRunning reports whether the root rotation with the ID is still
+// in progress.
+func (b *backend) rootRotationRunning(id string) bool {
+	b.rotateRootLock.Lock()
+	defer b.rotateRootLock.Unlock()
+	return b.rootRotation != nil && b.rootRotation.id == id
+}
+
+// endRootRotation records that the root rotation is over, whether or not it
+// was canceled.
+func (b *backend) endRootRotation(rotation *rootRotation) {
+	b.rotateRootLock.Lock()
+	defer b.rotateRootLock.Unlock()
+	rotation.cancel()
+	if b.rootRotation == rotation {
+		b.rootRotation = nil
+	}
+	if b.canceledRootRotation == rotation {
+		b.canceledRootRotation = nil
+	}
+}
+
+// cancelRootRotation cancels the root rotation in progress and returns it. It
+// returns nil if none is in progress. Another rotation can start once the
+// canceled one returns, since changing the password in AD can't be stopped
+// partway, and only retrying a rollback stops right away.
+func (b *backend) cancelRootRotation() *rootRotation {
+	b.rotateRootLock.Lock()
+	defer b.rotateRootLock.Unlock()
+	rotation := b.rootRotation
+	if rotation != nil {
+		rotation.cancel()
+		b.rootRotation = nil
+		b.canceledRootRotation = rotation
+	}
+	return rotation
+}
+
+func (b *backend) pathRotateRootCancelUpdate(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	rotation := b.cancelRootRotation()
+	if rotation == nil {
+		resp := &logical.Response{
+			Data: map[string]interface{}{
+				"canceled": false,
+			},
+		}
+		resp.AddWarning("No root password rotation is in progress.")
+		return resp, nil
+	}
+	b.Logger().Warn("root password rotation canceled", "job_id", rotation.id, "started_at", rotation.startedAt)
+	status, err := readRootRotationStatus(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if status != nil && status.ID == rotation.id {
+		status.Status = rootRotationCanceled
+		status.Stage = ""
+		if err := writeRootRotationStatus(ctx, req.Storage, status); err != nil {
+			return nil, err
+		}
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"canceled":   true,
+			"job_id":     rotation.id,
+			"started_at": rotation.startedAt,
+		},
+	}, nil
+}
+
 // rollBackPassword uses naive exponential backoff to retry updating to an old password,
 // because Active Directory may still be propagating the previous password change.
 func (b *backend) rollBackRootPassword(ctx context.Context, engineConf *configuration, oldPassword string) error {
@@ -108,4 +539,38 @@ Request to rotate the root credentials.
 
 const pathRotateRootCredentialsUpdateHelpDesc = `
 This path attempts to rotate the root credentials. 
+
+If async is set, it returns a job ID right away and rotates the password in the
+background. Its progress can be read from rotate-root/status.
+`
+
+const pathRotateRootStatusHelpSyn = `
+Report the progress of the latest root rotation.
+`
+
+const pathRotateRootStatusHelpDesc = `
+Returns the job ID of the latest root rotation, whether it's running,
+succeeded, failed, or was canceled, what it's doing if it's still running, when
+it started and finished, and why it failed if it did. Poll it after calling
+rotate-root with async set, instead of holding the request open while AD
+changes the password.
+
+A rotation that was running when the plugin stopped is reported as
+interrupted. Check that the bind password still works before rotating again.
+`
+
+const pathRotateRootCancelHelpSyn = `
+Cancel a root rotation that's stuck.
+`
+
+const pathRotateRootCancelHelpDesc = `
+Only one root rotation runs at a time. If one hangs, like when AD becomes
+unreachable while a failed rotation is being rolled back, this cancels it so
+another can start without restarting the plugin. Retrying the rollback stops
+right away.
+
+If AD is still changing the password when the rotation is canceled, another
+rotation can't start until AD answers, so the two can't race. If AD accepts the
+new password afterwards, the password is still stored so Vault doesn't lose
+track of it.
 `
@@ -9,6 +9,7 @@ import (
 
 	"github.com/go-errors/errors"
 	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+	"github.com/hashicorp/vault/sdk/logical"
 
 	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
 )
@@ -98,3 +99,152 @@ func (f *badFake) UpdatePassword(conf *client.ADConf, serviceAccountName string,
 func (f *badFake) UpdateRootPassword(conf *client.ADConf, bindDN string, newPassword string) error {
 	return errors.New("nope")
 }
+
+// hangingDirectory blocks changes to the bind password until release is
+// closed, if it's set, and signals started when they begin.
+type hangingDirectory struct {
+	*memoryDirectory
+	started chan struct{}
+	release chan struct{}
+}
+
+func (d *hangingDirectory) UpdateRootPassword(conf *client.ADConf, bindDN string, newPassword string) error {
+	release := d.release
+	if release != nil {
+		d.started <- struct{}{}
+		<-release
+	}
+	return d.memoryDirectory.UpdateRootPassword(conf, bindDN, newPassword)
+}
+
+func TestCancelRootRotation(t *testing.T) {
+	directory := &hangingDirectory{
+		memoryDirectory: newMemoryDirectory(),
+		started:         make(chan struct{}),
+		release:         make(chan struct{}),
+	}
+	config := testConfig()
+	config.ADConf.BindDN = "cats"
+	config.ADConf.BindPassword = "dogs"
+	b, storage := getBackend(t, directory, config)
+	handle := func(path string) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   storage,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Errorf("unexpected error: %#v, %v", resp, err)
+		}
+		return resp
+	}
+
+	stuck := make(chan struct{})
+	go func() {
+		defer close(stuck)
+		handle(rotateRootPath)
+	}()
+	<-directory.started
+	if resp := handle(rotateRootPath); resp == nil || len(resp.Warnings) != 1 {
+		t.Fatalf("expected a warning that a rotation is in progress but received %#v", resp)
+	}
+
+	resp := handle(rotateRootCancelPath)
+	if resp.Data["canceled"] != true || resp.Data["started_at"] == nil {
+		t.Fatalf("expected the rotation to be canceled but received %#v", resp.Data)
+	}
+
+	// Another rotation can't start while AD may still accept the canceled
+	// rotation's password.
+	if resp := handle(rotateRootPath); resp == nil || len(resp.Warnings) != 1 {
+		t.Fatalf("expected a warning that the canceled rotation is waiting but received %#v", resp)
+	}
+
+	// If AD accepts the canceled rotation's password after all, it's stored so
+	// Vault still knows the bind password.
+	release := directory.release
+	directory.release = nil
+	close(release)
+	<-stuck
+	conf, err := readConfig(ctx, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := directory.VerifyPassword(nil, "cats", conf.ADConf.BindPassword); err != nil {
+		t.Fatal("expected the stored bind password to be the one in AD")
+	}
+
+	// Once it has returned, another rotation can start.
+	if resp := handle(rotateRootPath); resp != nil {
+		t.Fatalf("expected the rotation to succeed but received %#v", resp)
+	}
+	if conf, err = readConfig(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+	if err := directory.VerifyPassword(nil, "cats", conf.ADConf.BindPassword); err != nil {
+		t.Fatal("expected the stored bind password to be the one in AD")
+	}
+
+	if resp := handle(rotateRootCancelPath); resp.Data["canceled"] != false {
+		t.Fatalf("expected nothing to cancel but received %#v", resp.Data)
+	}
+}
+
+func TestAsyncRootRotation(t *testing.T) {
+	directory := &hangingDirectory{
+		memoryDirectory: newMemoryDirectory(),
+		started:         make(chan struct{}),
+		release:         make(chan struct{}),
+	}
+	config := testConfig()
+	config.ADConf.BindDN = "cats"
+	config.ADConf.BindPassword = "dogs"
+	b, storage := getBackend(t, directory, config)
+	handle := succeedingRequester(t, b, storage, "")
+
+	if resp := handle(logical.ReadOperation, rotateRootStatusPath, nil); resp != nil {
+		t.Fatalf("expected no status before any rotation but received %#v", resp)
+	}
+
+	// The job ID is returned while AD is still changing the password.
+	resp := handle(logical.UpdateOperation, rotateRootPath, map[string]interface{}{"async": true})
+	jobID, _ := resp.Data["job_id"].(string)
+	if jobID == "" || resp.Data["status"] != rootRotationRunning {
+		t.Fatalf("expected a running job but received %#v", resp.Data)
+	}
+	<-directory.started
+	resp = handle(logical.ReadOperation, rotateRootStatusPath, nil)
+	if resp.Data["job_id"] != jobID || resp.Data["status"] != rootRotationRunning || resp.Data["stage"] != "changing password" {
+		t.Fatalf("expected the rotation to be changing the password but received %#v", resp.Data)
+	}
+
+	close(directory.release)
+	b.bgWG.Wait()
+	resp = handle(logical.ReadOperation, rotateRootStatusPath, nil)
+	if resp.Data["job_id"] != jobID || resp.Data["status"] != rootRotationSucceeded || resp.Data["completed_at"] == nil {
+		t.Fatalf("expected the rotation to have succeeded but received %#v", resp.Data)
+	}
+	conf, err := readConfig(ctx, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.ADConf.BindPassword == "dogs" {
+		t.Fatal("expected the bind password to be rotated")
+	}
+
+	// A rotation recorded as running that the plugin doesn't know of was cut
+	// short, like by a restart.
+	if err := writeRootRotationStatus(ctx, storage, &rootRotationStatus{
+		ID:        "lost",
+		Status:    rootRotationRunning,
+		Stage:     "storing password",
+		StartedAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	resp = handle(logical.ReadOperation, rotateRootStatusPath, nil)
+	if resp.Data["status"] != rootRotationInterrupted || resp.Data["stage"] != nil {
+		t.Fatalf("expected the rotation to be interrupted but received %#v", resp.Data)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	rotationPausePath  = "rotation/pause"
+	rotationResumePath = "rotation/resume"
+
+	rotationPauseStorageKey = "rotation-pause"
+
+	defaultRotationPauseTTL = time.Hour
+)
+
+// rotationPause suspends every password change until it expires or rotation is resumed.
+type rotationPause struct {
+	Until  time.Time `json:"until"`
+	Reason string    `json:"reason"`
+}
+
+// rotationPausedError is returned instead of changing a password while rotation is paused.
+type rotationPausedError struct {
+	Until time.Time
+}
+
+func (e *rotationPausedError) Error() string {
+	return fmt.Sprintf("password rotation is paused until %s", e.Until.Format(time.RFC3339))
+}
+
+func (b *backend) pathRotationPause() *framework.Path {
+	return &framework.Path{
+		Pattern: rotationPausePath + "$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationSuffix: "rotation",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "In seconds, how long to pause rotation for before it resumes on its own. Defaults to 1 hour.",
+				Default:     int(defaultRotationPauseTTL.Seconds()),
+			},
+			"reason": {
+				Type:        framework.TypeString,
+				Description: "Why rotation is paused, for whoever finds it paused.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.operationRotationPause,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationVerb: "pause",
+				},
+				Summary: "Suspend every password change until the pause expires or rotation is resumed.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields:      rotationPauseResponseFields(),
+					}},
+				},
+			},
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.operationRotationPauseRead,
+				DisplayAttrs: &framework.DisplayAttributes{
+					OperationVerb:   "read",
+					OperationSuffix: "rotation-pause",
+				},
+				Summary: "Report whether password rotation is paused.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields:      rotationPauseResponseFields(),
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    rotationPauseHelpSynopsis,
+		HelpDescription: rotationPauseHelpDescription,
+	}
+}
+
+func (b *backend) pathRotationResume() *framework.Path {
+	return &framework.Path{
+		Pattern: rotationResumePath + "$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "resume",
+			OperationSuffix: "rotation",
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.operationRotationResume,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Resume password rotation before the pause expires.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    rotationPauseHelpSynopsis,
+		HelpDescription: rotationPauseHelpDescription,
+	}
+}
+
+func rotationPauseResponseFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"paused": {
+			Type:        framework.TypeBool,
+			Description: "Whether password rotation is paused.",
+		},
+		"until": {
+			Type:        framework.TypeTime,
+			Description: "When the pause expires, if rotation is paused.",
+		},
+		"reason": {
+			Type:        framework.TypeString,
+			Description: "Why rotation is paused, if it is.",
+		},
+	}
+}
+
+func (b *backend) operationRotationPause(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	ttl := time.Duration(fieldData.Get("ttl").(int)) * time.Second
+	if ttl <= 0 {
+		return codedErrorResponse(errCodeInvalidRequest, "ttl must be positive"), nil
+	}
+	pause := &rotationPause{
+		Until:  b.now().Add(ttl),
+		Reason: fieldData.Get("reason").(string),
+	}
+	entry, err := logical.StorageEntryJSON(rotationPauseStorageKey, pause)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	b.Logger().Warn("password rotation paused", "until", pause.Until, "reason", pause.Reason)
+	return &logical.Response{
+		Data: pause.Map(),
+	}, nil
+}
+
+func (b *backend) operationRotationPauseRead(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	pause, err := activeRotationPause(ctx, req.Storage, b.now())
+	if err != nil {
+		return nil, err
+	}
+	if pause == nil {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"paused": false,
+			},
+		}, nil
+	}
+	return &logical.Response{
+		Data: pause.Map(),
+	}, nil
+}
+
+func (b *backend) operationRotationResume(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete(ctx, rotationPauseStorageKey); err != nil {
+		return nil, err
+	}
+	b.Logger().Info("password rotation resumed")
+	return nil, nil
+}
+
+func (p *rotationPause) Map() map[string]interface{} {
+	return map[string]interface{}{
+		"paused": true,
+		"until":  p.Until,
+		"reason": p.Reason,
+	}
+}
+
+// activeRotationPause returns the pause in effect at now, or nil if rotation isn't paused.
+func activeRotationPause(ctx context.Context, storage logical.Storage, now time.Time) (*rotationPause, error) {
+	entry, err := storage.Get(ctx, rotationPauseStorageKey)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	pause := &rotationPause{}
+	if err := entry.DecodeJSON(pause); err != nil {
+		return nil, err
+	}
+	if !now.Before(pause.Until) {
+		return nil, nil
+	}
+	return pause, nil
+}
+
+// checkRotationPaused returns a *rotationPausedError if rotation is paused at now.
+func checkRotationPaused(ctx context.Context, storage logical.Storage, now time.Time) error {
+	pause, err := activeRotationPause(ctx, storage, now)
+	if err != nil {
+		return err
+	}
+	if pause != nil {
+		return &rotationPausedError{Until: pause.Until}
+	}
+	return nil
+}
+
+const (
+	rotationPauseHelpSynopsis = `
+Temporarily suspend every password change.
+`
+	rotationPauseHelpDescription = `
+While rotation is paused, no password is changed in Active Directory: not by
+rotate-role or rotate-root, not when a role's creds are due for rotation, not
+when a library account is checked in, and not in the background. It's meant for
+emergencies, like when domain controllers aren't replicating.
+
+Reading a role's creds returns the current password even if it's due for
+rotation. Check-ins fail, so the account stays checked out, and revoking its
+lease is retried by Vault until rotation resumes.
+
+A pause expires after its ttl so rotation can't be left off by mistake. Write
+to "rotation/resume" to resume it sooner.
+`
+)
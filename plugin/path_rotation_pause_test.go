@@ -0,0 +1,71 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestRotationPause(t *testing.T) {
+	config := testConfig()
+	config.PasswordConf.TTL = int(time.Hour.Seconds())
+	config.PasswordConf.MaxTTL = int(24 * time.Hour.Seconds())
+	config.ADConf.UserDN = "OU=Service Accounts,DC=example,DC=com"
+	config.ADConf.DevMode = true
+	b, storage := getBackend(t, newDevModeClient(&fakeSecretsClient{}), config)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	request := requester(t, b, storage, "")
+	readPassword := func() (string, *logical.Response) {
+		t.Helper()
+		resp := request(logical.ReadOperation, "creds/app", nil)
+		if resp == nil || resp.IsError() {
+			t.Fatalf("unable to read creds: %#v", resp)
+		}
+		return resp.Data["current_password"].(string), resp
+	}
+
+	if resp := request(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@example.com",
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to create role: %#v", resp)
+	}
+	password, _ := readPassword()
+
+	if resp := request(logical.UpdateOperation, rotationPausePath, map[string]interface{}{
+		"ttl":    "2h",
+		"reason": "DCs aren't replicating",
+	}); resp == nil || resp.IsError() || resp.Data["paused"] != true {
+		t.Fatalf("unable to pause rotation: %#v", resp)
+	}
+
+	// The creds are due for rotation, but the current password is returned instead.
+	now = now.Add(90 * time.Minute)
+	if paused, resp := readPassword(); paused != password || len(resp.Warnings) == 0 {
+		t.Fatalf("expected the current password with a warning but received %#v", resp)
+	}
+	resp := request(logical.UpdateOperation, rotateRolePath+"app", nil)
+	if resp == nil || !resp.IsError() || resp.Data["data"].(map[string]interface{})["error_code"] != string(errCodeRotationPaused) {
+		t.Fatalf("expected rotate-role to be rejected while paused but received %#v", resp)
+	}
+
+	// The pause expires on its own.
+	now = now.Add(time.Hour)
+	if resp := request(logical.ReadOperation, rotationPausePath, nil); resp.Data["paused"] != false {
+		t.Fatalf("expected the pause to have expired but received %#v", resp)
+	}
+	if rotated, _ := readPassword(); rotated == password {
+		t.Fatal("expected the password to be rotated once the pause expired")
+	}
+
+	// Resuming ends a pause early.
+	request(logical.UpdateOperation, rotationPausePath, nil)
+	request(logical.UpdateOperation, rotationResumePath, nil)
+	if resp := request(logical.UpdateOperation, rotateRolePath+"app", nil); resp != nil && resp.IsError() {
+		t.Fatalf("expected rotate-role to succeed once rotation resumed but received %#v", resp)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func (b *backend) pathSetManageSetPassword() *framework.Path {
+	return &framework.Path{
+		Pattern: libraryPrefix + "manage/" + framework.GenericNameRegex("name") + "/set-password$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "set",
+			OperationSuffix: "library-account-password",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeLowerCaseString,
+				Description: "Name of the set.",
+				Required:    true,
+			},
+			"service_account_name": {
+				Type:        framework.TypeString,
+				Description: "The username/logon name of the service account whose password to set.",
+				Required:    true,
+			},
+			"password": {
+				Type:        framework.TypeString,
+				Description: "The password to set. It's set as is, without checking it against the config's password policy.",
+				Required:    true,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Sensitive: true,
+				},
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.operationSetManageSetPassword,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Set a library account's password to a known value in an emergency.",
+				Responses: map[int][]framework.Response{
+					http.StatusNoContent: {{
+						Description: "No Content",
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    setPasswordHelpSynopsis,
+		HelpDescription: setPasswordHelpDescription,
+	}
+}
+
+func (b *backend) operationSetManageSetPassword(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	setName := fieldData.Get("name").(string)
+	requestedName := fieldData.Get("service_account_name").(string)
+	if requestedName == "" {
+		return codedErrorResponse(errCodeInvalidRequest, `"service_account_name" must be provided`), nil
+	}
+	password := fieldData.Get("password").(string)
+	if password == "" {
+		return codedErrorResponse(errCodeInvalidRequest, `"password" must be provided`), nil
+	}
+
+	lock := locksutil.LockForKey(b.checkOutLocks, setName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	set, err := readSet(ctx, req.Storage, setName)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return codedErrorResponse(errCodeSetNotFound, `%q doesn't exist`, setName), nil
+	}
+	// The set's spelling is used, since its storage entries are keyed by it.
+	serviceAccountName := findServiceAccountName(set.ServiceAccountNames, requestedName)
+	if serviceAccountName == "" {
+		return codedErrorResponse(errCodeInvalidRequest, "%q isn't managed by %q", requestedName, setName), nil
+	}
+
+	engineConf, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if engineConf == nil {
+		return nil, errors.New("the config is currently unset")
+	}
+	if engineConf, err = configFor(ctx, req.Storage, engineConf, set.Config); err != nil {
+		return nil, err
+	}
+
+	rotationLock := locksutil.LockForKey(b.rotationLocks, serviceAccountName)
+	rotationLock.Lock()
+	defer rotationLock.Unlock()
+
+	if err := checkRotationPaused(ctx, req.Storage, b.now()); err != nil {
+		return errorResponseFor(err)
+	}
+
+	// The password is encrypted before it's set in AD, so if Transit is down
+	// nothing is changed.
+	sealed, err := sealPassword(ctx, b.transit, engineConf, &storedPassword{
+		Password:         password,
+		ExternallySet:    true,
+		SetByEntityID:    req.EntityID,
+		SetByDisplayName: req.DisplayName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Like a check-in, if we crash after updating AD the WAL lets us finish
+	// storing the password, though without recording who set it. It holds the
+	// password the way it'll be stored, so it's encrypted if that is.
+	walID, err := framework.PutWAL(ctx, req.Storage, checkInWAL, checkInEntry{
+		ServiceAccountName: serviceAccountName,
+		Password:           sealed.Password,
+		Ciphertext:         sealed.Ciphertext,
+		TransitKey:         sealed.TransitKey,
+		RotatedAt:          b.now().UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not persist WAL before setting the password: %w", err)
+	}
+	if err := b.client.UpdatePassword(engineConf.ADConf, serviceAccountName, password); err != nil {
+		// AD refused the password, so the rollback mustn't set it later.
+		_ = framework.DeleteWAL(ctx, req.Storage, walID)
+		return errorResponseFor(err)
+	}
+	sealed.LastRotated = b.now().UTC()
+	if err := writePassword(ctx, req.Storage, serviceAccountName, sealed); err != nil {
+		return nil, err
+	}
+	_ = framework.DeleteWAL(ctx, req.Storage, walID)
+
+	b.Logger().Warn("library account password set externally", "set", setName, "service_account_name", serviceAccountName, "entity_id", req.EntityID, "display_name", req.DisplayName)
+	return nil, nil
+}
+
+const (
+	setPasswordHelpSynopsis = `
+Set a library account's password to a known value.
+`
+	setPasswordHelpDescription = `
+Sets a service account's password in Active Directory to the one provided, and
+stores it as the account's current password, for emergencies where a known
+password must be coordinated out-of-band. It's meant to be allowed only to
+administrators, like the other manage paths.
+
+The set's status reports the password as externally set, and who set it, until
+Vault rotates the password again when the account is next checked in. Whether
+the account is checked out is unchanged.
+`
+)
@@ -0,0 +1,161 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+func TestSetManageSetPassword(t *testing.T) {
+	directory := newMemoryDirectory()
+	b, storage := getBackend(t, directory, testConfig())
+	handle := func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		return sendRequest(t, b, storage, &logical.Request{
+			Operation:   operation,
+			Path:        path,
+			Data:        data,
+			EntityID:    "admin-entity",
+			DisplayName: "admin",
+		})
+	}
+
+	handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com"},
+	})
+
+	if resp := handle(logical.UpdateOperation, libraryPrefix+"manage/lib/set-password", map[string]interface{}{
+		"service_account_name": "b@example.com",
+		"password":             "known-password",
+	}); responseErrorCode(resp) != string(errCodeInvalidRequest) {
+		t.Fatalf("expected an account outside the set to be refused but received %#v", resp)
+	}
+
+	if resp := handle(logical.UpdateOperation, libraryPrefix+"manage/lib/set-password", map[string]interface{}{
+		"service_account_name": "A@example.com",
+		"password":             "known-password",
+	}); resp != nil {
+		t.Fatalf("unable to set the password: %#v", resp)
+	}
+	if password := directory.account("a@example.com").password; password != "known-password" {
+		t.Fatalf("expected the password to be set in AD but received %q", password)
+	}
+	status := handle(logical.ReadOperation, libraryPrefix+"lib/status", nil).Data["a@example.com"].(map[string]interface{})
+	if status["password_externally_set"] != true || status["password_set_by_entity_id"] != "admin-entity" || status["password_set_by_display_name"] != "admin" {
+		t.Fatalf("expected the password to be reported as externally set but received %#v", status)
+	}
+	if _, ok := status["password_set_time"].(time.Time); !ok {
+		t.Fatalf("expected when the password was set but received %#v", status)
+	}
+
+	// The known password is checked out, and replaced when it's checked in.
+	resp := handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil)
+	if resp == nil || resp.IsError() || resp.Data["password"] != "known-password" {
+		t.Fatalf("expected the known password to be checked out but received %#v", resp)
+	}
+	handle(logical.UpdateOperation, libraryPrefix+"lib/check-in", nil)
+	status = handle(logical.ReadOperation, libraryPrefix+"lib/status", nil).Data["a@example.com"].(map[string]interface{})
+	if _, ok := status["password_externally_set"]; ok {
+		t.Fatalf("expected the flag to be cleared by the rotation but received %#v", status)
+	}
+	if password := directory.account("a@example.com").password; password == "known-password" {
+		t.Fatal("expected the known password to be rotated")
+	}
+}
+
+// failingDirectory is a memoryDirectory whose password updates fail while
+// failUpdates is set.
+type failingDirectory struct {
+	*memoryDirectory
+	failUpdates bool
+}
+
+func (d *failingDirectory) UpdatePassword(conf *client.ADConf, serviceAccountName string, newPassword string) error {
+	if d.failUpdates {
+		return errors.New("unable to update password")
+	}
+	return d.memoryDirectory.UpdatePassword(conf, serviceAccountName, newPassword)
+}
+
+func TestSetManageSetPasswordRefusedByAD(t *testing.T) {
+	directory := &failingDirectory{memoryDirectory: newMemoryDirectory()}
+	b, storage := getBackend(t, directory, testConfig())
+	handle := func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		return sendRequest(t, b, storage, &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+	rollback := func() {
+		t.Helper()
+		walIDs, err := framework.ListWAL(ctx, storage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, walID := range walIDs {
+			wal, err := framework.GetWAL(ctx, storage, walID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := b.walRollback(ctx, &logical.Request{Storage: storage}, wal.Kind, wal.Data); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com"},
+	})
+	original := directory.account("a@example.com").password
+
+	// A password AD refuses leaves no WAL for the rollback to set it later.
+	directory.failUpdates = true
+	if _, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      libraryPrefix + "manage/lib/set-password",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"service_account_name": "a@example.com",
+			"password":             "rejected-password",
+		},
+	}); err == nil {
+		t.Fatal("expected setting the password to fail")
+	}
+	directory.failUpdates = false
+	if walIDs, err := framework.ListWAL(ctx, storage); err != nil || len(walIDs) != 0 {
+		t.Fatalf("expected no WALs but found %v, %v", walIDs, err)
+	}
+	rollback()
+	if password := directory.account("a@example.com").password; password != original {
+		t.Fatalf("expected the password to be unchanged but received %q", password)
+	}
+
+	// A WAL a crash left behind doesn't replace a password rotated after it.
+	if _, err := framework.PutWAL(ctx, storage, checkInWAL, checkInEntry{
+		ServiceAccountName: "a@example.com",
+		Password:           "stale-password",
+		RotatedAt:          time.Now().Add(-time.Hour).UTC().Format(time.RFC3339Nano),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if resp := handle(logical.UpdateOperation, libraryPrefix+"manage/lib/set-password", map[string]interface{}{
+		"service_account_name": "a@example.com",
+		"password":             "known-password",
+	}); resp != nil {
+		t.Fatalf("unable to set the password: %#v", resp)
+	}
+	rollback()
+	if password := directory.account("a@example.com").password; password != "known-password" {
+		t.Fatalf("expected the later password to be kept but received %q", password)
+	}
+}
@@ -0,0 +1,299 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const tidyPath = "tidy"
+
+// tidyReport lists the storage entries that were found to be orphaned by tidy.
+type tidyReport struct {
+	Passwords      []string
+	CheckOuts      []string
+	Creds          []string
+	CheckInRetries []string
+	RoleRetries    []string
+	RoleErrors     []string
+	Approvals      []string
+}
+
+func (r *tidyReport) Map() map[string]interface{} {
+	return map[string]interface{}{
+		"orphaned_passwords":        r.Passwords,
+		"orphaned_check_outs":       r.CheckOuts,
+		"orphaned_creds":            r.Creds,
+		"orphaned_check_in_retries": r.CheckInRetries,
+		"orphaned_role_retries":     r.RoleRetries,
+		"orphaned_role_errors":      r.RoleErrors,
+		"orphaned_approvals":        r.Approvals,
+	}
+}
+
+// count is how many orphaned entries the report lists.
+func (r *tidyReport) count() int {
+	return len(r.Passwords) + len(r.CheckOuts) + len(r.Creds) + len(r.CheckInRetries) +
+		len(r.RoleRetries) + len(r.RoleErrors) + len(r.Approvals)
+}
+
+func (b *backend) pathTidy() *framework.Path {
+	return &framework.Path{
+		Pattern: tidyPath + "$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "tidy",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"dry_run": {
+				Type:        framework.TypeBool,
+				Description: "If true, report orphaned storage entries without removing them.",
+				Default:     false,
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.operationTidy,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+				Summary:                     "Remove storage entries left behind by deleted roles and library sets.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"dry_run": {
+								Type:        framework.TypeBool,
+								Description: "Whether orphaned storage entries were only reported.",
+							},
+							"orphaned_passwords": {
+								Type:        framework.TypeStringSlice,
+								Description: "Service accounts whose stored passwords don't belong to any library set.",
+							},
+							"orphaned_check_outs": {
+								Type:        framework.TypeStringSlice,
+								Description: "Service accounts whose check-outs don't belong to any library set.",
+							},
+							"orphaned_creds": {
+								Type:        framework.TypeStringSlice,
+								Description: "Roles whose stored creds don't belong to any role.",
+							},
+							"orphaned_check_in_retries": {
+								Type:        framework.TypeStringSlice,
+								Description: "Service accounts whose queued check-in retries don't belong to any library set.",
+							},
+							"orphaned_role_retries": {
+								Type:        framework.TypeStringSlice,
+								Description: "Roles whose queued rotation retries don't belong to any role.",
+							},
+							"orphaned_role_errors": {
+								Type:        framework.TypeStringSlice,
+								Description: "Roles whose stored errors don't belong to any role.",
+							},
+							"orphaned_approvals": {
+								Type:        framework.TypeStringSlice,
+								Description: "Library sets whose check-out requests don't belong to any set.",
+							},
+						},
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    tidyHelpSynopsis,
+		HelpDescription: tidyHelpDescription,
+	}
+}
+
+func (b *backend) operationTidy(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	dryRun := fieldData.Get("dry_run").(bool)
+
+	report, err := b.tidy(ctx, req.Storage, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	respData := report.Map()
+	respData["dry_run"] = dryRun
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+// periodicTidy tidies storage if the configured tidy_interval has passed since it was last tidied.
+func (b *backend) periodicTidy(ctx context.Context, storage logical.Storage) error {
+	engineConf, err := readConfig(ctx, storage)
+	if err != nil {
+		return err
+	}
+	if engineConf == nil || engineConf.TidyInterval <= 0 {
+		return nil
+	}
+	now := b.now()
+	if now.Before(b.lastTidy.Add(time.Duration(engineConf.TidyInterval) * time.Second)) {
+		return nil
+	}
+	report, err := b.tidy(ctx, storage, false)
+	if err != nil {
+		return err
+	}
+	b.lastTidy = now
+	if n := report.count(); n > 0 {
+		b.Logger().Info("removed orphaned storage entries", "count", n)
+	}
+	return nil
+}
+
+// tidy finds the password, check-out and check-in retry entries of service
+// accounts that no longer belong to any library set or elevation role, the creds,
+// rotation retries and errors of roles that no longer exist, and the check-out
+// requests of sets that no longer exist. Unless dryRun is set, it removes them.
+func (b *backend) tidy(ctx context.Context, storage logical.Storage, dryRun bool) (*tidyReport, error) {
+	// Hold every set lock so no set can start managing a service account
+	// between our deciding it's orphaned and removing its entries.
+	for _, lock := range b.checkOutLocks {
+		lock.Lock()
+		defer lock.Unlock()
+	}
+	b.credLock.Lock()
+	defer b.credLock.Unlock()
+
+	setNames, err := storage.List(ctx, libraryPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var sets, managed []string
+	for _, setName := range setNames {
+		if strings.HasSuffix(setName, "/") {
+			continue
+		}
+		set, err := readSet(ctx, storage, setName)
+		if err != nil {
+			return nil, err
+		}
+		if set == nil {
+			continue
+		}
+		sets = append(sets, setName)
+		managed = append(managed, set.ServiceAccountNames...)
+	}
+	elevated, err := elevationServiceAccounts(ctx, storage)
+	if err != nil {
+		return nil, err
+	}
+	managed = append(managed, elevated...)
+
+	report := &tidyReport{}
+	if report.Passwords, err = orphanedKeys(ctx, storage, passwordStoragePrefix, managed); err != nil {
+		return nil, err
+	}
+	if report.CheckOuts, err = orphanedKeys(ctx, storage, checkoutStoragePrefix, managed); err != nil {
+		return nil, err
+	}
+	roleNames, err := storage.List(ctx, roleStorageKey+"/")
+	if err != nil {
+		return nil, err
+	}
+	if report.Creds, err = orphanedKeys(ctx, storage, storageKey+"/", roleNames); err != nil {
+		return nil, err
+	}
+	if report.CheckInRetries, err = orphanedKeys(ctx, storage, retryStoragePrefix+retryKindCheckIn+"/", managed); err != nil {
+		return nil, err
+	}
+	if report.RoleRetries, err = orphanedKeys(ctx, storage, retryStoragePrefix+retryKindRole+"/", roleNames); err != nil {
+		return nil, err
+	}
+	if report.RoleErrors, err = orphanedKeys(ctx, storage, roleErrorStoragePrefix, roleNames); err != nil {
+		return nil, err
+	}
+	// Check-out requests are stored under their set's name.
+	approvalSets, err := storage.List(ctx, approvalStoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+	report.Approvals = []string{}
+	for _, approvalSet := range approvalSets {
+		setName := strings.TrimSuffix(approvalSet, "/")
+		if !strutil.StrListContains(sets, setName) {
+			report.Approvals = append(report.Approvals, setName)
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	for _, key := range report.Passwords {
+		if err := storage.Delete(ctx, passwordStoragePrefix+key); err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range report.CheckOuts {
+		if err := storage.Delete(ctx, checkoutStoragePrefix+key); err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range report.Creds {
+		if err := storage.Delete(ctx, storageKey+"/"+key); err != nil {
+			return nil, err
+		}
+		b.credCache.Delete(key)
+	}
+	for _, key := range report.CheckInRetries {
+		if err := storage.Delete(ctx, retryStoragePrefix+retryKindCheckIn+"/"+key); err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range report.RoleRetries {
+		if err := storage.Delete(ctx, retryStoragePrefix+retryKindRole+"/"+key); err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range report.RoleErrors {
+		if err := storage.Delete(ctx, roleErrorStoragePrefix+key); err != nil {
+			return nil, err
+		}
+	}
+	for _, setName := range report.Approvals {
+		if err := deleteApprovals(ctx, storage, setName); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// orphanedKeys returns the keys under prefix that don't have an owner.
+func orphanedKeys(ctx context.Context, storage logical.Storage, prefix string, owners []string) ([]string, error) {
+	keys, err := storage.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	orphaned := []string{}
+	for _, key := range keys {
+		if strings.HasSuffix(key, "/") {
+			continue
+		}
+		if !strutil.StrListContains(owners, key) {
+			orphaned = append(orphaned, key)
+		}
+	}
+	return orphaned, nil
+}
+
+const (
+	tidyHelpSynopsis = `
+Remove storage entries left behind by deleted roles and library sets.
+`
+	tidyHelpDescription = `
+This endpoint finds stored passwords, check-outs and queued check-in retries for
+service accounts that no longer belong to any library set or elevation role,
+stored creds, queued rotation retries and errors for roles that no longer
+exist, and check-out requests for library sets that no longer exist, and
+removes them. Use "dry_run" to see what would be removed without removing
+anything.
+`
+)
@@ -0,0 +1,183 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTidy(t *testing.T) {
+	ctx, storage, serviceAccountName, _ := setup()
+	b := newBackend(&fakeSecretsClient{}, nil)
+	if err := b.Setup(ctx, &logical.BackendConfig{System: &logical.StaticSystemView{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A set with one member, and a role with creds.
+	if err := b.checkOutHandler.CheckIn(ctx, storage, serviceAccountName); err != nil {
+		t.Fatal(err)
+	}
+	if err := storeSet(ctx, storage, "set", &librarySet{ServiceAccountNames: []string{serviceAccountName}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.writeRoleToStorage(ctx, storage, "role", &backendRole{ServiceAccountName: "role@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	putJSON(t, ctx, storage, storageKey+"/role", map[string]interface{}{"current_password": "role-password"})
+
+	// Entries left behind by a deleted set and a deleted role.
+	if err := b.checkOutHandler.CheckIn(ctx, storage, "orphan@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	putJSON(t, ctx, storage, storageKey+"/deleted-role", map[string]interface{}{"current_password": "deleted-role-password"})
+	putJSON(t, ctx, storage, retryStoragePrefix+retryKindCheckIn+"/orphan@example.com", &retryTask{Name: "orphan@example.com", SetName: "deleted-set"})
+	putJSON(t, ctx, storage, retryStoragePrefix+retryKindRole+"/deleted-role", &retryTask{Name: "deleted-role"})
+	putJSON(t, ctx, storage, roleErrorStoragePrefix+"deleted-role", &roleError{Operation: roleErrorRotation, Error: "unable to reach AD"})
+	putJSON(t, ctx, storage, approvalStoragePrefix+"deleted-set/request", &approvalRequest{RequesterEntityID: "borrower"})
+
+	// And ones that are still owned.
+	putJSON(t, ctx, storage, retryStoragePrefix+retryKindCheckIn+"/"+serviceAccountName, &retryTask{Name: serviceAccountName, SetName: "set"})
+	putJSON(t, ctx, storage, retryStoragePrefix+retryKindRole+"/role", &retryTask{Name: "role"})
+	putJSON(t, ctx, storage, roleErrorStoragePrefix+"role", &roleError{Operation: roleErrorRotation, Error: "unable to reach AD"})
+	putJSON(t, ctx, storage, approvalStoragePrefix+"set/request", &approvalRequest{RequesterEntityID: "borrower"})
+
+	expected := map[string]interface{}{
+		"dry_run":                   true,
+		"orphaned_passwords":        []string{"orphan@example.com"},
+		"orphaned_check_outs":       []string{"orphan@example.com"},
+		"orphaned_creds":            []string{"deleted-role"},
+		"orphaned_check_in_retries": []string{"orphan@example.com"},
+		"orphaned_role_retries":     []string{"deleted-role"},
+		"orphaned_role_errors":      []string{"deleted-role"},
+		"orphaned_approvals":        []string{"deleted-set"},
+	}
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      tidyPath,
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"dry_run": true,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	assert.Equal(t, expected, resp.Data)
+
+	// Nothing should have been removed during the dry run.
+	if _, err := retrievePassword(ctx, storage, b.transit, "orphan@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      tidyPath,
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	expected["dry_run"] = false
+	assert.Equal(t, expected, resp.Data)
+
+	if _, err := retrievePassword(ctx, storage, b.transit, "orphan@example.com"); err != errNotFound {
+		t.Fatalf("expected errNotFound but received %v", err)
+	}
+	if _, err := b.checkOutHandler.LoadCheckOut(ctx, storage, "orphan@example.com"); err != errNotFound {
+		t.Fatalf("expected errNotFound but received %v", err)
+	}
+	if entry, err := storage.Get(ctx, storageKey+"/deleted-role"); err != nil || entry != nil {
+		t.Fatalf("expected the deleted role's creds to be removed, err: %v", err)
+	}
+
+	for _, key := range []string{
+		retryStoragePrefix + retryKindCheckIn + "/orphan@example.com",
+		retryStoragePrefix + retryKindRole + "/deleted-role",
+		roleErrorStoragePrefix + "deleted-role",
+		approvalStoragePrefix + "deleted-set/request",
+	} {
+		if entry, err := storage.Get(ctx, key); err != nil || entry != nil {
+			t.Fatalf("expected %q to be removed, err: %v", key, err)
+		}
+	}
+
+	// Entries that are still owned are untouched.
+	if _, err := retrievePassword(ctx, storage, b.transit, serviceAccountName); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{
+		retryStoragePrefix + retryKindCheckIn + "/" + serviceAccountName,
+		retryStoragePrefix + retryKindRole + "/role",
+		roleErrorStoragePrefix + "role",
+		approvalStoragePrefix + "set/request",
+	} {
+		if entry, err := storage.Get(ctx, key); err != nil || entry == nil {
+			t.Fatalf("expected %q to remain, err: %v", key, err)
+		}
+	}
+	if entry, err := storage.Get(ctx, storageKey+"/role"); err != nil || entry == nil {
+		t.Fatalf("expected the role's creds to remain, err: %v", err)
+	}
+}
+
+func putJSON(t *testing.T, ctx context.Context, storage logical.Storage, key string, value interface{}) {
+	t.Helper()
+	entry, err := logical.StorageEntryJSON(key, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPeriodicTidy(t *testing.T) {
+	ctx, storage, _, _ := setup()
+	b := newBackend(&fakeSecretsClient{}, nil)
+	if err := b.Setup(ctx, &logical.BackendConfig{System: &logical.StaticSystemView{}}); err != nil {
+		t.Fatal(err)
+	}
+	req := &logical.Request{Storage: storage}
+
+	// Automatic tidying is off by default.
+	if err := b.checkOutHandler.CheckIn(ctx, storage, "orphan1@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.periodicFunc(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := retrievePassword(ctx, storage, b.transit, "orphan1@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	engineConf, err := readConfig(ctx, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engineConf.TidyInterval = 60 * 60
+	if err := writeConfig(ctx, storage, engineConf); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.periodicFunc(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := retrievePassword(ctx, storage, b.transit, "orphan1@example.com"); err != errNotFound {
+		t.Fatalf("expected errNotFound but received %v", err)
+	}
+
+	// It shouldn't run again until the interval has passed.
+	if err := b.checkOutHandler.CheckIn(ctx, storage, "orphan2@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.periodicFunc(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := retrievePassword(ctx, storage, b.transit, "orphan2@example.com"); err != nil {
+		t.Fatal(err)
+	}
+}
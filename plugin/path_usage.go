@@ -0,0 +1,258 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	usagePath          = "usage"
+	usageStoragePrefix = "usage/"
+
+	// usageDayFormat names the storage entry that counts a day's usage.
+	usageDayFormat = "2006-01-02"
+
+	defaultUsagePeriod = 30 * 24 * time.Hour
+	maxUsagePeriod     = 366 * 24 * time.Hour
+)
+
+// usageCounts is how much the engine was used over a day, or over a reporting
+// period when days are added together.
+type usageCounts struct {
+	// CredsIssued counts creds reads by role.
+	CredsIssued map[string]int `json:"creds_issued,omitempty"`
+
+	// Rotations counts passwords changed in AD for roles, library sets, and elevation roles.
+	Rotations int `json:"rotations,omitempty"`
+
+	// CheckOuts counts check-outs by library set.
+	CheckOuts map[string]int `json:"check_outs,omitempty"`
+
+	// UnavailableCheckOuts counts check-outs refused because no service account
+	// was available, by the library set or library group they were made from.
+	UnavailableCheckOuts map[string]int `json:"unavailable_check_outs,omitempty"`
+
+	// Borrowers are the distinct entities that checked service accounts out.
+	Borrowers []string `json:"borrowers,omitempty"`
+}
+
+func (c *usageCounts) add(other *usageCounts) {
+	c.CredsIssued = addUsage(c.CredsIssued, other.CredsIssued)
+	c.Rotations += other.Rotations
+	c.CheckOuts = addUsage(c.CheckOuts, other.CheckOuts)
+	c.UnavailableCheckOuts = addUsage(c.UnavailableCheckOuts, other.UnavailableCheckOuts)
+	c.Borrowers = strutil.RemoveDuplicates(append(c.Borrowers, other.Borrowers...), false)
+}
+
+func addUsage(counts map[string]int, other map[string]int) map[string]int {
+	if counts == nil {
+		counts = make(map[string]int, len(other))
+	}
+	for name, count := range other {
+		counts[name] += count
+	}
+	return counts
+}
+
+// usageRecorder counts usage in storage by day. Requests that use the engine are
+// forwarded to the active node, so only it records usage.
+type usageRecorder struct {
+	mu     sync.Mutex
+	logger func() hclog.Logger
+}
+
+// record applies the update to the counts for the day of now. Failing to record
+// usage is logged rather than failing the request that was being counted.
+func (r *usageRecorder) record(ctx context.Context, storage logical.Storage, now time.Time, update func(*usageCounts)) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := usageStoragePrefix + now.UTC().Format(usageDayFormat)
+	counts, err := readUsage(ctx, storage, key)
+	if err == nil {
+		update(counts)
+		var entry *logical.StorageEntry
+		if entry, err = logical.StorageEntryJSON(key, counts); err == nil {
+			err = storage.Put(ctx, entry)
+		}
+	}
+	if err != nil {
+		r.logger().Warn("unable to record usage", "error", err)
+	}
+}
+
+func (r *usageRecorder) credsIssued(ctx context.Context, storage logical.Storage, now time.Time, roleName string) {
+	r.record(ctx, storage, now, func(counts *usageCounts) {
+		counts.CredsIssued = addUsage(counts.CredsIssued, map[string]int{roleName: 1})
+	})
+}
+
+func (r *usageRecorder) rotated(ctx context.Context, storage logical.Storage, now time.Time) {
+	r.record(ctx, storage, now, func(counts *usageCounts) {
+		counts.Rotations++
+	})
+}
+
+func (r *usageRecorder) checkedOut(ctx context.Context, storage logical.Storage, now time.Time, setName, entityID string) {
+	r.record(ctx, storage, now, func(counts *usageCounts) {
+		counts.CheckOuts = addUsage(counts.CheckOuts, map[string]int{setName: 1})
+		if entityID != "" && !strutil.StrListContains(counts.Borrowers, entityID) {
+			counts.Borrowers = append(counts.Borrowers, entityID)
+		}
+	})
+}
+
+func (r *usageRecorder) checkOutUnavailable(ctx context.Context, storage logical.Storage, now time.Time, name string) {
+	r.record(ctx, storage, now, func(counts *usageCounts) {
+		counts.UnavailableCheckOuts = addUsage(counts.UnavailableCheckOuts, map[string]int{name: 1})
+	})
+}
+
+func (b *backend) pathUsage() *framework.Path {
+	return &framework.Path{
+		Pattern: usagePath + "$",
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: operationPrefixAD,
+			OperationVerb:   "report",
+			OperationSuffix: "usage",
+		},
+		Fields: map[string]*framework.FieldSchema{
+			"start": {
+				Type:        framework.TypeTime,
+				Description: "The start of the period to report on. Defaults to 30 days before end.",
+			},
+			"end": {
+				Type:        framework.TypeTime,
+				Description: "The end of the period to report on. Defaults to now.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.operationUsageRead,
+				Summary:  "Report how much the engine was used over a period.",
+				Responses: map[int][]framework.Response{
+					http.StatusOK: {{
+						Description: "OK",
+						Fields: map[string]*framework.FieldSchema{
+							"start": {
+								Type:        framework.TypeTime,
+								Description: "The start of the first day reported on.",
+							},
+							"end": {
+								Type:        framework.TypeTime,
+								Description: "The end of the last day reported on.",
+							},
+							"creds_issued": {
+								Type:        framework.TypeMap,
+								Description: "How many times each role's creds were read.",
+							},
+							"rotations": {
+								Type:        framework.TypeInt,
+								Description: "How many passwords were changed in AD.",
+							},
+							"check_outs": {
+								Type:        framework.TypeMap,
+								Description: "How many service accounts were checked out from each library set.",
+							},
+							"unavailable_check_outs": {
+								Type:        framework.TypeMap,
+								Description: "How many check-outs from each library set or library group were refused because no service account was available.",
+							},
+							"distinct_borrowers": {
+								Type:        framework.TypeInt,
+								Description: "How many different entities checked service accounts out.",
+							},
+						},
+					}},
+				},
+			},
+		},
+		HelpSynopsis:    usageHelpSynopsis,
+		HelpDescription: usageHelpDescription,
+	}
+}
+
+func (b *backend) operationUsageRead(ctx context.Context, req *logical.Request, fieldData *framework.FieldData) (*logical.Response, error) {
+	end := b.now()
+	if endRaw, ok := fieldData.GetOk("end"); ok {
+		end = endRaw.(time.Time)
+	}
+	start := end.Add(-defaultUsagePeriod)
+	if startRaw, ok := fieldData.GetOk("start"); ok {
+		start = startRaw.(time.Time)
+	}
+	if end.Before(start) {
+		return codedErrorResponse(errCodeInvalidRequest, "end can't be before start"), nil
+	}
+	if end.Sub(start) > maxUsagePeriod {
+		return codedErrorResponse(errCodeInvalidRequest, "the period can't be longer than %d days", int(maxUsagePeriod.Hours()/24)), nil
+	}
+
+	// Usage is counted by day, so the period is widened to whole days.
+	firstDay := start.UTC().Truncate(24 * time.Hour)
+	lastDay := end.UTC().Truncate(24 * time.Hour)
+	total := &usageCounts{}
+	for day := firstDay; !day.After(lastDay); day = day.Add(24 * time.Hour) {
+		counts, err := readUsage(ctx, req.Storage, usageStoragePrefix+day.Format(usageDayFormat))
+		if err != nil {
+			return nil, err
+		}
+		total.add(counts)
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"start":                  firstDay,
+			"end":                    lastDay.Add(24*time.Hour - time.Nanosecond),
+			"creds_issued":           addUsage(nil, total.CredsIssued),
+			"rotations":              total.Rotations,
+			"check_outs":             addUsage(nil, total.CheckOuts),
+			"unavailable_check_outs": addUsage(nil, total.UnavailableCheckOuts),
+			"distinct_borrowers":     len(total.Borrowers),
+		},
+	}, nil
+}
+
+// readUsage returns the counts stored at key, or empty counts if there are none.
+func readUsage(ctx context.Context, storage logical.Storage, key string) (*usageCounts, error) {
+	counts := &usageCounts{}
+	entry, err := storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return counts, nil
+	}
+	if err := entry.DecodeJSON(counts); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+const (
+	usageHelpSynopsis = `
+Report how much the engine was used over a period.
+`
+	usageHelpDescription = `
+This endpoint reports, over the requested period, how many times each role's
+creds were read, how many passwords were changed in AD, how many service
+accounts were checked out from each library set, how many check-outs were
+refused because no service account was available, and how many different
+entities checked service accounts out.
+
+Usage is counted by day in UTC, so the period is widened to whole days. It
+defaults to the last 30 days, and can't be longer than 366 days.
+`
+)
@@ -0,0 +1,81 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestUsage(t *testing.T) {
+	b, storage := getBackend(t, &fakeSecretsClient{}, testConfig())
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	b.checkOutHandler.now = b.now
+	handle := func(operation logical.Operation, path, entityID string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		return requester(t, b, storage, entityID)(operation, path, data)
+	}
+
+	if resp := handle(logical.UpdateOperation, rolePrefix+"app", "", map[string]interface{}{
+		"service_account_name": "app@example.com",
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to create role: %#v", resp)
+	}
+	// Creating the set rotates its account's password.
+	if resp := handle(logical.CreateOperation, libraryPrefix+"lib", "", map[string]interface{}{
+		"service_account_names": []string{"lib@example.com"},
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to create set: %#v", resp)
+	}
+
+	// The first read rotates the role's password.
+	handle(logical.ReadOperation, "creds/app", "", nil)
+	handle(logical.ReadOperation, "creds/app", "", nil)
+
+	now = now.Add(24 * time.Hour)
+	handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", "alice", nil)
+	handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", "bob", nil)
+	// Checking in rotates the account's password.
+	handle(logical.UpdateOperation, libraryPrefix+"lib/check-in", "alice", nil)
+	handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", "alice", nil)
+
+	resp := handle(logical.ReadOperation, usagePath, "", nil)
+	if resp == nil || resp.IsError() {
+		t.Fatalf("unable to read usage: %#v", resp)
+	}
+	if resp.Data["creds_issued"].(map[string]int)["app"] != 2 {
+		t.Fatalf("expected 2 creds issued but received %#v", resp.Data["creds_issued"])
+	}
+	if resp.Data["rotations"] != 3 {
+		t.Fatalf("expected 3 rotations but received %#v", resp.Data["rotations"])
+	}
+	if resp.Data["check_outs"].(map[string]int)["lib"] != 2 {
+		t.Fatalf("expected 2 check-outs but received %#v", resp.Data["check_outs"])
+	}
+	if resp.Data["unavailable_check_outs"].(map[string]int)["lib"] != 1 {
+		t.Fatalf("expected 1 unavailable check-out but received %#v", resp.Data["unavailable_check_outs"])
+	}
+	if resp.Data["distinct_borrowers"] != 1 {
+		t.Fatalf("expected 1 distinct borrower but received %#v", resp.Data["distinct_borrowers"])
+	}
+
+	// Only the days in the period are counted.
+	resp = handle(logical.ReadOperation, usagePath, "", map[string]interface{}{
+		"start": now.Format(time.RFC3339),
+	})
+	if len(resp.Data["creds_issued"].(map[string]int)) != 0 || resp.Data["rotations"] != 1 {
+		t.Fatalf("expected only the second day to be counted but received %#v", resp.Data)
+	}
+
+	resp = handle(logical.ReadOperation, usagePath, "", map[string]interface{}{
+		"start": now.Format(time.RFC3339),
+		"end":   now.Add(-time.Hour).Format(time.RFC3339),
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected an end before the start to be rejected")
+	}
+}
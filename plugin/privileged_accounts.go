@@ -0,0 +1,52 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+// privilegedGroups are the common names of the built-in groups whose members
+// control the whole domain or forest.
+var privilegedGroups = []string{
+	"Administrators",
+	"Domain Admins",
+	"Enterprise Admins",
+	"Schema Admins",
+}
+
+// privilegedReason returns why an account is privileged, or "" if it isn't. AD
+// sets adminCount on every account that is, or has been, a member of a protected
+// group, so it also catches nested memberships that memberOf doesn't show.
+func privilegedReason(entry *client.Entry) string {
+	if entry == nil {
+		return ""
+	}
+	if adminCount, _ := entry.GetJoined(client.FieldRegistry.AdminCount); adminCount == "1" {
+		return "its adminCount is 1"
+	}
+	memberOf, _ := entry.Get(client.FieldRegistry.MemberOf)
+	for _, groupDN := range memberOf {
+		dn, err := ldap.ParseDN(groupDN)
+		if err != nil || len(dn.RDNs) == 0 {
+			continue
+		}
+		for _, attribute := range dn.RDNs[0].Attributes {
+			if !strings.EqualFold(attribute.Type, "CN") {
+				continue
+			}
+			for _, group := range privilegedGroups {
+				if strings.EqualFold(attribute.Value, group) {
+					return fmt.Sprintf("it's a member of %s", group)
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,158 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+func TestPrivilegedReason(t *testing.T) {
+	tests := []struct {
+		name       string
+		attributes map[string][]string
+		want       string
+	}{
+		{
+			"unprivileged",
+			map[string][]string{
+				"adminCount": {"0"},
+				"memberOf":   {"CN=App Owners,OU=Groups,DC=example,DC=com"},
+			},
+			"",
+		},
+		{
+			"admin count",
+			map[string][]string{
+				"adminCount": {"1"},
+			},
+			"its adminCount is 1",
+		},
+		{
+			"domain admin",
+			map[string][]string{
+				"memberOf": {
+					"CN=App Owners,OU=Groups,DC=example,DC=com",
+					"cn=domain admins,CN=Users,DC=example,DC=com",
+				},
+			},
+			"it's a member of Domain Admins",
+		},
+		{
+			"group named like a privileged group",
+			map[string][]string{
+				"memberOf": {"CN=Readers,OU=Domain Admins,DC=example,DC=com"},
+			},
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ldapEntry := &ldap.Entry{}
+			for name, values := range tt.attributes {
+				ldapEntry.Attributes = append(ldapEntry.Attributes, &ldap.EntryAttribute{Name: name, Values: values})
+			}
+			if got := privilegedReason(client.NewEntry(ldapEntry)); got != tt.want {
+				t.Fatalf("expected %q but received %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// privilegedFake reports every service account whose name starts with "admin" as a Domain Admin.
+type privilegedFake struct {
+	fakeSecretsClient
+}
+
+func (f *privilegedFake) Get(conf *client.ADConf, serviceAccountName string) (*client.Entry, error) {
+	ldapEntry := &ldap.Entry{}
+	if strings.HasPrefix(serviceAccountName, "admin") {
+		ldapEntry.Attributes = append(ldapEntry.Attributes, &ldap.EntryAttribute{
+			Name:   client.FieldRegistry.MemberOf.String(),
+			Values: []string{"CN=Domain Admins,CN=Users,DC=example,DC=com"},
+		})
+	}
+	return client.NewEntry(ldapEntry), nil
+}
+
+func TestAllowPrivileged(t *testing.T) {
+	b, storage := getBackend(t, &privilegedFake{}, testConfig())
+
+	tests := []struct {
+		name      string
+		operation logical.Operation
+		path      string
+		data      map[string]interface{}
+		wantCode  errorCode
+	}{
+		{
+			"role refuses a privileged account",
+			logical.UpdateOperation,
+			rolePrefix + "admin",
+			map[string]interface{}{"service_account_name": "admin1@example.com"},
+			errCodePrivilegedAccount,
+		},
+		{
+			"role allows a privileged account when told to",
+			logical.UpdateOperation,
+			rolePrefix + "admin",
+			map[string]interface{}{"service_account_name": "admin1@example.com", "allow_privileged": true},
+			"",
+		},
+		{
+			"set refuses a privileged account",
+			logical.CreateOperation,
+			libraryPrefix + "admins",
+			map[string]interface{}{"service_account_names": []string{"app1@example.com", "admin2@example.com"}},
+			errCodePrivilegedAccount,
+		},
+		{
+			"set allows a privileged account when told to",
+			logical.CreateOperation,
+			libraryPrefix + "admins",
+			map[string]interface{}{"service_account_names": []string{"app1@example.com", "admin2@example.com"}, "allow_privileged": true},
+			"",
+		},
+		{
+			"set can't stop allowing privileged accounts it has",
+			logical.UpdateOperation,
+			libraryPrefix + "admins",
+			map[string]interface{}{"allow_privileged": false},
+			errCodePrivilegedAccount,
+		},
+		{
+			"set can stop allowing privileged accounts once they're removed",
+			logical.UpdateOperation,
+			libraryPrefix + "admins",
+			map[string]interface{}{"service_account_names": []string{"app1@example.com"}, "allow_privileged": false},
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := sendRequest(t, b, storage, &logical.Request{
+				Operation: tt.operation,
+				Path:      tt.path,
+				Data:      tt.data,
+			})
+			if tt.wantCode == "" {
+				if resp != nil && resp.IsError() {
+					t.Fatalf("unexpected error response: %#v", resp)
+				}
+				return
+			}
+			if resp == nil || !resp.IsError() {
+				t.Fatal("expected an error response")
+			}
+			if code := responseErrorCode(resp); code != string(tt.wantCode) {
+				t.Fatalf("expected %s but received %v", tt.wantCode, code)
+			}
+		})
+	}
+}
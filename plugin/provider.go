@@ -0,0 +1,129 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+// providerPreset describes the restrictions a managed Active Directory service
+// places on the directory, so operations it will refuse can be rejected up front
+// with an explanation instead of failing in AD with a generic error.
+type providerPreset struct {
+	// displayName is how the provider is referred to in error messages.
+	displayName string
+
+	// encryptedPasswordWrites is set if the provider only accepts password
+	// changes over LDAPS or StartTLS.
+	encryptedPasswordWrites bool
+
+	// delegatedOU is the OU customers are given to manage, if every directory
+	// from the provider uses the same name for it.
+	delegatedOU string
+
+	// reservedOUs maps OUs whose accounts customers can't manage to why.
+	reservedOUs map[string]string
+
+	// reservedAccounts maps sAMAccountNames customers can't manage through LDAP to why.
+	reservedAccounts map[string]string
+}
+
+var providerPresets = map[string]*providerPreset{
+	"aws-managed-ad": {
+		displayName:             "AWS Managed Microsoft AD",
+		encryptedPasswordWrites: true,
+		reservedOUs: map[string]string{
+			"AWS Reserved": "AWS manages the accounts in it",
+		},
+		reservedAccounts: map[string]string{
+			"Admin": "its password can only be reset through AWS Directory Service",
+		},
+	},
+	"azure-ad-ds": {
+		displayName:             "Microsoft Entra Domain Services",
+		encryptedPasswordWrites: true,
+		reservedOUs: map[string]string{
+			"AADDC Users":     "its accounts are synchronized from Microsoft Entra ID, where their passwords must be changed",
+			"AADDC Computers": "Microsoft manages the accounts in it",
+		},
+	},
+	"google-managed-ad": {
+		displayName:             "Managed Service for Microsoft Active Directory",
+		encryptedPasswordWrites: true,
+		delegatedOU:             "Cloud",
+		reservedOUs: map[string]string{
+			"Cloud Service Objects": "Google manages the accounts in it",
+		},
+	},
+}
+
+// providerNames returns the names of the supported providers, for error messages.
+func providerNames() []string {
+	names := make([]string, 0, len(providerPresets))
+	for name := range providerPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateConfig returns an error if the config can't work with the provider, and
+// warnings for settings that probably won't.
+func (p *providerPreset) validateConfig(adConf *client.ADConf) (warnings []string, err error) {
+	// Discovered domain controllers are reached with ldaps:// unless StartTLS is used.
+	if p.encryptedPasswordWrites && !adConf.StartTLS && !adConf.RequireStartTLS && !adConf.DiscoverDC {
+		for _, rawURL := range strings.Split(adConf.Url, ",") {
+			u, err := url.Parse(strings.TrimSpace(rawURL))
+			if err == nil && u.Scheme == "ldap" {
+				return nil, fmt.Errorf("%s only accepts password changes over encrypted connections, so %q must use ldaps:// or starttls must be set", p.displayName, rawURL)
+			}
+		}
+	}
+	if p.delegatedOU != "" && !dnHasOU(adConf.UserDN, p.delegatedOU) {
+		warnings = append(warnings, fmt.Sprintf("%s only lets customers manage accounts under OU=%s, but userdn isn't under it", p.displayName, p.delegatedOU))
+	}
+	return warnings, nil
+}
+
+// checkAccount returns an error if the provider doesn't let customers manage the account.
+func (p *providerPreset) checkAccount(serviceAccountName string, entry *client.Entry) error {
+	if entry == nil {
+		return nil
+	}
+	samAccountName, _ := entry.GetJoined(client.FieldRegistry.SAMAccountName)
+	for account, reason := range p.reservedAccounts {
+		if strings.EqualFold(samAccountName, account) {
+			return fmt.Errorf("%q can't be managed on %s because %s", serviceAccountName, p.displayName, reason)
+		}
+	}
+	for ou, reason := range p.reservedOUs {
+		if dnHasOU(entry.DN, ou) {
+			return fmt.Errorf("%q can't be managed on %s because it's in OU=%s, and %s", serviceAccountName, p.displayName, ou, reason)
+		}
+	}
+	return nil
+}
+
+// dnHasOU reports whether the DN is, or is under, an OU with the given name.
+func dnHasOU(rawDN, ou string) bool {
+	dn, err := ldap.ParseDN(rawDN)
+	if err != nil {
+		return false
+	}
+	for _, rdn := range dn.RDNs {
+		for _, attribute := range rdn.Attributes {
+			if strings.EqualFold(attribute.Type, "OU") && strings.EqualFold(attribute.Value, ou) {
+				return true
+			}
+		}
+	}
+	return false
+}
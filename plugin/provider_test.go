@@ -0,0 +1,96 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+func TestProviderPresetValidateConfig(t *testing.T) {
+	preset := providerPresets["google-managed-ad"]
+	adConf := &client.ADConf{
+		ConfigEntry: &ldaputil.ConfigEntry{
+			Url:    "ldaps://dc1.example.com,ldap://dc2.example.com",
+			UserDN: "OU=Cloud,DC=example,DC=com",
+		},
+	}
+	if _, err := preset.validateConfig(adConf); err == nil {
+		t.Fatal("expected an error because dc2 would receive passwords unencrypted")
+	}
+
+	adConf.StartTLS = true
+	warnings, err := preset.validateConfig(adConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Fatalf("expected no warnings but received %v", warnings)
+	}
+
+	adConf.UserDN = "OU=Cloud Service Objects,DC=example,DC=com"
+	if warnings, _ := preset.validateConfig(adConf); len(warnings) != 1 {
+		t.Fatalf("expected a warning about userdn but received %v", warnings)
+	}
+}
+
+func TestProviderPresetCheckAccount(t *testing.T) {
+	newEntry := func(dn, samAccountName string) *client.Entry {
+		return client.NewEntry(&ldap.Entry{
+			DN: dn,
+			Attributes: []*ldap.EntryAttribute{
+				{Name: "sAMAccountName", Values: []string{samAccountName}},
+			},
+		})
+	}
+	tests := []struct {
+		name     string
+		provider string
+		entry    *client.Entry
+		allowed  bool
+	}{
+		{
+			"aws delegated ou",
+			"aws-managed-ad",
+			newEntry("CN=svc-app,OU=Users,OU=corp,DC=corp,DC=example,DC=com", "svc-app"),
+			true,
+		},
+		{
+			"aws admin",
+			"aws-managed-ad",
+			newEntry("CN=Admin,OU=Users,OU=corp,DC=corp,DC=example,DC=com", "admin"),
+			false,
+		},
+		{
+			"aws reserved ou",
+			"aws-managed-ad",
+			newEntry("CN=AWSAdminD-1,OU=AWS Reserved,DC=corp,DC=example,DC=com", "AWSAdminD-1"),
+			false,
+		},
+		{
+			"azure synchronized user",
+			"azure-ad-ds",
+			newEntry("CN=svc-app,OU=AADDC Users,DC=example,DC=com", "svc-app"),
+			false,
+		},
+		{
+			"azure custom ou",
+			"azure-ad-ds",
+			newEntry("CN=svc-app,OU=Service Accounts,DC=example,DC=com", "svc-app"),
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := providerPresets[tt.provider].checkAccount("svc@example.com", tt.entry)
+			if allowed := err == nil; allowed != tt.allowed {
+				t.Fatalf("expected allowed to be %t but received %v", tt.allowed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// requesterIdentity identifies who made a request, like for the updated_by of
+// roles and library sets. Tokens without an entity, like the root token, are
+// identified by their display name instead.
+func requesterIdentity(req *logical.Request) string {
+	if req.EntityID != "" {
+		return req.EntityID
+	}
+	return req.DisplayName
+}
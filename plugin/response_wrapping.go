@@ -0,0 +1,27 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// responseWrappingRequired returns an error response if the config requires
+// passwords to be response-wrapped and the request isn't wrapped, or is wrapped
+// with a TTL shorter than min_wrap_ttl.
+func responseWrappingRequired(engineConf *configuration, req *logical.Request) *logical.Response {
+	if engineConf == nil || !engineConf.RequireResponseWrapping {
+		return nil
+	}
+	if req.WrapInfo == nil || req.WrapInfo.TTL <= 0 {
+		return codedErrorResponse(errCodeWrappingRequired, "this request returns a password, so it must be response-wrapped")
+	}
+	minWrapTTL := time.Duration(engineConf.MinWrapTTL) * time.Second
+	if req.WrapInfo.TTL < minWrapTTL {
+		return codedErrorResponse(errCodeWrappingRequired, "the response-wrapping TTL must be at least %s", minWrapTTL)
+	}
+	return nil
+}
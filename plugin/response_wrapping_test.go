@@ -0,0 +1,37 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestResponseWrappingRequired(t *testing.T) {
+	required := &configuration{RequireResponseWrapping: true, MinWrapTTL: 60}
+	tests := []struct {
+		name       string
+		engineConf *configuration
+		wrapInfo   *logical.RequestWrapInfo
+		rejected   bool
+	}{
+		{"not required", &configuration{}, nil, false},
+		{"unwrapped", required, nil, true},
+		{"wrapped too briefly", required, &logical.RequestWrapInfo{TTL: 30 * time.Second}, true},
+		{"wrapped", required, &logical.RequestWrapInfo{TTL: time.Minute}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := responseWrappingRequired(tt.engineConf, &logical.Request{WrapInfo: tt.wrapInfo})
+			if rejected := resp != nil; rejected != tt.rejected {
+				t.Fatalf("expected rejected to be %t but received %#v", tt.rejected, resp)
+			}
+			if resp != nil && resp.Data["data"].(map[string]interface{})["error_code"] != string(errCodeWrappingRequired) {
+				t.Fatalf("unexpected error response: %#v", resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	retryStoragePrefix = "retry/"
+
+	// retryKindRole retries rotating a role's password.
+	retryKindRole = "role"
+	// retryKindCheckIn retries checking in a library service account.
+	retryKindCheckIn = "check-in"
+
+	minRetryBackoff = time.Minute
+	maxRetryBackoff = time.Hour
+
+	// failureActionRetry keeps retrying no matter how many attempts fail.
+	failureActionRetry = "retry"
+	// failureActionStop stops retrying until the next rotation succeeds.
+	failureActionStop = "stop"
+	// failureActionDisable stops retrying, and refuses a role's creds until it's
+	// rotated successfully, or doesn't lend a library service account again
+	// until it's checked in successfully.
+	failureActionDisable = "disable"
+	// failureActionEvent keeps retrying, but sends an event so it can be alerted on.
+	failureActionEvent = "event"
+	// failureActionQuarantine stops retrying a library check-in, and takes the
+	// service account away from its borrower until it's checked in through the
+	// manage path. It doesn't apply to roles.
+	failureActionQuarantine = "quarantine"
+
+	rotationFailureEventType = "ad/rotation-failure"
+)
+
+var failureActions = []string{failureActionRetry, failureActionStop, failureActionDisable, failureActionEvent, failureActionQuarantine}
+
+// retryTask is a failed rotation that's retried by the periodic func until it
+// succeeds. It's kept in storage so it isn't forgotten when Vault restarts.
+type retryTask struct {
+	// Name is the role name, or the service account name for a check-in.
+	Name string `json:"name"`
+
+	// SetName is the library set the service account belongs to, for a check-in.
+	SetName string `json:"set_name,omitempty"`
+
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error"`
+
+	// Stopped is set once the failure threshold was reached with the stop or
+	// disable action, so the task is no longer retried.
+	Stopped bool `json:"stopped,omitempty"`
+
+	// Disabled is set once the failure threshold was reached with the disable action.
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Quarantined is set once the failure threshold was reached with the
+	// quarantine action. It's released when the check-in finally succeeds.
+	Quarantined bool `json:"quarantined,omitempty"`
+
+	// PolicyApplied is set once the failure action was taken, so it's only
+	// taken once even if more attempts fail.
+	PolicyApplied bool `json:"policy_applied,omitempty"`
+}
+
+// failurePolicy is what to do once a rotation has failed Threshold times in a row.
+type failurePolicy struct {
+	// Threshold is 0 if no action is taken.
+	Threshold int
+	Action    string
+}
+
+// validateFailurePolicy returns an error if the failure_threshold or
+// failure_action of a role or set are invalid.
+func validateFailurePolicy(threshold int, action string) error {
+	if threshold < 0 {
+		return errors.New("failure_threshold can't be negative")
+	}
+	// Sets and roles stored before failure_action existed have none, which means retry.
+	if action != "" && !strutil.StrListContains(failureActions, action) {
+		return fmt.Errorf("failure_action must be one of %s", strings.Join(failureActions, ", "))
+	}
+	return nil
+}
+
+// retryBackoff doubles the wait after each failed attempt, up to maxRetryBackoff.
+func retryBackoff(attempts int) time.Duration {
+	backoff := minRetryBackoff
+	for i := 1; i < attempts && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	return backoff
+}
+
+// enqueueRetry records that a rotation failed so it's retried later. Failures
+// because rotation is paused or the password is younger than AD's minimum
+// password age aren't queued, since they're expected.
+func (b *backend) enqueueRetry(ctx context.Context, storage logical.Storage, kind, name, setName string, cause error) {
+	var paused *rotationPausedError
+	var tooYoung *minPasswordAgeError
+	if errors.As(cause, &paused) || errors.As(cause, &tooYoung) {
+		return
+	}
+	task, err := readRetryTask(ctx, storage, kind, name)
+	if err != nil {
+		b.Logger().Error("unable to read retry task", "kind", kind, "name", name, "error", err)
+		return
+	}
+	if task == nil {
+		task = &retryTask{Name: name, SetName: setName}
+	}
+	task.Attempts++
+	task.NextAttempt = b.now().Add(retryBackoff(task.Attempts))
+	task.LastError = cause.Error()
+	policy, err := b.readFailurePolicy(ctx, storage, kind, name, task.SetName)
+	if err != nil {
+		b.Logger().Error("unable to read failure policy", "kind", kind, "name", name, "error", err)
+	} else if policy.Threshold > 0 && task.Attempts >= policy.Threshold && !task.Stopped && !task.PolicyApplied {
+		// The threshold may have been lowered below the attempts already made,
+		// so it's taken as soon as it's reached or passed.
+		b.applyFailurePolicy(ctx, kind, task, policy.Action)
+	}
+	entry, err := logical.StorageEntryJSON(retryStoragePrefix+kind+"/"+name, task)
+	if err == nil {
+		err = storage.Put(ctx, entry)
+	}
+	if err != nil {
+		b.Logger().Error("unable to queue rotation for retry", "kind", kind, "name", name, "error", err)
+		return
+	}
+	b.Logger().Warn("rotation failed, queued for retry", "kind", kind, "name", name, "attempts", task.Attempts, "next_attempt", task.NextAttempt, "error", cause)
+	b.notifyWebhook(ctx, storage, webhookEventRotationFailure, map[string]interface{}{
+		"kind":         kind,
+		"name":         name,
+		"set_name":     task.SetName,
+		"attempts":     task.Attempts,
+		"next_attempt": task.NextAttempt,
+		"error":        task.LastError,
+		"quarantined":  task.Quarantined,
+	})
+}
+
+// applyFailurePolicy takes the failure action once a rotation has failed as many
+// times in a row as its role or set allows.
+func (b *backend) applyFailurePolicy(ctx context.Context, kind string, task *retryTask, action string) {
+	b.Logger().Error("rotation failure threshold reached", "kind", kind, "name", task.Name, "attempts", task.Attempts, "action", action, "error", task.LastError)
+	task.PolicyApplied = true
+	switch action {
+	case failureActionStop:
+		task.Stopped = true
+	case failureActionDisable:
+		task.Stopped = true
+		task.Disabled = true
+	case failureActionQuarantine:
+		task.Stopped = true
+		task.Quarantined = true
+		metrics.IncrCounter([]string{"active directory", "check-in", "quarantined", task.SetName}, 1)
+	case failureActionEvent:
+		err := logical.SendEvent(ctx, b, rotationFailureEventType,
+			"kind", kind,
+			"name", task.Name,
+			"set_name", task.SetName,
+			"attempts", strconv.Itoa(task.Attempts),
+			"error", task.LastError,
+		)
+		if err != nil {
+			b.Logger().Warn("unable to send rotation failure event", "kind", kind, "name", task.Name, "error", err)
+		}
+	}
+}
+
+// readFailurePolicy returns the failure policy of the role or set being retried.
+func (b *backend) readFailurePolicy(ctx context.Context, storage logical.Storage, kind, name, setName string) (failurePolicy, error) {
+	switch kind {
+	case retryKindRole:
+		entry, err := storage.Get(ctx, roleStorageKey+"/"+name)
+		if err != nil || entry == nil {
+			return failurePolicy{}, err
+		}
+		role := &backendRole{}
+		if err := entry.DecodeJSON(role); err != nil {
+			return failurePolicy{}, err
+		}
+		return failurePolicy{Threshold: role.FailureThreshold, Action: role.FailureAction}, nil
+	case retryKindCheckIn:
+		set, err := readSet(ctx, storage, setName)
+		if err != nil || set == nil {
+			return failurePolicy{}, err
+		}
+		return failurePolicy{Threshold: set.FailureThreshold, Action: set.FailureAction}, nil
+	}
+	return failurePolicy{}, nil
+}
+
+// clearRetry drops a queued retry because the rotation has since succeeded.
+func (b *backend) clearRetry(ctx context.Context, storage logical.Storage, kind, name string) {
+	if err := storage.Delete(ctx, retryStoragePrefix+kind+"/"+name); err != nil {
+		b.Logger().Warn("unable to clear queued retry", "kind", kind, "name", name, "error", err)
+	}
+}
+
+// processRetryQueue retries the queued rotations that are due.
+func (b *backend) processRetryQueue(ctx context.Context, storage logical.Storage) error {
+	for _, kind := range []string{retryKindRole, retryKindCheckIn} {
+		names, err := storage.List(ctx, retryStoragePrefix+kind+"/")
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if strings.HasSuffix(name, "/") {
+				continue
+			}
+			task, err := readRetryTask(ctx, storage, kind, name)
+			if err != nil {
+				return err
+			}
+			if task == nil || task.Stopped || b.now().Before(task.NextAttempt) {
+				continue
+			}
+			var retryErr error
+			switch kind {
+			case retryKindRole:
+				retryErr = b.retryRoleRotation(ctx, storage, name)
+			case retryKindCheckIn:
+				retryErr = b.retryCheckIn(ctx, storage, task.SetName, name)
+			}
+			if retryErr != nil {
+				b.enqueueRetry(ctx, storage, kind, name, task.SetName, retryErr)
+				continue
+			}
+			b.clearRetry(ctx, storage, kind, name)
+			b.Logger().Info("retried rotation succeeded", "kind", kind, "name", name, "attempts", task.Attempts)
+		}
+	}
+	return nil
+}
+
+// retryRoleRotation rotates a role's password, unless the role no longer exists.
+func (b *backend) retryRoleRotation(ctx context.Context, storage logical.Storage, roleName string) error {
+	engineConf, err := readConfig(ctx, storage)
+	if err != nil {
+		return err
+	}
+	if engineConf == nil {
+		return errors.New("the config is currently unset")
+	}
+
+	b.credLock.Lock()
+	defer b.credLock.Unlock()
+
+	role, err := b.readRole(ctx, storage, roleName)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return nil
+	}
+	if role.DisableRotation {
+		// Rotation was disabled since the rotation failed, so there's nothing to retry.
+		b.clearRetry(ctx, storage, retryKindRole, roleName)
+		return nil
+	}
+	var previousCred map[string]interface{}
+	credEntry, err := storage.Get(ctx, storageKey+"/"+roleName)
+	if err != nil {
+		return err
+	}
+	if credEntry != nil {
+		if err := credEntry.DecodeJSON(&previousCred); err != nil {
+			return err
+		}
+	}
+	if _, err := b.generateAndReturnCreds(ctx, engineConf, storage, roleName, role, previousCred); err != nil {
+		return err
+	}
+	b.roleCache.Delete(roleName)
+	return nil
+}
+
+// retryCheckIn checks a service account in, unless it's already checked in or
+// no longer belongs to a set.
+func (b *backend) retryCheckIn(ctx context.Context, storage logical.Storage, setName, serviceAccountName string) error {
+	lock := locksutil.LockForKey(b.checkOutLocks, setName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, storage, serviceAccountName)
+	if err == errNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if checkOut.IsAvailable {
+		return nil
+	}
+	return b.checkOutHandler.CheckIn(ctx, storage, serviceAccountName)
+}
+
+// quarantined reports whether a library service account was quarantined
+// because its check-ins kept failing.
+func quarantined(ctx context.Context, storage logical.Storage, serviceAccountName string) (bool, error) {
+	task, err := readRetryTask(ctx, storage, retryKindCheckIn, serviceAccountName)
+	if err != nil {
+		return false, err
+	}
+	return task != nil && task.Quarantined, nil
+}
+
+// checkInDisabled reports whether a library service account was disabled
+// because its check-ins kept failing.
+func checkInDisabled(ctx context.Context, storage logical.Storage, serviceAccountName string) (bool, error) {
+	task, err := readRetryTask(ctx, storage, retryKindCheckIn, serviceAccountName)
+	if err != nil {
+		return false, err
+	}
+	return task != nil && task.Disabled, nil
+}
+
+func readRetryTask(ctx context.Context, storage logical.Storage, kind, name string) (*retryTask, error) {
+	entry, err := storage.Get(ctx, retryStoragePrefix+kind+"/"+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	task := &retryTask{}
+	if err := entry.DecodeJSON(task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
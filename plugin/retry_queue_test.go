@@ -0,0 +1,431 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+// failingUpdateClient is a fakeSecretsClient whose password updates fail while
+// failUpdates is set, like when AD refuses writes but can still be read.
+type failingUpdateClient struct {
+	fakeSecretsClient
+	failUpdates bool
+}
+
+func (c *failingUpdateClient) UpdatePassword(conf *client.ADConf, serviceAccountName string, newPassword string) error {
+	if c.failUpdates {
+		return errors.New("unable to update password")
+	}
+	return c.fakeSecretsClient.UpdatePassword(conf, serviceAccountName, newPassword)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	for attempts, expected := range map[int]time.Duration{
+		1:  time.Minute,
+		2:  2 * time.Minute,
+		4:  8 * time.Minute,
+		7:  time.Hour,
+		50: time.Hour,
+	} {
+		if actual := retryBackoff(attempts); actual != expected {
+			t.Errorf("attempts %d: expected %s but received %s", attempts, expected, actual)
+		}
+	}
+}
+
+func TestRetryQueue(t *testing.T) {
+	fake := &failingUpdateClient{}
+	b, storage := getBackend(t, fake, testConfig())
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	b.checkOutHandler.now = b.now
+	handle := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+			EntityID:  "borrower",
+		})
+	}
+	request := requester(t, b, storage, "borrower")
+	task := func(kind, name string) *retryTask {
+		t.Helper()
+		task, err := readRetryTask(ctx, storage, kind, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return task
+	}
+	periodic := func() {
+		t.Helper()
+		if err := b.periodicFunc(ctx, &logical.Request{Storage: storage}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if resp := request(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@example.com",
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to create role: %#v", resp)
+	}
+	if resp := request(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"lib@example.com"},
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to create set: %#v", resp)
+	}
+	if resp := request(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil); resp == nil || resp.IsError() {
+		t.Fatalf("unable to check out: %#v", resp)
+	}
+
+	// AD refuses password changes, so both rotations fail and are queued.
+	fake.failUpdates = true
+	if _, err := handle(logical.UpdateOperation, rotateRolePath+"app", nil); err == nil {
+		t.Fatal("expected rotate-role to fail")
+	}
+	if _, err := handle(logical.UpdateOperation, libraryPrefix+"lib/check-in", nil); err == nil {
+		t.Fatal("expected check-in to fail")
+	}
+	if task := task(retryKindRole, "app"); task == nil || task.Attempts != 1 || task.LastError == "" {
+		t.Fatalf("expected the role rotation to be queued but received %#v", task)
+	}
+	if task := task(retryKindCheckIn, "lib@example.com"); task == nil || task.Attempts != 1 || task.SetName != "lib" {
+		t.Fatalf("expected the check-in to be queued but received %#v", task)
+	}
+
+	// Retries back off after each failure.
+	now = now.Add(time.Minute)
+	periodic()
+	if task := task(retryKindRole, "app"); task.Attempts != 2 || !task.NextAttempt.Equal(now.Add(2*time.Minute)) {
+		t.Fatalf("expected a second attempt backing off 2m but received %#v", task)
+	}
+	now = now.Add(time.Minute)
+	periodic()
+	if task := task(retryKindRole, "app"); task.Attempts != 2 {
+		t.Fatalf("expected no attempt before the backoff elapsed but received %#v", task)
+	}
+
+	// Once AD is back, the retries succeed and are dropped.
+	fake.failUpdates = false
+	now = now.Add(time.Minute)
+	periodic()
+	if task := task(retryKindRole, "app"); task != nil {
+		t.Fatalf("expected the role retry to be dropped but received %#v", task)
+	}
+	if task := task(retryKindCheckIn, "lib@example.com"); task != nil {
+		t.Fatalf("expected the check-in retry to be dropped but received %#v", task)
+	}
+	checkOut, err := b.checkOutHandler.LoadCheckOut(ctx, storage, "lib@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !checkOut.IsAvailable {
+		t.Fatal("expected the retried check-in to make the account available")
+	}
+
+	// Retries for roles that were deleted are dropped.
+	fake.failUpdates = true
+	handle(logical.UpdateOperation, rotateRolePath+"app", nil)
+	fake.failUpdates = false
+	request(logical.DeleteOperation, rolePrefix+"app", nil)
+	now = now.Add(time.Minute)
+	periodic()
+	if task := task(retryKindRole, "app"); task != nil {
+		t.Fatalf("expected the retry of a deleted role to be dropped but received %#v", task)
+	}
+}
+
+func TestFailurePolicy(t *testing.T) {
+	fake := &failingUpdateClient{}
+	b, storage := getBackend(t, fake, testConfig())
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	b.checkOutHandler.now = b.now
+	handle := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+			EntityID:  "borrower",
+		})
+	}
+	request := requester(t, b, storage, "borrower")
+	periodic := func() {
+		t.Helper()
+		if err := b.periodicFunc(ctx, &logical.Request{Storage: storage}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp := request(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@example.com",
+		"failure_action":       "explode",
+	})
+	if responseErrorCode(resp) != string(errCodeInvalidRequest) {
+		t.Fatalf("expected an invalid failure_action to be rejected but received %#v", resp)
+	}
+	if resp := request(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@example.com",
+		"failure_threshold":    2,
+		"failure_action":       failureActionDisable,
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to create role: %#v", resp)
+	}
+	if resp := request(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"lib@example.com"},
+		"failure_threshold":     1,
+		"failure_action":        failureActionStop,
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to create set: %#v", resp)
+	}
+	if resp := request(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil); resp == nil || resp.IsError() {
+		t.Fatalf("unable to check out: %#v", resp)
+	}
+
+	fake.failUpdates = true
+	handle(logical.UpdateOperation, rotateRolePath+"app", nil)
+	handle(logical.UpdateOperation, libraryPrefix+"lib/check-in", nil)
+
+	// The check-in reached its threshold on the first failure, so it isn't retried.
+	resp = request(logical.ReadOperation, libraryPrefix+"lib/status", nil)
+	if status := resp.Data["lib@example.com"].(map[string]interface{}); status["available"] != false || status["check_in_stopped"] != true {
+		t.Fatalf("expected the check-in to be stopped but received %#v", status)
+	}
+
+	// The role is disabled once its retry fails too.
+	if resp := request(logical.ReadOperation, rolePrefix+"app", nil); resp.Data["rotation_failures"] != 1 || resp.Data["disabled"] != false {
+		t.Fatalf("expected the role to still be enabled but received %#v", resp.Data)
+	}
+	now = now.Add(time.Minute)
+	periodic()
+	if resp := request(logical.ReadOperation, "creds/app", nil); responseErrorCode(resp) != string(errCodeRoleDisabled) {
+		t.Fatalf("expected the role to be disabled but received %#v", resp)
+	}
+	resp = request(logical.ReadOperation, rolePrefix+"app", nil)
+	if resp.Data["rotation_failures"] != 2 || resp.Data["rotation_stopped"] != true || resp.Data["disabled"] != true {
+		t.Fatalf("expected the role to report being disabled but received %#v", resp.Data)
+	}
+
+	// Neither is retried once AD is back.
+	fake.failUpdates = false
+	now = now.Add(time.Hour)
+	periodic()
+	if task, err := readRetryTask(ctx, storage, retryKindCheckIn, "lib@example.com"); err != nil || task == nil || task.Attempts != 1 {
+		t.Fatalf("expected the stopped check-in not to be retried but received %#v, %v", task, err)
+	}
+	if resp := request(logical.ReadOperation, "creds/app", nil); responseErrorCode(resp) != string(errCodeRoleDisabled) {
+		t.Fatalf("expected the role to still be disabled but received %#v", resp)
+	}
+
+	// Rotating the role enables it again.
+	if resp := request(logical.UpdateOperation, rotateRolePath+"app", nil); resp != nil && resp.IsError() {
+		t.Fatalf("unable to rotate role: %#v", resp)
+	}
+	if resp := request(logical.ReadOperation, "creds/app", nil); resp == nil || resp.IsError() {
+		t.Fatalf("expected the role to be enabled but received %#v", resp)
+	}
+}
+
+func TestDisabledCheckIn(t *testing.T) {
+	fake := &failingUpdateClient{}
+	b, storage := getBackend(t, fake, testConfig())
+	request := requester(t, b, storage, "borrower")
+	status := func() map[string]interface{} {
+		t.Helper()
+		return request(logical.ReadOperation, libraryPrefix+"lib/status", nil).Data["lib@example.com"].(map[string]interface{})
+	}
+
+	if resp := request(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"lib@example.com"},
+		"failure_threshold":     1,
+		"failure_action":        failureActionDisable,
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to create set: %#v", resp)
+	}
+	if resp := request(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil); resp == nil || resp.IsError() {
+		t.Fatalf("unable to check out: %#v", resp)
+	}
+
+	fake.failUpdates = true
+	b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      libraryPrefix + "lib/check-in",
+		Storage:   storage,
+		EntityID:  "borrower",
+	})
+	if s := status(); s["disabled"] != true || s["check_in_stopped"] != true || s["available"] != false {
+		t.Fatalf("expected the account to be disabled but received %#v", s)
+	}
+
+	// It isn't lent even if it's made available without a successful check-in.
+	if err := b.checkOutHandler.Update(ctx, storage, "lib@example.com", &CheckOut{IsAvailable: true}); err != nil {
+		t.Fatal(err)
+	}
+	fake.failUpdates = false
+	if resp := request(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil); responseErrorCode(resp) != string(errCodeNoAccountsAvailable) {
+		t.Fatalf("expected the disabled account not to be lent but received %#v", resp)
+	}
+
+	// Checking it in through the manage path enables it again.
+	if err := b.checkOutHandler.Update(ctx, storage, "lib@example.com", &CheckOut{BorrowerEntityID: "borrower"}); err != nil {
+		t.Fatal(err)
+	}
+	if resp := request(logical.UpdateOperation, libraryPrefix+"manage/lib/check-in", nil); resp == nil || resp.IsError() {
+		t.Fatalf("unable to check in: %#v", resp)
+	}
+	if s := status(); s["disabled"] != nil {
+		t.Fatalf("expected the account to be enabled but received %#v", s)
+	}
+	if resp := request(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil); resp == nil || resp.IsError() {
+		t.Fatalf("expected the account to be lent again but received %#v", resp)
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	fake := &failingUpdateClient{}
+	b, storage := getBackend(t, fake, testConfig())
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	b.checkOutHandler.now = b.now
+	handle := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+			EntityID:  "borrower",
+		})
+	}
+	request := requester(t, b, storage, "borrower")
+	status := func() map[string]interface{} {
+		t.Helper()
+		return request(logical.ReadOperation, libraryPrefix+"lib/status", nil).Data["lib@example.com"].(map[string]interface{})
+	}
+
+	if resp := request(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@example.com",
+		"failure_threshold":    1,
+		"failure_action":       failureActionQuarantine,
+	}); responseErrorCode(resp) != string(errCodeInvalidRequest) {
+		t.Fatalf("expected roles not to be quarantinable but received %#v", resp)
+	}
+	if resp := request(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"lib@example.com"},
+		"failure_threshold":     2,
+		"failure_action":        failureActionQuarantine,
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to create set: %#v", resp)
+	}
+	checkOut := request(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil)
+	if checkOut == nil || checkOut.IsError() {
+		t.Fatalf("unable to check out: %#v", checkOut)
+	}
+
+	fake.failUpdates = true
+	handle(logical.UpdateOperation, libraryPrefix+"lib/check-in", nil)
+	if s := status(); s["quarantined"] != nil {
+		t.Fatalf("expected the account not to be quarantined before the threshold but received %#v", s)
+	}
+	handle(logical.UpdateOperation, libraryPrefix+"lib/check-in", nil)
+	if s := status(); s["quarantined"] != true || s["available"] != false || s["check_in_failures"] != 2 {
+		t.Fatalf("expected the account to be quarantined but received %#v", s)
+	}
+
+	// The borrower can neither check it in nor keep it, and it isn't lent to anyone else.
+	if resp := request(logical.UpdateOperation, libraryPrefix+"lib/check-in", nil); responseErrorCode(resp) != string(errCodeAccountQuarantined) {
+		t.Fatalf("expected the borrower's check-in to be refused but received %#v", resp)
+	}
+	renewal, err := b.renewCheckOut(ctx, &logical.Request{Storage: storage, Secret: checkOut.Secret}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if responseErrorCode(renewal) != string(errCodeAccountQuarantined) {
+		t.Fatalf("expected the renewal to be refused but received %#v", renewal)
+	}
+	if resp := request(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil); responseErrorCode(resp) != string(errCodeNoAccountsAvailable) {
+		t.Fatalf("expected the account not to be lent but received %#v", resp)
+	}
+
+	// An operator releases it by checking it in once AD is fixed.
+	fake.failUpdates = false
+	now = now.Add(time.Hour)
+	if err := b.periodicFunc(ctx, &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	if s := status(); s["quarantined"] != true {
+		t.Fatalf("expected the quarantined check-in not to be retried but received %#v", s)
+	}
+	if resp := request(logical.UpdateOperation, libraryPrefix+"manage/lib/check-in", nil); resp == nil || resp.IsError() {
+		t.Fatalf("unable to check in: %#v", resp)
+	}
+	if task, err := readRetryTask(ctx, storage, retryKindCheckIn, "lib@example.com"); err != nil || task != nil {
+		t.Fatalf("expected the quarantine to be released but received %#v, %v", task, err)
+	}
+	if resp := request(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil); resp == nil || resp.IsError() {
+		t.Fatalf("expected the account to be lent again but received %#v", resp)
+	}
+}
+
+func TestFailurePolicyThresholdLowered(t *testing.T) {
+	fake := &failingUpdateClient{}
+	b, storage := getBackend(t, fake, testConfig())
+	request := requester(t, b, storage, "")
+	rotate := func() {
+		t.Helper()
+		if _, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      rotateRolePath + "app",
+			Storage:   storage,
+		}); err == nil {
+			t.Fatal("expected rotate-role to fail")
+		}
+	}
+
+	if resp := request(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@example.com",
+		"failure_threshold":    5,
+		"failure_action":       failureActionEvent,
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to create role: %#v", resp)
+	}
+	fake.failUpdates = true
+	rotate()
+	rotate()
+
+	// The threshold is lowered below the failures already made, so the action
+	// is taken on the next failure, and only once.
+	if resp := request(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@example.com",
+		"failure_threshold":    1,
+		"failure_action":       failureActionEvent,
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to update role: %#v", resp)
+	}
+	rotate()
+	task, err := readRetryTask(ctx, storage, retryKindRole, "app")
+	if err != nil || task == nil || !task.PolicyApplied {
+		t.Fatalf("expected the failure action to be taken but received %#v, %v", task, err)
+	}
+
+	// Switching to stop doesn't take it again until the rotation succeeds.
+	if resp := request(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@example.com",
+		"failure_threshold":    1,
+		"failure_action":       failureActionStop,
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("unable to update role: %#v", resp)
+	}
+	rotate()
+	if task, err := readRetryTask(ctx, storage, retryKindRole, "app"); err != nil || task == nil || task.Stopped || task.Attempts != 4 {
+		t.Fatalf("expected the failure action not to be taken again but received %#v, %v", task, err)
+	}
+}
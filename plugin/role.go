@@ -4,14 +4,43 @@
 package plugin
 
 import (
+	"errors"
 	"time"
+
+	"github.com/robfig/cron/v3"
 )
 
+// minRotationWindow is the shortest rotation_window a role may have.
+const minRotationWindow = time.Hour
+
+// rotationScheduleParser parses standard five-field cron expressions, like the
+// database engine's rotation_schedule.
+var rotationScheduleParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// errRotationDisabled is returned when something would rotate the password of a
+// role with disable_rotation set.
+var errRotationDisabled = errors.New("rotation is disabled for the role, its password is managed outside of Vault")
+
 type backendRole struct {
-	ServiceAccountName string    `json:"service_account_name"`
-	TTL                int       `json:"ttl"`
-	LastVaultRotation  time.Time `json:"last_vault_rotation"`
-	PasswordLastSet    time.Time `json:"password_last_set"`
+	ServiceAccountName  string               `json:"service_account_name"`
+	Config              string               `json:"config,omitempty"`
+	TTL                 int                  `json:"ttl"`
+	RotationSchedule    string               `json:"rotation_schedule,omitempty"`
+	RotationWindow      int                  `json:"rotation_window,omitempty"`
+	MaxPasswordAge      int                  `json:"max_password_age,omitempty"`
+	MinRotationInterval int                  `json:"min_rotation_interval,omitempty"`
+	AllowPrivileged     bool                 `json:"allow_privileged,omitempty"`
+	FailureThreshold    int                  `json:"failure_threshold,omitempty"`
+	FailureAction       string               `json:"failure_action,omitempty"`
+	PasswordComposition *passwordComposition `json:"password_composition,omitempty"`
+	VerifyAfterRotation bool                 `json:"verify_after_rotation,omitempty"`
+	OmitLastPassword    bool                 `json:"omit_last_password,omitempty"`
+	DisableRotation     bool                 `json:"disable_rotation,omitempty"`
+	Notes               string               `json:"notes,omitempty"`
+	UpdatedBy           string               `json:"updated_by,omitempty"`
+	UpdatedAt           time.Time            `json:"updated_at"`
+	LastVaultRotation   time.Time            `json:"last_vault_rotation"`
+	PasswordLastSet     time.Time            `json:"password_last_set"`
 }
 
 func (r *backendRole) Map() map[string]interface{} {
@@ -20,7 +49,63 @@ func (r *backendRole) Map() map[string]interface{} {
 		"ttl":                  r.TTL,
 	}
 
+	if r.Config != "" {
+		m["config"] = r.Config
+	}
+
+	if r.RotationSchedule != "" {
+		m["rotation_schedule"] = r.RotationSchedule
+		m["rotation_window"] = r.RotationWindow
+	}
+
+	if r.MaxPasswordAge > 0 {
+		m["max_password_age"] = r.MaxPasswordAge
+	}
+
+	if r.MinRotationInterval > 0 {
+		m["min_rotation_interval"] = r.MinRotationInterval
+	}
+
+	if r.AllowPrivileged {
+		m["allow_privileged"] = r.AllowPrivileged
+	}
+
+	if r.FailureThreshold > 0 {
+		m["failure_threshold"] = r.FailureThreshold
+		m["failure_action"] = r.FailureAction
+	}
+
+	if r.VerifyAfterRotation {
+		m["verify_after_rotation"] = r.VerifyAfterRotation
+	}
+
+	if r.OmitLastPassword {
+		m["omit_last_password"] = r.OmitLastPassword
+	}
+
+	if r.DisableRotation {
+		m["disable_rotation"] = r.DisableRotation
+	}
+
+	if r.PasswordComposition != nil {
+		m["min_digits"] = r.PasswordComposition.MinDigits
+		m["min_uppercase"] = r.PasswordComposition.MinUppercase
+		m["min_symbols"] = r.PasswordComposition.MinSymbols
+		m["charset"] = r.PasswordComposition.Charset
+		m["exclude_characters"] = r.PasswordComposition.ExcludeCharacters
+	}
+
+	if r.Notes != "" {
+		m["notes"] = r.Notes
+	}
+	if r.UpdatedBy != "" {
+		m["updated_by"] = r.UpdatedBy
+	}
+
 	var unset time.Time
+	if r.UpdatedAt != unset {
+		m["updated_at"] = r.UpdatedAt
+	}
 	if r.LastVaultRotation != unset {
 		m["last_vault_rotation"] = r.LastVaultRotation
 	}
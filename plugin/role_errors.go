@@ -0,0 +1,74 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	roleErrorStoragePrefix = "role-error/"
+
+	// roleErrorLookup is an error looking up a role's service account in AD.
+	roleErrorLookup = "lookup"
+	// roleErrorRotation is an error changing a role's password in AD.
+	roleErrorRotation = "rotation"
+	// roleErrorVerification is an error binding with a role's new password.
+	roleErrorVerification = "verification"
+)
+
+// roleError is the most recent error from AD for a role, so it can be read
+// along with the role instead of searched for in the server logs. It's kept
+// after later requests succeed, and Time tells whether it's still relevant.
+type roleError struct {
+	Operation string    `json:"operation"`
+	Error     string    `json:"error"`
+	Time      time.Time `json:"time"`
+}
+
+func (e *roleError) Map() map[string]interface{} {
+	return map[string]interface{}{
+		"operation": e.Operation,
+		"error":     e.Error,
+		"time":      e.Time,
+	}
+}
+
+// recordRoleError stores the error as the role's most recent error from AD.
+// Failing to store it is only logged, so the original error is still returned.
+func (b *backend) recordRoleError(ctx context.Context, storage logical.Storage, roleName, operation string, cause error) {
+	// Reads of a role are served by performance standbys, which can't write to storage.
+	if b.isReplicatedFollower() {
+		return
+	}
+	entry, err := logical.StorageEntryJSON(roleErrorStoragePrefix+roleName, &roleError{
+		Operation: operation,
+		Error:     cause.Error(),
+		Time:      b.now().UTC(),
+	})
+	if err == nil {
+		err = storage.Put(ctx, entry)
+	}
+	if err != nil {
+		b.Logger().Warn("unable to record role error", "role", roleName, "error", err)
+	}
+}
+
+func readRoleError(ctx context.Context, storage logical.Storage, roleName string) (*roleError, error) {
+	entry, err := storage.Get(ctx, roleErrorStoragePrefix+roleName)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	roleErr := &roleError{}
+	if err := entry.DecodeJSON(roleErr); err != nil {
+		return nil, err
+	}
+	return roleErr, nil
+}
@@ -0,0 +1,91 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+// failingLookupClient is a failingUpdateClient whose password last set lookups
+// also fail while failLookups is set.
+type failingLookupClient struct {
+	failingUpdateClient
+	failLookups bool
+}
+
+func (c *failingLookupClient) GetPasswordLastSet(conf *client.ADConf, serviceAccountName string) (time.Time, error) {
+	if c.failLookups {
+		return time.Time{}, errors.New("unable to look up service account")
+	}
+	return c.failingUpdateClient.GetPasswordLastSet(conf, serviceAccountName)
+}
+
+func TestRoleLastLDAPError(t *testing.T) {
+	fake := &failingLookupClient{}
+	b, storage := getBackend(t, fake, testConfig())
+	handle := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+	}
+	readRole := func() *logical.Response {
+		t.Helper()
+		resp, err := handle(logical.ReadOperation, rolePrefix+"app", nil)
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("unable to read role: %#v, %v", resp, err)
+		}
+		return resp
+	}
+
+	if resp, err := handle(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name": "app@example.com",
+	}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("unable to create role: %#v, %v", resp, err)
+	}
+	if _, ok := readRole().Data["last_ldap_error"]; ok {
+		t.Fatal("expected no error before one occurred")
+	}
+
+	fake.failUpdates = true
+	if _, err := handle(logical.ReadOperation, "creds/app", nil); err == nil {
+		t.Fatal("expected the rotation to fail")
+	}
+	lastErr := readRole().Data["last_ldap_error"].(map[string]interface{})
+	if lastErr["operation"] != roleErrorRotation || lastErr["error"] != "unable to update password" {
+		t.Fatalf("expected the rotation error but received %#v", lastErr)
+	}
+
+	// The role can still be read when its service account can't be looked up.
+	fake.failLookups = true
+	b.roleCache.Flush()
+	resp := readRole()
+	lastErr = resp.Data["last_ldap_error"].(map[string]interface{})
+	if lastErr["operation"] != roleErrorLookup || lastErr["error"] != "unable to look up service account" {
+		t.Fatalf("expected the lookup error but received %#v", lastErr)
+	}
+	if resp.Data["service_account_name"] != "app@example.com" {
+		t.Fatalf("expected the stored role but received %#v", resp.Data)
+	}
+	if len(resp.Warnings) == 0 || !strings.Contains(resp.Warnings[0], "unable to look up") {
+		t.Fatalf("expected a warning about the failed lookup but received %#v", resp.Warnings)
+	}
+
+	fake.failLookups = false
+	if _, err := handle(logical.DeleteOperation, rolePrefix+"app", nil); err != nil {
+		t.Fatal(err)
+	}
+	if roleErr, err := readRoleError(ctx, storage, "app"); err != nil || roleErr != nil {
+		t.Fatalf("expected the error to be deleted with the role but received %#v, %v", roleErr, err)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// rotateAgedRolePasswords rotates the passwords of roles whose password, according
+// to Active Directory, is older than their max_password_age. Without it, a role
+// whose creds are never read would never have its password rotated.
+func (b *backend) rotateAgedRolePasswords(ctx context.Context, storage logical.Storage) error {
+	roleNames, err := storage.List(ctx, roleStorageKey+"/")
+	if err != nil {
+		return err
+	}
+	if len(roleNames) == 0 {
+		return nil
+	}
+	engineConf, err := readConfig(ctx, storage)
+	if err != nil {
+		return err
+	}
+	if engineConf == nil {
+		return nil
+	}
+	for _, roleName := range roleNames {
+		if err := b.rotateAgedRolePassword(ctx, storage, engineConf, roleName); err != nil {
+			// Keep going so one failing role doesn't hold back the rest.
+			b.Logger().Error("unable to rotate aged role password", "role", roleName, "error", err)
+		}
+	}
+	return nil
+}
+
+func (b *backend) rotateAgedRolePassword(ctx context.Context, storage logical.Storage, engineConf *configuration, roleName string) error {
+	// Roles are only read with the cred lock held, see credReadOperation.
+	b.credLock.Lock()
+	defer b.credLock.Unlock()
+
+	entry, err := storage.Get(ctx, roleStorageKey+"/"+roleName)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+	stored := &backendRole{}
+	if err := entry.DecodeJSON(stored); err != nil {
+		return err
+	}
+	if stored.MaxPasswordAge <= 0 || stored.DisableRotation {
+		// Skip asking AD about roles that don't enforce an age.
+		return nil
+	}
+
+	role, err := b.readRole(ctx, storage, roleName)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return nil
+	}
+	maxPasswordAge := time.Duration(role.MaxPasswordAge) * time.Second
+	if b.now().Before(role.PasswordLastSet.Add(maxPasswordAge)) {
+		return nil
+	}
+
+	var previousCred map[string]interface{}
+	credEntry, err := storage.Get(ctx, storageKey+"/"+roleName)
+	if err != nil {
+		return err
+	}
+	if credEntry != nil {
+		if err := credEntry.DecodeJSON(&previousCred); err != nil {
+			return err
+		}
+	}
+	if _, err := b.generateAndReturnCreds(ctx, engineConf, storage, roleName, role, previousCred); err != nil {
+		b.enqueueRetry(ctx, storage, retryKindRole, roleName, "", err)
+		return err
+	}
+	// The cached role still shows the password as last set before we rotated it.
+	b.roleCache.Delete(roleName)
+	b.Logger().Info("rotated password past its max_password_age", "role", roleName, "password_last_set", role.PasswordLastSet)
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestRotateAgedRolePasswords(t *testing.T) {
+	config := testConfig()
+	config.ADConf.UserDN = "OU=Service Accounts,DC=example,DC=com"
+	config.ADConf.DevMode = true
+	b, storage := getBackend(t, newDevModeClient(&fakeSecretsClient{}), config)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	for roleName, maxPasswordAge := range map[string]string{"aged": "1h", "unaged": "0"} {
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      rolePrefix + roleName,
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"service_account_name": roleName + "@example.com",
+				"max_password_age":     maxPasswordAge,
+			},
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+		}
+	}
+	currentPassword := func(roleName string) string {
+		entry, err := storage.Get(ctx, storageKey+"/"+roleName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry == nil {
+			return ""
+		}
+		cred := make(map[string]interface{})
+		if err := entry.DecodeJSON(&cred); err != nil {
+			t.Fatal(err)
+		}
+		return cred["current_password"].(string)
+	}
+
+	// The password has never been set, so it's past any max age.
+	if err := b.rotateAgedRolePasswords(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+	rotated := currentPassword("aged")
+	if rotated == "" {
+		t.Fatal("expected the aged role's password to be rotated")
+	}
+	if currentPassword("unaged") != "" {
+		t.Fatal("expected the role without a max_password_age to be left alone")
+	}
+
+	if err := b.rotateAgedRolePasswords(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+	if currentPassword("aged") != rotated {
+		t.Fatal("expected a fresh password to be left alone")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if err := b.rotateAgedRolePasswords(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+	if currentPassword("aged") == rotated {
+		t.Fatal("expected the aged role's password to be rotated again")
+	}
+}
@@ -88,3 +88,62 @@ func TestTTLTooHigh(t *testing.T) {
 		t.Fatal("should error when ttl is too high")
 	}
 }
+
+func TestSetRotation(t *testing.T) {
+	passwordConf := passwordConf{
+		TTL:    defaultTTLInt,
+		MaxTTL: maxTTLInt,
+		Length: defaultPasswordLength,
+	}
+	testCases := map[string]struct {
+		raw     map[string]interface{}
+		wantErr bool
+	}{
+		"schedule": {
+			raw: map[string]interface{}{"rotation_schedule": "0 0 * * SAT"},
+		},
+		"schedule and window": {
+			raw: map[string]interface{}{"rotation_schedule": "@daily", "rotation_window": "2h"},
+		},
+		"invalid schedule": {
+			raw:     map[string]interface{}{"rotation_schedule": "every saturday"},
+			wantErr: true,
+		},
+		"schedule and ttl": {
+			raw:     map[string]interface{}{"rotation_schedule": "@daily", "ttl": 10},
+			wantErr: true,
+		},
+		"window too short": {
+			raw:     map[string]interface{}{"rotation_schedule": "@daily", "rotation_window": "10m"},
+			wantErr: true,
+		},
+		"window without schedule": {
+			raw:     map[string]interface{}{"rotation_window": "2h"},
+			wantErr: true,
+		},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			role := &backendRole{}
+			err := setRotation(role, passwordConf, &framework.FieldData{
+				Raw:    testCase.raw,
+				Schema: schema,
+			})
+			if testCase.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if role.RotationSchedule != testCase.raw["rotation_schedule"] {
+				t.Fatalf("expected schedule %q but received %q", testCase.raw["rotation_schedule"], role.RotationSchedule)
+			}
+			if role.TTL != 0 {
+				t.Fatalf("expected no ttl but received %d", role.TTL)
+			}
+		})
+	}
+}
@@ -9,29 +9,53 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/mitchellh/mapstructure"
 )
 
 const (
 	rotateCredentialWAL = "rotateCredentialWAL"
+	checkInWAL          = "checkInWAL"
 )
 
 // rotateCredentialEntry is used to store information in a WAL that can retry a
-// credential rotation in the event of partial failure.
+// credential rotation in the event of partial failure. It holds only what the
+// rotation changes; the rest of the role is read from storage when it's rolled
+// back, so it doesn't need to track every role field.
 type rotateCredentialEntry struct {
-	LastVaultRotation  time.Time `json:"last_vault_rotation"`
-	LastPassword       string    `json:"last_password"`
-	CurrentPassword    string    `json:"current_password"`
-	RoleName           string    `json:"name"`
-	ServiceAccountName string    `json:"service_account_name"`
-	TTL                int       `json:"ttl"`
+	LastVaultRotation  time.Time `json:"last_vault_rotation" mapstructure:"last_vault_rotation"`
+	LastPassword       string    `json:"last_password" mapstructure:"last_password"`
+	CurrentPassword    string    `json:"current_password" mapstructure:"current_password"`
+	RoleName           string    `json:"name" mapstructure:"name"`
+	ServiceAccountName string    `json:"service_account_name" mapstructure:"service_account_name"`
+}
+
+// checkInEntry is used to store information in a WAL that can complete a
+// library check-in in the event of partial failure.
+type checkInEntry struct {
+	ServiceAccountName string `json:"service_account_name" mapstructure:"service_account_name"`
+	Password           string `json:"password" mapstructure:"password"`
+	// Ciphertext replaces Password when the config's transit_key_name is set,
+	// like it does in the stored password, and TransitKey is the key that
+	// encrypted it.
+	Ciphertext string      `json:"ciphertext,omitempty" mapstructure:"ciphertext"`
+	TransitKey *transitKey `json:"transit_key,omitempty" mapstructure:"transit_key"`
+	// RotatedAt is when the check-in's rotation started, in RFC 3339 format, so
+	// the rollback doesn't replace a password a later rotation stored.
+	RotatedAt string `json:"rotated_at" mapstructure:"rotated_at"`
 }
 
 func (b *backend) walRollback(ctx context.Context, req *logical.Request, kind string, data interface{}) error {
+	if b.isReplicatedFollower() {
+		// Leave the WAL in place for the cluster that owns it.
+		return fmt.Errorf("skipping rollback of %q because this cluster is a replicated follower", kind)
+	}
 	switch kind {
 	case rotateCredentialWAL:
 		return b.handleRotateCredentialRollback(ctx, req.Storage, data)
+	case checkInWAL:
+		return b.handleCheckInRollback(ctx, req.Storage, data)
 	default:
 		return fmt.Errorf("unknown WAL entry kind %q", kind)
 	}
@@ -39,7 +63,7 @@ func (b *backend) walRollback(ctx context.Context, req *logical.Request, kind st
 
 func (b *backend) handleRotateCredentialRollback(ctx context.Context, storage logical.Storage, data interface{}) error {
 	var wal rotateCredentialEntry
-	if err := mapstructure.WeakDecode(data, &wal); err != nil {
+	if err := decodeWAL(data, &wal); err != nil {
 		return err
 	}
 
@@ -48,6 +72,13 @@ func (b *backend) handleRotateCredentialRollback(ctx context.Context, storage lo
 		return nil
 	}
 
+	b.credLock.Lock()
+	defer b.credLock.Unlock()
+
+	lock := locksutil.LockForKey(b.rotationLocks, wal.ServiceAccountName)
+	lock.Lock()
+	defer lock.Unlock()
+
 	// Check creds for deltas. Exit if creds and WAL are the same.
 	path := fmt.Sprintf("%s/%s", storageKey, wal.RoleName)
 	credEntry, err := storage.Get(ctx, path)
@@ -64,11 +95,16 @@ func (b *backend) handleRotateCredentialRollback(ctx context.Context, storage lo
 		}
 	}
 
-	role := &backendRole{
-		ServiceAccountName: wal.ServiceAccountName,
-		TTL:                wal.TTL,
-		LastVaultRotation:  wal.LastVaultRotation,
+	// If the role was deleted since, or now manages another account, there's
+	// nothing left to roll back.
+	role, err := readStoredRole(ctx, storage, wal.RoleName)
+	if err != nil {
+		return err
+	}
+	if role == nil || role.ServiceAccountName != wal.ServiceAccountName {
+		return nil
 	}
+	role.LastVaultRotation = wal.LastVaultRotation
 
 	if err := b.writeRoleToStorage(ctx, storage, wal.RoleName, role); err != nil {
 		return err
@@ -84,6 +120,9 @@ func (b *backend) handleRotateCredentialRollback(ctx context.Context, storage lo
 	if conf == nil {
 		return errors.New("the config is currently unset")
 	}
+	if conf, err = configFor(ctx, storage, conf, role.Config); err != nil {
+		return err
+	}
 
 	if err := b.client.UpdatePassword(conf.ADConf, role.ServiceAccountName, wal.CurrentPassword); err != nil {
 		return err
@@ -96,9 +135,6 @@ func (b *backend) handleRotateCredentialRollback(ctx context.Context, storage lo
 		return err
 	}
 
-	b.credLock.Lock()
-	defer b.credLock.Unlock()
-
 	cred := map[string]interface{}{
 		"username":         username,
 		"current_password": wal.CurrentPassword,
@@ -122,3 +158,86 @@ func (b *backend) handleRotateCredentialRollback(ctx context.Context, storage lo
 
 	return nil
 }
+
+// decodeWAL decodes a WAL's data, which was read back from JSON, into entry.
+// Times were stored as RFC 3339 strings.
+func decodeWAL(data interface{}, entry interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeHookFunc(time.RFC3339Nano),
+		WeaklyTypedInput: true,
+		Result:           entry,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(data)
+}
+
+// handleCheckInRollback rolls a partially completed check-in forward. The
+// borrower may know the account's previous password, so rather than restoring
+// it, the password from the WAL is set in AD and stored.
+func (b *backend) handleCheckInRollback(ctx context.Context, storage logical.Storage, data interface{}) error {
+	var wal checkInEntry
+	if err := mapstructure.WeakDecode(data, &wal); err != nil {
+		return err
+	}
+	if wal.ServiceAccountName == "" || (wal.Password == "" && wal.Ciphertext == "") {
+		b.Logger().Warn("WAL does not contain a password for service account")
+		return nil
+	}
+
+	lock := locksutil.LockForKey(b.rotationLocks, wal.ServiceAccountName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// If the account is no longer in a set, there's nothing left to reconcile.
+	if _, err := b.checkOutHandler.LoadCheckOut(ctx, storage, wal.ServiceAccountName); err != nil {
+		if err == errNotFound {
+			return nil
+		}
+		return err
+	}
+
+	// If a later rotation stored a password, it's the one in AD.
+	if wal.RotatedAt != "" {
+		rotatedAt, err := time.Parse(time.RFC3339Nano, wal.RotatedAt)
+		if err != nil {
+			return err
+		}
+		stored, err := loadPasswordMetadata(ctx, storage, wal.ServiceAccountName)
+		if err != nil && err != errNotFound {
+			return err
+		}
+		if stored != nil && stored.LastRotated.After(rotatedAt) {
+			return nil
+		}
+	}
+
+	conf, err := readConfig(ctx, storage)
+	if err != nil {
+		return err
+	}
+	if conf == nil {
+		return errors.New("the config is currently unset")
+	}
+	password := &storedPassword{Password: wal.Password, Ciphertext: wal.Ciphertext, TransitKey: wal.TransitKey}
+	if err := unsealPassword(ctx, b.transit, conf, password); err != nil {
+		return err
+	}
+
+	// If the check-in got as far as storing the password, AD and Vault already agree.
+	storedPassword, err := retrievePassword(ctx, storage, b.transit, wal.ServiceAccountName)
+	if err != nil && err != errNotFound {
+		return err
+	}
+	if storedPassword == password.Password {
+		return nil
+	}
+	if conf, err = libraryConf(ctx, storage, conf, wal.ServiceAccountName); err != nil {
+		return err
+	}
+	if err := b.client.UpdatePassword(conf.ADConf, wal.ServiceAccountName, password.Password); err != nil {
+		return err
+	}
+	return storePassword(ctx, storage, b.transit, wal.ServiceAccountName, password.Password, b.now())
+}
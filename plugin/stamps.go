@@ -0,0 +1,117 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+const (
+	// accountOwnerRole is the kind of a role in stamps. Roles may share a service
+	// account, so unlike library sets and elevation roles they aren't indexed.
+	accountOwnerRole = "role"
+
+	defaultStampTemplate = "Managed by Vault at {{.MountPath}} ({{.Owner}})"
+)
+
+// stampAttributeRegex matches the LDAP display names of attributes.
+var stampAttributeRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*$`)
+
+// stampData is what a stamp_template is rendered with.
+type stampData struct {
+	MountPath string
+	Kind      string
+	Name      string
+	Owner     string
+}
+
+// parseStampTemplate validates the config's stamp_attribute and stamp_template.
+func parseStampTemplate(attribute, text string) (*template.Template, error) {
+	if attribute != "" && !stampAttributeRegex.MatchString(attribute) {
+		return nil, fmt.Errorf("stamp_attribute %q isn't a valid attribute name", attribute)
+	}
+	tmpl, err := template.New("stamp").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("stamp_template is invalid: %w", err)
+	}
+	if err := tmpl.Execute(&strings.Builder{}, &stampData{}); err != nil {
+		return nil, fmt.Errorf("stamp_template is invalid: %w", err)
+	}
+	return tmpl, nil
+}
+
+// stampAccounts sets the config's stamp_attribute on service accounts that a
+// role, library set, or elevation role has just taken over, so directory admins
+// can tell Vault manages them. The accounts are managed whether or not they can
+// be stamped, so failures are returned as warnings instead of errors.
+func (b *backend) stampAccounts(engineConf *configuration, mountPath string, owner *accountOwner, serviceAccountNames []string) []string {
+	if engineConf == nil || engineConf.StampAttribute == "" || len(serviceAccountNames) == 0 {
+		return nil
+	}
+	tmpl, err := parseStampTemplate(engineConf.StampAttribute, engineConf.stampTemplate())
+	if err != nil {
+		return []string{fmt.Sprintf("unable to stamp service accounts: %s", err)}
+	}
+	stamp := &strings.Builder{}
+	if err := tmpl.Execute(stamp, &stampData{
+		MountPath: mountPath,
+		Kind:      owner.Kind,
+		Name:      owner.Name,
+		Owner:     fmt.Sprintf("%s %q", owner.Kind, owner.Name),
+	}); err != nil {
+		return []string{fmt.Sprintf("unable to stamp service accounts: %s", err)}
+	}
+	return b.updateStamps(engineConf, serviceAccountNames, []string{stamp.String()})
+}
+
+// clearStamps removes the config's stamp_attribute from service accounts that
+// are no longer managed.
+func (b *backend) clearStamps(engineConf *configuration, serviceAccountNames []string) []string {
+	if engineConf == nil || engineConf.StampAttribute == "" || len(serviceAccountNames) == 0 {
+		return nil
+	}
+	return b.updateStamps(engineConf, serviceAccountNames, []string{})
+}
+
+func (b *backend) updateStamps(engineConf *configuration, serviceAccountNames []string, values []string) []string {
+	updater, ok := b.client.(EntryUpdater)
+	if !ok {
+		return []string{"the secrets client doesn't support stamping service accounts"}
+	}
+	field := client.NewField(engineConf.StampAttribute)
+	var warnings []string
+	for _, serviceAccountName := range serviceAccountNames {
+		if err := updater.UpdateEntry(engineConf.ADConf, serviceAccountName, map[*client.Field][]string{field: values}); err != nil {
+			b.Logger().Warn("unable to update stamp", "service_account_name", serviceAccountName, "attribute", field, "error", err)
+			warnings = append(warnings, fmt.Sprintf("unable to update %s of %q: %s", field, serviceAccountName, err))
+		}
+	}
+	return warnings
+}
+
+// warningsResponse returns a response carrying the warnings, or nil if there are
+// none, so writes without any still return a 204.
+func warningsResponse(warnings []string) *logical.Response {
+	if len(warnings) == 0 {
+		return nil
+	}
+	return &logical.Response{
+		Warnings: warnings,
+	}
+}
+
+// stampTemplate returns the template stamps are rendered from.
+func (c *configuration) stampTemplate() string {
+	if c.StampTemplate == "" {
+		return defaultStampTemplate
+	}
+	return c.StampTemplate
+}
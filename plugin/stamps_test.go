@@ -0,0 +1,129 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+// stampFake records the values of the attributes set on each service account.
+type stampFake struct {
+	fakeSecretsClient
+
+	mu     sync.Mutex
+	stamps map[string]map[string][]string
+}
+
+func (f *stampFake) UpdateEntry(conf *client.ADConf, serviceAccountName string, newValues map[*client.Field][]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stamps[serviceAccountName] == nil {
+		f.stamps[serviceAccountName] = make(map[string][]string)
+	}
+	for field, values := range newValues {
+		f.stamps[serviceAccountName][field.String()] = values
+	}
+	return nil
+}
+
+func (f *stampFake) stamp(serviceAccountName string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	values := f.stamps[serviceAccountName]["description"]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func TestStamps(t *testing.T) {
+	fake := &stampFake{stamps: make(map[string]map[string][]string)}
+	engineConf := testConfig()
+	engineConf.StampAttribute = "description"
+	b, storage := getBackend(t, fake, engineConf)
+	handle := func(operation logical.Operation, path string, data map[string]interface{}) {
+		t.Helper()
+		resp := sendRequest(t, b, storage, &logical.Request{
+			Operation:  operation,
+			Path:       path,
+			Data:       data,
+			MountPoint: "ad/",
+		})
+		if resp != nil && resp.IsError() {
+			t.Fatalf("unexpected error: %#v", resp)
+		}
+		if resp == nil {
+			return
+		}
+		for _, warning := range resp.Warnings {
+			if strings.Contains(warning, "stamp") || strings.HasPrefix(warning, "unable to update") {
+				t.Fatalf("unexpected warning: %s", warning)
+			}
+		}
+	}
+	expectStamp := func(serviceAccountName, expected string) {
+		t.Helper()
+		if stamp := fake.stamp(serviceAccountName); stamp != expected {
+			t.Fatalf("expected %s to be stamped %q but received %q", serviceAccountName, expected, stamp)
+		}
+	}
+
+	handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com", "b@example.com"},
+	})
+	expectStamp("a@example.com", `Managed by Vault at ad/ (set "lib")`)
+	expectStamp("b@example.com", `Managed by Vault at ad/ (set "lib")`)
+
+	// Accounts are stamped as they're added to a set and cleared as they're removed.
+	handle(logical.UpdateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"b@example.com", "c@example.com"},
+	})
+	expectStamp("a@example.com", "")
+	expectStamp("c@example.com", `Managed by Vault at ad/ (set "lib")`)
+
+	handle(logical.DeleteOperation, libraryPrefix+"lib", nil)
+	expectStamp("b@example.com", "")
+	expectStamp("c@example.com", "")
+
+	engineConf.StampTemplate = "{{.Kind}}/{{.Name}}"
+	if err := writeConfig(ctx, storage, engineConf); err != nil {
+		t.Fatal(err)
+	}
+
+	// A service account shared by roles keeps its stamp until the last one is deleted.
+	handle(logical.UpdateOperation, rolePrefix+"first", map[string]interface{}{
+		"service_account_name": "app@example.com",
+	})
+	handle(logical.UpdateOperation, rolePrefix+"second", map[string]interface{}{
+		"service_account_name": "app@example.com",
+	})
+	expectStamp("app@example.com", "role/first")
+	handle(logical.DeleteOperation, rolePrefix+"first", nil)
+	expectStamp("app@example.com", "role/first")
+	handle(logical.DeleteOperation, rolePrefix+"second", nil)
+	expectStamp("app@example.com", "")
+}
+
+func TestParseStampTemplate(t *testing.T) {
+	for _, tc := range []struct {
+		attribute, template string
+		valid               bool
+	}{
+		{"description", defaultStampTemplate, true},
+		{"extensionAttribute1", "{{.Owner}}", true},
+		{"not an attribute", defaultStampTemplate, false},
+		{"description", "{{.Unknown}}", false},
+		{"description", "{{.Owner", false},
+	} {
+		if _, err := parseStampTemplate(tc.attribute, tc.template); (err == nil) != tc.valid {
+			t.Fatalf("expected %q and %q to be valid: %t, but received %v", tc.attribute, tc.template, tc.valid, err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// storageEpochStorageKey holds the current storage epoch. Each stored password
+// records the epoch it was set or verified in, and passwords from an earlier
+// epoch are checked against AD before they're handed out.
+const storageEpochStorageKey = "storage-epoch"
+
+// storageEpoch identifies the storage the backend has been working with since it
+// was set up. Storage restored from a snapshot or migrated from elsewhere holds
+// an older epoch, or none, so its passwords may be ones AD no longer accepts.
+type storageEpoch struct {
+	ID string `json:"id"`
+}
+
+// readStorageEpoch returns the current epoch's ID, or "" if no epoch has been
+// started, in which case no stored password counts as verified.
+func readStorageEpoch(ctx context.Context, storage logical.Storage) (string, error) {
+	entry, err := storage.Get(ctx, storageEpochStorageKey)
+	if err != nil {
+		return "", err
+	}
+	if entry == nil {
+		return "", nil
+	}
+	epoch := &storageEpoch{}
+	if err := entry.DecodeJSON(epoch); err != nil {
+		return "", err
+	}
+	return epoch.ID, nil
+}
+
+// startStorageEpoch starts a new epoch, so every stored password is verified
+// again before it's handed out. The backend can't tell a restart from a restore
+// by storage alone, so it does this whenever it's set up.
+func (b *backend) startStorageEpoch(ctx context.Context, storage logical.Storage) error {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return err
+	}
+	entry, err := logical.StorageEntryJSON(storageEpochStorageKey, &storageEpoch{ID: id})
+	if err != nil {
+		return err
+	}
+	if err := storage.Put(ctx, entry); err != nil {
+		return err
+	}
+	b.epochLock.Lock()
+	b.epochID = id
+	b.epochLock.Unlock()
+	return nil
+}
+
+// checkStorageEpoch starts a new epoch if storage no longer holds the one this
+// backend started, as happens when it's restored or replaced while the backend
+// is running.
+func (b *backend) checkStorageEpoch(ctx context.Context, storage logical.Storage) error {
+	id, err := readStorageEpoch(ctx, storage)
+	if err != nil {
+		return err
+	}
+	b.epochLock.Lock()
+	current := b.epochID
+	b.epochLock.Unlock()
+	if id != "" && id == current {
+		return nil
+	}
+	b.Logger().Warn("storage holds a different epoch than the one this backend started, so stored passwords will be verified before they're checked out")
+	return b.startStorageEpoch(ctx, storage)
+}
@@ -0,0 +1,219 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/api"
+)
+
+const (
+	defaultTransitMount = "transit"
+
+	// transitTimeout bounds each request to Transit.
+	transitTimeout = 60 * time.Second
+)
+
+// transitKey names a Transit key by its mount and name.
+type transitKey struct {
+	Mount string `json:"mount"`
+	Name  string `json:"name"`
+}
+
+// transitClient encrypts and decrypts library passwords with Transit, so they
+// aren't written to storage in plaintext.
+type transitClient struct {
+	client *api.Client
+}
+
+// transitSettings are the config's settings that a Transit client is built from.
+type transitSettings struct {
+	address   string
+	token     string
+	caCert    string
+	namespace string
+}
+
+func transitSettingsOf(engineConf *configuration) transitSettings {
+	return transitSettings{
+		address:   engineConf.TransitAddress,
+		token:     engineConf.TransitToken,
+		caCert:    engineConf.TransitCACert,
+		namespace: engineConf.TransitNamespace,
+	}
+}
+
+// newTransitClient returns a client for the config's Transit server, or nil if
+// none is configured. It's built only from the config, so the VAULT_* variables
+// in Vault's own environment don't change where or how it connects.
+func newTransitClient(engineConf *configuration) (*transitClient, error) {
+	if engineConf == nil || engineConf.TransitAddress == "" {
+		return nil, nil
+	}
+	httpClient := cleanhttp.DefaultPooledClient()
+	transport := httpClient.Transport.(*http.Transport)
+	transport.TLSHandshakeTimeout = 10 * time.Second
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	// The api client follows Vault's redirects itself.
+	httpClient.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	conf := &api.Config{
+		Address:      engineConf.TransitAddress,
+		HttpClient:   httpClient,
+		Timeout:      transitTimeout,
+		MinRetryWait: time.Second,
+		MaxRetryWait: 1500 * time.Millisecond,
+		MaxRetries:   2,
+	}
+	if err := conf.ConfigureTLS(&api.TLSConfig{CACertBytes: []byte(engineConf.TransitCACert)}); err != nil {
+		return nil, fmt.Errorf("unable to configure TLS for Transit: %w", err)
+	}
+	client, err := api.NewClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	client.SetToken(engineConf.TransitToken)
+	if engineConf.TransitNamespace != "" {
+		client.SetNamespace(engineConf.TransitNamespace)
+	} else {
+		client.ClearNamespace()
+	}
+	return &transitClient{client: client}, nil
+}
+
+// transitCache holds the Transit client last built, so its connections are
+// reused across rotations. It's reset when the config changes.
+type transitCache struct {
+	lock     sync.Mutex
+	settings transitSettings
+	client   *transitClient
+}
+
+// get returns a client for the config's Transit server, building one if the
+// config's Transit settings aren't the ones the cached client was built from.
+// A nil cache builds a new client every time.
+func (c *transitCache) get(engineConf *configuration) (*transitClient, error) {
+	if engineConf == nil || engineConf.TransitAddress == "" {
+		return nil, nil
+	}
+	if c == nil {
+		return newTransitClient(engineConf)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	settings := transitSettingsOf(engineConf)
+	if c.client != nil && c.settings == settings {
+		return c.client, nil
+	}
+	client, err := newTransitClient(engineConf)
+	if err != nil {
+		return nil, err
+	}
+	c.settings = settings
+	c.client = client
+	return client, nil
+}
+
+// reset drops the cached client.
+func (c *transitCache) reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.settings = transitSettings{}
+	c.client = nil
+}
+
+func (c *transitClient) encrypt(ctx context.Context, key transitKey, plaintext string) (string, error) {
+	secret, err := c.client.Logical().WriteWithContext(ctx, path.Join(key.Mount, "encrypt", url.PathEscape(key.Name)), map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString([]byte(plaintext)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to encrypt with Transit key %q: %w", key.Name, err)
+	}
+	if secret == nil {
+		return "", fmt.Errorf("Transit key %q returned no ciphertext", key.Name)
+	}
+	ciphertext, _ := secret.Data["ciphertext"].(string)
+	if ciphertext == "" {
+		return "", fmt.Errorf("Transit key %q returned no ciphertext", key.Name)
+	}
+	return ciphertext, nil
+}
+
+func (c *transitClient) decrypt(ctx context.Context, key transitKey, ciphertext string) (string, error) {
+	secret, err := c.client.Logical().WriteWithContext(ctx, path.Join(key.Mount, "decrypt", url.PathEscape(key.Name)), map[string]interface{}{
+		"ciphertext": ciphertext,
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to decrypt with Transit key %q: %w", key.Name, err)
+	}
+	if secret == nil {
+		return "", fmt.Errorf("Transit key %q returned no plaintext", key.Name)
+	}
+	encoded, _ := secret.Data["plaintext"].(string)
+	plaintext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("Transit key %q returned invalid plaintext: %w", key.Name, err)
+	}
+	return string(plaintext), nil
+}
+
+// sealPassword encrypts the stored password with the config's Transit key, if
+// one is set. The key is recorded alongside the ciphertext, so passwords stay
+// readable after the config moves to another key.
+func sealPassword(ctx context.Context, transit *transitCache, engineConf *configuration, stored *storedPassword) (*storedPassword, error) {
+	if engineConf == nil || engineConf.TransitKeyName == "" {
+		return stored, nil
+	}
+	client, err := transit.get(engineConf)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, errors.New("transit_key_name is set, but transit_address isn't")
+	}
+	key := transitKey{Mount: engineConf.transitMount(), Name: engineConf.TransitKeyName}
+	ciphertext, err := client.encrypt(ctx, key, stored.Password)
+	if err != nil {
+		return nil, err
+	}
+	sealed := *stored
+	sealed.Password = ""
+	sealed.Ciphertext = ciphertext
+	sealed.TransitKey = &key
+	return &sealed, nil
+}
+
+// unsealPassword decrypts the stored password if it was encrypted with Transit.
+func unsealPassword(ctx context.Context, transit *transitCache, engineConf *configuration, stored *storedPassword) error {
+	if stored.TransitKey == nil {
+		return nil
+	}
+	client, err := transit.get(engineConf)
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		return errors.New("the password was encrypted with Transit, but transit_address is no longer configured")
+	}
+	password, err := client.decrypt(ctx, *stored.TransitKey, stored.Ciphertext)
+	if err != nil {
+		return err
+	}
+	stored.Password = password
+	stored.Ciphertext = ""
+	stored.TransitKey = nil
+	return nil
+}
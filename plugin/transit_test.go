@@ -0,0 +1,333 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+// fakeTransit answers Transit's encrypt and decrypt endpoints. Its ciphertexts
+// name the key that made them, so they only decrypt with the same key.
+type fakeTransit struct {
+	mu     sync.Mutex
+	denied bool
+	// namespace is the namespace of the last request.
+	namespace string
+}
+
+func (f *fakeTransit) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	denied := f.denied
+	f.namespace = r.Header.Get("X-Vault-Namespace")
+	f.mu.Unlock()
+	if denied || r.Header.Get("X-Vault-Token") != "transit-token" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	var body map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/"), "/")
+	if len(parts) != 3 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	mount, operation, key := parts[0], parts[1], parts[2]
+	prefix := "vault:v1:" + mount + "/" + key + ":"
+	data := map[string]string{}
+	switch operation {
+	case "encrypt":
+		data["ciphertext"] = prefix + body["plaintext"]
+	case "decrypt":
+		if !strings.HasPrefix(body["ciphertext"], prefix) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data["plaintext"] = strings.TrimPrefix(body["ciphertext"], prefix)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func (f *fakeTransit) setDenied(denied bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.denied = denied
+}
+
+func (f *fakeTransit) lastNamespace() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.namespace
+}
+
+func TestTransitClientConfig(t *testing.T) {
+	transit := &fakeTransit{}
+	server := httptest.NewTLSServer(transit)
+	defer server.Close()
+	caCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+	// None of Vault's own environment reaches the Transit client.
+	t.Setenv("VAULT_ADDR", "https://elsewhere.example.com:8200")
+	t.Setenv("VAULT_TOKEN", "env-token")
+	t.Setenv("VAULT_NAMESPACE", "env-namespace")
+	t.Setenv("VAULT_SKIP_VERIFY", "true")
+
+	engineConf := testConfig()
+	engineConf.TransitAddress = server.URL
+	engineConf.TransitToken = "transit-token"
+	engineConf.TransitKeyName = "passwords"
+	stored := &storedPassword{Password: "secret"}
+	cache := &transitCache{}
+
+	// The server's certificate isn't trusted without transit_ca_cert.
+	if _, err := sealPassword(ctx, cache, engineConf, stored); err == nil {
+		t.Fatal("expected the server's certificate not to be trusted")
+	}
+
+	engineConf.TransitCACert = caCert
+	engineConf.TransitNamespace = "team-a"
+	sealed, err := sealPassword(ctx, cache, engineConf, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if namespace := transit.lastNamespace(); namespace != "team-a" {
+		t.Fatalf("expected the request to be sent to transit_namespace but it was sent to %q", namespace)
+	}
+	client, err := cache.get(engineConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.client.Address() != server.URL {
+		t.Fatalf("expected the client to reach %s but it reaches %s", server.URL, client.client.Address())
+	}
+	if again, _ := cache.get(engineConf); again != client {
+		t.Fatal("expected the client to be reused")
+	}
+
+	// A config without a namespace sends none.
+	engineConf.TransitNamespace = ""
+	if err := unsealPassword(ctx, cache, engineConf, sealed); err != nil {
+		t.Fatal(err)
+	}
+	if sealed.Password != "secret" {
+		t.Fatalf("expected the password to be decrypted but received %#v", sealed)
+	}
+	if namespace := transit.lastNamespace(); namespace != "" {
+		t.Fatalf("expected no namespace but received %q", namespace)
+	}
+	if again, _ := cache.get(engineConf); again == client {
+		t.Fatal("expected a new client once the settings changed")
+	}
+
+	// Resetting the cache builds a new client.
+	client, _ = cache.get(engineConf)
+	cache.reset()
+	if again, _ := cache.get(engineConf); again == client {
+		t.Fatal("expected a new client once the cache was reset")
+	}
+}
+
+func TestTransitEncryptedPasswords(t *testing.T) {
+	transit := &fakeTransit{}
+	server := httptest.NewServer(transit)
+	defer server.Close()
+
+	directory := newMemoryDirectory()
+	engineConf := testConfig()
+	engineConf.TransitAddress = server.URL
+	engineConf.TransitToken = "transit-token"
+	engineConf.TransitKeyName = "passwords"
+	b, storage := getBackend(t, directory, engineConf)
+	handle := requester(t, b, storage, "borrower")
+	rawEntry := func() *storedPassword {
+		t.Helper()
+		entry, err := storage.Get(ctx, passwordStoragePrefix+"a@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored := &storedPassword{}
+		if err := entry.DecodeJSON(stored); err != nil {
+			t.Fatal(err)
+		}
+		return stored
+	}
+
+	handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com"},
+	})
+	stored := rawEntry()
+	if stored.Password != "" || !strings.HasPrefix(stored.Ciphertext, "vault:v1:transit/passwords:") {
+		t.Fatalf("expected the password to be stored encrypted but received %#v", stored)
+	}
+	checkOut := handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil)
+	if checkOut == nil || checkOut.IsError() || checkOut.Data["password"] != directory.account("a@example.com").password {
+		t.Fatalf("expected the decrypted password but received %#v", checkOut)
+	}
+
+	// If Transit refuses, the check-in fails before the password is changed in AD.
+	transit.setDenied(true)
+	password := directory.account("a@example.com").password
+	if _, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      libraryPrefix + "lib/check-in",
+		Storage:   storage,
+		EntityID:  "borrower",
+	}); err == nil {
+		t.Fatal("expected the check-in to fail while Transit refuses")
+	}
+	if directory.account("a@example.com").password != password {
+		t.Fatal("expected the password to be left alone in AD")
+	}
+	transit.setDenied(false)
+	handle(logical.UpdateOperation, libraryPrefix+"lib/check-in", nil)
+
+	// Passwords stay readable after the config moves to another key.
+	engineConf.TransitKeyName = "other"
+	if err := writeConfig(ctx, storage, engineConf); err != nil {
+		t.Fatal(err)
+	}
+	checkOut = handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil)
+	if checkOut == nil || checkOut.IsError() || checkOut.Data["password"] != directory.account("a@example.com").password {
+		t.Fatalf("expected the decrypted password but received %#v", checkOut)
+	}
+	handle(logical.UpdateOperation, libraryPrefix+"lib/check-in", nil)
+	if stored := rawEntry(); !strings.HasPrefix(stored.Ciphertext, "vault:v1:transit/other:") {
+		t.Fatalf("expected the password to be encrypted with the new key but received %#v", stored)
+	}
+
+	// The check-in's WAL holds the password encrypted too, and the rollback
+	// decrypts it.
+	sealed, err := sealPassword(ctx, b.transit, engineConf, &storedPassword{Password: "updated-in-ad", LastRotated: time.Now().UTC()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	walID, err := framework.PutWAL(ctx, storage, checkInWAL, checkInEntry{
+		ServiceAccountName: "a@example.com",
+		Ciphertext:         sealed.Ciphertext,
+		TransitKey:         sealed.TransitKey,
+		RotatedAt:          time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wal, err := framework.GetWAL(ctx, storage, walID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := json.Marshal(wal.Data); strings.Contains(string(raw), "updated-in-ad") {
+		t.Fatalf("expected the WAL's password to be encrypted but received %s", raw)
+	}
+	if err := b.handleCheckInRollback(ctx, storage, wal.Data); err != nil {
+		t.Fatal(err)
+	}
+	if password := directory.account("a@example.com").password; password != "updated-in-ad" {
+		t.Fatalf("expected the WAL's password to be set in AD but received %q", password)
+	}
+
+	// Without a key, new passwords are stored unencrypted.
+	engineConf.TransitKeyName = ""
+	if err := writeConfig(ctx, storage, engineConf); err != nil {
+		t.Fatal(err)
+	}
+	handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil)
+	handle(logical.UpdateOperation, libraryPrefix+"lib/check-in", nil)
+	if stored := rawEntry(); stored.Password != directory.account("a@example.com").password || stored.TransitKey != nil {
+		t.Fatalf("expected the password to be stored unencrypted but received %#v", stored)
+	}
+}
+
+// observedDirectory is a memoryDirectory that calls onUpdate before it updates
+// a password, while the WAL for the update is still in storage.
+type observedDirectory struct {
+	*memoryDirectory
+	onUpdate func()
+}
+
+func (d *observedDirectory) UpdatePassword(conf *client.ADConf, serviceAccountName string, newPassword string) error {
+	if d.onUpdate != nil {
+		d.onUpdate()
+	}
+	return d.memoryDirectory.UpdatePassword(conf, serviceAccountName, newPassword)
+}
+
+func TestTransitEncryptedSetPasswordWAL(t *testing.T) {
+	transit := &fakeTransit{}
+	server := httptest.NewServer(transit)
+	defer server.Close()
+
+	directory := &observedDirectory{memoryDirectory: newMemoryDirectory()}
+	engineConf := testConfig()
+	engineConf.TransitAddress = server.URL
+	engineConf.TransitToken = "transit-token"
+	engineConf.TransitKeyName = "passwords"
+	b, storage := getBackend(t, directory, engineConf)
+	handle := requester(t, b, storage, "admin")
+
+	handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com"},
+	})
+
+	var wals []*framework.WALEntry
+	directory.onUpdate = func() {
+		walIDs, err := framework.ListWAL(ctx, storage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, walID := range walIDs {
+			wal, err := framework.GetWAL(ctx, storage, walID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wals = append(wals, wal)
+		}
+	}
+	if resp := handle(logical.UpdateOperation, libraryPrefix+"manage/lib/set-password", map[string]interface{}{
+		"service_account_name": "a@example.com",
+		"password":             "known-password",
+	}); resp != nil {
+		t.Fatalf("unable to set the password: %#v", resp)
+	}
+	if len(wals) != 1 {
+		t.Fatalf("expected a WAL while the password was set but found %d", len(wals))
+	}
+	if raw, _ := json.Marshal(wals[0].Data); strings.Contains(string(raw), "known-password") {
+		t.Fatalf("expected the WAL's password to be encrypted but received %s", raw)
+	}
+	entry, err := storage.Get(ctx, passwordStoragePrefix+"a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := &storedPassword{}
+	if err := entry.DecodeJSON(stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Password != "" || !stored.ExternallySet || !strings.HasPrefix(stored.Ciphertext, "vault:v1:transit/passwords:") {
+		t.Fatalf("expected the password to be stored encrypted but received %#v", stored)
+	}
+
+	// The rollback decrypts the WAL's password to finish setting it.
+	if err := b.handleCheckInRollback(ctx, storage, wals[0].Data); err != nil {
+		t.Fatal(err)
+	}
+	if password := directory.account("a@example.com").password; password != "known-password" {
+		t.Fatalf("expected the known password in AD but received %q", password)
+	}
+}
@@ -5,6 +5,7 @@ package util
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/go-hclog"
@@ -16,23 +17,56 @@ func NewSecretsClient(logger hclog.Logger) *SecretsClient {
 	return &SecretsClient{adClient: client.NewClient(logger)}
 }
 
+// AccountNotFoundError is returned when a service account doesn't exist in AD.
+type AccountNotFoundError struct {
+	ServiceAccountName string
+}
+
+func (e *AccountNotFoundError) Error() string {
+	return fmt.Sprintf("unable to find service account named %s in active directory, searches are case sensitive", e.ServiceAccountName)
+}
+
 // SecretsClient wraps a *activeDirectory.activeDirectoryClient to expose just the common convenience methods needed by the ad secrets backend.
 type SecretsClient struct {
 	adClient *client.Client
 }
 
-func (c *SecretsClient) Get(conf *client.ADConf, serviceAccountName string) (*client.Entry, error) {
-	filters := map[*client.Field][]string{
+// IsComputerAccount reports whether the service account name is a computer's
+// sAMAccountName, like "WEB01$", rather than a userPrincipalName.
+func IsComputerAccount(serviceAccountName string) bool {
+	return len(serviceAccountName) > 1 && strings.HasSuffix(serviceAccountName, "$") && !strings.Contains(serviceAccountName, "@")
+}
+
+// accountSearch returns where to search for the service account and how to find
+// it. Users are found by their userPrincipalName. Computers don't necessarily
+// have one, so they're found by their sAMAccountName, and only among computer
+// objects, so a user whose name happens to end in $ is never matched instead.
+func accountSearch(conf *client.ADConf, serviceAccountName string) (*client.ADConf, string, map[*client.Field][]string) {
+	if IsComputerAccount(serviceAccountName) {
+		baseDN := conf.ComputerDN
+		if baseDN == "" {
+			baseDN = conf.UserDN
+		}
+		return conf, baseDN, map[*client.Field][]string{
+			client.FieldRegistry.ObjectClass:    {"computer"},
+			client.FieldRegistry.SAMAccountName: {serviceAccountName},
+		}
+	}
+	conf = conf.ForAccount(serviceAccountName)
+	return conf, conf.UserDN, map[*client.Field][]string{
 		client.FieldRegistry.UserPrincipalName: {serviceAccountName},
 	}
+}
 
-	entries, err := c.adClient.Search(conf, conf.UserDN, filters)
+func (c *SecretsClient) Get(conf *client.ADConf, serviceAccountName string) (*client.Entry, error) {
+	conf, baseDN, filters := accountSearch(conf, serviceAccountName)
+	entries, err := c.adClient.Search(conf, baseDN, filters)
 	if err != nil {
 		return nil, err
 	}
 
 	if len(entries) == 0 {
-		return nil, fmt.Errorf("unable to find service account named %s in active directory, searches are case sensitive", serviceAccountName)
+		return nil, &AccountNotFoundError{ServiceAccountName: serviceAccountName}
 	}
 	if len(entries) > 1 {
 		return nil, fmt.Errorf("expected one matching service account, but received %+v", entries)
@@ -69,13 +103,89 @@ func (c *SecretsClient) GetPasswordLastSet(conf *client.ADConf, serviceAccountNa
 }
 
 func (c *SecretsClient) UpdatePassword(conf *client.ADConf, serviceAccountName string, newPassword string) error {
-	filters := map[*client.Field][]string{
-		client.FieldRegistry.UserPrincipalName: {serviceAccountName},
+	conf, baseDN, filters := accountSearch(conf, serviceAccountName)
+	return c.adClient.UpdatePassword(conf, baseDN, filters, newPassword)
+}
+
+// VerifyPassword checks that the service account can bind to AD with the password.
+func (c *SecretsClient) VerifyPassword(conf *client.ADConf, serviceAccountName string, password string) error {
+	entry, err := c.Get(conf, serviceAccountName)
+	if err != nil {
+		return err
+	}
+	conf, _, _ = accountSearch(conf, serviceAccountName)
+	return c.adClient.VerifyPassword(conf, entry.DN, password)
+}
+
+// MinPasswordAge returns how long the service account's password must be kept
+// before it can be changed again.
+func (c *SecretsClient) MinPasswordAge(conf *client.ADConf, serviceAccountName string) (time.Duration, error) {
+	entry, err := c.Get(conf, serviceAccountName)
+	if err != nil {
+		return 0, err
 	}
-	return c.adClient.UpdatePassword(conf, conf.UserDN, filters, newPassword)
+	conf, _, _ = accountSearch(conf, serviceAccountName)
+	return c.adClient.MinPasswordAge(conf, entry.DN)
+}
+
+// UpdateEntry replaces the values of the given fields on the account's entry.
+func (c *SecretsClient) UpdateEntry(conf *client.ADConf, serviceAccountName string, newValues map[*client.Field][]string) error {
+	conf, baseDN, filters := accountSearch(conf, serviceAccountName)
+	return c.adClient.UpdateEntry(conf, baseDN, filters, newValues)
+}
+
+// AddGroupMember adds the service account to the group with the given DN.
+func (c *SecretsClient) AddGroupMember(conf *client.ADConf, groupDN string, serviceAccountName string) error {
+	entry, err := c.Get(conf, serviceAccountName)
+	if err != nil {
+		return err
+	}
+	return c.adClient.AddGroupMember(conf, groupDN, entry.DN)
+}
+
+// RemoveGroupMember removes the service account from the group with the given DN.
+func (c *SecretsClient) RemoveGroupMember(conf *client.ADConf, groupDN string, serviceAccountName string) error {
+	entry, err := c.Get(conf, serviceAccountName)
+	if err != nil {
+		return err
+	}
+	return c.adClient.RemoveGroupMember(conf, groupDN, entry.DN)
+}
+
+// Prewarm dials and binds a connection for the next request to use.
+func (c *SecretsClient) Prewarm(conf *client.ADConf) error {
+	return c.adClient.Prewarm(conf)
+}
+
+// Close closes the idle connections kept for later requests.
+func (c *SecretsClient) Close() {
+	c.adClient.Close()
+}
+
+// VerifyConnection binds to AD and searches the userdn to check the config works.
+func (c *SecretsClient) VerifyConnection(conf *client.ADConf) error {
+	return c.adClient.VerifyConnection(conf)
+}
+
+// ProbeDCs dials the domain controllers that are down to see if they're back.
+func (c *SecretsClient) ProbeDCs(conf *client.ADConf) ([]client.DCStatus, error) {
+	return c.adClient.ProbeDCs(conf)
+}
+
+// DCHealth returns whether each domain controller could last be reached.
+func (c *SecretsClient) DCHealth(conf *client.ADConf) ([]client.DCStatus, error) {
+	return c.adClient.DCHealth(conf)
 }
 
 func (c *SecretsClient) UpdateRootPassword(conf *client.ADConf, bindDN string, newPassword string) error {
+	// An account bound to with a UPN is found by it under the userdn, since
+	// there's no DN to search for.
+	if upn := conf.BindUPN(); upn != "" {
+		filters := map[*client.Field][]string{
+			client.FieldRegistry.UserPrincipalName: {upn},
+		}
+		return c.adClient.UpdatePassword(rotationConf(conf), conf.UserDN, filters, newPassword)
+	}
 	filters := map[*client.Field][]string{
 		client.FieldRegistry.DistinguishedName: {bindDN},
 	}
@@ -85,5 +195,30 @@ func (c *SecretsClient) UpdateRootPassword(conf *client.ADConf, bindDN string, n
 	// in a separate, non-overlapping "Accounting" OU. We wouldn't want to search the
 	// accounting team to rotate the security user's password, we'd want to search the
 	// security team.
-	return c.adClient.UpdatePassword(conf, conf.BindDN, filters, newPassword)
+	return c.adClient.UpdatePassword(rotationConf(conf), conf.BindDN, filters, newPassword)
+}
+
+// rotationConf returns the config to bind with when resetting the bind account's
+// password. If a separate rotation account is configured, it binds as that account
+// so the bind account isn't subject to the restrictions on changing its own password.
+// Everything but the bind identity is the config's, so the connection is made
+// and checked like any other.
+func rotationConf(conf *client.ADConf) *client.ADConf {
+	if conf.RotationBindDN == "" {
+		return conf
+	}
+	entry := *conf.ConfigEntry
+	entry.BindDN = conf.RotationBindDN
+	entry.BindPassword = conf.RotationBindPassword
+	rotation := *conf
+	rotation.ConfigEntry = &entry
+	// The rotation_binddn is always a DN once the config says how it binds.
+	if conf.BindMode != "" {
+		rotation.BindMode = client.BindModeDN
+	}
+	rotation.UPNUsername = ""
+	rotation.FallbackBindDN, rotation.FallbackBindPassword = "", ""
+	rotation.BindKeytab, rotation.BindPrincipal = "", ""
+	rotation.LastBindPassword = ""
+	return &rotation
 }
@@ -0,0 +1,60 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/helper/ldaputil"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+func TestRotationConf(t *testing.T) {
+	conf := &client.ADConf{
+		ConfigEntry: &ldaputil.ConfigEntry{
+			Url:          "ldaps://dc.example.com",
+			BindDN:       "CN=vault,DC=example,DC=com",
+			BindPassword: "bind-password",
+			Certificate:  "ca",
+		},
+		BindMode:             client.BindModeDN,
+		FallbackBindDN:       "CN=fallback,DC=example,DC=com",
+		FallbackBindPassword: "fallback-password",
+		LastBindPassword:     "last-password",
+		RotationBindDN:       "CN=rotator,DC=example,DC=com",
+		RotationBindPassword: "rotator-password",
+		CRL:                  "crl",
+		CheckOCSP:            true,
+		DiscoverDC:           true,
+		DiscoverDCDomain:     "example.com",
+		MaxOpenConnections:   4,
+	}
+
+	rotation := rotationConf(conf)
+
+	// It binds as the rotation account, and only as it.
+	if rotation.BindDN != conf.RotationBindDN || rotation.BindPassword != conf.RotationBindPassword || rotation.BindMode != client.BindModeDN {
+		t.Fatalf("expected to bind as the rotation account but received %#v", rotation.ConfigEntry)
+	}
+	if rotation.FallbackBindDN != "" || rotation.FallbackBindPassword != "" || rotation.LastBindPassword != "" {
+		t.Fatalf("expected no other identity to be bound as but received %#v", rotation)
+	}
+	// The connection is checked and made like any other.
+	if rotation.CRL != "crl" || !rotation.CheckOCSP || rotation.Certificate != "ca" {
+		t.Fatalf("expected the config's revocation checks but received %#v", rotation)
+	}
+	if !rotation.DiscoverDC || rotation.DiscoverDCDomain != "example.com" || rotation.MaxOpenConnections != 4 {
+		t.Fatalf("expected the config's connection settings but received %#v", rotation)
+	}
+	// The config itself is left alone.
+	if conf.BindDN != "CN=vault,DC=example,DC=com" || conf.FallbackBindDN == "" {
+		t.Fatalf("expected the config to be unchanged but received %#v", conf)
+	}
+
+	conf.RotationBindDN = ""
+	if rotationConf(conf) != conf {
+		t.Fatal("expected the config to be used without a rotation_binddn")
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// verifyAttempts is how many times to try binding with a new password before
+	// giving up. Domain controllers other than the one the password was changed
+	// on may take a few seconds to learn it.
+	verifyAttempts = 5
+
+	defaultVerifyRetryInterval = 2 * time.Second
+)
+
+// verifyRotation binds as the service account with its new password, so a
+// password that AD accepted but doesn't work, like one silently rejected by a
+// password filter, fails the rotation instead of going unnoticed until it's used.
+func (b *backend) verifyRotation(ctx context.Context, engineConf *configuration, serviceAccountName, password string) error {
+	verifier, ok := b.client.(PasswordVerifier)
+	if !ok {
+		return errors.New("the secrets client doesn't support verifying passwords")
+	}
+	var err error
+	for attempt := 1; attempt <= verifyAttempts; attempt++ {
+		if err = verifier.VerifyPassword(engineConf.ADConf, serviceAccountName, password); err == nil {
+			return nil
+		}
+		if attempt == verifyAttempts {
+			break
+		}
+		b.Logger().Debug("unable to bind with the new password, retrying", "service_account_name", serviceAccountName, "attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(b.verifyRetryInterval):
+		}
+	}
+	return fmt.Errorf("unable to bind as %q with its new password after %d attempts: %w", serviceAccountName, verifyAttempts, err)
+}
@@ -0,0 +1,96 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin/client"
+)
+
+// unreplicatedDirectory refuses binds with new passwords until it's been asked
+// unreplicatedBinds times, like a domain controller the password hasn't reached.
+type unreplicatedDirectory struct {
+	*memoryDirectory
+	unreplicatedBinds int
+	binds             int
+}
+
+func (d *unreplicatedDirectory) VerifyPassword(conf *client.ADConf, serviceAccountName string, password string) error {
+	d.binds++
+	if d.binds <= d.unreplicatedBinds {
+		return errors.New("invalid credentials")
+	}
+	return d.memoryDirectory.VerifyPassword(conf, serviceAccountName, password)
+}
+
+func TestVerifyAfterRotation(t *testing.T) {
+	directory := &unreplicatedDirectory{memoryDirectory: newMemoryDirectory()}
+	b, storage := getBackend(t, directory, testConfig())
+	b.verifyRetryInterval = time.Millisecond
+	handle := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+	}
+
+	if resp, err := handle(logical.UpdateOperation, rolePrefix+"app", map[string]interface{}{
+		"service_account_name":  "app@example.com",
+		"verify_after_rotation": true,
+	}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("unable to create role: %#v, %v", resp, err)
+	}
+	resp, err := handle(logical.ReadOperation, rolePrefix+"app", nil)
+	if err != nil || resp.Data["verify_after_rotation"] != true {
+		t.Fatalf("expected verify_after_rotation to be set but received %#v, %v", resp, err)
+	}
+
+	// The new password works once it replicates.
+	directory.unreplicatedBinds = verifyAttempts - 1
+	resp, err = handle(logical.ReadOperation, credPrefix+"app", nil)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("unable to read creds: %#v, %v", resp, err)
+	}
+	if directory.binds != verifyAttempts {
+		t.Fatalf("expected %d binds but received %d", verifyAttempts, directory.binds)
+	}
+
+	// A new password that never works fails the rotation, and the previous
+	// password is put back.
+	resp, err = handle(logical.ReadOperation, credPrefix+"app", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousPassword := resp.Data["current_password"].(string)
+	directory.binds = 0
+	directory.unreplicatedBinds = verifyAttempts
+	if _, err := handle(logical.UpdateOperation, "rotate-role/app", nil); err == nil {
+		t.Fatal("expected the rotation to fail")
+	}
+	if password := directory.account("app@example.com").password; password != previousPassword {
+		t.Fatalf("expected the previous password %q to be restored but received %q", previousPassword, password)
+	}
+	resp, err = handle(logical.ReadOperation, rolePrefix+"app", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastErr, ok := resp.Data["last_ldap_error"].(map[string]interface{}); !ok || lastErr["operation"] != roleErrorVerification {
+		t.Fatalf("expected the verification error to be recorded but received %#v", resp.Data["last_ldap_error"])
+	}
+	walIDs, err := framework.ListWAL(ctx, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(walIDs) != 0 {
+		t.Fatalf("expected the rotation's WAL to be deleted but received %d", len(walIDs))
+	}
+}
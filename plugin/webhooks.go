@@ -0,0 +1,128 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// webhookEventCheckOut is sent when a library account is checked out.
+	webhookEventCheckOut = "check_out"
+	// webhookEventForcedCheckIn is sent when a library account is checked in
+	// through the manage path instead of by its borrower.
+	webhookEventForcedCheckIn = "forced_check_in"
+	// webhookEventCheckOutOverdue is sent when a check-out is still out once
+	// it's due, so Vault checks it in. Leases revoked before then send nothing.
+	webhookEventCheckOutOverdue = "check_out_overdue"
+	// webhookEventCheckOutExpiring is sent once the check-out of a library
+	// account is due within the config's due_warning_window, so its borrower can
+	// renew it before it's checked in.
+	webhookEventCheckOutExpiring = "check_out_expiring"
+	// webhookEventRotationFailure is sent each time rotating a role's or library
+	// account's password fails and is queued for retry.
+	webhookEventRotationFailure = "rotation_failure"
+	// webhookEventPasswordPeek is sent when a library account's password is
+	// read through the manage path without checking the account out.
+	webhookEventPasswordPeek = "password_peek"
+
+	// webhookSignatureHeader carries the hex HMAC-SHA256 of the body, keyed by
+	// the config's webhook_hmac_key, so receivers can tell it came from Vault.
+	webhookSignatureHeader = "X-Vault-AD-Signature"
+
+	webhookTimeout = 10 * time.Second
+)
+
+// webhookEvent is the JSON body sent to the config's webhook_url.
+type webhookEvent struct {
+	Type string                 `json:"type"`
+	Time time.Time              `json:"time"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// validateWebhookURL requires webhook URLs to use HTTPS, since notifications
+// name service accounts and who borrowed them.
+func validateWebhookURL(rawURL string) error {
+	if rawURL == "" {
+		return nil
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("webhook_url is invalid: %w", err)
+	}
+	if parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("webhook_url must be an https URL, but received %q", rawURL)
+	}
+	return nil
+}
+
+// notifyWebhook sends the event to the config's webhook_url, if one is set, for
+// tools that can't subscribe to Vault's events. It's sent in the background so
+// a slow or unreachable receiver doesn't hold up the request, and failures are
+// only logged.
+func (b *backend) notifyWebhook(ctx context.Context, storage logical.Storage, eventType string, data map[string]interface{}) {
+	engineConf, err := readConfig(ctx, storage)
+	if err != nil {
+		b.Logger().Warn("unable to read config to send webhook", "event", eventType, "error", err)
+		return
+	}
+	if engineConf == nil || engineConf.WebhookURL == "" {
+		return
+	}
+	body, err := json.Marshal(&webhookEvent{
+		Type: eventType,
+		Time: b.now().UTC(),
+		Data: data,
+	})
+	if err != nil {
+		b.Logger().Warn("unable to marshal webhook", "event", eventType, "error", err)
+		return
+	}
+
+	b.bgWG.Add(1)
+	go func() {
+		defer b.bgWG.Done()
+		ctx, cancel := context.WithTimeout(b.bgCtx, webhookTimeout)
+		defer cancel()
+		if err := b.sendWebhook(ctx, engineConf, body); err != nil {
+			b.Logger().Warn("unable to send webhook", "event", eventType, "error", err)
+		}
+	}()
+}
+
+func (b *backend) sendWebhook(ctx context.Context, engineConf *configuration, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, engineConf.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if engineConf.WebhookAuthHeader != "" {
+		req.Header.Set("Authorization", engineConf.WebhookAuthHeader)
+	}
+	if engineConf.WebhookHMACKey != "" {
+		mac := hmac.New(sha256.New, []byte(engineConf.WebhookHMACKey))
+		mac.Write(body)
+		req.Header.Set(webhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := b.webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("the webhook responded with %s", resp.Status)
+	}
+	return nil
+}
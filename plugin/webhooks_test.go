@@ -0,0 +1,98 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestWebhook(t *testing.T) {
+	var mu sync.Mutex
+	var events []*webhookEvent
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		mac := hmac.New(sha256.New, []byte("key"))
+		mac.Write(body)
+		if r.Header.Get(webhookSignatureHeader) != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("unexpected signature %q", r.Header.Get(webhookSignatureHeader))
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("unexpected Authorization header %q", r.Header.Get("Authorization"))
+		}
+		event := &webhookEvent{}
+		if err := json.Unmarshal(body, event); err != nil {
+			t.Error(err)
+			return
+		}
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	engineConf := testConfig()
+	engineConf.WebhookURL = server.URL
+	engineConf.WebhookAuthHeader = "Bearer token"
+	engineConf.WebhookHMACKey = "key"
+	b, storage := getBackend(t, newMemoryDirectory(), engineConf)
+	b.webhookClient = server.Client()
+	handle := succeedingRequester(t, b, storage, "borrower")
+
+	handle(logical.CreateOperation, libraryPrefix+"lib", map[string]interface{}{
+		"service_account_names": []string{"a@example.com", "b@example.com"},
+	})
+	handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil)
+	handle(logical.UpdateOperation, libraryPrefix+"manage/lib/check-in", nil)
+
+	// A lease revoked before it's due isn't overdue.
+	resp := handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil)
+	if _, err := b.endCheckOut(ctx, &logical.Request{Storage: storage, Secret: resp.Secret}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The lease of a check-out that isn't checked in ends.
+	resp = handle(logical.UpdateOperation, libraryPrefix+"lib/check-out", nil)
+	b.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, err := b.endCheckOut(ctx, &logical.Request{Storage: storage, Secret: resp.Secret}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	b.enqueueRetry(ctx, storage, retryKindRole, "app", "", errors.New("unable to reach AD"))
+
+	b.bgWG.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	received := make(map[string]*webhookEvent)
+	for _, event := range events {
+		received[event.Type] = event
+	}
+	if len(events) != 6 || len(received) != 4 {
+		t.Fatalf("expected 3 check-outs, a forced check-in, an overdue check-out, and a rotation failure but received %d events: %v", len(events), received)
+	}
+	if event := received[webhookEventForcedCheckIn]; event.Data["set_name"] != "lib" || event.Data["service_account_name"] == "" {
+		t.Fatalf("unexpected forced check-in: %#v", event.Data)
+	}
+	if event := received[webhookEventCheckOutOverdue]; event.Data["checkout_id"] != resp.Data["checkout_id"] {
+		t.Fatalf("unexpected overdue check-out: %#v", event.Data)
+	}
+	if event := received[webhookEventRotationFailure]; event.Data["name"] != "app" || event.Data["error"] != "unable to reach AD" {
+		t.Fatalf("unexpected rotation failure: %#v", event.Data)
+	}
+}
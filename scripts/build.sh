@@ -19,7 +19,7 @@ DIR="$( cd -P "$( dirname "$SOURCE" )/.." && pwd )"
 cd "$DIR"
 
 # Set build tags
-BUILD_TAGS="${BUILD_TAGS}:-${TOOL}"
+BUILD_TAGS="${BUILD_TAGS:-${TOOL}}"
 
 # Get the git commit
 GIT_COMMIT="$(git rev-parse HEAD)"
@@ -0,0 +1,389 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+// acctest runs the plugin through a full cycle against a live Active Directory
+// or Samba domain controller and reports which steps passed, so operators can
+// check a directory works with a build of the plugin before upgrading.
+//
+// The directory is configured with these environment variables:
+//
+//	AD_URL               LDAP URL of the domain controller, ex. "ldaps://dc1.example.com"
+//	AD_BINDDN            DN or UPN of the account Vault binds with
+//	AD_BINDPASS          password of the bind account
+//	AD_USERDN            base DN under which service accounts are found
+//	AD_UPNDOMAIN         optional userPrincipalName domain of the bind account
+//	AD_CERTIFICATE       optional path to the PEM encoded CA certificate of the domain controller
+//	AD_INSECURE_TLS      set to "true" to skip verifying the domain controller's certificate
+//	AD_ROLE_ACCOUNT      service account to rotate with a role, ex. "svc-app@example.com"
+//	AD_LIBRARY_ACCOUNTS  comma separated service accounts to check in and out of a library set
+//
+// Every password the plugin sets is lost when acctest exits, so only point it at
+// accounts that exist for testing. Rotating the bind password is opt-in, see -rotate-root.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/hashicorp/vault-plugin-secrets-ad/plugin"
+)
+
+const (
+	roleName = "acctest"
+	setName  = "acctest"
+
+	// borrower identifies the entity checking out library accounts.
+	borrower = "acctest"
+)
+
+// errSkipped is returned by steps that didn't run because a step they depend on failed.
+var errSkipped = errors.New("skipped")
+
+func main() {
+	rotateRoot := flag.Bool("rotate-root", false, "also rotate the bind password, which requires -root-password-file")
+	rootPasswordFile := flag.String("root-password-file", "", "file to write the new bind password to after rotating it")
+	verbose := flag.Bool("v", false, "log what the plugin is doing")
+	flag.Parse()
+
+	if *rotateRoot && *rootPasswordFile == "" {
+		fmt.Fprintln(os.Stderr, "-rotate-root requires -root-password-file, or the new bind password would be lost")
+		os.Exit(2)
+	}
+	env, err := loadEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	logger := hclog.NewNullLogger()
+	if *verbose {
+		logger = hclog.New(&hclog.LoggerOptions{Name: "acctest", Level: hclog.Debug})
+	}
+	h, err := newHarness(logger)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	r := &report{}
+	r.run("write config", func() error { return h.writeConfig(env) })
+	if r.failed() {
+		// Nothing else can work without a config.
+		r.print()
+		os.Exit(1)
+	}
+	r.phase()
+	r.run("role: create", func() error { return h.createRole(env.roleAccount) })
+	r.run("role: read creds", h.readCreds)
+	r.run("role: rotate", h.rotateRole)
+	r.run("role: delete", h.deleteRole)
+	r.phase()
+	r.run("library: create set", func() error { return h.createSet(env.libraryAccounts) })
+	r.run("library: check out", h.checkOut)
+	r.run("library: check in", h.checkIn)
+	r.run("library: delete set", h.deleteSet)
+	if *rotateRoot {
+		r.phase()
+		r.run("rotate root", func() error { return h.rotateRoot(*rootPasswordFile) })
+	}
+	r.print()
+	if r.failed() {
+		os.Exit(1)
+	}
+}
+
+type env struct {
+	url             string
+	bindDN          string
+	bindPassword    string
+	userDN          string
+	upnDomain       string
+	certificate     string
+	insecureTLS     bool
+	roleAccount     string
+	libraryAccounts []string
+}
+
+func loadEnv() (*env, error) {
+	e := &env{
+		url:          os.Getenv("AD_URL"),
+		bindDN:       os.Getenv("AD_BINDDN"),
+		bindPassword: os.Getenv("AD_BINDPASS"),
+		userDN:       os.Getenv("AD_USERDN"),
+		upnDomain:    os.Getenv("AD_UPNDOMAIN"),
+		insecureTLS:  os.Getenv("AD_INSECURE_TLS") == "true",
+		roleAccount:  os.Getenv("AD_ROLE_ACCOUNT"),
+	}
+	var missing []string
+	for name, value := range map[string]string{
+		"AD_URL":              e.url,
+		"AD_BINDDN":           e.bindDN,
+		"AD_BINDPASS":         e.bindPassword,
+		"AD_USERDN":           e.userDN,
+		"AD_ROLE_ACCOUNT":     e.roleAccount,
+		"AD_LIBRARY_ACCOUNTS": os.Getenv("AD_LIBRARY_ACCOUNTS"),
+	} {
+		if value == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("missing required environment variables: %s", strings.Join(missing, ", "))
+	}
+	for _, account := range strings.Split(os.Getenv("AD_LIBRARY_ACCOUNTS"), ",") {
+		if account = strings.TrimSpace(account); account != "" {
+			e.libraryAccounts = append(e.libraryAccounts, account)
+		}
+	}
+	if path := os.Getenv("AD_CERTIFICATE"); path != "" {
+		certificate, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read AD_CERTIFICATE: %w", err)
+		}
+		e.certificate = string(certificate)
+	}
+	return e, nil
+}
+
+// report records the outcome of each step.
+type report struct {
+	results []result
+
+	// phaseStart is the index of the first result in the current phase.
+	phaseStart int
+}
+
+type result struct {
+	step     string
+	err      error
+	duration time.Duration
+}
+
+// phase starts a group of steps that doesn't depend on the steps before it.
+func (r *report) phase() {
+	r.phaseStart = len(r.results)
+}
+
+// run runs the step unless an earlier step in the phase failed, in which case
+// it's skipped, since each step builds on the ones before it.
+func (r *report) run(step string, fn func() error) {
+	if failed(r.results[r.phaseStart:]) {
+		r.results = append(r.results, result{step: step, err: errSkipped})
+		return
+	}
+	start := time.Now()
+	err := fn()
+	r.results = append(r.results, result{step: step, err: err, duration: time.Since(start)})
+}
+
+func (r *report) failed() bool {
+	return failed(r.results)
+}
+
+func failed(results []result) bool {
+	for _, result := range results {
+		if result.err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *report) print() {
+	for _, result := range r.results {
+		switch {
+		case result.err == nil:
+			fmt.Printf("PASS  %-24s %s\n", result.step, result.duration.Round(time.Millisecond))
+		case errors.Is(result.err, errSkipped):
+			fmt.Printf("SKIP  %s\n", result.step)
+		default:
+			fmt.Printf("FAIL  %-24s %s\n", result.step, result.err)
+		}
+	}
+	if r.failed() {
+		fmt.Println("FAIL")
+		return
+	}
+	fmt.Println("PASS")
+}
+
+// harness sends requests to an instance of the plugin backed by in-memory storage.
+type harness struct {
+	ctx      context.Context
+	backend  logical.Backend
+	storage  logical.Storage
+	password string
+	lease    *logical.Secret
+}
+
+func newHarness(logger hclog.Logger) (*harness, error) {
+	ctx := context.Background()
+	b := plugin.NewBackend(plugin.WithLogger(logger))
+	if err := b.Setup(ctx, &logical.BackendConfig{
+		Logger: logger,
+		System: &logical.StaticSystemView{
+			DefaultLeaseTTLVal: time.Hour,
+			MaxLeaseTTLVal:     24 * time.Hour,
+		},
+	}); err != nil {
+		return nil, err
+	}
+	return &harness{
+		ctx:     ctx,
+		backend: b,
+		storage: &logical.InmemStorage{},
+	}, nil
+}
+
+func (h *harness) request(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+	resp, err := h.backend.HandleRequest(h.ctx, &logical.Request{
+		Operation:   operation,
+		Path:        path,
+		Storage:     h.storage,
+		Data:        data,
+		EntityID:    borrower,
+		ClientToken: borrower,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp != nil && resp.IsError() {
+		return nil, resp.Error()
+	}
+	return resp, nil
+}
+
+func (h *harness) writeConfig(e *env) error {
+	data := map[string]interface{}{
+		"url":          e.url,
+		"binddn":       e.bindDN,
+		"bindpass":     e.bindPassword,
+		"userdn":       e.userDN,
+		"insecure_tls": e.insecureTLS,
+	}
+	if e.upnDomain != "" {
+		data["upndomain"] = e.upnDomain
+	}
+	if e.certificate != "" {
+		data["certificate"] = e.certificate
+	}
+	_, err := h.request(logical.UpdateOperation, "config", data)
+	return err
+}
+
+func (h *harness) createRole(serviceAccountName string) error {
+	_, err := h.request(logical.UpdateOperation, "roles/"+roleName, map[string]interface{}{
+		"service_account_name": serviceAccountName,
+	})
+	return err
+}
+
+// readCreds reads the role's creds, which sets its password in AD for the first time.
+func (h *harness) readCreds() error {
+	resp, err := h.request(logical.ReadOperation, "creds/"+roleName, nil)
+	if err != nil {
+		return err
+	}
+	password, _ := resp.Data["current_password"].(string)
+	if password == "" {
+		return errors.New("no password was returned")
+	}
+	h.password = password
+	return nil
+}
+
+func (h *harness) rotateRole() error {
+	if _, err := h.request(logical.UpdateOperation, "rotate-role/"+roleName, nil); err != nil {
+		return err
+	}
+	resp, err := h.request(logical.ReadOperation, "creds/"+roleName, nil)
+	if err != nil {
+		return err
+	}
+	if resp.Data["current_password"] == h.password {
+		return errors.New("the password didn't change")
+	}
+	if resp.Data["last_password"] != h.password {
+		return errors.New("the previous password wasn't kept as the last password")
+	}
+	return nil
+}
+
+func (h *harness) deleteRole() error {
+	_, err := h.request(logical.DeleteOperation, "roles/"+roleName, nil)
+	return err
+}
+
+func (h *harness) createSet(serviceAccountNames []string) error {
+	_, err := h.request(logical.CreateOperation, "library/"+setName, map[string]interface{}{
+		"service_account_names": serviceAccountNames,
+		"ttl":                   "10m",
+		"max_ttl":               "10m",
+	})
+	return err
+}
+
+func (h *harness) checkOut() error {
+	resp, err := h.request(logical.UpdateOperation, "library/"+setName+"/check-out", nil)
+	if err != nil {
+		return err
+	}
+	if resp.Secret == nil {
+		return errors.New("no lease was returned")
+	}
+	if password, _ := resp.Data["password"].(string); password == "" {
+		return errors.New("no password was returned")
+	}
+	h.lease = resp.Secret
+	return nil
+}
+
+func (h *harness) checkIn() error {
+	serviceAccountName, _ := h.lease.InternalData["service_account_name"].(string)
+	_, err := h.request(logical.UpdateOperation, "library/"+setName+"/check-in", map[string]interface{}{
+		"service_account_names": []string{serviceAccountName},
+	})
+	return err
+}
+
+func (h *harness) deleteSet() error {
+	_, err := h.request(logical.DeleteOperation, "library/"+setName, nil)
+	return err
+}
+
+// rotateRoot rotates the bind password and writes the new one to passwordFile,
+// since the config it's stored in is discarded when acctest exits.
+func (h *harness) rotateRoot(passwordFile string) error {
+	if _, err := h.request(logical.UpdateOperation, "rotate-root", nil); err != nil {
+		return err
+	}
+	entry, err := h.storage.Get(h.ctx, "config")
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return errors.New("the config is missing after rotating the bind password")
+	}
+	var config struct {
+		ADConf struct {
+			BindPassword string `json:"bindpass"`
+		}
+	}
+	if err := entry.DecodeJSON(&config); err != nil {
+		return err
+	}
+	if config.ADConf.BindPassword == "" {
+		return errors.New("no bind password was stored")
+	}
+	return os.WriteFile(passwordFile, []byte(config.ADConf.BindPassword+"\n"), 0o600)
+}
@@ -0,0 +1,13 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package version
+
+var (
+	// Version is the semantic version of the plugin.
+	Version = "v0.20.0-dev"
+
+	// GitCommit is the commit the plugin was built from. It's set at build
+	// time by scripts/build.sh.
+	GitCommit string
+)